@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"secure-payment-gateway/config"
+	"secure-payment-gateway/internal/core/domain"
+	"secure-payment-gateway/internal/core/ports"
+
+	"github.com/rs/zerolog"
+)
+
+// job is a periodic background task.
+type job struct {
+	name string
+	cfg  config.JobConfig
+	run  func(ctx context.Context) error
+}
+
+// scheduler runs each enabled job on its own interval until stopped.
+type scheduler struct {
+	jobs []job
+	log  zerolog.Logger
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// newScheduler creates a scheduler for the given jobs; nothing runs until Start.
+func newScheduler(log zerolog.Logger, jobs ...job) *scheduler {
+	return &scheduler{jobs: jobs, log: log}
+}
+
+// Start launches the enabled jobs. Each first runs one interval after Start,
+// and runs of the same job never overlap.
+func (s *scheduler) Start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+	for _, j := range s.jobs {
+		if !j.cfg.Enabled || j.cfg.Interval <= 0 {
+			s.log.Info().Str("job", j.name).Msg("Background job disabled")
+			continue
+		}
+		s.log.Info().Str("job", j.name).Dur("interval", j.cfg.Interval).Msg("Background job scheduled")
+		s.wg.Add(1)
+		go s.loop(ctx, j)
+	}
+}
+
+// Stop cancels the jobs and waits for runs in progress to return.
+func (s *scheduler) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+}
+
+func (s *scheduler) loop(ctx context.Context, j job) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(j.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			start := time.Now()
+			if err := j.run(ctx); err != nil && ctx.Err() == nil {
+				s.log.Error().Err(err).Str("job", j.name).Msg("Background job failed")
+				continue
+			}
+			s.log.Debug().Str("job", j.name).Dur("duration", time.Since(start)).Msg("Background job ran")
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// leaderGate runs the scheduler only while this instance holds the leader
+// lease, so replicas don't duplicate background work. It renews the lease
+// every renewEvery (well within its TTL) and stops the jobs as soon as a
+// renewal fails or the lease is lost, since another instance may take over.
+type leaderGate struct {
+	lease      ports.LeaderLease
+	renewEvery time.Duration
+	sched      *scheduler
+	log        zerolog.Logger
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// newLeaderGate creates a gate for sched; nothing runs until Start.
+func newLeaderGate(lease ports.LeaderLease, renewEvery time.Duration, sched *scheduler, log zerolog.Logger) *leaderGate {
+	return &leaderGate{lease: lease, renewEvery: renewEvery, sched: sched, log: log}
+}
+
+// Start begins campaigning for leadership.
+func (g *leaderGate) Start(ctx context.Context) {
+	ctx, g.cancel = context.WithCancel(ctx)
+	g.done = make(chan struct{})
+	go g.run(ctx)
+}
+
+// Stop stops the jobs if leading, releases the lease and waits for both.
+func (g *leaderGate) Stop() {
+	if g.cancel == nil {
+		return
+	}
+	g.cancel()
+	<-g.done
+}
+
+func (g *leaderGate) run(ctx context.Context) {
+	defer close(g.done)
+	ticker := time.NewTicker(g.renewEvery)
+	defer ticker.Stop()
+
+	leading := false
+	for {
+		held, err := g.lease.TryAcquire(ctx)
+		if err != nil && ctx.Err() == nil {
+			g.log.Warn().Err(err).Msg("Leader lease renewal failed")
+		}
+		switch {
+		case held && !leading:
+			g.log.Info().Msg("Elected leader, starting background jobs")
+			g.sched.Start(ctx)
+			leading = true
+		case !held && leading:
+			g.log.Warn().Msg("Lost leadership, stopping background jobs")
+			g.sched.Stop()
+			leading = false
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if leading {
+				g.sched.Stop()
+				releaseCtx, cancel := context.WithTimeout(context.Background(), g.renewEvery)
+				if err := g.lease.Release(releaseCtx); err != nil {
+					g.log.Warn().Err(err).Msg("Leader lease release failed")
+				}
+				cancel()
+			}
+			return
+		}
+	}
+}
+
+// idempotencyCleanupJob deletes database idempotency logs older than retention.
+func idempotencyCleanupJob(cfg config.JobConfig, repo ports.IdempotencyRepository, retention time.Duration, log zerolog.Logger) job {
+	return job{
+		name: "idempotency_cleanup",
+		cfg:  cfg,
+		run: func(ctx context.Context) error {
+			deleted, err := repo.DeleteOlderThan(ctx, time.Now().Add(-retention))
+			if err != nil {
+				return err
+			}
+			if deleted > 0 {
+				log.Info().Int64("deleted", deleted).Msg("Expired idempotency logs deleted")
+			}
+			return nil
+		},
+	}
+}
+
+// webhookLogCleanupJob deletes delivered webhook logs older than retention
+// and failed ones older than failedRetention. Pending logs may still be
+// retried, so they are left alone.
+func webhookLogCleanupJob(cfg config.JobConfig, repo ports.WebhookRepository, retention, failedRetention time.Duration, log zerolog.Logger) job {
+	return job{
+		name: "webhook_log_cleanup",
+		cfg:  cfg,
+		run: func(ctx context.Context) error {
+			now := time.Now()
+			for _, p := range []struct {
+				status domain.WebhookStatus
+				keep   time.Duration
+			}{
+				{domain.WebhookStatusDelivered, retention},
+				{domain.WebhookStatusFailed, failedRetention},
+			} {
+				deleted, err := repo.DeleteOlderThan(ctx, p.status, now.Add(-p.keep))
+				if err != nil {
+					return err
+				}
+				if deleted > 0 {
+					log.Info().Int64("deleted", deleted).Str("status", string(p.status)).Msg("Expired webhook delivery logs deleted")
+				}
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"secure-payment-gateway/config"
+	"secure-payment-gateway/internal/core/domain"
+	"secure-payment-gateway/internal/core/ports/mocks"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func countingJob(name string, cfg config.JobConfig, runs *atomic.Int32) job {
+	return job{name: name, cfg: cfg, run: func(context.Context) error {
+		runs.Add(1)
+		return nil
+	}}
+}
+
+func TestScheduler_DisabledJobNeverRuns(t *testing.T) {
+	var disabled, zeroInterval atomic.Int32
+	s := newScheduler(zerolog.New(io.Discard),
+		countingJob("disabled", config.JobConfig{Enabled: false, Interval: 5 * time.Millisecond}, &disabled),
+		countingJob("zero_interval", config.JobConfig{Enabled: true}, &zeroInterval),
+	)
+	s.Start(context.Background())
+	time.Sleep(50 * time.Millisecond)
+	s.Stop()
+
+	assert.Zero(t, disabled.Load())
+	assert.Zero(t, zeroInterval.Load())
+}
+
+func TestScheduler_EnabledJobRunsOnItsInterval(t *testing.T) {
+	var fast, slow atomic.Int32
+	s := newScheduler(zerolog.New(io.Discard),
+		countingJob("fast", config.JobConfig{Enabled: true, Interval: 10 * time.Millisecond}, &fast),
+		countingJob("slow", config.JobConfig{Enabled: true, Interval: time.Hour}, &slow),
+	)
+	s.Start(context.Background())
+
+	assert.Eventually(t, func() bool { return fast.Load() >= 3 }, time.Second, 5*time.Millisecond)
+	assert.Zero(t, slow.Load(), "the first run waits one interval")
+
+	s.Stop()
+	stopped := fast.Load()
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, stopped, fast.Load(), "no runs after Stop")
+}
+
+func TestScheduler_FailingJobKeepsRunning(t *testing.T) {
+	var runs atomic.Int32
+	s := newScheduler(zerolog.New(io.Discard), job{
+		name: "failing",
+		cfg:  config.JobConfig{Enabled: true, Interval: 5 * time.Millisecond},
+		run: func(context.Context) error {
+			runs.Add(1)
+			return errors.New("db down")
+		},
+	})
+	s.Start(context.Background())
+	defer s.Stop()
+
+	assert.Eventually(t, func() bool { return runs.Load() >= 2 }, time.Second, 5*time.Millisecond)
+}
+
+func TestIdempotencyCleanupJob_DeletesPastRetention(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockIdempotencyRepository(ctrl)
+	retention := 720 * time.Hour
+	repo.EXPECT().DeleteOlderThan(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, before time.Time) (int64, error) {
+			assert.WithinDuration(t, time.Now().Add(-retention), before, time.Minute)
+			return 3, nil
+		})
+
+	j := idempotencyCleanupJob(config.JobConfig{Enabled: true, Interval: time.Hour}, repo, retention, zerolog.New(io.Discard))
+	assert.Equal(t, "idempotency_cleanup", j.name)
+	assert.NoError(t, j.run(context.Background()))
+}
+
+func TestWebhookLogCleanupJob_KeepsFailedLogsLonger(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockWebhookRepository(ctrl)
+	retention, failedRetention := 720*time.Hour, 2160*time.Hour
+	cutoffs := map[domain.WebhookStatus]time.Time{}
+	repo.EXPECT().DeleteOlderThan(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, status domain.WebhookStatus, before time.Time) (int64, error) {
+			cutoffs[status] = before
+			return 2, nil
+		}).Times(2)
+
+	j := webhookLogCleanupJob(config.JobConfig{Enabled: true, Interval: time.Hour}, repo, retention, failedRetention, zerolog.New(io.Discard))
+	assert.Equal(t, "webhook_log_cleanup", j.name)
+	require.NoError(t, j.run(context.Background()))
+
+	require.Len(t, cutoffs, 2, "pending logs are never deleted")
+	assert.WithinDuration(t, time.Now().Add(-retention), cutoffs[domain.WebhookStatusDelivered], time.Minute)
+	assert.WithinDuration(t, time.Now().Add(-failedRetention), cutoffs[domain.WebhookStatusFailed], time.Minute)
+}
+
+func TestWebhookLogCleanupJob_StopsOnError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockWebhookRepository(ctrl)
+	repo.EXPECT().DeleteOlderThan(gomock.Any(), domain.WebhookStatusDelivered, gomock.Any()).Return(int64(0), errors.New("db down"))
+
+	j := webhookLogCleanupJob(config.JobConfig{Enabled: true, Interval: time.Hour}, repo, time.Hour, time.Hour, zerolog.New(io.Discard))
+	assert.Error(t, j.run(context.Background()))
+}
+
+// fakeLease is a ports.LeaderLease whose holder the test controls.
+type fakeLease struct {
+	held     atomic.Bool
+	fail     atomic.Bool
+	released atomic.Bool
+}
+
+func (l *fakeLease) TryAcquire(context.Context) (bool, error) {
+	if l.fail.Load() {
+		return false, errors.New("redis down")
+	}
+	return l.held.Load(), nil
+}
+
+func (l *fakeLease) Release(context.Context) error {
+	l.released.Store(true)
+	return nil
+}
+
+func TestLeaderGate_RunsJobsOnlyWhileLeading(t *testing.T) {
+	var runs atomic.Int32
+	lease := &fakeLease{}
+	sched := newScheduler(zerolog.New(io.Discard),
+		countingJob("cleanup", config.JobConfig{Enabled: true, Interval: 5 * time.Millisecond}, &runs))
+	gate := newLeaderGate(lease, 5*time.Millisecond, sched, zerolog.New(io.Discard))
+	gate.Start(context.Background())
+	defer gate.Stop()
+
+	// Follower: jobs never run
+	time.Sleep(30 * time.Millisecond)
+	assert.Zero(t, runs.Load())
+
+	// Elected: jobs start
+	lease.held.Store(true)
+	assert.Eventually(t, func() bool { return runs.Load() >= 2 }, time.Second, 5*time.Millisecond)
+
+	// Lost leadership: jobs stop
+	lease.held.Store(false)
+	time.Sleep(20 * time.Millisecond)
+	stopped := runs.Load()
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, stopped, runs.Load())
+}
+
+func TestLeaderGate_StopsJobsWhenRenewalFails(t *testing.T) {
+	var runs atomic.Int32
+	lease := &fakeLease{}
+	lease.held.Store(true)
+	sched := newScheduler(zerolog.New(io.Discard),
+		countingJob("cleanup", config.JobConfig{Enabled: true, Interval: 5 * time.Millisecond}, &runs))
+	gate := newLeaderGate(lease, 5*time.Millisecond, sched, zerolog.New(io.Discard))
+	gate.Start(context.Background())
+	defer gate.Stop()
+
+	assert.Eventually(t, func() bool { return runs.Load() >= 1 }, time.Second, 5*time.Millisecond)
+
+	// Another instance may take over once the lease expires unrenewed
+	lease.fail.Store(true)
+	time.Sleep(20 * time.Millisecond)
+	stopped := runs.Load()
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, stopped, runs.Load())
+}
+
+func TestLeaderGate_StopReleasesLease(t *testing.T) {
+	lease := &fakeLease{}
+	lease.held.Store(true)
+	sched := newScheduler(zerolog.New(io.Discard))
+	gate := newLeaderGate(lease, 5*time.Millisecond, sched, zerolog.New(io.Discard))
+	gate.Start(context.Background())
+	time.Sleep(10 * time.Millisecond)
+	gate.Stop()
+
+	assert.True(t, lease.released.Load())
+}
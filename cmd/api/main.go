@@ -10,12 +10,22 @@ import (
 	"time"
 
 	"secure-payment-gateway/config"
+	"secure-payment-gateway/internal/adapter/http/dto"
 	httpHandler "secure-payment-gateway/internal/adapter/http/handler"
+	"secure-payment-gateway/internal/adapter/http/middleware"
+	memoryStorage "secure-payment-gateway/internal/adapter/storage/memory"
 	pgStorage "secure-payment-gateway/internal/adapter/storage/postgres"
 	redisStorage "secure-payment-gateway/internal/adapter/storage/redis"
+	"secure-payment-gateway/internal/core/domain"
 	"secure-payment-gateway/internal/core/ports"
 	"secure-payment-gateway/internal/service"
 	"secure-payment-gateway/pkg/logger"
+	"secure-payment-gateway/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
 )
 
 func main() {
@@ -44,13 +54,18 @@ func main() {
 	defer pool.Close()
 	log.Info().Msg("PostgreSQL connected")
 
-	// Initialize Redis client
-	rdb, err := redisStorage.NewClient(ctx, cfg.Redis, log)
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to connect to Redis")
+	// Initialize Redis client, unless every store is in memory
+	var rdb *goredis.Client
+	if cfg.RequiresRedis() {
+		rdb, err = redisStorage.NewClient(ctx, cfg.Redis, log)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to connect to Redis")
+		}
+		defer rdb.Close()
+		log.Info().Msg("Redis connected")
+	} else {
+		log.Info().Msg("All stores in memory, Redis not used")
 	}
-	defer rdb.Close()
-	log.Info().Msg("Redis connected")
 
 	// Initialize repositories
 	merchantRepo := pgStorage.NewMerchantRepo(pool)
@@ -59,21 +74,94 @@ func main() {
 	idempotencyRepo := pgStorage.NewIdempotencyRepo(pool)
 	transactor := pgStorage.NewTransactor(pool)
 
-	// Initialize Redis stores
-	idempotencyCache := redisStorage.NewIdempotencyCache(rdb)
-	nonceStore := redisStorage.NewNonceStore(rdb)
+	// Initialize idempotency and nonce stores (Redis or in-memory)
+	idempotencyCache, err := newIdempotencyCache(cfg.Idempotency, rdb)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize idempotency cache")
+	}
+	log.Info().Str("backend", cfg.Idempotency.Backend).Msg("Idempotency cache ready")
+	inFlightMode, err := newInFlightMode(cfg.Idempotency.InFlight)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid idempotency in-flight mode")
+	}
+	referenceDayLoc, err := newReferenceDayLocation(cfg.Payment)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid reference scope")
+	}
+	nonceStore, closeNonceStore, err := newNonceStore(cfg.Nonce, rdb)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize nonce store")
+	}
+	defer closeNonceStore()
+	if cfg.Nonce.Backend == config.BackendMemory {
+		log.Warn().Msg("In-memory nonce store: replays are only detected per instance; do not run more than one instance")
+	}
+	nonceScope, err := newNonceScope(cfg.Nonce.Scope)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid nonce scope")
+	}
+	signatureHeaders, err := newSignatureHeaders(cfg.HMAC)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid HMAC header names")
+	}
+	secretExpiry, err := newSecretExpiry(cfg.Security)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid secret expiry")
+	}
+	refreshCookie, err := newRefreshCookie(cfg.Security)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid refresh cookie settings")
+	}
+	trustedProxies, err := httpHandler.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid trusted proxies")
+	}
+	swaggerAccounts, err := newSwaggerAccounts(cfg.Swagger)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid swagger settings")
+	}
 
 	// Initialize core services
 	encSvc, err := service.NewAESEncryptionService(cfg.AES.Key)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to initialize encryption service")
 	}
+	encHealth := service.NewEncryptionHealthCheck(encSvc)
+	if err := encHealth.Ping(ctx); err != nil {
+		log.Fatal().Err(err).Msg("Encryption self-check failed")
+	}
 	sigSvc := service.NewHMACSignatureService()
 	hashSvc := service.NewArgon2HashService()
-	tokenSvc := service.NewJWTTokenService(cfg.JWT.Secret, cfg.JWT.Expiry, cfg.JWT.Issuer)
+	tokenSvc := service.NewJWTTokenService(cfg.JWT.Secret, cfg.JWT.Expiry, cfg.JWT.Issuer,
+		service.WithRefreshExpiry(cfg.JWT.RefreshExpiry),
+	)
 
 	// Initialize business services
-	authSvc := service.NewAuthService(merchantRepo, walletRepo, hashSvc, encSvc, tokenSvc)
+	// Shared by registrations, payments and key rotations; their keys never overlap
+	inFlightLock := newInFlightLock(cfg.Idempotency, rdb)
+	authOpts := []service.AuthOption{
+		service.WithRegisterIdempotency(idempotencyCache, inFlightLock),
+		service.WithMaxSessionExpiry(cfg.JWT.MaxSessionExpiry),
+		service.WithAuthLogger(log),
+		// Refresh token IDs share the nonce store: both are single-use IDs with a TTL
+		service.WithRefreshRotation(nonceStore),
+	}
+	if cfg.Registration.RequireWebhookURL {
+		authOpts = append(authOpts, service.WithRequiredWebhookURL())
+	}
+	authSvc := service.NewAuthService(merchantRepo, walletRepo, transactor, hashSvc, encSvc, tokenSvc, authOpts...)
+	auditRepo := pgStorage.NewAuditRepository(pool)
+	auditSvc := service.NewAuditService(auditRepo, log)
+	// Email/SMS notifications (optional); no provider is integrated yet, so
+	// both channels log
+	var notifier ports.NotificationService
+	if cfg.Notifications.Enabled {
+		logNotifier := service.NewLogNotifier(log)
+		notifier = service.NewNotificationService(merchantRepo, log,
+			service.WithNotifier(domain.NotificationChannelEmail, logNotifier),
+			service.WithNotifier(domain.NotificationChannelSMS, logNotifier),
+		)
+	}
 	paymentSvc := service.NewPaymentService(
 		txRepo,
 		walletRepo,
@@ -82,20 +170,66 @@ func main() {
 		encSvc,
 		transactor,
 		log,
+		service.WithTopupLimits(service.TopupLimits{
+			Min:      cfg.Payment.TopupMin,
+			Max:      cfg.Payment.TopupMax,
+			DailyCap: cfg.Payment.TopupDailyCap,
+		}),
+		service.WithReplayRefetch(cfg.Idempotency.RefetchOnReplay),
+		service.WithAutoCreateWallets(cfg.Payment.AutoCreateWallets),
+		service.WithRefundToCurrencyWallet(cfg.Payment.RefundToCurrencyWallet),
+		service.WithMaxExtraDataBytes(cfg.Payment.ExtraDataMaxBytes),
+		service.WithTopupIncrements(cfg.Payment.TopupIncrements),
+		service.WithMaxConcurrentPayments(cfg.Payment.MaxConcurrentPerMerchant),
+		service.WithDailyTransactionLimit(cfg.Payment.DailyTransactionLimit),
+		service.WithMaxRefundsPerTransaction(cfg.Payment.MaxRefundsPerTransaction),
+		service.WithRejectReferenceCollisions(cfg.Payment.RejectReferenceCollisions),
+		service.WithDailyReferences(referenceDayLoc),
+		service.WithInFlightLock(inFlightLock, inFlightMode, cfg.Idempotency.InFlightWait),
+		service.WithPaymentAudit(auditSvc),
+		service.WithLargeRefundNotifications(notifier, cfg.Notifications.LargeRefundThreshold),
+	)
+	reportingSvc := service.NewReportingService(txRepo, walletRepo, encSvc,
+		service.WithExportLimits(service.ExportLimits{
+			MaxRows:          cfg.Export.MaxRows,
+			UnboundedMaxRows: cfg.Export.UnboundedMaxRows,
+		}),
+		service.WithReportingLogger(log),
+		service.WithPrimaryCurrencies(merchantRepo),
 	)
-	reportingSvc := service.NewReportingService(txRepo, walletRepo, encSvc)
 	webhookRepo := pgStorage.NewWebhookRepository(pool)
-	webhookSvc := service.NewWebhookService(merchantRepo, walletRepo, encSvc, sigSvc, &http.Client{Timeout: 10 * time.Second}, log, webhookRepo)
-	merchantSvc := service.NewMerchantService(merchantRepo, encSvc)
-	auditRepo := pgStorage.NewAuditRepository(pool)
-	auditSvc := service.NewAuditService(auditRepo, log)
+	webhookSvc := service.NewWebhookService(merchantRepo, walletRepo, encSvc, sigSvc, &http.Client{Timeout: 10 * time.Second}, log, webhookRepo,
+		service.WithPayloadEncryption(cfg.Webhook.EncryptPayloads),
+	)
+	merchantSvc := service.NewMerchantService(merchantRepo, encSvc,
+		service.WithSecretMaxAge(cfg.Security.SecretMaxAge),
+		service.WithMerchantNotifications(notifier),
+		service.WithRotateKeysIdempotency(idempotencyCache, inFlightLock),
+	)
+	// Signed receipts (optional — requires an Ed25519 signing key)
+	var receiptSvc ports.ReceiptService
+	if cfg.Receipt.SigningKey != "" {
+		receiptSigner, err := service.NewEd25519ReceiptSigner(cfg.Receipt.SigningKey)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to initialize receipt signer")
+		}
+		receiptSvc = service.NewReceiptService(txRepo, walletRepo, merchantRepo, receiptSigner)
+	} else {
+		log.Warn().Msg("Receipt signing key not set, signed receipts disabled")
+	}
 
 	// Initialize rate limit store
-	rateLimitStore := redisStorage.NewRateLimitStore(rdb)
+	rateLimitStore, rateLimitFallback, err := newRateLimiter(cfg.RateLimit, rdb)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize rate limiter")
+	}
 
 	// Initialize health checkers
-	pgHealth := pgStorage.NewHealthCheck(pool)
-	redisHealth := redisStorage.NewHealthCheck(rdb)
+	healthCheckers := []ports.HealthChecker{pgStorage.NewHealthCheck(pool)}
+	if rdb != nil {
+		healthCheckers = append(healthCheckers, redisStorage.NewHealthCheck(rdb))
+	}
+	healthCheckers = append(healthCheckers, encHealth)
 
 	// Load OpenAPI spec for Swagger UI
 	if specBytes, err := os.ReadFile("docs/api/openapi.yaml"); err == nil {
@@ -105,6 +239,13 @@ func main() {
 		log.Warn().Err(err).Msg("OpenAPI spec not found, Swagger UI will be unavailable")
 	}
 
+	// Request validation limits
+	dto.SetMaxReferenceIDLength(cfg.Payment.MaxReferenceIDLength)
+	dto.SetExtraDataJSON(cfg.Payment.ExtraDataJSON)
+
+	// ?pretty=true indented responses, for debugging outside release mode
+	response.SetPrettyQueryEnabled(cfg.Server.Mode != "release")
+
 	// Setup Gin router with all routes
 	router := httpHandler.SetupRouter(httpHandler.RouterDeps{
 		AuthSvc:        authSvc,
@@ -115,22 +256,61 @@ func main() {
 		EncSvc:         encSvc,
 		SigSvc:         sigSvc,
 		NonceStore:     nonceStore,
+		NonceScope:     nonceScope,
 		TokenSvc:       tokenSvc,
 		RateLimitStore: rateLimitStore,
-		HealthCheckers: []ports.HealthChecker{pgHealth, redisHealth},
+		RateLimitLocal: rateLimitFallback,
+		HealthCheckers: healthCheckers,
 		MerchantSvc:    merchantSvc,
 		AuditSvc:       auditSvc,
-		Logger:         log,
+		ReceiptSvc:     receiptSvc,
+		Security: middleware.SecurityHeadersConfig{
+			HSTS:       cfg.Security.HSTS,
+			HSTSMaxAge: cfg.Security.HSTSMaxAge,
+		},
+		JSONLimits: middleware.JSONLimitsConfig{
+			MaxDepth: cfg.Request.JSONMaxDepth,
+			MaxKeys:  cfg.Request.JSONMaxKeys,
+		},
+		TimestampDrift: middleware.TimestampDrift{
+			Past:   cfg.HMAC.MaxPastDrift,
+			Future: cfg.HMAC.MaxFutureDrift,
+		},
+		SignatureHeaders: signatureHeaders,
+		FailedBodyLog: middleware.FailedBodyLogConfig{
+			Enabled:    cfg.Request.LogFailedBodies,
+			ServerMode: cfg.Server.Mode,
+			MaxBytes:   cfg.Request.LogBodyMaxBytes,
+		},
+		MaxInFlight:        cfg.Request.MaxInFlight,
+		IdempotencyHeaders: cfg.Idempotency.Headers,
+		BatchIdempotency:   idempotencyCache,
+		AdminAPIKey:        cfg.Admin.APIKey,
+		SecretExpiry:       secretExpiry,
+		RefreshCookie:      refreshCookie,
+		TrustedProxies:     trustedProxies,
+		BodySizes:          middleware.NewBodySizeMetrics(),
+		Swagger: httpHandler.SwaggerAccess{
+			Disabled: !cfg.Swagger.Enabled(cfg.Server.Mode),
+			Accounts: swaggerAccounts,
+		},
+		Logger: log,
 	})
 
-	// HTTP Server with graceful shutdown
-	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
-	srv := &http.Server{
-		Addr:              addr,
-		Handler:           router,
-		ReadHeaderTimeout: 10 * time.Second,
+	// Background jobs
+	jobs := newScheduler(log,
+		idempotencyCleanupJob(cfg.Jobs.IdempotencyCleanup, idempotencyRepo, cfg.Idempotency.LogRetention, log),
+		webhookLogCleanupJob(cfg.Jobs.WebhookLogCleanup, webhookRepo, cfg.Webhook.LogRetention, cfg.Webhook.FailedLogRetention, log),
+	)
+	jobRunner, err := startJobs(ctx, cfg.Jobs, jobs, rdb, log)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid jobs settings")
 	}
 
+	// HTTP Server with graceful shutdown
+	srv := newHTTPServer(cfg.Server, router)
+	addr := srv.Addr
+
 	// Start server in goroutine
 	go func() {
 		log.Info().Str("addr", addr).Msg("HTTP server listening")
@@ -151,6 +331,217 @@ func main() {
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		log.Error().Err(err).Msg("Server forced to shutdown")
 	}
+	jobRunner.Stop()
+	webhookSvc.Stop()
 
 	log.Info().Msg("Server exited")
 }
+
+// newHTTPServer builds the API server with the configured listen address and
+// timeouts.
+func newHTTPServer(cfg config.ServerConfig, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+// minJobLeaseTTL is the shortest jobs.lease_ttl accepted. The leader renews
+// every lease_ttl/3, so a shorter lease would be renewed more than once a
+// second and lost on any Redis hiccup.
+const minJobLeaseTTL = 3 * time.Second
+
+// startJobs starts the background jobs, behind a Redis leader lease when
+// leader election is enabled, and returns what to stop on shutdown.
+func startJobs(ctx context.Context, cfg config.JobsConfig, jobs *scheduler, rdb *goredis.Client, log zerolog.Logger) (interface{ Stop() }, error) {
+	if !cfg.LeaderElection {
+		jobs.Start(ctx)
+		return jobs, nil
+	}
+	if cfg.LeaseTTL < minJobLeaseTTL {
+		return nil, fmt.Errorf("jobs.lease_ttl %s is too short, must be at least %s", cfg.LeaseTTL, minJobLeaseTTL)
+	}
+	lease := redisStorage.NewLeaderLease(rdb, "jobs", instanceID(), cfg.LeaseTTL)
+	gate := newLeaderGate(lease, cfg.LeaseTTL/3, jobs, log)
+	gate.Start(ctx)
+	return gate, nil
+}
+
+// instanceID identifies this process in the leader lease.
+func instanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return host + "-" + uuid.NewString()
+}
+
+// newSwaggerAccounts returns basic-auth credentials for the API docs, or nil
+// when no username is configured. A username without a password is rejected:
+// it would let anyone who guesses the username in.
+func newSwaggerAccounts(cfg config.SwaggerConfig) (gin.Accounts, error) {
+	if cfg.Username == "" {
+		return nil, nil
+	}
+	if cfg.Password == "" {
+		return nil, fmt.Errorf("swagger.password is required when swagger.username is set")
+	}
+	return gin.Accounts{cfg.Username: cfg.Password}, nil
+}
+
+// newIdempotencyCache builds the configured idempotency cache backend.
+func newIdempotencyCache(cfg config.IdempotencyConfig, rdb *goredis.Client) (ports.IdempotencyCache, error) {
+	switch cfg.Backend {
+	case config.BackendRedis:
+		return redisStorage.NewIdempotencyCache(rdb), nil
+	case config.BackendMemory:
+		return memoryStorage.NewIdempotencyCache(cfg.MaxEntries), nil
+	default:
+		return nil, fmt.Errorf("unknown idempotency backend %q (want %s or %s)",
+			cfg.Backend, config.BackendRedis, config.BackendMemory)
+	}
+}
+
+// newRateLimiter builds the configured rate limit backend: the Redis store,
+// with the local limiter as its fallback when enabled, or the local limiter
+// alone for the memory backend.
+func newRateLimiter(cfg config.RateLimitConfig, rdb *goredis.Client) (*redisStorage.RateLimitStore, *middleware.LocalRateLimiter, error) {
+	switch cfg.Backend {
+	case config.BackendRedis:
+		var fallback *middleware.LocalRateLimiter
+		if cfg.LocalFallback {
+			fallback = middleware.NewLocalRateLimiter()
+		}
+		return redisStorage.NewRateLimitStore(rdb), fallback, nil
+	case config.BackendMemory:
+		return nil, middleware.NewLocalRateLimiter(), nil
+	default:
+		return nil, nil, fmt.Errorf("unknown ratelimit backend %q (want %s or %s)",
+			cfg.Backend, config.BackendRedis, config.BackendMemory)
+	}
+}
+
+// newInFlightLock builds the in-flight lock matching the idempotency backend,
+// so duplicates are detected across instances exactly when cached results are.
+func newInFlightLock(cfg config.IdempotencyConfig, rdb *goredis.Client) ports.InFlightLock {
+	if cfg.Backend == config.BackendMemory {
+		return memoryStorage.NewInFlightLock()
+	}
+	return redisStorage.NewInFlightLock(rdb)
+}
+
+// newInFlightMode validates the configured handling of in-flight duplicates.
+func newInFlightMode(mode string) (service.InFlightMode, error) {
+	switch m := service.InFlightMode(mode); m {
+	case service.InFlightBlock, service.InFlightConflict:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown idempotency in_flight mode %q (want %s or %s)",
+			mode, service.InFlightBlock, service.InFlightConflict)
+	}
+}
+
+// newReferenceDayLocation returns the time zone days are counted in for
+// daily-scoped references, or nil if references are globally unique.
+func newReferenceDayLocation(cfg config.PaymentConfig) (*time.Location, error) {
+	switch scope := domain.ReferenceScope(cfg.ReferenceScope); scope {
+	case domain.ReferenceScopeGlobal:
+		return nil, nil
+	case domain.ReferenceScopeDaily:
+		loc, err := time.LoadLocation(cfg.ReferenceTimezone)
+		if err != nil {
+			return nil, fmt.Errorf("reference_timezone: %w", err)
+		}
+		return loc, nil
+	default:
+		return nil, fmt.Errorf("unknown payment reference_scope %q (want %s or %s)",
+			cfg.ReferenceScope, domain.ReferenceScopeGlobal, domain.ReferenceScopeDaily)
+	}
+}
+
+// newNonceStore builds the configured nonce store and a func releasing it.
+func newNonceStore(cfg config.NonceConfig, rdb *goredis.Client) (ports.NonceStore, func(), error) {
+	switch cfg.Backend {
+	case config.BackendRedis:
+		return redisStorage.NewNonceStore(rdb), func() {}, nil
+	case config.BackendMemory:
+		store := memoryStorage.NewNonceStore(cfg.SweepInterval)
+		return store, store.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown nonce backend %q (want %s or %s)",
+			cfg.Backend, config.BackendRedis, config.BackendMemory)
+	}
+}
+
+// newNonceScope validates the configured nonce uniqueness scope.
+func newNonceScope(scope string) (middleware.NonceScope, error) {
+	switch s := middleware.NonceScope(scope); s {
+	case middleware.NonceScopeMerchant, middleware.NonceScopeEndpoint:
+		return s, nil
+	default:
+		return "", fmt.Errorf("unknown nonce scope %q (want %s or %s)",
+			scope, middleware.NonceScopeMerchant, middleware.NonceScopeEndpoint)
+	}
+}
+
+// newSignatureHeaders validates the configured HMAC header names: empty
+// names keep the defaults, and no two may name the same header.
+func newSignatureHeaders(cfg config.HMACConfig) (middleware.SignatureHeaders, error) {
+	headers := middleware.SignatureHeaders{
+		AccessKey: cfg.AccessKeyHeader,
+		Signature: cfg.SignatureHeader,
+		Timestamp: cfg.TimestampHeader,
+		Nonce:     cfg.NonceHeader,
+	}.WithDefaults()
+	seen := make(map[string]bool, 4)
+	for _, name := range []string{headers.AccessKey, headers.Signature, headers.Timestamp, headers.Nonce} {
+		canonical := http.CanonicalHeaderKey(name)
+		if seen[canonical] {
+			return middleware.SignatureHeaders{}, fmt.Errorf("header %q is configured for more than one HMAC credential", name)
+		}
+		seen[canonical] = true
+	}
+	return headers, nil
+}
+
+// newSecretExpiry validates the configured API secret expiry action.
+func newSecretExpiry(cfg config.SecurityConfig) (middleware.SecretExpiry, error) {
+	switch cfg.SecretExpiryAction {
+	case config.SecretExpiryWarn, config.SecretExpiryBlock:
+		return middleware.SecretExpiry{
+			MaxAge: cfg.SecretMaxAge,
+			Block:  cfg.SecretExpiryAction == config.SecretExpiryBlock,
+		}, nil
+	default:
+		return middleware.SecretExpiry{}, fmt.Errorf("unknown secret expiry action %q (want %s or %s)",
+			cfg.SecretExpiryAction, config.SecretExpiryWarn, config.SecretExpiryBlock)
+	}
+}
+
+// newRefreshCookie builds the dashboard refresh cookie settings, or nil when
+// refresh cookies are disabled.
+func newRefreshCookie(cfg config.SecurityConfig) (*httpHandler.RefreshCookie, error) {
+	if !cfg.RefreshCookie {
+		return nil, nil
+	}
+	var sameSite http.SameSite
+	switch cfg.RefreshCookieSameSite {
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "lax":
+		sameSite = http.SameSiteLaxMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	default:
+		return nil, fmt.Errorf("unknown refresh cookie same_site %q (want strict, lax or none)", cfg.RefreshCookieSameSite)
+	}
+	return &httpHandler.RefreshCookie{
+		Domain:     cfg.RefreshCookieDomain,
+		SameSite:   sameSite,
+		RequireTLS: cfg.RequireTLS,
+	}, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"secure-payment-gateway/config"
+	"secure-payment-gateway/internal/adapter/http/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHTTPServer_AppliesTimeouts(t *testing.T) {
+	handler := http.NewServeMux()
+	srv := newHTTPServer(config.ServerConfig{
+		Host:              "127.0.0.1",
+		Port:              9090,
+		ReadTimeout:       5 * time.Second,
+		ReadHeaderTimeout: 2 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       90 * time.Second,
+	}, handler)
+
+	assert.Equal(t, "127.0.0.1:9090", srv.Addr)
+	assert.Same(t, handler, srv.Handler)
+	assert.Equal(t, 5*time.Second, srv.ReadTimeout)
+	assert.Equal(t, 2*time.Second, srv.ReadHeaderTimeout)
+	assert.Equal(t, 30*time.Second, srv.WriteTimeout)
+	assert.Equal(t, 90*time.Second, srv.IdleTimeout)
+}
+
+func TestNewSignatureHeaders(t *testing.T) {
+	headers, err := newSignatureHeaders(config.HMACConfig{AccessKeyHeader: "X-Api-Key", NonceHeader: "X-Request-Nonce"})
+	require.NoError(t, err)
+	assert.Equal(t, middleware.SignatureHeaders{
+		AccessKey: "X-Api-Key",
+		Signature: middleware.HeaderSignature,
+		Timestamp: middleware.HeaderTimestamp,
+		Nonce:     "X-Request-Nonce",
+	}, headers)
+
+	_, err = newSignatureHeaders(config.HMACConfig{NonceHeader: "x-timestamp"})
+	assert.Error(t, err, "header names are case-insensitive")
+}
+
+func TestNewSwaggerAccounts(t *testing.T) {
+	accounts, err := newSwaggerAccounts(config.SwaggerConfig{})
+	require.NoError(t, err)
+	assert.Nil(t, accounts, "no username means no basic auth")
+
+	accounts, err = newSwaggerAccounts(config.SwaggerConfig{Username: "docs", Password: "s3cret"})
+	require.NoError(t, err)
+	assert.Equal(t, gin.Accounts{"docs": "s3cret"}, accounts)
+
+	_, err = newSwaggerAccounts(config.SwaggerConfig{Username: "docs"})
+	assert.Error(t, err, "an empty password would accept any client that knows the username")
+}
+
+func TestStartJobs_RejectsShortLeaseTTL(t *testing.T) {
+	// Rejected before the lease touches Redis
+	_, err := startJobs(context.Background(), config.JobsConfig{LeaderElection: true, LeaseTTL: 900 * time.Millisecond}, nil, nil, zerolog.Nop())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "jobs.lease_ttl 900ms is too short")
+}
+
+func TestNewRateLimiter(t *testing.T) {
+	store, local, err := newRateLimiter(config.RateLimitConfig{Backend: config.BackendMemory, LocalFallback: false}, nil)
+	require.NoError(t, err)
+	assert.Nil(t, store, "the memory backend needs no Redis client")
+	assert.NotNil(t, local)
+
+	store, local, err = newRateLimiter(config.RateLimitConfig{Backend: config.BackendRedis}, nil)
+	require.NoError(t, err)
+	assert.NotNil(t, store)
+	assert.Nil(t, local, "no fallback unless local_fallback is set")
+
+	_, _, err = newRateLimiter(config.RateLimitConfig{Backend: "memcached"}, nil)
+	assert.Error(t, err)
+}
@@ -16,12 +16,41 @@ type Config struct {
 	JWT      JWTConfig      `mapstructure:"jwt"`
 	AES      AESConfig      `mapstructure:"aes"`
 	Log      LogConfig      `mapstructure:"log"`
+	Payment  PaymentConfig  `mapstructure:"payment"`
+	Receipt  ReceiptConfig  `mapstructure:"receipt"`
+	Export   ExportConfig   `mapstructure:"export"`
+	Security SecurityConfig `mapstructure:"security"`
+	Swagger  SwaggerConfig  `mapstructure:"swagger"`
+
+	Idempotency IdempotencyConfig `mapstructure:"idempotency"`
+	Nonce       NonceConfig       `mapstructure:"nonce"`
+	RateLimit   RateLimitConfig   `mapstructure:"ratelimit"`
+	Request     RequestConfig     `mapstructure:"request"`
+	HMAC        HMACConfig        `mapstructure:"hmac"`
+	Admin       AdminConfig       `mapstructure:"admin"`
+
+	Registration RegistrationConfig `mapstructure:"registration"`
+	Jobs         JobsConfig         `mapstructure:"jobs"`
+	Webhook      WebhookConfig      `mapstructure:"webhook"`
+
+	Notifications NotificationsConfig `mapstructure:"notifications"`
 }
 
 type ServerConfig struct {
 	Host string `mapstructure:"host"`
 	Port int    `mapstructure:"port"`
 	Mode string `mapstructure:"mode"` // debug, release, test
+
+	// http.Server timeouts; they bound slow or idle clients (slowloris).
+	// WriteTimeout must also cover the slowest handler, e.g. CSV exports.
+	ReadTimeout       time.Duration `mapstructure:"read_timeout"`
+	ReadHeaderTimeout time.Duration `mapstructure:"read_header_timeout"`
+	WriteTimeout      time.Duration `mapstructure:"write_timeout"`
+	IdleTimeout       time.Duration `mapstructure:"idle_timeout"` // keep-alive
+
+	// Proxy IPs or CIDR ranges whose X-Forwarded-For/-Proto headers are
+	// believed, for client IPs and security.require_tls. Empty = none.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 type DatabaseConfig struct {
@@ -57,20 +86,249 @@ func (r RedisConfig) Addr() string {
 }
 
 type JWTConfig struct {
-	Secret string        `mapstructure:"secret"`
-	Expiry time.Duration `mapstructure:"expiry"`
-	Issuer string        `mapstructure:"issuer"`
+	Secret        string        `mapstructure:"secret"`
+	Expiry        time.Duration `mapstructure:"expiry"`
+	Issuer        string        `mapstructure:"issuer"`
+	RefreshExpiry time.Duration `mapstructure:"refresh_expiry"` // dashboard refresh tokens (security.refresh_cookie)
+
+	// Longest per-merchant session expiry override honoured; longer
+	// overrides are clamped to it. 0 = no cap
+	MaxSessionExpiry time.Duration `mapstructure:"max_session_expiry"`
 }
 
 type AESConfig struct {
 	Key string `mapstructure:"key"` // 32-byte hex-encoded key for AES-256
 }
 
+type ReceiptConfig struct {
+	SigningKey string `mapstructure:"signing_key"` // 32-byte hex Ed25519 seed; empty disables receipts
+}
+
+type ExportConfig struct {
+	MaxRows          int `mapstructure:"max_rows"`           // Hard cap per CSV export
+	UnboundedMaxRows int `mapstructure:"unbounded_max_rows"` // Above this, from+to are required
+}
+
+type SecurityConfig struct {
+	HSTS       bool          `mapstructure:"hsts"` // Strict-Transport-Security; off in dev, enable behind TLS
+	HSTSMaxAge time.Duration `mapstructure:"hsts_max_age"`
+
+	// SecretMaxAge is how long an API secret stays valid after registration
+	// or the last rotation; 0 = no expiry. SecretExpiryAction is what HMAC
+	// requests signed with an expired secret get: SecretExpiryWarn or
+	// SecretExpiryBlock.
+	SecretMaxAge       time.Duration `mapstructure:"secret_max_age"`
+	SecretExpiryAction string        `mapstructure:"secret_expiry_action"`
+
+	// RefreshCookie makes dashboard logins also set a Secure, HttpOnly
+	// refresh token cookie with the given SameSite mode and domain.
+	// RequireTLS rejects cookie logins and refreshes made over plain HTTP.
+	RefreshCookie         bool   `mapstructure:"refresh_cookie"`
+	RefreshCookieSameSite string `mapstructure:"refresh_cookie_same_site"` // strict | lax | none
+	RefreshCookieDomain   string `mapstructure:"refresh_cookie_domain"`    // empty = host-only
+	RequireTLS            bool   `mapstructure:"require_tls"`
+}
+
+// Actions for SecurityConfig.SecretExpiryAction.
+const (
+	SecretExpiryWarn  = "warn"  // allow, with an X-Secret-Key-Warning: SEC_005 header
+	SecretExpiryBlock = "block" // reject with 403 SEC_005
+)
+
+type SwaggerConfig struct {
+	ReleaseEnabled bool   `mapstructure:"release_enabled"` // serve Swagger when server.mode is release
+	Username       string `mapstructure:"username"`        // basic auth; empty = no auth
+	Password       string `mapstructure:"password"`
+}
+
+// Enabled reports whether Swagger should be served in the given server mode.
+func (s SwaggerConfig) Enabled(mode string) bool {
+	return mode != "release" || s.ReleaseEnabled
+}
+
+// RegistrationConfig controls merchant self-registration.
+type RegistrationConfig struct {
+	// Reject registrations without an https webhook_url whose host resolves
+	RequireWebhookURL bool `mapstructure:"require_webhook_url"`
+}
+
+// WebhookConfig controls webhook delivery logs.
+type WebhookConfig struct {
+	// Store delivery log payloads (amounts, references) encrypted with the
+	// AES key; only the owning merchant's delivery detail decrypts them
+	EncryptPayloads bool `mapstructure:"encrypt_payloads"`
+	// How long the webhook_log_cleanup job keeps delivered logs, and failed
+	// (dead-letter) logs, which are kept longer for investigation. Pending
+	// logs are never deleted.
+	LogRetention       time.Duration `mapstructure:"log_retention"`
+	FailedLogRetention time.Duration `mapstructure:"failed_log_retention"`
+}
+
+// NotificationsConfig controls email/SMS notifications to merchants, sent
+// besides webhooks on the events each merchant opts into.
+type NotificationsConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Refunds of at least this amount, in minor units, raise large_refund;
+	// 0 = never
+	LargeRefundThreshold int64 `mapstructure:"large_refund_threshold"`
+}
+
+// AdminConfig guards the operator-only /api/v1/admin routes.
+type AdminConfig struct {
+	APIKey string `mapstructure:"api_key"` // sent as X-Admin-Key; empty = admin routes disabled (404)
+}
+
+// Backends for the Redis-backed stores that also have an in-process
+// implementation for deployments without Redis.
+const (
+	BackendRedis  = "redis"
+	BackendMemory = "memory" // per process; state is not shared between instances
+)
+
+// IdempotencyConfig selects the idempotency cache. The database idempotency
+// log stays authoritative whichever backend is used.
+type IdempotencyConfig struct {
+	Backend    string `mapstructure:"backend"`     // redis | memory
+	MaxEntries int    `mapstructure:"max_entries"` // memory backend: LRU capacity
+	// Re-read replayed payments/refunds/topups from the database so replays
+	// reflect later status changes (one extra query per replay)
+	RefetchOnReplay bool `mapstructure:"refetch_on_replay"`
+	// Headers a payment idempotency key is read from, in precedence order
+	Headers []string `mapstructure:"headers"`
+	// How long database idempotency logs are kept by the idempotency_cleanup
+	// job; after that a reference_id can be processed again
+	LogRetention time.Duration `mapstructure:"log_retention"`
+	// What a request does when an identical one is still in flight: block
+	// (wait up to InFlightWait for its result) or conflict (PAY_003 at once)
+	InFlight     string        `mapstructure:"in_flight"`
+	InFlightWait time.Duration `mapstructure:"in_flight_wait"`
+}
+
+// JobsConfig enables and schedules the periodic background jobs. With
+// LeaderElection, only the instance holding a Redis lease runs them; the
+// lease expires LeaseTTL after the leader's last renewal.
+type JobsConfig struct {
+	LeaderElection bool          `mapstructure:"leader_election"`
+	LeaseTTL       time.Duration `mapstructure:"lease_ttl"`
+
+	IdempotencyCleanup JobConfig `mapstructure:"idempotency_cleanup"` // deletes idempotency logs past idempotency.log_retention
+	WebhookLogCleanup  JobConfig `mapstructure:"webhook_log_cleanup"` // deletes webhook delivery logs past webhook.log_retention / failed_log_retention
+}
+
+// JobConfig schedules one background job. A disabled job, or one with a
+// non-positive interval, never runs.
+type JobConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Interval time.Duration `mapstructure:"interval"`
+}
+
+// NonceConfig selects the replay-protection nonce store. The memory backend
+// only detects replays that reach the same instance; never use it with more
+// than one instance.
+type NonceConfig struct {
+	Backend       string        `mapstructure:"backend"`        // redis | memory
+	SweepInterval time.Duration `mapstructure:"sweep_interval"` // memory backend: purge expired nonces
+	Scope         string        `mapstructure:"scope"`          // merchant | endpoint: where a nonce must be unique
+}
+
+// HMACConfig bounds how far a signed request's X-Timestamp may be from the
+// server clock, separately for old and future-dated timestamps, and names
+// the headers signed requests carry their credentials in.
+type HMACConfig struct {
+	MaxPastDrift   time.Duration `mapstructure:"max_past_drift"`
+	MaxFutureDrift time.Duration `mapstructure:"max_future_drift"`
+
+	AccessKeyHeader string `mapstructure:"access_key_header"`
+	SignatureHeader string `mapstructure:"signature_header"`
+	TimestampHeader string `mapstructure:"timestamp_header"`
+	NonceHeader     string `mapstructure:"nonce_header"`
+}
+
+// RateLimitConfig selects where rate limit counters live. The memory backend
+// limits each instance separately, so N instances allow N times the limit.
+type RateLimitConfig struct {
+	Backend string `mapstructure:"backend"` // redis | memory
+	// LocalFallback enforces per-instance token-bucket limits while Redis is
+	// unreachable; false lets requests through unchecked during an outage.
+	LocalFallback bool `mapstructure:"local_fallback"`
+}
+
+// RequiresRedis reports whether any configured store or the jobs leader
+// lease needs Redis. When none does, the gateway runs without connecting to it.
+func (c *Config) RequiresRedis() bool {
+	return c.Idempotency.Backend != BackendMemory ||
+		c.Nonce.Backend != BackendMemory ||
+		c.RateLimit.Backend != BackendMemory ||
+		c.Jobs.LeaderElection
+}
+
+// RequestConfig bounds incoming requests. For the JSON limits 0 uses the
+// built-in default; for MaxInFlight 0 means unlimited.
+type RequestConfig struct {
+	JSONMaxDepth int `mapstructure:"json_max_depth"` // nested objects/arrays
+	JSONMaxKeys  int `mapstructure:"json_max_keys"`  // object keys across the whole body
+	MaxInFlight  int `mapstructure:"max_in_flight"`  // concurrent requests before 503 (health exempt)
+
+	// Log redacted bodies of 4xx write requests; ignored in release mode
+	LogFailedBodies bool `mapstructure:"log_failed_bodies"`
+	LogBodyMaxBytes int  `mapstructure:"log_body_max_bytes"` // body prefix logged per request
+}
+
 type LogConfig struct {
 	Level  string `mapstructure:"level"`  // debug, info, warn, error
 	Pretty bool   `mapstructure:"pretty"` // human-readable output (dev only)
 }
 
+// PaymentConfig holds business limits. Unset (nil) limits are unlimited.
+type PaymentConfig struct {
+	TopupMin      *int64 `mapstructure:"topup_min"`
+	TopupMax      *int64 `mapstructure:"topup_max"`
+	TopupDailyCap *int64 `mapstructure:"topup_daily_cap"` // Per wallet, per UTC day
+
+	MaxReferenceIDLength int `mapstructure:"max_reference_id_length"` // Capped at the column width (100)
+
+	// AutoCreateWallets lets a topup in a new currency create the wallet
+	// (zero starting balance). Disabling it makes such topups fail with
+	// PAY_004, so wallets come only from registration.
+	AutoCreateWallets bool `mapstructure:"auto_create_wallets"`
+
+	// RefundToCurrencyWallet credits a refund whose original wallet no
+	// longer exists to the merchant's wallet in the payment's currency,
+	// created if needed. Off = such refunds fail with PAY_004.
+	RefundToCurrencyWallet bool `mapstructure:"refund_to_currency_wallet"`
+
+	// ExtraData limits: stored size cap in bytes (payment extra_data and
+	// refund reason), and whether payment extra_data must be a JSON object.
+	ExtraDataMaxBytes int  `mapstructure:"extra_data_max_bytes"`
+	ExtraDataJSON     bool `mapstructure:"extra_data_json"`
+
+	// TopupIncrements requires topups in a currency to be a multiple of this
+	// many minor units (e.g. VND: 1000). Unlisted currencies accept any amount.
+	TopupIncrements map[string]int64 `mapstructure:"topup_increments"`
+
+	// MaxConcurrentPerMerchant caps one merchant's in-flight payments per
+	// instance; more fail with SYS_002. 0 = unlimited.
+	MaxConcurrentPerMerchant int `mapstructure:"max_concurrent_per_merchant"`
+
+	// DailyTransactionLimit caps payments per merchant per UTC day; the
+	// payment beyond it fails with PAY_005.
+	DailyTransactionLimit *int64 `mapstructure:"daily_transaction_limit"`
+
+	// MaxRefundsPerTransaction caps the refunds against one transaction;
+	// the refund beyond it fails with PAY_006. 0 = unlimited.
+	MaxRefundsPerTransaction int `mapstructure:"max_refunds_per_transaction"`
+
+	// RejectReferenceCollisions fails payments and topups with PAY_008 when
+	// their reference_id is already used by another operation type.
+	RejectReferenceCollisions bool `mapstructure:"reject_reference_collisions"`
+
+	// ReferenceScope is "global" (a reference_id is replayed for as long as
+	// its idempotency log is kept) or "daily" (unique per calendar day in
+	// ReferenceTimezone; the same reference on a later day is a new payment).
+	ReferenceScope    string `mapstructure:"reference_scope"`
+	ReferenceTimezone string `mapstructure:"reference_timezone"` // IANA name, e.g. Asia/Ho_Chi_Minh
+}
+
 // Load reads configuration from file and environment variables.
 // Environment variables override file values. Prefix: SPG_ (Secure Payment Gateway).
 // Nested keys use underscore: SPG_DATABASE_HOST, SPG_JWT_SECRET, etc.
@@ -81,6 +339,11 @@ func Load(path string) (*Config, error) {
 	v.SetDefault("server.host", "0.0.0.0")
 	v.SetDefault("server.port", 8080)
 	v.SetDefault("server.mode", "debug")
+	v.SetDefault("server.read_timeout", "15s")
+	v.SetDefault("server.read_header_timeout", "10s")
+	v.SetDefault("server.write_timeout", "60s")
+	v.SetDefault("server.idle_timeout", "120s")
+	v.SetDefault("server.trusted_proxies", []string{})
 	v.SetDefault("database.host", "localhost")
 	v.SetDefault("database.port", 5432)
 	v.SetDefault("database.user", "postgres")
@@ -97,9 +360,76 @@ func Load(path string) (*Config, error) {
 	v.SetDefault("jwt.secret", "")
 	v.SetDefault("jwt.expiry", "24h")
 	v.SetDefault("jwt.issuer", "secure-payment-gateway")
+	v.SetDefault("jwt.refresh_expiry", "168h")
+	v.SetDefault("jwt.max_session_expiry", "24h")
 	v.SetDefault("aes.key", "")
 	v.SetDefault("log.level", "info")
 	v.SetDefault("log.pretty", false)
+	v.SetDefault("receipt.signing_key", "")
+	v.SetDefault("payment.max_reference_id_length", 100)
+	v.SetDefault("payment.auto_create_wallets", true)
+	v.SetDefault("payment.refund_to_currency_wallet", false)
+	v.SetDefault("payment.extra_data_max_bytes", 4096)
+	v.SetDefault("payment.extra_data_json", false)
+	v.SetDefault("payment.max_concurrent_per_merchant", 50)
+	v.SetDefault("payment.max_refunds_per_transaction", 0)
+	v.SetDefault("payment.reject_reference_collisions", false)
+	v.SetDefault("payment.reference_scope", "global")
+	v.SetDefault("payment.reference_timezone", "UTC")
+	v.SetDefault("export.max_rows", 10000)
+	v.SetDefault("export.unbounded_max_rows", 1000)
+	v.SetDefault("security.hsts", false)
+	v.SetDefault("security.hsts_max_age", "8760h")
+	v.SetDefault("security.secret_max_age", "0s")
+	v.SetDefault("security.secret_expiry_action", SecretExpiryWarn)
+	v.SetDefault("security.refresh_cookie", false)
+	v.SetDefault("security.refresh_cookie_same_site", "strict")
+	v.SetDefault("security.refresh_cookie_domain", "")
+	v.SetDefault("security.require_tls", true)
+	v.SetDefault("swagger.release_enabled", false)
+	v.SetDefault("swagger.username", "")
+	v.SetDefault("swagger.password", "")
+	v.SetDefault("idempotency.backend", BackendRedis)
+	v.SetDefault("idempotency.max_entries", 10000)
+	v.SetDefault("idempotency.refetch_on_replay", false)
+	v.SetDefault("idempotency.headers", []string{"Idempotency-Key"})
+	v.SetDefault("idempotency.log_retention", "720h")
+	v.SetDefault("idempotency.in_flight", "block")
+	v.SetDefault("idempotency.in_flight_wait", "5s")
+	v.SetDefault("nonce.backend", BackendRedis)
+	v.SetDefault("nonce.sweep_interval", "1m")
+	v.SetDefault("nonce.scope", "merchant")
+	v.SetDefault("hmac.max_past_drift", "60s")
+	v.SetDefault("hmac.max_future_drift", "60s")
+	v.SetDefault("hmac.access_key_header", "X-Merchant-Access-Key")
+	v.SetDefault("hmac.signature_header", "X-Signature")
+	v.SetDefault("hmac.timestamp_header", "X-Timestamp")
+	v.SetDefault("hmac.nonce_header", "X-Nonce")
+	v.SetDefault("ratelimit.backend", BackendRedis)
+	v.SetDefault("ratelimit.local_fallback", false)
+	v.SetDefault("request.json_max_depth", 20)
+	v.SetDefault("request.json_max_keys", 1000)
+	v.SetDefault("request.max_in_flight", 0)
+	v.SetDefault("request.log_failed_bodies", false)
+	v.SetDefault("request.log_body_max_bytes", 2048)
+	v.SetDefault("admin.api_key", "")
+	v.SetDefault("registration.require_webhook_url", false)
+	v.SetDefault("webhook.encrypt_payloads", false)
+	v.SetDefault("webhook.log_retention", "720h")
+	v.SetDefault("webhook.failed_log_retention", "2160h")
+	v.SetDefault("notifications.enabled", false)
+	v.SetDefault("notifications.large_refund_threshold", 0)
+	v.SetDefault("jobs.leader_election", true)
+	v.SetDefault("jobs.lease_ttl", "30s")
+	v.SetDefault("jobs.idempotency_cleanup.enabled", false)
+	v.SetDefault("jobs.idempotency_cleanup.interval", "1h")
+	v.SetDefault("jobs.webhook_log_cleanup.enabled", false)
+	v.SetDefault("jobs.webhook_log_cleanup.interval", "1h")
+
+	// Optional keys without defaults must be bound explicitly for env overrides.
+	for _, key := range []string{"payment.topup_min", "payment.topup_max", "payment.topup_daily_cap", "payment.daily_transaction_limit"} {
+		_ = v.BindEnv(key)
+	}
 
 	// File config
 	if path != "" {
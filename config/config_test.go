@@ -25,6 +25,11 @@ func TestLoad_Defaults(t *testing.T) {
 	assert.Equal(t, "0.0.0.0", cfg.Server.Host)
 	assert.Equal(t, 8080, cfg.Server.Port)
 	assert.Equal(t, "debug", cfg.Server.Mode)
+	assert.Equal(t, 15*time.Second, cfg.Server.ReadTimeout)
+	assert.Equal(t, 10*time.Second, cfg.Server.ReadHeaderTimeout)
+	assert.Equal(t, 60*time.Second, cfg.Server.WriteTimeout)
+	assert.Equal(t, 120*time.Second, cfg.Server.IdleTimeout)
+	assert.Empty(t, cfg.Server.TrustedProxies)
 
 	assert.Equal(t, "localhost", cfg.Database.Host)
 	assert.Equal(t, 5432, cfg.Database.Port)
@@ -40,9 +45,95 @@ func TestLoad_Defaults(t *testing.T) {
 
 	assert.Equal(t, 24*time.Hour, cfg.JWT.Expiry)
 	assert.Equal(t, "secure-payment-gateway", cfg.JWT.Issuer)
+	assert.Equal(t, 168*time.Hour, cfg.JWT.RefreshExpiry)
+	assert.Equal(t, 24*time.Hour, cfg.JWT.MaxSessionExpiry)
 
 	assert.Equal(t, "info", cfg.Log.Level)
 	assert.False(t, cfg.Log.Pretty)
+
+	assert.Equal(t, 100, cfg.Payment.MaxReferenceIDLength)
+	assert.True(t, cfg.Payment.AutoCreateWallets)
+	assert.False(t, cfg.Payment.RefundToCurrencyWallet)
+	assert.Equal(t, 4096, cfg.Payment.ExtraDataMaxBytes)
+	assert.False(t, cfg.Payment.ExtraDataJSON)
+	assert.Equal(t, 50, cfg.Payment.MaxConcurrentPerMerchant)
+	assert.Nil(t, cfg.Payment.DailyTransactionLimit)
+	assert.Zero(t, cfg.Payment.MaxRefundsPerTransaction)
+	assert.False(t, cfg.Payment.RejectReferenceCollisions)
+	assert.Equal(t, "global", cfg.Payment.ReferenceScope)
+	assert.Equal(t, "UTC", cfg.Payment.ReferenceTimezone)
+	assert.Equal(t, 10000, cfg.Export.MaxRows)
+	assert.Equal(t, 1000, cfg.Export.UnboundedMaxRows)
+	assert.False(t, cfg.Security.HSTS)
+	assert.Equal(t, 8760*time.Hour, cfg.Security.HSTSMaxAge)
+	assert.Zero(t, cfg.Security.SecretMaxAge)
+	assert.Equal(t, SecretExpiryWarn, cfg.Security.SecretExpiryAction)
+	assert.False(t, cfg.Security.RefreshCookie)
+	assert.Equal(t, "strict", cfg.Security.RefreshCookieSameSite)
+	assert.Empty(t, cfg.Security.RefreshCookieDomain)
+	assert.True(t, cfg.Security.RequireTLS)
+	assert.False(t, cfg.Swagger.ReleaseEnabled)
+	assert.Empty(t, cfg.Swagger.Username)
+	assert.Equal(t, BackendRedis, cfg.Idempotency.Backend)
+	assert.Equal(t, 10000, cfg.Idempotency.MaxEntries)
+	assert.False(t, cfg.Idempotency.RefetchOnReplay)
+	assert.Equal(t, []string{"Idempotency-Key"}, cfg.Idempotency.Headers)
+	assert.Equal(t, BackendRedis, cfg.Nonce.Backend)
+	assert.Equal(t, time.Minute, cfg.Nonce.SweepInterval)
+	assert.Equal(t, "merchant", cfg.Nonce.Scope)
+	assert.Equal(t, time.Minute, cfg.HMAC.MaxPastDrift)
+	assert.Equal(t, time.Minute, cfg.HMAC.MaxFutureDrift)
+	assert.Equal(t, "X-Merchant-Access-Key", cfg.HMAC.AccessKeyHeader)
+	assert.Equal(t, "X-Signature", cfg.HMAC.SignatureHeader)
+	assert.Equal(t, "X-Timestamp", cfg.HMAC.TimestampHeader)
+	assert.Equal(t, "X-Nonce", cfg.HMAC.NonceHeader)
+	assert.Equal(t, BackendRedis, cfg.RateLimit.Backend)
+	assert.False(t, cfg.RateLimit.LocalFallback)
+	assert.Equal(t, 20, cfg.Request.JSONMaxDepth)
+	assert.Equal(t, 1000, cfg.Request.JSONMaxKeys)
+	assert.Zero(t, cfg.Request.MaxInFlight)
+	assert.False(t, cfg.Request.LogFailedBodies)
+	assert.Equal(t, 2048, cfg.Request.LogBodyMaxBytes)
+	assert.Empty(t, cfg.Admin.APIKey)
+	assert.False(t, cfg.Registration.RequireWebhookURL)
+	assert.Equal(t, 720*time.Hour, cfg.Idempotency.LogRetention)
+	assert.Equal(t, "block", cfg.Idempotency.InFlight)
+	assert.Equal(t, 5*time.Second, cfg.Idempotency.InFlightWait)
+	assert.False(t, cfg.Webhook.EncryptPayloads)
+	assert.Equal(t, 720*time.Hour, cfg.Webhook.LogRetention)
+	assert.Equal(t, 2160*time.Hour, cfg.Webhook.FailedLogRetention)
+	assert.False(t, cfg.Notifications.Enabled)
+	assert.Zero(t, cfg.Notifications.LargeRefundThreshold)
+	assert.True(t, cfg.Jobs.LeaderElection)
+	assert.Equal(t, 30*time.Second, cfg.Jobs.LeaseTTL)
+	assert.False(t, cfg.Jobs.IdempotencyCleanup.Enabled)
+	assert.Equal(t, time.Hour, cfg.Jobs.IdempotencyCleanup.Interval)
+	assert.False(t, cfg.Jobs.WebhookLogCleanup.Enabled)
+	assert.Equal(t, time.Hour, cfg.Jobs.WebhookLogCleanup.Interval)
+}
+
+func TestSwaggerConfig_Enabled(t *testing.T) {
+	assert.True(t, SwaggerConfig{}.Enabled("debug"))
+	assert.True(t, SwaggerConfig{}.Enabled("test"))
+	assert.False(t, SwaggerConfig{}.Enabled("release"))
+	assert.True(t, SwaggerConfig{ReleaseEnabled: true}.Enabled("release"))
+}
+
+func TestConfig_RequiresRedis(t *testing.T) {
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.True(t, cfg.RequiresRedis(), "defaults use Redis")
+
+	cfg.Idempotency.Backend = BackendMemory
+	cfg.Nonce.Backend = BackendMemory
+	cfg.RateLimit.Backend = BackendMemory
+	assert.True(t, cfg.RequiresRedis(), "the jobs leader lease still needs Redis")
+
+	cfg.Jobs.LeaderElection = false
+	assert.False(t, cfg.RequiresRedis())
+
+	cfg.Nonce.Backend = BackendRedis
+	assert.True(t, cfg.RequiresRedis())
 }
 
 func TestLoad_FromYAMLFile(t *testing.T) {
@@ -52,6 +143,8 @@ server:
   host: "127.0.0.1"
   port: 9090
   mode: "release"
+  read_timeout: "5s"
+  write_timeout: "20s"
 database:
   host: "db.example.com"
   port: 5433
@@ -73,6 +166,13 @@ aes:
 log:
   level: "debug"
   pretty: true
+payment:
+  topup_increments:
+    VND: 1000
+jobs:
+  idempotency_cleanup:
+    enabled: true
+    interval: "15m"
 `)
 	tmpDir := t.TempDir()
 	cfgPath := filepath.Join(tmpDir, "config.yaml")
@@ -84,6 +184,8 @@ log:
 	assert.Equal(t, "127.0.0.1", cfg.Server.Host)
 	assert.Equal(t, 9090, cfg.Server.Port)
 	assert.Equal(t, "release", cfg.Server.Mode)
+	assert.Equal(t, 5*time.Second, cfg.Server.ReadTimeout)
+	assert.Equal(t, 20*time.Second, cfg.Server.WriteTimeout)
 
 	assert.Equal(t, "db.example.com", cfg.Database.Host)
 	assert.Equal(t, 5433, cfg.Database.Port)
@@ -104,6 +206,12 @@ log:
 	assert.Equal(t, "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", cfg.AES.Key)
 	assert.Equal(t, "debug", cfg.Log.Level)
 	assert.True(t, cfg.Log.Pretty)
+
+	// Map keys come back lowercased
+	assert.Equal(t, map[string]int64{"vnd": 1000}, cfg.Payment.TopupIncrements)
+
+	assert.True(t, cfg.Jobs.IdempotencyCleanup.Enabled)
+	assert.Equal(t, 15*time.Minute, cfg.Jobs.IdempotencyCleanup.Interval)
 }
 
 func TestLoad_EnvOverride(t *testing.T) {
@@ -111,15 +219,42 @@ func TestLoad_EnvOverride(t *testing.T) {
 	t.Setenv("SPG_SERVER_PORT", "3000")
 	t.Setenv("SPG_DATABASE_HOST", "env-db-host")
 	t.Setenv("SPG_JWT_SECRET", "env-secret")
+	t.Setenv("SPG_SERVER_TRUSTED_PROXIES", "10.0.0.0/8,192.0.2.7")
 
 	cfg, err := Load("")
 	require.NoError(t, err)
 
 	assert.Equal(t, 3000, cfg.Server.Port)
+	assert.Equal(t, []string{"10.0.0.0/8", "192.0.2.7"}, cfg.Server.TrustedProxies)
 	assert.Equal(t, "env-db-host", cfg.Database.Host)
 	assert.Equal(t, "env-secret", cfg.JWT.Secret)
 }
 
+func TestLoad_PaymentLimits(t *testing.T) {
+	// Unset limits stay nil (unlimited); set ones are picked up from env.
+	t.Setenv("SPG_PAYMENT_TOPUP_MAX", "1000000")
+	t.Setenv("SPG_PAYMENT_DAILY_TRANSACTION_LIMIT", "500")
+
+	cfg, err := Load("")
+	require.NoError(t, err)
+
+	assert.Nil(t, cfg.Payment.TopupMin)
+	require.NotNil(t, cfg.Payment.TopupMax)
+	assert.Equal(t, int64(1000000), *cfg.Payment.TopupMax)
+	assert.Nil(t, cfg.Payment.TopupDailyCap)
+	require.NotNil(t, cfg.Payment.DailyTransactionLimit)
+	assert.Equal(t, int64(500), *cfg.Payment.DailyTransactionLimit)
+}
+
+func TestLoad_IdempotencyHeadersFromEnv(t *testing.T) {
+	t.Setenv("SPG_IDEMPOTENCY_HEADERS", "X-Idempotency-Key,Idempotency-Key")
+
+	cfg, err := Load("")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"X-Idempotency-Key", "Idempotency-Key"}, cfg.Idempotency.Headers)
+}
+
 func TestDatabaseConfig_DSN(t *testing.T) {
 	dbCfg := DatabaseConfig{
 		Host:     "localhost",
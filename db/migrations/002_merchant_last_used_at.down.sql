@@ -0,0 +1,4 @@
+-- 002_merchant_last_used_at.down.sql
+-- Rollback merchant credential usage tracking
+
+ALTER TABLE merchants DROP COLUMN IF EXISTS last_used_at;
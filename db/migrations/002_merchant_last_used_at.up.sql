@@ -0,0 +1,4 @@
+-- 002_merchant_last_used_at.up.sql
+-- Track when a merchant's API credentials were last used
+
+ALTER TABLE merchants ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,6 @@
+-- 003_merchant_activity.down.sql
+-- Rollback merchant activity tracking
+
+DROP INDEX IF EXISTS idx_webhook_logs_merchant;
+ALTER TABLE merchants DROP COLUMN IF EXISTS secret_rotated_at;
+ALTER TABLE merchants DROP COLUMN IF EXISTS last_login_at;
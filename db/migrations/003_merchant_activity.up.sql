@@ -0,0 +1,6 @@
+-- 003_merchant_activity.up.sql
+-- Track dashboard logins and secret key rotation for the account summary
+
+ALTER TABLE merchants ADD COLUMN IF NOT EXISTS last_login_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE merchants ADD COLUMN IF NOT EXISTS secret_rotated_at TIMESTAMP WITH TIME ZONE;
+CREATE INDEX IF NOT EXISTS idx_webhook_logs_merchant ON webhook_delivery_logs(merchant_id, updated_at DESC);
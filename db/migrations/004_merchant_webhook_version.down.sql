@@ -0,0 +1,4 @@
+-- 004_merchant_webhook_version.down.sql
+-- Rollback webhook payload version pinning
+
+ALTER TABLE merchants DROP COLUMN IF EXISTS webhook_version;
@@ -0,0 +1,4 @@
+-- 004_merchant_webhook_version.up.sql
+-- Pin each merchant to a webhook payload schema version (NULL = original 2024-01 shape)
+
+ALTER TABLE merchants ADD COLUMN IF NOT EXISTS webhook_version VARCHAR(10);
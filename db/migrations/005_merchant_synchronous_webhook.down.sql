@@ -0,0 +1,4 @@
+-- 005_merchant_synchronous_webhook.down.sql
+-- Rollback synchronous webhook mode
+
+ALTER TABLE merchants DROP COLUMN IF EXISTS synchronous_webhook;
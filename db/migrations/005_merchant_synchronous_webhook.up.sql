@@ -0,0 +1,4 @@
+-- 005_merchant_synchronous_webhook.up.sql
+-- Per-merchant opt-in to block payment responses on the first webhook attempt
+
+ALTER TABLE merchants ADD COLUMN IF NOT EXISTS synchronous_webhook BOOLEAN NOT NULL DEFAULT FALSE;
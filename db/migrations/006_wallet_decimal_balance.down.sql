@@ -0,0 +1,3 @@
+-- 006_wallet_decimal_balance.down.sql
+
+ALTER TABLE wallets DROP COLUMN IF EXISTS decimal_balance;
@@ -0,0 +1,4 @@
+-- 006_wallet_decimal_balance.up.sql
+-- Opt-in arbitrary-precision balances: the encrypted plaintext is a decimal string
+
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS decimal_balance BOOLEAN NOT NULL DEFAULT FALSE;
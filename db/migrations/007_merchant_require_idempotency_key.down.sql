@@ -0,0 +1,4 @@
+-- 007_merchant_require_idempotency_key.down.sql
+-- Rollback the idempotency key requirement
+
+ALTER TABLE merchants DROP COLUMN IF EXISTS require_idempotency_key;
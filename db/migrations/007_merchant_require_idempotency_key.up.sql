@@ -0,0 +1,4 @@
+-- 007_merchant_require_idempotency_key.up.sql
+-- Per-merchant opt-in to reject payments without an Idempotency-Key header
+
+ALTER TABLE merchants ADD COLUMN IF NOT EXISTS require_idempotency_key BOOLEAN NOT NULL DEFAULT FALSE;
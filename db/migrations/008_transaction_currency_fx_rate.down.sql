@@ -0,0 +1,5 @@
+-- 008_transaction_currency_fx_rate.down.sql
+-- Rollback transaction currency and FX rate
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS fx_rate;
+ALTER TABLE transactions DROP COLUMN IF EXISTS currency;
@@ -0,0 +1,5 @@
+-- 008_transaction_currency_fx_rate.up.sql
+-- Record each transaction's currency, and the FX rate applied to cross-currency refunds
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS currency VARCHAR(3);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fx_rate NUMERIC(30, 12);
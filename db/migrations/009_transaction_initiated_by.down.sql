@@ -0,0 +1,4 @@
+-- 009_transaction_initiated_by.down.sql
+-- Rollback transaction initiator
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS initiated_by;
@@ -0,0 +1,4 @@
+-- 009_transaction_initiated_by.up.sql
+-- Record which credential initiated each transaction
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS initiated_by VARCHAR(100);
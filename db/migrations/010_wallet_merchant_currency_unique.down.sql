@@ -0,0 +1,4 @@
+-- 010_wallet_merchant_currency_unique.down.sql
+-- Rollback one-wallet-per-currency constraint
+
+ALTER TABLE wallets DROP CONSTRAINT IF EXISTS uq_wallets_merchant_currency;
@@ -0,0 +1,5 @@
+-- 010_wallet_merchant_currency_unique.up.sql
+-- At most one wallet per merchant and currency.
+-- Fails if duplicates already exist; merge them before migrating.
+
+ALTER TABLE wallets ADD CONSTRAINT uq_wallets_merchant_currency UNIQUE (merchant_id, currency);
@@ -0,0 +1,4 @@
+-- 011_merchant_webhook_payload_mode.down.sql
+-- Rollback webhook payload verbosity
+
+ALTER TABLE merchants DROP COLUMN IF EXISTS webhook_payload_mode;
@@ -0,0 +1,4 @@
+-- 011_merchant_webhook_payload_mode.up.sql
+-- Per-merchant webhook payload verbosity: full (default) or minimal
+
+ALTER TABLE merchants ADD COLUMN IF NOT EXISTS webhook_payload_mode VARCHAR(10) NOT NULL DEFAULT 'full';
@@ -0,0 +1,4 @@
+-- 012_merchant_session_expiry.down.sql
+-- Rollback per-merchant session lifetime
+
+ALTER TABLE merchants DROP COLUMN IF EXISTS session_expiry_seconds;
@@ -0,0 +1,4 @@
+-- 012_merchant_session_expiry.up.sql
+-- Per-merchant dashboard session lifetime override; NULL = jwt.expiry
+
+ALTER TABLE merchants ADD COLUMN IF NOT EXISTS session_expiry_seconds INTEGER CHECK (session_expiry_seconds > 0);
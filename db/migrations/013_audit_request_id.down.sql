@@ -0,0 +1,5 @@
+-- 013_audit_request_id.down.sql
+-- Rollback audit request IDs
+
+DROP INDEX IF EXISTS idx_audit_logs_request_id;
+ALTER TABLE audit_logs DROP COLUMN IF EXISTS request_id;
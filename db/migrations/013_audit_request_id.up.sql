@@ -0,0 +1,5 @@
+-- 013_audit_request_id.up.sql
+-- One audit entry per request: entries carry the request ID, unique when set
+
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS request_id VARCHAR(64);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_audit_logs_request_id ON audit_logs(request_id) WHERE request_id IS NOT NULL;
@@ -0,0 +1,4 @@
+-- 014_merchant_notification_preferences.down.sql
+-- Rollback per-merchant notification preferences
+
+ALTER TABLE merchants DROP COLUMN IF EXISTS notification_preferences;
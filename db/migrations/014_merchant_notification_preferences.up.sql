@@ -0,0 +1,4 @@
+-- 014_merchant_notification_preferences.up.sql
+-- Per-merchant email/SMS notification preferences: events and addresses
+
+ALTER TABLE merchants ADD COLUMN IF NOT EXISTS notification_preferences JSONB NOT NULL DEFAULT '{}';
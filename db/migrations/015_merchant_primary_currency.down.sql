@@ -0,0 +1,4 @@
+-- 015_merchant_primary_currency.down.sql
+-- Rollback per-merchant primary currency
+
+ALTER TABLE merchants DROP COLUMN IF EXISTS primary_currency;
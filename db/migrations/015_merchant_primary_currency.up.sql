@@ -0,0 +1,5 @@
+-- 015_merchant_primary_currency.up.sql
+-- Per-merchant primary currency: the wallet created at registration and the
+-- default for balance queries that name no currency
+
+ALTER TABLE merchants ADD COLUMN IF NOT EXISTS primary_currency VARCHAR(3) NOT NULL DEFAULT 'VND';
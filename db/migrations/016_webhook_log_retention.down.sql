@@ -0,0 +1,4 @@
+-- 016_webhook_log_retention.down.sql
+-- Rollback webhook delivery log retention index
+
+DROP INDEX IF EXISTS idx_webhook_logs_status_updated;
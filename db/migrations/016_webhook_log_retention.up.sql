@@ -0,0 +1,4 @@
+-- 016_webhook_log_retention.up.sql
+-- Let the webhook_log_cleanup job find expired delivery logs by status and age
+
+CREATE INDEX IF NOT EXISTS idx_webhook_logs_status_updated ON webhook_delivery_logs(status, updated_at);
@@ -0,0 +1,4 @@
+-- 017_idempotency_request_hash.down.sql
+-- Rollback idempotency request hashes
+
+ALTER TABLE idempotency_logs DROP COLUMN IF EXISTS request_hash;
@@ -0,0 +1,5 @@
+-- 017_idempotency_request_hash.up.sql
+-- SHA-256 of the request that produced each idempotency log, so a key reused
+-- with a different body is rejected instead of replayed
+
+ALTER TABLE idempotency_logs ADD COLUMN IF NOT EXISTS request_hash VARCHAR(64);
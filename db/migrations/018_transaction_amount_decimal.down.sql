@@ -0,0 +1,3 @@
+-- Rollback exact transaction amounts
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS amount_decimal;
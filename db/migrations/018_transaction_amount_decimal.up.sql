@@ -0,0 +1,4 @@
+-- Exact amount of transactions with a fractional part, on decimal-balance
+-- wallets; amount keeps the integer part
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS amount_decimal NUMERIC;
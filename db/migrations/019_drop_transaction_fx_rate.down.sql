@@ -0,0 +1,4 @@
+-- 019_drop_transaction_fx_rate.down.sql
+-- Restore the unused FX rate column
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fx_rate NUMERIC(30, 12);
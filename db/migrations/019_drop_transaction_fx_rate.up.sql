@@ -0,0 +1,5 @@
+-- 019_drop_transaction_fx_rate.up.sql
+-- Refunds are always credited in the payment's currency, so no FX rate is
+-- ever recorded
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS fx_rate;
@@ -13,7 +13,17 @@ CREATE TABLE merchants (
     access_key VARCHAR(64) NOT NULL UNIQUE, -- Public identifier
     secret_key_enc TEXT NOT NULL, -- Encrypted Secret Key (AES-256)
     webhook_url TEXT, -- URL for transaction status callbacks
+    webhook_version VARCHAR(10), -- Pinned webhook payload version (NULL = 2024-01)
+    synchronous_webhook BOOLEAN NOT NULL DEFAULT FALSE, -- Payment responses wait for the first webhook attempt
+    require_idempotency_key BOOLEAN NOT NULL DEFAULT FALSE, -- Reject payments without an Idempotency-Key header
+    webhook_payload_mode VARCHAR(10) NOT NULL DEFAULT 'full', -- full | minimal (IDs and status only)
+    session_expiry_seconds INTEGER CHECK (session_expiry_seconds > 0), -- Dashboard token lifetime override (NULL = jwt.expiry)
+    notification_preferences JSONB NOT NULL DEFAULT '{}', -- Email/SMS notification events and addresses
+    primary_currency VARCHAR(3) NOT NULL DEFAULT 'VND', -- Wallet created at registration; default for balance queries
     status VARCHAR(20) NOT NULL DEFAULT 'ACTIVE', -- ACTIVE, SUSPENDED, DEACTIVATED
+    last_used_at TIMESTAMP WITH TIME ZONE, -- Last successful HMAC auth (throttled)
+    last_login_at TIMESTAMP WITH TIME ZONE, -- Last successful dashboard login
+    secret_rotated_at TIMESTAMP WITH TIME ZONE, -- Last secret key rotation (NULL = never rotated)
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
@@ -26,9 +36,11 @@ CREATE TABLE wallets (
     merchant_id UUID NOT NULL REFERENCES merchants(id),
     currency VARCHAR(3) NOT NULL DEFAULT 'VND',
     encrypted_balance TEXT NOT NULL, -- Must decrypt to use
+    decimal_balance BOOLEAN NOT NULL DEFAULT FALSE, -- Plaintext is a decimal string, not int64 minor units
     last_audit_hash VARCHAR(64), -- For integrity check
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    CONSTRAINT uq_wallets_merchant_currency UNIQUE (merchant_id, currency) -- One wallet per currency
 );
 
 -- 3. TRANSACTIONS TABLE
@@ -42,7 +54,7 @@ CREATE TABLE transactions (
     amount DECIMAL(20, 2) NOT NULL, -- Visible for analytics/reporting
     amount_encrypted TEXT NOT NULL, -- Secure record (AES-256)
     
-    transaction_type VARCHAR(20) NOT NULL, -- PAYMENT, REFUND, TOPUP
+    transaction_type VARCHAR(20) NOT NULL, -- PAYMENT, REFUND, TOPUP, REVERSAL
     status VARCHAR(20) NOT NULL DEFAULT 'PENDING', -- PENDING, SUCCESS, FAILED, REVERSED
     
     signature VARCHAR(255) NOT NULL, -- Request signature from Merchant
@@ -51,7 +63,11 @@ CREATE TABLE transactions (
     original_transaction_id UUID REFERENCES transactions(id), -- For REFUND: links to original tx
     
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-    processed_at TIMESTAMP WITH TIME ZONE
+    processed_at TIMESTAMP WITH TIME ZONE,
+
+    currency VARCHAR(3), -- Wallet currency at creation; NULL for rows before migration 008
+    initiated_by VARCHAR(100), -- Access key that initiated the transaction; NULL for rows before migration 009
+    amount_decimal NUMERIC -- Exact amount when fractional (decimal_balance wallets); amount holds its integer part
 );
 
 -- 4. IDEMPOTENCY_LOGS TABLE
@@ -60,7 +76,8 @@ CREATE TABLE idempotency_logs (
     key VARCHAR(255) PRIMARY KEY, -- usually "merchant_id:reference_id"
     transaction_id UUID NOT NULL REFERENCES transactions(id),
     response_json JSONB, -- Cache the response to return identical result
-    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    request_hash VARCHAR(64) -- SHA-256 of the request; NULL if not hashed
 );
 
 -- 5. WEBHOOK DELIVERY LOGS TABLE
@@ -90,4 +107,6 @@ CREATE INDEX idx_wallets_merchant ON wallets(merchant_id);
 CREATE INDEX idx_webhook_logs_pending ON webhook_delivery_logs(status, next_retry_at)
     WHERE status = 'PENDING';
 CREATE INDEX idx_webhook_logs_transaction ON webhook_delivery_logs(transaction_id);
+CREATE INDEX idx_webhook_logs_merchant ON webhook_delivery_logs(merchant_id, updated_at DESC);
+CREATE INDEX idx_webhook_logs_status_updated ON webhook_delivery_logs(status, updated_at);
 CREATE INDEX idx_merchants_status ON merchants(status);
\ No newline at end of file
@@ -1,11 +1,20 @@
 package dto
 
+import (
+	"encoding/json"
+
+	"secure-payment-gateway/internal/core/ports"
+	"secure-payment-gateway/pkg/pagination"
+)
+
 // RegisterRequest is the request body for merchant registration.
 type RegisterRequest struct {
-	Username     string  `json:"username" binding:"required,min=3,max=50,safe_id"`
-	Password     string  `json:"password" binding:"required,min=8,max=128"`
-	MerchantName string  `json:"merchant_name" binding:"required,min=1,max=100"`
-	WebhookURL   *string `json:"webhook_url,omitempty" binding:"omitempty,safe_url"`
+	Username     string   `json:"username" binding:"required,min=3,max=50,safe_id"`
+	Password     string   `json:"password" binding:"required,min=8,max=128"`
+	MerchantName string   `json:"merchant_name" binding:"required,min=1,max=100"`
+	WebhookURL   *string  `json:"webhook_url,omitempty" binding:"omitempty,safe_url"`
+	Currency     string   `json:"currency,omitempty" binding:"omitempty,len=3,alpha"`               // Primary currency; default VND
+	Currencies   []string `json:"currencies,omitempty" binding:"omitempty,max=10,dive,len=3,alpha"` // Further wallets to open
 }
 
 // LoginRequest is the request body for merchant login.
@@ -29,63 +38,304 @@ type LoginResponse struct {
 
 // PaymentRequest is the request body for payment processing.
 type PaymentRequest struct {
-	ReferenceID string  `json:"reference_id" binding:"required,max=100,safe_id"`
-	Amount      int64   `json:"amount" binding:"required,gt=0"`
-	Currency    string  `json:"currency" binding:"required,len=3,alpha"`
-	ExtraData   *string `json:"extra_data,omitempty" binding:"omitempty,max=1000"`
+	ReferenceID string      `json:"reference_id" binding:"required,reference_id"`
+	Amount      json.Number `json:"amount" binding:"required,amount"` // Fractional only for decimal-balance wallets
+	Currency    string      `json:"currency" binding:"required,len=3,alpha"`
+	ExtraData   *string     `json:"extra_data,omitempty" binding:"omitempty,max=1000,extra_data"`
 }
 
 // RefundRequest is the request body for refund processing.
 type RefundRequest struct {
-	OriginalReferenceID string `json:"original_reference_id" binding:"required,max=100,safe_id"`
-	Amount              *int64 `json:"amount,omitempty" binding:"omitempty,gt=0"`
-	Reason              string `json:"reason" binding:"required,max=500"`
+	OriginalReferenceID string       `json:"original_reference_id" binding:"required,reference_id"`
+	ReferenceID         string       `json:"reference_id,omitempty" binding:"omitempty,reference_id"` // names this refund among the payment's partial refunds
+	Amount              *json.Number `json:"amount,omitempty" binding:"omitempty,amount"`
+	Reason              string       `json:"reason" binding:"required,max=500"` // domain.MaxRefundReasonLength
+}
+
+// ReversalRequest is the request body for an operator reversal.
+type ReversalRequest struct {
+	Reason string `json:"reason" binding:"required,max=500"` // domain.MaxRefundReasonLength
+}
+
+// MaxRefundBatchSize bounds the number of items in a batch refund request.
+const MaxRefundBatchSize = 100
+
+// BatchRefundRequest is the request body for batch refund processing.
+// The reason applies to every item.
+type BatchRefundRequest struct {
+	Items  []BatchRefundItem `json:"items" binding:"required,min=1,max=100,dive"` // MaxRefundBatchSize
+	Reason string            `json:"reason" binding:"required,max=500"`           // domain.MaxRefundReasonLength
+}
+
+// BatchRefundItem is a single refund within a batch.
+type BatchRefundItem struct {
+	OriginalReferenceID string       `json:"original_reference_id" binding:"required,reference_id"`
+	Amount              *json.Number `json:"amount,omitempty" binding:"omitempty,amount"` // nil = full refund
+}
+
+// BatchRefundResponse reports the outcome of each item, in request order.
+type BatchRefundResponse struct {
+	Succeeded int                     `json:"succeeded"`
+	Failed    int                     `json:"failed"`
+	Results   []BatchRefundItemResult `json:"results"`
+}
+
+// BatchRefundItemResult is the outcome of one batch item: either the refund
+// transaction or the error it failed with.
+type BatchRefundItemResult struct {
+	OriginalReferenceID string               `json:"original_reference_id"`
+	Transaction         *TransactionResponse `json:"transaction,omitempty"`
+	ErrorCode           string               `json:"error_code,omitempty"`
+	Message             string               `json:"message,omitempty"`
 }
 
 // TopupRequest is the request body for wallet topup.
 type TopupRequest struct {
-	Amount   int64  `json:"amount" binding:"required,gt=0"`
-	Currency string `json:"currency" binding:"required,len=3,alpha"`
+	Amount      json.Number `json:"amount" binding:"required,amount"` // Fractional only for decimal-balance wallets
+	Currency    string      `json:"currency" binding:"required,len=3,alpha"`
+	ReferenceID *string     `json:"reference_id,omitempty" binding:"omitempty,max=94,reference_id"` // Enables idempotent retries; stored as TOPUP-{reference_id}
 }
 
 // TransactionResponse is the response body for transaction results.
 type TransactionResponse struct {
-	ID              string  `json:"id"`
-	ReferenceID     string  `json:"reference_id"`
-	Amount          int64   `json:"amount"`
-	TransactionType string  `json:"transaction_type"`
-	Status          string  `json:"status"`
-	CreatedAt       string  `json:"created_at"`
-	ProcessedAt     *string `json:"processed_at,omitempty"`
+	ID              string      `json:"id"`
+	ReferenceID     string      `json:"reference_id"`
+	Amount          json.Number `json:"amount"` // Exact, so fractional on decimal-balance wallets
+	TransactionType string      `json:"transaction_type"`
+	Status          string      `json:"status"`
+	CreatedAt       string      `json:"created_at"`
+	ProcessedAt     *string     `json:"processed_at,omitempty"`
+	Currency        string      `json:"currency,omitempty"`
+	InitiatedBy     string      `json:"initiated_by,omitempty"`
+	// Webhook is set only for merchants in synchronous webhook mode
+	Webhook *WebhookDispatchResponse `json:"webhook,omitempty"`
+}
+
+// TransactionCreatedResponse is the body returned instead of a
+// TransactionResponse when the client sends Prefer: return=minimal.
+type TransactionCreatedResponse struct {
+	ID      string                   `json:"id"`
+	Webhook *WebhookDispatchResponse `json:"webhook,omitempty"` // As in TransactionResponse
+}
+
+// WebhookDispatchResponse reports the synchronous webhook attempt made for a payment.
+type WebhookDispatchResponse struct {
+	Delivered  bool    `json:"delivered"`
+	HTTPStatus *int    `json:"http_status,omitempty"`
+	Error      *string `json:"error,omitempty"`
 }
 
 // WalletBalanceResponse is the response for balance query.
 type WalletBalanceResponse struct {
-	Balance  int64  `json:"balance"`
-	Currency string `json:"currency"`
+	Balance  json.Number `json:"balance"` // Exact; an integer unless the wallet stores decimal balances
+	Currency string      `json:"currency"`
+}
+
+// MaxBalancePreviewDeltas bounds the number of deltas in a balance preview.
+const MaxBalancePreviewDeltas = 100
+
+// BalancePreviewRequest is the request body for a projected balance preview.
+type BalancePreviewRequest struct {
+	Currency string  `json:"currency" binding:"required,len=3,alpha"`
+	Deltas   []int64 `json:"deltas" binding:"required,min=1,max=100,dive,ne=0"` // MaxBalancePreviewDeltas; minor units, negative = debit
+}
+
+// BalancePreviewResponse is the balance projected through a preview's deltas.
+type BalancePreviewResponse struct {
+	Currency         string        `json:"currency"`
+	Balance          json.Number   `json:"balance"`           // Current balance
+	Steps            []json.Number `json:"steps"`             // Balance after each delta
+	ProjectedBalance json.Number   `json:"projected_balance"` // Balance after the last delta
 }
 
 // DashboardStatsResponse is the response for dashboard statistics.
 type DashboardStatsResponse struct {
+	TotalTransactions int64       `json:"total_transactions"`
+	Successful        int64       `json:"successful"`
+	Failed            int64       `json:"failed"`
+	Reversed          int64       `json:"reversed"`
+	TotalRevenue      json.Number `json:"total_revenue"` // Exact, so fractional with decimal-balance wallets
+	TotalRefunded     json.Number `json:"total_refunded"`
+	TotalTopup        json.Number `json:"total_topup"`
+}
+
+// TransactionListResponse wraps paginated transaction list.
+type TransactionListResponse = pagination.List[TransactionResponse]
+
+// MerchantSummaryResponse is the composite account activity summary.
+type MerchantSummaryResponse struct {
+	Status          string                   `json:"status"`
+	Balances        []WalletBalanceResponse  `json:"balances"`
+	Today           TodayActivityResponse    `json:"today"`
+	LastLoginAt     *string                  `json:"last_login_at"`
+	LastKeyUsedAt   *string                  `json:"last_key_used_at"`
+	SecretRotatedAt *string                  `json:"secret_rotated_at"`
+	SecretExpiresAt *string                  `json:"secret_expires_at"` // null = secrets do not expire
+	LastWebhook     *WebhookDeliveryResponse `json:"last_webhook"`
+}
+
+// TodayActivityResponse holds transaction counts since midnight UTC.
+type TodayActivityResponse struct {
 	TotalTransactions int64 `json:"total_transactions"`
 	Successful        int64 `json:"successful"`
 	Failed            int64 `json:"failed"`
 	Reversed          int64 `json:"reversed"`
-	TotalRevenue      int64 `json:"total_revenue"`
-	TotalRefunded     int64 `json:"total_refunded"`
-	TotalTopup        int64 `json:"total_topup"`
 }
 
-// TransactionListResponse wraps paginated transaction list.
-type TransactionListResponse struct {
-	Items      []TransactionResponse `json:"items"`
-	Total      int64                 `json:"total"`
-	Page       int                   `json:"page"`
-	PageSize   int                   `json:"page_size"`
-	TotalPages int                   `json:"total_pages"`
+// WebhookDeliveryResponse summarises a single webhook delivery log.
+type WebhookDeliveryResponse struct {
+	TransactionID string  `json:"transaction_id"`
+	Status        string  `json:"status"`
+	Attempt       int     `json:"attempt"`
+	HTTPStatus    *int    `json:"http_status"`
+	UpdatedAt     string  `json:"updated_at"`
+	LastError     *string `json:"last_error,omitempty"`
+}
+
+// WebhookDeliveryDetailResponse is the full record of one webhook delivery.
+// Attempt counts every try; HTTPStatus and LastError are from the latest.
+type WebhookDeliveryDetailResponse struct {
+	ID            string          `json:"id"`
+	TransactionID string          `json:"transaction_id"`
+	WebhookURL    string          `json:"webhook_url"`
+	Status        string          `json:"status"`
+	Attempt       int             `json:"attempt"`
+	HTTPStatus    *int            `json:"http_status"`
+	LastError     *string         `json:"last_error,omitempty"`
+	NextRetryAt   *string         `json:"next_retry_at,omitempty"`
+	Payload       json.RawMessage `json:"payload,omitempty"` // omitted with ?include_payload=false
+	CreatedAt     string          `json:"created_at"`
+	UpdatedAt     string          `json:"updated_at"`
+}
+
+// WebhookTestFireResponse reports a test webhook. SigningInput is the exact
+// string the signature is the HMAC-SHA256 of; live webhooks never carry it.
+type WebhookTestFireResponse struct {
+	Delivered    bool            `json:"delivered"`
+	HTTPStatus   *int            `json:"http_status,omitempty"`
+	Error        *string         `json:"error,omitempty"`
+	Payload      json.RawMessage `json:"payload"` // body sent to the webhook URL
+	SigningInput string          `json:"signing_input"`
+}
+
+// UsageResponse reports the merchant's rate-limit usage per group.
+type UsageResponse struct {
+	Groups []UsageGroupResponse `json:"groups"`
+}
+
+// UsageGroupResponse is the current fixed window of one rate-limit group.
+type UsageGroupResponse struct {
+	Group         string `json:"group"`
+	Used          int64  `json:"used"` // May exceed limit: rejected requests are counted too
+	Limit         int64  `json:"limit"`
+	Remaining     int64  `json:"remaining"`
+	ResetAt       int64  `json:"reset_at"` // Unix timestamp, as in X-RateLimit-Reset
+	WindowSeconds int64  `json:"window_seconds"`
+}
+
+// ReceiptResponse is a transaction receipt with its gateway signature.
+// The signature covers the compact JSON encoding of Receipt, in field order.
+type ReceiptResponse struct {
+	Receipt   ports.Receipt `json:"receipt"`
+	Algorithm string        `json:"algorithm"`
+	Signature string        `json:"signature"` // base64
+}
+
+// ReceiptPublicKeyResponse exposes the key used to verify receipts.
+type ReceiptPublicKeyResponse struct {
+	Algorithm string `json:"algorithm"`
+	PublicKey string `json:"public_key"` // base64
 }
 
 // UpdateWebhookRequest is the request body for updating webhook URL.
 type UpdateWebhookRequest struct {
-	WebhookURL *string `json:"webhook_url" binding:"omitempty,safe_url"`
+	WebhookURL  *string `json:"webhook_url,omitempty" binding:"omitempty,safe_url"` // nil = leave unchanged, "" = remove
+	Synchronous *bool   `json:"synchronous,omitempty"`                              // nil = leave the delivery mode unchanged
+}
+
+// UpdateSettingsRequest is the request body for updating merchant settings.
+// Nil fields are left unchanged.
+type UpdateSettingsRequest struct {
+	RequireIdempotencyKey *bool `json:"require_idempotency_key,omitempty"` // Reject payments without an Idempotency-Key header
+
+	// WebhookPayloadMode is "full" or "minimal" (IDs and status only)
+	WebhookPayloadMode *string `json:"webhook_payload_mode,omitempty" binding:"omitempty,oneof=full minimal"`
+
+	// SessionExpirySeconds is the dashboard token lifetime; 0 restores the default
+	SessionExpirySeconds *int `json:"session_expiry_seconds,omitempty" binding:"omitempty,min=0,max=2592000"` // 30 days
+
+	// NotificationPreferences replaces the email/SMS notification settings
+	NotificationPreferences *NotificationPreferencesRequest `json:"notification_preferences,omitempty"`
+}
+
+// NotificationPreferencesRequest selects the events a merchant is notified
+// of besides webhooks, and the addresses to notify. Empty fields are cleared.
+type NotificationPreferencesRequest struct {
+	Events []string `json:"events" binding:"max=10"` // key_rotation, large_refund
+	Email  string   `json:"email" binding:"max=254"`
+	Phone  string   `json:"phone" binding:"max=16"` // E.164
+}
+
+// WebhookCatalogResponse lists the webhook events and payload schemas.
+type WebhookCatalogResponse struct {
+	Events         []WebhookEventResponse   `json:"events"`
+	Envelope       []WebhookFieldResponse   `json:"envelope"`
+	Versions       []WebhookVersionResponse `json:"versions"`
+	DefaultVersion string                   `json:"default_version"`
+	LatestVersion  string                   `json:"latest_version"`
+}
+
+// WebhookEventResponse describes one webhook event type.
+type WebhookEventResponse struct {
+	Type            string `json:"type"`
+	TransactionType string `json:"transaction_type"`
+	Trigger         string `json:"trigger"`
+}
+
+// WebhookVersionResponse describes the "data" object of one payload version.
+type WebhookVersionResponse struct {
+	Version       string                 `json:"version"`
+	Fields        []WebhookFieldResponse `json:"fields"`
+	MinimalFields []WebhookFieldResponse `json:"minimal_fields"` // webhook_payload_mode "minimal"
+}
+
+// WebhookFieldResponse describes one payload field.
+type WebhookFieldResponse struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Optional bool   `json:"optional"`
+}
+
+// ErrorCatalogResponse lists every error code the API can return.
+type ErrorCatalogResponse struct {
+	Errors []ErrorCodeResponse `json:"errors"`
+}
+
+// ErrorCodeResponse describes one error code.
+type ErrorCodeResponse struct {
+	ErrorCode  string `json:"error_code"`
+	Message    string `json:"message"` // {placeholders} are filled in per error
+	HTTPStatus int    `json:"http_status"`
+}
+
+// BodySizeMetricsResponse reports request and response body size histograms
+// per route, keyed by "METHOD /route/:param".
+type BodySizeMetricsResponse struct {
+	BucketBounds []int64                          `json:"bucket_bounds"` // bytes, inclusive upper bounds
+	Routes       map[string]RouteBodySizeResponse `json:"routes"`
+}
+
+// RouteBodySizeResponse holds the body size histograms of one route.
+type RouteBodySizeResponse struct {
+	Request  SizeHistogramResponse `json:"request"`
+	Response SizeHistogramResponse `json:"response"`
+}
+
+// SizeHistogramResponse is one body size histogram. Buckets are cumulative:
+// Buckets[i] counts bodies no larger than BucketBounds[i].
+type SizeHistogramResponse struct {
+	Count   int64   `json:"count"`
+	Sum     int64   `json:"sum"` // bytes
+	Max     int64   `json:"max"` // bytes
+	Buckets []int64 `json:"buckets"`
 }
@@ -1,23 +1,68 @@
 package dto
 
 import (
+"encoding/json"
 "html"
+"math"
 "net/url"
 "reflect"
 "regexp"
 "strings"
+"sync/atomic"
+
+"secure-payment-gateway/internal/core/domain"
 
 "github.com/gin-gonic/gin/binding"
 "github.com/go-playground/validator/v10"
+"github.com/shopspring/decimal"
 )
 
 var safeStringRe = regexp.MustCompile(`^[a-zA-Z0-9_\-\.]+$`)
 
+// MaxReferenceIDColumnLength is the width of transactions.reference_id.
+const MaxReferenceIDColumnLength = domain.MaxReferenceIDLength
+
+// maxReferenceIDLength is the configured limit enforced by the reference_id validator.
+var maxReferenceIDLength atomic.Int64
+
+// extraDataJSON makes the extra_data validator require a JSON object.
+var extraDataJSON atomic.Bool
+
 func init() {
+maxReferenceIDLength.Store(MaxReferenceIDColumnLength)
 if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
 _ = v.RegisterValidation("safe_id", validateSafeID)
 _ = v.RegisterValidation("safe_url", validateSafeURL)
+_ = v.RegisterValidation("reference_id", validateReferenceID)
+_ = v.RegisterValidation("extra_data", validateExtraData)
+_ = v.RegisterValidation("amount", validateAmount)
+}
 }
+
+// SetMaxReferenceIDLength sets the maximum reference length accepted on
+// payment, refund and topup requests. Values outside 1..MaxReferenceIDColumnLength
+// fall back to the column width.
+func SetMaxReferenceIDLength(n int) {
+if n <= 0 || n > MaxReferenceIDColumnLength {
+n = MaxReferenceIDColumnLength
+}
+maxReferenceIDLength.Store(int64(n))
+}
+
+// SetExtraDataJSON controls whether payment extra_data must be a JSON object.
+// The check runs at binding, before sanitising escapes the quotes.
+func SetExtraDataJSON(required bool) {
+extraDataJSON.Store(required)
+}
+
+// validateExtraData accepts any string unless SetExtraDataJSON is on, in
+// which case only a JSON object passes.
+func validateExtraData(fl validator.FieldLevel) bool {
+if !extraDataJSON.Load() {
+return true
+}
+var obj map[string]json.RawMessage
+return json.Unmarshal([]byte(fl.Field().String()), &obj) == nil
 }
 
 // validateSafeID allows alphanumeric, underscore, dash, and dot.
@@ -25,6 +70,23 @@ func validateSafeID(fl validator.FieldLevel) bool {
 return safeStringRe.MatchString(fl.Field().String())
 }
 
+// validateReferenceID applies the safe_id charset and the configured max length.
+func validateReferenceID(fl validator.FieldLevel) bool {
+s := fl.Field().String()
+return int64(len(s)) <= maxReferenceIDLength.Load() && safeStringRe.MatchString(s)
+}
+
+// maxAmount keeps an amount's integer part within int64 minor units.
+var maxAmount = decimal.NewFromInt(math.MaxInt64)
+
+// validateAmount accepts a positive number up to maxAmount. A fractional
+// amount passes here; the service rejects it unless the wallet holds
+// decimal balances.
+func validateAmount(fl validator.FieldLevel) bool {
+d, err := decimal.NewFromString(fl.Field().String())
+return err == nil && d.Sign() > 0 && d.LessThanOrEqual(maxAmount)
+}
+
 // validateSafeURL accepts only http/https URLs.
 func validateSafeURL(fl validator.FieldLevel) bool {
 raw := fl.Field().String()
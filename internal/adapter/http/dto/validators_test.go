@@ -1,8 +1,12 @@
 package dto
 
 import (
+"encoding/json"
+"strings"
 "testing"
 
+"github.com/gin-gonic/gin/binding"
+"github.com/go-playground/validator/v10"
 "github.com/stretchr/testify/assert"
 )
 
@@ -91,6 +95,89 @@ assert.False(t, safeStringRe.MatchString(tc), "expected invalid: %s", tc)
 }
 }
 
+func TestReferenceIDValidator_AppliesToAllReferenceFields(t *testing.T) {
+v := binding.Validator.Engine().(*validator.Validate)
+bad := "ref 001;DROP"
+
+assert.Error(t, v.Struct(PaymentRequest{ReferenceID: bad, Amount: "1", Currency: "VND"}))
+assert.Error(t, v.Struct(RefundRequest{OriginalReferenceID: bad, Reason: "r"}))
+assert.Error(t, v.Struct(TopupRequest{Amount: "1", Currency: "VND", ReferenceID: &bad}))
+
+good := "ref-001"
+assert.NoError(t, v.Struct(PaymentRequest{ReferenceID: good, Amount: "1", Currency: "VND"}))
+assert.NoError(t, v.Struct(RefundRequest{OriginalReferenceID: good, Reason: "r"}))
+assert.NoError(t, v.Struct(TopupRequest{Amount: "1", Currency: "VND", ReferenceID: &good}))
+}
+
+func TestReferenceIDValidator_ConfigurableMaxLength(t *testing.T) {
+v := binding.Validator.Engine().(*validator.Validate)
+SetMaxReferenceIDLength(8)
+defer SetMaxReferenceIDLength(MaxReferenceIDColumnLength)
+
+assert.NoError(t, v.Struct(RefundRequest{OriginalReferenceID: "ref-0001", Reason: "r"}))
+assert.Error(t, v.Struct(RefundRequest{OriginalReferenceID: "ref-00001", Reason: "r"}))
+
+// Values above the column width fall back to it
+SetMaxReferenceIDLength(500)
+assert.Error(t, v.Struct(RefundRequest{OriginalReferenceID: strings.Repeat("a", MaxReferenceIDColumnLength+1), Reason: "r"}))
+}
+
+func TestTopupRequest_ReferenceLeavesRoomForPrefix(t *testing.T) {
+v := binding.Validator.Engine().(*validator.Validate)
+fits := strings.Repeat("a", MaxReferenceIDColumnLength-len("TOPUP-"))
+tooLong := fits + "a"
+
+assert.NoError(t, v.Struct(TopupRequest{Amount: "1", Currency: "VND", ReferenceID: &fits}))
+assert.Error(t, v.Struct(TopupRequest{Amount: "1", Currency: "VND", ReferenceID: &tooLong}))
+}
+
+func TestAmountValidator(t *testing.T) {
+v := binding.Validator.Engine().(*validator.Validate)
+pay := func(amount string) PaymentRequest {
+return PaymentRequest{ReferenceID: "ref-001", Amount: json.Number(amount), Currency: "VND"}
+}
+
+for _, ok := range []string{"1", "150000", "0.000000017", "12.5", "9223372036854775807"} {
+assert.NoError(t, v.Struct(pay(ok)), ok)
+}
+for _, bad := range []string{"", "0", "-5", "0.0", "abc", "9223372036854775808"} {
+assert.Error(t, v.Struct(pay(bad)), bad)
+}
+
+negative := json.Number("-1")
+assert.Error(t, v.Struct(RefundRequest{OriginalReferenceID: "ref-001", Amount: &negative, Reason: "r"}))
+fraction := json.Number("0.5")
+assert.NoError(t, v.Struct(RefundRequest{OriginalReferenceID: "ref-001", Amount: &fraction, Reason: "r"}))
+}
+
+func TestRefundRequest_ReasonLength(t *testing.T) {
+v := binding.Validator.Engine().(*validator.Validate)
+
+assert.NoError(t, v.Struct(RefundRequest{OriginalReferenceID: "ref-001", Reason: strings.Repeat("a", 500)}))
+assert.Error(t, v.Struct(RefundRequest{OriginalReferenceID: "ref-001", Reason: strings.Repeat("a", 501)}))
+assert.Error(t, v.Struct(RefundRequest{OriginalReferenceID: "ref-001", Reason: ""}))
+}
+
+func TestExtraDataValidator_JSONShape(t *testing.T) {
+v := binding.Validator.Engine().(*validator.Validate)
+notes := "plain notes"
+obj := `{"order_id": "A-1", "items": 3}`
+arr := `[1, 2]`
+req := func(extra *string) PaymentRequest {
+return PaymentRequest{ReferenceID: "ref-001", Amount: "1", Currency: "VND", ExtraData: extra}
+}
+
+// Free-form by default
+assert.NoError(t, v.Struct(req(&notes)))
+
+SetExtraDataJSON(true)
+defer SetExtraDataJSON(false)
+assert.NoError(t, v.Struct(req(&obj)))
+assert.NoError(t, v.Struct(req(nil)))
+assert.Error(t, v.Struct(req(&notes)))
+assert.Error(t, v.Struct(req(&arr)))
+}
+
 func TestSanitizeStruct_PaymentRequest(t *testing.T) {
 extra := "  some notes <b>bold</b>  "
 req := PaymentRequest{
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+
+	"secure-payment-gateway/internal/adapter/http/dto"
+	"secure-payment-gateway/internal/adapter/http/middleware"
+	"secure-payment-gateway/internal/core/ports"
+	"secure-payment-gateway/pkg/apperror"
+	"secure-payment-gateway/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// AdminHandler handles operator-only endpoints.
+type AdminHandler struct {
+	paymentSvc ports.PaymentService
+}
+
+// NewAdminHandler creates a new AdminHandler.
+func NewAdminHandler(paymentSvc ports.PaymentService) *AdminHandler {
+	return &AdminHandler{paymentSvc: paymentSvc}
+}
+
+// ReverseTransaction handles POST /api/v1/admin/transactions/:id/reverse.
+// No webhook is sent: a reversal is an operator action, not a
+// merchant-facing refund.
+func (h *AdminHandler) ReverseTransaction(c *gin.Context) {
+	txID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, apperror.Validation("invalid transaction id"))
+		return
+	}
+
+	var req dto.ReversalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, apperror.Validation(err.Error()))
+		return
+	}
+	dto.SanitizeStruct(&req)
+
+	actor, err := adminActor(c)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	result, err := h.paymentSvc.ReverseTransaction(c.Request.Context(), ports.ReversalRequest{
+		TransactionID: txID,
+		Reason:        req.Reason,
+		ClientIP:      c.ClientIP(),
+		InitiatedBy:   actor,
+	})
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	// Attribute the audit entry to the merchant whose payment was reversed
+	c.Set(middleware.CtxMerchantID, result.MerchantID)
+
+	response.Created(c, toTransactionResponse(result))
+}
+
+// maxAdminActorLen caps X-Admin-Actor so "admin:" + it fits initiated_by.
+const maxAdminActorLen = 64
+
+// adminActor returns who to record as initiating an admin action: "admin",
+// or "admin:" followed by the operator named in X-Admin-Actor.
+func adminActor(c *gin.Context) (string, error) {
+	name := strings.TrimSpace(c.GetHeader(middleware.HeaderAdminActor))
+	if name == "" {
+		return "admin", nil
+	}
+	if len(name) > maxAdminActorLen {
+		return "", apperror.Validation(fmt.Sprintf("%s must be at most %d characters", middleware.HeaderAdminActor, maxAdminActorLen))
+	}
+	for i := 0; i < len(name); i++ {
+		if name[i] < ' ' || name[i] > '~' {
+			return "", apperror.Validation(middleware.HeaderAdminActor + " must contain only printable ASCII characters")
+		}
+	}
+	return "admin:" + name, nil
+}
+
+// BodySizeMetrics handles GET /api/v1/admin/metrics/body-sizes.
+func BodySizeMetrics(metrics *middleware.BodySizeMetrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		routes := make(map[string]dto.RouteBodySizeResponse)
+		for route, sizes := range metrics.Snapshot() {
+			routes[route] = dto.RouteBodySizeResponse{
+				Request:  toSizeHistogramResponse(sizes.Request),
+				Response: toSizeHistogramResponse(sizes.Response),
+			}
+		}
+		response.OK(c, dto.BodySizeMetricsResponse{
+			BucketBounds: middleware.BodySizeBuckets,
+			Routes:       routes,
+		})
+	}
+}
+
+func toSizeHistogramResponse(h middleware.SizeHistogram) dto.SizeHistogramResponse {
+	buckets := h.Buckets
+	if buckets == nil {
+		buckets = make([]int64, len(middleware.BodySizeBuckets))
+	}
+	return dto.SizeHistogramResponse{
+		Count:   h.Count,
+		Sum:     h.Sum,
+		Max:     h.Max,
+		Buckets: buckets,
+	}
+}
@@ -2,23 +2,78 @@ package handler
 
 import (
 	"net/http"
+	"net/netip"
+	"time"
 
 	"secure-payment-gateway/internal/adapter/http/dto"
 	"secure-payment-gateway/internal/core/ports"
 	"secure-payment-gateway/pkg/apperror"
+	"secure-payment-gateway/pkg/buildinfo"
 	"secure-payment-gateway/pkg/response"
 
 	"github.com/gin-gonic/gin"
 )
 
+// HeaderIdempotencyKey lets clients safely retry non-idempotent requests.
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+// maxIdempotencyKeyLen bounds client-supplied idempotency keys.
+const maxIdempotencyKeyLen = 255
+
+// RefreshCookieName is the cookie dashboard refresh tokens are delivered in.
+// It is scoped to the auth routes, the only ones that read it.
+const (
+	RefreshCookieName = "spg_refresh"
+	refreshCookiePath = "/api/v1/auth"
+)
+
+// RefreshCookie configures cookie-delivered dashboard refresh tokens. The
+// cookie is always Secure and HttpOnly, so scripts cannot read it and it is
+// never sent over plain HTTP.
+type RefreshCookie struct {
+	Domain     string        // empty = host-only cookie
+	SameSite   http.SameSite // zero = Strict
+	RequireTLS bool          // reject cookie logins and refreshes not made over HTTPS (SEC_006)
+}
+
 // AuthHandler handles authentication endpoints.
 type AuthHandler struct {
 	authSvc ports.AuthService
+
+	refreshCookie  *RefreshCookie // nil = login returns only the access token
+	trustedProxies []netip.Prefix // peers whose X-Forwarded-Proto is believed
+}
+
+// AuthHandlerOption configures optional AuthHandler behaviour.
+type AuthHandlerOption func(*AuthHandler)
+
+// WithRefreshCookie makes login also set a refresh token cookie, which
+// POST /auth/refresh exchanges for a new access token.
+func WithRefreshCookie(cfg RefreshCookie) AuthHandlerOption {
+	return func(h *AuthHandler) {
+		if cfg.SameSite == 0 {
+			cfg.SameSite = http.SameSiteStrictMode
+		}
+		h.refreshCookie = &cfg
+	}
+}
+
+// WithTrustedProxies makes RequireTLS accept X-Forwarded-Proto: https from
+// requests whose peer is in proxies. From any other peer the header is
+// ignored, since clients can set it themselves.
+func WithTrustedProxies(proxies []netip.Prefix) AuthHandlerOption {
+	return func(h *AuthHandler) {
+		h.trustedProxies = proxies
+	}
 }
 
 // NewAuthHandler creates a new AuthHandler.
-func NewAuthHandler(authSvc ports.AuthService) *AuthHandler {
-	return &AuthHandler{authSvc: authSvc}
+func NewAuthHandler(authSvc ports.AuthService, opts ...AuthHandlerOption) *AuthHandler {
+	h := &AuthHandler{authSvc: authSvc}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 // Register handles POST /api/v1/auth/register.
@@ -30,11 +85,23 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	}
 	dto.SanitizeStruct(&req)
 
+	var idempotencyKey *string
+	if key := c.GetHeader(HeaderIdempotencyKey); key != "" {
+		if len(key) > maxIdempotencyKeyLen {
+			response.Error(c, apperror.Validation("Idempotency-Key must be at most 255 characters"))
+			return
+		}
+		idempotencyKey = &key
+	}
+
 	result, err := h.authSvc.Register(c.Request.Context(), ports.RegisterRequest{
-		Username:     req.Username,
-		Password:     req.Password,
-		MerchantName: req.MerchantName,
-		WebhookURL:   req.WebhookURL,
+		Username:       req.Username,
+		Password:       req.Password,
+		MerchantName:   req.MerchantName,
+		WebhookURL:     req.WebhookURL,
+		Currency:       req.Currency,
+		Currencies:     req.Currencies,
+		IdempotencyKey: idempotencyKey,
 	})
 	if err != nil {
 		response.Error(c, err)
@@ -57,6 +124,20 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 	dto.SanitizeStruct(&req)
 
+	if h.refreshCookie != nil {
+		if h.refreshCookie.RequireTLS && !h.isTLS(c) {
+			response.Error(c, apperror.ErrTLSRequired())
+			return
+		}
+		session, err := h.authSvc.LoginSession(c.Request.Context(), req.Username, req.Password)
+		if err != nil {
+			response.Error(c, err)
+			return
+		}
+		h.respondSession(c, session)
+		return
+	}
+
 	token, expiry, err := h.authSvc.Login(c.Request.Context(), req.Username, req.Password)
 	if err != nil {
 		response.Error(c, err)
@@ -69,6 +150,71 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	})
 }
 
+// Refresh handles POST /api/v1/auth/refresh. It exchanges the refresh token
+// cookie for a new access token and rotates the cookie.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	if h.refreshCookie.RequireTLS && !h.isTLS(c) {
+		response.Error(c, apperror.ErrTLSRequired())
+		return
+	}
+
+	refreshToken, err := c.Cookie(RefreshCookieName)
+	if err != nil || refreshToken == "" {
+		response.Error(c, apperror.ErrInvalidToken())
+		return
+	}
+
+	session, err := h.authSvc.Refresh(c.Request.Context(), refreshToken)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+	h.respondSession(c, session)
+}
+
+// respondSession sets the refresh token cookie and returns the access token
+// in the body, as Login does without cookies.
+func (h *AuthHandler) respondSession(c *gin.Context, session *ports.SessionTokens) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     RefreshCookieName,
+		Value:    session.RefreshToken,
+		Path:     refreshCookiePath,
+		Domain:   h.refreshCookie.Domain,
+		Expires:  session.RefreshExpiry,
+		MaxAge:   int(time.Until(session.RefreshExpiry).Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: h.refreshCookie.SameSite,
+	})
+
+	response.OK(c, dto.LoginResponse{
+		Token:  session.AccessToken,
+		Expiry: session.AccessExpiry.Unix(),
+	})
+}
+
+// isTLS reports whether the request reached the gateway, or a trusted proxy
+// in front of it, over HTTPS.
+func (h *AuthHandler) isTLS(c *gin.Context) bool {
+	if c.Request.TLS != nil {
+		return true
+	}
+	if c.GetHeader("X-Forwarded-Proto") != "https" {
+		return false
+	}
+	peer, err := netip.ParseAddr(c.RemoteIP())
+	if err != nil {
+		return false
+	}
+	peer = peer.Unmap()
+	for _, proxy := range h.trustedProxies {
+		if proxy.Contains(peer) {
+			return true
+		}
+	}
+	return false
+}
+
 // HealthCheck handles GET /health — deep health check verifying all dependencies.
 func HealthCheck(checkers ...ports.HealthChecker) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -99,6 +245,12 @@ func HealthCheck(checkers ...ports.HealthChecker) gin.HandlerFunc {
 		c.JSON(httpCode, gin.H{
 			"status":       status,
 			"dependencies": deps,
+			"build":        buildinfo.Get(),
 		})
 	}
 }
+
+// Version handles GET /version — the build metadata of the running binary.
+func Version(c *gin.Context) {
+	c.JSON(http.StatusOK, buildinfo.Get())
+}
@@ -1,14 +1,22 @@
 package handler
 
 import (
-"math"
+"bytes"
+"encoding/csv"
+"encoding/json"
+"fmt"
+"io"
+"net/http"
+"slices"
 "strconv"
+"strings"
 
 "secure-payment-gateway/internal/adapter/http/dto"
 "secure-payment-gateway/internal/adapter/http/middleware"
 "secure-payment-gateway/internal/core/domain"
 "secure-payment-gateway/internal/core/ports"
 "secure-payment-gateway/pkg/apperror"
+"secure-payment-gateway/pkg/pagination"
 "secure-payment-gateway/pkg/response"
 
 "github.com/gin-gonic/gin"
@@ -45,9 +53,9 @@ TotalTransactions: stats.TotalTransactions,
 Successful:        stats.Successful,
 Failed:            stats.Failed,
 Reversed:          stats.Reversed,
-TotalRevenue:      stats.TotalRevenue,
-TotalRefunded:     stats.TotalRefunded,
-TotalTopup:        stats.TotalTopup,
+TotalRevenue:      json.Number(stats.TotalRevenue.String()),
+TotalRefunded:     json.Number(stats.TotalRefunded.String()),
+TotalTopup:        json.Number(stats.TotalTopup.String()),
 })
 }
 
@@ -59,27 +67,163 @@ response.Error(c, apperror.ErrInvalidToken())
 return
 }
 
-page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
-if page < 1 {
-page = 1
+page := pagination.FromQuery(c)
+
+params, err := transactionFilterParams(c, merchantID.(uuid.UUID))
+if err != nil {
+response.Error(c, err)
+return
+}
+params.Page = page.Number
+params.PageSize = page.Size
+params.SortBy = c.Query("sort_by")
+params.SortDir = c.Query("sort_dir")
+if params.SortBy != "" && !slices.Contains(ports.TransactionSortFields, params.SortBy) {
+response.Error(c, apperror.Validation(fmt.Sprintf("sort_by must be one of %v", ports.TransactionSortFields)))
+return
 }
-if pageSize < 1 || pageSize > 100 {
-pageSize = 20
+if params.SortDir != "" && params.SortDir != ports.SortAsc && params.SortDir != ports.SortDesc {
+response.Error(c, apperror.Validation("sort_dir must be asc or desc"))
+return
+}
+includeTotal := true
+if v := c.Query("include_total"); v != "" {
+if includeTotal, err = strconv.ParseBool(v); err != nil {
+response.Error(c, apperror.Validation("include_total must be true or false"))
+return
 }
+}
+params.SkipTotal = !includeTotal
 
-params := ports.TransactionListParams{
-MerchantID: merchantID.(uuid.UUID),
-Page:       page,
-PageSize:   pageSize,
+txns, total, err := h.reportingSvc.ListTransactions(c.Request.Context(), params)
+if err != nil {
+response.Error(c, err)
+return
+}
+
+items := make([]dto.TransactionResponse, 0, len(txns))
+for i := range txns {
+items = append(items, toTransactionResponse(&txns[i]))
+}
+
+if params.SkipTotal {
+response.OK(c, pagination.NewUncountedList(c, page, items))
+return
+}
+response.OK(c, pagination.NewList(c, page, items, total))
+}
+
+// GetTransaction handles GET /api/v1/transactions/:id.
+func (h *DashboardHandler) GetTransaction(c *gin.Context) {
+merchantID, ok := c.Get(middleware.CtxMerchantID)
+if !ok {
+response.Error(c, apperror.ErrInvalidToken())
+return
+}
+
+txID, err := uuid.Parse(c.Param("id"))
+if err != nil {
+response.Error(c, apperror.Validation("invalid transaction id"))
+return
+}
+
+txn, err := h.reportingSvc.GetTransaction(c.Request.Context(), merchantID.(uuid.UUID), txID)
+if err != nil {
+response.Error(c, err)
+return
+}
+response.OK(c, toTransactionResponse(txn))
+}
+
+// ExportTransactions handles GET /api/v1/transactions/export as a CSV download.
+// Accepts the same filters as ListTransactions; pagination does not apply.
+func (h *DashboardHandler) ExportTransactions(c *gin.Context) {
+merchantID, ok := c.Get(middleware.CtxMerchantID)
+if !ok {
+response.Error(c, apperror.ErrInvalidToken())
+return
 }
 
+params, err := transactionFilterParams(c, merchantID.(uuid.UUID))
+if err != nil {
+response.Error(c, err)
+return
+}
+
+txns, err := h.reportingSvc.ExportTransactions(c.Request.Context(), params)
+if err != nil {
+response.Error(c, err)
+return
+}
+
+// Rendered in full before anything is sent, so a write error can still
+// be reported; the export row cap bounds the buffer.
+var buf bytes.Buffer
+if err := writeTransactionsCSV(&buf, txns); err != nil {
+response.Error(c, apperror.InternalError(fmt.Errorf("write transactions csv: %w", err)))
+return
+}
+
+c.Header("Content-Disposition", `attachment; filename="transactions.csv"`)
+c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+// writeTransactionsCSV writes txns as CSV to out and returns the first
+// write error, including one only surfaced by the final flush.
+func writeTransactionsCSV(out io.Writer, txns []domain.Transaction) error {
+w := csv.NewWriter(out)
+if err := w.Write([]string{"id", "reference_id", "transaction_type", "status", "amount", "created_at", "processed_at"}); err != nil {
+return err
+}
+for i := range txns {
+tx := toTransactionResponse(&txns[i])
+processedAt := ""
+if tx.ProcessedAt != nil {
+processedAt = *tx.ProcessedAt
+}
+row := []string{
+tx.ID, tx.ReferenceID, tx.TransactionType, tx.Status,
+tx.Amount.String(), tx.CreatedAt, processedAt,
+}
+for j := range row {
+row[j] = csvSafeCell(row[j])
+}
+if err := w.Write(row); err != nil {
+return err
+}
+}
+w.Flush()
+return w.Error()
+}
+
+// csvSafeCell prefixes a cell that a spreadsheet would evaluate as a
+// formula with a single quote, so it opens as text.
+func csvSafeCell(s string) string {
+if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+return "'" + s
+}
+return s
+}
+
+// transactionFilterParams reads the status/type/from/to query filters. An
+// unknown status or type is rejected rather than silently matching nothing.
+func transactionFilterParams(c *gin.Context, merchantID uuid.UUID) (ports.TransactionListParams, error) {
+params := ports.TransactionListParams{MerchantID: merchantID}
+
 if s := c.Query("status"); s != "" {
 status := domain.TransactionStatus(s)
+if !status.IsValid() {
+return params, apperror.Validation(fmt.Sprintf("status must be one of %s, %s, %s or %s",
+domain.TransactionStatusPending, domain.TransactionStatusSuccess, domain.TransactionStatusFailed, domain.TransactionStatusReversed))
+}
 params.Status = &status
 }
 if t := c.Query("type"); t != "" {
 txType := domain.TransactionType(t)
+if !txType.IsValid() {
+return params, apperror.Validation(fmt.Sprintf("type must be one of %s, %s, %s or %s",
+domain.TransactionTypePayment, domain.TransactionTypeRefund, domain.TransactionTypeTopup, domain.TransactionTypeReversal))
+}
 params.Type = &txType
 }
 if f := c.Query("from"); f != "" {
@@ -92,25 +236,5 @@ if v, err := strconv.ParseInt(t, 10, 64); err == nil {
 params.To = &v
 }
 }
-
-txns, total, err := h.reportingSvc.ListTransactions(c.Request.Context(), params)
-if err != nil {
-response.Error(c, err)
-return
-}
-
-items := make([]dto.TransactionResponse, 0, len(txns))
-for i := range txns {
-items = append(items, toTransactionResponse(&txns[i]))
-}
-
-totalPages := int(math.Ceil(float64(total) / float64(pageSize)))
-
-response.OK(c, dto.TransactionListResponse{
-Items:      items,
-Total:      total,
-Page:       page,
-PageSize:   pageSize,
-TotalPages: totalPages,
-})
+return params, nil
 }
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"secure-payment-gateway/internal/adapter/http/dto"
+	"secure-payment-gateway/pkg/apperror"
+	"secure-payment-gateway/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetErrorCatalog handles GET /api/v1/errors — every error code with its
+// message template and HTTP status, generated from pkg/apperror.
+func GetErrorCatalog(c *gin.Context) {
+	catalog := apperror.Catalog()
+	resp := dto.ErrorCatalogResponse{Errors: make([]dto.ErrorCodeResponse, 0, len(catalog))}
+	for _, e := range catalog {
+		resp.Errors = append(resp.Errors, dto.ErrorCodeResponse{
+			ErrorCode:  e.Code,
+			Message:    e.Message,
+			HTTPStatus: e.HTTPStatus,
+		})
+	}
+
+	c.Header("Cache-Control", "public, max-age=3600")
+	response.OK(c, resp)
+}
+
+// NoRoute answers requests to unknown paths with the standard error envelope
+// instead of Gin's plain-text 404.
+func NoRoute(c *gin.Context) {
+	response.Error(c, apperror.ErrRouteNotFound())
+}
+
+// NoMethod answers requests to a known path with an unsupported method with
+// the standard error envelope instead of Gin's plain-text 405.
+func NoMethod(c *gin.Context) {
+	response.Error(c, apperror.ErrMethodNotAllowed())
+}
@@ -2,21 +2,37 @@ package handler
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
 	"secure-payment-gateway/internal/adapter/http/dto"
+	"secure-payment-gateway/internal/adapter/http/middleware"
+	memoryStore "secure-payment-gateway/internal/adapter/storage/memory"
+	redisStore "secure-payment-gateway/internal/adapter/storage/redis"
 	"secure-payment-gateway/internal/core/domain"
 	"secure-payment-gateway/internal/core/ports"
 	"secure-payment-gateway/internal/core/ports/mocks"
 	"secure-payment-gateway/pkg/apperror"
+	"secure-payment-gateway/pkg/buildinfo"
+	"secure-payment-gateway/pkg/response"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
@@ -140,6 +156,152 @@ func TestLogin_Success(t *testing.T) {
 	assert.Equal(t, "jwt-token-123", data["token"])
 }
 
+func newLoginContext(w *httptest.ResponseRecorder, https bool) *gin.Context {
+	body, _ := json.Marshal(dto.LoginRequest{Username: "testuser", Password: "password123"})
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	if https {
+		c.Request.Header.Set("X-Forwarded-Proto", "https")
+	}
+	return c
+}
+
+func TestLogin_RefreshCookieAttributes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockAuth := mocks.NewMockAuthService(ctrl)
+	h := NewAuthHandler(mockAuth, WithRefreshCookie(RefreshCookie{Domain: "dashboard.example.com", RequireTLS: true}),
+		WithTrustedProxies([]netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")})) // httptest's peer
+
+	refreshExpiry := time.Now().Add(168 * time.Hour)
+	mockAuth.EXPECT().LoginSession(gomock.Any(), "testuser", "password123").Return(&ports.SessionTokens{
+		AccessToken:   "jwt-token-123",
+		AccessExpiry:  time.Now().Add(time.Hour),
+		RefreshToken:  "refresh-token-123",
+		RefreshExpiry: refreshExpiry,
+	}, nil)
+
+	w := httptest.NewRecorder()
+	h.Login(newLoginContext(w, true))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "jwt-token-123", resp["data"].(map[string]interface{})["token"])
+	assert.NotContains(t, w.Body.String(), "refresh-token-123")
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	cookie := cookies[0]
+	assert.Equal(t, RefreshCookieName, cookie.Name)
+	assert.Equal(t, "refresh-token-123", cookie.Value)
+	assert.Equal(t, "/api/v1/auth", cookie.Path)
+	assert.Equal(t, "dashboard.example.com", cookie.Domain)
+	assert.True(t, cookie.Secure)
+	assert.True(t, cookie.HttpOnly)
+	assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite)
+	assert.InDelta(t, time.Until(refreshExpiry).Seconds(), cookie.MaxAge, 5)
+
+	header := w.Header().Get("Set-Cookie")
+	assert.Contains(t, header, "; Secure")
+	assert.Contains(t, header, "; HttpOnly")
+	assert.Contains(t, header, "; SameSite=Strict")
+}
+
+func TestLogin_RefreshCookieRequiresTLS(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// The service must not be reached over plain HTTP
+	h := NewAuthHandler(mocks.NewMockAuthService(ctrl), WithRefreshCookie(RefreshCookie{RequireTLS: true}))
+
+	w := httptest.NewRecorder()
+	h.Login(newLoginContext(w, false))
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "SEC_006")
+	assert.Empty(t, w.Header().Get("Set-Cookie"))
+}
+
+func TestLogin_ForwardedProtoOnlyFromTrustedProxies(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// httptest's peer is 192.0.2.1, outside the trusted range, so its
+	// X-Forwarded-Proto could have been set by the client itself
+	h := NewAuthHandler(mocks.NewMockAuthService(ctrl), WithRefreshCookie(RefreshCookie{RequireTLS: true}),
+		WithTrustedProxies([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}))
+
+	w := httptest.NewRecorder()
+	h.Login(newLoginContext(w, true))
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "SEC_006")
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	prefixes, err := ParseTrustedProxies([]string{"10.0.0.0/8", " 192.0.2.7 ", "::ffff:198.51.100.1", "2001:db8::/32", ""})
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.7/32"),
+		netip.MustParsePrefix("198.51.100.1/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}, prefixes)
+
+	_, err = ParseTrustedProxies([]string{"proxy.internal"})
+	assert.Error(t, err)
+}
+
+func TestRefresh_RotatesCookie(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockAuth := mocks.NewMockAuthService(ctrl)
+	h := NewAuthHandler(mockAuth, WithRefreshCookie(RefreshCookie{SameSite: http.SameSiteLaxMode}))
+
+	mockAuth.EXPECT().Refresh(gomock.Any(), "old-refresh").Return(&ports.SessionTokens{
+		AccessToken:   "new-jwt",
+		AccessExpiry:  time.Now().Add(time.Hour),
+		RefreshToken:  "new-refresh",
+		RefreshExpiry: time.Now().Add(168 * time.Hour),
+	}, nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/auth/refresh", nil)
+	c.Request.AddCookie(&http.Cookie{Name: RefreshCookieName, Value: "old-refresh"})
+
+	h.Refresh(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "new-jwt")
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "new-refresh", cookies[0].Value)
+	assert.True(t, cookies[0].Secure)
+	assert.True(t, cookies[0].HttpOnly)
+	assert.Equal(t, http.SameSiteLaxMode, cookies[0].SameSite)
+}
+
+func TestRefresh_MissingCookie(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h := NewAuthHandler(mocks.NewMockAuthService(ctrl), WithRefreshCookie(RefreshCookie{}))
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/auth/refresh", nil)
+
+	h.Refresh(c)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "AUTH_003")
+}
+
 func TestLogin_InvalidCredentials(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -190,7 +352,7 @@ func TestProcessPayment_Success(t *testing.T) {
 
 	body, _ := json.Marshal(dto.PaymentRequest{
 		ReferenceID: "ref-001",
-		Amount:      50000,
+		Amount:      "50000",
 		Currency:    "VND",
 	})
 
@@ -210,6 +372,60 @@ func TestProcessPayment_Success(t *testing.T) {
 	assert.Equal(t, "PAYMENT", data["transaction_type"])
 }
 
+func TestCreateEndpoints_PreferReturnMinimal(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPayment := mocks.NewMockPaymentService(ctrl)
+	paymentHandler := NewPaymentHandler(mockPayment, nil)
+	walletHandler := NewWalletHandler(mockPayment, nil, nil)
+
+	txn := &domain.Transaction{ID: uuid.New(), ReferenceID: "ref-001", Amount: 50000, Status: domain.TransactionStatusSuccess, CreatedAt: time.Now()}
+	mockPayment.EXPECT().ProcessPayment(gomock.Any(), gomock.Any()).Return(txn, nil).AnyTimes()
+	mockPayment.EXPECT().ProcessRefund(gomock.Any(), gomock.Any()).Return(txn, nil).AnyTimes()
+	mockPayment.EXPECT().ProcessTopup(gomock.Any(), gomock.Any()).Return(txn, nil).AnyTimes()
+
+	endpoints := map[string]struct {
+		serve gin.HandlerFunc
+		body  any
+	}{
+		"payment": {paymentHandler.ProcessPayment, dto.PaymentRequest{ReferenceID: "ref-001", Amount: "50000", Currency: "VND"}},
+		"refund":  {paymentHandler.ProcessRefund, dto.RefundRequest{OriginalReferenceID: "ref-001", Reason: "Customer request"}},
+		"topup":   {walletHandler.Topup, dto.TopupRequest{Amount: "50000", Currency: "VND"}},
+	}
+	for name, ep := range endpoints {
+		for _, prefer := range []string{"", "return=representation", "return=minimal", "respond-async, RETURN = minimal; x=1"} {
+			body, _ := json.Marshal(ep.body)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			if prefer != "" {
+				c.Request.Header.Set(HeaderPrefer, prefer)
+			}
+			c.Set("merchant_id", uuid.New())
+
+			ep.serve(c)
+
+			require.Equal(t, http.StatusCreated, w.Code, name)
+			assert.Equal(t, "/api/v1/transactions/"+txn.ID.String(), w.Header().Get("Location"), name)
+			var resp struct {
+				Data map[string]any `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, txn.ID.String(), resp.Data["id"], name)
+
+			if strings.Contains(strings.ToLower(prefer), "minimal") {
+				assert.Equal(t, "return=minimal", w.Header().Get(HeaderPreferenceApplied), name)
+				assert.Len(t, resp.Data, 1, "%s %q: only the id", name, prefer)
+			} else {
+				assert.Empty(t, w.Header().Get(HeaderPreferenceApplied), name)
+				assert.Equal(t, "ref-001", resp.Data["reference_id"], "%s %q: full body", name, prefer)
+			}
+		}
+	}
+}
+
 func TestProcessPayment_MissingMerchantID(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -226,6 +442,173 @@ func TestProcessPayment_MissingMerchantID(t *testing.T) {
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
 }
 
+// newPaymentContext builds a payment request as HMACAuth would leave it.
+func newPaymentContext(w *httptest.ResponseRecorder, merchant *domain.Merchant, idempotencyKey string) *gin.Context {
+	body, _ := json.Marshal(dto.PaymentRequest{ReferenceID: "ref-001", Amount: "50000", Currency: "VND"})
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	if idempotencyKey != "" {
+		c.Request.Header.Set(HeaderIdempotencyKey, idempotencyKey)
+	}
+	c.Set("merchant_id", merchant.ID)
+	c.Set(middleware.CtxMerchantKey, merchant)
+	return c
+}
+
+func TestProcessPayment_RecordsInitiatingAccessKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPayment := mocks.NewMockPaymentService(ctrl)
+	h := NewPaymentHandler(mockPayment, nil)
+
+	mockPayment.EXPECT().ProcessPayment(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, req ports.PaymentRequest) (*domain.Transaction, error) {
+			assert.Equal(t, "ak_live_0001", req.InitiatedBy)
+			return &domain.Transaction{
+				ID:              uuid.New(),
+				TransactionType: domain.TransactionTypePayment,
+				Status:          domain.TransactionStatusSuccess,
+				InitiatedBy:     req.InitiatedBy,
+			}, nil
+		})
+
+	w := httptest.NewRecorder()
+	c := newPaymentContext(w, &domain.Merchant{ID: uuid.New()}, "")
+	c.Set(middleware.CtxAccessKey, "ak_live_0001")
+	h.ProcessPayment(c)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "ak_live_0001", resp["data"].(map[string]interface{})["initiated_by"])
+}
+
+func TestProcessPayment_RequiredIdempotencyKeyMissing(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPayment := mocks.NewMockPaymentService(ctrl) // no calls expected
+	h := NewPaymentHandler(mockPayment, nil)
+
+	w := httptest.NewRecorder()
+	h.ProcessPayment(newPaymentContext(w, &domain.Merchant{ID: uuid.New(), RequireIdempotencyKey: true}, ""))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "PAY_002")
+	assert.Contains(t, w.Body.String(), "Idempotency-Key")
+}
+
+func TestProcessPayment_RequiredIdempotencyKeyPresent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPayment := mocks.NewMockPaymentService(ctrl)
+	h := NewPaymentHandler(mockPayment, nil)
+	mockPayment.EXPECT().ProcessPayment(gomock.Any(), gomock.Any()).Return(&domain.Transaction{ID: uuid.New()}, nil)
+
+	w := httptest.NewRecorder()
+	h.ProcessPayment(newPaymentContext(w, &domain.Merchant{ID: uuid.New(), RequireIdempotencyKey: true}, "key-1"))
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestProcessPayment_PassesIdempotencyKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPayment := mocks.NewMockPaymentService(ctrl)
+	h := NewPaymentHandler(mockPayment, nil)
+	mockPayment.EXPECT().ProcessPayment(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, req ports.PaymentRequest) (*domain.Transaction, error) {
+			assert.Equal(t, "key-1", req.IdempotencyKey)
+			assert.Equal(t, "ref-001", req.ReferenceID)
+			return &domain.Transaction{ID: uuid.New()}, nil
+		})
+
+	w := httptest.NewRecorder()
+	h.ProcessPayment(newPaymentContext(w, &domain.Merchant{ID: uuid.New()}, "key-1"))
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestProcessPayment_IdempotencyKeyOptionalByDefault(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPayment := mocks.NewMockPaymentService(ctrl)
+	h := NewPaymentHandler(mockPayment, nil)
+	mockPayment.EXPECT().ProcessPayment(gomock.Any(), gomock.Any()).Return(&domain.Transaction{ID: uuid.New()}, nil)
+
+	w := httptest.NewRecorder()
+	h.ProcessPayment(newPaymentContext(w, &domain.Merchant{ID: uuid.New()}, ""))
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestProcessPayment_IdempotencyKeyTooLong(t *testing.T) {
+	h := NewPaymentHandler(nil, nil)
+
+	w := httptest.NewRecorder()
+	h.ProcessPayment(newPaymentContext(w, &domain.Merchant{ID: uuid.New()}, strings.Repeat("k", maxIdempotencyKeyLen+1)))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestProcessPayment_IdempotencyHeaderPrecedence(t *testing.T) {
+	h := NewPaymentHandler(nil, nil, WithIdempotencyHeaders("Idempotency-Key", "X-Idempotency-Key", "X-Request-ID"))
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{"none", map[string]string{}, ""},
+		{"Idempotency-Key", map[string]string{"Idempotency-Key": "a", "X-Idempotency-Key": "b", "X-Request-ID": "c"}, "a"},
+		{"X-Idempotency-Key", map[string]string{"X-Idempotency-Key": "b", "X-Request-ID": "c"}, "b"},
+		{"X-Request-ID", map[string]string{"X-Request-ID": "c"}, "c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+			for k, v := range tt.headers {
+				c.Request.Header.Set(k, v)
+			}
+			key, err := h.idempotencyKey(c)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, key)
+		})
+	}
+}
+
+func TestProcessPayment_IdempotencyHeaderDefaultIgnoresOthers(t *testing.T) {
+	h := NewPaymentHandler(nil, nil, WithIdempotencyHeaders())
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	c.Request.Header.Set("X-Request-ID", "req-1")
+
+	key, err := h.idempotencyKey(c)
+	require.NoError(t, err)
+	assert.Empty(t, key)
+}
+
+func TestProcessPayment_IdempotencyKeyInvalidCharset(t *testing.T) {
+	h := NewPaymentHandler(nil, nil, WithIdempotencyHeaders("X-Idempotency-Key"))
+
+	for _, key := range []string{"has space", "tab\tkey", "caf\u00e9"} {
+		w := httptest.NewRecorder()
+		c := newPaymentContext(w, &domain.Merchant{ID: uuid.New()}, "")
+		c.Request.Header.Set("X-Idempotency-Key", key)
+		h.ProcessPayment(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, key)
+		assert.Contains(t, w.Body.String(), "X-Idempotency-Key must contain only printable ASCII", key)
+	}
+}
+
 func TestProcessPayment_InsufficientFunds(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -238,7 +621,7 @@ func TestProcessPayment_InsufficientFunds(t *testing.T) {
 
 	body, _ := json.Marshal(dto.PaymentRequest{
 		ReferenceID: "ref-001",
-		Amount:      9999999,
+		Amount:      "9999999",
 		Currency:    "VND",
 	})
 
@@ -253,6 +636,110 @@ func TestProcessPayment_InsufficientFunds(t *testing.T) {
 	assert.Equal(t, http.StatusPaymentRequired, w.Code)
 }
 
+func TestProcessPayment_DecimalAmount(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPayment := mocks.NewMockPaymentService(ctrl)
+	h := NewPaymentHandler(mockPayment, nil)
+
+	merchantID := uuid.New()
+	send := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("merchant_id", merchantID)
+		h.ProcessPayment(c)
+		return w
+	}
+
+	// A fractional amount reaches the service exactly and comes back exactly
+	mockPayment.EXPECT().ProcessPayment(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, req ports.PaymentRequest) (*domain.Transaction, error) {
+			assert.Equal(t, int64(1), req.Amount)
+			require.NotNil(t, req.AmountDecimal)
+			assert.Equal(t, "1.000000017", req.AmountDecimal.String())
+			return &domain.Transaction{
+				ID: uuid.New(), ReferenceID: req.ReferenceID, Amount: req.Amount, AmountDecimal: req.AmountDecimal,
+				TransactionType: domain.TransactionTypePayment, Status: domain.TransactionStatusSuccess,
+				Currency: "BTC", CreatedAt: time.Now(),
+			}, nil
+		})
+	w := send(`{"reference_id":"ORDER-BTC","amount":1.000000017,"currency":"BTC"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"amount":1.000000017`)
+
+	// A whole amount carries no decimal part
+	mockPayment.EXPECT().ProcessPayment(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, req ports.PaymentRequest) (*domain.Transaction, error) {
+			assert.Equal(t, int64(50000), req.Amount)
+			assert.Nil(t, req.AmountDecimal)
+			return nil, apperror.ErrInsufficientFunds()
+		})
+	assert.Equal(t, http.StatusPaymentRequired, send(`{"reference_id":"ORDER-VND","amount":50000,"currency":"VND"}`).Code)
+
+	// The service rejects a fraction the wallet cannot hold
+	mockPayment.EXPECT().ProcessPayment(gomock.Any(), gomock.Any()).
+		Return(nil, apperror.Validation("amount must be a whole number of minor units for VND wallets"))
+	w = send(`{"reference_id":"ORDER-VND","amount":500.5,"currency":"VND"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "PAY_002")
+
+	// Malformed amounts never reach the service
+	for _, amount := range []string{`0`, `-1.5`, `"abc"`, `9223372036854775808`} {
+		w := send(`{"reference_id":"ORDER-BAD","amount":` + amount + `,"currency":"VND"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code, amount)
+		assert.Contains(t, w.Body.String(), "PAY_002", amount)
+	}
+}
+
+func TestProcessPayment_SyncWebhookFailureStillSucceeds(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPayment := mocks.NewMockPaymentService(ctrl)
+	mockWebhook := mocks.NewMockWebhookService(ctrl)
+	h := NewPaymentHandler(mockPayment, mockWebhook)
+
+	merchantID := uuid.New()
+	txn := &domain.Transaction{
+		ID:              uuid.New(),
+		ReferenceID:     "ORDER-SYNC",
+		MerchantID:      merchantID,
+		Amount:          50000,
+		TransactionType: domain.TransactionTypePayment,
+		Status:          domain.TransactionStatusSuccess,
+		CreatedAt:       time.Now(),
+	}
+	errMsg := "context deadline exceeded"
+	mockPayment.EXPECT().ProcessPayment(gomock.Any(), gomock.Any()).Return(txn, nil)
+	mockWebhook.EXPECT().DispatchWebhook(gomock.Any(), txn).Return(&ports.WebhookDispatchResult{
+		Synchronous: true,
+		Delivered:   false,
+		Error:       &errMsg,
+	}, nil)
+
+	body, _ := json.Marshal(dto.PaymentRequest{ReferenceID: "ORDER-SYNC", Amount: "50000", Currency: "VND"})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("merchant_id", merchantID)
+
+	h.ProcessPayment(c)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var resp struct {
+		Data dto.TransactionResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "SUCCESS", resp.Data.Status)
+	require.NotNil(t, resp.Data.Webhook)
+	assert.False(t, resp.Data.Webhook.Delivered)
+	assert.Equal(t, errMsg, *resp.Data.Webhook.Error)
+}
+
 func TestProcessRefund_Success(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -290,108 +777,595 @@ func TestProcessRefund_Success(t *testing.T) {
 	assert.Equal(t, http.StatusCreated, w.Code)
 }
 
-// --- Wallet Handler Tests ---
+func newBatchRefundContext(w *httptest.ResponseRecorder, merchantID uuid.UUID, req dto.BatchRefundRequest) *gin.Context {
+	body, _ := json.Marshal(req)
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("merchant_id", merchantID)
+	return c
+}
 
-func TestGetBalance_Success(t *testing.T) {
+func TestProcessRefundBatch_MixedResults(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	mockPayment := mocks.NewMockPaymentService(ctrl)
-	mockReporting := mocks.NewMockReportingService(ctrl)
-	h := NewWalletHandler(mockPayment, mockReporting, nil)
+	mockWebhook := mocks.NewMockWebhookService(ctrl)
+	h := NewPaymentHandler(mockPayment, mockWebhook)
 
 	merchantID := uuid.New()
-	mockReporting.EXPECT().GetWalletBalance(gomock.Any(), merchantID).Return(int64(100000), "VND", nil)
+	partial := int64(10000)
+	partialAmount := json.Number("10000")
+	refund := &domain.Transaction{
+		ID:              uuid.New(),
+		ReferenceID:     "refund-ok",
+		MerchantID:      merchantID,
+		Amount:          partial,
+		TransactionType: domain.TransactionTypeRefund,
+		Status:          domain.TransactionStatusSuccess,
+		CreatedAt:       time.Now(),
+	}
+
+	// Items are processed in request order; a failure does not stop the batch.
+	gomock.InOrder(
+		mockPayment.EXPECT().ProcessRefund(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, req ports.RefundRequest) (*domain.Transaction, error) {
+				assert.Equal(t, merchantID, req.MerchantID)
+				assert.Equal(t, "ref-ok", req.OriginalReferenceID)
+				assert.Equal(t, &partial, req.Amount)
+				assert.Equal(t, "Event cancelled", req.Reason)
+				return refund, nil
+			}),
+		mockPayment.EXPECT().ProcessRefund(gomock.Any(), gomock.Any()).Return(nil, apperror.ErrNotFound("original transaction")),
+		mockPayment.EXPECT().ProcessRefund(gomock.Any(), gomock.Any()).Return(nil, apperror.ErrDuplicateTransaction()),
+		mockPayment.EXPECT().ProcessRefund(gomock.Any(), gomock.Any()).Return(nil, errors.New("connection reset")),
+	)
+	mockWebhook.EXPECT().EnqueueWebhook(gomock.Any(), refund).Return(nil).Times(1)
 
 	w := httptest.NewRecorder()
-	c, _ := gin.CreateTestContext(w)
-	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
-	c.Set("merchant_id", merchantID)
-
-	h.GetBalance(c)
+	h.ProcessRefundBatch(newBatchRefundContext(w, merchantID, dto.BatchRefundRequest{
+		Reason: "Event cancelled",
+		Items: []dto.BatchRefundItem{
+			{OriginalReferenceID: "ref-ok", Amount: &partialAmount},
+			{OriginalReferenceID: "ref-missing"},
+			{OriginalReferenceID: "ref-refunded"},
+			{OriginalReferenceID: "ref-broken"},
+		},
+	}))
 
-	assert.Equal(t, http.StatusOK, w.Code)
-	var resp map[string]interface{}
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Data dto.BatchRefundResponse `json:"data"`
+	}
 	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
-	data := resp["data"].(map[string]interface{})
-	assert.Equal(t, float64(100000), data["balance"])
-	assert.Equal(t, "VND", data["currency"])
+
+	assert.Equal(t, 1, resp.Data.Succeeded)
+	assert.Equal(t, 3, resp.Data.Failed)
+	require.Len(t, resp.Data.Results, 4)
+
+	ok := resp.Data.Results[0]
+	assert.Equal(t, "ref-ok", ok.OriginalReferenceID)
+	require.NotNil(t, ok.Transaction)
+	assert.Equal(t, refund.ID.String(), ok.Transaction.ID)
+	assert.Empty(t, ok.ErrorCode)
+
+	assert.Equal(t, "ref-missing", resp.Data.Results[1].OriginalReferenceID)
+	assert.Equal(t, "PAY_004", resp.Data.Results[1].ErrorCode)
+	assert.Nil(t, resp.Data.Results[1].Transaction)
+	assert.Equal(t, "PAY_003", resp.Data.Results[2].ErrorCode)
+	// Unexpected errors are masked like top-level 500s
+	assert.Equal(t, "SYS_001", resp.Data.Results[3].ErrorCode)
+	assert.NotContains(t, w.Body.String(), "connection reset")
 }
 
-func TestTopup_Success(t *testing.T) {
+func TestProcessRefundBatch_ReplayReturnsCachedResults(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	mockPayment := mocks.NewMockPaymentService(ctrl)
-	mockReporting := mocks.NewMockReportingService(ctrl)
-	h := NewWalletHandler(mockPayment, mockReporting, nil)
+	mockWebhook := mocks.NewMockWebhookService(ctrl)
+	h := NewPaymentHandler(mockPayment, mockWebhook, WithBatchIdempotency(memoryStore.NewIdempotencyCache(100)))
 
 	merchantID := uuid.New()
-	txID := uuid.New()
-	now := time.Now()
-
-	mockPayment.EXPECT().ProcessTopup(gomock.Any(), ports.TopupRequest{
-		MerchantID: merchantID,
-		Amount:     500000,
-		Currency:   "VND",
-	}).Return(&domain.Transaction{
-		ID:              txID,
+	refund := &domain.Transaction{
+		ID:              uuid.New(),
+		ReferenceID:     "refund-ok",
 		MerchantID:      merchantID,
-		Amount:          500000,
-		TransactionType: domain.TransactionTypeTopup,
+		Amount:          10000,
+		TransactionType: domain.TransactionTypeRefund,
 		Status:          domain.TransactionStatusSuccess,
-		CreatedAt:       now,
-	}, nil)
-
-	body, _ := json.Marshal(dto.TopupRequest{
-		Amount:   500000,
-		Currency: "VND",
-	})
+		CreatedAt:       time.Now(),
+	}
+
+	// Only the first submission reaches the service and sends webhooks
+	gomock.InOrder(
+		mockPayment.EXPECT().ProcessRefund(gomock.Any(), gomock.Any()).Return(refund, nil),
+		mockPayment.EXPECT().ProcessRefund(gomock.Any(), gomock.Any()).Return(nil, apperror.ErrNotFound("original transaction")),
+	)
+	mockWebhook.EXPECT().EnqueueWebhook(gomock.Any(), refund).Return(nil).Times(1)
+
+	req := dto.BatchRefundRequest{
+		Reason: "Event cancelled",
+		Items:  []dto.BatchRefundItem{{OriginalReferenceID: "ref-ok"}, {OriginalReferenceID: "ref-missing"}},
+	}
+	submit := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c := newBatchRefundContext(w, merchantID, req)
+		c.Request.Header.Set(HeaderIdempotencyKey, "batch-1")
+		h.ProcessRefundBatch(c)
+		return w
+	}
+
+	first := submit()
+	require.Equal(t, http.StatusOK, first.Code)
+	replay := submit()
+	require.Equal(t, http.StatusOK, replay.Code)
+
+	var firstResp, replayResp struct {
+		Data dto.BatchRefundResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(first.Body.Bytes(), &firstResp))
+	require.NoError(t, json.Unmarshal(replay.Body.Bytes(), &replayResp))
+	assert.Equal(t, firstResp.Data, replayResp.Data)
+	require.Len(t, replayResp.Data.Results, 2)
+	assert.Equal(t, refund.ID.String(), replayResp.Data.Results[0].Transaction.ID)
+	assert.Equal(t, "PAY_004", replayResp.Data.Results[1].ErrorCode)
+}
 
-	w := httptest.NewRecorder()
-	c, _ := gin.CreateTestContext(w)
-	c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
-	c.Request.Header.Set("Content-Type", "application/json")
-	c.Set("merchant_id", merchantID)
+func TestProcessRefundBatch_ReusedKeyWithDifferentBatchIsRejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
 
-	h.Topup(c)
+	mockPayment := mocks.NewMockPaymentService(ctrl)
+	h := NewPaymentHandler(mockPayment, nil, WithBatchIdempotency(memoryStore.NewIdempotencyCache(100)))
 
-	assert.Equal(t, http.StatusCreated, w.Code)
+	merchantID := uuid.New()
+	mockPayment.EXPECT().ProcessRefund(gomock.Any(), gomock.Any()).Return(nil, apperror.ErrNotFound("original transaction")).Times(1)
+
+	for i, ref := range []string{"ref-1", "ref-2"} {
+		w := httptest.NewRecorder()
+		c := newBatchRefundContext(w, merchantID, dto.BatchRefundRequest{
+			Reason: "Event cancelled",
+			Items:  []dto.BatchRefundItem{{OriginalReferenceID: ref}},
+		})
+		c.Request.Header.Set(HeaderIdempotencyKey, "batch-1")
+		h.ProcessRefundBatch(c)
+
+		if i == 0 {
+			assert.Equal(t, http.StatusOK, w.Code)
+		} else {
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), "PAY_002")
+		}
+	}
 }
 
-// --- Dashboard Handler Tests ---
+func TestProcessRefundBatch_RejectsInvalidBatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
 
-func TestGetStats_Success(t *testing.T) {
+	// The service must not be reached
+	h := NewPaymentHandler(mocks.NewMockPaymentService(ctrl), nil)
+
+	tooMany := make([]dto.BatchRefundItem, dto.MaxRefundBatchSize+1)
+	for i := range tooMany {
+		tooMany[i].OriginalReferenceID = fmt.Sprintf("ref-%d", i)
+	}
+
+	tests := map[string]dto.BatchRefundRequest{
+		"empty":     {Reason: "Event cancelled"},
+		"too large": {Reason: "Event cancelled", Items: tooMany},
+		"duplicate": {Reason: "Event cancelled", Items: []dto.BatchRefundItem{{OriginalReferenceID: "ref-1"}, {OriginalReferenceID: "ref-1"}}},
+		"no reason": {Items: []dto.BatchRefundItem{{OriginalReferenceID: "ref-1"}}},
+		"unsafe":    {Reason: "Event cancelled", Items: []dto.BatchRefundItem{{OriginalReferenceID: "ref;DROP"}}},
+	}
+	for name, req := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ProcessRefundBatch(newBatchRefundContext(w, uuid.New(), req))
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), "PAY_002")
+		})
+	}
+}
+
+func TestProcessRefund_RejectsUnsafeReference(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	mockReporting := mocks.NewMockReportingService(ctrl)
-	h := NewDashboardHandler(mockReporting)
+	// The service must not be reached
+	h := NewPaymentHandler(mocks.NewMockPaymentService(ctrl), nil)
 
-	merchantID := uuid.New()
-	mockReporting.EXPECT().GetDashboardStats(gomock.Any(), merchantID, "all").Return(&ports.TransactionStats{
-		TotalTransactions: 100,
-		Successful:        80,
-		Failed:            15,
-		Reversed:          5,
-		TotalRevenue:      5000000,
-		TotalRefunded:     200000,
-		TotalTopup:        1000000,
-	}, nil)
+	for _, ref := range []string{"ref 001", "ref;DROP"} {
+		body, _ := json.Marshal(dto.RefundRequest{
+			OriginalReferenceID: ref,
+			Reason:              "Customer request",
+		})
 
-	w := httptest.NewRecorder()
-	c, _ := gin.CreateTestContext(w)
-	c.Request = httptest.NewRequest(http.MethodGet, "/?period=all", nil)
-	c.Set("merchant_id", merchantID)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("merchant_id", uuid.New())
 
-	h.GetStats(c)
+		h.ProcessRefund(c)
 
-	assert.Equal(t, http.StatusOK, w.Code)
-	var resp map[string]interface{}
-	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, http.StatusBadRequest, w.Code, ref)
+	}
+}
+
+func TestProcessRefund_RejectsNonPositiveAmount(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// The service must not be reached
+	h := NewPaymentHandler(mocks.NewMockPaymentService(ctrl), nil)
+
+	for _, amount := range []json.Number{"0", "-500"} {
+		body, _ := json.Marshal(dto.RefundRequest{
+			OriginalReferenceID: "ref-001",
+			Amount:              &amount,
+			Reason:              "Customer request",
+		})
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("merchant_id", uuid.New())
+
+		h.ProcessRefund(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, amount)
+		assert.Contains(t, w.Body.String(), "PAY_002", amount)
+	}
+
+	amount := json.Number("0")
+	w := httptest.NewRecorder()
+	h.ProcessRefundBatch(newBatchRefundContext(w, uuid.New(), dto.BatchRefundRequest{
+		Reason: "Event cancelled",
+		Items:  []dto.BatchRefundItem{{OriginalReferenceID: "ref-1", Amount: &amount}},
+	}))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "PAY_002")
+}
+
+// --- Wallet Handler Tests ---
+
+func TestGetBalance_Success(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPayment := mocks.NewMockPaymentService(ctrl)
+	mockReporting := mocks.NewMockReportingService(ctrl)
+	h := NewWalletHandler(mockPayment, mockReporting, nil)
+
+	merchantID := uuid.New()
+	mockReporting.EXPECT().GetWalletBalance(gomock.Any(), merchantID, "").Return(decimal.NewFromInt(100000), "VND", nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Set("merchant_id", merchantID)
+
+	h.GetBalance(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	data := resp["data"].(map[string]interface{})
+	assert.Equal(t, float64(100000), data["balance"])
+	assert.Equal(t, "VND", data["currency"])
+}
+
+func TestGetBalance_DecimalIsExact(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReporting := mocks.NewMockReportingService(ctrl)
+	h := NewWalletHandler(nil, mockReporting, nil)
+
+	merchantID := uuid.New()
+	mockReporting.EXPECT().GetWalletBalance(gomock.Any(), merchantID, "").
+		Return(decimal.RequireFromString("12345678901234567890.123456789"), "BTC", nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Set("merchant_id", merchantID)
+
+	h.GetBalance(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	// A JSON number, not a string, with every digit preserved
+	assert.Contains(t, w.Body.String(), `"balance":12345678901234567890.123456789`)
+}
+
+func TestTopup_Success(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPayment := mocks.NewMockPaymentService(ctrl)
+	mockReporting := mocks.NewMockReportingService(ctrl)
+	h := NewWalletHandler(mockPayment, mockReporting, nil)
+
+	merchantID := uuid.New()
+	txID := uuid.New()
+	now := time.Now()
+
+	mockPayment.EXPECT().ProcessTopup(gomock.Any(), ports.TopupRequest{
+		MerchantID: merchantID,
+		Amount:     500000,
+		Currency:   "VND",
+	}).Return(&domain.Transaction{
+		ID:              txID,
+		MerchantID:      merchantID,
+		Amount:          500000,
+		TransactionType: domain.TransactionTypeTopup,
+		Status:          domain.TransactionStatusSuccess,
+		CreatedAt:       now,
+	}, nil)
+
+	body, _ := json.Marshal(dto.TopupRequest{
+		Amount:   "500000",
+		Currency: "VND",
+	})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("merchant_id", merchantID)
+
+	h.Topup(c)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestTopup_WithReferenceID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPayment := mocks.NewMockPaymentService(ctrl)
+	h := NewWalletHandler(mockPayment, nil, nil)
+
+	merchantID := uuid.New()
+	ref := "BANK-TRF-001"
+	original := &domain.Transaction{
+		ID:              uuid.New(),
+		ReferenceID:     "TOPUP-" + ref,
+		MerchantID:      merchantID,
+		Amount:          500000,
+		TransactionType: domain.TransactionTypeTopup,
+		Status:          domain.TransactionStatusSuccess,
+		CreatedAt:       time.Now(),
+	}
+
+	// The service dedupes on the reference, so a retry yields the same transaction.
+	mockPayment.EXPECT().ProcessTopup(gomock.Any(), ports.TopupRequest{
+		MerchantID:  merchantID,
+		Amount:      500000,
+		Currency:    "VND",
+		ReferenceID: &ref,
+	}).Return(original, nil).Times(2)
+
+	body, _ := json.Marshal(dto.TopupRequest{
+		Amount:      "500000",
+		Currency:    "VND",
+		ReferenceID: &ref,
+	})
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("merchant_id", merchantID)
+
+		h.Topup(c)
+
+		require.Equal(t, http.StatusCreated, w.Code)
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		ids = append(ids, resp["data"].(map[string]interface{})["id"].(string))
+	}
+	assert.Equal(t, ids[0], ids[1])
+}
+
+func TestTopup_DecimalAmount(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPayment := mocks.NewMockPaymentService(ctrl)
+	h := NewWalletHandler(mockPayment, nil, nil)
+
+	merchantID := uuid.New()
+	mockPayment.EXPECT().ProcessTopup(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, req ports.TopupRequest) (*domain.Transaction, error) {
+			assert.Equal(t, int64(0), req.Amount)
+			require.NotNil(t, req.AmountDecimal)
+			assert.Equal(t, "0.00000001", req.AmountDecimal.String())
+			return &domain.Transaction{
+				ID: uuid.New(), MerchantID: merchantID, Amount: req.Amount, AmountDecimal: req.AmountDecimal,
+				TransactionType: domain.TransactionTypeTopup, Status: domain.TransactionStatusSuccess,
+				Currency: "BTC", CreatedAt: time.Now(),
+			}, nil
+		})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"amount":0.00000001,"currency":"BTC"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("merchant_id", merchantID)
+
+	h.Topup(c)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"amount":0.00000001`)
+}
+
+func TestTopup_InvalidReferenceID(t *testing.T) {
+	h := NewWalletHandler(nil, nil, nil)
+
+	body := []byte(`{"amount":500000,"currency":"VND","reference_id":"bad ref!"}`)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("merchant_id", uuid.New())
+
+	h.Topup(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestPreviewBalance_Success(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReporting := mocks.NewMockReportingService(ctrl)
+	h := NewWalletHandler(nil, mockReporting, nil)
+
+	merchantID := uuid.New()
+	mockReporting.EXPECT().PreviewBalance(gomock.Any(), merchantID, "VND", []int64{-30000, 50000}).
+		Return(&ports.BalancePreview{
+			Currency:  "VND",
+			Balance:   decimal.NewFromInt(100000),
+			Steps:     []decimal.Decimal{decimal.NewFromInt(70000), decimal.NewFromInt(120000)},
+			Projected: decimal.NewFromInt(120000),
+		}, nil)
+
+	body := []byte(`{"currency":"VND","deltas":[-30000,50000]}`)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("merchant_id", merchantID)
+
+	h.PreviewBalance(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"steps":[70000,120000]`)
+	assert.Contains(t, w.Body.String(), `"projected_balance":120000`)
+}
+
+func TestPreviewBalance_InvalidRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"invalid currency", `{"currency":"VN1","deltas":[1000]}`},
+		{"no deltas", `{"currency":"VND","deltas":[]}`},
+		{"zero delta", `{"currency":"VND","deltas":[1000,0]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The service must not be called
+			h := NewWalletHandler(nil, nil, nil)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Set("merchant_id", uuid.New())
+
+			h.PreviewBalance(c)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+}
+
+func TestPreviewBalance_NegativeProjection(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReporting := mocks.NewMockReportingService(ctrl)
+	h := NewWalletHandler(nil, mockReporting, nil)
+
+	mockReporting.EXPECT().PreviewBalance(gomock.Any(), gomock.Any(), "VND", []int64{-200000}).
+		Return(nil, apperror.ErrInsufficientFunds())
+
+	body := []byte(`{"currency":"VND","deltas":[-200000]}`)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("merchant_id", uuid.New())
+
+	h.PreviewBalance(c)
+
+	assert.Equal(t, http.StatusPaymentRequired, w.Code)
+	assert.Contains(t, w.Body.String(), "PAY_001")
+}
+
+// --- Dashboard Handler Tests ---
+
+func TestGetStats_Success(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReporting := mocks.NewMockReportingService(ctrl)
+	h := NewDashboardHandler(mockReporting)
+
+	merchantID := uuid.New()
+	mockReporting.EXPECT().GetDashboardStats(gomock.Any(), merchantID, "all").Return(&ports.TransactionStats{
+		TotalTransactions: 100,
+		Successful:        80,
+		Failed:            15,
+		Reversed:          5,
+		TotalRevenue:      decimal.RequireFromString("5000000.5"),
+		TotalRefunded:     decimal.NewFromInt(200000),
+		TotalTopup:        decimal.NewFromInt(1000000),
+	}, nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/?period=all", nil)
+	c.Set("merchant_id", merchantID)
+
+	h.GetStats(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
 	data := resp["data"].(map[string]interface{})
 	assert.Equal(t, float64(100), data["total_transactions"])
-	assert.Equal(t, float64(5000000), data["total_revenue"])
+	assert.Equal(t, 5000000.5, data["total_revenue"])
+}
+
+func TestToTransactionResponse_UnsetProcessedAtIsOmitted(t *testing.T) {
+	// A cached transaction round-tripped through JSON comes back with a
+	// non-nil zero ProcessedAt.
+	var zero time.Time
+	raw, err := json.Marshal(domain.Transaction{ID: uuid.New(), CreatedAt: time.Now(), ProcessedAt: &zero})
+	require.NoError(t, err)
+	var cached domain.Transaction
+	require.NoError(t, json.Unmarshal(raw, &cached))
+	require.NotNil(t, cached.ProcessedAt)
+
+	for _, tx := range []*domain.Transaction{{ID: uuid.New(), CreatedAt: time.Now()}, &cached} {
+		resp := toTransactionResponse(tx)
+		assert.Nil(t, resp.ProcessedAt)
+
+		body, err := json.Marshal(resp)
+		require.NoError(t, err)
+		assert.NotContains(t, string(body), "processed_at")
+		assert.NotContains(t, string(body), "0001-01-01")
+	}
+}
+
+func TestToTransactionResponse_Currency(t *testing.T) {
+	resp := toTransactionResponse(&domain.Transaction{ID: uuid.New(), CreatedAt: time.Now(), Currency: "VND"})
+	assert.Equal(t, "VND", resp.Currency)
+
+	// Rows from before currencies were recorded omit it
+	body, err := json.Marshal(toTransactionResponse(&domain.Transaction{ID: uuid.New(), CreatedAt: time.Now()}))
+	require.NoError(t, err)
+	assert.NotContains(t, string(body), "currency")
 }
 
 func TestListTransactions_Success(t *testing.T) {
@@ -433,52 +1407,1049 @@ func TestListTransactions_Success(t *testing.T) {
 	assert.Equal(t, float64(1), data["total_pages"])
 }
 
-func TestListTransactions_ServiceError(t *testing.T) {
+func TestListTransactions_PaginationLinks(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	mockReporting := mocks.NewMockReportingService(ctrl)
 	h := NewDashboardHandler(mockReporting)
 
-	merchantID := uuid.New()
-	mockReporting.EXPECT().ListTransactions(gomock.Any(), gomock.Any()).Return(nil, int64(0), errors.New("db down"))
+	mockReporting.EXPECT().ListTransactions(gomock.Any(), gomock.Any()).Return([]domain.Transaction{}, int64(45), nil)
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
-	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
-	c.Set("merchant_id", merchantID)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/transactions?status=SUCCESS&type=PAYMENT&page=2&page_size=20", nil)
+	c.Set("merchant_id", uuid.New())
 
 	h.ListTransactions(c)
 
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Data dto.TransactionListResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.NotNil(t, resp.Data.Next)
+	require.NotNil(t, resp.Data.Prev)
+
+	for link, wantPage := range map[string]string{*resp.Data.Next: "3", *resp.Data.Prev: "1"} {
+		u, err := url.Parse(link)
+		require.NoError(t, err)
+		assert.Equal(t, "/api/v1/transactions", u.Path)
+		assert.Equal(t, "SUCCESS", u.Query().Get("status"))
+		assert.Equal(t, "PAYMENT", u.Query().Get("type"))
+		assert.Equal(t, wantPage, u.Query().Get("page"))
+		assert.Equal(t, "20", u.Query().Get("page_size"))
+	}
 }
 
-// --- Health Check Test ---
+func TestListTransactions_PaginationLinksAtEdges(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReporting := mocks.NewMockReportingService(ctrl)
+	h := NewDashboardHandler(mockReporting)
+
+	mockReporting.EXPECT().ListTransactions(gomock.Any(), gomock.Any()).Return([]domain.Transaction{}, int64(5), nil)
 
-func TestHealthCheck(t *testing.T) {
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
-	c.Request = httptest.NewRequest(http.MethodGet, "/health", nil)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/transactions", nil)
+	c.Set("merchant_id", uuid.New())
 
-	HealthCheck()(c)
+	h.ListTransactions(c)
 
-	assert.Equal(t, http.StatusOK, w.Code)
 	var resp map[string]interface{}
 	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
-	assert.Equal(t, "healthy", resp["status"])
+	data := resp["data"].(map[string]interface{})
+	// Single page: both links present as null
+	assert.Contains(t, data, "next")
+	assert.Nil(t, data["next"])
+	assert.Nil(t, data["prev"])
 }
 
-func TestSwaggerUI(t *testing.T) {
+func TestListTransactions_WithoutTotal(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReporting := mocks.NewMockReportingService(ctrl)
+	h := NewDashboardHandler(mockReporting)
+
+	// The repo returns page_size+1 rows when a next page exists
+	mockReporting.EXPECT().ListTransactions(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, params ports.TransactionListParams) ([]domain.Transaction, int64, error) {
+			assert.True(t, params.SkipTotal)
+			return make([]domain.Transaction, params.PageSize+1), 0, nil
+		})
+
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
-	c.Request = httptest.NewRequest(http.MethodGet, "/swagger", nil)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/transactions?include_total=false&page=2&page_size=2", nil)
+	c.Set("merchant_id", uuid.New())
 
-	SwaggerUI(c)
+	h.ListTransactions(c)
 
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
-	assert.Contains(t, w.Body.String(), "swagger-ui")
-	assert.Contains(t, w.Body.String(), "/swagger/spec")
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	data := resp["data"].(map[string]interface{})
+	assert.Len(t, data["items"], 2, "the lookahead row is not returned")
+	assert.Contains(t, data, "total")
+	assert.Nil(t, data["total"])
+	assert.Nil(t, data["total_pages"])
+	assert.Equal(t, true, data["has_next"])
+	assert.Contains(t, data["next"], "page=3")
+	assert.Contains(t, data["prev"], "page=1")
+}
+
+func TestListTransactions_InvalidIncludeTotal(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h := NewDashboardHandler(mocks.NewMockReportingService(ctrl))
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/transactions?include_total=maybe", nil)
+	c.Set("merchant_id", uuid.New())
+
+	h.ListTransactions(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestListTransactions_Sort(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReporting := mocks.NewMockReportingService(ctrl)
+	h := NewDashboardHandler(mockReporting)
+
+	mockReporting.EXPECT().ListTransactions(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ any, params ports.TransactionListParams) ([]domain.Transaction, int64, error) {
+			assert.Equal(t, "amount", params.SortBy)
+			assert.Equal(t, ports.SortAsc, params.SortDir)
+			return []domain.Transaction{}, int64(0), nil
+		})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/?sort_by=amount&sort_dir=asc", nil)
+	c.Set("merchant_id", uuid.New())
+
+	h.ListTransactions(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestListTransactions_InvalidSort(t *testing.T) {
+	h := NewDashboardHandler(nil)
+
+	for _, query := range []string{"sort_by=signature", "sort_by=amount&sort_dir=sideways"} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		c.Set("merchant_id", uuid.New())
+
+		h.ListTransactions(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestListTransactions_FilterByTypeAndStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReporting := mocks.NewMockReportingService(ctrl)
+	h := NewDashboardHandler(mockReporting)
+
+	mockReporting.EXPECT().ListTransactions(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ any, params ports.TransactionListParams) ([]domain.Transaction, int64, error) {
+			require.NotNil(t, params.Type)
+			require.NotNil(t, params.Status)
+			assert.Equal(t, domain.TransactionTypeRefund, *params.Type)
+			assert.Equal(t, domain.TransactionStatusReversed, *params.Status)
+			return []domain.Transaction{}, int64(0), nil
+		})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/?type=REFUND&status=REVERSED", nil)
+	c.Set("merchant_id", uuid.New())
+
+	h.ListTransactions(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestListTransactions_UnknownTypeOrStatus(t *testing.T) {
+	// The service must not be reached
+	h := NewDashboardHandler(nil)
+
+	for _, query := range []string{"type=FOO", "status=DONE", "type=payment", "type=PAYMENT&status=success"} {
+		for name, serve := range map[string]gin.HandlerFunc{"list": h.ListTransactions, "export": h.ExportTransactions} {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+			c.Set("merchant_id", uuid.New())
+
+			serve(c)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, name+" "+query)
+			assert.Contains(t, w.Body.String(), "PAY_002", name+" "+query)
+		}
+	}
+}
+
+func TestGetTransaction(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReporting := mocks.NewMockReportingService(ctrl)
+	h := NewDashboardHandler(mockReporting)
+
+	merchantID := uuid.New()
+	found := &domain.Transaction{ID: uuid.New(), MerchantID: merchantID, ReferenceID: "ref-1", TransactionType: domain.TransactionTypePayment}
+	missing := uuid.New()
+	mockReporting.EXPECT().GetTransaction(gomock.Any(), merchantID, found.ID).Return(found, nil)
+	mockReporting.EXPECT().GetTransaction(gomock.Any(), merchantID, missing).Return(nil, apperror.ErrNotFound("transaction"))
+
+	for id, want := range map[string]int{found.ID.String(): http.StatusOK, missing.String(): http.StatusNotFound, "not-a-uuid": http.StatusBadRequest} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		c.Params = gin.Params{{Key: "id", Value: id}}
+		c.Set("merchant_id", merchantID)
+
+		h.GetTransaction(c)
+
+		assert.Equal(t, want, w.Code, id)
+	}
+}
+
+func TestListTransactions_ServiceError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReporting := mocks.NewMockReportingService(ctrl)
+	h := NewDashboardHandler(mockReporting)
+
+	merchantID := uuid.New()
+	mockReporting.EXPECT().ListTransactions(gomock.Any(), gomock.Any()).Return(nil, int64(0), errors.New("db down"))
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Set("merchant_id", merchantID)
+
+	h.ListTransactions(c)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+// --- Merchant Handler Tests ---
+
+func TestGetSummary_ComposesSubServices(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMerchant := mocks.NewMockMerchantManagementService(ctrl)
+	mockReporting := mocks.NewMockReportingService(ctrl)
+	mockWebhook := mocks.NewMockWebhookService(ctrl)
+	h := NewMerchantHandler(mockMerchant, mockReporting, mockWebhook)
+
+	merchantID := uuid.New()
+	txID := uuid.New()
+	lastLogin := "2026-01-02T03:04:05Z"
+	rotated := "2026-01-01T00:00:00Z"
+	httpStatus := 200
+
+	mockMerchant.EXPECT().GetProfile(gomock.Any(), merchantID).Return(&ports.MerchantProfile{
+		ID:              merchantID,
+		Status:          domain.MerchantStatusActive,
+		LastLoginAt:     &lastLogin,
+		SecretRotatedAt: &rotated,
+	}, nil)
+	mockReporting.EXPECT().ListWalletBalances(gomock.Any(), merchantID).Return([]ports.WalletBalance{
+		{Currency: "USD", Balance: decimal.RequireFromString("12.5")},
+		{Currency: "VND", Balance: decimal.NewFromInt(250000)},
+	}, nil)
+	mockReporting.EXPECT().GetDashboardStats(gomock.Any(), merchantID, "today").Return(&ports.TransactionStats{
+		TotalTransactions: 7,
+		Successful:        5,
+		Failed:            2,
+	}, nil)
+	mockWebhook.EXPECT().GetLastDelivery(gomock.Any(), merchantID).Return(&domain.WebhookDeliveryLog{
+		TransactionID: txID,
+		Status:        domain.WebhookStatusDelivered,
+		Attempt:       1,
+		HTTPStatus:    &httpStatus,
+		UpdatedAt:     time.Now(),
+	}, nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Set("merchant_id", merchantID)
+
+	h.GetSummary(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "private, max-age=30", w.Header().Get("Cache-Control"))
+
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	data := resp["data"].(map[string]interface{})
+	assert.Equal(t, "ACTIVE", data["status"])
+	assert.Equal(t, lastLogin, data["last_login_at"])
+	assert.Equal(t, rotated, data["secret_rotated_at"])
+	assert.Nil(t, data["last_key_used_at"])
+
+	balances := data["balances"].([]interface{})
+	require.Len(t, balances, 2)
+	assert.Equal(t, "USD", balances[0].(map[string]interface{})["currency"])
+	assert.Equal(t, float64(12.5), balances[0].(map[string]interface{})["balance"])
+	assert.Equal(t, float64(250000), balances[1].(map[string]interface{})["balance"])
+	assert.Equal(t, "VND", balances[1].(map[string]interface{})["currency"])
+
+	today := data["today"].(map[string]interface{})
+	assert.Equal(t, float64(7), today["total_transactions"])
+	assert.Equal(t, float64(2), today["failed"])
+
+	webhook := data["last_webhook"].(map[string]interface{})
+	assert.Equal(t, txID.String(), webhook["transaction_id"])
+	assert.Equal(t, "DELIVERED", webhook["status"])
+}
+
+func newWebhookDeliveryContext(w *httptest.ResponseRecorder, merchantID uuid.UUID, logID, query string) *gin.Context {
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/"+query, nil)
+	c.Params = gin.Params{{Key: "log_id", Value: logID}}
+	c.Set("merchant_id", merchantID)
+	return c
+}
+
+func TestGetWebhookDelivery_OwnLog(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockWebhook := mocks.NewMockWebhookService(ctrl)
+	h := NewMerchantHandler(nil, nil, mockWebhook)
+
+	merchantID := uuid.New()
+	httpStatus := 500
+	lastErr := "HTTP 500"
+	next := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	log := &domain.WebhookDeliveryLog{
+		ID:            uuid.New(),
+		TransactionID: uuid.New(),
+		MerchantID:    merchantID,
+		WebhookURL:    "https://merchant.example.com/webhook",
+		Payload:       `{"event_type":"PAYMENT_UPDATE","data":{"amount":50000}}`,
+		HTTPStatus:    &httpStatus,
+		Attempt:       3,
+		Status:        domain.WebhookStatusPending,
+		NextRetryAt:   &next,
+		LastError:     &lastErr,
+	}
+	mockWebhook.EXPECT().GetDelivery(gomock.Any(), merchantID, log.ID).Return(log, nil).Times(2)
+
+	w := httptest.NewRecorder()
+	h.GetWebhookDelivery(newWebhookDeliveryContext(w, merchantID, log.ID.String(), ""))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "private, no-store", w.Header().Get("Cache-Control"))
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, log.ID.String(), resp.Data["id"])
+	assert.Equal(t, "PENDING", resp.Data["status"])
+	assert.Equal(t, float64(3), resp.Data["attempt"])
+	assert.Equal(t, float64(500), resp.Data["http_status"])
+	assert.Equal(t, "HTTP 500", resp.Data["last_error"])
+	assert.Equal(t, "2026-01-02T03:04:05Z", resp.Data["next_retry_at"])
+	payload := resp.Data["payload"].(map[string]interface{})
+	assert.Equal(t, "PAYMENT_UPDATE", payload["event_type"])
+
+	w = httptest.NewRecorder()
+	h.GetWebhookDelivery(newWebhookDeliveryContext(w, merchantID, log.ID.String(), "?include_payload=false"))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), `"payload"`)
+}
+
+func TestGetWebhookDelivery_OtherMerchantsLogIsNotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockWebhook := mocks.NewMockWebhookService(ctrl)
+	h := NewMerchantHandler(nil, nil, mockWebhook)
+
+	merchantID := uuid.New()
+	logID := uuid.New()
+	// The service hides logs owned by other merchants
+	mockWebhook.EXPECT().GetDelivery(gomock.Any(), merchantID, logID).Return(nil, nil)
+
+	w := httptest.NewRecorder()
+	h.GetWebhookDelivery(newWebhookDeliveryContext(w, merchantID, logID.String(), ""))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	var resp response.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "PAY_004", resp.ErrorCode)
+}
+
+func TestGetWebhookDelivery_InvalidID(t *testing.T) {
+	h := NewMerchantHandler(nil, nil, nil)
+
+	w := httptest.NewRecorder()
+	h.GetWebhookDelivery(newWebhookDeliveryContext(w, uuid.New(), "not-a-uuid", ""))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestTestFireWebhook_ReturnsSigningInput(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockWebhook := mocks.NewMockWebhookService(ctrl)
+	h := NewMerchantHandler(nil, nil, mockWebhook)
+
+	merchantID := uuid.New()
+	httpStatus := 200
+	signingInput := `{"merchant_order_id":"TEST-20260101000000","status":"SUCCESS"}`
+	mockWebhook.EXPECT().TestFireWebhook(gomock.Any(), merchantID).Return(&ports.WebhookTestFireResult{
+		Delivered:    true,
+		HTTPStatus:   &httpStatus,
+		Payload:      []byte(`{"version":"2024-01","event_type":"PAYMENT_UPDATE","data":{},"signature":"abc"}`),
+		SigningInput: signingInput,
+	}, nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	c.Set("merchant_id", merchantID)
+	h.TestFireWebhook(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "private, no-store", w.Header().Get("Cache-Control"))
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, true, resp.Data["delivered"])
+	assert.Equal(t, float64(200), resp.Data["http_status"])
+	assert.Equal(t, signingInput, resp.Data["signing_input"])
+	payload := resp.Data["payload"].(map[string]interface{})
+	assert.Equal(t, "abc", payload["signature"])
+}
+
+func TestUpdateWebhookURL_OmittedURLIsLeftUnchanged(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMerchant := mocks.NewMockMerchantManagementService(ctrl)
+	h := NewMerchantHandler(mockMerchant, nil, nil)
+
+	merchantID := uuid.New()
+	// Only the delivery mode changes; the URL must not be cleared
+	mockMerchant.EXPECT().UpdateWebhookURL(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	mockMerchant.EXPECT().SetSynchronousWebhook(gomock.Any(), merchantID, true).Return(nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPut, "/", bytes.NewBufferString(`{"synchronous":true}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("merchant_id", merchantID)
+	h.UpdateWebhookURL(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestUpdateWebhookURL_EmptyURLRemovesIt(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMerchant := mocks.NewMockMerchantManagementService(ctrl)
+	h := NewMerchantHandler(mockMerchant, nil, nil)
+
+	merchantID := uuid.New()
+	mockMerchant.EXPECT().UpdateWebhookURL(gomock.Any(), merchantID, gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ uuid.UUID, url *string) error {
+			require.NotNil(t, url)
+			assert.Empty(t, *url)
+			return nil
+		})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPut, "/", bytes.NewBufferString(`{"webhook_url":""}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("merchant_id", merchantID)
+	h.UpdateWebhookURL(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestGetUsage_ReportsCountersWithoutConsuming(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mr := miniredis.RunT(t)
+	rdb := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	store := redisStore.NewRateLimitStore(rdb)
+
+	merchant := &domain.Merchant{ID: uuid.New(), AccessKey: "ak_current"}
+	mockRepo := mocks.NewMockMerchantRepository(ctrl)
+	mockRepo.EXPECT().GetByID(gomock.Any(), merchant.ID).Return(merchant, nil).Times(2)
+
+	rules := middleware.DefaultRateLimitRules()
+	h := NewUsageHandler(store, mockRepo, []UsageGroup{
+		{Name: "payments", Rule: rules["payments"], ByAccessKey: true},
+		{Name: "balance", Rule: rules["balance"]},
+	})
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		_, err := store.Allow(ctx, middleware.RateLimitKey("ak_current", "payments"), 100, time.Minute)
+		require.NoError(t, err)
+	}
+	_, err := store.Allow(ctx, middleware.RateLimitKey(merchant.ID.String(), "balance"), 120, time.Minute)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/merchants/me/usage", nil)
+		c.Set(middleware.CtxMerchantID, merchant.ID)
+		h.GetUsage(c)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp struct {
+			Data dto.UsageResponse `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.Len(t, resp.Data.Groups, 2)
+		assert.Equal(t, dto.UsageGroupResponse{
+			Group: "payments", Used: 2, Limit: 100, Remaining: 98,
+			ResetAt: resp.Data.Groups[0].ResetAt, WindowSeconds: 60,
+		}, resp.Data.Groups[0], "read %d", i)
+		assert.Equal(t, "balance", resp.Data.Groups[1].Group)
+		assert.Equal(t, int64(1), resp.Data.Groups[1].Used, "read %d", i)
+		assert.Equal(t, int64(119), resp.Data.Groups[1].Remaining)
+	}
+}
+
+func TestGetSummary_SubServiceError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMerchant := mocks.NewMockMerchantManagementService(ctrl)
+	mockReporting := mocks.NewMockReportingService(ctrl)
+	h := NewMerchantHandler(mockMerchant, mockReporting, nil)
+
+	merchantID := uuid.New()
+	mockMerchant.EXPECT().GetProfile(gomock.Any(), merchantID).Return(&ports.MerchantProfile{ID: merchantID}, nil)
+	mockReporting.EXPECT().ListWalletBalances(gomock.Any(), merchantID).Return(nil, apperror.InternalError(errors.New("db down")))
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Set("merchant_id", merchantID)
+
+	h.GetSummary(c)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestGetSummary_NoWallets(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMerchant := mocks.NewMockMerchantManagementService(ctrl)
+	mockReporting := mocks.NewMockReportingService(ctrl)
+	h := NewMerchantHandler(mockMerchant, mockReporting, nil)
+
+	merchantID := uuid.New()
+	mockMerchant.EXPECT().GetProfile(gomock.Any(), merchantID).Return(&ports.MerchantProfile{ID: merchantID}, nil)
+	mockReporting.EXPECT().ListWalletBalances(gomock.Any(), merchantID).Return([]ports.WalletBalance{}, nil)
+	mockReporting.EXPECT().GetDashboardStats(gomock.Any(), merchantID, "today").Return(&ports.TransactionStats{}, nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Set("merchant_id", merchantID)
+
+	h.GetSummary(c)
+
+	// A merchant without a primary wallet still gets its summary
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Empty(t, resp["data"].(map[string]interface{})["balances"])
+}
+
+// --- Receipt Handler Tests ---
+
+func TestGetReceipt_Success(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReceipt := mocks.NewMockReceiptService(ctrl)
+	h := NewReceiptHandler(mockReceipt)
+
+	merchantID := uuid.New()
+	txID := uuid.New()
+	mockReceipt.EXPECT().GetReceipt(gomock.Any(), merchantID, txID).Return(&ports.SignedReceipt{
+		Receipt:   ports.Receipt{TransactionID: txID.String(), Amount: "50000", Currency: "VND"},
+		Algorithm: "Ed25519",
+		Signature: "c2ln",
+	}, nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Params = gin.Params{{Key: "id", Value: txID.String()}}
+	c.Set("merchant_id", merchantID)
+
+	h.GetReceipt(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	data := resp["data"].(map[string]interface{})
+	assert.Equal(t, "Ed25519", data["algorithm"])
+	assert.Equal(t, "c2ln", data["signature"])
+	assert.Equal(t, txID.String(), data["receipt"].(map[string]interface{})["transaction_id"])
+}
+
+func TestGetReceipt_InvalidID(t *testing.T) {
+	h := NewReceiptHandler(nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Params = gin.Params{{Key: "id", Value: "not-a-uuid"}}
+	c.Set("merchant_id", uuid.New())
+
+	h.GetReceipt(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestExportTransactions_CSV(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReporting := mocks.NewMockReportingService(ctrl)
+	h := NewDashboardHandler(mockReporting)
+
+	merchantID := uuid.New()
+	txID := uuid.New()
+	mockReporting.EXPECT().ExportTransactions(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ interface{}, p ports.TransactionListParams) ([]domain.Transaction, error) {
+			require.NotNil(t, p.From)
+			require.NotNil(t, p.To)
+			return []domain.Transaction{{
+				ID:              txID,
+				ReferenceID:     "ORDER-1",
+				Amount:          1000,
+				TransactionType: domain.TransactionTypePayment,
+				Status:          domain.TransactionStatusSuccess,
+				CreatedAt:       time.Unix(1700000000, 0).UTC(),
+			}}, nil
+		})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/?from=1699990000&to=1700010000", nil)
+	c.Set("merchant_id", merchantID)
+
+	h.ExportTransactions(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/csv")
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, "id,reference_id,transaction_type,status,amount,created_at,processed_at", lines[0])
+	assert.Equal(t, txID.String()+",ORDER-1,PAYMENT,SUCCESS,1000,2023-11-14T22:13:20Z,", lines[1])
+}
+
+func TestExportTransactions_EscapesFormulaCells(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReporting := mocks.NewMockReportingService(ctrl)
+	h := NewDashboardHandler(mockReporting)
+
+	created := time.Unix(1700000000, 0).UTC()
+	mockReporting.EXPECT().ExportTransactions(gomock.Any(), gomock.Any()).Return([]domain.Transaction{
+		{ID: uuid.New(), ReferenceID: "-2+3", Amount: 1, TransactionType: domain.TransactionTypePayment, Status: domain.TransactionStatusSuccess, CreatedAt: created},
+		{ID: uuid.New(), ReferenceID: "ORDER-2", Amount: 1, TransactionType: domain.TransactionTypePayment, Status: domain.TransactionStatusSuccess, CreatedAt: created},
+	}, nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/?from=1699990000&to=1700010000", nil)
+	c.Set("merchant_id", uuid.New())
+
+	h.ExportTransactions(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	records, err := csv.NewReader(w.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, "'-2+3", records[1][1])
+	assert.Equal(t, "ORDER-2", records[2][1])
+
+	for _, cell := range []string{"=SUM(A1)", "+1", "-1", "@cmd", "\tx", "\rx"} {
+		assert.Equal(t, "'"+cell, csvSafeCell(cell), cell)
+	}
+	assert.Equal(t, "", csvSafeCell(""))
+}
+
+func TestWriteTransactionsCSV_ReportsWriteError(t *testing.T) {
+	txns := []domain.Transaction{{ID: uuid.New(), ReferenceID: "ORDER-1", Amount: 1, CreatedAt: time.Now()}}
+	err := writeTransactionsCSV(failingWriter{}, txns)
+	assert.ErrorIs(t, err, errWriteFailed)
+}
+
+var errWriteFailed = errors.New("connection reset")
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errWriteFailed }
+
+func TestExportTransactions_Rejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReporting := mocks.NewMockReportingService(ctrl)
+	h := NewDashboardHandler(mockReporting)
+
+	mockReporting.EXPECT().ExportTransactions(gomock.Any(), gomock.Any()).
+		Return(nil, apperror.Validation("both from and to are required"))
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Set("merchant_id", uuid.New())
+
+	h.ExportTransactions(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+}
+
+func TestGetWebhookEventCatalog(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockWebhook := mocks.NewMockWebhookService(ctrl)
+	mockWebhook.EXPECT().EventCatalog().Return(&ports.WebhookCatalog{
+		Events: []ports.WebhookEventInfo{{Type: "PAYMENT_UPDATE", TransactionType: "PAYMENT", Trigger: "payment settles"}},
+		Versions: []ports.WebhookVersionInfo{{
+			Version: "2025-01",
+			Fields:  []ports.WebhookFieldInfo{{Name: "amount", Type: "integer"}},
+		}},
+		DefaultVersion: "2024-01",
+		LatestVersion:  "2025-01",
+	})
+
+	r := gin.New()
+	r.GET("/webhooks/events", NewWebhookHandler(mockWebhook).GetEventCatalog)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/webhooks/events", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Data dto.WebhookCatalogResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Data.Events, 1)
+	assert.Equal(t, "PAYMENT_UPDATE", resp.Data.Events[0].Type)
+	assert.Equal(t, "integer", resp.Data.Versions[0].Fields[0].Type)
+	assert.Equal(t, "2025-01", resp.Data.LatestVersion)
+	assert.NotNil(t, resp.Data.Envelope)
+}
+
+func TestGetErrorCatalog(t *testing.T) {
+	r := gin.New()
+	r.GET("/errors", GetErrorCatalog)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/errors", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Data dto.ErrorCatalogResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	byCode := map[string]dto.ErrorCodeResponse{}
+	for _, e := range resp.Data.Errors {
+		byCode[e.ErrorCode] = e
+	}
+	require.Contains(t, byCode, "PAY_001")
+	assert.Equal(t, http.StatusPaymentRequired, byCode["PAY_001"].HTTPStatus)
+	assert.Equal(t, "Insufficient balance in wallet", byCode["PAY_001"].Message)
+	assert.Equal(t, http.StatusUnauthorized, byCode["SEC_002"].HTTPStatus)
+	assert.Equal(t, http.StatusTooManyRequests, byCode["RATE_001"].HTTPStatus)
+}
+
+// --- Health Check Test ---
+
+func TestHealthCheck(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/health", nil)
+
+	HealthCheck()(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "healthy", resp["status"])
+}
+
+func TestVersion(t *testing.T) {
+	defer func(v, c, b string) { buildinfo.Version, buildinfo.Commit, buildinfo.BuildTime = v, c, b }(
+		buildinfo.Version, buildinfo.Commit, buildinfo.BuildTime)
+	buildinfo.Version, buildinfo.Commit, buildinfo.BuildTime = "v1.4.0", "abc1234", "2026-01-02T03:04:05Z"
+
+	r := SetupRouter(RouterDeps{})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, map[string]string{
+		"version":    "v1.4.0",
+		"commit":     "abc1234",
+		"build_time": "2026-01-02T03:04:05Z",
+	}, resp)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Contains(t, w.Body.String(), `"build":{"version":"v1.4.0"`)
+}
+
+func TestSwaggerUI(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/swagger", nil)
+
+	SwaggerUI(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, w.Body.String(), "swagger-ui")
+	assert.Contains(t, w.Body.String(), "/swagger/spec")
+}
+
+func TestSwaggerUI_SecurityHeaders(t *testing.T) {
+	r := gin.New()
+	r.Use(middleware.SecurityHeaders(middleware.SecurityHeadersConfig{}))
+	r.GET("/swagger", SwaggerUI)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/swagger", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "SwaggerUIBundle")
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+
+	sum := sha256.Sum256([]byte(swaggerInitScript))
+	csp := w.Header().Get("Content-Security-Policy")
+	assert.Contains(t, csp, "'sha256-"+base64.StdEncoding.EncodeToString(sum[:])+"'")
+	assert.Contains(t, csp, "script-src https://cdn.jsdelivr.net")
+	assert.Contains(t, w.Body.String(), "<script>"+swaggerInitScript+"</script>")
+}
+
+func TestSetupRouter_SwaggerEnabled(t *testing.T) {
+	r := SetupRouter(RouterDeps{})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/swagger", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestSetupRouter_SwaggerDisabled(t *testing.T) {
+	SetSwaggerSpec([]byte("openapi: '3.0.0'"))
+	defer SetSwaggerSpec(nil)
+	r := SetupRouter(RouterDeps{Swagger: SwaggerAccess{Disabled: true}})
+
+	for _, path := range []string{"/swagger", "/swagger/spec"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+		assert.NotContains(t, w.Body.String(), "openapi", path)
+	}
+}
+
+func TestSetupRouter_SwaggerBasicAuth(t *testing.T) {
+	r := SetupRouter(RouterDeps{Swagger: SwaggerAccess{Accounts: gin.Accounts{"docs": "s3cret"}}})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/swagger", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/swagger", nil)
+	req.SetBasicAuth("docs", "s3cret")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestSetupRouter_UnknownPathReturnsJSONEnvelope(t *testing.T) {
+	r := SetupRouter(RouterDeps{})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/does-not-exist", nil))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+	var resp response.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "REQ_001", resp.ErrorCode)
+	assert.NotEmpty(t, resp.RequestID)
+	assert.NotEmpty(t, resp.Timestamp)
+}
+
+func TestSetupRouter_WrongMethodReturnsJSONEnvelope(t *testing.T) {
+	r := SetupRouter(RouterDeps{})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/v1/errors", nil))
+
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	var resp response.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "REQ_002", resp.ErrorCode)
+	assert.NotEmpty(t, resp.RequestID)
+}
+
+func newReverseRequest(txID uuid.UUID, adminKey string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/transactions/"+txID.String()+"/reverse",
+		strings.NewReader(`{"reason":"Confirmed fraud"}`))
+	req.Header.Set("Content-Type", "application/json")
+	if adminKey != "" {
+		req.Header.Set(middleware.HeaderAdminKey, adminKey)
+	}
+	return req
+}
+
+func TestReverseTransaction_RecordsReversalWithoutWebhook(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPayment := mocks.NewMockPaymentService(ctrl)
+	mockWebhook := mocks.NewMockWebhookService(ctrl)
+	// Refunds enqueue a webhook; reversals must not
+	mockWebhook.EXPECT().EnqueueWebhook(gomock.Any(), gomock.Any()).Times(0)
+	r := SetupRouter(RouterDeps{PaymentSvc: mockPayment, WebhookSvc: mockWebhook, AdminAPIKey: "admin-key"})
+
+	origID := uuid.New()
+	mockPayment.EXPECT().ReverseTransaction(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, req ports.ReversalRequest) (*domain.Transaction, error) {
+			assert.Equal(t, origID, req.TransactionID)
+			assert.Equal(t, "Confirmed fraud", req.Reason)
+			assert.Equal(t, "admin", req.InitiatedBy)
+			return &domain.Transaction{
+				ID:                    uuid.New(),
+				ReferenceID:           "REVERSAL-ORDER-1",
+				MerchantID:            uuid.New(),
+				Amount:                100000,
+				TransactionType:       domain.TransactionTypeReversal,
+				Status:                domain.TransactionStatusSuccess,
+				OriginalTransactionID: &origID,
+				CreatedAt:             time.Now(),
+			}, nil
+		})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, newReverseRequest(origID, "admin-key"))
+
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var resp struct {
+		Data dto.TransactionResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "REVERSAL", resp.Data.TransactionType)
+}
+
+func TestReverseTransaction_RecordsAdminActor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPayment := mocks.NewMockPaymentService(ctrl)
+	r := SetupRouter(RouterDeps{PaymentSvc: mockPayment, AdminAPIKey: "admin-key"})
+
+	origID := uuid.New()
+	mockPayment.EXPECT().ReverseTransaction(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, req ports.ReversalRequest) (*domain.Transaction, error) {
+			assert.Equal(t, "admin:alice@ops", req.InitiatedBy)
+			return &domain.Transaction{ID: uuid.New(), MerchantID: uuid.New(), InitiatedBy: req.InitiatedBy,
+				TransactionType: domain.TransactionTypeReversal, OriginalTransactionID: &origID}, nil
+		})
+
+	req := newReverseRequest(origID, "admin-key")
+	req.Header.Set(middleware.HeaderAdminActor, "alice@ops")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var resp struct {
+		Data dto.TransactionResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "admin:alice@ops", resp.Data.InitiatedBy)
+
+	// Too long for initiated_by
+	req = newReverseRequest(origID, "admin-key")
+	req.Header.Set(middleware.HeaderAdminActor, strings.Repeat("a", maxAdminActorLen+1))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestReverseTransaction_RequiresAdminKey(t *testing.T) {
+	r := SetupRouter(RouterDeps{AdminAPIKey: "admin-key"})
+
+	for _, key := range []string{"", "wrong-key"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, newReverseRequest(uuid.New(), key))
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code, key)
+		var resp response.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "AUTH_005", resp.ErrorCode)
+	}
+}
+
+func TestReverseTransaction_InvalidID(t *testing.T) {
+	r := SetupRouter(RouterDeps{AdminAPIKey: "admin-key"})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/transactions/not-a-uuid/reverse", strings.NewReader(`{"reason":"fraud"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(middleware.HeaderAdminKey, "admin-key")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestSetupRouter_AdminRoutesDisabledWithoutKey(t *testing.T) {
+	r := SetupRouter(RouterDeps{})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, newReverseRequest(uuid.New(), "anything"))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
 }
 
 func TestSwaggerSpec_Loaded(t *testing.T) {
@@ -1,8 +1,12 @@
 package handler
 
 import (
+"encoding/json"
+"time"
+
 "secure-payment-gateway/internal/adapter/http/dto"
 "secure-payment-gateway/internal/adapter/http/middleware"
+"secure-payment-gateway/internal/core/domain"
 "secure-payment-gateway/internal/core/ports"
 "secure-payment-gateway/pkg/apperror"
 "secure-payment-gateway/pkg/response"
@@ -13,12 +17,18 @@ import (
 
 // MerchantHandler handles merchant self-service endpoints.
 type MerchantHandler struct {
-merchantSvc ports.MerchantManagementService
+merchantSvc  ports.MerchantManagementService
+reportingSvc ports.ReportingService
+webhookSvc   ports.WebhookService // nil = last webhook omitted from summary
 }
 
 // NewMerchantHandler creates a new merchant handler.
-func NewMerchantHandler(merchantSvc ports.MerchantManagementService) *MerchantHandler {
-return &MerchantHandler{merchantSvc: merchantSvc}
+func NewMerchantHandler(merchantSvc ports.MerchantManagementService, reportingSvc ports.ReportingService, webhookSvc ports.WebhookService) *MerchantHandler {
+return &MerchantHandler{
+merchantSvc:  merchantSvc,
+reportingSvc: reportingSvc,
+webhookSvc:   webhookSvc,
+}
 }
 
 // GetProfile returns the authenticated merchant's profile.
@@ -41,11 +51,19 @@ response.OK(c, gin.H{
 "merchant_name": profile.MerchantName,
 "webhook_url":   profile.WebhookURL,
 "status":        string(profile.Status),
+"synchronous_webhook": profile.SynchronousWebhook,
+"require_idempotency_key": profile.RequireIdempotencyKey,
+"webhook_payload_mode": string(profile.WebhookPayloadMode),
+"session_expiry_seconds": profile.SessionExpirySeconds,
+"notification_preferences": profile.NotificationPreferences,
+"last_used_at":  profile.LastUsedAt,
+"secret_expires_at": profile.SecretExpiresAt,
 "created_at":    profile.CreatedAt,
 })
 }
 
-// UpdateWebhookURL updates the merchant's webhook URL.
+// UpdateWebhookURL updates the merchant's webhook URL and delivery mode.
+// Omitted fields are left unchanged; an empty webhook_url removes the URL.
 func (h *MerchantHandler) UpdateWebhookURL(c *gin.Context) {
 merchantID, ok := c.Get(middleware.CtxMerchantID)
 if !ok {
@@ -60,15 +78,76 @@ return
 }
 dto.SanitizeStruct(&req)
 
-err := h.merchantSvc.UpdateWebhookURL(c.Request.Context(), merchantID.(uuid.UUID), req.WebhookURL)
-if err != nil {
+if req.WebhookURL != nil {
+if err := h.merchantSvc.UpdateWebhookURL(c.Request.Context(), merchantID.(uuid.UUID), req.WebhookURL); err != nil {
+response.Error(c, err)
+return
+}
+}
+if req.Synchronous != nil {
+if err := h.merchantSvc.SetSynchronousWebhook(c.Request.Context(), merchantID.(uuid.UUID), *req.Synchronous); err != nil {
 response.Error(c, err)
 return
 }
+}
 
 response.OK(c, gin.H{"message": "webhook URL updated"})
 }
 
+// UpdateSettings handles PUT /api/v1/merchants/me/settings.
+// Omitted fields are left unchanged.
+func (h *MerchantHandler) UpdateSettings(c *gin.Context) {
+merchantID, ok := c.Get(middleware.CtxMerchantID)
+if !ok {
+response.Error(c, apperror.ErrInvalidToken())
+return
+}
+
+var req dto.UpdateSettingsRequest
+if err := c.ShouldBindJSON(&req); err != nil {
+response.Error(c, apperror.Validation(err.Error()))
+return
+}
+
+if req.RequireIdempotencyKey != nil {
+if err := h.merchantSvc.SetRequireIdempotencyKey(c.Request.Context(), merchantID.(uuid.UUID), *req.RequireIdempotencyKey); err != nil {
+response.Error(c, err)
+return
+}
+}
+if req.WebhookPayloadMode != nil {
+if err := h.merchantSvc.SetWebhookPayloadMode(c.Request.Context(), merchantID.(uuid.UUID), domain.WebhookPayloadMode(*req.WebhookPayloadMode)); err != nil {
+response.Error(c, err)
+return
+}
+}
+
+if req.SessionExpirySeconds != nil {
+expiry := time.Duration(*req.SessionExpirySeconds) * time.Second
+if err := h.merchantSvc.SetSessionExpiry(c.Request.Context(), merchantID.(uuid.UUID), expiry); err != nil {
+response.Error(c, err)
+return
+}
+}
+
+if req.NotificationPreferences != nil {
+prefs := domain.NotificationPreferences{
+Events: make([]domain.NotificationEvent, 0, len(req.NotificationPreferences.Events)),
+Email:  req.NotificationPreferences.Email,
+Phone:  req.NotificationPreferences.Phone,
+}
+for _, event := range req.NotificationPreferences.Events {
+prefs.Events = append(prefs.Events, domain.NotificationEvent(event))
+}
+if err := h.merchantSvc.SetNotificationPreferences(c.Request.Context(), merchantID.(uuid.UUID), prefs); err != nil {
+response.Error(c, err)
+return
+}
+}
+
+response.OK(c, gin.H{"message": "settings updated"})
+}
+
 // RotateKeys generates new access and secret keys for the merchant.
 func (h *MerchantHandler) RotateKeys(c *gin.Context) {
 merchantID, ok := c.Get(middleware.CtxMerchantID)
@@ -77,7 +156,13 @@ response.Error(c, apperror.ErrInvalidToken())
 return
 }
 
-result, err := h.merchantSvc.RotateKeys(c.Request.Context(), merchantID.(uuid.UUID))
+idempotencyKey := c.GetHeader(HeaderIdempotencyKey)
+if len(idempotencyKey) > maxIdempotencyKeyLen {
+response.Error(c, apperror.Validation("Idempotency-Key must be at most 255 characters"))
+return
+}
+
+result, err := h.merchantSvc.RotateKeys(c.Request.Context(), merchantID.(uuid.UUID), idempotencyKey)
 if err != nil {
 response.Error(c, err)
 return
@@ -88,3 +173,150 @@ response.OK(c, gin.H{
 "secret_key": result.SecretKey,
 })
 }
+
+// GetSummary handles GET /api/v1/merchants/me/summary.
+// It composes the profile, the balance of every wallet, today's stats and
+// the latest webhook delivery into a single read-only view.
+func (h *MerchantHandler) GetSummary(c *gin.Context) {
+merchantID, ok := c.Get(middleware.CtxMerchantID)
+if !ok {
+response.Error(c, apperror.ErrInvalidToken())
+return
+}
+id := merchantID.(uuid.UUID)
+ctx := c.Request.Context()
+
+profile, err := h.merchantSvc.GetProfile(ctx, id)
+if err != nil {
+response.Error(c, err)
+return
+}
+
+wallets, err := h.reportingSvc.ListWalletBalances(ctx, id)
+if err != nil {
+response.Error(c, err)
+return
+}
+balances := make([]dto.WalletBalanceResponse, 0, len(wallets))
+for _, wallet := range wallets {
+balances = append(balances, dto.WalletBalanceResponse{Balance: json.Number(wallet.Balance.String()), Currency: wallet.Currency})
+}
+
+today, err := h.reportingSvc.GetDashboardStats(ctx, id, "today")
+if err != nil {
+response.Error(c, err)
+return
+}
+
+summary := dto.MerchantSummaryResponse{
+Status:   string(profile.Status),
+Balances: balances,
+Today: dto.TodayActivityResponse{
+TotalTransactions: today.TotalTransactions,
+Successful:        today.Successful,
+Failed:            today.Failed,
+Reversed:          today.Reversed,
+},
+LastLoginAt:     profile.LastLoginAt,
+LastKeyUsedAt:   profile.LastUsedAt,
+SecretRotatedAt: profile.SecretRotatedAt,
+SecretExpiresAt: profile.SecretExpiresAt,
+}
+
+if h.webhookSvc != nil {
+last, err := h.webhookSvc.GetLastDelivery(ctx, id)
+if err != nil {
+response.Error(c, err)
+return
+}
+if last != nil {
+summary.LastWebhook = &dto.WebhookDeliveryResponse{
+TransactionID: last.TransactionID.String(),
+Status:        string(last.Status),
+Attempt:       last.Attempt,
+HTTPStatus:    last.HTTPStatus,
+UpdatedAt:     last.UpdatedAt.Format(time.RFC3339),
+LastError:     last.LastError,
+}
+}
+}
+
+// Per-merchant data: cacheable by the client only, and only briefly.
+c.Header("Cache-Control", "private, max-age=30")
+response.OK(c, summary)
+}
+
+// GetWebhookDelivery handles GET /api/v1/merchants/me/webhooks/:log_id.
+// Another merchant's log is reported as not found. ?include_payload=false
+// leaves the delivered payload out of the response.
+func (h *MerchantHandler) GetWebhookDelivery(c *gin.Context) {
+merchantID, ok := c.Get(middleware.CtxMerchantID)
+if !ok {
+response.Error(c, apperror.ErrInvalidToken())
+return
+}
+
+logID, err := uuid.Parse(c.Param("log_id"))
+if err != nil {
+response.Error(c, apperror.Validation("invalid webhook log id"))
+return
+}
+
+log, err := h.webhookSvc.GetDelivery(c.Request.Context(), merchantID.(uuid.UUID), logID)
+if err != nil {
+response.Error(c, err)
+return
+}
+if log == nil {
+response.Error(c, apperror.ErrNotFound("webhook delivery"))
+return
+}
+
+resp := dto.WebhookDeliveryDetailResponse{
+ID:            log.ID.String(),
+TransactionID: log.TransactionID.String(),
+WebhookURL:    log.WebhookURL,
+Status:        string(log.Status),
+Attempt:       log.Attempt,
+HTTPStatus:    log.HTTPStatus,
+LastError:     log.LastError,
+CreatedAt:     log.CreatedAt.Format(time.RFC3339),
+UpdatedAt:     log.UpdatedAt.Format(time.RFC3339),
+}
+if log.NextRetryAt != nil {
+next := log.NextRetryAt.Format(time.RFC3339)
+resp.NextRetryAt = &next
+}
+if c.Query("include_payload") != "false" && json.Valid([]byte(log.Payload)) {
+resp.Payload = json.RawMessage(log.Payload)
+}
+
+c.Header("Cache-Control", "private, no-store")
+response.OK(c, resp)
+}
+
+// TestFireWebhook handles POST /api/v1/merchants/me/webhook/test.
+// It sends a sample event to the merchant's webhook URL and returns the
+// outcome with the payload and the signing input, for debugging signatures.
+func (h *MerchantHandler) TestFireWebhook(c *gin.Context) {
+merchantID, ok := c.Get(middleware.CtxMerchantID)
+if !ok {
+response.Error(c, apperror.ErrInvalidToken())
+return
+}
+
+result, err := h.webhookSvc.TestFireWebhook(c.Request.Context(), merchantID.(uuid.UUID))
+if err != nil {
+response.Error(c, err)
+return
+}
+
+c.Header("Cache-Control", "private, no-store")
+response.OK(c, dto.WebhookTestFireResponse{
+Delivered:    result.Delivered,
+HTTPStatus:   result.HTTPStatus,
+Error:        result.Error,
+Payload:      json.RawMessage(result.Payload),
+SigningInput: result.SigningInput,
+})
+}
@@ -1,6 +1,15 @@
 package handler
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
 	"secure-payment-gateway/internal/adapter/http/dto"
 	"secure-payment-gateway/internal/adapter/http/middleware"
 	"secure-payment-gateway/internal/core/domain"
@@ -10,17 +19,64 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 )
 
 // PaymentHandler handles payment-related endpoints.
 type PaymentHandler struct {
 	paymentSvc ports.PaymentService
 	webhookSvc ports.WebhookService
+
+	idempotencyHeaders []string // checked in order; the first non-empty one wins
+
+	batchCache ports.IdempotencyCache // nil = batch refunds are not idempotent as a whole
+}
+
+// Headers for RFC 7240 preferences on create endpoints.
+const (
+	HeaderPrefer            = "Prefer"
+	HeaderPreferenceApplied = "Preference-Applied"
+
+	preferReturnMinimal = "return=minimal"
+)
+
+// batchIdempotencyTTL matches the payment idempotency window.
+const batchIdempotencyTTL = 24 * time.Hour
+
+// PaymentHandlerOption configures optional PaymentHandler behaviour.
+type PaymentHandlerOption func(*PaymentHandler)
+
+// WithIdempotencyHeaders sets the headers a payment's idempotency key is read
+// from, in order of precedence, for SDKs that send e.g. X-Idempotency-Key or
+// X-Request-ID. An empty list keeps the default of Idempotency-Key only.
+func WithIdempotencyHeaders(headers ...string) PaymentHandlerOption {
+	return func(h *PaymentHandler) {
+		if len(headers) > 0 {
+			h.idempotencyHeaders = headers
+		}
+	}
+}
+
+// WithBatchIdempotency makes batch refunds idempotent as a whole: a batch
+// resubmitted with the same Idempotency-Key returns the stored per-item
+// results without processing any item again.
+func WithBatchIdempotency(cache ports.IdempotencyCache) PaymentHandlerOption {
+	return func(h *PaymentHandler) {
+		h.batchCache = cache
+	}
 }
 
 // NewPaymentHandler creates a new PaymentHandler.
-func NewPaymentHandler(paymentSvc ports.PaymentService, webhookSvc ports.WebhookService) *PaymentHandler {
-	return &PaymentHandler{paymentSvc: paymentSvc, webhookSvc: webhookSvc}
+func NewPaymentHandler(paymentSvc ports.PaymentService, webhookSvc ports.WebhookService, opts ...PaymentHandlerOption) *PaymentHandler {
+	h := &PaymentHandler{
+		paymentSvc:         paymentSvc,
+		webhookSvc:         webhookSvc,
+		idempotencyHeaders: []string{HeaderIdempotencyKey},
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 // ProcessPayment handles POST /api/v1/payments.
@@ -31,6 +87,16 @@ func (h *PaymentHandler) ProcessPayment(c *gin.Context) {
 		return
 	}
 
+	key, err := h.idempotencyKey(c)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+	if key == "" && requiresIdempotencyKey(c) {
+		response.Error(c, apperror.Validation(h.idempotencyHeaders[0]+" header is required for this merchant"))
+		return
+	}
+
 	var req dto.PaymentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		response.Error(c, apperror.Validation(err.Error()))
@@ -38,25 +104,101 @@ func (h *PaymentHandler) ProcessPayment(c *gin.Context) {
 	}
 	dto.SanitizeStruct(&req)
 
+	amount, exactAmount := splitAmount(req.Amount)
 	result, err := h.paymentSvc.ProcessPayment(c.Request.Context(), ports.PaymentRequest{
-		MerchantID:  merchantID.(uuid.UUID),
-		ReferenceID: req.ReferenceID,
-		Amount:      req.Amount,
-		Currency:    req.Currency,
-		ClientIP:    c.ClientIP(),
-		ExtraData:   req.ExtraData,
+		MerchantID:    merchantID.(uuid.UUID),
+		ReferenceID:   req.ReferenceID,
+		Amount:        amount,
+		AmountDecimal: exactAmount,
+		Currency:      req.Currency,
+		ClientIP:      c.ClientIP(),
+		ExtraData:     req.ExtraData,
+		InitiatedBy:   c.GetString(middleware.CtxAccessKey),
+
+		IdempotencyKey: key,
 	})
 	if err != nil {
 		response.Error(c, err)
 		return
 	}
 
-	// Trigger async webhook notification
+	resp := toTransactionResponse(result)
+
+	// Notify the merchant; synchronous-mode merchants wait for the first attempt.
+	// A failed webhook never fails the payment.
 	if h.webhookSvc != nil {
-		_ = h.webhookSvc.EnqueueWebhook(c.Request.Context(), result)
+		dispatch, _ := h.webhookSvc.DispatchWebhook(c.Request.Context(), result)
+		if dispatch != nil && dispatch.Synchronous {
+			resp.Webhook = &dto.WebhookDispatchResponse{
+				Delivered:  dispatch.Delivered,
+				HTTPStatus: dispatch.HTTPStatus,
+				Error:      dispatch.Error,
+			}
+		}
+	}
+
+	respondCreated(c, resp)
+}
+
+// idempotencyKey returns the payment's idempotency key from the first
+// configured header that is set, or "" if none is. The key must be at most
+// maxIdempotencyKeyLen printable ASCII characters without spaces.
+func (h *PaymentHandler) idempotencyKey(c *gin.Context) (string, error) {
+	for _, header := range h.idempotencyHeaders {
+		key := c.GetHeader(header)
+		if key == "" {
+			continue
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			return "", apperror.Validation(fmt.Sprintf("%s must be at most %d characters", header, maxIdempotencyKeyLen))
+		}
+		for i := 0; i < len(key); i++ {
+			if key[i] <= ' ' || key[i] > '~' {
+				return "", apperror.Validation(header + " must contain only printable ASCII characters without spaces")
+			}
+		}
+		return key, nil
 	}
+	return "", nil
+}
 
-	response.Created(c, toTransactionResponse(result))
+// respondCreated writes a 201 for a created transaction, with a Location
+// header naming it. With Prefer: return=minimal the body carries only the
+// ID (and the synchronous webhook outcome, if any).
+func respondCreated(c *gin.Context, resp dto.TransactionResponse) {
+	c.Header("Location", "/api/v1/transactions/"+resp.ID)
+	if !prefersMinimal(c) {
+		response.Created(c, resp)
+		return
+	}
+	c.Header(HeaderPreferenceApplied, preferReturnMinimal)
+	response.Created(c, dto.TransactionCreatedResponse{ID: resp.ID, Webhook: resp.Webhook})
+}
+
+// prefersMinimal reports whether a Prefer header (RFC 7240) asks for
+// return=minimal. Other preferences in the header are ignored.
+func prefersMinimal(c *gin.Context) bool {
+	for _, header := range c.Request.Header.Values(HeaderPrefer) {
+		for _, pref := range strings.Split(header, ",") {
+			// Drop any parameters, e.g. "return=minimal; foo=bar"
+			pref, _, _ = strings.Cut(pref, ";")
+			if strings.EqualFold(strings.ReplaceAll(pref, " ", ""), preferReturnMinimal) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// requiresIdempotencyKey reports whether the authenticated merchant has opted
+// in to mandatory Idempotency-Key headers on payments.
+func requiresIdempotencyKey(c *gin.Context) bool {
+	v, ok := c.Get(middleware.CtxMerchantKey)
+	if !ok {
+		return false
+	}
+	merchant, ok := v.(*domain.Merchant)
+	return ok && merchant.RequireIdempotencyKey
 }
 
 // ProcessRefund handles POST /api/v1/payments/refund.
@@ -74,12 +216,23 @@ func (h *PaymentHandler) ProcessRefund(c *gin.Context) {
 	}
 	dto.SanitizeStruct(&req)
 
+	key, err := h.idempotencyKey(c)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	amount, exactAmount := splitRefundAmount(req.Amount)
 	result, err := h.paymentSvc.ProcessRefund(c.Request.Context(), ports.RefundRequest{
 		MerchantID:          merchantID.(uuid.UUID),
 		OriginalReferenceID: req.OriginalReferenceID,
-		Amount:              req.Amount,
+		ReferenceID:         req.ReferenceID,
+		IdempotencyKey:      key,
+		Amount:              amount,
+		AmountDecimal:       exactAmount,
 		Reason:              req.Reason,
 		ClientIP:            c.ClientIP(),
+		InitiatedBy:         c.GetString(middleware.CtxAccessKey),
 	})
 	if err != nil {
 		response.Error(c, err)
@@ -91,7 +244,157 @@ func (h *PaymentHandler) ProcessRefund(c *gin.Context) {
 		_ = h.webhookSvc.EnqueueWebhook(c.Request.Context(), result)
 	}
 
-	response.Created(c, toTransactionResponse(result))
+	respondCreated(c, toTransactionResponse(result))
+}
+
+// ProcessRefundBatch handles POST /api/v1/payments/refund/batch.
+// Items are refunded one at a time through ProcessRefund, so at most one wallet
+// row is locked at any moment and each lock is held only for its own refund.
+// A failed item does not stop the batch; its error is reported in its result.
+func (h *PaymentHandler) ProcessRefundBatch(c *gin.Context) {
+	merchantID, ok := c.Get(middleware.CtxMerchantID)
+	if !ok {
+		response.Error(c, apperror.ErrInvalidToken())
+		return
+	}
+
+	var req dto.BatchRefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, apperror.Validation(err.Error()))
+		return
+	}
+	dto.SanitizeStruct(&req)
+
+	// Refund idempotency is keyed by original reference, so a repeated item
+	// would only replay the first; reject it rather than report it twice.
+	seen := make(map[string]bool, len(req.Items))
+	for _, item := range req.Items {
+		if seen[item.OriginalReferenceID] {
+			response.Error(c, apperror.Validation("duplicate original_reference_id in batch: "+item.OriginalReferenceID))
+			return
+		}
+		seen[item.OriginalReferenceID] = true
+	}
+
+	key, err := h.idempotencyKey(c)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+	var batchKey, requestHash string
+	if key != "" && h.batchCache != nil {
+		batchKey = domain.BuildRefundBatchIdempotencyKey(merchantID.(uuid.UUID), key)
+		requestHash = batchRequestHash(req)
+		replay, err := h.replayRefundBatch(c.Request.Context(), batchKey, requestHash)
+		if err != nil {
+			response.Error(c, err)
+			return
+		}
+		if replay != nil {
+			response.OK(c, replay)
+			return
+		}
+	}
+
+	resp := dto.BatchRefundResponse{Results: make([]dto.BatchRefundItemResult, 0, len(req.Items))}
+	for _, item := range req.Items {
+		result := dto.BatchRefundItemResult{OriginalReferenceID: item.OriginalReferenceID}
+
+		amount, exactAmount := splitRefundAmount(item.Amount)
+		tx, err := h.paymentSvc.ProcessRefund(c.Request.Context(), ports.RefundRequest{
+			MerchantID:          merchantID.(uuid.UUID),
+			OriginalReferenceID: item.OriginalReferenceID,
+			Amount:              amount,
+			AmountDecimal:       exactAmount,
+			Reason:              req.Reason,
+			ClientIP:            c.ClientIP(),
+			InitiatedBy:         c.GetString(middleware.CtxAccessKey),
+		})
+		if err != nil {
+			result.ErrorCode, result.Message = batchItemError(err)
+			resp.Failed++
+		} else {
+			if h.webhookSvc != nil {
+				_ = h.webhookSvc.EnqueueWebhook(c.Request.Context(), tx)
+			}
+			txResp := toTransactionResponse(tx)
+			result.Transaction = &txResp
+			resp.Succeeded++
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	// Stored only once every item has been attempted. A batch interrupted
+	// before this point is resumed by resubmitting it: refunds are idempotent
+	// per original reference, so committed items replay instead of repeating.
+	if batchKey != "" {
+		if record, err := json.Marshal(refundBatchRecord{RequestHash: requestHash, Response: resp}); err == nil {
+			_ = h.batchCache.Set(c.Request.Context(), batchKey, record, batchIdempotencyTTL)
+		}
+	}
+
+	response.OK(c, resp)
+}
+
+// refundBatchRecord is the stored outcome of an idempotent batch refund.
+type refundBatchRecord struct {
+	RequestHash string                  `json:"request_hash"`
+	Response    dto.BatchRefundResponse `json:"response"`
+}
+
+// replayRefundBatch returns the stored response for a resubmitted batch, or
+// nil if the key is unused. If the cache is unavailable the batch is
+// processed again, which per-item refund idempotency keeps safe.
+func (h *PaymentHandler) replayRefundBatch(ctx context.Context, batchKey, requestHash string) (*dto.BatchRefundResponse, error) {
+	cached, err := h.batchCache.Get(ctx, batchKey)
+	if err != nil || cached == nil {
+		return nil, nil
+	}
+
+	var record refundBatchRecord
+	if err := json.Unmarshal(cached, &record); err != nil {
+		return nil, nil
+	}
+	if record.RequestHash != requestHash {
+		return nil, apperror.Validation("idempotency key already used for a different batch")
+	}
+	return &record.Response, nil
+}
+
+// batchRequestHash fingerprints a batch so a reused key with a different
+// body is rejected instead of replaying unrelated results.
+func batchRequestHash(req dto.BatchRefundRequest) string {
+	b, _ := json.Marshal(req)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// batchItemError maps an item error the same way response.Error maps a
+// request error, so internal details never reach the client.
+func batchItemError(err error) (code, message string) {
+	var appErr *apperror.AppError
+	if errors.As(err, &appErr) {
+		return appErr.Code, appErr.Message
+	}
+	internal := apperror.InternalError(err)
+	return internal.Code, internal.Message
+}
+
+// splitAmount parses a request amount, already checked by the amount
+// validator, into the Amount and AmountDecimal of a service request.
+func splitAmount(n json.Number) (int64, *decimal.Decimal) {
+	d, _ := decimal.NewFromString(n.String())
+	return domain.SplitAmount(d)
+}
+
+// splitRefundAmount is splitAmount for an optional refund amount; nil
+// stays nil, a full refund.
+func splitRefundAmount(n *json.Number) (*int64, *decimal.Decimal) {
+	if n == nil {
+		return nil, nil
+	}
+	amount, exact := splitAmount(*n)
+	return &amount, exact
 }
 
 // toTransactionResponse converts domain.Transaction to DTO.
@@ -99,12 +402,14 @@ func toTransactionResponse(tx *domain.Transaction) dto.TransactionResponse {
 	resp := dto.TransactionResponse{
 		ID:              tx.ID.String(),
 		ReferenceID:     tx.ReferenceID,
-		Amount:          tx.Amount,
+		Amount:          json.Number(tx.ExactAmount().String()),
 		TransactionType: string(tx.TransactionType),
 		Status:          string(tx.Status),
 		CreatedAt:       tx.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		Currency:        tx.Currency,
+		InitiatedBy:     tx.InitiatedBy,
 	}
-	if tx.ProcessedAt != nil {
+	if tx.HasProcessedAt() {
 		s := tx.ProcessedAt.Format("2006-01-02T15:04:05Z07:00")
 		resp.ProcessedAt = &s
 	}
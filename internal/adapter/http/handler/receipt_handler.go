@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"secure-payment-gateway/internal/adapter/http/dto"
+	"secure-payment-gateway/internal/adapter/http/middleware"
+	"secure-payment-gateway/internal/core/ports"
+	"secure-payment-gateway/pkg/apperror"
+	"secure-payment-gateway/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ReceiptHandler handles signed transaction receipt endpoints.
+type ReceiptHandler struct {
+	receiptSvc ports.ReceiptService
+}
+
+// NewReceiptHandler creates a new ReceiptHandler.
+func NewReceiptHandler(receiptSvc ports.ReceiptService) *ReceiptHandler {
+	return &ReceiptHandler{receiptSvc: receiptSvc}
+}
+
+// GetReceipt handles GET /api/v1/transactions/:id/receipt.
+func (h *ReceiptHandler) GetReceipt(c *gin.Context) {
+	merchantID, ok := c.Get(middleware.CtxMerchantID)
+	if !ok {
+		response.Error(c, apperror.ErrInvalidToken())
+		return
+	}
+
+	txID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, apperror.Validation("invalid transaction id"))
+		return
+	}
+
+	signed, err := h.receiptSvc.GetReceipt(c.Request.Context(), merchantID.(uuid.UUID), txID)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.OK(c, dto.ReceiptResponse{
+		Receipt:   signed.Receipt,
+		Algorithm: signed.Algorithm,
+		Signature: signed.Signature,
+	})
+}
+
+// GetPublicKey handles GET /api/v1/receipts/public-key.
+func (h *ReceiptHandler) GetPublicKey(c *gin.Context) {
+	algorithm, publicKey := h.receiptSvc.PublicKey()
+	response.OK(c, dto.ReceiptPublicKeyResponse{
+		Algorithm: algorithm,
+		PublicKey: publicKey,
+	})
+}
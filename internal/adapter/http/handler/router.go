@@ -1,6 +1,10 @@
 package handler
 
 import (
+	"fmt"
+	"net/netip"
+	"strings"
+
 	"secure-payment-gateway/internal/adapter/http/middleware"
 	redisStore "secure-payment-gateway/internal/adapter/storage/redis"
 	"secure-payment-gateway/internal/core/ports"
@@ -19,23 +23,138 @@ type RouterDeps struct {
 	EncSvc         ports.EncryptionService
 	SigSvc         ports.SignatureService
 	NonceStore     ports.NonceStore
+	NonceScope     middleware.NonceScope     // "" = per-merchant
+	TimestampDrift middleware.TimestampDrift // zero fields = 60s
 	TokenSvc       ports.TokenService
-	RateLimitStore *redisStore.RateLimitStore // nil = rate limiting disabled
+	RateLimitStore *redisStore.RateLimitStore   // nil (with no RateLimitLocal) = rate limiting disabled
+	RateLimitLocal *middleware.LocalRateLimiter // per-instance limits when the store fails; nil = fail open
 	HealthCheckers []ports.HealthChecker
 	MerchantSvc    ports.MerchantManagementService // nil = merchant management disabled
 	AuditSvc       ports.AuditService              // nil = audit logging disabled
+	ReceiptSvc     ports.ReceiptService            // nil = signed receipts disabled
+	Security       middleware.SecurityHeadersConfig
+	JSONLimits     middleware.JSONLimitsConfig    // zero values = middleware defaults
+	FailedBodyLog  middleware.FailedBodyLogConfig // Enabled false = 4xx bodies not logged
+	MaxInFlight    int                            // concurrent request cap (503 beyond it); 0 = unlimited
+	Swagger        SwaggerAccess
 	Logger         zerolog.Logger
+
+	// Headers HMAC credentials are read from; zero fields = X-Merchant-Access-Key etc.
+	SignatureHeaders middleware.SignatureHeaders
+
+	// Headers a payment's idempotency key is read from, in precedence
+	// order; empty = Idempotency-Key only
+	IdempotencyHeaders []string
+
+	// Stores batch refund results by Idempotency-Key; nil = each item is
+	// still idempotent, but a resubmitted batch re-runs its failed items
+	BatchIdempotency ports.IdempotencyCache
+
+	// Key operators send in X-Admin-Key; empty = /api/v1/admin not registered
+	AdminAPIKey string
+
+	// API secret max age for HMAC routes; zero MaxAge = secrets never expire
+	SecretExpiry middleware.SecretExpiry
+
+	// Dashboard refresh tokens delivered in a cookie; nil = login returns
+	// only the access token and /api/v1/auth/refresh is not registered
+	RefreshCookie *RefreshCookie
+
+	// Proxies whose X-Forwarded-For and X-Forwarded-Proto headers are
+	// believed; empty = none, so the TCP peer is the client
+	TrustedProxies []netip.Prefix
+
+	// Per-route request/response body size histograms, served at
+	// /api/v1/admin/metrics/body-sizes; nil = sizes not recorded
+	BodySizes *middleware.BodySizeMetrics
+}
+
+// maxRequestBodyBytes is the request body limit enforced by MaxBodySize.
+const maxRequestBodyBytes = 1 << 20 // 1 MB
+
+// merchantUsageGroups lists the rate-limit groups merchants are counted in,
+// in the order /merchants/me/usage reports them. ByAccessKey must match the
+// auth of the routes above: HMAC routes count per access key, JWT routes per
+// merchant ID. Public auth groups are per client IP and are not reported.
+func merchantUsageGroups(rules map[string]middleware.RateLimitRule) []UsageGroup {
+	groups := []UsageGroup{
+		{Name: "payments", ByAccessKey: true},
+		{Name: "payments_refund", ByAccessKey: true},
+		{Name: "payments_refund_batch", ByAccessKey: true},
+		{Name: "balance"},
+		{Name: "wallets_topup"},
+		{Name: "dashboard"},
+		{Name: "dashboard_stats"},
+		{Name: "transactions_list"},
+		{Name: "transactions_export"},
+	}
+	for i := range groups {
+		groups[i].Rule = rules[groups[i].Name]
+	}
+	return groups
+}
+
+// SwaggerAccess controls whether and how the API docs are served.
+type SwaggerAccess struct {
+	Disabled bool         // true = /swagger routes are not registered (404)
+	Accounts gin.Accounts // non-empty = HTTP basic auth required
+}
+
+// ParseTrustedProxies parses proxy IP addresses and CIDR ranges for
+// RouterDeps.TrustedProxies.
+func ParseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if strings.Contains(proxy, "/") {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("trusted proxy %q: %w", proxy, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", proxy, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
 }
 
 // SetupRouter initialises the Gin engine with all routes and middleware.
 func SetupRouter(deps RouterDeps) *gin.Engine {
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
+	r.HandleMethodNotAllowed = true
+	// gin trusts every peer's X-Forwarded-For by default, which would let
+	// clients pick the IP they are rate limited and audited under
+	trusted := make([]string, len(deps.TrustedProxies))
+	for i, proxy := range deps.TrustedProxies {
+		trusted[i] = proxy.String()
+	}
+	_ = r.SetTrustedProxies(trusted) // valid prefixes always parse
+	r.NoRoute(NoRoute)
+	r.NoMethod(NoMethod)
 
 	// Global middleware
+	r.Use(middleware.RequestID())
 	r.Use(middleware.Recovery(deps.Logger))
+	r.Use(middleware.SecurityHeaders(deps.Security))
 	r.Use(middleware.RequestLogger(deps.Logger))
-	r.Use(middleware.MaxBodySize(1 << 20)) // 1 MB request body limit
+	r.Use(middleware.MaxInFlight(deps.MaxInFlight, "/health"))
+	r.Use(middleware.BodySizes(deps.BodySizes, maxRequestBodyBytes, deps.Logger))
+	r.Use(middleware.MaxBodySize(maxRequestBodyBytes))
+	// Credentials are never logged, whatever the redaction would catch
+	deps.FailedBodyLog.SkipPrefixes = append([]string{"/api/v1/auth"}, deps.FailedBodyLog.SkipPrefixes...)
+	r.Use(middleware.FailedBodyLog(deps.FailedBodyLog, deps.Logger))
+	r.Use(middleware.JSONLimits(deps.JSONLimits))
+	r.Use(middleware.RequireJSON())
 
 	// Audit logging (after response)
 	if deps.AuditSvc != nil {
@@ -44,10 +163,14 @@ func SetupRouter(deps RouterDeps) *gin.Engine {
 
 	// Health check (deep — verifies PostgreSQL + Redis)
 	r.GET("/health", HealthCheck(deps.HealthCheckers...))
+	r.GET("/version", Version)
 
 	// Swagger documentation
-	swagger := r.Group("/swagger")
-	{
+	if !deps.Swagger.Disabled {
+		swagger := r.Group("/swagger")
+		if len(deps.Swagger.Accounts) > 0 {
+			swagger.Use(gin.BasicAuthForRealm(deps.Swagger.Accounts, "API Docs"))
+		}
 		swagger.GET("", SwaggerUI)
 		swagger.GET("/spec", SwaggerSpec)
 	}
@@ -55,36 +178,62 @@ func SetupRouter(deps RouterDeps) *gin.Engine {
 	// Rate limit rules
 	rules := middleware.DefaultRateLimitRules()
 
-	// Helper: return rate limiter middleware if store is available, else noop.
+	// Helper: return rate limiter middleware if a limiter is available, else noop.
 	rl := func(group string) gin.HandlerFunc {
-		if deps.RateLimitStore == nil {
+		if deps.RateLimitStore == nil && deps.RateLimitLocal == nil {
 			return func(c *gin.Context) { c.Next() }
 		}
 		rule, ok := rules[group]
 		if !ok {
 			return func(c *gin.Context) { c.Next() }
 		}
-		return middleware.RateLimiter(deps.RateLimitStore, group, rule, deps.Logger)
+		opts := []middleware.RateLimiterOption{middleware.WithAccessKeyHeader(deps.SignatureHeaders.WithDefaults().AccessKey)}
+		if deps.RateLimitLocal != nil {
+			opts = append(opts, middleware.WithLocalFallback(deps.RateLimitLocal))
+		}
+		return middleware.RateLimiter(deps.RateLimitStore, group, rule, deps.Logger, opts...)
 	}
 
 	// API v1 routes
 	v1 := r.Group("/api/v1")
 
 	// --- Public routes (no auth) ---
-	authHandler := NewAuthHandler(deps.AuthSvc)
+	authOpts := []AuthHandlerOption{WithTrustedProxies(deps.TrustedProxies)}
+	if deps.RefreshCookie != nil {
+		authOpts = append(authOpts, WithRefreshCookie(*deps.RefreshCookie))
+	}
+	authHandler := NewAuthHandler(deps.AuthSvc, authOpts...)
 	auth := v1.Group("/auth")
 	{
 		auth.POST("/register", rl("auth_register"), authHandler.Register)
 		auth.POST("/login", rl("auth_login"), authHandler.Login)
+		if deps.RefreshCookie != nil {
+			// Refreshes are credential exchanges, limited like logins
+			auth.POST("/refresh", rl("auth_login"), authHandler.Refresh)
+		}
 	}
 
 	// --- HMAC-authenticated routes (merchant API) ---
-	hmacAuth := middleware.HMACAuth(deps.MerchantRepo, deps.EncSvc, deps.SigSvc, deps.NonceStore, deps.Logger)
-	paymentHandler := NewPaymentHandler(deps.PaymentSvc, deps.WebhookSvc)
+	var hmacOpts []middleware.HMACAuthOption
+	if deps.NonceScope != "" {
+		hmacOpts = append(hmacOpts, middleware.WithNonceScope(deps.NonceScope))
+	}
+	hmacOpts = append(hmacOpts, middleware.WithTimestampDrift(deps.TimestampDrift))
+	hmacOpts = append(hmacOpts, middleware.WithSecretExpiry(deps.SecretExpiry))
+	hmacOpts = append(hmacOpts, middleware.WithSignatureHeaders(deps.SignatureHeaders))
+	hmacAuth := middleware.HMACAuth(deps.MerchantRepo, deps.EncSvc, deps.SigSvc, deps.NonceStore, deps.Logger, hmacOpts...)
+	// Signing debugger: same checks and options, but reports instead of rejecting
+	auth.POST("/verify-signature", rl("auth_verify_signature"),
+		middleware.HMACVerifySignature(deps.MerchantRepo, deps.EncSvc, deps.SigSvc, deps.NonceStore, deps.Logger, hmacOpts...))
+	paymentHandler := NewPaymentHandler(deps.PaymentSvc, deps.WebhookSvc,
+		WithIdempotencyHeaders(deps.IdempotencyHeaders...),
+		WithBatchIdempotency(deps.BatchIdempotency),
+	)
 	payments := v1.Group("/payments", hmacAuth)
 	{
 		payments.POST("", rl("payments"), paymentHandler.ProcessPayment)
 		payments.POST("/refund", rl("payments_refund"), paymentHandler.ProcessRefund)
+		payments.POST("/refund/batch", rl("payments_refund_batch"), paymentHandler.ProcessRefundBatch)
 	}
 
 	// --- JWT-authenticated routes (dashboard) ---
@@ -94,29 +243,73 @@ func SetupRouter(deps RouterDeps) *gin.Engine {
 
 	wallets := v1.Group("/wallets", jwtAuth)
 	{
-		wallets.GET("/balance", rl("dashboard"), walletHandler.GetBalance)
-		wallets.POST("/topup", rl("wallets_topup"), walletHandler.Topup)
+		wallets.GET("/balance", rl("balance"), walletHandler.GetBalance)
+		wallets.POST("/preview", rl("balance"), walletHandler.PreviewBalance)
 	}
 
+	// Topups come from the dashboard and from back-office systems holding
+	// only the key pair, so the route takes either auth
+	v1.POST("/wallets/topup", middleware.HMACOrJWTAuth(deps.SignatureHeaders, hmacAuth, jwtAuth), rl("wallets_topup"), walletHandler.Topup)
+
 	dashboard := v1.Group("/dashboard", jwtAuth)
 	{
-		dashboard.GET("/stats", rl("dashboard"), dashboardHandler.GetStats)
+		dashboard.GET("/stats", rl("dashboard_stats"), dashboardHandler.GetStats)
 	}
 
 	transactions := v1.Group("/transactions", jwtAuth)
 	{
-		transactions.GET("", rl("dashboard"), dashboardHandler.ListTransactions)
+		transactions.GET("", rl("transactions_list"), dashboardHandler.ListTransactions)
+		transactions.GET("/export", rl("transactions_export"), dashboardHandler.ExportTransactions)
+		transactions.GET("/:id", rl("transactions_list"), dashboardHandler.GetTransaction)
+	}
+
+	// --- Signed receipts ---
+	if deps.ReceiptSvc != nil {
+		receiptHandler := NewReceiptHandler(deps.ReceiptSvc)
+		transactions.GET("/:id/receipt", rl("transactions_list"), receiptHandler.GetReceipt)
+		v1.GET("/receipts/public-key", receiptHandler.GetPublicKey)
+	}
+
+	// --- Webhook event catalog (public) ---
+	if deps.WebhookSvc != nil {
+		webhookHandler := NewWebhookHandler(deps.WebhookSvc)
+		v1.GET("/webhooks/events", webhookHandler.GetEventCatalog)
 	}
 
+	// --- Error code catalog (public) ---
+	v1.GET("/errors", GetErrorCatalog)
+
 	// --- Merchant management (JWT-authenticated) ---
 	if deps.MerchantSvc != nil {
-		merchantHandler := NewMerchantHandler(deps.MerchantSvc)
+		merchantHandler := NewMerchantHandler(deps.MerchantSvc, deps.ReportingSvc, deps.WebhookSvc)
 		merchants := v1.Group("/merchants/me", jwtAuth)
 		{
 			merchants.GET("", rl("dashboard"), merchantHandler.GetProfile)
+			merchants.GET("/summary", rl("dashboard"), merchantHandler.GetSummary)
 			merchants.PUT("/webhook", rl("dashboard"), merchantHandler.UpdateWebhookURL)
+			merchants.PUT("/settings", rl("dashboard"), merchantHandler.UpdateSettings)
 			merchants.POST("/rotate-keys", rl("dashboard"), merchantHandler.RotateKeys)
 		}
+		if deps.WebhookSvc != nil {
+			merchants.GET("/webhooks/:log_id", rl("dashboard"), merchantHandler.GetWebhookDelivery)
+			merchants.POST("/webhook/test", rl("dashboard"), merchantHandler.TestFireWebhook)
+		}
+		if deps.RateLimitStore != nil {
+			usageHandler := NewUsageHandler(deps.RateLimitStore, deps.MerchantRepo, merchantUsageGroups(rules))
+			merchants.GET("/usage", rl("dashboard"), usageHandler.GetUsage)
+		}
+	}
+
+	// --- Operator routes (admin key) ---
+	if deps.AdminAPIKey != "" {
+		adminHandler := NewAdminHandler(deps.PaymentSvc)
+		admin := v1.Group("/admin", middleware.AdminAuth(deps.AdminAPIKey))
+		{
+			admin.POST("/transactions/:id/reverse", adminHandler.ReverseTransaction)
+			if deps.BodySizes != nil {
+				admin.GET("/metrics/body-sizes", BodySizeMetrics(deps.BodySizes))
+			}
+		}
 	}
 
 	return r
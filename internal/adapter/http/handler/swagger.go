@@ -1,11 +1,36 @@
 package handler
 
 import (
+"crypto/sha256"
+"encoding/base64"
 "net/http"
 
 "github.com/gin-gonic/gin"
 )
 
+// swaggerCDN hosts the Swagger UI assets.
+const swaggerCDN = "https://cdn.jsdelivr.net"
+
+// swaggerInitScript is the inline bootstrap script; the CSP allows it by hash.
+const swaggerInitScript = `
+    SwaggerUIBundle({
+      url: '/swagger/spec',
+      dom_id: '#swagger-ui',
+      presets: [SwaggerUIBundle.presets.apis, SwaggerUIBundle.SwaggerUIStandalonePreset],
+      layout: 'BaseLayout'
+    });
+  `
+
+// swaggerCSP permits the CDN assets and the inline bootstrap script only.
+var swaggerCSP = func() string {
+sum := sha256.Sum256([]byte(swaggerInitScript))
+return "default-src 'none'; " +
+"script-src " + swaggerCDN + " 'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'; " +
+"style-src " + swaggerCDN + " 'unsafe-inline'; " +
+"img-src 'self' data: " + swaggerCDN + "; " +
+"connect-src 'self'; frame-ancestors 'none'"
+}()
+
 // swaggerSpec holds the OpenAPI YAML loaded at startup.
 var swaggerSpec []byte
 
@@ -30,20 +55,14 @@ html := `<!DOCTYPE html>
 <head>
   <meta charset="UTF-8">
   <title>Secure Payment Gateway - API Docs</title>
-  <link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/swagger-ui-dist@5/swagger-ui.css">
+  <link rel="stylesheet" href="` + swaggerCDN + `/npm/swagger-ui-dist@5/swagger-ui.css">
 </head>
 <body>
   <div id="swagger-ui"></div>
-  <script src="https://cdn.jsdelivr.net/npm/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
-  <script>
-    SwaggerUIBundle({
-      url: '/swagger/spec',
-      dom_id: '#swagger-ui',
-      presets: [SwaggerUIBundle.presets.apis, SwaggerUIBundle.SwaggerUIStandalonePreset],
-      layout: 'BaseLayout'
-    });
-  </script>
+  <script src="` + swaggerCDN + `/npm/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>` + swaggerInitScript + `</script>
 </body>
 </html>`
+c.Header("Content-Security-Policy", swaggerCSP)
 c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(html))
 }
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"fmt"
+
+	"secure-payment-gateway/internal/adapter/http/dto"
+	"secure-payment-gateway/internal/adapter/http/middleware"
+	redisStore "secure-payment-gateway/internal/adapter/storage/redis"
+	"secure-payment-gateway/internal/core/ports"
+	"secure-payment-gateway/pkg/apperror"
+	"secure-payment-gateway/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// UsageGroup is a rate-limit group reported by the usage endpoint.
+type UsageGroup struct {
+	Name        string
+	Rule        middleware.RateLimitRule
+	ByAccessKey bool // HMAC routes count per access key, JWT routes per merchant ID
+}
+
+// UsageHandler reports a merchant's rate-limit usage.
+type UsageHandler struct {
+	store        *redisStore.RateLimitStore
+	merchantRepo ports.MerchantRepository
+	groups       []UsageGroup
+}
+
+// NewUsageHandler creates a new UsageHandler. Groups are reported in order.
+func NewUsageHandler(store *redisStore.RateLimitStore, merchantRepo ports.MerchantRepository, groups []UsageGroup) *UsageHandler {
+	return &UsageHandler{store: store, merchantRepo: merchantRepo, groups: groups}
+}
+
+// GetUsage handles GET /api/v1/merchants/me/usage.
+// Counters are read without being consumed.
+func (h *UsageHandler) GetUsage(c *gin.Context) {
+	merchantID, ok := c.Get(middleware.CtxMerchantID)
+	if !ok {
+		response.Error(c, apperror.ErrInvalidToken())
+		return
+	}
+
+	// The JWT's access key goes stale after a rotation; HMAC counters use the current one
+	merchant, err := h.merchantRepo.GetByID(c.Request.Context(), merchantID.(uuid.UUID))
+	if err != nil {
+		response.Error(c, apperror.InternalError(err))
+		return
+	}
+	if merchant == nil {
+		response.Error(c, apperror.ErrNotFound("merchant"))
+		return
+	}
+
+	groups := make([]dto.UsageGroupResponse, 0, len(h.groups))
+	for _, g := range h.groups {
+		identifier := merchant.ID.String()
+		if g.ByAccessKey {
+			identifier = merchant.AccessKey
+		}
+		result, err := h.store.Peek(c.Request.Context(), middleware.RateLimitKey(identifier, g.Name), g.Rule.Limit, g.Rule.Window)
+		if err != nil {
+			response.Error(c, apperror.InternalError(fmt.Errorf("peek rate limit %s: %w", g.Name, err)))
+			return
+		}
+		groups = append(groups, dto.UsageGroupResponse{
+			Group:         g.Name,
+			Used:          result.Used,
+			Limit:         result.Limit,
+			Remaining:     result.Remaining,
+			ResetAt:       result.ResetAt,
+			WindowSeconds: int64(g.Rule.Window.Seconds()),
+		})
+	}
+
+	response.OK(c, dto.UsageResponse{Groups: groups})
+}
@@ -1,8 +1,11 @@
 package handler
 
 import (
+	"encoding/json"
+
 	"secure-payment-gateway/internal/adapter/http/dto"
 	"secure-payment-gateway/internal/adapter/http/middleware"
+	"secure-payment-gateway/internal/core/domain"
 	"secure-payment-gateway/internal/core/ports"
 	"secure-payment-gateway/pkg/apperror"
 	"secure-payment-gateway/pkg/response"
@@ -27,7 +30,8 @@ func NewWalletHandler(paymentSvc ports.PaymentService, reportingSvc ports.Report
 	}
 }
 
-// GetBalance handles GET /api/v1/wallets/balance.
+// GetBalance handles GET /api/v1/wallets/balance. Without a currency query
+// it returns the merchant's primary wallet.
 func (h *WalletHandler) GetBalance(c *gin.Context) {
 	merchantID, ok := c.Get(middleware.CtxMerchantID)
 	if !ok {
@@ -35,19 +39,59 @@ func (h *WalletHandler) GetBalance(c *gin.Context) {
 		return
 	}
 
-	balance, currency, err := h.reportingSvc.GetWalletBalance(c.Request.Context(), merchantID.(uuid.UUID))
+	currency := c.Query("currency")
+	if currency != "" && !domain.IsCurrencyCode(currency) {
+		response.Error(c, apperror.Validation("currency must be an ISO 4217 currency code"))
+		return
+	}
+
+	balance, currency, err := h.reportingSvc.GetWalletBalance(c.Request.Context(), merchantID.(uuid.UUID), currency)
 	if err != nil {
 		response.Error(c, err)
 		return
 	}
 
 	response.OK(c, dto.WalletBalanceResponse{
-		Balance:  balance,
+		Balance:  json.Number(balance.String()),
 		Currency: currency,
 	})
 }
 
-// Topup handles POST /api/v1/wallets/topup.
+// PreviewBalance handles POST /api/v1/wallets/preview. It is read-only:
+// the wallet is not locked and nothing is recorded.
+func (h *WalletHandler) PreviewBalance(c *gin.Context) {
+	merchantID, ok := c.Get(middleware.CtxMerchantID)
+	if !ok {
+		response.Error(c, apperror.ErrInvalidToken())
+		return
+	}
+
+	var req dto.BalancePreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, apperror.Validation(err.Error()))
+		return
+	}
+
+	preview, err := h.reportingSvc.PreviewBalance(c.Request.Context(), merchantID.(uuid.UUID), req.Currency, req.Deltas)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	steps := make([]json.Number, len(preview.Steps))
+	for i, step := range preview.Steps {
+		steps[i] = json.Number(step.String())
+	}
+	response.OK(c, dto.BalancePreviewResponse{
+		Currency:         preview.Currency,
+		Balance:          json.Number(preview.Balance.String()),
+		Steps:            steps,
+		ProjectedBalance: json.Number(preview.Projected.String()),
+	})
+}
+
+// Topup handles POST /api/v1/wallets/topup, authenticated by either a
+// dashboard JWT or an HMAC-signed request.
 func (h *WalletHandler) Topup(c *gin.Context) {
 	merchantID, ok := c.Get(middleware.CtxMerchantID)
 	if !ok {
@@ -62,10 +106,14 @@ func (h *WalletHandler) Topup(c *gin.Context) {
 	}
 	dto.SanitizeStruct(&req)
 
+	amount, exactAmount := splitAmount(req.Amount)
 	result, err := h.paymentSvc.ProcessTopup(c.Request.Context(), ports.TopupRequest{
-		MerchantID: merchantID.(uuid.UUID),
-		Amount:     req.Amount,
-		Currency:   req.Currency,
+		MerchantID:    merchantID.(uuid.UUID),
+		Amount:        amount,
+		AmountDecimal: exactAmount,
+		Currency:      req.Currency,
+		ReferenceID:   req.ReferenceID,
+		InitiatedBy:   c.GetString(middleware.CtxAccessKey),
 	})
 	if err != nil {
 		response.Error(c, err)
@@ -77,5 +125,5 @@ func (h *WalletHandler) Topup(c *gin.Context) {
 		_ = h.webhookSvc.EnqueueWebhook(c.Request.Context(), result)
 	}
 
-	response.Created(c, toTransactionResponse(result))
+	respondCreated(c, toTransactionResponse(result))
 }
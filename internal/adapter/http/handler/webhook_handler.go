@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"secure-payment-gateway/internal/adapter/http/dto"
+	"secure-payment-gateway/internal/core/ports"
+	"secure-payment-gateway/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebhookHandler handles public webhook documentation endpoints.
+type WebhookHandler struct {
+	webhookSvc ports.WebhookService
+}
+
+// NewWebhookHandler creates a new WebhookHandler.
+func NewWebhookHandler(webhookSvc ports.WebhookService) *WebhookHandler {
+	return &WebhookHandler{webhookSvc: webhookSvc}
+}
+
+// GetEventCatalog handles GET /api/v1/webhooks/events.
+func (h *WebhookHandler) GetEventCatalog(c *gin.Context) {
+	catalog := h.webhookSvc.EventCatalog()
+
+	resp := dto.WebhookCatalogResponse{
+		Events:         make([]dto.WebhookEventResponse, 0, len(catalog.Events)),
+		Envelope:       toWebhookFieldResponses(catalog.Envelope),
+		Versions:       make([]dto.WebhookVersionResponse, 0, len(catalog.Versions)),
+		DefaultVersion: catalog.DefaultVersion,
+		LatestVersion:  catalog.LatestVersion,
+	}
+	for _, ev := range catalog.Events {
+		resp.Events = append(resp.Events, dto.WebhookEventResponse{
+			Type:            ev.Type,
+			TransactionType: ev.TransactionType,
+			Trigger:         ev.Trigger,
+		})
+	}
+	for _, v := range catalog.Versions {
+		resp.Versions = append(resp.Versions, dto.WebhookVersionResponse{
+			Version:       v.Version,
+			Fields:        toWebhookFieldResponses(v.Fields),
+			MinimalFields: toWebhookFieldResponses(v.MinimalFields),
+		})
+	}
+
+	c.Header("Cache-Control", "public, max-age=3600")
+	response.OK(c, resp)
+}
+
+func toWebhookFieldResponses(fields []ports.WebhookFieldInfo) []dto.WebhookFieldResponse {
+	out := make([]dto.WebhookFieldResponse, 0, len(fields))
+	for _, f := range fields {
+		out = append(out, dto.WebhookFieldResponse{Name: f.Name, Type: f.Type, Optional: f.Optional})
+	}
+	return out
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"crypto/subtle"
+
+	"secure-payment-gateway/pkg/apperror"
+	"secure-payment-gateway/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HeaderAdminKey carries the operator key for /api/v1/admin routes.
+const HeaderAdminKey = "X-Admin-Key"
+
+// HeaderAdminActor optionally names the operator behind an admin request.
+// The admin key is shared, so this is what tells operators apart in the
+// transactions they create.
+const HeaderAdminActor = "X-Admin-Actor"
+
+// AdminAuth admits requests whose X-Admin-Key matches apiKey and rejects the
+// rest with AUTH_005. The comparison is constant-time.
+func AdminAuth(apiKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		got := c.GetHeader(HeaderAdminKey)
+		if got == "" || subtle.ConstantTimeCompare([]byte(got), []byte(apiKey)) != 1 {
+			response.Error(c, apperror.ErrInvalidAdminKey())
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 "encoding/json"
+"strings"
 "time"
 
 "secure-payment-gateway/internal/core/domain"
@@ -63,7 +64,7 @@ case path == "/api/v1/auth/login" && method == "POST":
 return domain.AuditActionLogin, "session"
 case path == "/api/v1/payments" && method == "POST":
 return domain.AuditActionPayment, "transaction"
-case path == "/api/v1/payments/refund" && method == "POST":
+case (path == "/api/v1/payments/refund" || path == "/api/v1/payments/refund/batch") && method == "POST":
 return domain.AuditActionRefund, "transaction"
 case path == "/api/v1/wallets/topup" && method == "POST":
 return domain.AuditActionTopup, "wallet"
@@ -71,6 +72,8 @@ case path == "/api/v1/merchants/me/webhook" && method == "PUT":
 return domain.AuditActionUpdateWebhook, "merchant"
 case path == "/api/v1/merchants/me/rotate-keys" && method == "POST":
 return domain.AuditActionRotateKeys, "merchant"
+case strings.HasPrefix(path, "/api/v1/admin/transactions/") && strings.HasSuffix(path, "/reverse") && method == "POST":
+return domain.AuditActionReverse, "transaction"
 }
 return "", ""
 }
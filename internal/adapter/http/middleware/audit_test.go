@@ -102,9 +102,11 @@ resource string
 {"/api/v1/auth/login", "POST", domain.AuditActionLogin, "session"},
 {"/api/v1/payments", "POST", domain.AuditActionPayment, "transaction"},
 {"/api/v1/payments/refund", "POST", domain.AuditActionRefund, "transaction"},
+{"/api/v1/payments/refund/batch", "POST", domain.AuditActionRefund, "transaction"},
 {"/api/v1/wallets/topup", "POST", domain.AuditActionTopup, "wallet"},
 {"/api/v1/merchants/me/webhook", "PUT", domain.AuditActionUpdateWebhook, "merchant"},
 {"/api/v1/merchants/me/rotate-keys", "POST", domain.AuditActionRotateKeys, "merchant"},
+{"/api/v1/admin/transactions/550e8400-e29b-41d4-a716-446655440000/reverse", "POST", domain.AuditActionReverse, "transaction"},
 {"/unknown", "POST", "", ""},
 }
 
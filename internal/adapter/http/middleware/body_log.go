@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// DefaultFailedBodyLogMaxBytes is the body prefix logged when
+// FailedBodyLogConfig.MaxBytes is zero.
+const DefaultFailedBodyLogMaxBytes = 2048
+
+// FailedBodyLogConfig controls logging of request bodies that were rejected
+// with a 4xx, for debugging merchant integrations.
+type FailedBodyLogConfig struct {
+	Enabled      bool
+	ServerMode   string   // bodies are never logged in "release", even if Enabled
+	MaxBytes     int      // body prefix kept per request; 0 = DefaultFailedBodyLogMaxBytes
+	SkipPrefixes []string // paths whose bodies are never logged, e.g. credential endpoints
+}
+
+// redactedBodyField matches a JSON member whose name suggests a credential,
+// with its value: a string (possibly cut off by truncation) or a bare token.
+var redactedBodyField = regexp.MustCompile(`(?i)("[^"]*(?:password|secret|token|api_key|card|cvv)[^"]*"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\]\s]*)`)
+
+// FailedBodyLog logs the body of write requests (POST, PUT, PATCH, DELETE)
+// that end with a 4xx status, so a malformed payload can be seen as sent.
+// Only the first MaxBytes are kept, and values of credential-like fields are
+// replaced with "[REDACTED]" before logging. The body is captured as the
+// handler reads it, so what the handler sees is unchanged.
+//
+// It is a no-op unless Enabled and outside release mode.
+func FailedBodyLog(cfg FailedBodyLogConfig, log zerolog.Logger) gin.HandlerFunc {
+	if !cfg.Enabled || cfg.ServerMode == gin.ReleaseMode {
+		return func(c *gin.Context) { c.Next() }
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = DefaultFailedBodyLogMaxBytes
+	}
+
+	return func(c *gin.Context) {
+		if !isWriteMethod(c.Request.Method) || c.Request.Body == nil || c.Request.Body == http.NoBody || skipBodyLog(c.Request.URL.Path, cfg.SkipPrefixes) {
+			c.Next()
+			return
+		}
+
+		captured := &prefixBuffer{max: cfg.MaxBytes}
+		c.Request.Body = readCloser{io.TeeReader(c.Request.Body, captured), c.Request.Body}
+		c.Next()
+
+		status := c.Writer.Status()
+		if status < http.StatusBadRequest || status >= http.StatusInternalServerError {
+			return
+		}
+		log.Warn().
+			Str("request_id", c.GetString(CtxRequestID)).
+			Str("method", c.Request.Method).
+			Str("path", c.Request.URL.Path).
+			Int("status", status).
+			Int64("body_bytes", captured.total).
+			Bool("truncated", captured.total > int64(len(captured.buf))).
+			Str("body", redactBody(captured.buf)).
+			Msg("failed request body")
+	}
+}
+
+// redactBody returns body with the values of credential-like JSON fields
+// replaced. It works on raw text, so malformed or truncated JSON is redacted
+// too.
+func redactBody(body []byte) string {
+	return redactedBodyField.ReplaceAllString(string(body), `${1}"[REDACTED]"`)
+}
+
+func isWriteMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func skipBodyLog(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// prefixBuffer keeps the first max bytes written to it and counts the rest.
+type prefixBuffer struct {
+	buf   []byte
+	max   int
+	total int64
+}
+
+func (b *prefixBuffer) Write(p []byte) (int, error) {
+	b.total += int64(len(p))
+	if room := b.max - len(b.buf); room > 0 {
+		b.buf = append(b.buf, p[:min(room, len(p))]...)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newBodyLogRouter serves a payment route that reads the body and rejects it,
+// and an auth route that does the same, logging to the returned buffer.
+func newBodyLogRouter(cfg FailedBodyLogConfig) (*gin.Engine, *bytes.Buffer) {
+	var logs bytes.Buffer
+	r := gin.New()
+	r.Use(FailedBodyLog(cfg, zerolog.New(&logs)))
+	reject := func(c *gin.Context) {
+		_, _ = io.ReadAll(c.Request.Body)
+		c.JSON(http.StatusBadRequest, gin.H{"error_code": "PAY_002"})
+	}
+	r.POST("/api/v1/payments", reject)
+	r.POST("/api/v1/auth/login", reject)
+	r.POST("/api/v1/payments/ok", func(c *gin.Context) {
+		_, _ = io.ReadAll(c.Request.Body)
+		c.Status(http.StatusCreated)
+	})
+	return r, &logs
+}
+
+func TestFailedBodyLog_LogsRedactedBodyInDebugMode(t *testing.T) {
+	r, logs := newBodyLogRouter(FailedBodyLogConfig{Enabled: true, ServerMode: gin.DebugMode, SkipPrefixes: []string{"/api/v1/auth"}})
+
+	body := `{"reference_id":"ORD-1","amount":"abc","card_number":"4111111111111111","extra_data":"{\"api_key\":\"k\"}"}`
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/payments", strings.NewReader(body)))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &entry), logs.String())
+	assert.Equal(t, "failed request body", entry["message"])
+	assert.Equal(t, float64(http.StatusBadRequest), entry["status"])
+	assert.Equal(t, false, entry["truncated"])
+	logged := entry["body"].(string)
+	assert.Contains(t, logged, `"amount":"abc"`, "the malformed field is what the merchant needs to see")
+	assert.Contains(t, logged, `"card_number":"[REDACTED]"`)
+	assert.NotContains(t, logged, "4111111111111111")
+	assert.NotContains(t, logged, `\"k\"`, "escaped nested fields are redacted too")
+}
+
+func TestFailedBodyLog_SilentOtherwise(t *testing.T) {
+	body := `{"password":"hunter2"}`
+	tests := []struct {
+		name string
+		cfg  FailedBodyLogConfig
+		path string
+	}{
+		{"release mode", FailedBodyLogConfig{Enabled: true, ServerMode: gin.ReleaseMode}, "/api/v1/payments"},
+		{"disabled", FailedBodyLogConfig{ServerMode: gin.DebugMode}, "/api/v1/payments"},
+		{"auth endpoint", FailedBodyLogConfig{Enabled: true, ServerMode: gin.DebugMode, SkipPrefixes: []string{"/api/v1/auth"}}, "/api/v1/auth/login"},
+		{"successful request", FailedBodyLogConfig{Enabled: true, ServerMode: gin.DebugMode}, "/api/v1/payments/ok"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, logs := newBodyLogRouter(tt.cfg)
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(body)))
+			assert.Empty(t, logs.String())
+		})
+	}
+}
+
+func TestFailedBodyLog_TruncatesWithoutAlteringBody(t *testing.T) {
+	var logs bytes.Buffer
+	var seen []byte
+	r := gin.New()
+	r.Use(FailedBodyLog(FailedBodyLogConfig{Enabled: true, ServerMode: gin.TestMode, MaxBytes: 32}, zerolog.New(&logs)))
+	r.PUT("/x", func(c *gin.Context) {
+		seen, _ = io.ReadAll(c.Request.Body)
+		c.Status(http.StatusUnprocessableEntity)
+	})
+
+	body := `{"secret_key":"` + strings.Repeat("s", 100) + `"}`
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/x", strings.NewReader(body)))
+	assert.Equal(t, body, string(seen))
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+	assert.Equal(t, true, entry["truncated"])
+	assert.Equal(t, float64(len(body)), entry["body_bytes"])
+	assert.Equal(t, `{"secret_key":"[REDACTED]"`, entry["body"], "a value cut off by truncation is still redacted")
+}
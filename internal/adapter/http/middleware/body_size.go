@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"io"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// BodySizeBuckets are the upper bounds, in bytes, of the body size
+// histogram buckets. Larger bodies are counted only in Count and Sum.
+var BodySizeBuckets = []int64{256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20}
+
+// bodySizeWarnRatio is the fraction of the body limit at which a request is
+// logged as approaching it.
+const bodySizeWarnRatio = 0.8
+
+// unmatchedRoute labels requests that matched no route, so arbitrary paths
+// cannot grow the metrics without bound.
+const unmatchedRoute = "unmatched"
+
+// SizeHistogram counts observed body sizes. Buckets[i] is the number of
+// observations no larger than BodySizeBuckets[i] (cumulative, as in
+// Prometheus).
+type SizeHistogram struct {
+	Count   int64
+	Sum     int64
+	Max     int64
+	Buckets []int64
+}
+
+func (h *SizeHistogram) observe(size int64) {
+	if h.Buckets == nil {
+		h.Buckets = make([]int64, len(BodySizeBuckets))
+	}
+	h.Count++
+	h.Sum += size
+	if size > h.Max {
+		h.Max = size
+	}
+	for i, bound := range BodySizeBuckets {
+		if size <= bound {
+			h.Buckets[i]++
+		}
+	}
+}
+
+// RouteBodySizes holds the request and response size histograms of one route.
+type RouteBodySizes struct {
+	Request  SizeHistogram
+	Response SizeHistogram
+}
+
+// BodySizeMetrics records request and response body sizes per route.
+// It is safe for concurrent use.
+type BodySizeMetrics struct {
+	mu     sync.Mutex
+	routes map[string]*RouteBodySizes
+}
+
+// NewBodySizeMetrics creates an empty set of body size histograms.
+func NewBodySizeMetrics() *BodySizeMetrics {
+	return &BodySizeMetrics{routes: make(map[string]*RouteBodySizes)}
+}
+
+// Observe records one request to route.
+func (m *BodySizeMetrics) Observe(route string, requestBytes, responseBytes int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sizes, ok := m.routes[route]
+	if !ok {
+		sizes = &RouteBodySizes{}
+		m.routes[route] = sizes
+	}
+	sizes.Request.observe(requestBytes)
+	sizes.Response.observe(responseBytes)
+}
+
+// Snapshot returns a copy of the histograms, keyed by "METHOD /route/:param".
+func (m *BodySizeMetrics) Snapshot() map[string]RouteBodySizes {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[string]RouteBodySizes, len(m.routes))
+	for route, sizes := range m.routes {
+		cp := *sizes
+		cp.Request.Buckets = append([]int64(nil), sizes.Request.Buckets...)
+		cp.Response.Buckets = append([]int64(nil), sizes.Response.Buckets...)
+		out[route] = cp
+	}
+	return out
+}
+
+// countingReader counts the bytes read from a request body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// BodySizes returns middleware that records request and response body sizes
+// per route in metrics (nil = not recorded) and logs a warning when a
+// request body reaches bodySizeWarnRatio of maxBytes, the MaxBodySize limit.
+// The request size is the Content-Length, or the bytes actually read when
+// the length is unknown (chunked bodies). Routes are labelled by their
+// pattern, not the raw path, to keep the label set bounded.
+func BodySizes(metrics *BodySizeMetrics, maxBytes int64, log zerolog.Logger) gin.HandlerFunc {
+	warnAt := int64(float64(maxBytes) * bodySizeWarnRatio)
+
+	return func(c *gin.Context) {
+		var body *countingReader
+		if c.Request.Body != nil {
+			body = &countingReader{ReadCloser: c.Request.Body}
+			c.Request.Body = body
+		}
+
+		c.Next()
+
+		requestBytes := c.Request.ContentLength
+		if body != nil && body.n > requestBytes {
+			requestBytes = body.n
+		}
+		if requestBytes < 0 {
+			requestBytes = 0
+		}
+		responseBytes := int64(c.Writer.Size())
+		if responseBytes < 0 {
+			responseBytes = 0 // nothing written
+		}
+
+		// The method comes from the client, so only matched routes (whose
+		// methods are the registered ones) are labelled with it
+		route := unmatchedRoute
+		if path := c.FullPath(); path != "" {
+			route = c.Request.Method + " " + path
+		}
+
+		if metrics != nil {
+			metrics.Observe(route, requestBytes, responseBytes)
+		}
+		if maxBytes > 0 && requestBytes >= warnAt {
+			log.Warn().
+				Str("route", route).
+				Int64("body_bytes", requestBytes).
+				Int64("limit_bytes", maxBytes).
+				Int("status", c.Writer.Status()).
+				Msg("request body approaching size limit")
+		}
+	}
+}
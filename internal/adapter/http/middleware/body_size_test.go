@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBodySizes_ObservesKnownSizeRequest(t *testing.T) {
+	metrics := NewBodySizeMetrics()
+	r := gin.New()
+	r.Use(BodySizes(metrics, 1<<20, zerolog.Nop()))
+	r.POST("/items/:id", func(c *gin.Context) {
+		_, _ = io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, strings.Repeat("r", 2000))
+	})
+
+	body := strings.Repeat("a", 300)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/items/42", strings.NewReader(body)))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	snapshot := metrics.Snapshot()
+	require.Contains(t, snapshot, "POST /items/:id", "labelled by route pattern, not raw path")
+	sizes := snapshot["POST /items/:id"]
+
+	assert.Equal(t, int64(1), sizes.Request.Count)
+	assert.Equal(t, int64(300), sizes.Request.Sum)
+	assert.Equal(t, int64(300), sizes.Request.Max)
+	// 300 bytes: above the 256 B bound, within 1 KB and every larger bound
+	assert.Equal(t, []int64{0, 1, 1, 1, 1, 1, 1}, sizes.Request.Buckets)
+
+	assert.Equal(t, int64(1), sizes.Response.Count)
+	assert.Equal(t, int64(2000), sizes.Response.Sum)
+	assert.Equal(t, []int64{0, 0, 1, 1, 1, 1, 1}, sizes.Response.Buckets)
+}
+
+func TestBodySizes_CountsBytesReadWithoutContentLength(t *testing.T) {
+	metrics := NewBodySizeMetrics()
+	r := gin.New()
+	r.Use(BodySizes(metrics, 1<<20, zerolog.Nop()))
+	r.POST("/upload", func(c *gin.Context) {
+		_, _ = io.ReadAll(c.Request.Body)
+		c.Status(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(strings.Repeat("a", 5000)))
+	req.ContentLength = -1 // chunked
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	sizes := metrics.Snapshot()["POST /upload"]
+	assert.Equal(t, int64(5000), sizes.Request.Sum)
+	assert.Equal(t, int64(0), sizes.Response.Sum)
+}
+
+func TestBodySizes_UnmatchedRoutesShareOneLabel(t *testing.T) {
+	metrics := NewBodySizeMetrics()
+	r := gin.New()
+	r.Use(BodySizes(metrics, 1<<20, zerolog.Nop()))
+
+	for _, path := range []string{"/a", "/b", "/c"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	// Made-up methods are client-controlled too
+	for _, method := range []string{"FOO", "BAR"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/a", nil))
+	}
+
+	snapshot := metrics.Snapshot()
+	assert.Len(t, snapshot, 1)
+	assert.Equal(t, int64(5), snapshot["unmatched"].Request.Count)
+}
+
+func TestBodySizes_LogsRequestsApproachingLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		wantLog bool
+	}{
+		{"well under limit", 50, false},
+		{"at 80% of limit", 80, true},
+		{"over limit", 150, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			r := gin.New()
+			r.Use(BodySizes(nil, 100, zerolog.New(&logs)))
+			r.POST("/payments", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader(strings.Repeat("a", tt.size)))
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			if tt.wantLog {
+				assert.Contains(t, logs.String(), "request body approaching size limit")
+				assert.Contains(t, logs.String(), `"route":"POST /payments"`)
+			} else {
+				assert.Empty(t, logs.String())
+			}
+		})
+	}
+}
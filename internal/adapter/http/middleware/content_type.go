@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+
+	"secure-payment-gateway/pkg/apperror"
+	"secure-payment-gateway/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireJSON rejects POST, PUT and PATCH requests that carry a body whose
+// Content-Type is not JSON with PAY_002, so clients get a clear message
+// instead of an opaque binding error. Requests without a body (e.g. key
+// rotation) and all other methods pass through.
+func RequireJSON() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+		default:
+			c.Next()
+			return
+		}
+		if c.Request.Body == nil || c.Request.Body == http.NoBody || c.Request.ContentLength == 0 {
+			c.Next()
+			return
+		}
+
+		if !isJSONContent(c.ContentType()) {
+			response.Error(c, apperror.Validation("Content-Type must be application/json"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
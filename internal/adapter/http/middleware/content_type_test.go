@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRequireJSONRouter() *gin.Engine {
+	r := gin.New()
+	r.Use(RequireJSON())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.POST("/write", ok)
+	r.PUT("/write", ok)
+	r.GET("/read", ok)
+	return r
+}
+
+func TestRequireJSON_RejectsNonJSONBodies(t *testing.T) {
+	r := newRequireJSONRouter()
+
+	for name, contentType := range map[string]string{
+		"missing": "",
+		"form":    "application/x-www-form-urlencoded",
+		"text":    "text/plain",
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/write", strings.NewReader(`{"amount":1}`))
+			if contentType != "" {
+				req.Header.Set("Content-Type", contentType)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), "PAY_002")
+			assert.Contains(t, w.Body.String(), "Content-Type must be application/json")
+		})
+	}
+}
+
+func TestRequireJSON_AllowsJSONAndBodylessRequests(t *testing.T) {
+	r := newRequireJSONRouter()
+
+	for _, contentType := range []string{"application/json", "application/json; charset=utf-8", "application/merge-patch+json"} {
+		req := httptest.NewRequest(http.MethodPut, "/write", strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, contentType)
+	}
+
+	// No body at all, e.g. POST /merchants/me/rotate-keys
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/write", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// GET is exempt even with a body
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/read", strings.NewReader("x")))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
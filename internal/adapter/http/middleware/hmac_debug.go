@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"secure-payment-gateway/internal/core/ports"
+	"secure-payment-gateway/pkg/apperror"
+	"secure-payment-gateway/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// SignatureReport is the check-by-check outcome of HMACVerifySignature. A
+// check that could not run (e.g. the signature when the access key is
+// unknown) is reported as false; Failures says why.
+type SignatureReport struct {
+	Valid           bool                 `json:"valid"`
+	MissingHeaders  []string             `json:"missing_headers,omitempty"`
+	TimestampOK     bool                 `json:"timestamp_ok"`
+	ServerTime      int64                `json:"server_time"`
+	AccessKeyOK     bool                 `json:"access_key_ok"`
+	NonceOK         bool                 `json:"nonce_ok"`
+	SignatureOK     bool                 `json:"signature_ok"`
+	SecretExpired   bool                 `json:"secret_expired"`
+	CanonicalString string               `json:"canonical_string,omitempty"`
+	Failures        []*apperror.AppError `json:"failures"`
+}
+
+// HMACVerifySignature is a debugging endpoint for merchants implementing
+// request signing. It runs every HMACAuth check against the request, using
+// the same options, and responds 200 with a SignatureReport instead of
+// rejecting. Unlike HMACAuth it keeps going after a failed check, never
+// spends the nonce (a signed request can be checked here and then sent for
+// real) and never records last_used_at.
+func HMACVerifySignature(
+	merchantRepo ports.MerchantRepository,
+	encSvc ports.EncryptionService,
+	sigSvc ports.SignatureService,
+	nonceStore ports.NonceStore,
+	log zerolog.Logger,
+	opts ...HMACAuthOption,
+) gin.HandlerFunc {
+	v := newHMACVerifier(merchantRepo, encSvc, sigSvc, nonceStore, log, opts...)
+
+	return func(c *gin.Context) {
+		report := SignatureReport{ServerTime: time.Now().Unix(), Failures: []*apperror.AppError{}}
+		fail := func(err *apperror.AppError) {
+			report.Failures = append(report.Failures, err)
+		}
+
+		names := v.cfg.headers
+		headers := map[string]string{}
+		for _, name := range []string{names.AccessKey, names.Signature, names.Timestamp, names.Nonce} {
+			headers[name] = c.GetHeader(name)
+			if headers[name] == "" {
+				report.MissingHeaders = append(report.MissingHeaders, name)
+			}
+		}
+		if len(report.MissingHeaders) > 0 {
+			fail(apperror.ErrInvalidAccessKey())
+		}
+
+		var timestamp int64
+		if headers[names.Timestamp] != "" {
+			timestamp, report.TimestampOK = v.checkTimestamp(headers[names.Timestamp])
+			if !report.TimestampOK {
+				fail(apperror.ErrTimestampExpired())
+			}
+		}
+		// Computable from the request alone, so shown whenever the timestamp parses
+		if timestamp != 0 && headers[names.Nonce] != "" {
+			canonical, err := v.canonicalString(c, timestamp, headers[names.Nonce])
+			if err != nil {
+				response.Error(c, err)
+				return
+			}
+			report.CanonicalString = canonical
+		}
+
+		if headers[names.AccessKey] == "" {
+			response.OK(c, report)
+			return
+		}
+		merchant, err := v.lookupMerchant(c.Request.Context(), headers[names.AccessKey])
+		if err != nil {
+			var appErr *apperror.AppError
+			if !errors.As(err, &appErr) || appErr.HTTPStatus >= http.StatusInternalServerError {
+				response.Error(c, err)
+				return
+			}
+			fail(appErr)
+			response.OK(c, report)
+			return
+		}
+		report.AccessKeyOK = true
+
+		if headers[names.Nonce] != "" {
+			seen, err := v.nonceStore.Seen(c.Request.Context(), merchant.ID.String(), v.nonceKey(c, headers[names.Nonce]))
+			if err != nil {
+				// HMACAuth lets the request through in this case too
+				log.Warn().Err(err).Msg("nonce store error, reporting nonce as unused")
+			}
+			report.NonceOK = !seen
+			if seen {
+				fail(apperror.ErrNonceUsed())
+			}
+		}
+
+		if report.CanonicalString != "" && headers[names.Signature] != "" {
+			valid, err := v.verifySignature(merchant, report.CanonicalString, headers[names.Signature])
+			if err != nil {
+				response.Error(c, err)
+				return
+			}
+			report.SignatureOK = valid
+			if !valid {
+				fail(apperror.ErrInvalidSignature())
+			}
+		}
+
+		// As in HMACAuth, the secret's age is only revealed to its holder
+		if report.SignatureOK && v.secretExpired(merchant, time.Now().UTC()) {
+			report.SecretExpired = true
+			if v.cfg.secretExpiry.Block {
+				fail(apperror.ErrSecretKeyExpired())
+			} else {
+				c.Header(HeaderSecretKeyWarning, "SEC_005")
+			}
+		}
+
+		report.Valid = len(report.Failures) == 0
+		response.OK(c, report)
+	}
+}
@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	memoryStorage "secure-payment-gateway/internal/adapter/storage/memory"
+	"secure-payment-gateway/internal/core/domain"
+	"secure-payment-gateway/internal/core/ports/mocks"
+	"secure-payment-gateway/internal/service"
+	"secure-payment-gateway/pkg/clientauth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+const verifyPath = "/api/v1/auth/verify-signature"
+
+type verifyReport struct {
+	SignatureReport
+	Failures []struct {
+		Code string `json:"error_code"`
+	} `json:"failures"`
+}
+
+func (r verifyReport) codes() []string {
+	codes := []string{}
+	for _, f := range r.Failures {
+		codes = append(codes, f.Code)
+	}
+	return codes
+}
+
+// verifyFixture serves HMACVerifySignature for a merchant with access key
+// ak_valid and secret raw_secret, over a real signer and nonce store.
+type verifyFixture struct {
+	router     *gin.Engine
+	merchant   *domain.Merchant
+	nonceStore *memoryStorage.NonceStore
+}
+
+func newVerifyFixture(t *testing.T, opts ...HMACAuthOption) *verifyFixture {
+	ctrl := gomock.NewController(t)
+	merchantRepo := mocks.NewMockMerchantRepository(ctrl)
+	encSvc := mocks.NewMockEncryptionService(ctrl)
+	nonceStore := memoryStorage.NewNonceStore(time.Minute)
+	t.Cleanup(nonceStore.Close)
+
+	merchant := &domain.Merchant{ID: uuid.New(), AccessKey: "ak_valid", SecretKeyEnc: "enc_secret", Status: domain.MerchantStatusActive}
+	merchantRepo.EXPECT().GetByAccessKey(gomock.Any(), "ak_valid").Return(merchant, nil).AnyTimes()
+	merchantRepo.EXPECT().GetByAccessKey(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	encSvc.EXPECT().Decrypt("enc_secret").Return("raw_secret", nil).AnyTimes()
+
+	router := gin.New()
+	router.POST(verifyPath, HMACVerifySignature(merchantRepo, encSvc, service.NewHMACSignatureService(), nonceStore, zerolog.Nop(), opts...))
+	return &verifyFixture{router: router, merchant: merchant, nonceStore: nonceStore}
+}
+
+// send signs the request with secret and lets tweak alter it before sending.
+func (f *verifyFixture) send(t *testing.T, secret string, ts int64, tweak func(*http.Request)) verifyReport {
+	body := []byte(`{"amount":50000}`)
+	req := httptest.NewRequest(http.MethodPost, verifyPath, bytes.NewReader(body))
+	clientauth.SetHeaders(req, "ak_valid", secret, body, ts, "nonce-debug")
+	if tweak != nil {
+		tweak(req)
+	}
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp struct {
+		Data verifyReport `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp.Data
+}
+
+func TestHMACVerifySignature_ValidDoesNotSpendNonce(t *testing.T) {
+	f := newVerifyFixture(t)
+	ts := time.Now().Unix()
+
+	report := f.send(t, "raw_secret", ts, nil)
+	assert.True(t, report.Valid)
+	assert.True(t, report.TimestampOK)
+	assert.True(t, report.AccessKeyOK)
+	assert.True(t, report.NonceOK)
+	assert.True(t, report.SignatureOK)
+	assert.Empty(t, report.codes())
+	assert.Equal(t, "POST|"+verifyPath+"|"+strconv.FormatInt(ts, 10)+`|nonce-debug|{"amount":50000}`, report.CanonicalString)
+
+	// Checking twice is fine, and the nonce is still fresh for the real request
+	assert.True(t, f.send(t, "raw_secret", ts, nil).Valid)
+	fresh, err := f.nonceStore.CheckAndSet(context.Background(), f.merchant.ID.String(), "nonce-debug", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, fresh)
+}
+
+func TestHMACVerifySignature_ReportsEachFailure(t *testing.T) {
+	now := time.Now().Unix()
+
+	t.Run("missing headers", func(t *testing.T) {
+		report := newVerifyFixture(t).send(t, "raw_secret", now, func(r *http.Request) {
+			r.Header.Del(HeaderNonce)
+		})
+		assert.Equal(t, []string{HeaderNonce}, report.MissingHeaders)
+		assert.Equal(t, []string{"SEC_001"}, report.codes())
+		assert.False(t, report.Valid)
+	})
+
+	t.Run("expired timestamp", func(t *testing.T) {
+		report := newVerifyFixture(t).send(t, "raw_secret", now-300, nil)
+		assert.False(t, report.TimestampOK)
+		assert.True(t, report.SignatureOK, "the signature itself is still checked")
+		assert.Equal(t, []string{"SEC_003"}, report.codes())
+	})
+
+	t.Run("unknown access key", func(t *testing.T) {
+		report := newVerifyFixture(t).send(t, "raw_secret", now, func(r *http.Request) {
+			r.Header.Set(HeaderAccessKey, "ak_unknown")
+		})
+		assert.False(t, report.AccessKeyOK)
+		assert.NotEmpty(t, report.CanonicalString)
+		assert.Equal(t, []string{"SEC_001"}, report.codes())
+	})
+
+	t.Run("suspended merchant", func(t *testing.T) {
+		f := newVerifyFixture(t)
+		f.merchant.Status = domain.MerchantStatusSuspended
+		report := f.send(t, "raw_secret", now, nil)
+		assert.Equal(t, []string{"AUTH_004"}, report.codes())
+	})
+
+	t.Run("nonce already used", func(t *testing.T) {
+		f := newVerifyFixture(t)
+		_, err := f.nonceStore.CheckAndSet(context.Background(), f.merchant.ID.String(), "nonce-debug", time.Minute)
+		require.NoError(t, err)
+		report := f.send(t, "raw_secret", now, nil)
+		assert.False(t, report.NonceOK)
+		assert.True(t, report.SignatureOK)
+		assert.Equal(t, []string{"SEC_004"}, report.codes())
+	})
+
+	t.Run("wrong secret", func(t *testing.T) {
+		report := newVerifyFixture(t).send(t, "other_secret", now, nil)
+		assert.True(t, report.NonceOK)
+		assert.False(t, report.SignatureOK)
+		assert.Equal(t, []string{"SEC_002"}, report.codes())
+	})
+
+	t.Run("expired secret blocked", func(t *testing.T) {
+		f := newVerifyFixture(t, WithSecretExpiry(SecretExpiry{MaxAge: time.Hour, Block: true}))
+		rotatedAt := time.Now().UTC().Add(-2 * time.Hour)
+		f.merchant.SecretRotatedAt = &rotatedAt
+		report := f.send(t, "raw_secret", now, nil)
+		assert.True(t, report.SecretExpired)
+		assert.Equal(t, []string{"SEC_005"}, report.codes())
+	})
+
+	t.Run("several at once", func(t *testing.T) {
+		report := newVerifyFixture(t).send(t, "other_secret", now-300, nil)
+		assert.Equal(t, []string{"SEC_003", "SEC_002"}, report.codes())
+	})
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"secure-payment-gateway/pkg/apperror"
+	"secure-payment-gateway/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// inFlightRetryAfter is the Retry-After value, in seconds, sent when the
+// server is at capacity.
+const inFlightRetryAfter = "1"
+
+// MaxInFlight returns middleware that allows at most limit requests to be
+// processed concurrently. Requests beyond the cap are rejected immediately
+// with 503 and Retry-After instead of queueing on the database pool.
+// Requests whose path is in exempt (e.g. /health) are never limited.
+// A limit <= 0 disables the middleware.
+func MaxInFlight(limit int, exempt ...string) gin.HandlerFunc {
+	if limit <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	skip := make(map[string]struct{}, len(exempt))
+	for _, path := range exempt {
+		skip[path] = struct{}{}
+	}
+	slots := make(chan struct{}, limit)
+
+	return func(c *gin.Context) {
+		if _, ok := skip[c.Request.URL.Path]; ok {
+			c.Next()
+			return
+		}
+
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+			c.Next()
+		default:
+			c.Header("Retry-After", inFlightRetryAfter)
+			response.Error(c, apperror.ErrServerOverloaded())
+			c.Abort()
+		}
+	}
+}
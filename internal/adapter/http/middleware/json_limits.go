@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"secure-payment-gateway/pkg/apperror"
+	"secure-payment-gateway/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Defaults for JSONLimitsConfig fields left at zero. Request bodies in this
+// API are flat objects, so both are generous.
+const (
+	DefaultJSONMaxDepth = 20
+	DefaultJSONMaxKeys  = 1000
+)
+
+// JSONLimitsConfig bounds the structure of JSON request bodies.
+type JSONLimitsConfig struct {
+	MaxDepth int // Maximum nesting of objects/arrays; 0 = DefaultJSONMaxDepth
+	MaxKeys  int // Maximum object keys across the whole body; 0 = DefaultJSONMaxKeys
+}
+
+// JSONLimits rejects JSON bodies nested deeper than MaxDepth or holding more
+// than MaxKeys object keys with PAY_002, before any handler decodes them.
+//
+// The body is scanned as a token stream, so a rejected body is never fully
+// materialised. Malformed JSON is passed through untouched for the handler's
+// binding to report. The body seen downstream is byte-for-byte the original,
+// which HMAC signature verification relies on.
+func JSONLimits(cfg JSONLimitsConfig) gin.HandlerFunc {
+	if cfg.MaxDepth <= 0 {
+		cfg.MaxDepth = DefaultJSONMaxDepth
+	}
+	if cfg.MaxKeys <= 0 {
+		cfg.MaxKeys = DefaultJSONMaxKeys
+	}
+
+	return func(c *gin.Context) {
+		if c.Request.Body == nil || c.Request.Body == http.NoBody || !isJSONContent(c.ContentType()) {
+			c.Next()
+			return
+		}
+
+		var consumed bytes.Buffer
+		err := checkJSONLimits(io.TeeReader(c.Request.Body, &consumed), cfg)
+		// Replay what the scan read, followed by anything it did not reach
+		c.Request.Body = readCloser{io.MultiReader(&consumed, c.Request.Body), c.Request.Body}
+
+		var limitErr *jsonLimitError
+		if errors.As(err, &limitErr) {
+			response.Error(c, apperror.Validation(limitErr.Error()))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// jsonLimitError reports a body that exceeds a JSONLimitsConfig bound.
+type jsonLimitError struct{ msg string }
+
+func (e *jsonLimitError) Error() string { return e.msg }
+
+// checkJSONLimits walks the token stream counting depth and object keys.
+// It returns a *jsonLimitError on a violation, another error if the stream is
+// not valid JSON, or nil.
+func checkJSONLimits(r io.Reader, cfg JSONLimitsConfig) error {
+	type frame struct {
+		object    bool
+		expectKey bool // next string token in this object is a key
+	}
+
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var stack []frame
+	keys := 0
+
+	// valueDone marks the current value complete, so an enclosing object
+	// expects a key next.
+	valueDone := func() {
+		if n := len(stack); n > 0 && stack[n-1].object {
+			stack[n-1].expectKey = true
+		}
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := tok.(type) {
+		case json.Delim:
+			switch t {
+			case '{', '[':
+				stack = append(stack, frame{object: t == '{', expectKey: true})
+				if len(stack) > cfg.MaxDepth {
+					return &jsonLimitError{fmt.Sprintf("JSON body exceeds maximum nesting depth of %d", cfg.MaxDepth)}
+				}
+			case '}', ']':
+				stack = stack[:len(stack)-1]
+				valueDone()
+			}
+		default:
+			if n := len(stack); n > 0 && stack[n-1].object && stack[n-1].expectKey {
+				keys++
+				if keys > cfg.MaxKeys {
+					return &jsonLimitError{fmt.Sprintf("JSON body exceeds maximum of %d keys", cfg.MaxKeys)}
+				}
+				stack[n-1].expectKey = false
+				continue
+			}
+			valueDone()
+		}
+	}
+}
+
+func isJSONContent(contentType string) bool {
+	return contentType == "application/json" || strings.HasSuffix(contentType, "+json")
+}
+
+// readCloser pairs a replacement reader with the original body's Close.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// serveJSONLimits posts body through JSONLimits and returns the response and
+// the body as the handler saw it.
+func serveJSONLimits(cfg JSONLimitsConfig, contentType, body string) (*httptest.ResponseRecorder, string) {
+	r := gin.New()
+	r.Use(JSONLimits(cfg))
+	var seen string
+	r.POST("/test", func(c *gin.Context) {
+		b, _ := io.ReadAll(c.Request.Body)
+		seen = string(b)
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/test", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	r.ServeHTTP(w, req)
+	return w, seen
+}
+
+func TestJSONLimits_AllowsWithinLimitsAndPreservesBody(t *testing.T) {
+	body := `{"reference_id":"ref-1","amount":50000,"meta":{"tags":["a",{"b":1}]}}`
+	w, seen := serveJSONLimits(JSONLimitsConfig{MaxDepth: 4, MaxKeys: 5}, "application/json", body)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, body, seen)
+}
+
+func TestJSONLimits_RejectsTooDeep(t *testing.T) {
+	body := strings.Repeat(`{"a":`, 5) + "1" + strings.Repeat("}", 5)
+
+	w, seen := serveJSONLimits(JSONLimitsConfig{MaxDepth: 4}, "application/json", body)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "PAY_002")
+	assert.Contains(t, w.Body.String(), "depth of 4")
+	assert.Empty(t, seen, "handler must not run")
+}
+
+func TestJSONLimits_RejectsDeepArrays(t *testing.T) {
+	body := strings.Repeat("[", DefaultJSONMaxDepth+1) + strings.Repeat("]", DefaultJSONMaxDepth+1)
+
+	w, _ := serveJSONLimits(JSONLimitsConfig{}, "application/json", body)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestJSONLimits_RejectsTooManyKeys(t *testing.T) {
+	// Keys are counted across nested objects; string values are not keys
+	body := `{"a":"x","b":{"c":"y","d":"z"}}`
+
+	w, _ := serveJSONLimits(JSONLimitsConfig{MaxKeys: 4}, "application/json", body)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w, _ = serveJSONLimits(JSONLimitsConfig{MaxKeys: 3}, "application/json", body)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "maximum of 3 keys")
+}
+
+func TestJSONLimits_IgnoresNonJSONAndMalformedBodies(t *testing.T) {
+	deep := strings.Repeat("[", 50)
+
+	w, seen := serveJSONLimits(JSONLimitsConfig{MaxDepth: 2}, "text/plain", deep)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, deep, seen)
+
+	// Syntax errors are left for the handler's binding to report
+	malformed := `{"a":1,,}`
+	w, seen = serveJSONLimits(JSONLimitsConfig{}, "application/json", malformed)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, malformed, seen)
+}
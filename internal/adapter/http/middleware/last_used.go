@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+
+	"secure-payment-gateway/internal/core/domain"
+
+	"github.com/google/uuid"
+)
+
+// lastUsedInterval is the minimum gap between two last_used_at writes for one merchant.
+const lastUsedInterval = time.Minute
+
+// lastUsedTracker throttles last_used_at writes so that a busy merchant causes
+// at most one UPDATE per interval instead of one per request. Entries are
+// swept once they expire, so the map only holds merchants seen recently.
+type lastUsedTracker struct {
+	mu        sync.Mutex
+	interval  time.Duration
+	recorded  map[uuid.UUID]time.Time
+	lastSweep time.Time
+}
+
+func newLastUsedTracker(interval time.Duration) *lastUsedTracker {
+	return &lastUsedTracker{
+		interval: interval,
+		recorded: make(map[uuid.UUID]time.Time),
+	}
+}
+
+// shouldRecord reports whether a credential use at now should be persisted.
+// The persisted value on the merchant is consulted first so that several
+// instances sharing the database also stay within the throttle window.
+func (t *lastUsedTracker) shouldRecord(m *domain.Merchant, now time.Time) bool {
+	if m.LastUsedAt != nil && now.Sub(*m.LastUsedAt) < t.interval {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sweep(now)
+	if last, ok := t.recorded[m.ID]; ok && now.Sub(last) < t.interval {
+		return false
+	}
+	t.recorded[m.ID] = now
+	return true
+}
+
+// sweep drops entries older than the interval, which no longer throttle
+// anything. It runs at most once per interval.
+func (t *lastUsedTracker) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < t.interval {
+		return
+	}
+	t.lastSweep = now
+	for id, last := range t.recorded {
+		if now.Sub(last) >= t.interval {
+			delete(t.recorded, id)
+		}
+	}
+}
@@ -2,53 +2,167 @@ package middleware
 
 import (
 	"bytes"
+	"context"
 	"io"
-	"math"
 	"net/http"
 	"strconv"
 	"time"
 
+	"secure-payment-gateway/internal/core/domain"
 	"secure-payment-gateway/internal/core/ports"
 	"secure-payment-gateway/pkg/apperror"
 	"secure-payment-gateway/pkg/response"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog"
 )
 
 const (
-	// Header names for HMAC authentication
+	// Default header names for HMAC authentication; see WithSignatureHeaders
 	HeaderAccessKey = "X-Merchant-Access-Key"
 	HeaderSignature = "X-Signature"
 	HeaderTimestamp = "X-Timestamp"
 	HeaderNonce     = "X-Nonce"
 
-	// Max timestamp drift allowed (60 seconds)
+	// Set to SEC_005 on responses to requests signed with an expired secret
+	// when SecretExpiry.Block is off
+	HeaderSecretKeyWarning = "X-Secret-Key-Warning"
+
+	// Default max timestamp drift in either direction (60 seconds)
 	maxTimestampDrift = 60 * time.Second
 
-	// Nonce TTL (120 seconds)
+	// Minimum nonce TTL (120 seconds); raised to cover wider drift windows
 	nonceTTL = 120 * time.Second
 
 	// Context keys
 	CtxMerchantID  = "merchant_id"
 	CtxAccessKey   = "access_key"
 	CtxMerchantKey = "merchant"
+	CtxRequestID   = "request_id" // read by pkg/response
+)
+
+// NonceScope sets how widely a nonce must be unique.
+type NonceScope string
+
+const (
+	// NonceScopeMerchant rejects a nonce reused anywhere by the same merchant.
+	NonceScopeMerchant NonceScope = "merchant"
+	// NonceScopeEndpoint rejects a nonce reused on the same method and path
+	// only. Cross-endpoint replays still fail because the signature covers
+	// the method and path.
+	NonceScopeEndpoint NonceScope = "endpoint"
 )
 
+// HMACAuthOption configures optional HMACAuth behaviour.
+type HMACAuthOption func(*hmacAuthConfig)
+
+type hmacAuthConfig struct {
+	nonceScope   NonceScope
+	drift        TimestampDrift
+	secretExpiry SecretExpiry
+	headers      SignatureHeaders
+}
+
+// SignatureHeaders names the request headers HMAC credentials are read
+// from. Empty fields use HeaderAccessKey, HeaderSignature, HeaderTimestamp
+// and HeaderNonce.
+type SignatureHeaders struct {
+	AccessKey string
+	Signature string
+	Timestamp string
+	Nonce     string
+}
+
+// WithDefaults returns h with each empty name set to its default.
+func (h SignatureHeaders) WithDefaults() SignatureHeaders {
+	if h.AccessKey == "" {
+		h.AccessKey = HeaderAccessKey
+	}
+	if h.Signature == "" {
+		h.Signature = HeaderSignature
+	}
+	if h.Timestamp == "" {
+		h.Timestamp = HeaderTimestamp
+	}
+	if h.Nonce == "" {
+		h.Nonce = HeaderNonce
+	}
+	return h
+}
+
+// WithSignatureHeaders reads the credentials from the given headers instead
+// of the defaults, so merchants moving from another gateway can keep their
+// header names. The signed canonical string is unchanged.
+func WithSignatureHeaders(headers SignatureHeaders) HMACAuthOption {
+	return func(cfg *hmacAuthConfig) {
+		cfg.headers = headers.WithDefaults()
+	}
+}
+
+// TimestampDrift bounds how far X-Timestamp may lie behind (Past) or ahead
+// of (Future) the server clock. Zero fields use maxTimestampDrift.
+type TimestampDrift struct {
+	Past   time.Duration
+	Future time.Duration
+}
+
+// WithNonceScope sets the nonce uniqueness scope (default NonceScopeMerchant).
+func WithNonceScope(scope NonceScope) HMACAuthOption {
+	return func(cfg *hmacAuthConfig) {
+		cfg.nonceScope = scope
+	}
+}
+
+// WithTimestampDrift sets asymmetric timestamp tolerances, e.g. a generous
+// Past for slow clients and a tight Future, since future-dated requests are
+// more suspicious.
+func WithTimestampDrift(drift TimestampDrift) HMACAuthOption {
+	return func(cfg *hmacAuthConfig) {
+		if drift.Past > 0 {
+			cfg.drift.Past = drift.Past
+		}
+		if drift.Future > 0 {
+			cfg.drift.Future = drift.Future
+		}
+	}
+}
+
+// SecretExpiry limits how long a merchant's API secret stays usable after
+// registration or its last rotation. A zero MaxAge disables expiry.
+type SecretExpiry struct {
+	MaxAge time.Duration
+	Block  bool // true = reject with SEC_005; false = allow and set HeaderSecretKeyWarning
+}
+
+// WithSecretExpiry flags or blocks requests signed with a secret older than
+// expiry.MaxAge.
+func WithSecretExpiry(expiry SecretExpiry) HMACAuthOption {
+	return func(cfg *hmacAuthConfig) {
+		cfg.secretExpiry = expiry
+	}
+}
+
 // HMACAuth creates a middleware that verifies HMAC-SHA256 signatures.
-// Pipeline: Check timestamp -> Check nonce -> Verify signature.
+// Pipeline: Check timestamp -> Check nonce -> Verify signature -> Check secret age.
+// On success the merchant's last_used_at is refreshed asynchronously,
+// at most once per lastUsedInterval.
 func HMACAuth(
 	merchantRepo ports.MerchantRepository,
 	encSvc ports.EncryptionService,
 	sigSvc ports.SignatureService,
 	nonceStore ports.NonceStore,
 	log zerolog.Logger,
+	opts ...HMACAuthOption,
 ) gin.HandlerFunc {
+	v := newHMACVerifier(merchantRepo, encSvc, sigSvc, nonceStore, log, opts...)
+	lastUsed := newLastUsedTracker(lastUsedInterval)
+
 	return func(c *gin.Context) {
-		accessKey := c.GetHeader(HeaderAccessKey)
-		signature := c.GetHeader(HeaderSignature)
-		timestampStr := c.GetHeader(HeaderTimestamp)
-		nonce := c.GetHeader(HeaderNonce)
+		accessKey := c.GetHeader(v.cfg.headers.AccessKey)
+		signature := c.GetHeader(v.cfg.headers.Signature)
+		timestampStr := c.GetHeader(v.cfg.headers.Timestamp)
+		nonce := c.GetHeader(v.cfg.headers.Nonce)
 
 		if accessKey == "" || signature == "" || timestampStr == "" || nonce == "" {
 			response.Error(c, apperror.ErrInvalidAccessKey())
@@ -57,39 +171,22 @@ func HMACAuth(
 		}
 
 		// Step 1: Timestamp check
-		timestamp, err := strconv.ParseInt(timestampStr, 10, 64)
-		if err != nil {
-			response.Error(c, apperror.ErrTimestampExpired())
-			c.Abort()
-			return
-		}
-		now := time.Now().Unix()
-		if math.Abs(float64(now-timestamp)) > maxTimestampDrift.Seconds() {
+		timestamp, ok := v.checkTimestamp(timestampStr)
+		if !ok {
 			response.Error(c, apperror.ErrTimestampExpired())
 			c.Abort()
 			return
 		}
 
 		// Step 2: Lookup merchant and check nonce
-		merchant, err := merchantRepo.GetByAccessKey(c.Request.Context(), accessKey)
+		merchant, err := v.lookupMerchant(c.Request.Context(), accessKey)
 		if err != nil {
-			log.Error().Err(err).Msg("failed to fetch merchant")
-			response.Error(c, apperror.InternalError(err))
-			c.Abort()
-			return
-		}
-		if merchant == nil {
-			response.Error(c, apperror.ErrInvalidAccessKey())
-			c.Abort()
-			return
-		}
-		if !merchant.IsActive() {
-			response.Error(c, apperror.ErrMerchantSuspended())
+			response.Error(c, err)
 			c.Abort()
 			return
 		}
 
-		isNew, err := nonceStore.CheckAndSet(c.Request.Context(), merchant.ID.String(), nonce, nonceTTL)
+		isNew, err := v.nonceStore.CheckAndSet(c.Request.Context(), merchant.ID.String(), v.nonceKey(c, nonce), v.nonceTTL)
 		if err != nil {
 			log.Warn().Err(err).Msg("nonce store error, allowing request")
 		} else if !isNew {
@@ -99,36 +196,43 @@ func HMACAuth(
 		}
 
 		// Step 3: Signature verification
-		secretKey, err := encSvc.Decrypt(merchant.SecretKeyEnc)
+		canonical, err := v.canonicalString(c, timestamp, nonce)
 		if err != nil {
-			log.Error().Err(err).Msg("failed to decrypt merchant secret key")
-			response.Error(c, apperror.InternalError(err))
+			response.Error(c, err)
 			c.Abort()
 			return
 		}
-
-		bodyBytes, err := io.ReadAll(c.Request.Body)
+		valid, err := v.verifySignature(merchant, canonical, signature)
 		if err != nil {
-			response.Error(c, apperror.Validation("cannot read request body"))
+			response.Error(c, err)
 			c.Abort()
 			return
 		}
-		c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-
-		canonical := sigSvc.BuildCanonicalString(
-			c.Request.Method,
-			c.Request.URL.Path,
-			timestamp,
-			nonce,
-			string(bodyBytes),
-		)
-
-		if !sigSvc.Verify(secretKey, canonical, signature) {
+		if !valid {
 			response.Error(c, apperror.ErrInvalidSignature())
 			c.Abort()
 			return
 		}
 
+		// Step 4: Secret age, checked only once the caller has proven the secret
+		usedAt := time.Now().UTC()
+		if v.secretExpired(merchant, usedAt) {
+			if v.cfg.secretExpiry.Block {
+				response.Error(c, apperror.ErrSecretKeyExpired())
+				c.Abort()
+				return
+			}
+			c.Header(HeaderSecretKeyWarning, "SEC_005")
+		}
+
+		if lastUsed.shouldRecord(merchant, usedAt) {
+			go func(id uuid.UUID) {
+				if err := merchantRepo.UpdateLastUsedAt(context.Background(), id, usedAt); err != nil {
+					log.Warn().Err(err).Str("merchant_id", id.String()).Msg("failed to record access key last_used_at")
+				}
+			}(merchant.ID)
+		}
+
 		c.Set(CtxMerchantID, merchant.ID)
 		c.Set(CtxAccessKey, merchant.AccessKey)
 		c.Set(CtxMerchantKey, merchant)
@@ -137,6 +241,125 @@ func HMACAuth(
 	}
 }
 
+// hmacVerifier holds the individual checks of HMACAuth so that
+// HMACVerifySignature can run the same checks and report each outcome.
+type hmacVerifier struct {
+	merchantRepo ports.MerchantRepository
+	encSvc       ports.EncryptionService
+	sigSvc       ports.SignatureService
+	nonceStore   ports.NonceStore
+	log          zerolog.Logger
+	cfg          hmacAuthConfig
+	nonceTTL     time.Duration
+}
+
+func newHMACVerifier(
+	merchantRepo ports.MerchantRepository,
+	encSvc ports.EncryptionService,
+	sigSvc ports.SignatureService,
+	nonceStore ports.NonceStore,
+	log zerolog.Logger,
+	opts ...HMACAuthOption,
+) *hmacVerifier {
+	cfg := hmacAuthConfig{
+		nonceScope: NonceScopeMerchant,
+		drift:      TimestampDrift{Past: maxTimestampDrift, Future: maxTimestampDrift},
+		headers:    SignatureHeaders{}.WithDefaults(),
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	// A nonce must outlive every timestamp that would still be accepted,
+	// otherwise a replay after the nonce expires passes both checks
+	ttl := nonceTTL
+	if window := cfg.drift.Past + cfg.drift.Future; window > ttl {
+		ttl = window
+	}
+	return &hmacVerifier{
+		merchantRepo: merchantRepo,
+		encSvc:       encSvc,
+		sigSvc:       sigSvc,
+		nonceStore:   nonceStore,
+		log:          log,
+		cfg:          cfg,
+		nonceTTL:     ttl,
+	}
+}
+
+// checkTimestamp parses X-Timestamp and reports whether it is numeric and
+// within the allowed drift of the server clock.
+func (v *hmacVerifier) checkTimestamp(raw string) (int64, bool) {
+	timestamp, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	now := time.Now()
+	if timestamp < now.Add(-v.cfg.drift.Past).Unix() || timestamp > now.Add(v.cfg.drift.Future).Unix() {
+		return timestamp, false
+	}
+	return timestamp, true
+}
+
+// lookupMerchant returns the active merchant owning accessKey, or the
+// AppError to reject the request with.
+func (v *hmacVerifier) lookupMerchant(ctx context.Context, accessKey string) (*domain.Merchant, error) {
+	merchant, err := v.merchantRepo.GetByAccessKey(ctx, accessKey)
+	if err != nil {
+		v.log.Error().Err(err).Msg("failed to fetch merchant")
+		return nil, apperror.InternalError(err)
+	}
+	if merchant == nil {
+		return nil, apperror.ErrInvalidAccessKey()
+	}
+	if !merchant.IsActive() {
+		return nil, apperror.ErrMerchantSuspended()
+	}
+	return merchant, nil
+}
+
+// nonceKey is the nonce as stored, widened to the method and path under
+// NonceScopeEndpoint.
+func (v *hmacVerifier) nonceKey(c *gin.Context, nonce string) string {
+	if v.cfg.nonceScope == NonceScopeEndpoint {
+		return c.Request.Method + ":" + c.Request.URL.Path + ":" + nonce
+	}
+	return nonce
+}
+
+// canonicalString builds the signed string of the request. The body is
+// read and put back for the next handler.
+func (v *hmacVerifier) canonicalString(c *gin.Context, timestamp int64, nonce string) (string, error) {
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return "", apperror.Validation("cannot read request body")
+	}
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+
+	return v.sigSvc.BuildCanonicalString(
+		c.Request.Method,
+		c.Request.URL.Path,
+		timestamp,
+		nonce,
+		string(bodyBytes),
+	), nil
+}
+
+// verifySignature checks signature against the merchant's decrypted secret.
+func (v *hmacVerifier) verifySignature(merchant *domain.Merchant, canonical, signature string) (bool, error) {
+	secretKey, err := v.encSvc.Decrypt(merchant.SecretKeyEnc)
+	if err != nil {
+		v.log.Error().Err(err).Msg("failed to decrypt merchant secret key")
+		return false, apperror.InternalError(err)
+	}
+	return v.sigSvc.Verify(secretKey, canonical, signature), nil
+}
+
+// secretExpired reports whether the merchant's secret is past its max age at t.
+func (v *hmacVerifier) secretExpired(merchant *domain.Merchant, t time.Time) bool {
+	expiresAt := merchant.SecretExpiresAt(v.cfg.secretExpiry.MaxAge)
+	return expiresAt != nil && !t.Before(*expiresAt)
+}
+
 // JWTAuth creates a middleware that validates JWT tokens for dashboard routes.
 func JWTAuth(tokenSvc ports.TokenService, log zerolog.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -161,6 +384,21 @@ func JWTAuth(tokenSvc ports.TokenService, log zerolog.Logger) gin.HandlerFunc {
 	}
 }
 
+// HMACOrJWTAuth serves one route to both the merchant API and the
+// dashboard: requests carrying the access key header named in headers are
+// authenticated by hmac, all others by jwt. Either sets CtxMerchantID and
+// CtxAccessKey.
+func HMACOrJWTAuth(headers SignatureHeaders, hmac, jwt gin.HandlerFunc) gin.HandlerFunc {
+	accessKeyHeader := headers.WithDefaults().AccessKey
+	return func(c *gin.Context) {
+		if c.GetHeader(accessKeyHeader) != "" {
+			hmac(c)
+			return
+		}
+		jwt(c)
+	}
+}
+
 // RequestLogger creates a middleware that logs every HTTP request.
 func RequestLogger(log zerolog.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
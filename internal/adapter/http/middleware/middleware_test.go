@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -9,9 +10,12 @@ import (
 	"testing"
 	"time"
 
+	memoryStorage "secure-payment-gateway/internal/adapter/storage/memory"
 	"secure-payment-gateway/internal/core/domain"
 	"secure-payment-gateway/internal/core/ports"
 	"secure-payment-gateway/internal/core/ports/mocks"
+	"secure-payment-gateway/internal/service"
+	"secure-payment-gateway/pkg/clientauth"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -128,6 +132,13 @@ func TestHMACAuth_Success(t *testing.T) {
 	sigSvc.EXPECT().BuildCanonicalString("POST", "/test", nowTs, "nonce-ok", body).Return("canonical")
 	sigSvc.EXPECT().Verify("raw_secret", "canonical", "valid_sig").Return(true)
 
+	recorded := make(chan uuid.UUID, 1)
+	merchantRepo.EXPECT().UpdateLastUsedAt(gomock.Any(), merchantID, gomock.Any()).
+		DoAndReturn(func(_ context.Context, id uuid.UUID, _ time.Time) error {
+			recorded <- id
+			return nil
+		})
+
 	var capturedID uuid.UUID
 	router := gin.New()
 	router.POST("/test", HMACAuth(merchantRepo, encSvc, sigSvc, nonceStore, log), func(c *gin.Context) {
@@ -146,6 +157,123 @@ func TestHMACAuth_Success(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Equal(t, merchantID, capturedID)
+
+	select {
+	case id := <-recorded:
+		assert.Equal(t, merchantID, id)
+	case <-time.After(time.Second):
+		t.Fatal("expected last_used_at to be recorded")
+	}
+}
+
+func TestHMACAuth_CustomSignatureHeaders(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	merchantRepo := mocks.NewMockMerchantRepository(ctrl)
+	encSvc := mocks.NewMockEncryptionService(ctrl)
+	sigSvc := mocks.NewMockSignatureService(ctrl)
+	nonceStore := mocks.NewMockNonceStore(ctrl)
+
+	lastUsed := time.Now() // recent, so last_used_at is not rewritten
+	merchant := &domain.Merchant{
+		ID:           uuid.New(),
+		AccessKey:    "ak_valid",
+		SecretKeyEnc: "enc_secret",
+		Status:       domain.MerchantStatusActive,
+		LastUsedAt:   &lastUsed,
+	}
+	nowTs := time.Now().Unix()
+
+	merchantRepo.EXPECT().GetByAccessKey(gomock.Any(), "ak_valid").Return(merchant, nil)
+	nonceStore.EXPECT().CheckAndSet(gomock.Any(), merchant.ID.String(), "nonce-ok", nonceTTL).Return(true, nil)
+	encSvc.EXPECT().Decrypt("enc_secret").Return("raw_secret", nil)
+	sigSvc.EXPECT().BuildCanonicalString("POST", "/test", nowTs, "nonce-ok", "").Return("canonical")
+	sigSvc.EXPECT().Verify("raw_secret", "canonical", "valid_sig").Return(true)
+
+	headers := SignatureHeaders{AccessKey: "X-Api-Key", Signature: "X-Api-Signature", Timestamp: "X-Api-Timestamp", Nonce: "X-Api-Nonce"}
+	router := gin.New()
+	router.POST("/test", HMACAuth(merchantRepo, encSvc, sigSvc, nonceStore, zerolog.Nop(), WithSignatureHeaders(headers)), func(c *gin.Context) {
+		c.JSON(200, gin.H{"ok": true})
+	})
+
+	// The default names are no longer read
+	req := httptest.NewRequest(http.MethodPost, "/test", nil)
+	req.Header.Set(HeaderAccessKey, "ak_valid")
+	req.Header.Set(HeaderSignature, "valid_sig")
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(nowTs, 10))
+	req.Header.Set(HeaderNonce, "nonce-ok")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/test", nil)
+	req.Header.Set("X-Api-Key", "ak_valid")
+	req.Header.Set("X-Api-Signature", "valid_sig")
+	req.Header.Set("X-Api-Timestamp", strconv.FormatInt(nowTs, 10))
+	req.Header.Set("X-Api-Nonce", "nonce-ok")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestLastUsedTracker_Throttles(t *testing.T) {
+	tracker := newLastUsedTracker(time.Minute)
+	merchant := &domain.Merchant{ID: uuid.New()}
+	now := time.Now()
+
+	assert.True(t, tracker.shouldRecord(merchant, now))
+	assert.False(t, tracker.shouldRecord(merchant, now.Add(30*time.Second)))
+	assert.True(t, tracker.shouldRecord(merchant, now.Add(2*time.Minute)))
+
+	// A recent persisted value suppresses the write even on a fresh tracker.
+	recent := now.Add(-10 * time.Second)
+	other := &domain.Merchant{ID: uuid.New(), LastUsedAt: &recent}
+	assert.False(t, newLastUsedTracker(time.Minute).shouldRecord(other, now))
+}
+
+func TestLastUsedTracker_SweepsExpiredEntries(t *testing.T) {
+	tracker := newLastUsedTracker(time.Minute)
+	now := time.Now()
+
+	for i := 0; i < 100; i++ {
+		assert.True(t, tracker.shouldRecord(&domain.Merchant{ID: uuid.New()}, now))
+	}
+	assert.Len(t, tracker.recorded, 100)
+
+	// Once the interval has passed, the next use clears the stale entries
+	active := &domain.Merchant{ID: uuid.New()}
+	assert.True(t, tracker.shouldRecord(active, now.Add(time.Minute)))
+	assert.Len(t, tracker.recorded, 1)
+	assert.False(t, tracker.shouldRecord(active, now.Add(90*time.Second)))
+}
+
+func TestHMACOrJWTAuth_PicksSchemeByAccessKeyHeader(t *testing.T) {
+	var used string
+	scheme := func(name string) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			used = name
+			c.Next()
+		}
+	}
+	router := gin.New()
+	router.POST("/test", HMACOrJWTAuth(SignatureHeaders{}, scheme("hmac"), scheme("jwt")), func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/test", nil)
+	req.Header.Set(HeaderAccessKey, "ak_test")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "hmac", used)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/test", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "jwt", used)
+	assert.Equal(t, http.StatusCreated, w.Code)
 }
 
 func TestJWTAuth_MissingHeader(t *testing.T) {
@@ -237,3 +365,183 @@ func TestRecovery_PanicRecovered(t *testing.T) {
 	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
 	assert.Equal(t, "SYS_001", resp["error_code"])
 }
+
+// serveWithNonceScope sends the same nonce, correctly signed each time, to
+// each path in turn and returns the status codes.
+func serveWithNonceScope(t *testing.T, scope NonceScope, paths ...string) []int {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	merchantRepo := mocks.NewMockMerchantRepository(ctrl)
+	encSvc := mocks.NewMockEncryptionService(ctrl)
+	nonceStore := memoryStorage.NewNonceStore(time.Minute)
+	defer nonceStore.Close()
+
+	merchant := &domain.Merchant{
+		ID:           uuid.New(),
+		AccessKey:    "ak_valid",
+		SecretKeyEnc: "enc_secret",
+		Status:       domain.MerchantStatusActive,
+	}
+	merchantRepo.EXPECT().GetByAccessKey(gomock.Any(), "ak_valid").Return(merchant, nil).AnyTimes()
+	merchantRepo.EXPECT().UpdateLastUsedAt(gomock.Any(), merchant.ID, gomock.Any()).Return(nil).AnyTimes()
+	encSvc.EXPECT().Decrypt("enc_secret").Return("raw_secret", nil).AnyTimes()
+
+	router := gin.New()
+	auth := HMACAuth(merchantRepo, encSvc, service.NewHMACSignatureService(), nonceStore, zerolog.Nop(), WithNonceScope(scope))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.POST("/payments", auth, ok)
+	router.POST("/payments/refund", auth, ok)
+
+	codes := make([]int, 0, len(paths))
+	for _, path := range paths {
+		body := []byte(`{"amount":50000}`)
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+		clientauth.SetHeaders(req, "ak_valid", "raw_secret", body, time.Now().Unix(), "shared-nonce")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+	return codes
+}
+
+func TestHMACAuth_NonceScopeMerchant(t *testing.T) {
+	codes := serveWithNonceScope(t, NonceScopeMerchant, "/payments", "/payments/refund")
+	assert.Equal(t, []int{http.StatusOK, http.StatusForbidden}, codes, "nonce is spent for every endpoint")
+}
+
+func TestHMACAuth_NonceScopeEndpoint(t *testing.T) {
+	codes := serveWithNonceScope(t, NonceScopeEndpoint, "/payments", "/payments/refund", "/payments")
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusForbidden}, codes,
+		"nonce may be reused on another endpoint but not replayed on the same one")
+}
+
+// serveWithTimestamp sends one correctly signed request stamped at ts.
+func serveWithTimestamp(t *testing.T, drift TimestampDrift, ts int64) int {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	merchantRepo := mocks.NewMockMerchantRepository(ctrl)
+	encSvc := mocks.NewMockEncryptionService(ctrl)
+	nonceStore := mocks.NewMockNonceStore(ctrl)
+
+	merchant := &domain.Merchant{ID: uuid.New(), AccessKey: "ak_valid", SecretKeyEnc: "enc_secret", Status: domain.MerchantStatusActive}
+	merchantRepo.EXPECT().GetByAccessKey(gomock.Any(), "ak_valid").Return(merchant, nil).AnyTimes()
+	merchantRepo.EXPECT().UpdateLastUsedAt(gomock.Any(), merchant.ID, gomock.Any()).Return(nil).AnyTimes()
+	encSvc.EXPECT().Decrypt("enc_secret").Return("raw_secret", nil).AnyTimes()
+	nonceStore.EXPECT().CheckAndSet(gomock.Any(), merchant.ID.String(), "nonce-ts", gomock.Any()).Return(true, nil).AnyTimes()
+
+	router := gin.New()
+	router.POST("/payments", HMACAuth(merchantRepo, encSvc, service.NewHMACSignatureService(), nonceStore, zerolog.Nop(), WithTimestampDrift(drift)),
+		func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	body := []byte(`{"amount":50000}`)
+	req := httptest.NewRequest(http.MethodPost, "/payments", bytes.NewReader(body))
+	clientauth.SetHeaders(req, "ak_valid", "raw_secret", body, ts, "nonce-ts")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestHMACAuth_AsymmetricTimestampDrift(t *testing.T) {
+	drift := TimestampDrift{Past: 120 * time.Second, Future: 5 * time.Second}
+	now := time.Now().Unix()
+
+	assert.Equal(t, http.StatusOK, serveWithTimestamp(t, drift, now-100), "within past tolerance")
+	assert.Equal(t, http.StatusOK, serveWithTimestamp(t, drift, now+2), "within future tolerance")
+	assert.Equal(t, http.StatusForbidden, serveWithTimestamp(t, drift, now+30), "too far in the future")
+	assert.Equal(t, http.StatusForbidden, serveWithTimestamp(t, drift, now-200), "too old")
+
+	// Defaults stay symmetric at 60s
+	assert.Equal(t, http.StatusOK, serveWithTimestamp(t, TimestampDrift{}, now+30))
+	assert.Equal(t, http.StatusForbidden, serveWithTimestamp(t, TimestampDrift{}, now-100))
+}
+
+func TestHMACAuth_NonceTTLCoversDriftWindow(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	merchantRepo := mocks.NewMockMerchantRepository(ctrl)
+	encSvc := mocks.NewMockEncryptionService(ctrl)
+	nonceStore := mocks.NewMockNonceStore(ctrl)
+
+	merchant := &domain.Merchant{ID: uuid.New(), AccessKey: "ak_valid", SecretKeyEnc: "enc_secret", Status: domain.MerchantStatusActive}
+	merchantRepo.EXPECT().GetByAccessKey(gomock.Any(), "ak_valid").Return(merchant, nil)
+	merchantRepo.EXPECT().UpdateLastUsedAt(gomock.Any(), merchant.ID, gomock.Any()).Return(nil).AnyTimes()
+	encSvc.EXPECT().Decrypt("enc_secret").Return("raw_secret", nil)
+	nonceStore.EXPECT().CheckAndSet(gomock.Any(), merchant.ID.String(), "nonce-ttl", 300*time.Second).Return(true, nil)
+
+	router := gin.New()
+	drift := WithTimestampDrift(TimestampDrift{Past: 240 * time.Second, Future: 60 * time.Second})
+	router.POST("/payments", HMACAuth(merchantRepo, encSvc, service.NewHMACSignatureService(), nonceStore, zerolog.Nop(), drift),
+		func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	body := []byte(`{}`)
+	req := httptest.NewRequest(http.MethodPost, "/payments", bytes.NewReader(body))
+	clientauth.SetHeaders(req, "ak_valid", "raw_secret", body, time.Now().Unix(), "nonce-ttl")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// serveWithSecretAge sends one correctly signed request from a merchant whose
+// secret was last rotated age ago.
+func serveWithSecretAge(t *testing.T, expiry SecretExpiry, age time.Duration) *httptest.ResponseRecorder {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	merchantRepo := mocks.NewMockMerchantRepository(ctrl)
+	encSvc := mocks.NewMockEncryptionService(ctrl)
+	nonceStore := mocks.NewMockNonceStore(ctrl)
+
+	rotatedAt := time.Now().UTC().Add(-age)
+	merchant := &domain.Merchant{
+		ID:              uuid.New(),
+		AccessKey:       "ak_valid",
+		SecretKeyEnc:    "enc_secret",
+		Status:          domain.MerchantStatusActive,
+		SecretRotatedAt: &rotatedAt,
+	}
+	merchantRepo.EXPECT().GetByAccessKey(gomock.Any(), "ak_valid").Return(merchant, nil)
+	merchantRepo.EXPECT().UpdateLastUsedAt(gomock.Any(), merchant.ID, gomock.Any()).Return(nil).AnyTimes()
+	encSvc.EXPECT().Decrypt("enc_secret").Return("raw_secret", nil)
+	nonceStore.EXPECT().CheckAndSet(gomock.Any(), merchant.ID.String(), "nonce-age", gomock.Any()).Return(true, nil)
+
+	router := gin.New()
+	router.POST("/payments", HMACAuth(merchantRepo, encSvc, service.NewHMACSignatureService(), nonceStore, zerolog.Nop(), WithSecretExpiry(expiry)),
+		func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	body := []byte(`{"amount":50000}`)
+	req := httptest.NewRequest(http.MethodPost, "/payments", bytes.NewReader(body))
+	clientauth.SetHeaders(req, "ak_valid", "raw_secret", body, time.Now().Unix(), "nonce-age")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestHMACAuth_SecretExpiry_FreshSecretNotFlagged(t *testing.T) {
+	w := serveWithSecretAge(t, SecretExpiry{MaxAge: 90 * 24 * time.Hour, Block: true}, 24*time.Hour)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(HeaderSecretKeyWarning))
+}
+
+func TestHMACAuth_SecretExpiry_WarnFlagsExpiredSecret(t *testing.T) {
+	w := serveWithSecretAge(t, SecretExpiry{MaxAge: 90 * 24 * time.Hour}, 91*24*time.Hour)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "SEC_005", w.Header().Get(HeaderSecretKeyWarning))
+}
+
+func TestHMACAuth_SecretExpiry_BlockRejectsExpiredSecret(t *testing.T) {
+	w := serveWithSecretAge(t, SecretExpiry{MaxAge: 90 * 24 * time.Hour, Block: true}, 91*24*time.Hour)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "SEC_005", resp["error_code"])
+}
+
+func TestHMACAuth_SecretExpiry_DisabledByDefault(t *testing.T) {
+	w := serveWithSecretAge(t, SecretExpiry{}, 5*365*24*time.Hour)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(HeaderSecretKeyWarning))
+}
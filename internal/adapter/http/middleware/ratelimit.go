@@ -14,42 +14,91 @@ redisStore "secure-payment-gateway/internal/adapter/storage/redis"
 )
 
 // RateLimitRule defines a rate limit for an endpoint group.
+// Cost is the number of units each request consumes from the bucket; zero means 1.
 type RateLimitRule struct {
 Limit  int64
 Window time.Duration
+Cost   int64
 }
 
 // DefaultRateLimitRules returns the spec-defined rate limits per endpoint group.
+// Dashboard reads are split into independent groups so heavy listing or export
+// traffic cannot starve balance checks; "dashboard" covers the remaining
+// merchant management endpoints. Batch refunds and exports weigh 10 units
+// each, so their limits still admit 5 requests a minute.
 func DefaultRateLimitRules() map[string]RateLimitRule {
 return map[string]RateLimitRule{
-"payments":        {Limit: 100, Window: time.Minute},
-"payments_refund": {Limit: 30, Window: time.Minute},
-"auth_login":      {Limit: 10, Window: time.Minute},
-"auth_register":   {Limit: 5, Window: time.Hour},
-"dashboard":       {Limit: 60, Window: time.Minute},
-"wallets_topup":   {Limit: 20, Window: time.Minute},
+"payments":              {Limit: 100, Window: time.Minute},
+"payments_refund":       {Limit: 30, Window: time.Minute},
+"payments_refund_batch": {Limit: 50, Window: time.Minute, Cost: 10},
+"auth_login":            {Limit: 10, Window: time.Minute},
+"auth_register":         {Limit: 5, Window: time.Hour},
+"auth_verify_signature": {Limit: 30, Window: time.Minute},
+"dashboard":             {Limit: 60, Window: time.Minute},
+"dashboard_stats":       {Limit: 30, Window: time.Minute},
+"transactions_list":     {Limit: 60, Window: time.Minute},
+"transactions_export":   {Limit: 50, Window: time.Minute, Cost: 10},
+"balance":               {Limit: 120, Window: time.Minute},
+"wallets_topup":         {Limit: 20, Window: time.Minute},
+}
+}
+
+// RateLimiterOption configures optional RateLimiter behaviour.
+type RateLimiterOption func(*rateLimiterConfig)
+
+type rateLimiterConfig struct {
+fallback        *LocalRateLimiter
+accessKeyHeader string
+}
+
+// WithLocalFallback limits requests with the given per-instance limiter when
+// the Redis store fails (or is nil), instead of allowing them unchecked.
+func WithLocalFallback(l *LocalRateLimiter) RateLimiterOption {
+return func(cfg *rateLimiterConfig) {
+cfg.fallback = l
+}
+}
+
+// WithAccessKeyHeader counts signed requests by the access key in the named
+// header (default HeaderAccessKey); set it to match WithSignatureHeaders.
+func WithAccessKeyHeader(name string) RateLimiterOption {
+return func(cfg *rateLimiterConfig) {
+cfg.accessKeyHeader = name
 }
 }
 
 // RateLimiter creates a rate-limiting middleware for a given endpoint group.
-func RateLimiter(store *redisStore.RateLimitStore, group string, rule RateLimitRule, log zerolog.Logger) gin.HandlerFunc {
+// If the store fails, requests are allowed (degraded mode) unless a local
+// fallback is configured.
+func RateLimiter(store *redisStore.RateLimitStore, group string, rule RateLimitRule, log zerolog.Logger, opts ...RateLimiterOption) gin.HandlerFunc {
+cfg := rateLimiterConfig{accessKeyHeader: HeaderAccessKey}
+for _, opt := range opts {
+opt(&cfg)
+}
+
 return func(c *gin.Context) {
-identifier := extractIdentifier(c)
-key := fmt.Sprintf("%s:%s", identifier, group)
+key := RateLimitKey(extractIdentifier(c, cfg.accessKeyHeader), group)
 
-result, err := store.Allow(c.Request.Context(), key, rule.Limit, rule.Window)
-if err != nil {
+var result *redisStore.RateLimitResult
+var err error
+if store != nil {
+result, err = store.AllowN(c.Request.Context(), key, rule.Limit, rule.Cost, rule.Window)
+}
+if store == nil || err != nil {
+if cfg.fallback == nil {
 log.Warn().Err(err).Str("group", group).Msg("rate limit check failed, allowing request (degraded mode)")
 c.Next()
 return
 }
-
-// Always set rate limit headers
-c.Header("X-RateLimit-Limit", strconv.FormatInt(result.Limit, 10))
-c.Header("X-RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
-c.Header("X-RateLimit-Reset", strconv.FormatInt(result.ResetAt, 10))
+if err != nil {
+log.Warn().Err(err).Str("group", group).Msg("rate limit check failed, using local limiter (degraded mode)")
+}
+result = cfg.fallback.AllowN(key, rule.Limit, rule.Cost, rule.Window)
+}
 
 if !result.Allowed {
+// Rejected responses carry the full header set so clients can self-throttle
+writeRateLimitHeaders(c, result.Limit, 0, result.ResetAt)
 retryAfter := result.ResetAt - time.Now().Unix()
 if retryAfter < 1 {
 retryAfter = 1
@@ -60,13 +109,28 @@ c.Abort()
 return
 }
 
+writeRateLimitHeaders(c, result.Limit, result.Remaining, result.ResetAt)
 c.Next()
 }
 }
 
+// RateLimitKey returns the counter key for identifier's requests in group.
+// HMAC routes are counted per access key, JWT routes per merchant ID and
+// public routes per client IP.
+func RateLimitKey(identifier, group string) string {
+return fmt.Sprintf("%s:%s", identifier, group)
+}
+
+// writeRateLimitHeaders sets the X-RateLimit-* headers on the response.
+func writeRateLimitHeaders(c *gin.Context, limit, remaining, resetAt int64) {
+c.Header("X-RateLimit-Limit", strconv.FormatInt(limit, 10))
+c.Header("X-RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+c.Header("X-RateLimit-Reset", strconv.FormatInt(resetAt, 10))
+}
+
 // extractIdentifier determines the rate limit key source.
-func extractIdentifier(c *gin.Context) string {
-if ak := c.GetHeader(HeaderAccessKey); ak != "" {
+func extractIdentifier(c *gin.Context, accessKeyHeader string) string {
+if ak := c.GetHeader(accessKeyHeader); ak != "" {
 return ak
 }
 if mid, exists := c.Get(CtxMerchantID); exists {
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	redisStore "secure-payment-gateway/internal/adapter/storage/redis"
+)
+
+// LocalRateLimiter is an in-process token-bucket limiter that RateLimiter
+// falls back to when the Redis store fails. Each bucket holds up to the rule's
+// limit and refills at limit per window. Limits are per instance, so during an
+// outage N instances together admit up to N times the configured rate.
+type LocalRateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	window time.Duration
+}
+
+// NewLocalRateLimiter creates an empty local limiter. It is safe for
+// concurrent use.
+func NewLocalRateLimiter() *LocalRateLimiter {
+	return &LocalRateLimiter{
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// AllowN takes cost tokens (minimum 1) from key's bucket if available.
+// ResetAt is when the bucket will next hold enough tokens for the request
+// (rejected) or be full again (allowed).
+func (l *LocalRateLimiter) AllowN(key string, limit, cost int64, window time.Duration) *redisStore.RateLimitResult {
+	if cost < 1 {
+		cost = 1
+	}
+	now := l.now()
+	rate := float64(limit) / window.Seconds() // tokens per second
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(limit), last: now, window: window}
+		l.buckets[key] = b
+	} else {
+		b.tokens = math.Min(float64(limit), b.tokens+now.Sub(b.last).Seconds()*rate)
+		b.last = now
+	}
+
+	allowed := b.tokens >= float64(cost)
+	if allowed {
+		b.tokens -= float64(cost)
+	}
+
+	missing := float64(limit) - b.tokens
+	if !allowed {
+		missing = float64(cost) - b.tokens
+	}
+	resetAt := now.Add(time.Duration(missing / rate * float64(time.Second)))
+
+	return &redisStore.RateLimitResult{
+		Allowed:   allowed,
+		Limit:     limit,
+		Remaining: int64(b.tokens),
+		ResetAt:   int64(math.Ceil(float64(resetAt.UnixNano()) / float64(time.Second))),
+	}
+}
+
+// sweep drops buckets idle for a full window, which have refilled completely
+// and are indistinguishable from new ones. It runs at most once a minute.
+func (l *LocalRateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= b.window {
+			delete(l.buckets, key)
+		}
+	}
+}
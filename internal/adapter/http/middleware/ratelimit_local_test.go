@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	redisStore "secure-payment-gateway/internal/adapter/storage/redis"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLocalLimiter() (*LocalRateLimiter, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewLocalRateLimiter()
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestLocalRateLimiter_AllowsWithinLimit(t *testing.T) {
+	l, _ := newTestLocalLimiter()
+
+	for i := int64(0); i < 3; i++ {
+		res := l.AllowN("k", 3, 1, time.Minute)
+		assert.True(t, res.Allowed, "request %d should be allowed", i+1)
+		assert.Equal(t, int64(3), res.Limit)
+		assert.Equal(t, 2-i, res.Remaining)
+	}
+}
+
+func TestLocalRateLimiter_BlocksOverLimit(t *testing.T) {
+	l, now := newTestLocalLimiter()
+
+	for i := 0; i < 3; i++ {
+		require.True(t, l.AllowN("k", 3, 1, time.Minute).Allowed)
+	}
+	res := l.AllowN("k", 3, 1, time.Minute)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, int64(0), res.Remaining)
+	// One token refills every 20s
+	assert.Equal(t, now.Add(20*time.Second).Unix(), res.ResetAt)
+
+	// Other keys have their own bucket
+	assert.True(t, l.AllowN("other", 3, 1, time.Minute).Allowed)
+}
+
+func TestLocalRateLimiter_Refills(t *testing.T) {
+	l, now := newTestLocalLimiter()
+
+	for i := 0; i < 3; i++ {
+		require.True(t, l.AllowN("k", 3, 1, time.Minute).Allowed)
+	}
+	*now = now.Add(19 * time.Second)
+	assert.False(t, l.AllowN("k", 3, 1, time.Minute).Allowed)
+
+	*now = now.Add(time.Second)
+	assert.True(t, l.AllowN("k", 3, 1, time.Minute).Allowed)
+	assert.False(t, l.AllowN("k", 3, 1, time.Minute).Allowed)
+}
+
+func TestLocalRateLimiter_WeightedCost(t *testing.T) {
+	l, _ := newTestLocalLimiter()
+
+	assert.True(t, l.AllowN("k", 6, 3, time.Minute).Allowed)
+	assert.True(t, l.AllowN("k", 6, 3, time.Minute).Allowed)
+	assert.False(t, l.AllowN("k", 6, 3, time.Minute).Allowed)
+}
+
+func TestLocalRateLimiter_SweepsIdleBuckets(t *testing.T) {
+	l, now := newTestLocalLimiter()
+
+	l.AllowN("idle", 3, 1, time.Minute)
+	*now = now.Add(2 * time.Minute)
+	l.AllowN("active", 3, 1, time.Minute)
+
+	assert.NotContains(t, l.buckets, "idle")
+	assert.Contains(t, l.buckets, "active")
+}
+
+func TestRateLimiter_FallsBackToLocalWhenStoreFails(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	mr.SetError("ERR Redis is unavailable") // Redis outage
+
+	rule := RateLimitRule{Limit: 2, Window: time.Minute}
+	r := gin.New()
+	r.GET("/test", RateLimiter(redisStore.NewRateLimitStore(client), "test", rule, zerolog.Nop(), WithLocalFallback(NewLocalRateLimiter())),
+		func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	codes := make([]int, 3)
+	for i := range codes {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+		codes[i] = w.Code
+		assert.NotEmpty(t, w.Header().Get("X-RateLimit-Remaining"))
+	}
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, codes)
+}
+
+func TestRateLimiter_FailsOpenWithoutFallback(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	mr.SetError("ERR Redis is unavailable")
+
+	rule := RateLimitRule{Limit: 1, Window: time.Minute}
+	r := gin.New()
+	r.GET("/test", RateLimiter(redisStore.NewRateLimitStore(client), "test", rule, zerolog.Nop()),
+		func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+}
@@ -73,6 +73,56 @@ assert.Equal(t, 429, w.Code)
 assert.NotEmpty(t, w.Header().Get("Retry-After"))
 }
 
+func TestRateLimiter_RejectedResponseHasFullHeaderSet(t *testing.T) {
+mr := miniredis.RunT(t)
+client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+defer client.Close()
+
+store := redisStore.NewRateLimitStore(client)
+router := setupRateLimitRouter(store)
+
+var w *httptest.ResponseRecorder
+for i := 0; i < 4; i++ {
+w = httptest.NewRecorder()
+req, _ := http.NewRequestWithContext(context.Background(), "GET", "/test", nil)
+router.ServeHTTP(w, req)
+}
+
+assert.Equal(t, 429, w.Code)
+assert.Equal(t, "3", w.Header().Get("X-RateLimit-Limit"))
+assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+assert.NotEmpty(t, w.Header().Get("X-RateLimit-Reset"))
+assert.NotEmpty(t, w.Header().Get("Retry-After"))
+}
+
+func TestRateLimiter_WeightedCost(t *testing.T) {
+mr := miniredis.RunT(t)
+client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+defer client.Close()
+
+store := redisStore.NewRateLimitStore(client)
+rule := middleware.RateLimitRule{Limit: 6, Window: time.Minute, Cost: 3}
+
+r := gin.New()
+r.GET("/export", middleware.RateLimiter(store, "export", rule, zerolog.Nop()), func(c *gin.Context) {
+c.JSON(200, gin.H{"ok": true})
+})
+
+codes := make([]int, 0, 3)
+for i := 0; i < 3; i++ {
+w := httptest.NewRecorder()
+req, _ := http.NewRequestWithContext(context.Background(), "GET", "/export", nil)
+r.ServeHTTP(w, req)
+codes = append(codes, w.Code)
+if i == 0 {
+assert.Equal(t, "3", w.Header().Get("X-RateLimit-Remaining"))
+}
+}
+
+// A cost-3 endpoint exhausts a limit-6 bucket in two requests
+assert.Equal(t, []int{200, 200, 429}, codes)
+}
+
 func TestRateLimiter_UsesAccessKeyHeader(t *testing.T) {
 mr := miniredis.RunT(t)
 client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
@@ -106,4 +156,49 @@ assert.Equal(t, int64(10), rules["auth_login"].Limit)
 assert.Equal(t, int64(5), rules["auth_register"].Limit)
 assert.Equal(t, int64(60), rules["dashboard"].Limit)
 assert.Equal(t, int64(20), rules["wallets_topup"].Limit)
+assert.Equal(t, int64(30), rules["dashboard_stats"].Limit)
+assert.Equal(t, int64(60), rules["transactions_list"].Limit)
+assert.Equal(t, int64(50), rules["transactions_export"].Limit)
+assert.Equal(t, int64(10), rules["transactions_export"].Cost)
+assert.Equal(t, int64(50), rules["payments_refund_batch"].Limit)
+assert.Equal(t, int64(10), rules["payments_refund_batch"].Cost)
+assert.Equal(t, int64(120), rules["balance"].Limit)
+}
+
+func TestRateLimiter_GroupsHaveIndependentCounters(t *testing.T) {
+mr := miniredis.RunT(t)
+client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+defer client.Close()
+
+store := redisStore.NewRateLimitStore(client)
+log := zerolog.Nop()
+rule := middleware.RateLimitRule{Limit: 1, Window: time.Minute}
+groups := []string{"transactions_list", "transactions_export", "dashboard_stats", "balance"}
+
+r := gin.New()
+for _, g := range groups {
+r.GET("/"+g, middleware.RateLimiter(store, g, rule, log), func(c *gin.Context) {
+c.JSON(200, gin.H{"ok": true})
+})
+}
+
+do := func(path string) int {
+w := httptest.NewRecorder()
+req, _ := http.NewRequestWithContext(context.Background(), "GET", path, nil)
+req.Header.Set("X-Merchant-Access-Key", "merchantA")
+r.ServeHTTP(w, req)
+return w.Code
+}
+
+// Exhaust the export bucket
+assert.Equal(t, 200, do("/transactions_export"))
+assert.Equal(t, 429, do("/transactions_export"))
+
+// Every other group still has its own budget
+for _, g := range groups {
+if g == "transactions_export" {
+continue
+}
+assert.Equal(t, 200, do("/"+g), g)
+}
 }
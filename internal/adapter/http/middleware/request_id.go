@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"secure-payment-gateway/internal/core/domain"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestID returns middleware that assigns each request a fresh ID. It is
+// stored under CtxRequestID, so response bodies report it, and in the request
+// context for services and audit deduplication. Client-supplied IDs are not
+// trusted: a reused ID would let one request's audit entry suppress another's.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := uuid.New().String()
+		c.Set(CtxRequestID, id)
+		c.Request = c.Request.WithContext(domain.ContextWithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
@@ -0,0 +1,99 @@
+// Package memory provides in-process implementations of storage ports for
+// deployments without Redis. State is per process and lost on restart.
+package memory
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultIdempotencyCacheSize is the entry limit used when none is configured.
+const DefaultIdempotencyCacheSize = 10000
+
+// IdempotencyCache implements ports.IdempotencyCache as a size-bounded LRU
+// with per-entry TTL. It is safe for concurrent use.
+//
+// Entries are not shared between instances, so with several replicas the
+// database idempotency log remains the authority; this cache only saves the
+// lookup when a retry reaches the same process.
+type IdempotencyCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	ll         *list.List // front = most recently used
+	items      map[string]*list.Element
+	now        func() time.Time
+}
+
+type cacheEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time // zero = no expiry
+}
+
+// NewIdempotencyCache creates an in-memory idempotency cache holding at most
+// maxEntries keys; the least recently used key is evicted beyond that.
+// A non-positive maxEntries uses DefaultIdempotencyCacheSize.
+func NewIdempotencyCache(maxEntries int) *IdempotencyCache {
+	if maxEntries <= 0 {
+		maxEntries = DefaultIdempotencyCacheSize
+	}
+	return &IdempotencyCache{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+		now:        time.Now,
+	}
+}
+
+// Get retrieves a cached response by idempotency key.
+// Returns nil, nil if the key does not exist or has expired.
+func (c *IdempotencyCache) Get(_ context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, nil
+	}
+	entry := el.Value.(*cacheEntry)
+	if c.expired(entry) {
+		c.remove(el)
+		return nil, nil
+	}
+	c.ll.MoveToFront(el)
+	return append([]byte(nil), entry.value...), nil
+}
+
+// Set stores a response with TTL, replacing any existing entry for the key.
+// A non-positive TTL keeps the entry until it is evicted, as Redis does.
+func (c *IdempotencyCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cacheEntry{key: key, value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		entry.expiresAt = c.now().Add(ttl)
+	}
+
+	if el, ok := c.items[key]; ok {
+		el.Value = entry
+		c.ll.MoveToFront(el)
+		return nil
+	}
+	c.items[key] = c.ll.PushFront(entry)
+	for c.ll.Len() > c.maxEntries {
+		c.remove(c.ll.Back())
+	}
+	return nil
+}
+
+func (c *IdempotencyCache) expired(e *cacheEntry) bool {
+	return !e.expiresAt.IsZero() && !c.now().Before(e.expiresAt)
+}
+
+func (c *IdempotencyCache) remove(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*cacheEntry).key)
+}
@@ -0,0 +1,131 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock lets tests move time forward without sleeping.
+type fakeClock struct{ t time.Time }
+
+func (f *fakeClock) Now() time.Time          { return f.t }
+func (f *fakeClock) Advance(d time.Duration) { f.t = f.t.Add(d) }
+
+func newTestCache(maxEntries int) (*IdempotencyCache, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	c := NewIdempotencyCache(maxEntries)
+	c.now = clock.Now
+	return c, clock
+}
+
+func TestIdempotencyCache_SetAndGet(t *testing.T) {
+	cache, _ := newTestCache(10)
+	ctx := context.Background()
+
+	key := "merchant-123:ORDER-001"
+	value := []byte(`{"transaction_id":"abc","status":"SUCCESS"}`)
+
+	result, err := cache.Get(ctx, key)
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+
+	require.NoError(t, cache.Set(ctx, key, value, 24*time.Hour))
+
+	result, err = cache.Get(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, value, result)
+
+	// Stored bytes are not aliased to the caller's slice
+	result[0] = 'X'
+	again, _ := cache.Get(ctx, key)
+	assert.Equal(t, value, again)
+}
+
+func TestIdempotencyCache_TTLExpiry(t *testing.T) {
+	cache, clock := newTestCache(10)
+	ctx := context.Background()
+
+	require.NoError(t, cache.Set(ctx, "short", []byte("v"), time.Minute))
+	require.NoError(t, cache.Set(ctx, "forever", []byte("v"), 0))
+
+	clock.Advance(59 * time.Second)
+	result, _ := cache.Get(ctx, "short")
+	assert.NotNil(t, result)
+
+	clock.Advance(time.Second)
+	result, err := cache.Get(ctx, "short")
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+	assert.Equal(t, 1, cache.ll.Len(), "expired entry is dropped on access")
+
+	clock.Advance(365 * 24 * time.Hour)
+	result, _ = cache.Get(ctx, "forever")
+	assert.NotNil(t, result)
+}
+
+func TestIdempotencyCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	cache, _ := newTestCache(2)
+	ctx := context.Background()
+
+	require.NoError(t, cache.Set(ctx, "a", []byte("1"), time.Hour))
+	require.NoError(t, cache.Set(ctx, "b", []byte("2"), time.Hour))
+	// Touch "a" so "b" becomes the eviction candidate
+	_, _ = cache.Get(ctx, "a")
+	require.NoError(t, cache.Set(ctx, "c", []byte("3"), time.Hour))
+
+	a, _ := cache.Get(ctx, "a")
+	b, _ := cache.Get(ctx, "b")
+	c, _ := cache.Get(ctx, "c")
+	assert.Equal(t, []byte("1"), a)
+	assert.Nil(t, b)
+	assert.Equal(t, []byte("3"), c)
+	assert.Equal(t, 2, cache.ll.Len())
+}
+
+func TestIdempotencyCache_OverwriteRefreshesTTL(t *testing.T) {
+	cache, clock := newTestCache(2)
+	ctx := context.Background()
+
+	require.NoError(t, cache.Set(ctx, "k", []byte("old"), time.Minute))
+	clock.Advance(50 * time.Second)
+	require.NoError(t, cache.Set(ctx, "k", []byte("new"), time.Minute))
+	clock.Advance(50 * time.Second)
+
+	result, _ := cache.Get(ctx, "k")
+	assert.Equal(t, []byte("new"), result)
+	assert.Equal(t, 1, cache.ll.Len())
+}
+
+func TestIdempotencyCache_DefaultSize(t *testing.T) {
+	assert.Equal(t, DefaultIdempotencyCacheSize, NewIdempotencyCache(0).maxEntries)
+}
+
+func TestIdempotencyCache_ConcurrentAccess(t *testing.T) {
+	cache := NewIdempotencyCache(50)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				key := fmt.Sprintf("k-%d", (g*200+i)%100)
+				_ = cache.Set(ctx, key, []byte(key), time.Minute)
+				if v, _ := cache.Get(ctx, key); v != nil {
+					assert.Equal(t, key, string(v))
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, cache.ll.Len(), 50)
+	assert.Len(t, cache.items, cache.ll.Len())
+}
@@ -0,0 +1,55 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// InFlightLock implements ports.InFlightLock within one process. Duplicates
+// reaching another instance are not seen, as with the in-memory
+// idempotency cache.
+type InFlightLock struct {
+	mu     sync.Mutex
+	claims map[string]inFlightClaim
+	now    func() time.Time
+}
+
+type inFlightClaim struct {
+	token     string
+	expiresAt time.Time
+}
+
+// NewInFlightLock creates an empty in-memory in-flight lock.
+func NewInFlightLock() *InFlightLock {
+	return &InFlightLock{claims: make(map[string]inFlightClaim), now: time.Now}
+}
+
+// Acquire claims key for ttl, returning "" if it is already claimed. An
+// expired claim is taken over.
+func (l *InFlightLock) Acquire(_ context.Context, key string, ttl time.Duration) (string, error) {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if claim, ok := l.claims[key]; ok && now.Before(claim.expiresAt) {
+		return "", nil
+	}
+	token := uuid.NewString()
+	l.claims[key] = inFlightClaim{token: token, expiresAt: now.Add(ttl)}
+	return token, nil
+}
+
+// Release frees key if token still holds it.
+func (l *InFlightLock) Release(_ context.Context, key, token string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if claim, ok := l.claims[key]; ok && claim.token == token {
+		delete(l.claims, key)
+	}
+	return nil
+}
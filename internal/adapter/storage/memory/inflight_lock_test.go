@@ -0,0 +1,40 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInFlightLock_AcquireReleaseAndExpiry(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	lock := NewInFlightLock()
+	lock.now = clock.Now
+	ctx := context.Background()
+
+	token, err := lock.Acquire(ctx, "m:ORD-1", time.Minute)
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+
+	other, err := lock.Acquire(ctx, "m:ORD-1", time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, other, "held by the first claim")
+
+	// A stale token does not free the current claim
+	require.NoError(t, lock.Release(ctx, "m:ORD-1", "stale"))
+	other, _ = lock.Acquire(ctx, "m:ORD-1", time.Minute)
+	assert.Empty(t, other)
+
+	require.NoError(t, lock.Release(ctx, "m:ORD-1", token))
+	token, _ = lock.Acquire(ctx, "m:ORD-1", time.Minute)
+	assert.NotEmpty(t, token, "free again after release")
+
+	// An abandoned claim expires
+	clock.Advance(time.Minute)
+	other, _ = lock.Acquire(ctx, "m:ORD-1", time.Minute)
+	assert.NotEmpty(t, other)
+	assert.NotEqual(t, token, other)
+}
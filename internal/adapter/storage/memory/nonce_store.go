@@ -0,0 +1,100 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultNonceSweepInterval is how often expired nonces are purged when no
+// interval is configured.
+const DefaultNonceSweepInterval = time.Minute
+
+// NonceStore implements ports.NonceStore in process memory.
+//
+// CheckAndSet is atomic within one process only. Nonces are not shared between
+// instances, so behind a load balancer a replayed request routed to another
+// instance is NOT detected: use it only for single-instance deployments.
+type NonceStore struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time // key -> expiry
+	now    func() time.Time
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewNonceStore creates an in-memory nonce store and starts a goroutine that
+// purges expired nonces every sweepInterval (DefaultNonceSweepInterval if
+// non-positive). Call Close to stop it.
+func NewNonceStore(sweepInterval time.Duration) *NonceStore {
+	if sweepInterval <= 0 {
+		sweepInterval = DefaultNonceSweepInterval
+	}
+	s := &NonceStore{
+		nonces: make(map[string]time.Time),
+		now:    time.Now,
+		stop:   make(chan struct{}),
+	}
+	go s.sweepLoop(sweepInterval)
+	return s
+}
+
+// CheckAndSet atomically checks if a nonce exists, sets it if not.
+// Returns true if the nonce is new (valid), false if already used.
+func (s *NonceStore) CheckAndSet(_ context.Context, merchantID string, nonce string, ttl time.Duration) (bool, error) {
+	key := merchantID + ":" + nonce
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if expiry, ok := s.nonces[key]; ok && now.Before(expiry) {
+		return false, nil
+	}
+	s.nonces[key] = now.Add(ttl)
+	return true, nil
+}
+
+// Seen reports whether a nonce has been used, without recording it.
+func (s *NonceStore) Seen(_ context.Context, merchantID string, nonce string) (bool, error) {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiry, ok := s.nonces[merchantID+":"+nonce]
+	return ok && now.Before(expiry), nil
+}
+
+// Close stops the sweeper. The store remains usable but no longer purges.
+func (s *NonceStore) Close() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+func (s *NonceStore) sweepLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.sweep()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// sweep removes expired nonces so the map does not grow without bound.
+func (s *NonceStore) sweep() {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, expiry := range s.nonces {
+		if !now.Before(expiry) {
+			delete(s.nonces, key)
+		}
+	}
+}
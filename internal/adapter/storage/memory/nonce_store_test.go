@@ -0,0 +1,121 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestNonceStore returns a store on a fake clock whose background sweeper
+// never fires during the test; call sweep directly instead.
+func newTestNonceStore(t *testing.T) (*NonceStore, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewNonceStore(time.Hour)
+	t.Cleanup(s.Close)
+	s.now = clock.Now
+	return s, clock
+}
+
+func TestNonceStore_CheckAndSet_NewAndReplay(t *testing.T) {
+	store, _ := newTestNonceStore(t)
+	ctx := context.Background()
+
+	ok, err := store.CheckAndSet(ctx, "merchant-1", "nonce-xyz", 5*time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok, "new nonce should return true")
+
+	ok, err = store.CheckAndSet(ctx, "merchant-1", "nonce-xyz", 5*time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok, "replayed nonce should return false")
+
+	// Nonces are scoped per merchant
+	ok, err = store.CheckAndSet(ctx, "merchant-2", "nonce-xyz", 5*time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestNonceStore_TTLExpiry(t *testing.T) {
+	store, clock := newTestNonceStore(t)
+	ctx := context.Background()
+
+	ok, _ := store.CheckAndSet(ctx, "merchant-1", "nonce-ttl", 2*time.Minute)
+	require.True(t, ok)
+
+	clock.Advance(2*time.Minute - time.Second)
+	ok, _ = store.CheckAndSet(ctx, "merchant-1", "nonce-ttl", 2*time.Minute)
+	assert.False(t, ok, "nonce still within TTL")
+
+	clock.Advance(time.Second)
+	ok, _ = store.CheckAndSet(ctx, "merchant-1", "nonce-ttl", 2*time.Minute)
+	assert.True(t, ok, "nonce is reusable once its TTL has passed")
+}
+
+func TestNonceStore_Seen_DoesNotRecord(t *testing.T) {
+	store, clock := newTestNonceStore(t)
+	ctx := context.Background()
+
+	seen, _ := store.Seen(ctx, "merchant-1", "nonce-peek")
+	assert.False(t, seen)
+	ok, _ := store.CheckAndSet(ctx, "merchant-1", "nonce-peek", time.Minute)
+	assert.True(t, ok, "looking did not spend the nonce")
+
+	seen, _ = store.Seen(ctx, "merchant-1", "nonce-peek")
+	assert.True(t, seen)
+	clock.Advance(time.Minute)
+	seen, _ = store.Seen(ctx, "merchant-1", "nonce-peek")
+	assert.False(t, seen, "expired nonces are not reported")
+}
+
+func TestNonceStore_SweepRemovesExpired(t *testing.T) {
+	store, clock := newTestNonceStore(t)
+	ctx := context.Background()
+
+	_, _ = store.CheckAndSet(ctx, "m", "short", time.Minute)
+	_, _ = store.CheckAndSet(ctx, "m", "long", time.Hour)
+
+	clock.Advance(time.Minute)
+	store.sweep()
+
+	assert.Len(t, store.nonces, 1)
+	assert.Contains(t, store.nonces, "m:long")
+}
+
+func TestNonceStore_CheckAndSet_ConcurrentIsAtomic(t *testing.T) {
+	store := NewNonceStore(time.Hour)
+	defer store.Close()
+	ctx := context.Background()
+
+	var accepted atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _ := store.CheckAndSet(ctx, "merchant-1", "same-nonce", time.Minute); ok {
+				accepted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), accepted.Load(), "exactly one concurrent request may use a nonce")
+}
+
+func TestNonceStore_SweeperRunsAndStops(t *testing.T) {
+	store := NewNonceStore(10 * time.Millisecond)
+	_, _ = store.CheckAndSet(context.Background(), "m", "n", time.Millisecond)
+
+	assert.Eventually(t, func() bool {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		return len(store.nonces) == 0
+	}, time.Second, 5*time.Millisecond)
+
+	store.Close()
+	store.Close() // idempotent
+}
@@ -18,12 +18,15 @@ func NewAuditRepository(pool *pgxpool.Pool) ports.AuditRepository {
 return &auditRepo{pool: pool}
 }
 
+// Create inserts the entry. An entry for a request that already has one is
+// dropped, so a request is audited at most once even across instances.
 func (r *auditRepo) Create(ctx context.Context, log *domain.AuditLog) error {
 _, err := r.pool.Exec(ctx,
-`INSERT INTO audit_logs (id, merchant_id, action, resource_type, resource_id, details, ip_address, created_at)
- VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+`INSERT INTO audit_logs (id, merchant_id, action, resource_type, resource_id, details, ip_address, created_at, request_id)
+ VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+ ON CONFLICT (request_id) WHERE request_id IS NOT NULL DO NOTHING`,
 log.ID, log.MerchantID, string(log.Action), log.ResourceType,
-log.ResourceID, log.Details, log.IPAddress, log.CreatedAt,
+log.ResourceID, log.Details, log.IPAddress, log.CreatedAt, nullIfEmpty(log.RequestID),
 )
 return err
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"secure-payment-gateway/internal/core/domain"
 
@@ -22,10 +23,10 @@ func NewIdempotencyRepo(pool Pool) *IdempotencyRepo {
 
 // Create inserts an idempotency log within a database transaction.
 func (r *IdempotencyRepo) Create(ctx context.Context, tx pgx.Tx, log *domain.IdempotencyLog) error {
-	query := `INSERT INTO idempotency_logs (key, transaction_id, response_json, created_at)
-		VALUES ($1, $2, $3, $4)`
+	query := `INSERT INTO idempotency_logs (key, transaction_id, response_json, created_at, request_hash)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''))`
 
-	_, err := tx.Exec(ctx, query, log.Key, log.TransactionID, log.ResponseJSON, log.CreatedAt)
+	_, err := tx.Exec(ctx, query, log.Key, log.TransactionID, log.ResponseJSON, log.CreatedAt, log.RequestHash)
 	if err != nil {
 		return fmt.Errorf("insert idempotency log: %w", err)
 	}
@@ -34,10 +35,10 @@ func (r *IdempotencyRepo) Create(ctx context.Context, tx pgx.Tx, log *domain.Ide
 
 // Get fetches an idempotency log by key.
 func (r *IdempotencyRepo) Get(ctx context.Context, key string) (*domain.IdempotencyLog, error) {
-	query := `SELECT key, transaction_id, response_json, created_at FROM idempotency_logs WHERE key = $1`
+	query := `SELECT key, transaction_id, response_json, created_at, COALESCE(request_hash, '') FROM idempotency_logs WHERE key = $1`
 
 	log := &domain.IdempotencyLog{}
-	err := r.pool.QueryRow(ctx, query, key).Scan(&log.Key, &log.TransactionID, &log.ResponseJSON, &log.CreatedAt)
+	err := r.pool.QueryRow(ctx, query, key).Scan(&log.Key, &log.TransactionID, &log.ResponseJSON, &log.CreatedAt, &log.RequestHash)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil
@@ -46,3 +47,15 @@ func (r *IdempotencyRepo) Get(ctx context.Context, key string) (*domain.Idempote
 	}
 	return log, nil
 }
+
+// DeleteOlderThan removes idempotency logs created before the given time and
+// returns how many were deleted.
+func (r *IdempotencyRepo) DeleteOlderThan(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM idempotency_logs WHERE created_at < $1`
+
+	tag, err := r.pool.Exec(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("delete idempotency logs: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -24,11 +24,12 @@ func TestIdempotencyRepo_Create(t *testing.T) {
 		TransactionID: uuid.New(),
 		ResponseJSON:  []byte(`{"status":"SUCCESS"}`),
 		CreatedAt:     time.Now().UTC().Truncate(time.Microsecond),
+		RequestHash:   "abc123",
 	}
 
 	mock.ExpectBegin()
 	mock.ExpectExec("INSERT INTO idempotency_logs").
-		WithArgs(log.Key, log.TransactionID, log.ResponseJSON, log.CreatedAt).
+		WithArgs(log.Key, log.TransactionID, log.ResponseJSON, log.CreatedAt, log.RequestHash).
 		WillReturnResult(pgxmock.NewResult("INSERT", 1))
 
 	tx, err := mock.Begin(context.Background())
@@ -50,14 +51,15 @@ func TestIdempotencyRepo_Get(t *testing.T) {
 
 	mock.ExpectQuery("SELECT .+ FROM idempotency_logs WHERE key").
 		WithArgs("merchant-id:ORDER-001").
-		WillReturnRows(pgxmock.NewRows([]string{"key", "transaction_id", "response_json", "created_at"}).
-			AddRow("merchant-id:ORDER-001", txID, []byte(`{"status":"SUCCESS"}`), now))
+		WillReturnRows(pgxmock.NewRows([]string{"key", "transaction_id", "response_json", "created_at", "request_hash"}).
+			AddRow("merchant-id:ORDER-001", txID, []byte(`{"status":"SUCCESS"}`), now, "abc123"))
 
 	result, err := repo.Get(context.Background(), "merchant-id:ORDER-001")
 	require.NoError(t, err)
 	require.NotNil(t, result)
 	assert.Equal(t, txID, result.TransactionID)
 	assert.Equal(t, []byte(`{"status":"SUCCESS"}`), result.ResponseJSON)
+	assert.Equal(t, "abc123", result.RequestHash)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -70,10 +72,28 @@ func TestIdempotencyRepo_Get_NotFound(t *testing.T) {
 
 	mock.ExpectQuery("SELECT .+ FROM idempotency_logs WHERE key").
 		WithArgs("nonexistent-key").
-		WillReturnRows(pgxmock.NewRows([]string{"key", "transaction_id", "response_json", "created_at"}))
+		WillReturnRows(pgxmock.NewRows([]string{"key", "transaction_id", "response_json", "created_at", "request_hash"}))
 
 	result, err := repo.Get(context.Background(), "nonexistent-key")
 	assert.NoError(t, err)
 	assert.Nil(t, result)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestIdempotencyRepo_DeleteOlderThan(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewIdempotencyRepo(mock)
+	before := time.Now().UTC().Add(-30 * 24 * time.Hour)
+
+	mock.ExpectExec("DELETE FROM idempotency_logs WHERE created_at < \\$1").
+		WithArgs(before).
+		WillReturnResult(pgxmock.NewResult("DELETE", 7))
+
+	deleted, err := repo.DeleteOlderThan(context.Background(), before)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), deleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"secure-payment-gateway/internal/core/domain"
 
@@ -11,6 +12,10 @@ import (
 	"github.com/jackc/pgx/v5"
 )
 
+// merchantSelectColumns is the column list shared by every merchant SELECT.
+const merchantSelectColumns = `id, username, password_hash, merchant_name, access_key, secret_key_enc, webhook_url, webhook_version, synchronous_webhook, require_idempotency_key, webhook_payload_mode, session_expiry_seconds, notification_preferences, primary_currency, status,
+		last_used_at, last_login_at, secret_rotated_at, created_at, updated_at`
+
 // MerchantRepo implements ports.MerchantRepository.
 type MerchantRepo struct {
 	pool Pool
@@ -21,14 +26,14 @@ func NewMerchantRepo(pool Pool) *MerchantRepo {
 	return &MerchantRepo{pool: pool}
 }
 
-// Create inserts a new merchant into the database.
-func (r *MerchantRepo) Create(ctx context.Context, m *domain.Merchant) error {
-	query := `INSERT INTO merchants (id, username, password_hash, merchant_name, access_key, secret_key_enc, webhook_url, status, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+// Create inserts a new merchant within a transaction.
+func (r *MerchantRepo) Create(ctx context.Context, tx pgx.Tx, m *domain.Merchant) error {
+	query := `INSERT INTO merchants (id, username, password_hash, merchant_name, access_key, secret_key_enc, webhook_url, webhook_version, synchronous_webhook, require_idempotency_key, webhook_payload_mode, session_expiry_seconds, notification_preferences, primary_currency, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)`
 
-	_, err := r.pool.Exec(ctx, query,
+	_, err := tx.Exec(ctx, query,
 		m.ID, m.Username, m.PasswordHash, m.MerchantName,
-		m.AccessKey, m.SecretKeyEnc, m.WebhookURL, m.Status,
+		m.AccessKey, m.SecretKeyEnc, m.WebhookURL, m.WebhookVersion, m.SynchronousWebhook, m.RequireIdempotencyKey, payloadModeOrFull(m.WebhookPayloadMode), m.SessionExpirySeconds, m.NotificationPreferences, m.Currency(), m.Status,
 		m.CreatedAt, m.UpdatedAt,
 	)
 	if err != nil {
@@ -39,74 +44,87 @@ func (r *MerchantRepo) Create(ctx context.Context, m *domain.Merchant) error {
 
 // GetByID fetches a merchant by its UUID.
 func (r *MerchantRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Merchant, error) {
-	query := `SELECT id, username, password_hash, merchant_name, access_key, secret_key_enc, webhook_url, status, created_at, updated_at
+	query := `SELECT ` + merchantSelectColumns + `
 		FROM merchants WHERE id = $1`
 
-	m := &domain.Merchant{}
-	err := r.pool.QueryRow(ctx, query, id).Scan(
-		&m.ID, &m.Username, &m.PasswordHash, &m.MerchantName,
-		&m.AccessKey, &m.SecretKeyEnc, &m.WebhookURL, &m.Status,
-		&m.CreatedAt, &m.UpdatedAt,
-	)
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, nil
-		}
-		return nil, fmt.Errorf("get merchant by id: %w", err)
-	}
-	return m, nil
+	return r.scanMerchant(r.pool.QueryRow(ctx, query, id), "get merchant by id")
 }
 
 // GetByAccessKey fetches a merchant by its public access key.
 func (r *MerchantRepo) GetByAccessKey(ctx context.Context, accessKey string) (*domain.Merchant, error) {
-	query := `SELECT id, username, password_hash, merchant_name, access_key, secret_key_enc, webhook_url, status, created_at, updated_at
+	query := `SELECT ` + merchantSelectColumns + `
 		FROM merchants WHERE access_key = $1`
 
-	m := &domain.Merchant{}
-	err := r.pool.QueryRow(ctx, query, accessKey).Scan(
-		&m.ID, &m.Username, &m.PasswordHash, &m.MerchantName,
-		&m.AccessKey, &m.SecretKeyEnc, &m.WebhookURL, &m.Status,
-		&m.CreatedAt, &m.UpdatedAt,
-	)
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, nil
-		}
-		return nil, fmt.Errorf("get merchant by access_key: %w", err)
-	}
-	return m, nil
+	return r.scanMerchant(r.pool.QueryRow(ctx, query, accessKey), "get merchant by access_key")
 }
 
 // GetByUsername fetches a merchant by username.
 func (r *MerchantRepo) GetByUsername(ctx context.Context, username string) (*domain.Merchant, error) {
-	query := `SELECT id, username, password_hash, merchant_name, access_key, secret_key_enc, webhook_url, status, created_at, updated_at
+	query := `SELECT ` + merchantSelectColumns + `
 		FROM merchants WHERE username = $1`
 
-	m := &domain.Merchant{}
-	err := r.pool.QueryRow(ctx, query, username).Scan(
-		&m.ID, &m.Username, &m.PasswordHash, &m.MerchantName,
-		&m.AccessKey, &m.SecretKeyEnc, &m.WebhookURL, &m.Status,
-		&m.CreatedAt, &m.UpdatedAt,
-	)
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, nil
-		}
-		return nil, fmt.Errorf("get merchant by username: %w", err)
-	}
-	return m, nil
+	return r.scanMerchant(r.pool.QueryRow(ctx, query, username), "get merchant by username")
 }
 
 // Update updates a merchant record.
 func (r *MerchantRepo) Update(ctx context.Context, m *domain.Merchant) error {
 	query := `UPDATE merchants
-		SET merchant_name=$1, webhook_url=$2, access_key=$3, secret_key_enc=$4, status=$5, updated_at=NOW()
-		WHERE id=$6`
+		SET merchant_name=$1, webhook_url=$2, webhook_version=$3, synchronous_webhook=$4, require_idempotency_key=$5, access_key=$6, secret_key_enc=$7, status=$8, secret_rotated_at=$9, webhook_payload_mode=$10, session_expiry_seconds=$11, notification_preferences=$12, updated_at=NOW()
+		WHERE id=$13`
 	_, err := r.pool.Exec(ctx, query,
-		m.MerchantName, m.WebhookURL, m.AccessKey, m.SecretKeyEnc, m.Status, m.ID,
+		m.MerchantName, m.WebhookURL, m.WebhookVersion, m.SynchronousWebhook, m.RequireIdempotencyKey, m.AccessKey, m.SecretKeyEnc, m.Status, m.SecretRotatedAt, payloadModeOrFull(m.WebhookPayloadMode), m.SessionExpirySeconds, m.NotificationPreferences, m.ID,
 	)
 	if err != nil {
 		return fmt.Errorf("update merchant: %w", err)
 	}
 	return nil
 }
+
+// UpdateLastUsedAt records when the merchant's API credentials were last used.
+// The update is monotonic: an older timestamp never overwrites a newer one.
+func (r *MerchantRepo) UpdateLastUsedAt(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	query := `UPDATE merchants SET last_used_at = $1
+		WHERE id = $2 AND (last_used_at IS NULL OR last_used_at < $1)`
+
+	_, err := r.pool.Exec(ctx, query, usedAt, id)
+	if err != nil {
+		return fmt.Errorf("update merchant last_used_at: %w", err)
+	}
+	return nil
+}
+
+// UpdateLastLoginAt records the time of the merchant's latest dashboard login.
+func (r *MerchantRepo) UpdateLastLoginAt(ctx context.Context, id uuid.UUID, loginAt time.Time) error {
+	query := `UPDATE merchants SET last_login_at = $1 WHERE id = $2`
+
+	_, err := r.pool.Exec(ctx, query, loginAt, id)
+	if err != nil {
+		return fmt.Errorf("update merchant last_login_at: %w", err)
+	}
+	return nil
+}
+
+// payloadModeOrFull stores the zero mode as the column default.
+func payloadModeOrFull(mode domain.WebhookPayloadMode) domain.WebhookPayloadMode {
+	if mode == "" {
+		return domain.WebhookPayloadFull
+	}
+	return mode
+}
+
+// scanMerchant is a helper to scan a single row into a Merchant.
+func (r *MerchantRepo) scanMerchant(row pgx.Row, op string) (*domain.Merchant, error) {
+	m := &domain.Merchant{}
+	err := row.Scan(
+		&m.ID, &m.Username, &m.PasswordHash, &m.MerchantName,
+		&m.AccessKey, &m.SecretKeyEnc, &m.WebhookURL, &m.WebhookVersion, &m.SynchronousWebhook, &m.RequireIdempotencyKey, &m.WebhookPayloadMode, &m.SessionExpirySeconds, &m.NotificationPreferences, &m.PrimaryCurrency, &m.Status,
+		&m.LastUsedAt, &m.LastLoginAt, &m.SecretRotatedAt, &m.CreatedAt, &m.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return m, nil
+}
@@ -31,14 +31,14 @@ func newTestMerchant() *domain.Merchant {
 func strPtr(s string) *string { return &s }
 
 func merchantColumns() []string {
-	return []string{"id", "username", "password_hash", "merchant_name", "access_key", "secret_key_enc", "webhook_url", "status", "created_at", "updated_at"}
+	return []string{"id", "username", "password_hash", "merchant_name", "access_key", "secret_key_enc", "webhook_url", "webhook_version", "synchronous_webhook", "require_idempotency_key", "webhook_payload_mode", "session_expiry_seconds", "notification_preferences", "primary_currency", "status", "last_used_at", "last_login_at", "secret_rotated_at", "created_at", "updated_at"}
 }
 
 func merchantRow(m *domain.Merchant) *pgxmock.Rows {
 	return pgxmock.NewRows(merchantColumns()).AddRow(
 		m.ID, m.Username, m.PasswordHash, m.MerchantName,
-		m.AccessKey, m.SecretKeyEnc, m.WebhookURL, m.Status,
-		m.CreatedAt, m.UpdatedAt,
+		m.AccessKey, m.SecretKeyEnc, m.WebhookURL, m.WebhookVersion, m.SynchronousWebhook, m.RequireIdempotencyKey, m.WebhookPayloadMode, m.SessionExpirySeconds, m.NotificationPreferences, m.PrimaryCurrency, m.Status,
+		m.LastUsedAt, m.LastLoginAt, m.SecretRotatedAt, m.CreatedAt, m.UpdatedAt,
 	)
 }
 
@@ -50,13 +50,17 @@ func TestMerchantRepo_Create(t *testing.T) {
 	repo := NewMerchantRepo(mock)
 	m := newTestMerchant()
 
+	mock.ExpectBegin()
 	mock.ExpectExec("INSERT INTO merchants").
 		WithArgs(m.ID, m.Username, m.PasswordHash, m.MerchantName,
-			m.AccessKey, m.SecretKeyEnc, m.WebhookURL, m.Status,
+			m.AccessKey, m.SecretKeyEnc, m.WebhookURL, m.WebhookVersion, m.SynchronousWebhook, m.RequireIdempotencyKey, domain.WebhookPayloadFull, m.SessionExpirySeconds, m.NotificationPreferences, domain.DefaultCurrency, m.Status,
 			m.CreatedAt, m.UpdatedAt).
 		WillReturnResult(pgxmock.NewResult("INSERT", 1))
 
-	err = repo.Create(context.Background(), m)
+	tx, err := mock.Begin(context.Background())
+	require.NoError(t, err)
+
+	err = repo.Create(context.Background(), tx, m)
 	assert.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -136,3 +140,39 @@ func TestMerchantRepo_GetByUsername(t *testing.T) {
 	assert.Equal(t, m.Username, result.Username)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestMerchantRepo_UpdateLastUsedAt(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewMerchantRepo(mock)
+	id := uuid.New()
+	usedAt := time.Now().UTC()
+
+	mock.ExpectExec("UPDATE merchants SET last_used_at").
+		WithArgs(usedAt, id).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	err = repo.UpdateLastUsedAt(context.Background(), id, usedAt)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMerchantRepo_UpdateLastLoginAt(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewMerchantRepo(mock)
+	id := uuid.New()
+	loginAt := time.Now().UTC()
+
+	mock.ExpectExec("UPDATE merchants SET last_login_at").
+		WithArgs(loginAt, id).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	err = repo.UpdateLastLoginAt(context.Background(), id, loginAt)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
 )
 
 // TransactionRepo implements ports.TransactionRepository.
@@ -27,14 +28,16 @@ func NewTransactionRepo(pool Pool) *TransactionRepo {
 // Create inserts a new transaction within a database transaction.
 func (r *TransactionRepo) Create(ctx context.Context, tx pgx.Tx, t *domain.Transaction) error {
 	query := `INSERT INTO transactions (id, reference_id, merchant_id, wallet_id, amount, amount_encrypted,
-		transaction_type, status, signature, client_ip, extra_data, original_transaction_id, created_at, processed_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`
+		transaction_type, status, signature, client_ip, extra_data, original_transaction_id, created_at, processed_at,
+		currency, initiated_by, amount_decimal)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)`
 
 	_, err := tx.Exec(ctx, query,
 		t.ID, t.ReferenceID, t.MerchantID, t.WalletID,
 		t.Amount, t.AmountEncrypted, t.TransactionType, t.Status,
 		t.Signature, t.ClientIP, t.ExtraData, t.OriginalTransactionID,
 		t.CreatedAt, t.ProcessedAt,
+		nullIfEmpty(t.Currency), nullIfEmpty(t.InitiatedBy), t.AmountDecimal,
 	)
 	if err != nil {
 		return fmt.Errorf("insert transaction: %w", err)
@@ -45,17 +48,39 @@ func (r *TransactionRepo) Create(ctx context.Context, tx pgx.Tx, t *domain.Trans
 // GetByID fetches a transaction by UUID.
 func (r *TransactionRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Transaction, error) {
 	query := `SELECT id, reference_id, merchant_id, wallet_id, amount, amount_encrypted,
-		transaction_type, status, signature, client_ip, extra_data, original_transaction_id, created_at, processed_at
+		transaction_type, status, signature, client_ip, extra_data, original_transaction_id, created_at, processed_at,
+		COALESCE(currency, ''), COALESCE(initiated_by, ''), amount_decimal
 		FROM transactions WHERE id = $1`
 
 	return r.scanTransaction(r.pool.QueryRow(ctx, query, id))
 }
 
+// GetByIDForUpdate fetches a transaction by UUID with pessimistic locking.
+// This MUST be called within a transaction.
+func (r *TransactionRepo) GetByIDForUpdate(ctx context.Context, tx pgx.Tx, id uuid.UUID) (*domain.Transaction, error) {
+	query := `SELECT id, reference_id, merchant_id, wallet_id, amount, amount_encrypted,
+		transaction_type, status, signature, client_ip, extra_data, original_transaction_id, created_at, processed_at,
+		COALESCE(currency, ''), COALESCE(initiated_by, ''), amount_decimal
+		FROM transactions WHERE id = $1 FOR UPDATE`
+
+	return r.scanTransaction(tx.QueryRow(ctx, query, id))
+}
+
 // GetByReference fetches a transaction by merchant ID and reference ID.
-func (r *TransactionRepo) GetByReference(ctx context.Context, merchantID uuid.UUID, referenceID string) (*domain.Transaction, error) {
+// References are unique per operation type only, so when several
+// transactions share one the payment wins, then the oldest (the newest with
+// newestFirst, for references reused daily).
+func (r *TransactionRepo) GetByReference(ctx context.Context, merchantID uuid.UUID, referenceID string, newestFirst bool) (*domain.Transaction, error) {
+	order := "created_at"
+	if newestFirst {
+		order = "created_at DESC"
+	}
 	query := `SELECT id, reference_id, merchant_id, wallet_id, amount, amount_encrypted,
-		transaction_type, status, signature, client_ip, extra_data, original_transaction_id, created_at, processed_at
-		FROM transactions WHERE merchant_id = $1 AND reference_id = $2`
+		transaction_type, status, signature, client_ip, extra_data, original_transaction_id, created_at, processed_at,
+		COALESCE(currency, ''), COALESCE(initiated_by, ''), amount_decimal
+		FROM transactions WHERE merchant_id = $1 AND reference_id = $2
+		ORDER BY (transaction_type = 'PAYMENT') DESC, ` + order + `
+		LIMIT 1`
 
 	return r.scanTransaction(r.pool.QueryRow(ctx, query, merchantID, referenceID))
 }
@@ -87,8 +112,115 @@ func (r *TransactionRepo) CheckRefundExists(ctx context.Context, originalTxID uu
 	return exists, nil
 }
 
+// CountRefunds returns how many refunds that have not FAILED were made
+// against a transaction.
+func (r *TransactionRepo) CountRefunds(ctx context.Context, originalTxID uuid.UUID) (int64, error) {
+	query := `SELECT COUNT(*) FROM transactions
+		WHERE original_transaction_id = $1 AND transaction_type = 'REFUND' AND status != 'FAILED'`
+
+	var count int64
+	err := r.pool.QueryRow(ctx, query, originalTxID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("count refunds: %w", err)
+	}
+	return count, nil
+}
+
+// SumRefunds returns the total refunded so far against a transaction,
+// counting every refund that has not FAILED. A fractional refund counts at
+// its exact amount.
+func (r *TransactionRepo) SumRefunds(ctx context.Context, originalTxID uuid.UUID) (decimal.Decimal, error) {
+	query := `SELECT COALESCE(SUM(COALESCE(amount_decimal, amount)), 0) FROM transactions
+		WHERE original_transaction_id = $1 AND transaction_type = 'REFUND' AND status != 'FAILED'`
+
+	var total decimal.Decimal
+	err := r.pool.QueryRow(ctx, query, originalTxID).Scan(&total)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("sum refunds: %w", err)
+	}
+	return total, nil
+}
+
+// SumTopupsSince returns the total of successful topups into a wallet since
+// the given time. A fractional topup counts at its exact amount.
+func (r *TransactionRepo) SumTopupsSince(ctx context.Context, walletID uuid.UUID, since time.Time) (decimal.Decimal, error) {
+	query := `SELECT COALESCE(SUM(COALESCE(amount_decimal, amount)), 0) FROM transactions
+		WHERE wallet_id = $1 AND transaction_type = 'TOPUP' AND status = 'SUCCESS' AND created_at >= $2`
+
+	var total decimal.Decimal
+	err := r.pool.QueryRow(ctx, query, walletID, since).Scan(&total)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("sum topups: %w", err)
+	}
+	return total, nil
+}
+
+// CountTodayForUpdate returns how many payments a merchant has made since
+// midnight UTC, whatever their current status. A transaction-scoped advisory
+// lock on the merchant serialises concurrent counters, so two payments in
+// different currencies cannot both see room under the daily limit. This
+// MUST be called within a transaction, before any wallet is locked.
+func (r *TransactionRepo) CountTodayForUpdate(ctx context.Context, tx pgx.Tx, merchantID uuid.UUID) (int64, error) {
+	lockKey := "daily-payments:" + merchantID.String()
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, lockKey); err != nil {
+		return 0, fmt.Errorf("lock daily payment count: %w", err)
+	}
+
+	query := `SELECT COUNT(*) FROM transactions
+		WHERE merchant_id = $1 AND transaction_type = 'PAYMENT' AND created_at >= $2`
+
+	var count int64
+	err := tx.QueryRow(ctx, query, merchantID, utcDayStart(time.Now())).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("count today's payments: %w", err)
+	}
+	return count, nil
+}
+
+// utcDayStart returns midnight UTC of t's UTC day.
+func utcDayStart(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// transactionSortColumns maps the allowed sort fields to SQL columns. Only
+// values from this map are ever interpolated into ORDER BY.
+var transactionSortColumns = map[string]string{
+	"created_at": "created_at",
+	"amount":     "amount",
+}
+
+// orderByClause builds the ORDER BY clause for params, defaulting to newest
+// first. id breaks ties so pages are stable.
+func orderByClause(params ports.TransactionListParams) (string, error) {
+	sortBy := params.SortBy
+	if sortBy == "" {
+		sortBy = "created_at"
+	}
+	column, ok := transactionSortColumns[sortBy]
+	if !ok {
+		return "", fmt.Errorf("unsupported sort column %q", params.SortBy)
+	}
+
+	var dir string
+	switch params.SortDir {
+	case "", ports.SortDesc:
+		dir = "DESC"
+	case ports.SortAsc:
+		dir = "ASC"
+	default:
+		return "", fmt.Errorf("unsupported sort direction %q", params.SortDir)
+	}
+	return fmt.Sprintf("ORDER BY %s %s, id %s", column, dir, dir), nil
+}
+
 // List fetches transactions with filtering and pagination.
 func (r *TransactionRepo) List(ctx context.Context, params ports.TransactionListParams) ([]domain.Transaction, int64, error) {
+	orderBy, err := orderByClause(params)
+	if err != nil {
+		return nil, 0, err
+	}
+
 	var conditions []string
 	var args []any
 	argIdx := 1
@@ -120,20 +252,26 @@ func (r *TransactionRepo) List(ctx context.Context, params ports.TransactionList
 
 	where := "WHERE " + strings.Join(conditions, " AND ")
 
-	// Count total
-	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM transactions %s", where)
+	// Count total, unless the caller only needs to know if a next page exists
 	var total int64
-	err := r.pool.QueryRow(ctx, countQuery, args...).Scan(&total)
-	if err != nil {
-		return nil, 0, fmt.Errorf("count transactions: %w", err)
+	limit := params.PageSize
+	if params.SkipTotal {
+		limit++
+	} else {
+		countQuery := fmt.Sprintf("SELECT COUNT(*) FROM transactions %s", where)
+		err = r.pool.QueryRow(ctx, countQuery, args...).Scan(&total)
+		if err != nil {
+			return nil, 0, fmt.Errorf("count transactions: %w", err)
+		}
 	}
 
 	// Fetch page
 	offset := (params.Page - 1) * params.PageSize
 	dataQuery := fmt.Sprintf(`SELECT id, reference_id, merchant_id, wallet_id, amount, amount_encrypted,
-		transaction_type, status, signature, client_ip, extra_data, original_transaction_id, created_at, processed_at
-		FROM transactions %s ORDER BY created_at DESC LIMIT $%d OFFSET $%d`, where, argIdx, argIdx+1)
-	args = append(args, params.PageSize, offset)
+		transaction_type, status, signature, client_ip, extra_data, original_transaction_id, created_at, processed_at,
+		COALESCE(currency, ''), COALESCE(initiated_by, ''), amount_decimal
+		FROM transactions %s %s LIMIT $%d OFFSET $%d`, where, orderBy, argIdx, argIdx+1)
+	args = append(args, limit, offset)
 
 	rows, err := r.pool.Query(ctx, dataQuery, args...)
 	if err != nil {
@@ -149,6 +287,7 @@ func (r *TransactionRepo) List(ctx context.Context, params ports.TransactionList
 			&t.Amount, &t.AmountEncrypted, &t.TransactionType, &t.Status,
 			&t.Signature, &t.ClientIP, &t.ExtraData, &t.OriginalTransactionID,
 			&t.CreatedAt, &t.ProcessedAt,
+			&t.Currency, &t.InitiatedBy, &t.AmountDecimal,
 		)
 		if err != nil {
 			return nil, 0, fmt.Errorf("scan transaction row: %w", err)
@@ -180,9 +319,9 @@ func (r *TransactionRepo) GetStats(ctx context.Context, merchantID uuid.UUID, pe
 		COUNT(*) FILTER (WHERE status = 'SUCCESS') AS successful,
 		COUNT(*) FILTER (WHERE status = 'FAILED') AS failed,
 		COUNT(*) FILTER (WHERE status = 'REVERSED') AS reversed,
-		COALESCE(SUM(amount) FILTER (WHERE transaction_type = 'PAYMENT' AND status = 'SUCCESS'), 0) AS revenue,
-		COALESCE(SUM(amount) FILTER (WHERE transaction_type = 'REFUND' AND status = 'SUCCESS'), 0) AS refunded,
-		COALESCE(SUM(amount) FILTER (WHERE transaction_type = 'TOPUP' AND status = 'SUCCESS'), 0) AS topup
+		COALESCE(SUM(COALESCE(amount_decimal, amount)) FILTER (WHERE transaction_type = 'PAYMENT' AND status = 'SUCCESS'), 0) AS revenue,
+		COALESCE(SUM(COALESCE(amount_decimal, amount)) FILTER (WHERE transaction_type = 'REFUND' AND status = 'SUCCESS'), 0) AS refunded,
+		COALESCE(SUM(COALESCE(amount_decimal, amount)) FILTER (WHERE transaction_type = 'TOPUP' AND status = 'SUCCESS'), 0) AS topup
 		FROM transactions WHERE %s`, condition)
 
 	stats := &ports.TransactionStats{}
@@ -196,6 +335,14 @@ func (r *TransactionRepo) GetStats(ctx context.Context, merchantID uuid.UUID, pe
 	return stats, nil
 }
 
+// nullIfEmpty stores an empty string as NULL.
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
 // scanTransaction is a helper to scan a single row into a Transaction.
 func (r *TransactionRepo) scanTransaction(row pgx.Row) (*domain.Transaction, error) {
 	t := &domain.Transaction{}
@@ -204,6 +351,7 @@ func (r *TransactionRepo) scanTransaction(row pgx.Row) (*domain.Transaction, err
 		&t.Amount, &t.AmountEncrypted, &t.TransactionType, &t.Status,
 		&t.Signature, &t.ClientIP, &t.ExtraData, &t.OriginalTransactionID,
 		&t.CreatedAt, &t.ProcessedAt,
+		&t.Currency, &t.InitiatedBy, &t.AmountDecimal,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -2,13 +2,16 @@ package postgres
 
 import (
 	"context"
+	"regexp"
 	"testing"
 	"time"
 
 	"secure-payment-gateway/internal/core/domain"
+	"secure-payment-gateway/internal/core/ports"
 
 	"github.com/google/uuid"
 	"github.com/pashagolub/pgxmock/v4"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -30,13 +33,15 @@ func newTestTransaction(merchantID, walletID uuid.UUID) *domain.Transaction {
 		OriginalTransactionID: nil,
 		CreatedAt:             now,
 		ProcessedAt:           &now,
+		Currency:              "VND",
+		InitiatedBy:           "ak_test_1234",
 	}
 }
 
 func txColumns() []string {
 	return []string{"id", "reference_id", "merchant_id", "wallet_id", "amount", "amount_encrypted",
 		"transaction_type", "status", "signature", "client_ip", "extra_data", "original_transaction_id",
-		"created_at", "processed_at"}
+		"created_at", "processed_at", "currency", "initiated_by", "amount_decimal"}
 }
 
 func txRow(t *domain.Transaction) *pgxmock.Rows {
@@ -44,7 +49,7 @@ func txRow(t *domain.Transaction) *pgxmock.Rows {
 		t.ID, t.ReferenceID, t.MerchantID, t.WalletID,
 		t.Amount, t.AmountEncrypted, t.TransactionType, t.Status,
 		t.Signature, t.ClientIP, t.ExtraData, t.OriginalTransactionID,
-		t.CreatedAt, t.ProcessedAt,
+		t.CreatedAt, t.ProcessedAt, t.Currency, t.InitiatedBy, t.AmountDecimal,
 	)
 }
 
@@ -63,6 +68,7 @@ func TestTransactionRepo_Create(t *testing.T) {
 			txn.Amount, txn.AmountEncrypted, txn.TransactionType, txn.Status,
 			txn.Signature, txn.ClientIP, txn.ExtraData, txn.OriginalTransactionID,
 			txn.CreatedAt, txn.ProcessedAt,
+			strPtr("VND"), strPtr("ak_test_1234"), txn.AmountDecimal,
 		).
 		WillReturnResult(pgxmock.NewResult("INSERT", 1))
 
@@ -92,6 +98,28 @@ func TestTransactionRepo_GetByID(t *testing.T) {
 	assert.Equal(t, txn.ID, result.ID)
 	assert.Equal(t, txn.ReferenceID, result.ReferenceID)
 	assert.Equal(t, txn.Amount, result.Amount)
+	assert.Equal(t, "ak_test_1234", result.InitiatedBy)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransactionRepo_GetByID_DecimalAmount(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewTransactionRepo(mock)
+	txn := newTestTransaction(uuid.New(), uuid.New())
+	exact := decimal.RequireFromString("0.000000017")
+	txn.Amount, txn.AmountDecimal = 0, &exact
+
+	mock.ExpectQuery(regexp.QuoteMeta("COALESCE(initiated_by, ''), amount_decimal")).
+		WithArgs(txn.ID).
+		WillReturnRows(txRow(txn))
+
+	result, err := repo.GetByID(context.Background(), txn.ID)
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, "0.000000017", result.ExactAmount().String())
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -112,6 +140,29 @@ func TestTransactionRepo_GetByID_NotFound(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestTransactionRepo_GetByIDForUpdate(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewTransactionRepo(mock)
+	txn := newTestTransaction(uuid.New(), uuid.New())
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT .+ FROM transactions WHERE id .+ FOR UPDATE").
+		WithArgs(txn.ID).
+		WillReturnRows(txRow(txn))
+
+	dbTx, err := mock.Begin(context.Background())
+	require.NoError(t, err)
+
+	result, err := repo.GetByIDForUpdate(context.Background(), dbTx, txn.ID)
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, txn.ID, result.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestTransactionRepo_GetByReference(t *testing.T) {
 	mock, err := pgxmock.NewPool()
 	require.NoError(t, err)
@@ -120,17 +171,34 @@ func TestTransactionRepo_GetByReference(t *testing.T) {
 	repo := NewTransactionRepo(mock)
 	txn := newTestTransaction(uuid.New(), uuid.New())
 
-	mock.ExpectQuery("SELECT .+ FROM transactions WHERE merchant_id .+ AND reference_id").
+	mock.ExpectQuery(`SELECT .+ FROM transactions WHERE merchant_id .+ AND reference_id .+ ORDER BY \(transaction_type = 'PAYMENT'\) DESC, created_at\s+LIMIT`).
 		WithArgs(txn.MerchantID, txn.ReferenceID).
 		WillReturnRows(txRow(txn))
 
-	result, err := repo.GetByReference(context.Background(), txn.MerchantID, txn.ReferenceID)
+	result, err := repo.GetByReference(context.Background(), txn.MerchantID, txn.ReferenceID, false)
 	require.NoError(t, err)
 	require.NotNil(t, result)
 	assert.Equal(t, txn.ReferenceID, result.ReferenceID)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestTransactionRepo_GetByReference_NewestFirst(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewTransactionRepo(mock)
+	txn := newTestTransaction(uuid.New(), uuid.New())
+
+	mock.ExpectQuery(`ORDER BY \(transaction_type = 'PAYMENT'\) DESC, created_at DESC`).
+		WithArgs(txn.MerchantID, txn.ReferenceID).
+		WillReturnRows(txRow(txn))
+
+	_, err = repo.GetByReference(context.Background(), txn.MerchantID, txn.ReferenceID, true)
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestTransactionRepo_UpdateStatus(t *testing.T) {
 	mock, err := pgxmock.NewPool()
 	require.NoError(t, err)
@@ -188,6 +256,86 @@ func TestTransactionRepo_CheckRefundExists_True(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestTransactionRepo_CountRefunds(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewTransactionRepo(mock)
+	origID := uuid.New()
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM transactions\s+WHERE original_transaction_id = \$1 AND transaction_type = 'REFUND' AND status != 'FAILED'`).
+		WithArgs(origID).
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int64(2)))
+
+	count, err := repo.CountRefunds(context.Background(), origID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransactionRepo_SumRefunds(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewTransactionRepo(mock)
+	origID := uuid.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE original_transaction_id = $1 AND transaction_type = 'REFUND' AND status != 'FAILED'")).
+		WithArgs(origID).
+		WillReturnRows(pgxmock.NewRows([]string{"sum"}).AddRow(decimal.RequireFromString("45000.25")))
+
+	total, err := repo.SumRefunds(context.Background(), origID)
+	assert.NoError(t, err)
+	assert.Equal(t, "45000.25", total.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransactionRepo_SumTopupsSince(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewTransactionRepo(mock)
+	walletID := uuid.New()
+	since := time.Now().UTC().Truncate(24 * time.Hour)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(SUM(COALESCE(amount_decimal, amount)), 0) FROM transactions")).
+		WithArgs(walletID, since).
+		WillReturnRows(pgxmock.NewRows([]string{"sum"}).AddRow(decimal.RequireFromString("750000.5")))
+
+	total, err := repo.SumTopupsSince(context.Background(), walletID, since)
+	assert.NoError(t, err)
+	assert.Equal(t, "750000.5", total.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransactionRepo_CountTodayForUpdate(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewTransactionRepo(mock)
+	merchantID := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("pg_advisory_xact_lock").
+		WithArgs("daily-payments:" + merchantID.String()).
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM transactions\\s+WHERE merchant_id = \\$1 AND transaction_type = 'PAYMENT'").
+		WithArgs(merchantID, utcDayStart(time.Now())).
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int64(42)))
+
+	tx, err := mock.Begin(context.Background())
+	require.NoError(t, err)
+
+	count, err := repo.CountTodayForUpdate(context.Background(), tx, merchantID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), count)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestTransactionRepo_GetStats(t *testing.T) {
 	mock, err := pgxmock.NewPool()
 	require.NoError(t, err)
@@ -196,11 +344,12 @@ func TestTransactionRepo_GetStats(t *testing.T) {
 	repo := NewTransactionRepo(mock)
 	merchantID := uuid.New()
 
-	mock.ExpectQuery("SELECT .+ FROM transactions WHERE merchant_id").
+	mock.ExpectQuery(`SELECT .+COALESCE\(SUM\(COALESCE\(amount_decimal, amount\)\) FILTER .+ FROM transactions WHERE merchant_id`).
 		WithArgs(merchantID).
 		WillReturnRows(pgxmock.NewRows(
 			[]string{"total", "successful", "failed", "reversed", "revenue", "refunded", "topup"},
-		).AddRow(int64(100), int64(80), int64(15), int64(5), int64(5000000), int64(200000), int64(1000000)))
+		).AddRow(int64(100), int64(80), int64(15), int64(5),
+			decimal.RequireFromString("5000000.25"), decimal.NewFromInt(200000), decimal.NewFromInt(1000000)))
 
 	stats, err := repo.GetStats(context.Background(), merchantID, nil)
 	require.NoError(t, err)
@@ -209,6 +358,89 @@ func TestTransactionRepo_GetStats(t *testing.T) {
 	assert.Equal(t, int64(80), stats.Successful)
 	assert.Equal(t, int64(15), stats.Failed)
 	assert.Equal(t, int64(5), stats.Reversed)
-	assert.Equal(t, int64(5000000), stats.TotalRevenue)
+	assert.Equal(t, "5000000.25", stats.TotalRevenue.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransactionRepo_List_Sort(t *testing.T) {
+	tests := []struct {
+		sortBy, sortDir string
+		wantOrder       string
+	}{
+		{"", "", "ORDER BY created_at DESC, id DESC"},
+		{"created_at", "asc", "ORDER BY created_at ASC, id ASC"},
+		{"created_at", "desc", "ORDER BY created_at DESC, id DESC"},
+		{"amount", "asc", "ORDER BY amount ASC, id ASC"},
+		{"amount", "", "ORDER BY amount DESC, id DESC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sortBy+"_"+tt.sortDir, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			require.NoError(t, err)
+			defer mock.Close()
+
+			repo := NewTransactionRepo(mock)
+			merchantID := uuid.New()
+			txn := newTestTransaction(merchantID, uuid.New())
+
+			mock.ExpectQuery("SELECT COUNT").
+				WithArgs(merchantID).
+				WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int64(1)))
+			mock.ExpectQuery(regexp.QuoteMeta(tt.wantOrder+" LIMIT")).
+				WithArgs(merchantID, 20, 0).
+				WillReturnRows(txRow(txn))
+
+			txns, total, err := repo.List(context.Background(), ports.TransactionListParams{
+				MerchantID: merchantID, Page: 1, PageSize: 20,
+				SortBy: tt.sortBy, SortDir: tt.sortDir,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), total)
+			assert.Len(t, txns, 1)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestTransactionRepo_List_SkipTotal(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewTransactionRepo(mock)
+	merchantID := uuid.New()
+	txn := newTestTransaction(merchantID, uuid.New())
+
+	// No COUNT query; one row beyond the page shows whether a next page exists
+	mock.ExpectQuery(regexp.QuoteMeta("FROM transactions WHERE merchant_id = $1 ORDER BY created_at DESC, id DESC LIMIT")).
+		WithArgs(merchantID, 21, 20).
+		WillReturnRows(txRow(txn))
+
+	txns, total, err := repo.List(context.Background(), ports.TransactionListParams{
+		MerchantID: merchantID, Page: 2, PageSize: 20, SkipTotal: true,
+	})
+	require.NoError(t, err)
+	assert.Zero(t, total)
+	assert.Len(t, txns, 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransactionRepo_List_RejectsDisallowedSort(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewTransactionRepo(mock)
+	for _, params := range []ports.TransactionListParams{
+		{SortBy: "signature"},
+		{SortBy: "amount; DROP TABLE transactions"},
+		{SortBy: "amount", SortDir: "asc, id"},
+	} {
+		params.MerchantID, params.Page, params.PageSize = uuid.New(), 1, 20
+		_, _, err := repo.List(context.Background(), params)
+		assert.Error(t, err)
+	}
+	// Rejected before any query is sent
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -9,8 +9,12 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
+// walletCurrencyConstraint enforces one wallet per (merchant_id, currency).
+const walletCurrencyConstraint = "uq_wallets_merchant_currency"
+
 // WalletRepo implements ports.WalletRepository.
 type WalletRepo struct {
 	pool Pool
@@ -23,27 +27,37 @@ func NewWalletRepo(pool Pool) *WalletRepo {
 
 // Create inserts a new wallet into the database.
 func (r *WalletRepo) Create(ctx context.Context, w *domain.Wallet) error {
-	query := `INSERT INTO wallets (id, merchant_id, currency, encrypted_balance, last_audit_hash, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	query := `INSERT INTO wallets (id, merchant_id, currency, encrypted_balance, decimal_balance, last_audit_hash, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
 
 	_, err := r.pool.Exec(ctx, query,
-		w.ID, w.MerchantID, w.Currency, w.EncryptedBalance,
+		w.ID, w.MerchantID, w.Currency, w.EncryptedBalance, w.DecimalBalance,
 		w.LastAuditHash, w.CreatedAt, w.UpdatedAt,
 	)
 	if err != nil {
-		return fmt.Errorf("insert wallet: %w", err)
+		return insertWalletError(w, err)
 	}
 	return nil
 }
 
+// insertWalletError maps a unique violation on (merchant_id, currency) to
+// domain.ErrWalletExists.
+func insertWalletError(w *domain.Wallet, err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == walletCurrencyConstraint {
+		return fmt.Errorf("%w: merchant %s, currency %s", domain.ErrWalletExists, w.MerchantID, w.Currency)
+	}
+	return fmt.Errorf("insert wallet: %w", err)
+}
+
 // GetByID fetches a wallet by its UUID (without locking).
 func (r *WalletRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Wallet, error) {
-	query := `SELECT id, merchant_id, currency, encrypted_balance, last_audit_hash, created_at, updated_at
+	query := `SELECT id, merchant_id, currency, encrypted_balance, decimal_balance, last_audit_hash, created_at, updated_at
 		FROM wallets WHERE id = $1`
 
 	w := &domain.Wallet{}
 	err := r.pool.QueryRow(ctx, query, id).Scan(
-		&w.ID, &w.MerchantID, &w.Currency, &w.EncryptedBalance,
+		&w.ID, &w.MerchantID, &w.Currency, &w.EncryptedBalance, &w.DecimalBalance,
 		&w.LastAuditHash, &w.CreatedAt, &w.UpdatedAt,
 	)
 	if err != nil {
@@ -57,12 +71,12 @@ func (r *WalletRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Wallet,
 
 // GetByMerchantID fetches a wallet by merchant ID and currency (non-locking read).
 func (r *WalletRepo) GetByMerchantID(ctx context.Context, merchantID uuid.UUID, currency string) (*domain.Wallet, error) {
-	query := `SELECT id, merchant_id, currency, encrypted_balance, last_audit_hash, created_at, updated_at
+	query := `SELECT id, merchant_id, currency, encrypted_balance, decimal_balance, last_audit_hash, created_at, updated_at
 		FROM wallets WHERE merchant_id = $1 AND currency = $2`
 
 	w := &domain.Wallet{}
 	err := r.pool.QueryRow(ctx, query, merchantID, currency).Scan(
-		&w.ID, &w.MerchantID, &w.Currency, &w.EncryptedBalance,
+		&w.ID, &w.MerchantID, &w.Currency, &w.EncryptedBalance, &w.DecimalBalance,
 		&w.LastAuditHash, &w.CreatedAt, &w.UpdatedAt,
 	)
 	if err != nil {
@@ -77,12 +91,12 @@ func (r *WalletRepo) GetByMerchantID(ctx context.Context, merchantID uuid.UUID,
 // GetByMerchantIDForUpdate fetches a wallet by merchant ID and currency with pessimistic locking.
 // This MUST be called within a transaction.
 func (r *WalletRepo) GetByMerchantIDForUpdate(ctx context.Context, tx pgx.Tx, merchantID uuid.UUID, currency string) (*domain.Wallet, error) {
-	query := `SELECT id, merchant_id, currency, encrypted_balance, last_audit_hash, created_at, updated_at
+	query := `SELECT id, merchant_id, currency, encrypted_balance, decimal_balance, last_audit_hash, created_at, updated_at
 		FROM wallets WHERE merchant_id = $1 AND currency = $2 FOR UPDATE`
 
 	w := &domain.Wallet{}
 	err := tx.QueryRow(ctx, query, merchantID, currency).Scan(
-		&w.ID, &w.MerchantID, &w.Currency, &w.EncryptedBalance,
+		&w.ID, &w.MerchantID, &w.Currency, &w.EncryptedBalance, &w.DecimalBalance,
 		&w.LastAuditHash, &w.CreatedAt, &w.UpdatedAt,
 	)
 	if err != nil {
@@ -97,12 +111,12 @@ func (r *WalletRepo) GetByMerchantIDForUpdate(ctx context.Context, tx pgx.Tx, me
 // GetByIDForUpdate fetches a wallet by ID with pessimistic locking.
 // This MUST be called within a transaction.
 func (r *WalletRepo) GetByIDForUpdate(ctx context.Context, tx pgx.Tx, id uuid.UUID) (*domain.Wallet, error) {
-	query := `SELECT id, merchant_id, currency, encrypted_balance, last_audit_hash, created_at, updated_at
+	query := `SELECT id, merchant_id, currency, encrypted_balance, decimal_balance, last_audit_hash, created_at, updated_at
 		FROM wallets WHERE id = $1 FOR UPDATE`
 
 	w := &domain.Wallet{}
 	err := tx.QueryRow(ctx, query, id).Scan(
-		&w.ID, &w.MerchantID, &w.Currency, &w.EncryptedBalance,
+		&w.ID, &w.MerchantID, &w.Currency, &w.EncryptedBalance, &w.DecimalBalance,
 		&w.LastAuditHash, &w.CreatedAt, &w.UpdatedAt,
 	)
 	if err != nil {
@@ -114,6 +128,84 @@ func (r *WalletRepo) GetByIDForUpdate(ctx context.Context, tx pgx.Tx, id uuid.UU
 	return w, nil
 }
 
+// ListByMerchantID fetches all of a merchant's wallets, ordered by currency.
+func (r *WalletRepo) ListByMerchantID(ctx context.Context, merchantID uuid.UUID) ([]domain.Wallet, error) {
+	query := `SELECT id, merchant_id, currency, encrypted_balance, decimal_balance, last_audit_hash, created_at, updated_at
+		FROM wallets WHERE merchant_id = $1 ORDER BY currency`
+
+	rows, err := r.pool.Query(ctx, query, merchantID)
+	if err != nil {
+		return nil, fmt.Errorf("list wallets: %w", err)
+	}
+	defer rows.Close()
+
+	var wallets []domain.Wallet
+	for rows.Next() {
+		w := domain.Wallet{}
+		err := rows.Scan(
+			&w.ID, &w.MerchantID, &w.Currency, &w.EncryptedBalance, &w.DecimalBalance,
+			&w.LastAuditHash, &w.CreatedAt, &w.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan wallet row: %w", err)
+		}
+		wallets = append(wallets, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate wallet rows: %w", err)
+	}
+	return wallets, nil
+}
+
+// LockForUpdate locks the wallets with the given IDs one at a time in
+// domain.WalletLockOrder, regardless of argument order, and returns them by
+// ID. Missing wallets are absent from the result. This MUST be called within
+// a transaction.
+func (r *WalletRepo) LockForUpdate(ctx context.Context, tx pgx.Tx, ids ...uuid.UUID) (map[uuid.UUID]*domain.Wallet, error) {
+	wallets := make(map[uuid.UUID]*domain.Wallet, len(ids))
+	for _, id := range domain.WalletLockOrder(ids...) {
+		w, err := r.GetByIDForUpdate(ctx, tx, id)
+		if err != nil {
+			return nil, err
+		}
+		if w != nil {
+			wallets[id] = w
+		}
+	}
+	return wallets, nil
+}
+
+// GetOrCreateForUpdate returns the merchant's wallet in w.Currency locked
+// for update, inserting w if none exists. A transaction-scoped advisory lock
+// on (merchant, currency) serialises concurrent creators, so two first
+// topups cannot both insert a wallet. This MUST be called within a
+// transaction.
+func (r *WalletRepo) GetOrCreateForUpdate(ctx context.Context, tx pgx.Tx, w *domain.Wallet) (*domain.Wallet, error) {
+	lockKey := w.MerchantID.String() + ":" + w.Currency
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, lockKey); err != nil {
+		return nil, fmt.Errorf("lock wallet creation: %w", err)
+	}
+
+	existing, err := r.GetByMerchantIDForUpdate(ctx, tx, w.MerchantID, w.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return existing, nil
+	}
+
+	query := `INSERT INTO wallets (id, merchant_id, currency, encrypted_balance, decimal_balance, last_audit_hash, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err = tx.Exec(ctx, query,
+		w.ID, w.MerchantID, w.Currency, w.EncryptedBalance, w.DecimalBalance,
+		w.LastAuditHash, w.CreatedAt, w.UpdatedAt,
+	)
+	if err != nil {
+		return nil, insertWalletError(w, err)
+	}
+	return w, nil
+}
+
 // UpdateBalance updates a wallet's encrypted balance within a transaction.
 func (r *WalletRepo) UpdateBalance(ctx context.Context, tx pgx.Tx, walletID uuid.UUID, encryptedBalance string) error {
 	query := `UPDATE wallets SET encrypted_balance = $1, updated_at = NOW() WHERE id = $2`
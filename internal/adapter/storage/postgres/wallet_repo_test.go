@@ -8,6 +8,8 @@ import (
 	"secure-payment-gateway/internal/core/domain"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/pashagolub/pgxmock/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -26,12 +28,12 @@ func newTestWallet(merchantID uuid.UUID) *domain.Wallet {
 }
 
 func walletColumns() []string {
-	return []string{"id", "merchant_id", "currency", "encrypted_balance", "last_audit_hash", "created_at", "updated_at"}
+	return []string{"id", "merchant_id", "currency", "encrypted_balance", "decimal_balance", "last_audit_hash", "created_at", "updated_at"}
 }
 
 func walletRow(w *domain.Wallet) *pgxmock.Rows {
 	return pgxmock.NewRows(walletColumns()).AddRow(
-		w.ID, w.MerchantID, w.Currency, w.EncryptedBalance,
+		w.ID, w.MerchantID, w.Currency, w.EncryptedBalance, w.DecimalBalance,
 		w.LastAuditHash, w.CreatedAt, w.UpdatedAt,
 	)
 }
@@ -45,7 +47,7 @@ func TestWalletRepo_Create(t *testing.T) {
 	w := newTestWallet(uuid.New())
 
 	mock.ExpectExec("INSERT INTO wallets").
-		WithArgs(w.ID, w.MerchantID, w.Currency, w.EncryptedBalance,
+		WithArgs(w.ID, w.MerchantID, w.Currency, w.EncryptedBalance, w.DecimalBalance,
 			w.LastAuditHash, w.CreatedAt, w.UpdatedAt).
 		WillReturnResult(pgxmock.NewResult("INSERT", 1))
 
@@ -54,6 +56,68 @@ func TestWalletRepo_Create(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestWalletRepo_ListByMerchantID(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewWalletRepo(mock)
+	merchantID := uuid.New()
+	vnd := newTestWallet(merchantID)
+	usd := newTestWallet(merchantID)
+	usd.Currency = "USD"
+
+	mock.ExpectQuery("SELECT .+ FROM wallets WHERE merchant_id = \\$1 ORDER BY currency").
+		WithArgs(merchantID).
+		WillReturnRows(pgxmock.NewRows(walletColumns()).
+			AddRow(usd.ID, usd.MerchantID, usd.Currency, usd.EncryptedBalance, usd.DecimalBalance, usd.LastAuditHash, usd.CreatedAt, usd.UpdatedAt).
+			AddRow(vnd.ID, vnd.MerchantID, vnd.Currency, vnd.EncryptedBalance, vnd.DecimalBalance, vnd.LastAuditHash, vnd.CreatedAt, vnd.UpdatedAt))
+
+	wallets, err := repo.ListByMerchantID(context.Background(), merchantID)
+	require.NoError(t, err)
+	require.Len(t, wallets, 2)
+	assert.Equal(t, "USD", wallets[0].Currency)
+	assert.Equal(t, vnd.ID, wallets[1].ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWalletRepo_Create_DuplicateCurrency(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewWalletRepo(mock)
+	w := newTestWallet(uuid.New())
+
+	mock.ExpectExec("INSERT INTO wallets").
+		WithArgs(w.ID, w.MerchantID, w.Currency, w.EncryptedBalance, w.DecimalBalance,
+			w.LastAuditHash, w.CreatedAt, w.UpdatedAt).
+		WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "uq_wallets_merchant_currency"})
+
+	err = repo.Create(context.Background(), w)
+	assert.ErrorIs(t, err, domain.ErrWalletExists)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWalletRepo_Create_OtherUniqueViolation(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewWalletRepo(mock)
+	w := newTestWallet(uuid.New())
+
+	mock.ExpectExec("INSERT INTO wallets").
+		WithArgs(w.ID, w.MerchantID, w.Currency, w.EncryptedBalance, w.DecimalBalance,
+			w.LastAuditHash, w.CreatedAt, w.UpdatedAt).
+		WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "wallets_pkey"})
+
+	err = repo.Create(context.Background(), w)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, domain.ErrWalletExists)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestWalletRepo_GetByID(t *testing.T) {
 	mock, err := pgxmock.NewPool()
 	require.NoError(t, err)
@@ -120,6 +184,98 @@ func TestWalletRepo_GetByIDForUpdate(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestWalletRepo_LockForUpdate_LocksInCanonicalOrder(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewWalletRepo(mock)
+	low := newTestWallet(uuid.New())
+	low.ID = uuid.MustParse("00000000-0000-0000-0000-000000000001")
+	high := newTestWallet(uuid.New())
+	high.ID = uuid.MustParse("ffffffff-0000-0000-0000-000000000001")
+	missing := uuid.MustParse("80000000-0000-0000-0000-000000000001")
+
+	// Expectations are ordered: low, missing, high whatever the argument order
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT .+ FROM wallets WHERE id .+ FOR UPDATE").
+		WithArgs(low.ID).
+		WillReturnRows(walletRow(low))
+	mock.ExpectQuery("SELECT .+ FROM wallets WHERE id .+ FOR UPDATE").
+		WithArgs(missing).
+		WillReturnError(pgx.ErrNoRows)
+	mock.ExpectQuery("SELECT .+ FROM wallets WHERE id .+ FOR UPDATE").
+		WithArgs(high.ID).
+		WillReturnRows(walletRow(high))
+
+	tx, err := mock.Begin(context.Background())
+	require.NoError(t, err)
+
+	wallets, err := repo.LockForUpdate(context.Background(), tx, high.ID, missing, low.ID, high.ID)
+	require.NoError(t, err)
+	assert.Len(t, wallets, 2)
+	assert.Equal(t, low.ID, wallets[low.ID].ID)
+	assert.Equal(t, high.ID, wallets[high.ID].ID)
+	assert.NotContains(t, wallets, missing)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWalletRepo_GetOrCreateForUpdate_Inserts(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewWalletRepo(mock)
+	w := newTestWallet(uuid.New())
+	w.Currency = "USD"
+
+	mock.ExpectBegin()
+	mock.ExpectExec("pg_advisory_xact_lock").
+		WithArgs(w.MerchantID.String() + ":USD").
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	mock.ExpectQuery("SELECT .+ FROM wallets WHERE merchant_id .+ FOR UPDATE").
+		WithArgs(w.MerchantID, "USD").
+		WillReturnRows(pgxmock.NewRows(walletColumns()))
+	mock.ExpectExec("INSERT INTO wallets").
+		WithArgs(w.ID, w.MerchantID, w.Currency, w.EncryptedBalance, w.DecimalBalance,
+			w.LastAuditHash, w.CreatedAt, w.UpdatedAt).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	tx, err := mock.Begin(context.Background())
+	require.NoError(t, err)
+
+	got, err := repo.GetOrCreateForUpdate(context.Background(), tx, w)
+	require.NoError(t, err)
+	assert.Equal(t, w.ID, got.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWalletRepo_GetOrCreateForUpdate_ReturnsExisting(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewWalletRepo(mock)
+	existing := newTestWallet(uuid.New())
+	candidate := newTestWallet(existing.MerchantID)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("pg_advisory_xact_lock").
+		WithArgs(existing.MerchantID.String() + ":VND").
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	mock.ExpectQuery("SELECT .+ FROM wallets WHERE merchant_id .+ FOR UPDATE").
+		WithArgs(existing.MerchantID, "VND").
+		WillReturnRows(walletRow(existing))
+
+	tx, err := mock.Begin(context.Background())
+	require.NoError(t, err)
+
+	got, err := repo.GetOrCreateForUpdate(context.Background(), tx, candidate)
+	require.NoError(t, err)
+	assert.Equal(t, existing.ID, got.ID, "a concurrent creator's wallet wins")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestWalletRepo_UpdateBalance(t *testing.T) {
 	mock, err := pgxmock.NewPool()
 	require.NoError(t, err)
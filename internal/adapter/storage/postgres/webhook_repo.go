@@ -2,47 +2,102 @@ package postgres
 
 import (
 "context"
+"errors"
+"fmt"
 "time"
 
 "secure-payment-gateway/internal/core/domain"
 "secure-payment-gateway/internal/core/ports"
 
 "github.com/google/uuid"
-"github.com/jackc/pgx/v5/pgxpool"
+"github.com/jackc/pgx/v5"
 )
 
 type webhookRepo struct {
-pool *pgxpool.Pool
+pool Pool
 }
 
 // NewWebhookRepository creates a PostgreSQL-backed WebhookRepository.
-func NewWebhookRepository(pool *pgxpool.Pool) ports.WebhookRepository {
+func NewWebhookRepository(pool Pool) ports.WebhookRepository {
 return &webhookRepo{pool: pool}
 }
 
+// Create inserts the log, or updates its delivery state if a log with the
+// same ID already exists (e.g. a retry re-persisting its log after a
+// restart). The existing row keeps its payload, URL and created_at, its
+// attempt count never goes backwards, and the same status guard as Update
+// applies: a DELIVERED or FAILED row only accepts the same status again.
+// Returns domain.ErrInvalidWebhookTransition when the guard rejects it.
 func (r *webhookRepo) Create(ctx context.Context, log *domain.WebhookDeliveryLog) error {
-_, err := r.pool.Exec(ctx,
+tag, err := r.pool.Exec(ctx,
 `INSERT INTO webhook_delivery_logs
 (id, transaction_id, merchant_id, webhook_url, payload, http_status, attempt, status, next_retry_at, last_error, created_at, updated_at)
- VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)`,
+ VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
+ ON CONFLICT (id) DO UPDATE
+ SET http_status=EXCLUDED.http_status,
+     attempt=GREATEST(webhook_delivery_logs.attempt, EXCLUDED.attempt),
+     status=EXCLUDED.status, next_retry_at=EXCLUDED.next_retry_at,
+     last_error=EXCLUDED.last_error, updated_at=EXCLUDED.updated_at
+ WHERE webhook_delivery_logs.status=$13 OR webhook_delivery_logs.status=EXCLUDED.status`,
 log.ID, log.TransactionID, log.MerchantID, log.WebhookURL,
 log.Payload, log.HTTPStatus, log.Attempt, string(log.Status),
 log.NextRetryAt, log.LastError, log.CreatedAt, log.UpdatedAt,
+string(domain.WebhookStatusPending),
 )
+if err != nil {
 return err
 }
+if tag.RowsAffected() == 0 {
+return fmt.Errorf("%w: log %s already exists and is not pending or %s", domain.ErrInvalidWebhookTransition, log.ID, log.Status)
+}
+return nil
+}
 
+// Update persists the log's delivery state. The status guard is enforced in
+// the WHERE clause so a concurrent writer that already recorded a terminal
+// status wins: DELIVERED and FAILED rows only accept the same status again.
+// Returns domain.ErrInvalidWebhookTransition when no row was updated.
 func (r *webhookRepo) Update(ctx context.Context, log *domain.WebhookDeliveryLog) error {
 log.UpdatedAt = time.Now()
-_, err := r.pool.Exec(ctx,
+tag, err := r.pool.Exec(ctx,
 `UPDATE webhook_delivery_logs
  SET http_status=$1, attempt=$2, status=$3, next_retry_at=$4, last_error=$5, updated_at=$6
- WHERE id=$7`,
+ WHERE id=$7 AND (status=$8 OR status=$3)`,
 log.HTTPStatus, log.Attempt, string(log.Status),
 log.NextRetryAt, log.LastError, log.UpdatedAt, log.ID,
+string(domain.WebhookStatusPending),
 )
+if err != nil {
 return err
 }
+if tag.RowsAffected() == 0 {
+return fmt.Errorf("%w: log %s is not pending or %s", domain.ErrInvalidWebhookTransition, log.ID, log.Status)
+}
+return nil
+}
+
+func (r *webhookRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.WebhookDeliveryLog, error) {
+var l domain.WebhookDeliveryLog
+var status string
+err := r.pool.QueryRow(ctx,
+`SELECT id, transaction_id, merchant_id, webhook_url, payload,
+http_status, attempt, status, next_retry_at, last_error,
+created_at, updated_at
+ FROM webhook_delivery_logs
+ WHERE id=$1`, id).Scan(
+&l.ID, &l.TransactionID, &l.MerchantID, &l.WebhookURL, &l.Payload,
+&l.HTTPStatus, &l.Attempt, &status, &l.NextRetryAt, &l.LastError,
+&l.CreatedAt, &l.UpdatedAt,
+)
+if err != nil {
+if errors.Is(err, pgx.ErrNoRows) {
+return nil, nil
+}
+return nil, err
+}
+l.Status = domain.WebhookStatus(status)
+return &l, nil
+}
 
 func (r *webhookRepo) GetByTransactionID(ctx context.Context, txID uuid.UUID) ([]domain.WebhookDeliveryLog, error) {
 rows, err := r.pool.Query(ctx,
@@ -73,3 +128,40 @@ logs = append(logs, l)
 }
 return logs, rows.Err()
 }
+
+func (r *webhookRepo) GetLatestByMerchant(ctx context.Context, merchantID uuid.UUID) (*domain.WebhookDeliveryLog, error) {
+var l domain.WebhookDeliveryLog
+var status string
+err := r.pool.QueryRow(ctx,
+`SELECT id, transaction_id, merchant_id, webhook_url, payload,
+http_status, attempt, status, next_retry_at, last_error,
+created_at, updated_at
+ FROM webhook_delivery_logs
+ WHERE merchant_id=$1
+ ORDER BY updated_at DESC
+ LIMIT 1`, merchantID).Scan(
+&l.ID, &l.TransactionID, &l.MerchantID, &l.WebhookURL, &l.Payload,
+&l.HTTPStatus, &l.Attempt, &status, &l.NextRetryAt, &l.LastError,
+&l.CreatedAt, &l.UpdatedAt,
+)
+if err != nil {
+if errors.Is(err, pgx.ErrNoRows) {
+return nil, nil
+}
+return nil, err
+}
+l.Status = domain.WebhookStatus(status)
+return &l, nil
+}
+
+// DeleteOlderThan removes logs in status last updated before the given time
+// and returns how many were deleted.
+func (r *webhookRepo) DeleteOlderThan(ctx context.Context, status domain.WebhookStatus, before time.Time) (int64, error) {
+tag, err := r.pool.Exec(ctx,
+`DELETE FROM webhook_delivery_logs WHERE status=$1 AND updated_at < $2`,
+string(status), before)
+if err != nil {
+return 0, fmt.Errorf("delete webhook delivery logs: %w", err)
+}
+return tag.RowsAffected(), nil
+}
@@ -0,0 +1,172 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"secure-payment-gateway/internal/core/domain"
+
+	"github.com/google/uuid"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDeliveryLog(status domain.WebhookStatus) *domain.WebhookDeliveryLog {
+	httpStatus := 200
+	return &domain.WebhookDeliveryLog{
+		ID:            uuid.New(),
+		TransactionID: uuid.New(),
+		MerchantID:    uuid.New(),
+		WebhookURL:    "https://example.com/webhook",
+		HTTPStatus:    &httpStatus,
+		Attempt:       2,
+		Status:        status,
+		CreatedAt:     time.Now().UTC(),
+	}
+}
+
+func TestWebhookRepo_Update_GuardsStatus(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewWebhookRepository(mock)
+	log := newTestDeliveryLog(domain.WebhookStatusDelivered)
+
+	mock.ExpectExec(`UPDATE webhook_delivery_logs .* WHERE id=\$7 AND \(status=\$8 OR status=\$3\)`).
+		WithArgs(log.HTTPStatus, log.Attempt, "DELIVERED", log.NextRetryAt, log.LastError, pgxmock.AnyArg(), log.ID, "PENDING").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	require.NoError(t, repo.Update(context.Background(), log))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebhookRepo_Update_RejectsTerminalFlip(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewWebhookRepository(mock)
+	// Row is already FAILED, so the guarded UPDATE matches nothing
+	log := newTestDeliveryLog(domain.WebhookStatusDelivered)
+
+	mock.ExpectExec("UPDATE webhook_delivery_logs").
+		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), "DELIVERED", pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), log.ID, "PENDING").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+
+	err = repo.Update(context.Background(), log)
+	assert.ErrorIs(t, err, domain.ErrInvalidWebhookTransition)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebhookRepo_Create_UpsertsExistingLog(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewWebhookRepository(mock)
+	log := newTestDeliveryLog(domain.WebhookStatusPending)
+
+	// A log re-created under the same ID takes the update branch, which
+	// reports one affected row just like an insert
+	mock.ExpectExec(`INSERT INTO webhook_delivery_logs .* ON CONFLICT \(id\) DO UPDATE .* attempt=GREATEST\(webhook_delivery_logs.attempt, EXCLUDED.attempt\).* WHERE webhook_delivery_logs.status=\$13 OR webhook_delivery_logs.status=EXCLUDED.status`).
+		WithArgs(log.ID, log.TransactionID, log.MerchantID, log.WebhookURL,
+			log.Payload, log.HTTPStatus, log.Attempt, "PENDING",
+			log.NextRetryAt, log.LastError, log.CreatedAt, log.UpdatedAt, "PENDING").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	require.NoError(t, repo.Create(context.Background(), log))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebhookRepo_Create_ConflictWithTerminalLog(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewWebhookRepository(mock)
+	// Existing row is DELIVERED, so the conflict update is skipped
+	log := newTestDeliveryLog(domain.WebhookStatusPending)
+
+	mock.ExpectExec("INSERT INTO webhook_delivery_logs").
+		WithArgs(log.ID, pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(),
+			pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), "PENDING",
+			pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), "PENDING").
+		WillReturnResult(pgxmock.NewResult("INSERT", 0))
+
+	err = repo.Create(context.Background(), log)
+	assert.ErrorIs(t, err, domain.ErrInvalidWebhookTransition)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func webhookColumns() []string {
+	return []string{"id", "transaction_id", "merchant_id", "webhook_url", "payload",
+		"http_status", "attempt", "status", "next_retry_at", "last_error",
+		"created_at", "updated_at"}
+}
+
+func TestWebhookRepo_GetByID_Found(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewWebhookRepository(mock)
+	want := newTestDeliveryLog(domain.WebhookStatusDelivered)
+	want.Payload = `{"event":"payment.success"}`
+
+	mock.ExpectQuery(`SELECT .* FROM webhook_delivery_logs\s+WHERE id=\$1`).
+		WithArgs(want.ID).
+		WillReturnRows(pgxmock.NewRows(webhookColumns()).AddRow(
+			want.ID, want.TransactionID, want.MerchantID, want.WebhookURL, want.Payload,
+			want.HTTPStatus, want.Attempt, "DELIVERED", want.NextRetryAt, want.LastError,
+			want.CreatedAt, want.UpdatedAt,
+		))
+
+	got, err := repo.GetByID(context.Background(), want.ID)
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, want.ID, got.ID)
+	assert.Equal(t, want.TransactionID, got.TransactionID)
+	assert.Equal(t, domain.WebhookStatusDelivered, got.Status)
+	assert.Equal(t, 200, *got.HTTPStatus)
+	assert.Equal(t, want.Payload, got.Payload)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebhookRepo_GetByID_NotFound(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewWebhookRepository(mock)
+	id := uuid.New()
+
+	mock.ExpectQuery("SELECT .* FROM webhook_delivery_logs").
+		WithArgs(id).
+		WillReturnRows(pgxmock.NewRows(webhookColumns()))
+
+	got, err := repo.GetByID(context.Background(), id)
+	require.NoError(t, err)
+	assert.Nil(t, got)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebhookRepo_DeleteOlderThan(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewWebhookRepository(mock)
+	before := time.Now().Add(-720 * time.Hour)
+
+	mock.ExpectExec(`DELETE FROM webhook_delivery_logs WHERE status=\$1 AND updated_at < \$2`).
+		WithArgs("DELIVERED", before).
+		WillReturnResult(pgxmock.NewResult("DELETE", 4))
+
+	deleted, err := repo.DeleteOlderThan(context.Background(), domain.WebhookStatusDelivered, before)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), deleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
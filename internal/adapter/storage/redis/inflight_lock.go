@@ -0,0 +1,48 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// InFlightLock implements ports.InFlightLock with SET NX keys, so the claim
+// is shared by every instance. A claim whose holder dies expires after its
+// TTL.
+type InFlightLock struct {
+	client *goredis.Client
+	prefix string
+}
+
+// NewInFlightLock creates a Redis-backed in-flight lock.
+func NewInFlightLock(client *goredis.Client) *InFlightLock {
+	return &InFlightLock{
+		client: client,
+		prefix: "idempotency_lock:",
+	}
+}
+
+// Acquire claims key for ttl, returning "" if it is already claimed.
+func (l *InFlightLock) Acquire(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	token := uuid.NewString()
+	ok, err := l.client.SetNX(ctx, l.prefix+key, token, ttl).Result()
+	if err != nil {
+		return "", fmt.Errorf("redis in-flight lock acquire: %w", err)
+	}
+	if !ok {
+		return "", nil
+	}
+	return token, nil
+}
+
+// Release deletes the claim only if token still holds it, so a request
+// whose claim expired cannot free a later request's.
+func (l *InFlightLock) Release(ctx context.Context, key, token string) error {
+	if err := releaseLeaseScript.Run(ctx, l.client, []string{l.prefix + key}, token).Err(); err != nil {
+		return fmt.Errorf("redis in-flight lock release: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInFlightLock_SharedClaimAndRelease(t *testing.T) {
+	s := miniredis.RunT(t)
+	newClient := func() *goredis.Client {
+		client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+		t.Cleanup(func() { client.Close() })
+		return client
+	}
+	// Two instances sharing one Redis
+	a, b := NewInFlightLock(newClient()), NewInFlightLock(newClient())
+	ctx := context.Background()
+
+	token, err := a.Acquire(ctx, "m:ORD-1", 30*time.Second)
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+	assert.Equal(t, 30*time.Second, s.TTL("idempotency_lock:m:ORD-1"))
+
+	other, err := b.Acquire(ctx, "m:ORD-1", 30*time.Second)
+	require.NoError(t, err)
+	assert.Empty(t, other, "claimed on the other instance")
+
+	require.NoError(t, b.Release(ctx, "m:ORD-1", "stale"))
+	assert.True(t, s.Exists("idempotency_lock:m:ORD-1"), "a stale token does not free the claim")
+
+	require.NoError(t, a.Release(ctx, "m:ORD-1", token))
+	other, err = b.Acquire(ctx, "m:ORD-1", 30*time.Second)
+	require.NoError(t, err)
+	assert.NotEmpty(t, other)
+
+	// An abandoned claim expires
+	s.FastForward(30 * time.Second)
+	token, err = a.Acquire(ctx, "m:ORD-1", 30*time.Second)
+	require.NoError(t, err)
+	assert.NotEmpty(t, token)
+}
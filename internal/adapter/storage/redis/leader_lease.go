@@ -0,0 +1,71 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// acquireLeaseScript renews the lease when this instance holds it and
+// otherwise takes it only if it is free (SET NX), in one atomic step.
+var acquireLeaseScript = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return 1
+end
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+// releaseLeaseScript deletes the lease only if this instance holds it.
+// InFlightLock releases its claims with it too, passing the claim token.
+var releaseLeaseScript = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// LeaderLease implements ports.LeaderLease with a Redis key holding the
+// leader's instance ID. The leader must renew it within ttl; if it dies,
+// the key expires and another instance takes over.
+type LeaderLease struct {
+	client     *goredis.Client
+	key        string
+	instanceID string
+	ttl        time.Duration
+}
+
+// NewLeaderLease creates a lease named name, held by instanceID for ttl
+// after each acquisition or renewal. instanceID must be unique per instance.
+func NewLeaderLease(client *goredis.Client, name, instanceID string, ttl time.Duration) *LeaderLease {
+	return &LeaderLease{
+		client:     client,
+		key:        "leader:" + name,
+		instanceID: instanceID,
+		ttl:        ttl,
+	}
+}
+
+// TryAcquire takes the lease if it is free, or renews it if this instance
+// already holds it. It reports whether this instance holds the lease.
+func (l *LeaderLease) TryAcquire(ctx context.Context) (bool, error) {
+	held, err := acquireLeaseScript.Run(ctx, l.client, []string{l.key}, l.instanceID, l.ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("redis leader lease acquire: %w", err)
+	}
+	return held == 1, nil
+}
+
+// Release gives the lease up so another instance can take over without
+// waiting for it to expire. A lease held by another instance is untouched.
+func (l *LeaderLease) Release(ctx context.Context) error {
+	if err := releaseLeaseScript.Run(ctx, l.client, []string{l.key}, l.instanceID).Err(); err != nil {
+		return fmt.Errorf("redis leader lease release: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLeaseClient(t *testing.T) (*miniredis.Miniredis, *goredis.Client) {
+	s := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return s, client
+}
+
+func TestLeaderLease_OnlyOneInstanceAcquires(t *testing.T) {
+	s, client := newLeaseClient(t)
+	a := NewLeaderLease(client, "jobs", "instance-a", 30*time.Second)
+	b := NewLeaderLease(client, "jobs", "instance-b", 30*time.Second)
+	ctx := context.Background()
+
+	held, err := a.TryAcquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, held)
+
+	held, err = b.TryAcquire(ctx)
+	require.NoError(t, err)
+	assert.False(t, held, "the lease is taken")
+
+	got, err := s.Get("leader:jobs")
+	require.NoError(t, err)
+	assert.Equal(t, "instance-a", got)
+}
+
+func TestLeaderLease_RenewExtendsTTL(t *testing.T) {
+	s, client := newLeaseClient(t)
+	a := NewLeaderLease(client, "jobs", "instance-a", 30*time.Second)
+	b := NewLeaderLease(client, "jobs", "instance-b", 30*time.Second)
+	ctx := context.Background()
+
+	held, err := a.TryAcquire(ctx)
+	require.NoError(t, err)
+	require.True(t, held)
+
+	// Renewing before expiry keeps the lease alive past the original TTL
+	s.FastForward(20 * time.Second)
+	held, err = a.TryAcquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, held)
+	assert.Equal(t, 30*time.Second, s.TTL("leader:jobs"))
+
+	s.FastForward(20 * time.Second)
+	held, err = b.TryAcquire(ctx)
+	require.NoError(t, err)
+	assert.False(t, held, "the renewed lease has not expired")
+}
+
+func TestLeaderLease_LostWhenNotRenewed(t *testing.T) {
+	s, client := newLeaseClient(t)
+	a := NewLeaderLease(client, "jobs", "instance-a", 30*time.Second)
+	b := NewLeaderLease(client, "jobs", "instance-b", 30*time.Second)
+	ctx := context.Background()
+
+	held, err := a.TryAcquire(ctx)
+	require.NoError(t, err)
+	require.True(t, held)
+
+	// Leader dies: the lease expires and another instance fails over
+	s.FastForward(31 * time.Second)
+	held, err = b.TryAcquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, held)
+
+	held, err = a.TryAcquire(ctx)
+	require.NoError(t, err)
+	assert.False(t, held, "the old leader has lost the lease")
+}
+
+func TestLeaderLease_Release(t *testing.T) {
+	s, client := newLeaseClient(t)
+	a := NewLeaderLease(client, "jobs", "instance-a", 30*time.Second)
+	b := NewLeaderLease(client, "jobs", "instance-b", 30*time.Second)
+	ctx := context.Background()
+
+	held, err := a.TryAcquire(ctx)
+	require.NoError(t, err)
+	require.True(t, held)
+
+	// A non-holder's release leaves the lease alone
+	require.NoError(t, b.Release(ctx))
+	assert.True(t, s.Exists("leader:jobs"))
+
+	require.NoError(t, a.Release(ctx))
+	held, err = b.TryAcquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, held, "released lease is free at once")
+}
+
+func TestLeaderLease_RedisDown(t *testing.T) {
+	s, client := newLeaseClient(t)
+	lease := NewLeaderLease(client, "jobs", "instance-a", 30*time.Second)
+	s.Close()
+
+	held, err := lease.TryAcquire(context.Background())
+	assert.Error(t, err)
+	assert.False(t, held)
+}
@@ -39,3 +39,12 @@ func (s *NonceStore) CheckAndSet(ctx context.Context, merchantID string, nonce s
 	}
 	return result == "OK", nil
 }
+
+// Seen reports whether a nonce has been used, without recording it.
+func (s *NonceStore) Seen(ctx context.Context, merchantID string, nonce string) (bool, error) {
+	n, err := s.client.Exists(ctx, s.prefix+merchantID+":"+nonce).Result()
+	if err != nil {
+		return false, fmt.Errorf("redis nonce lookup: %w", err)
+	}
+	return n > 0, nil
+}
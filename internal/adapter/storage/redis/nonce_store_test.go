@@ -72,3 +72,23 @@ func TestNonceStore_CheckAndSet_ExpiredNonce(t *testing.T) {
 	require.NoError(t, err)
 	assert.True(t, ok, "expired nonce should be accepted again")
 }
+
+func TestNonceStore_Seen_DoesNotRecord(t *testing.T) {
+	s := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+	store := NewNonceStore(client)
+	ctx := context.Background()
+
+	seen, err := store.Seen(ctx, "merchant-1", "nonce-peek")
+	require.NoError(t, err)
+	assert.False(t, seen)
+
+	// Looking did not spend the nonce
+	ok, err := store.CheckAndSet(ctx, "merchant-1", "nonce-peek", 5*time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	seen, err = store.Seen(ctx, "merchant-1", "nonce-peek")
+	require.NoError(t, err)
+	assert.True(t, seen)
+}
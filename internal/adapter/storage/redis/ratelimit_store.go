@@ -2,6 +2,7 @@ package redis
 
 import (
 "context"
+"errors"
 "fmt"
 "time"
 
@@ -28,37 +29,68 @@ Allowed   bool
 Limit     int64
 Remaining int64
 ResetAt   int64 // Unix timestamp
+Used      int64 // Units consumed in the current window
 }
 
 // Allow checks if a request is within the rate limit.
 // It uses a fixed-window counter: INCR + EXPIRE on a key scoped by windowID.
 // windowID should be computed as time / windowDuration to form discrete windows.
 func (s *RateLimitStore) Allow(ctx context.Context, key string, limit int64, window time.Duration) (*RateLimitResult, error) {
-now := time.Now()
-windowID := now.Unix() / int64(window.Seconds())
-redisKey := fmt.Sprintf("%s%s:%d", s.prefix, key, windowID)
+return s.AllowN(ctx, key, limit, 1, window)
+}
+
+// AllowN is like Allow but consumes cost units from the bucket instead of one.
+func (s *RateLimitStore) AllowN(ctx context.Context, key string, limit, cost int64, window time.Duration) (*RateLimitResult, error) {
+if cost < 1 {
+cost = 1
+}
+windowID, redisKey := s.window(key, window)
 
 // Increment counter atomically
-count, err := s.client.Incr(ctx, redisKey).Result()
+count, err := s.client.IncrBy(ctx, redisKey, cost).Result()
 if err != nil {
 return nil, fmt.Errorf("redis rate limit incr: %w", err)
 }
 
 // Set expiry only on first increment (new window)
-if count == 1 {
+if count == cost {
 s.client.Expire(ctx, redisKey, window+time.Second) // +1s safety margin
 }
 
-resetAt := (windowID + 1) * int64(window.Seconds())
+return newRateLimitResult(windowID, count, limit, window), nil
+}
+
+// Peek reports the current window's usage for key without consuming any
+// units. Allowed reports whether one more unit would be accepted.
+func (s *RateLimitStore) Peek(ctx context.Context, key string, limit int64, window time.Duration) (*RateLimitResult, error) {
+windowID, redisKey := s.window(key, window)
+
+count, err := s.client.Get(ctx, redisKey).Int64()
+if err != nil && !errors.Is(err, goredis.Nil) {
+return nil, fmt.Errorf("redis rate limit get: %w", err)
+}
+
+result := newRateLimitResult(windowID, count, limit, window)
+result.Allowed = count < limit
+return result, nil
+}
+
+// window returns the current fixed window's ID and its Redis key.
+func (s *RateLimitStore) window(key string, window time.Duration) (int64, string) {
+windowID := time.Now().Unix() / int64(window.Seconds())
+return windowID, fmt.Sprintf("%s%s:%d", s.prefix, key, windowID)
+}
+
+func newRateLimitResult(windowID, count, limit int64, window time.Duration) *RateLimitResult {
 remaining := limit - count
 if remaining < 0 {
 remaining = 0
 }
-
 return &RateLimitResult{
 Allowed:   count <= limit,
 Limit:     limit,
 Remaining: remaining,
-ResetAt:   resetAt,
-}, nil
+ResetAt:   (windowID + 1) * int64(window.Seconds()),
+Used:      count,
+}
 }
@@ -73,3 +73,73 @@ assert.True(t, result.Allowed)
 assert.Greater(t, result.ResetAt, time.Now().Unix()-1)
 })
 }
+
+func TestRateLimitStore_AllowN(t *testing.T) {
+mr := miniredis.RunT(t)
+client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+defer client.Close()
+
+store := redis.NewRateLimitStore(client)
+ctx := context.Background()
+
+result, err := store.AllowN(ctx, "merchant1:export", 6, 3, time.Minute)
+require.NoError(t, err)
+assert.True(t, result.Allowed)
+assert.Equal(t, int64(3), result.Remaining)
+
+result, err = store.AllowN(ctx, "merchant1:export", 6, 3, time.Minute)
+require.NoError(t, err)
+assert.True(t, result.Allowed)
+assert.Equal(t, int64(0), result.Remaining)
+
+result, err = store.AllowN(ctx, "merchant1:export", 6, 3, time.Minute)
+require.NoError(t, err)
+assert.False(t, result.Allowed)
+}
+
+func TestRateLimitStore_Peek(t *testing.T) {
+mr := miniredis.RunT(t)
+client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+defer client.Close()
+
+store := redis.NewRateLimitStore(client)
+ctx := context.Background()
+
+t.Run("unused key reports the full quota", func(t *testing.T) {
+result, err := store.Peek(ctx, "merchant1:payments", 5, time.Minute)
+require.NoError(t, err)
+assert.True(t, result.Allowed)
+assert.Equal(t, int64(0), result.Used)
+assert.Equal(t, int64(5), result.Remaining)
+})
+
+t.Run("reflects prior consumption without consuming", func(t *testing.T) {
+for i := 0; i < 3; i++ {
+_, err := store.Allow(ctx, "merchant1:payments", 5, time.Minute)
+require.NoError(t, err)
+}
+
+for i := 0; i < 3; i++ {
+result, err := store.Peek(ctx, "merchant1:payments", 5, time.Minute)
+require.NoError(t, err)
+assert.Equal(t, int64(3), result.Used)
+assert.Equal(t, int64(2), result.Remaining)
+assert.Equal(t, int64(5), result.Limit)
+}
+
+// The next Allow sees only the three real requests
+result, err := store.Allow(ctx, "merchant1:payments", 5, time.Minute)
+require.NoError(t, err)
+assert.Equal(t, int64(4), result.Used)
+})
+
+t.Run("exhausted quota is not allowed", func(t *testing.T) {
+_, err := store.AllowN(ctx, "merchant2:payments", 2, 2, time.Minute)
+require.NoError(t, err)
+
+result, err := store.Peek(ctx, "merchant2:payments", 2, time.Minute)
+require.NoError(t, err)
+assert.False(t, result.Allowed)
+assert.Equal(t, int64(0), result.Remaining)
+})
+}
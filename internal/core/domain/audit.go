@@ -17,6 +17,7 @@ AuditActionRegister      AuditAction = "REGISTER"
 AuditActionLogin         AuditAction = "LOGIN"
 AuditActionRotateKeys    AuditAction = "ROTATE_KEYS"
 AuditActionUpdateWebhook AuditAction = "UPDATE_WEBHOOK"
+AuditActionReverse       AuditAction = "REVERSE"
 )
 
 // AuditLog records a single audited action in the system.
@@ -29,4 +30,7 @@ ResourceID   string      `json:"resource_id,omitempty"`
 Details      string      `json:"details,omitempty"` // JSON string
 IPAddress    string      `json:"ip_address"`
 CreatedAt    time.Time   `json:"created_at"`
+
+// RequestID identifies the request that produced the entry; "" outside a request
+RequestID string `json:"request_id,omitempty"`
 }
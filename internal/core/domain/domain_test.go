@@ -1,10 +1,15 @@
 package domain
 
 import (
+	"context"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMerchant_IsActive(t *testing.T) {
@@ -26,6 +31,19 @@ func TestMerchant_IsActive(t *testing.T) {
 	}
 }
 
+func TestMerchant_SecretExpiresAt(t *testing.T) {
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	rotated := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	maxAge := 30 * 24 * time.Hour
+
+	m := &Merchant{CreatedAt: created}
+	assert.Nil(t, m.SecretExpiresAt(0), "no max age, no expiry")
+	assert.Equal(t, created.Add(maxAge), *m.SecretExpiresAt(maxAge), "never rotated: counts from creation")
+
+	m.SecretRotatedAt = &rotated
+	assert.Equal(t, rotated.Add(maxAge), *m.SecretExpiresAt(maxAge), "counts from the last rotation")
+}
+
 func TestTransaction_IsTerminal(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -71,18 +89,251 @@ func TestTransaction_IsRefundable(t *testing.T) {
 	}
 }
 
+func TestTransaction_HasProcessedAt(t *testing.T) {
+	now := time.Now()
+	var zero time.Time
+
+	assert.False(t, (&Transaction{}).HasProcessedAt())
+	assert.False(t, (&Transaction{ProcessedAt: &zero}).HasProcessedAt())
+	assert.True(t, (&Transaction{ProcessedAt: &now}).HasProcessedAt())
+}
+
+func TestNewTransaction_Defaults(t *testing.T) {
+	now := time.Date(2026, 1, 2, 10, 0, 0, 0, time.FixedZone("ICT", 7*3600))
+	p := TransactionParams{
+		Type:            TransactionTypeTopup,
+		ReferenceID:     "TOPUP-1",
+		MerchantID:      uuid.New(),
+		WalletID:        uuid.New(),
+		Amount:          5000,
+		AmountEncrypted: "enc",
+		Currency:        "VND",
+		Now:             now,
+	}
+
+	tx, err := NewTransaction(p)
+	require.NoError(t, err)
+	assert.NotEqual(t, uuid.Nil, tx.ID)
+	assert.Equal(t, TransactionStatusSuccess, tx.Status)
+	assert.Equal(t, SystemTopupSignature, tx.Signature)
+	assert.Equal(t, now.UTC(), tx.CreatedAt)
+	assert.Equal(t, time.UTC, tx.CreatedAt.Location())
+	require.True(t, tx.HasProcessedAt())
+	assert.Equal(t, tx.CreatedAt, *tx.ProcessedAt)
+
+	other, err := NewTransaction(p)
+	require.NoError(t, err)
+	assert.NotEqual(t, tx.ID, other.ID, "each transaction gets its own ID")
+
+	p.Type, p.Signature = TransactionTypePayment, ""
+	tx, err = NewTransaction(p)
+	require.NoError(t, err)
+	assert.Empty(t, tx.Signature, "only topups are signed by the system")
+}
+
+func TestNewTransaction_Invariants(t *testing.T) {
+	origID := uuid.New()
+	valid := func(typ TransactionType) TransactionParams {
+		p := TransactionParams{
+			Type:            typ,
+			ReferenceID:     "REF-1",
+			MerchantID:      uuid.New(),
+			WalletID:        uuid.New(),
+			Amount:          100,
+			AmountEncrypted: "enc",
+		}
+		if typ == TransactionTypeRefund || typ == TransactionTypeReversal {
+			p.OriginalTransactionID = &origID
+		}
+		return p
+	}
+
+	for _, typ := range []TransactionType{TransactionTypePayment, TransactionTypeRefund, TransactionTypeTopup, TransactionTypeReversal} {
+		_, err := NewTransaction(valid(typ))
+		assert.NoError(t, err, typ)
+	}
+
+	tests := []struct {
+		name   string
+		typ    TransactionType
+		mutate func(p *TransactionParams)
+	}{
+		{"unknown type", TransactionTypePayment, func(p *TransactionParams) { p.Type = "CHARGEBACK" }},
+		{"no reference", TransactionTypePayment, func(p *TransactionParams) { p.ReferenceID = "" }},
+		{"no merchant", TransactionTypePayment, func(p *TransactionParams) { p.MerchantID = uuid.Nil }},
+		{"no wallet", TransactionTypeTopup, func(p *TransactionParams) { p.WalletID = uuid.Nil }},
+		{"zero amount", TransactionTypePayment, func(p *TransactionParams) { p.Amount = 0 }},
+		{"negative amount", TransactionTypeRefund, func(p *TransactionParams) { p.Amount = -1 }},
+		{"negative decimal amount", TransactionTypePayment, func(p *TransactionParams) {
+			p.Amount, p.AmountDecimal = 0, decimalPtr("-0.5")
+		}},
+		{"decimal amount mismatch", TransactionTypeTopup, func(p *TransactionParams) { p.AmountDecimal = decimalPtr("2.5") }},
+		{"amount not encrypted", TransactionTypeTopup, func(p *TransactionParams) { p.AmountEncrypted = "" }},
+		{"refund without original", TransactionTypeRefund, func(p *TransactionParams) { p.OriginalTransactionID = nil }},
+		{"refund with nil original", TransactionTypeRefund, func(p *TransactionParams) { p.OriginalTransactionID = &uuid.Nil }},
+		{"reversal without original", TransactionTypeReversal, func(p *TransactionParams) { p.OriginalTransactionID = nil }},
+		{"payment with original", TransactionTypePayment, func(p *TransactionParams) { p.OriginalTransactionID = &origID }},
+		{"topup with original", TransactionTypeTopup, func(p *TransactionParams) { p.OriginalTransactionID = &origID }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid(tt.typ)
+			tt.mutate(&p)
+			tx, err := NewTransaction(p)
+			assert.ErrorIs(t, err, ErrInvalidTransaction)
+			assert.Nil(t, tx)
+		})
+	}
+}
+
+func TestNewTransaction_DecimalAmount(t *testing.T) {
+	amount, exact := SplitAmount(decimal.RequireFromString("0.000000017"))
+	assert.Equal(t, int64(0), amount)
+	require.NotNil(t, exact)
+
+	tx, err := NewTransaction(TransactionParams{
+		Type:            TransactionTypePayment,
+		ReferenceID:     "REF-1",
+		MerchantID:      uuid.New(),
+		WalletID:        uuid.New(),
+		Amount:          amount,
+		AmountDecimal:   exact,
+		AmountEncrypted: "enc",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "0.000000017", tx.ExactAmount().String())
+}
+
+func TestSplitAmount(t *testing.T) {
+	amount, exact := SplitAmount(decimal.NewFromInt(150000))
+	assert.Equal(t, int64(150000), amount)
+	assert.Nil(t, exact)
+
+	amount, exact = SplitAmount(decimal.RequireFromString("12.50"))
+	assert.Equal(t, int64(12), amount)
+	require.NotNil(t, exact)
+	assert.Equal(t, "12.5", exact.String())
+
+	tx := &Transaction{Amount: 150000}
+	assert.Equal(t, "150000", tx.ExactAmount().String())
+}
+
+func decimalPtr(s string) *decimal.Decimal {
+	d := decimal.RequireFromString(s)
+	return &d
+}
+
 func TestBuildIdempotencyKey(t *testing.T) {
 	id := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
 	key := BuildIdempotencyKey(id, "ORD-001")
 	assert.Equal(t, "550e8400-e29b-41d4-a716-446655440000:ORD-001", key)
 }
 
+func TestBuildPaymentIdempotencyKey(t *testing.T) {
+	id := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	key := BuildPaymentIdempotencyKey(id, "ORD-001")
+	assert.Equal(t, "550e8400-e29b-41d4-a716-446655440000:idempotency-key:ORD-001", key)
+	assert.NotEqual(t, BuildIdempotencyKey(id, "ORD-001"), key)
+}
+
+func TestPaymentRequestHash(t *testing.T) {
+	id := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	h := PaymentRequestHash(id, decimal.NewFromInt(50000), "VND", "ORDER-001")
+	assert.Len(t, h, 64)
+	assert.Equal(t, h, PaymentRequestHash(id, decimal.NewFromInt(50000), "VND", "ORDER-001"))
+	assert.NotEqual(t, h, PaymentRequestHash(id, decimal.NewFromInt(50001), "VND", "ORDER-001"))
+	assert.NotEqual(t, h, PaymentRequestHash(id, decimal.NewFromInt(50000), "USD", "ORDER-001"))
+	assert.NotEqual(t, h, PaymentRequestHash(id, decimal.NewFromInt(50000), "VND", "ORDER-002"))
+	assert.NotEqual(t, h, PaymentRequestHash(uuid.New(), decimal.NewFromInt(50000), "VND", "ORDER-001"))
+	assert.NotEqual(t, h, PaymentRequestHash(id, decimal.RequireFromString("50000.5"), "VND", "ORDER-001"))
+	// Currency codes are case-insensitive
+	assert.Equal(t, h, PaymentRequestHash(id, decimal.NewFromInt(50000), "vnd", "ORDER-001"))
+	// Hashes stored while amounts were int64 still match
+	assert.Equal(t, "f951a9345faf0de2fcec10a4f91de4940ddeeed17098a776bf64222097ff27be", h)
+}
+
+func TestBuildIdempotencyKey_LongReferenceIsBounded(t *testing.T) {
+	id := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	long := strings.Repeat("a", 10*1024)
+
+	key := BuildIdempotencyKey(id, long)
+	assert.Len(t, key, len(id.String())+1+len(hashedKeyPartPrefix)+64)
+	assert.Equal(t, key, BuildIdempotencyKey(id, long), "stable across calls")
+	assert.NotEqual(t, key, BuildIdempotencyKey(id, long+"b"), "distinct references keep distinct keys")
+
+	// Valid references are kept verbatim; only over-long or prefix-lookalike parts are hashed
+	maxRef := strings.Repeat("r", MaxReferenceIDLength)
+	assert.Equal(t, id.String()+":"+maxRef, BuildIdempotencyKey(id, maxRef))
+	lookalike := key[len(id.String())+1:]
+	assert.NotEqual(t, key, BuildIdempotencyKey(id, lookalike))
+
+	for _, k := range []string{
+		BuildTopupIdempotencyKey(id, long),
+		BuildRegisterIdempotencyKey(long),
+		BuildRefundIdempotencyKey(id, long),
+		BuildReversalIdempotencyKey(id, long),
+		BuildRefundBatchIdempotencyKey(id, long),
+		BuildRefundBatchIdempotencyKey(id, strings.Repeat("k", MaxIdempotencyKeyPartLength)),
+	} {
+		assert.LessOrEqual(t, len(k), MaxIdempotencyKeyLength, k)
+	}
+}
+
+func TestDerivedReference(t *testing.T) {
+	assert.Equal(t, "REVERSAL-ORD-001", DerivedReference("REVERSAL-", "ORD-001"))
+
+	long := strings.Repeat("r", MaxReferenceIDLength)
+	ref := DerivedReference("REVERSAL-", long)
+	assert.LessOrEqual(t, len(ref), MaxReferenceIDLength)
+	assert.True(t, strings.HasPrefix(ref, "REVERSAL-"))
+	assert.Equal(t, ref, DerivedReference("REVERSAL-", long), "stable across calls")
+	assert.NotEqual(t, ref, DerivedReference("REVERSAL-", long[1:]+"s"))
+}
+
+func TestBuildIdempotencyKey_DailyReference(t *testing.T) {
+	id := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	hcm := time.FixedZone("ICT", 7*3600)
+	lateUTC := time.Date(2026, 10, 16, 23, 30, 0, 0, time.UTC)
+
+	assert.Equal(t, "550e8400-e29b-41d4-a716-446655440000:20261016:ORD-001", BuildIdempotencyKey(id, DailyReference(lateUTC, "ORD-001")))
+	assert.Equal(t, "20261017:ORD-001", DailyReference(lateUTC.In(hcm), "ORD-001"), "the day is taken in t's location")
+	assert.Equal(t, "20261016:"+strings.Repeat("r", MaxReferenceIDLength),
+		boundKeyPart(DailyReference(lateUTC, strings.Repeat("r", MaxReferenceIDLength))), "valid references are never hashed")
+}
+
 func TestBuildRefundIdempotencyKey(t *testing.T) {
 	id := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
 	key := BuildRefundIdempotencyKey(id, "ORD-001")
 	assert.Equal(t, "550e8400-e29b-41d4-a716-446655440000:refund:ORD-001", key)
 }
 
+func TestBuildRefundBatchIdempotencyKey(t *testing.T) {
+	id := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	key := BuildRefundBatchIdempotencyKey(id, "batch-1")
+	assert.Equal(t, "550e8400-e29b-41d4-a716-446655440000:refund_batch:batch-1", key)
+}
+
+func TestWalletLockOrder(t *testing.T) {
+	a := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+	b := uuid.MustParse("7fffffff-0000-0000-0000-000000000000")
+	c := uuid.MustParse("ffffffff-0000-0000-0000-000000000000")
+
+	assert.Equal(t, []uuid.UUID{a, b, c}, WalletLockOrder(c, a, b))
+	assert.Equal(t, WalletLockOrder(a, c), WalletLockOrder(c, a))
+	assert.Equal(t, []uuid.UUID{a, c}, WalletLockOrder(c, a, c, a))
+	assert.Empty(t, WalletLockOrder())
+}
+
+func TestIsCurrencyCode(t *testing.T) {
+	for _, c := range []string{"VND", "usd", "Sgd", "EUR"} {
+		assert.True(t, IsCurrencyCode(c), c)
+	}
+	// Letter-shaped but not ISO 4217 currencies: made up, metal, testing
+	for _, c := range []string{"", "VN", "VNDD", "US1", "U$D", "ĐỒN", "ABC", "XYZ", "XAU", "XTS", "XXX"} {
+		assert.False(t, IsCurrencyCode(c), c)
+	}
+}
+
 func TestMerchantStatus_Constants(t *testing.T) {
 	assert.Equal(t, MerchantStatus("ACTIVE"), MerchantStatusActive)
 	assert.Equal(t, MerchantStatus("SUSPENDED"), MerchantStatusSuspended)
@@ -101,3 +352,59 @@ func TestTransactionStatus_Constants(t *testing.T) {
 	assert.Equal(t, TransactionStatus("FAILED"), TransactionStatusFailed)
 	assert.Equal(t, TransactionStatus("REVERSED"), TransactionStatusReversed)
 }
+
+func TestWebhookStatus_CanTransitionTo(t *testing.T) {
+	tests := []struct {
+		from, to WebhookStatus
+		want     bool
+	}{
+		{WebhookStatusPending, WebhookStatusPending, true},
+		{WebhookStatusPending, WebhookStatusDelivered, true},
+		{WebhookStatusPending, WebhookStatusFailed, true},
+		{WebhookStatusDelivered, WebhookStatusDelivered, true},
+		{WebhookStatusFailed, WebhookStatusFailed, true},
+		{WebhookStatusDelivered, WebhookStatusFailed, false},
+		{WebhookStatusFailed, WebhookStatusDelivered, false},
+		{WebhookStatusDelivered, WebhookStatusPending, false},
+		{WebhookStatusFailed, WebhookStatusPending, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.from)+"->"+string(tt.to), func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.from.CanTransitionTo(tt.to))
+		})
+	}
+}
+
+func TestWebhookDeliveryLog_TransitionTo(t *testing.T) {
+	log := &WebhookDeliveryLog{Status: WebhookStatusPending}
+	assert.NoError(t, log.TransitionTo(WebhookStatusDelivered))
+	assert.Equal(t, WebhookStatusDelivered, log.Status)
+
+	err := log.TransitionTo(WebhookStatusFailed)
+	assert.ErrorIs(t, err, ErrInvalidWebhookTransition)
+	assert.Equal(t, WebhookStatusDelivered, log.Status, "rejected transition leaves status unchanged")
+
+	log = &WebhookDeliveryLog{Status: WebhookStatusFailed}
+	assert.ErrorIs(t, log.TransitionTo(WebhookStatusDelivered), ErrInvalidWebhookTransition)
+	assert.Equal(t, WebhookStatusFailed, log.Status)
+}
+
+func TestClaimAudit_OncePerRequest(t *testing.T) {
+	ctx := ContextWithRequestID(context.Background(), "req-1")
+	assert.Equal(t, "req-1", RequestIDFromContext(ctx))
+
+	// Derived contexts share the request's claim
+	child, cancel := context.WithCancel(ctx)
+	defer cancel()
+	assert.True(t, ClaimAudit(child))
+	assert.False(t, ClaimAudit(ctx))
+
+	other := ContextWithRequestID(context.Background(), "req-2")
+	assert.True(t, ClaimAudit(other), "each request has its own claim")
+
+	// Outside a request nothing is deduplicated
+	assert.True(t, ClaimAudit(context.Background()))
+	assert.True(t, ClaimAudit(context.Background()))
+	assert.Equal(t, "", RequestIDFromContext(context.Background()))
+}
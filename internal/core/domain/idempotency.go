@@ -1,9 +1,14 @@
 package domain
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 )
 
 // IdempotencyLog represents a cached transaction result to prevent double-processing.
@@ -12,14 +17,130 @@ type IdempotencyLog struct {
 	TransactionID uuid.UUID `json:"transaction_id"`
 	ResponseJSON  []byte    `json:"response_json"` // Cached response to return
 	CreatedAt     time.Time `json:"created_at"`
+	// RequestHash fingerprints the request that produced the response (see
+	// PaymentRequestHash); empty for operations not hashed and for logs
+	// written before it was recorded.
+	RequestHash string `json:"request_hash,omitempty"`
+}
+
+// PaymentRequestHash returns the hex SHA-256 of a payment's canonical
+// fields, so a retry can be told apart from a different payment reusing
+// its idempotency key. The amount is encoded as a bare JSON number, so a
+// whole amount hashes as it did when amounts were int64. Currency codes are
+// case-insensitive, so the currency is upper-cased first. Callers pass an
+// empty referenceID for a payment keyed by an explicit Idempotency-Key: a
+// retry under that key may carry a fresh reference and is still a retry.
+func PaymentRequestHash(merchantID uuid.UUID, amount decimal.Decimal, currency, referenceID string) string {
+	b, _ := json.Marshal(struct {
+		MerchantID  uuid.UUID   `json:"merchant_id"`
+		Amount      json.Number `json:"amount"`
+		Currency    string      `json:"currency"`
+		ReferenceID string      `json:"reference_id"`
+	}{merchantID, json.Number(amount.String()), strings.ToUpper(currency), referenceID})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// MaxIdempotencyKeyLength is the width of idempotency_logs.key. Every Build*
+// function returns a key of at most this length, whatever its input.
+const MaxIdempotencyKeyLength = 255
+
+// MaxIdempotencyKeyPartLength is the longest client-supplied part (reference
+// or Idempotency-Key) kept verbatim in a key. Longer parts are replaced by
+// their SHA-256, so keys stay bounded in Redis and fit the column. It is above
+// MaxReferenceIDLength so that valid references are never hashed.
+const MaxIdempotencyKeyPartLength = 128
+
+// hashedKeyPartPrefix marks a key part replaced by its hash.
+const hashedKeyPartPrefix = "sha256:"
+
+// boundKeyPart returns part, or its hash if it is too long. Parts that
+// already start with hashedKeyPartPrefix are hashed as well, so a verbatim
+// part can never equal the hash of a different one.
+func boundKeyPart(part string) string {
+	if len(part) <= MaxIdempotencyKeyPartLength && !strings.HasPrefix(part, hashedKeyPartPrefix) {
+		return part
+	}
+	sum := sha256.Sum256([]byte(part))
+	return hashedKeyPartPrefix + hex.EncodeToString(sum[:])
+}
+
+// ReferenceScope selects how long a merchant's reference_id must stay unique.
+type ReferenceScope string
+
+const (
+	// ReferenceScopeGlobal keys operations by reference alone: a reference
+	// is replayed for as long as its idempotency log is kept.
+	ReferenceScopeGlobal ReferenceScope = "global"
+	// ReferenceScopeDaily adds the day to the key, for merchants that
+	// recycle order numbers daily: the same reference on another day is a
+	// new operation.
+	ReferenceScopeDaily ReferenceScope = "daily"
+)
+
+// IsValid reports whether s is a known reference scope.
+func (s ReferenceScope) IsValid() bool {
+	return s == ReferenceScopeGlobal || s == ReferenceScopeDaily
+}
+
+// ReferenceDayLayout formats the day in daily-scoped idempotency keys.
+const ReferenceDayLayout = "20060102"
+
+// DailyReference returns the reference part of a daily-scoped key,
+// "YYYYMMDD:reference", for the day of t in t's location. Passed to a Build*
+// function it yields e.g. "merchant_id:YYYYMMDD:reference". References are
+// at most MaxReferenceIDLength, so the result is never hashed.
+func DailyReference(t time.Time, referenceID string) string {
+	return t.Format(ReferenceDayLayout) + ":" + referenceID
 }
 
 // BuildIdempotencyKey constructs the standard key format.
 func BuildIdempotencyKey(merchantID uuid.UUID, referenceID string) string {
-	return merchantID.String() + ":" + referenceID
+	return merchantID.String() + ":" + boundKeyPart(referenceID)
+}
+
+// BuildPaymentIdempotencyKey constructs the key for a payment sent with an
+// explicit Idempotency-Key. References cannot contain ':', so it never
+// equals a BuildIdempotencyKey key.
+func BuildPaymentIdempotencyKey(merchantID uuid.UUID, idempotencyKey string) string {
+	return merchantID.String() + ":idempotency-key:" + boundKeyPart(idempotencyKey)
+}
+
+// BuildTopupIdempotencyKey constructs the key for topup idempotency.
+func BuildTopupIdempotencyKey(merchantID uuid.UUID, referenceID string) string {
+	return merchantID.String() + ":topup:" + boundKeyPart(referenceID)
+}
+
+// BuildRegisterIdempotencyKey constructs the key for merchant registration idempotency.
+// Registration is unauthenticated, so the key is scoped by the client-supplied value only.
+func BuildRegisterIdempotencyKey(idempotencyKey string) string {
+	return "register:" + boundKeyPart(idempotencyKey)
+}
+
+// BuildRotateKeysIdempotencyKey constructs the key for API key rotation idempotency.
+func BuildRotateKeysIdempotencyKey(merchantID uuid.UUID, idempotencyKey string) string {
+	return merchantID.String() + ":rotate-keys:" + boundKeyPart(idempotencyKey)
 }
 
 // BuildRefundIdempotencyKey constructs the key for refund idempotency.
 func BuildRefundIdempotencyKey(merchantID uuid.UUID, originalReferenceID string) string {
-	return merchantID.String() + ":refund:" + originalReferenceID
+	return merchantID.String() + ":refund:" + boundKeyPart(originalReferenceID)
+}
+
+// BuildPartialRefundIdempotencyKey constructs the key for a refund that
+// carries its own reference or Idempotency-Key (refundKey), so each refund of
+// a payment is keyed apart from the others.
+func BuildPartialRefundIdempotencyKey(merchantID uuid.UUID, originalReferenceID, refundKey string) string {
+	return BuildRefundIdempotencyKey(merchantID, originalReferenceID) + ":" + boundKeyPart(refundKey)
+}
+
+// BuildReversalIdempotencyKey constructs the key for reversal idempotency.
+func BuildReversalIdempotencyKey(merchantID uuid.UUID, originalReferenceID string) string {
+	return merchantID.String() + ":reversal:" + boundKeyPart(originalReferenceID)
+}
+
+// BuildRefundBatchIdempotencyKey constructs the key for batch refund
+// idempotency from the client-supplied Idempotency-Key.
+func BuildRefundBatchIdempotencyKey(merchantID uuid.UUID, idempotencyKey string) string {
+	return merchantID.String() + ":refund_batch:" + boundKeyPart(idempotencyKey)
 }
@@ -15,18 +15,89 @@ const (
 	MerchantStatusDeactivated MerchantStatus = "DEACTIVATED"
 )
 
+// WebhookPayloadMode controls how much transaction detail webhooks carry.
+type WebhookPayloadMode string
+
+const (
+	WebhookPayloadFull    WebhookPayloadMode = "full"    // Every field of the pinned version
+	WebhookPayloadMinimal WebhookPayloadMode = "minimal" // IDs and status only; details are fetched via the API
+)
+
+// IsValid reports whether m is a known payload mode.
+func (m WebhookPayloadMode) IsValid() bool {
+	return m == WebhookPayloadFull || m == WebhookPayloadMinimal
+}
+
 // Merchant represents a registered merchant in the system.
 type Merchant struct {
-	ID           uuid.UUID      `json:"id"`
-	Username     string         `json:"username"`
-	PasswordHash string         `json:"-"` // Never expose
-	MerchantName string         `json:"merchant_name"`
-	AccessKey    string         `json:"access_key"`
-	SecretKeyEnc string         `json:"-"` // Encrypted, never expose
-	WebhookURL   *string        `json:"webhook_url,omitempty"`
-	Status       MerchantStatus `json:"status"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
+	ID                    uuid.UUID      `json:"id"`
+	Username              string         `json:"username"`
+	PasswordHash          string         `json:"-"` // Never expose
+	MerchantName          string         `json:"merchant_name"`
+	AccessKey             string         `json:"access_key"`
+	SecretKeyEnc          string         `json:"-"` // Encrypted, never expose
+	WebhookURL            *string        `json:"webhook_url,omitempty"`
+	WebhookVersion        *string        `json:"webhook_version,omitempty"` // Pinned payload version; nil = oldest
+	SynchronousWebhook    bool           `json:"synchronous_webhook"`       // Payment calls wait for the first webhook attempt
+	RequireIdempotencyKey bool           `json:"require_idempotency_key"`   // Payments without an Idempotency-Key header are rejected
+	Status                MerchantStatus `json:"status"`
+	LastUsedAt            *time.Time     `json:"last_used_at,omitempty"`      // Last successful HMAC auth with these keys
+	LastLoginAt           *time.Time     `json:"last_login_at,omitempty"`     // Last successful dashboard login
+	SecretRotatedAt       *time.Time     `json:"secret_rotated_at,omitempty"` // Last key rotation; nil = original keys
+	CreatedAt             time.Time      `json:"created_at"`
+	UpdatedAt             time.Time      `json:"updated_at"`
+
+	// WebhookPayloadMode sets webhook verbosity; "" is treated as full
+	WebhookPayloadMode WebhookPayloadMode `json:"webhook_payload_mode"`
+
+	// SessionExpirySeconds overrides the dashboard access token lifetime,
+	// capped by jwt.max_session_expiry; nil = the global jwt.expiry
+	SessionExpirySeconds *int `json:"session_expiry_seconds,omitempty"`
+
+	// NotificationPreferences selects email/SMS notifications besides webhooks
+	NotificationPreferences NotificationPreferences `json:"notification_preferences"`
+
+	// PrimaryCurrency is the currency of the wallet created at registration,
+	// used when a balance query names none; "" is treated as DefaultCurrency
+	PrimaryCurrency string `json:"primary_currency"`
+}
+
+// DefaultCurrency is the primary currency of merchants registered without one.
+const DefaultCurrency = "VND"
+
+// Currency returns the merchant's primary currency.
+func (m *Merchant) Currency() string {
+	if m.PrimaryCurrency == "" {
+		return DefaultCurrency
+	}
+	return m.PrimaryCurrency
+}
+
+// MinSessionExpiry is the shortest session expiry a merchant may set.
+const MinSessionExpiry = time.Minute
+
+// SessionExpiry returns the merchant's access token lifetime override,
+// or zero if the global expiry applies.
+func (m *Merchant) SessionExpiry() time.Duration {
+	if m.SessionExpirySeconds == nil {
+		return 0
+	}
+	return time.Duration(*m.SessionExpirySeconds) * time.Second
+}
+
+// SecretExpiresAt returns when the current secret key exceeds maxAge,
+// counted from its last rotation or, if never rotated, from registration.
+// It returns nil when maxAge is zero (no expiry).
+func (m *Merchant) SecretExpiresAt(maxAge time.Duration) *time.Time {
+	if maxAge <= 0 {
+		return nil
+	}
+	issued := m.CreatedAt
+	if m.SecretRotatedAt != nil {
+		issued = *m.SecretRotatedAt
+	}
+	expires := issued.Add(maxAge)
+	return &expires
 }
 
 // IsActive returns true if the merchant account is active.
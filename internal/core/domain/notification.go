@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NotificationEvent names a merchant event that can trigger a notification
+// outside webhooks, e.g. an email to the merchant's operations team.
+type NotificationEvent string
+
+const (
+	NotificationKeyRotation NotificationEvent = "key_rotation" // API keys were rotated
+	NotificationLargeRefund NotificationEvent = "large_refund" // A refund at or above the configured threshold
+)
+
+// IsValid reports whether e is a known notification event.
+func (e NotificationEvent) IsValid() bool {
+	return e == NotificationKeyRotation || e == NotificationLargeRefund
+}
+
+// NotificationChannel names a notification delivery channel.
+type NotificationChannel string
+
+const (
+	NotificationChannelEmail NotificationChannel = "email"
+	NotificationChannelSMS   NotificationChannel = "sms"
+)
+
+// NotificationPreferences selects which events a merchant is notified of and
+// where. A channel is used when its address is set. The zero value sends
+// nothing.
+type NotificationPreferences struct {
+	Events []NotificationEvent `json:"events"`
+	Email  string              `json:"email,omitempty"`
+	Phone  string              `json:"phone,omitempty"` // E.164, e.g. +84901234567
+}
+
+// Wants reports whether the merchant asked to be notified of e.
+func (p NotificationPreferences) Wants(e NotificationEvent) bool {
+	for _, want := range p.Events {
+		if want == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Recipients returns the address to notify on each channel with one set.
+func (p NotificationPreferences) Recipients() map[NotificationChannel]string {
+	recipients := make(map[NotificationChannel]string, 2)
+	if p.Email != "" {
+		recipients[NotificationChannelEmail] = p.Email
+	}
+	if p.Phone != "" {
+		recipients[NotificationChannelSMS] = p.Phone
+	}
+	return recipients
+}
+
+// Notification is one event to deliver to one recipient.
+type Notification struct {
+	MerchantID uuid.UUID
+	Event      NotificationEvent
+	Channel    NotificationChannel
+	Recipient  string // Email address or phone number, per Channel
+	Message    string
+	OccurredAt time.Time
+}
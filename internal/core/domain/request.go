@@ -0,0 +1,40 @@
+package domain
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type requestScopeKey struct{}
+
+// requestScope is per-request state shared by every layer handling it.
+type requestScope struct {
+	id      string
+	audited atomic.Bool
+}
+
+// ContextWithRequestID starts a request scope identified by id.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestScopeKey{}, &requestScope{id: id})
+}
+
+// RequestIDFromContext returns the ID of the request ctx belongs to, or ""
+// outside a request.
+func RequestIDFromContext(ctx context.Context) string {
+	if scope, ok := ctx.Value(requestScopeKey{}).(*requestScope); ok {
+		return scope.id
+	}
+	return ""
+}
+
+// ClaimAudit reports whether the caller is the first to audit the request
+// ctx belongs to. Each request gets exactly one audit entry: whichever path
+// (service or HTTP middleware) claims it first writes it, and later claims
+// return false. Outside a request every claim succeeds.
+func ClaimAudit(ctx context.Context) bool {
+	scope, ok := ctx.Value(requestScopeKey{}).(*requestScope)
+	if !ok {
+		return true
+	}
+	return scope.audited.CompareAndSwap(false, true)
+}
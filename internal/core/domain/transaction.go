@@ -1,9 +1,14 @@
 package domain
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 )
 
 // TransactionType represents the kind of money movement.
@@ -13,8 +18,44 @@ const (
 	TransactionTypePayment TransactionType = "PAYMENT"
 	TransactionTypeRefund  TransactionType = "REFUND"
 	TransactionTypeTopup   TransactionType = "TOPUP"
+	// TransactionTypeReversal credits back a payment reversed by an operator
+	// (e.g. for fraud). Unlike a refund it is not merchant-initiated and sends
+	// no webhook.
+	TransactionTypeReversal TransactionType = "REVERSAL"
 )
 
+// IsValid reports whether t is a known transaction type.
+func (t TransactionType) IsValid() bool {
+	switch t {
+	case TransactionTypePayment, TransactionTypeRefund, TransactionTypeTopup, TransactionTypeReversal:
+		return true
+	}
+	return false
+}
+
+// MaxReferenceIDLength is the width of transactions.reference_id, the longest
+// reference any caller can use.
+const MaxReferenceIDLength = 100
+
+// DerivedReference returns the reference of a transaction recorded against
+// another: prefix followed by the other's reference, e.g. "REVERSAL-ORD-1".
+// When that would exceed MaxReferenceIDLength the reference is replaced by its
+// hex SHA-256, so the result still fits the column and stays distinct.
+func DerivedReference(prefix, referenceID string) string {
+	if len(prefix)+len(referenceID) <= MaxReferenceIDLength {
+		return prefix + referenceID
+	}
+	sum := sha256.Sum256([]byte(referenceID))
+	return prefix + hex.EncodeToString(sum[:])
+}
+
+// MaxRefundReasonLength caps the refund reason stored as ExtraData, in characters.
+const MaxRefundReasonLength = 500
+
+// DefaultMaxExtraDataBytes caps ExtraData as stored (after sanitising), in
+// bytes, unless configured otherwise.
+const DefaultMaxExtraDataBytes = 4096
+
 // TransactionStatus represents the lifecycle state of a transaction.
 type TransactionStatus string
 
@@ -25,6 +66,15 @@ const (
 	TransactionStatusReversed TransactionStatus = "REVERSED"
 )
 
+// IsValid reports whether s is a known transaction status.
+func (s TransactionStatus) IsValid() bool {
+	switch s {
+	case TransactionStatusPending, TransactionStatusSuccess, TransactionStatusFailed, TransactionStatusReversed:
+		return true
+	}
+	return false
+}
+
 // Transaction represents an immutable ledger entry for money movement.
 type Transaction struct {
 	ID                    uuid.UUID         `json:"id"`
@@ -41,6 +91,31 @@ type Transaction struct {
 	OriginalTransactionID *uuid.UUID        `json:"original_transaction_id,omitempty"`
 	CreatedAt             time.Time         `json:"created_at"`
 	ProcessedAt           *time.Time        `json:"processed_at,omitempty"`
+	Currency              string            `json:"currency,omitempty"` // Wallet currency; empty for rows before it was recorded
+	// AmountDecimal is the exact amount when it has a fractional part, which
+	// only DecimalBalance wallets accept. Amount then holds its integer part.
+	AmountDecimal *decimal.Decimal `json:"amount_decimal,omitempty"`
+	// InitiatedBy is the access key of the credential that created the
+	// transaction; empty for rows recorded before it was tracked.
+	InitiatedBy string `json:"initiated_by,omitempty"`
+}
+
+// ExactAmount returns the transaction's amount including any fractional part.
+func (t *Transaction) ExactAmount() decimal.Decimal {
+	if t.AmountDecimal != nil {
+		return *t.AmountDecimal
+	}
+	return decimal.NewFromInt(t.Amount)
+}
+
+// SplitAmount splits amount into the Amount and AmountDecimal fields of a
+// transaction or request: AmountDecimal is set only when amount has a
+// fractional part.
+func SplitAmount(amount decimal.Decimal) (int64, *decimal.Decimal) {
+	if amount.IsInteger() {
+		return amount.IntPart(), nil
+	}
+	return amount.IntPart(), &amount
 }
 
 // IsTerminal returns true if the transaction is in a final state.
@@ -50,8 +125,120 @@ func (t *Transaction) IsTerminal() bool {
 		t.Status == TransactionStatusReversed
 }
 
+// HasProcessedAt reports whether ProcessedAt holds a real time. A zero time
+// (e.g. from a cached transaction round-tripped through JSON) counts as unset.
+func (t *Transaction) HasProcessedAt() bool {
+	return t.ProcessedAt != nil && !t.ProcessedAt.IsZero()
+}
+
+// IsReversible returns true if an operator can reverse this transaction: a
+// successful payment not already reversed by a refund or earlier reversal.
+func (t *Transaction) IsReversible() bool {
+	return t.TransactionType == TransactionTypePayment &&
+		t.Status == TransactionStatusSuccess
+}
+
 // IsRefundable returns true if this transaction can be refunded.
 func (t *Transaction) IsRefundable() bool {
 	return t.TransactionType == TransactionTypePayment &&
 		t.Status == TransactionStatusSuccess
 }
+
+// SystemTopupSignature is the Signature recorded on topups, which credit a
+// wallet without a signed merchant request.
+const SystemTopupSignature = "SYSTEM_TOPUP"
+
+// ErrInvalidTransaction is returned by NewTransaction when the fields given
+// break a ledger invariant.
+var ErrInvalidTransaction = errors.New("invalid transaction")
+
+// TransactionParams holds the fields of a new ledger entry. Fields left
+// zero get the defaults described on NewTransaction.
+type TransactionParams struct {
+	Type            TransactionType
+	ReferenceID     string
+	MerchantID      uuid.UUID
+	WalletID        uuid.UUID
+	Amount          int64
+	AmountDecimal   *decimal.Decimal // As on Transaction
+	AmountEncrypted string
+	Currency        string
+	Signature       string
+	ClientIP        string
+	ExtraData       *string
+	// OriginalTransactionID is required for refunds and reversals and
+	// rejected on any other type.
+	OriginalTransactionID *uuid.UUID
+	InitiatedBy           string
+	Now                   time.Time // Defaults to time.Now()
+}
+
+// NewTransaction builds a successful, processed transaction from p. It
+// assigns a new ID, stamps CreatedAt and ProcessedAt with p.Now in UTC and
+// signs topups with SystemTopupSignature unless p.Signature is set. It
+// returns an error wrapping ErrInvalidTransaction if p is missing a required
+// field or sets one its type does not allow.
+func NewTransaction(p TransactionParams) (*Transaction, error) {
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidTransaction, err)
+	}
+
+	now := p.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	now = now.UTC()
+	signature := p.Signature
+	if signature == "" && p.Type == TransactionTypeTopup {
+		signature = SystemTopupSignature
+	}
+	return &Transaction{
+		ID:                    uuid.New(),
+		ReferenceID:           p.ReferenceID,
+		MerchantID:            p.MerchantID,
+		WalletID:              p.WalletID,
+		Amount:                p.Amount,
+		AmountDecimal:         p.AmountDecimal,
+		AmountEncrypted:       p.AmountEncrypted,
+		TransactionType:       p.Type,
+		Status:                TransactionStatusSuccess,
+		Signature:             signature,
+		ClientIP:              p.ClientIP,
+		ExtraData:             p.ExtraData,
+		OriginalTransactionID: p.OriginalTransactionID,
+		CreatedAt:             now,
+		ProcessedAt:           &now,
+		Currency:              p.Currency,
+		InitiatedBy:           p.InitiatedBy,
+	}, nil
+}
+
+func (p TransactionParams) validate() error {
+	switch {
+	case !p.Type.IsValid():
+		return fmt.Errorf("unknown type %q", p.Type)
+	case p.ReferenceID == "":
+		return errors.New("reference ID is required")
+	case p.MerchantID == uuid.Nil:
+		return errors.New("merchant ID is required")
+	case p.WalletID == uuid.Nil:
+		return errors.New("wallet ID is required")
+	case p.AmountDecimal == nil && p.Amount <= 0:
+		return fmt.Errorf("amount must be positive, got %d", p.Amount)
+	case p.AmountDecimal != nil && p.AmountDecimal.Sign() <= 0:
+		return fmt.Errorf("amount must be positive, got %s", p.AmountDecimal)
+	case p.AmountDecimal != nil && p.AmountDecimal.IntPart() != p.Amount:
+		return fmt.Errorf("amount %d is not the integer part of %s", p.Amount, p.AmountDecimal)
+	case p.AmountEncrypted == "":
+		return errors.New("encrypted amount is required")
+	}
+
+	credit := p.Type == TransactionTypeRefund || p.Type == TransactionTypeReversal
+	switch {
+	case credit && (p.OriginalTransactionID == nil || *p.OriginalTransactionID == uuid.Nil):
+		return fmt.Errorf("%s requires an original transaction ID", p.Type)
+	case !credit && p.OriginalTransactionID != nil:
+		return fmt.Errorf("%s cannot reference an original transaction", p.Type)
+	}
+	return nil
+}
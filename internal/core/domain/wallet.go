@@ -1,11 +1,18 @@
 package domain
 
 import (
+	"bytes"
+	"errors"
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// ErrWalletExists is returned when creating a wallet in a currency the
+// merchant already has a wallet for.
+var ErrWalletExists = errors.New("wallet already exists for this merchant and currency")
+
 // Wallet represents a merchant's currency wallet with encrypted balance.
 type Wallet struct {
 	ID               uuid.UUID `json:"id"`
@@ -15,4 +22,23 @@ type Wallet struct {
 	LastAuditHash    *string   `json:"-"` // Integrity check hash
 	CreatedAt        time.Time `json:"created_at"`
 	UpdatedAt        time.Time `json:"updated_at"`
+	DecimalBalance   bool      `json:"decimal_balance"` // Balance plaintext is a decimal string, not int64 minor units
+}
+
+// WalletLockOrder returns ids without duplicates, sorted ascending: the order
+// wallets must be locked in. With one global order, two transactions locking
+// the same wallets can never each hold one the other is waiting for.
+func WalletLockOrder(ids ...uuid.UUID) []uuid.UUID {
+	ordered := make([]uuid.UUID, 0, len(ids))
+	seen := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			ordered = append(ordered, id)
+		}
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		return bytes.Compare(ordered[i][:], ordered[j][:]) < 0
+	})
+	return ordered
 }
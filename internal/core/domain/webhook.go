@@ -1,6 +1,8 @@
 package domain
 
 import (
+"errors"
+"fmt"
 "time"
 
 "github.com/google/uuid"
@@ -15,6 +17,26 @@ WebhookStatusDelivered WebhookStatus = "DELIVERED"
 WebhookStatusFailed    WebhookStatus = "FAILED"
 )
 
+// ErrInvalidWebhookTransition is returned when a status change would move a
+// delivery log out of a terminal state (DELIVERED or FAILED).
+var ErrInvalidWebhookTransition = errors.New("invalid webhook delivery status transition")
+
+// IsTerminal returns true if no further delivery attempts will be recorded.
+func (s WebhookStatus) IsTerminal() bool {
+return s == WebhookStatusDelivered || s == WebhookStatusFailed
+}
+
+// CanTransitionTo reports whether a log in status s may move to next.
+// PENDING may move anywhere; a terminal status may only be re-applied
+// (e.g. a duplicate late 200), never flipped to the other terminal status
+// or back to PENDING.
+func (s WebhookStatus) CanTransitionTo(next WebhookStatus) bool {
+if !s.IsTerminal() {
+return true
+}
+return s == next
+}
+
 // WebhookDeliveryLog records each webhook delivery attempt.
 type WebhookDeliveryLog struct {
 ID            uuid.UUID     `json:"id"`
@@ -30,3 +52,13 @@ LastError     *string       `json:"last_error"`
 CreatedAt     time.Time     `json:"created_at"`
 UpdatedAt     time.Time     `json:"updated_at"`
 }
+
+// TransitionTo moves the log to next, or returns ErrInvalidWebhookTransition
+// leaving the log unchanged.
+func (l *WebhookDeliveryLog) TransitionTo(next WebhookStatus) error {
+if !l.Status.CanTransitionTo(next) {
+return fmt.Errorf("%w: %s -> %s", ErrInvalidWebhookTransition, l.Status, next)
+}
+l.Status = next
+return nil
+}
@@ -14,9 +14,11 @@ import (
 	reflect "reflect"
 	domain "secure-payment-gateway/internal/core/domain"
 	ports "secure-payment-gateway/internal/core/ports"
+	time "time"
 
 	uuid "github.com/google/uuid"
 	pgx "github.com/jackc/pgx/v5"
+	decimal "github.com/shopspring/decimal"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -45,17 +47,17 @@ func (m *MockMerchantRepository) EXPECT() *MockMerchantRepositoryMockRecorder {
 }
 
 // Create mocks base method.
-func (m *MockMerchantRepository) Create(ctx context.Context, merchant *domain.Merchant) error {
+func (m *MockMerchantRepository) Create(ctx context.Context, tx pgx.Tx, merchant *domain.Merchant) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Create", ctx, merchant)
+	ret := m.ctrl.Call(m, "Create", ctx, tx, merchant)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Create indicates an expected call of Create.
-func (mr *MockMerchantRepositoryMockRecorder) Create(ctx, merchant any) *gomock.Call {
+func (mr *MockMerchantRepositoryMockRecorder) Create(ctx, tx, merchant any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockMerchantRepository)(nil).Create), ctx, merchant)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockMerchantRepository)(nil).Create), ctx, tx, merchant)
 }
 
 // GetByAccessKey mocks base method.
@@ -117,6 +119,34 @@ func (mr *MockMerchantRepositoryMockRecorder) Update(ctx, merchant any) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockMerchantRepository)(nil).Update), ctx, merchant)
 }
 
+// UpdateLastLoginAt mocks base method.
+func (m *MockMerchantRepository) UpdateLastLoginAt(ctx context.Context, id uuid.UUID, loginAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateLastLoginAt", ctx, id, loginAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateLastLoginAt indicates an expected call of UpdateLastLoginAt.
+func (mr *MockMerchantRepositoryMockRecorder) UpdateLastLoginAt(ctx, id, loginAt any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateLastLoginAt", reflect.TypeOf((*MockMerchantRepository)(nil).UpdateLastLoginAt), ctx, id, loginAt)
+}
+
+// UpdateLastUsedAt mocks base method.
+func (m *MockMerchantRepository) UpdateLastUsedAt(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateLastUsedAt", ctx, id, usedAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateLastUsedAt indicates an expected call of UpdateLastUsedAt.
+func (mr *MockMerchantRepositoryMockRecorder) UpdateLastUsedAt(ctx, id, usedAt any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateLastUsedAt", reflect.TypeOf((*MockMerchantRepository)(nil).UpdateLastUsedAt), ctx, id, usedAt)
+}
+
 // MockWalletRepository is a mock of WalletRepository interface.
 type MockWalletRepository struct {
 	ctrl     *gomock.Controller
@@ -215,6 +245,56 @@ func (mr *MockWalletRepositoryMockRecorder) GetByMerchantIDForUpdate(ctx, tx, me
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByMerchantIDForUpdate", reflect.TypeOf((*MockWalletRepository)(nil).GetByMerchantIDForUpdate), ctx, tx, merchantID, currency)
 }
 
+// GetOrCreateForUpdate mocks base method.
+func (m *MockWalletRepository) GetOrCreateForUpdate(ctx context.Context, tx pgx.Tx, wallet *domain.Wallet) (*domain.Wallet, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrCreateForUpdate", ctx, tx, wallet)
+	ret0, _ := ret[0].(*domain.Wallet)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrCreateForUpdate indicates an expected call of GetOrCreateForUpdate.
+func (mr *MockWalletRepositoryMockRecorder) GetOrCreateForUpdate(ctx, tx, wallet any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrCreateForUpdate", reflect.TypeOf((*MockWalletRepository)(nil).GetOrCreateForUpdate), ctx, tx, wallet)
+}
+
+// ListByMerchantID mocks base method.
+func (m *MockWalletRepository) ListByMerchantID(ctx context.Context, merchantID uuid.UUID) ([]domain.Wallet, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListByMerchantID", ctx, merchantID)
+	ret0, _ := ret[0].([]domain.Wallet)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListByMerchantID indicates an expected call of ListByMerchantID.
+func (mr *MockWalletRepositoryMockRecorder) ListByMerchantID(ctx, merchantID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListByMerchantID", reflect.TypeOf((*MockWalletRepository)(nil).ListByMerchantID), ctx, merchantID)
+}
+
+// LockForUpdate mocks base method.
+func (m *MockWalletRepository) LockForUpdate(ctx context.Context, tx pgx.Tx, ids ...uuid.UUID) (map[uuid.UUID]*domain.Wallet, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, tx}
+	for _, a := range ids {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "LockForUpdate", varargs...)
+	ret0, _ := ret[0].(map[uuid.UUID]*domain.Wallet)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LockForUpdate indicates an expected call of LockForUpdate.
+func (mr *MockWalletRepositoryMockRecorder) LockForUpdate(ctx, tx any, ids ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, tx}, ids...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LockForUpdate", reflect.TypeOf((*MockWalletRepository)(nil).LockForUpdate), varargs...)
+}
+
 // UpdateBalance mocks base method.
 func (m *MockWalletRepository) UpdateBalance(ctx context.Context, tx pgx.Tx, walletID uuid.UUID, encryptedBalance string) error {
 	m.ctrl.T.Helper()
@@ -268,6 +348,36 @@ func (mr *MockTransactionRepositoryMockRecorder) CheckRefundExists(ctx, original
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckRefundExists", reflect.TypeOf((*MockTransactionRepository)(nil).CheckRefundExists), ctx, originalTxID)
 }
 
+// CountRefunds mocks base method.
+func (m *MockTransactionRepository) CountRefunds(ctx context.Context, originalTxID uuid.UUID) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountRefunds", ctx, originalTxID)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountRefunds indicates an expected call of CountRefunds.
+func (mr *MockTransactionRepositoryMockRecorder) CountRefunds(ctx, originalTxID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountRefunds", reflect.TypeOf((*MockTransactionRepository)(nil).CountRefunds), ctx, originalTxID)
+}
+
+// CountTodayForUpdate mocks base method.
+func (m *MockTransactionRepository) CountTodayForUpdate(ctx context.Context, tx pgx.Tx, merchantID uuid.UUID) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountTodayForUpdate", ctx, tx, merchantID)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountTodayForUpdate indicates an expected call of CountTodayForUpdate.
+func (mr *MockTransactionRepositoryMockRecorder) CountTodayForUpdate(ctx, tx, merchantID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountTodayForUpdate", reflect.TypeOf((*MockTransactionRepository)(nil).CountTodayForUpdate), ctx, tx, merchantID)
+}
+
 // Create mocks base method.
 func (m *MockTransactionRepository) Create(ctx context.Context, tx pgx.Tx, transaction *domain.Transaction) error {
 	m.ctrl.T.Helper()
@@ -297,19 +407,34 @@ func (mr *MockTransactionRepositoryMockRecorder) GetByID(ctx, id any) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockTransactionRepository)(nil).GetByID), ctx, id)
 }
 
+// GetByIDForUpdate mocks base method.
+func (m *MockTransactionRepository) GetByIDForUpdate(ctx context.Context, tx pgx.Tx, id uuid.UUID) (*domain.Transaction, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByIDForUpdate", ctx, tx, id)
+	ret0, _ := ret[0].(*domain.Transaction)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByIDForUpdate indicates an expected call of GetByIDForUpdate.
+func (mr *MockTransactionRepositoryMockRecorder) GetByIDForUpdate(ctx, tx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByIDForUpdate", reflect.TypeOf((*MockTransactionRepository)(nil).GetByIDForUpdate), ctx, tx, id)
+}
+
 // GetByReference mocks base method.
-func (m *MockTransactionRepository) GetByReference(ctx context.Context, merchantID uuid.UUID, referenceID string) (*domain.Transaction, error) {
+func (m *MockTransactionRepository) GetByReference(ctx context.Context, merchantID uuid.UUID, referenceID string, newestFirst bool) (*domain.Transaction, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetByReference", ctx, merchantID, referenceID)
+	ret := m.ctrl.Call(m, "GetByReference", ctx, merchantID, referenceID, newestFirst)
 	ret0, _ := ret[0].(*domain.Transaction)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetByReference indicates an expected call of GetByReference.
-func (mr *MockTransactionRepositoryMockRecorder) GetByReference(ctx, merchantID, referenceID any) *gomock.Call {
+func (mr *MockTransactionRepositoryMockRecorder) GetByReference(ctx, merchantID, referenceID, newestFirst any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByReference", reflect.TypeOf((*MockTransactionRepository)(nil).GetByReference), ctx, merchantID, referenceID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByReference", reflect.TypeOf((*MockTransactionRepository)(nil).GetByReference), ctx, merchantID, referenceID, newestFirst)
 }
 
 // GetStats mocks base method.
@@ -343,6 +468,36 @@ func (mr *MockTransactionRepositoryMockRecorder) List(ctx, params any) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockTransactionRepository)(nil).List), ctx, params)
 }
 
+// SumRefunds mocks base method.
+func (m *MockTransactionRepository) SumRefunds(ctx context.Context, originalTxID uuid.UUID) (decimal.Decimal, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SumRefunds", ctx, originalTxID)
+	ret0, _ := ret[0].(decimal.Decimal)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SumRefunds indicates an expected call of SumRefunds.
+func (mr *MockTransactionRepositoryMockRecorder) SumRefunds(ctx, originalTxID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SumRefunds", reflect.TypeOf((*MockTransactionRepository)(nil).SumRefunds), ctx, originalTxID)
+}
+
+// SumTopupsSince mocks base method.
+func (m *MockTransactionRepository) SumTopupsSince(ctx context.Context, walletID uuid.UUID, since time.Time) (decimal.Decimal, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SumTopupsSince", ctx, walletID, since)
+	ret0, _ := ret[0].(decimal.Decimal)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SumTopupsSince indicates an expected call of SumTopupsSince.
+func (mr *MockTransactionRepositoryMockRecorder) SumTopupsSince(ctx, walletID, since any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SumTopupsSince", reflect.TypeOf((*MockTransactionRepository)(nil).SumTopupsSince), ctx, walletID, since)
+}
+
 // UpdateStatus mocks base method.
 func (m *MockTransactionRepository) UpdateStatus(ctx context.Context, tx pgx.Tx, id uuid.UUID, status domain.TransactionStatus) error {
 	m.ctrl.T.Helper()
@@ -395,6 +550,21 @@ func (mr *MockIdempotencyRepositoryMockRecorder) Create(ctx, tx, log any) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockIdempotencyRepository)(nil).Create), ctx, tx, log)
 }
 
+// DeleteOlderThan mocks base method.
+func (m *MockIdempotencyRepository) DeleteOlderThan(ctx context.Context, before time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteOlderThan", ctx, before)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteOlderThan indicates an expected call of DeleteOlderThan.
+func (mr *MockIdempotencyRepositoryMockRecorder) DeleteOlderThan(ctx, before any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteOlderThan", reflect.TypeOf((*MockIdempotencyRepository)(nil).DeleteOlderThan), ctx, before)
+}
+
 // Get mocks base method.
 func (m *MockIdempotencyRepository) Get(ctx context.Context, key string) (*domain.IdempotencyLog, error) {
 	m.ctrl.T.Helper()
@@ -448,6 +618,36 @@ func (mr *MockWebhookRepositoryMockRecorder) Create(ctx, log any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockWebhookRepository)(nil).Create), ctx, log)
 }
 
+// DeleteOlderThan mocks base method.
+func (m *MockWebhookRepository) DeleteOlderThan(ctx context.Context, status domain.WebhookStatus, before time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteOlderThan", ctx, status, before)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteOlderThan indicates an expected call of DeleteOlderThan.
+func (mr *MockWebhookRepositoryMockRecorder) DeleteOlderThan(ctx, status, before any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteOlderThan", reflect.TypeOf((*MockWebhookRepository)(nil).DeleteOlderThan), ctx, status, before)
+}
+
+// GetByID mocks base method.
+func (m *MockWebhookRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.WebhookDeliveryLog, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByID", ctx, id)
+	ret0, _ := ret[0].(*domain.WebhookDeliveryLog)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByID indicates an expected call of GetByID.
+func (mr *MockWebhookRepositoryMockRecorder) GetByID(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockWebhookRepository)(nil).GetByID), ctx, id)
+}
+
 // GetByTransactionID mocks base method.
 func (m *MockWebhookRepository) GetByTransactionID(ctx context.Context, txID uuid.UUID) ([]domain.WebhookDeliveryLog, error) {
 	m.ctrl.T.Helper()
@@ -463,6 +663,21 @@ func (mr *MockWebhookRepositoryMockRecorder) GetByTransactionID(ctx, txID any) *
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByTransactionID", reflect.TypeOf((*MockWebhookRepository)(nil).GetByTransactionID), ctx, txID)
 }
 
+// GetLatestByMerchant mocks base method.
+func (m *MockWebhookRepository) GetLatestByMerchant(ctx context.Context, merchantID uuid.UUID) (*domain.WebhookDeliveryLog, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLatestByMerchant", ctx, merchantID)
+	ret0, _ := ret[0].(*domain.WebhookDeliveryLog)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLatestByMerchant indicates an expected call of GetLatestByMerchant.
+func (mr *MockWebhookRepositoryMockRecorder) GetLatestByMerchant(ctx, merchantID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLatestByMerchant", reflect.TypeOf((*MockWebhookRepository)(nil).GetLatestByMerchant), ctx, merchantID)
+}
+
 // Update mocks base method.
 func (m *MockWebhookRepository) Update(ctx context.Context, log *domain.WebhookDeliveryLog) error {
 	m.ctrl.T.Helper()
@@ -17,6 +17,7 @@ import (
 	time "time"
 
 	uuid "github.com/google/uuid"
+	decimal "github.com/shopspring/decimal"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -140,6 +141,86 @@ func (mr *MockSignatureServiceMockRecorder) Verify(secretKey, payload, signature
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Verify", reflect.TypeOf((*MockSignatureService)(nil).Verify), secretKey, payload, signature)
 }
 
+// MockReceiptSigner is a mock of ReceiptSigner interface.
+type MockReceiptSigner struct {
+	ctrl     *gomock.Controller
+	recorder *MockReceiptSignerMockRecorder
+	isgomock struct{}
+}
+
+// MockReceiptSignerMockRecorder is the mock recorder for MockReceiptSigner.
+type MockReceiptSignerMockRecorder struct {
+	mock *MockReceiptSigner
+}
+
+// NewMockReceiptSigner creates a new mock instance.
+func NewMockReceiptSigner(ctrl *gomock.Controller) *MockReceiptSigner {
+	mock := &MockReceiptSigner{ctrl: ctrl}
+	mock.recorder = &MockReceiptSignerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockReceiptSigner) EXPECT() *MockReceiptSignerMockRecorder {
+	return m.recorder
+}
+
+// Algorithm mocks base method.
+func (m *MockReceiptSigner) Algorithm() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Algorithm")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// Algorithm indicates an expected call of Algorithm.
+func (mr *MockReceiptSignerMockRecorder) Algorithm() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Algorithm", reflect.TypeOf((*MockReceiptSigner)(nil).Algorithm))
+}
+
+// PublicKey mocks base method.
+func (m *MockReceiptSigner) PublicKey() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PublicKey")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// PublicKey indicates an expected call of PublicKey.
+func (mr *MockReceiptSignerMockRecorder) PublicKey() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PublicKey", reflect.TypeOf((*MockReceiptSigner)(nil).PublicKey))
+}
+
+// Sign mocks base method.
+func (m *MockReceiptSigner) Sign(message []byte) string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Sign", message)
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// Sign indicates an expected call of Sign.
+func (mr *MockReceiptSignerMockRecorder) Sign(message any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Sign", reflect.TypeOf((*MockReceiptSigner)(nil).Sign), message)
+}
+
+// Verify mocks base method.
+func (m *MockReceiptSigner) Verify(message []byte, signature string) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Verify", message, signature)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// Verify indicates an expected call of Verify.
+func (mr *MockReceiptSignerMockRecorder) Verify(message, signature any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Verify", reflect.TypeOf((*MockReceiptSigner)(nil).Verify), message, signature)
+}
+
 // MockHashService is a mock of HashService interface.
 type MockHashService struct {
 	ctrl     *gomock.Controller
@@ -234,6 +315,38 @@ func (mr *MockTokenServiceMockRecorder) Generate(merchantID, accessKey any) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Generate", reflect.TypeOf((*MockTokenService)(nil).Generate), merchantID, accessKey)
 }
 
+// GenerateRefresh mocks base method.
+func (m *MockTokenService) GenerateRefresh(merchantID uuid.UUID, accessKey string) (string, time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GenerateRefresh", merchantID, accessKey)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(time.Time)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GenerateRefresh indicates an expected call of GenerateRefresh.
+func (mr *MockTokenServiceMockRecorder) GenerateRefresh(merchantID, accessKey any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GenerateRefresh", reflect.TypeOf((*MockTokenService)(nil).GenerateRefresh), merchantID, accessKey)
+}
+
+// GenerateWithExpiry mocks base method.
+func (m *MockTokenService) GenerateWithExpiry(merchantID uuid.UUID, accessKey string, ttl time.Duration) (string, time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GenerateWithExpiry", merchantID, accessKey, ttl)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(time.Time)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GenerateWithExpiry indicates an expected call of GenerateWithExpiry.
+func (mr *MockTokenServiceMockRecorder) GenerateWithExpiry(merchantID, accessKey, ttl any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GenerateWithExpiry", reflect.TypeOf((*MockTokenService)(nil).GenerateWithExpiry), merchantID, accessKey, ttl)
+}
+
 // Validate mocks base method.
 func (m *MockTokenService) Validate(tokenString string) (*ports.TokenClaims, error) {
 	m.ctrl.T.Helper()
@@ -249,6 +362,21 @@ func (mr *MockTokenServiceMockRecorder) Validate(tokenString any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Validate", reflect.TypeOf((*MockTokenService)(nil).Validate), tokenString)
 }
 
+// ValidateRefresh mocks base method.
+func (m *MockTokenService) ValidateRefresh(tokenString string) (*ports.TokenClaims, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ValidateRefresh", tokenString)
+	ret0, _ := ret[0].(*ports.TokenClaims)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ValidateRefresh indicates an expected call of ValidateRefresh.
+func (mr *MockTokenServiceMockRecorder) ValidateRefresh(tokenString any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ValidateRefresh", reflect.TypeOf((*MockTokenService)(nil).ValidateRefresh), tokenString)
+}
+
 // MockIdempotencyCache is a mock of IdempotencyCache interface.
 type MockIdempotencyCache struct {
 	ctrl     *gomock.Controller
@@ -341,6 +469,21 @@ func (mr *MockNonceStoreMockRecorder) CheckAndSet(ctx, merchantID, nonce, ttl an
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckAndSet", reflect.TypeOf((*MockNonceStore)(nil).CheckAndSet), ctx, merchantID, nonce, ttl)
 }
 
+// Seen mocks base method.
+func (m *MockNonceStore) Seen(ctx context.Context, merchantID, nonce string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Seen", ctx, merchantID, nonce)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Seen indicates an expected call of Seen.
+func (mr *MockNonceStoreMockRecorder) Seen(ctx, merchantID, nonce any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Seen", reflect.TypeOf((*MockNonceStore)(nil).Seen), ctx, merchantID, nonce)
+}
+
 // MockPaymentService is a mock of PaymentService interface.
 type MockPaymentService struct {
 	ctrl     *gomock.Controller
@@ -410,6 +553,21 @@ func (mr *MockPaymentServiceMockRecorder) ProcessTopup(ctx, req any) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProcessTopup", reflect.TypeOf((*MockPaymentService)(nil).ProcessTopup), ctx, req)
 }
 
+// ReverseTransaction mocks base method.
+func (m *MockPaymentService) ReverseTransaction(ctx context.Context, req ports.ReversalRequest) (*domain.Transaction, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReverseTransaction", ctx, req)
+	ret0, _ := ret[0].(*domain.Transaction)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReverseTransaction indicates an expected call of ReverseTransaction.
+func (mr *MockPaymentServiceMockRecorder) ReverseTransaction(ctx, req any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReverseTransaction", reflect.TypeOf((*MockPaymentService)(nil).ReverseTransaction), ctx, req)
+}
+
 // MockAuthService is a mock of AuthService interface.
 type MockAuthService struct {
 	ctrl     *gomock.Controller
@@ -450,6 +608,36 @@ func (mr *MockAuthServiceMockRecorder) Login(ctx, username, password any) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Login", reflect.TypeOf((*MockAuthService)(nil).Login), ctx, username, password)
 }
 
+// LoginSession mocks base method.
+func (m *MockAuthService) LoginSession(ctx context.Context, username, password string) (*ports.SessionTokens, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LoginSession", ctx, username, password)
+	ret0, _ := ret[0].(*ports.SessionTokens)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LoginSession indicates an expected call of LoginSession.
+func (mr *MockAuthServiceMockRecorder) LoginSession(ctx, username, password any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoginSession", reflect.TypeOf((*MockAuthService)(nil).LoginSession), ctx, username, password)
+}
+
+// Refresh mocks base method.
+func (m *MockAuthService) Refresh(ctx context.Context, refreshToken string) (*ports.SessionTokens, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Refresh", ctx, refreshToken)
+	ret0, _ := ret[0].(*ports.SessionTokens)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Refresh indicates an expected call of Refresh.
+func (mr *MockAuthServiceMockRecorder) Refresh(ctx, refreshToken any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Refresh", reflect.TypeOf((*MockAuthService)(nil).Refresh), ctx, refreshToken)
+}
+
 // Register mocks base method.
 func (m *MockAuthService) Register(ctx context.Context, req ports.RegisterRequest) (*ports.RegisterResponse, error) {
 	m.ctrl.T.Helper()
@@ -489,6 +677,21 @@ func (m *MockReportingService) EXPECT() *MockReportingServiceMockRecorder {
 	return m.recorder
 }
 
+// ExportTransactions mocks base method.
+func (m *MockReportingService) ExportTransactions(ctx context.Context, params ports.TransactionListParams) ([]domain.Transaction, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportTransactions", ctx, params)
+	ret0, _ := ret[0].([]domain.Transaction)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExportTransactions indicates an expected call of ExportTransactions.
+func (mr *MockReportingServiceMockRecorder) ExportTransactions(ctx, params any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportTransactions", reflect.TypeOf((*MockReportingService)(nil).ExportTransactions), ctx, params)
+}
+
 // GetDashboardStats mocks base method.
 func (m *MockReportingService) GetDashboardStats(ctx context.Context, merchantID uuid.UUID, period string) (*ports.TransactionStats, error) {
 	m.ctrl.T.Helper()
@@ -505,19 +708,34 @@ func (mr *MockReportingServiceMockRecorder) GetDashboardStats(ctx, merchantID, p
 }
 
 // GetWalletBalance mocks base method.
-func (m *MockReportingService) GetWalletBalance(ctx context.Context, merchantID uuid.UUID) (int64, string, error) {
+func (m *MockReportingService) GetWalletBalance(ctx context.Context, merchantID uuid.UUID, currency string) (decimal.Decimal, string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetWalletBalance", ctx, merchantID)
-	ret0, _ := ret[0].(int64)
+	ret := m.ctrl.Call(m, "GetWalletBalance", ctx, merchantID, currency)
+	ret0, _ := ret[0].(decimal.Decimal)
 	ret1, _ := ret[1].(string)
 	ret2, _ := ret[2].(error)
 	return ret0, ret1, ret2
 }
 
 // GetWalletBalance indicates an expected call of GetWalletBalance.
-func (mr *MockReportingServiceMockRecorder) GetWalletBalance(ctx, merchantID any) *gomock.Call {
+func (mr *MockReportingServiceMockRecorder) GetWalletBalance(ctx, merchantID, currency any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWalletBalance", reflect.TypeOf((*MockReportingService)(nil).GetWalletBalance), ctx, merchantID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWalletBalance", reflect.TypeOf((*MockReportingService)(nil).GetWalletBalance), ctx, merchantID, currency)
+}
+
+// GetTransaction mocks base method.
+func (m *MockReportingService) GetTransaction(ctx context.Context, merchantID, transactionID uuid.UUID) (*domain.Transaction, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTransaction", ctx, merchantID, transactionID)
+	ret0, _ := ret[0].(*domain.Transaction)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTransaction indicates an expected call of GetTransaction.
+func (mr *MockReportingServiceMockRecorder) GetTransaction(ctx, merchantID, transactionID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTransaction", reflect.TypeOf((*MockReportingService)(nil).GetTransaction), ctx, merchantID, transactionID)
 }
 
 // ListTransactions mocks base method.
@@ -536,6 +754,36 @@ func (mr *MockReportingServiceMockRecorder) ListTransactions(ctx, params any) *g
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTransactions", reflect.TypeOf((*MockReportingService)(nil).ListTransactions), ctx, params)
 }
 
+// ListWalletBalances mocks base method.
+func (m *MockReportingService) ListWalletBalances(ctx context.Context, merchantID uuid.UUID) ([]ports.WalletBalance, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListWalletBalances", ctx, merchantID)
+	ret0, _ := ret[0].([]ports.WalletBalance)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListWalletBalances indicates an expected call of ListWalletBalances.
+func (mr *MockReportingServiceMockRecorder) ListWalletBalances(ctx, merchantID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListWalletBalances", reflect.TypeOf((*MockReportingService)(nil).ListWalletBalances), ctx, merchantID)
+}
+
+// PreviewBalance mocks base method.
+func (m *MockReportingService) PreviewBalance(ctx context.Context, merchantID uuid.UUID, currency string, deltas []int64) (*ports.BalancePreview, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PreviewBalance", ctx, merchantID, currency, deltas)
+	ret0, _ := ret[0].(*ports.BalancePreview)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PreviewBalance indicates an expected call of PreviewBalance.
+func (mr *MockReportingServiceMockRecorder) PreviewBalance(ctx, merchantID, currency, deltas any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PreviewBalance", reflect.TypeOf((*MockReportingService)(nil).PreviewBalance), ctx, merchantID, currency, deltas)
+}
+
 // MockWebhookService is a mock of WebhookService interface.
 type MockWebhookService struct {
 	ctrl     *gomock.Controller
@@ -560,6 +808,21 @@ func (m *MockWebhookService) EXPECT() *MockWebhookServiceMockRecorder {
 	return m.recorder
 }
 
+// DispatchWebhook mocks base method.
+func (m *MockWebhookService) DispatchWebhook(ctx context.Context, transaction *domain.Transaction) (*ports.WebhookDispatchResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DispatchWebhook", ctx, transaction)
+	ret0, _ := ret[0].(*ports.WebhookDispatchResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DispatchWebhook indicates an expected call of DispatchWebhook.
+func (mr *MockWebhookServiceMockRecorder) DispatchWebhook(ctx, transaction any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DispatchWebhook", reflect.TypeOf((*MockWebhookService)(nil).DispatchWebhook), ctx, transaction)
+}
+
 // EnqueueWebhook mocks base method.
 func (m *MockWebhookService) EnqueueWebhook(ctx context.Context, transaction *domain.Transaction) error {
 	m.ctrl.T.Helper()
@@ -574,6 +837,77 @@ func (mr *MockWebhookServiceMockRecorder) EnqueueWebhook(ctx, transaction any) *
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnqueueWebhook", reflect.TypeOf((*MockWebhookService)(nil).EnqueueWebhook), ctx, transaction)
 }
 
+// EventCatalog mocks base method.
+func (m *MockWebhookService) EventCatalog() *ports.WebhookCatalog {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EventCatalog")
+	ret0, _ := ret[0].(*ports.WebhookCatalog)
+	return ret0
+}
+
+// EventCatalog indicates an expected call of EventCatalog.
+func (mr *MockWebhookServiceMockRecorder) EventCatalog() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EventCatalog", reflect.TypeOf((*MockWebhookService)(nil).EventCatalog))
+}
+
+// GetDelivery mocks base method.
+func (m *MockWebhookService) GetDelivery(ctx context.Context, merchantID, logID uuid.UUID) (*domain.WebhookDeliveryLog, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDelivery", ctx, merchantID, logID)
+	ret0, _ := ret[0].(*domain.WebhookDeliveryLog)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDelivery indicates an expected call of GetDelivery.
+func (mr *MockWebhookServiceMockRecorder) GetDelivery(ctx, merchantID, logID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDelivery", reflect.TypeOf((*MockWebhookService)(nil).GetDelivery), ctx, merchantID, logID)
+}
+
+// GetLastDelivery mocks base method.
+func (m *MockWebhookService) GetLastDelivery(ctx context.Context, merchantID uuid.UUID) (*domain.WebhookDeliveryLog, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLastDelivery", ctx, merchantID)
+	ret0, _ := ret[0].(*domain.WebhookDeliveryLog)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLastDelivery indicates an expected call of GetLastDelivery.
+func (mr *MockWebhookServiceMockRecorder) GetLastDelivery(ctx, merchantID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastDelivery", reflect.TypeOf((*MockWebhookService)(nil).GetLastDelivery), ctx, merchantID)
+}
+
+// Stop mocks base method.
+func (m *MockWebhookService) Stop() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Stop")
+}
+
+// Stop indicates an expected call of Stop.
+func (mr *MockWebhookServiceMockRecorder) Stop() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockWebhookService)(nil).Stop))
+}
+
+// TestFireWebhook mocks base method.
+func (m *MockWebhookService) TestFireWebhook(ctx context.Context, merchantID uuid.UUID) (*ports.WebhookTestFireResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TestFireWebhook", ctx, merchantID)
+	ret0, _ := ret[0].(*ports.WebhookTestFireResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TestFireWebhook indicates an expected call of TestFireWebhook.
+func (mr *MockWebhookServiceMockRecorder) TestFireWebhook(ctx, merchantID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TestFireWebhook", reflect.TypeOf((*MockWebhookService)(nil).TestFireWebhook), ctx, merchantID)
+}
+
 // MockMerchantManagementService is a mock of MerchantManagementService interface.
 type MockMerchantManagementService struct {
 	ctrl     *gomock.Controller
@@ -614,18 +948,88 @@ func (mr *MockMerchantManagementServiceMockRecorder) GetProfile(ctx, merchantID
 }
 
 // RotateKeys mocks base method.
-func (m *MockMerchantManagementService) RotateKeys(ctx context.Context, merchantID uuid.UUID) (*ports.RotateKeysResponse, error) {
+func (m *MockMerchantManagementService) RotateKeys(ctx context.Context, merchantID uuid.UUID, idempotencyKey string) (*ports.RotateKeysResponse, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "RotateKeys", ctx, merchantID)
+	ret := m.ctrl.Call(m, "RotateKeys", ctx, merchantID, idempotencyKey)
 	ret0, _ := ret[0].(*ports.RotateKeysResponse)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // RotateKeys indicates an expected call of RotateKeys.
-func (mr *MockMerchantManagementServiceMockRecorder) RotateKeys(ctx, merchantID any) *gomock.Call {
+func (mr *MockMerchantManagementServiceMockRecorder) RotateKeys(ctx, merchantID, idempotencyKey any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateKeys", reflect.TypeOf((*MockMerchantManagementService)(nil).RotateKeys), ctx, merchantID, idempotencyKey)
+}
+
+// SetNotificationPreferences mocks base method.
+func (m *MockMerchantManagementService) SetNotificationPreferences(ctx context.Context, merchantID uuid.UUID, prefs domain.NotificationPreferences) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetNotificationPreferences", ctx, merchantID, prefs)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetNotificationPreferences indicates an expected call of SetNotificationPreferences.
+func (mr *MockMerchantManagementServiceMockRecorder) SetNotificationPreferences(ctx, merchantID, prefs any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetNotificationPreferences", reflect.TypeOf((*MockMerchantManagementService)(nil).SetNotificationPreferences), ctx, merchantID, prefs)
+}
+
+// SetRequireIdempotencyKey mocks base method.
+func (m *MockMerchantManagementService) SetRequireIdempotencyKey(ctx context.Context, merchantID uuid.UUID, required bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetRequireIdempotencyKey", ctx, merchantID, required)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetRequireIdempotencyKey indicates an expected call of SetRequireIdempotencyKey.
+func (mr *MockMerchantManagementServiceMockRecorder) SetRequireIdempotencyKey(ctx, merchantID, required any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetRequireIdempotencyKey", reflect.TypeOf((*MockMerchantManagementService)(nil).SetRequireIdempotencyKey), ctx, merchantID, required)
+}
+
+// SetSessionExpiry mocks base method.
+func (m *MockMerchantManagementService) SetSessionExpiry(ctx context.Context, merchantID uuid.UUID, expiry time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetSessionExpiry", ctx, merchantID, expiry)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetSessionExpiry indicates an expected call of SetSessionExpiry.
+func (mr *MockMerchantManagementServiceMockRecorder) SetSessionExpiry(ctx, merchantID, expiry any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetSessionExpiry", reflect.TypeOf((*MockMerchantManagementService)(nil).SetSessionExpiry), ctx, merchantID, expiry)
+}
+
+// SetSynchronousWebhook mocks base method.
+func (m *MockMerchantManagementService) SetSynchronousWebhook(ctx context.Context, merchantID uuid.UUID, enabled bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetSynchronousWebhook", ctx, merchantID, enabled)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetSynchronousWebhook indicates an expected call of SetSynchronousWebhook.
+func (mr *MockMerchantManagementServiceMockRecorder) SetSynchronousWebhook(ctx, merchantID, enabled any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetSynchronousWebhook", reflect.TypeOf((*MockMerchantManagementService)(nil).SetSynchronousWebhook), ctx, merchantID, enabled)
+}
+
+// SetWebhookPayloadMode mocks base method.
+func (m *MockMerchantManagementService) SetWebhookPayloadMode(ctx context.Context, merchantID uuid.UUID, mode domain.WebhookPayloadMode) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetWebhookPayloadMode", ctx, merchantID, mode)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetWebhookPayloadMode indicates an expected call of SetWebhookPayloadMode.
+func (mr *MockMerchantManagementServiceMockRecorder) SetWebhookPayloadMode(ctx, merchantID, mode any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateKeys", reflect.TypeOf((*MockMerchantManagementService)(nil).RotateKeys), ctx, merchantID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetWebhookPayloadMode", reflect.TypeOf((*MockMerchantManagementService)(nil).SetWebhookPayloadMode), ctx, merchantID, mode)
 }
 
 // UpdateWebhookURL mocks base method.
@@ -642,6 +1046,60 @@ func (mr *MockMerchantManagementServiceMockRecorder) UpdateWebhookURL(ctx, merch
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateWebhookURL", reflect.TypeOf((*MockMerchantManagementService)(nil).UpdateWebhookURL), ctx, merchantID, webhookURL)
 }
 
+// MockReceiptService is a mock of ReceiptService interface.
+type MockReceiptService struct {
+	ctrl     *gomock.Controller
+	recorder *MockReceiptServiceMockRecorder
+	isgomock struct{}
+}
+
+// MockReceiptServiceMockRecorder is the mock recorder for MockReceiptService.
+type MockReceiptServiceMockRecorder struct {
+	mock *MockReceiptService
+}
+
+// NewMockReceiptService creates a new mock instance.
+func NewMockReceiptService(ctrl *gomock.Controller) *MockReceiptService {
+	mock := &MockReceiptService{ctrl: ctrl}
+	mock.recorder = &MockReceiptServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockReceiptService) EXPECT() *MockReceiptServiceMockRecorder {
+	return m.recorder
+}
+
+// GetReceipt mocks base method.
+func (m *MockReceiptService) GetReceipt(ctx context.Context, merchantID, transactionID uuid.UUID) (*ports.SignedReceipt, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetReceipt", ctx, merchantID, transactionID)
+	ret0, _ := ret[0].(*ports.SignedReceipt)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetReceipt indicates an expected call of GetReceipt.
+func (mr *MockReceiptServiceMockRecorder) GetReceipt(ctx, merchantID, transactionID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReceipt", reflect.TypeOf((*MockReceiptService)(nil).GetReceipt), ctx, merchantID, transactionID)
+}
+
+// PublicKey mocks base method.
+func (m *MockReceiptService) PublicKey() (string, string) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PublicKey")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(string)
+	return ret0, ret1
+}
+
+// PublicKey indicates an expected call of PublicKey.
+func (mr *MockReceiptServiceMockRecorder) PublicKey() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PublicKey", reflect.TypeOf((*MockReceiptService)(nil).PublicKey))
+}
+
 // MockAuditService is a mock of AuditService interface.
 type MockAuditService struct {
 	ctrl     *gomock.Controller
@@ -677,3 +1135,77 @@ func (mr *MockAuditServiceMockRecorder) Log(ctx, log any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Log", reflect.TypeOf((*MockAuditService)(nil).Log), ctx, log)
 }
+
+// MockNotifier is a mock of Notifier interface.
+type MockNotifier struct {
+	ctrl     *gomock.Controller
+	recorder *MockNotifierMockRecorder
+	isgomock struct{}
+}
+
+// MockNotifierMockRecorder is the mock recorder for MockNotifier.
+type MockNotifierMockRecorder struct {
+	mock *MockNotifier
+}
+
+// NewMockNotifier creates a new mock instance.
+func NewMockNotifier(ctrl *gomock.Controller) *MockNotifier {
+	mock := &MockNotifier{ctrl: ctrl}
+	mock.recorder = &MockNotifierMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockNotifier) EXPECT() *MockNotifierMockRecorder {
+	return m.recorder
+}
+
+// Send mocks base method.
+func (m *MockNotifier) Send(ctx context.Context, n domain.Notification) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Send", ctx, n)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Send indicates an expected call of Send.
+func (mr *MockNotifierMockRecorder) Send(ctx, n any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockNotifier)(nil).Send), ctx, n)
+}
+
+// MockNotificationService is a mock of NotificationService interface.
+type MockNotificationService struct {
+	ctrl     *gomock.Controller
+	recorder *MockNotificationServiceMockRecorder
+	isgomock struct{}
+}
+
+// MockNotificationServiceMockRecorder is the mock recorder for MockNotificationService.
+type MockNotificationServiceMockRecorder struct {
+	mock *MockNotificationService
+}
+
+// NewMockNotificationService creates a new mock instance.
+func NewMockNotificationService(ctrl *gomock.Controller) *MockNotificationService {
+	mock := &MockNotificationService{ctrl: ctrl}
+	mock.recorder = &MockNotificationServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockNotificationService) EXPECT() *MockNotificationServiceMockRecorder {
+	return m.recorder
+}
+
+// Notify mocks base method.
+func (m *MockNotificationService) Notify(ctx context.Context, merchantID uuid.UUID, event domain.NotificationEvent, message string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Notify", ctx, merchantID, event, message)
+}
+
+// Notify indicates an expected call of Notify.
+func (mr *MockNotificationServiceMockRecorder) Notify(ctx, merchantID, event, message any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Notify", reflect.TypeOf((*MockNotificationService)(nil).Notify), ctx, merchantID, event, message)
+}
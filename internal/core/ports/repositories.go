@@ -2,30 +2,42 @@ package ports
 
 import (
 	"context"
+	"time"
 
 	"secure-payment-gateway/internal/core/domain"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
 )
 
 // MerchantRepository defines persistence operations for merchants.
 type MerchantRepository interface {
-	Create(ctx context.Context, merchant *domain.Merchant) error
+	Create(ctx context.Context, tx pgx.Tx, merchant *domain.Merchant) error // Within tx, so the merchant's wallets commit with it
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.Merchant, error)
 	GetByAccessKey(ctx context.Context, accessKey string) (*domain.Merchant, error)
 	GetByUsername(ctx context.Context, username string) (*domain.Merchant, error)
 	Update(ctx context.Context, merchant *domain.Merchant) error
+	UpdateLastUsedAt(ctx context.Context, id uuid.UUID, usedAt time.Time) error
+	UpdateLastLoginAt(ctx context.Context, id uuid.UUID, loginAt time.Time) error
 }
 
 // WalletRepository defines persistence operations for wallets.
 // Methods accepting pgx.Tx are used inside transaction blocks for pessimistic locking.
 type WalletRepository interface {
-	Create(ctx context.Context, wallet *domain.Wallet) error
+	Create(ctx context.Context, wallet *domain.Wallet) error // domain.ErrWalletExists if the merchant has one in that currency
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.Wallet, error)
 	GetByMerchantID(ctx context.Context, merchantID uuid.UUID, currency string) (*domain.Wallet, error)
 	GetByMerchantIDForUpdate(ctx context.Context, tx pgx.Tx, merchantID uuid.UUID, currency string) (*domain.Wallet, error)
 	GetByIDForUpdate(ctx context.Context, tx pgx.Tx, id uuid.UUID) (*domain.Wallet, error)
+	ListByMerchantID(ctx context.Context, merchantID uuid.UUID) ([]domain.Wallet, error) // Ordered by currency
+	// LockForUpdate locks wallets by ID in domain.WalletLockOrder, whatever
+	// the argument order, and returns them by ID (missing wallets are absent).
+	// Operations locking wallets by ID go through it so they cannot deadlock.
+	LockForUpdate(ctx context.Context, tx pgx.Tx, ids ...uuid.UUID) (map[uuid.UUID]*domain.Wallet, error)
+	// GetOrCreateForUpdate returns the merchant's locked wallet in
+	// wallet.Currency, inserting wallet within tx if there is none yet.
+	GetOrCreateForUpdate(ctx context.Context, tx pgx.Tx, wallet *domain.Wallet) (*domain.Wallet, error)
 	UpdateBalance(ctx context.Context, tx pgx.Tx, walletID uuid.UUID, encryptedBalance string) error
 }
 
@@ -33,9 +45,21 @@ type WalletRepository interface {
 type TransactionRepository interface {
 	Create(ctx context.Context, tx pgx.Tx, transaction *domain.Transaction) error
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.Transaction, error)
-	GetByReference(ctx context.Context, merchantID uuid.UUID, referenceID string) (*domain.Transaction, error)
+	// GetByIDForUpdate locks the transaction's row within tx. Refunds and
+	// reversals lock the payment they target before its wallet.
+	GetByIDForUpdate(ctx context.Context, tx pgx.Tx, id uuid.UUID) (*domain.Transaction, error)
+	// GetByReference prefers the PAYMENT when several types share the
+	// reference, then the oldest, or the newest if newestFirst is set.
+	GetByReference(ctx context.Context, merchantID uuid.UUID, referenceID string, newestFirst bool) (*domain.Transaction, error)
 	UpdateStatus(ctx context.Context, tx pgx.Tx, id uuid.UUID, status domain.TransactionStatus) error
 	CheckRefundExists(ctx context.Context, originalTxID uuid.UUID) (bool, error)
+	SumRefunds(ctx context.Context, originalTxID uuid.UUID) (decimal.Decimal, error)                  // Non-FAILED refunds, in the original's currency, fractions included
+	CountRefunds(ctx context.Context, originalTxID uuid.UUID) (int64, error)                          // Non-FAILED refunds
+	SumTopupsSince(ctx context.Context, walletID uuid.UUID, since time.Time) (decimal.Decimal, error) // Successful topups only, at their exact amounts
+	// CountTodayForUpdate counts the merchant's payments since UTC midnight,
+	// any status, under a merchant-wide lock held until tx ends. Payments
+	// take it before their wallet lock.
+	CountTodayForUpdate(ctx context.Context, tx pgx.Tx, merchantID uuid.UUID) (int64, error)
 	// Reporting queries
 	List(ctx context.Context, params TransactionListParams) ([]domain.Transaction, int64, error)
 	GetStats(ctx context.Context, merchantID uuid.UUID, periodStart *int64) (*TransactionStats, error)
@@ -50,30 +74,51 @@ type TransactionListParams struct {
 	To         *int64 // Unix timestamp
 	Page       int
 	PageSize   int
+	SortBy     string // One of TransactionSortFields; empty = created_at
+	SortDir    string // SortAsc or SortDesc; empty = desc
+
+	// SkipTotal skips the COUNT(*) query: List returns a total of 0 and up
+	// to PageSize+1 transactions, the extra one showing a next page exists
+	SkipTotal bool
 }
 
+// Sort directions for TransactionListParams.SortDir.
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// TransactionSortFields lists the fields transactions can be sorted by.
+var TransactionSortFields = []string{"created_at", "amount"}
+
 // TransactionStats holds aggregated statistics for dashboard.
 type TransactionStats struct {
 	TotalTransactions int64
 	Successful        int64
 	Failed            int64
 	Reversed          int64
-	TotalRevenue      int64 // Sum of successful payment amounts
-	TotalRefunded     int64 // Sum of successful refund amounts
-	TotalTopup        int64 // Sum of successful topup amounts
+	TotalRevenue      decimal.Decimal // Sum of successful payment amounts, exact
+	TotalRefunded     decimal.Decimal // Sum of successful refund amounts, exact
+	TotalTopup        decimal.Decimal // Sum of successful topup amounts, exact
 }
 
 // IdempotencyRepository defines persistence for idempotency logs (DB backup).
 type IdempotencyRepository interface {
 	Create(ctx context.Context, tx pgx.Tx, log *domain.IdempotencyLog) error
 	Get(ctx context.Context, key string) (*domain.IdempotencyLog, error)
+	DeleteOlderThan(ctx context.Context, before time.Time) (int64, error) // Returns the number of logs deleted
 }
 
 // WebhookRepository defines persistence for webhook delivery logs.
 type WebhookRepository interface {
-	Create(ctx context.Context, log *domain.WebhookDeliveryLog) error
+	Create(ctx context.Context, log *domain.WebhookDeliveryLog) error // Upserts: re-creating an existing log updates it like Update
 	Update(ctx context.Context, log *domain.WebhookDeliveryLog) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.WebhookDeliveryLog, error) // Returns nil if not found
 	GetByTransactionID(ctx context.Context, txID uuid.UUID) ([]domain.WebhookDeliveryLog, error)
+	GetLatestByMerchant(ctx context.Context, merchantID uuid.UUID) (*domain.WebhookDeliveryLog, error) // Returns nil if none
+	// DeleteOlderThan removes logs in status last updated before the given
+	// time and returns how many were deleted.
+	DeleteOlderThan(ctx context.Context, status domain.WebhookStatus, before time.Time) (int64, error)
 }
 
 // AuditRepository defines persistence for audit logs.
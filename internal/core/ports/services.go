@@ -2,11 +2,13 @@ package ports
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
 	"secure-payment-gateway/internal/core/domain"
 
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 )
 
 // EncryptionService handles AES-256-GCM encryption/decryption.
@@ -22,6 +24,14 @@ type SignatureService interface {
 	BuildCanonicalString(method, path string, timestamp int64, nonce string, body string) string
 }
 
+// ReceiptSigner signs transaction receipts with the gateway's asymmetric key.
+type ReceiptSigner interface {
+	Algorithm() string
+	Sign(message []byte) string // base64 signature
+	Verify(message []byte, signature string) bool
+	PublicKey() string // base64 public key
+}
+
 // HashService handles password hashing (Argon2id).
 type HashService interface {
 	Hash(password string) (string, error)
@@ -31,13 +41,20 @@ type HashService interface {
 // TokenService handles JWT token operations.
 type TokenService interface {
 	Generate(merchantID uuid.UUID, accessKey string) (string, time.Time, error)
+	// GenerateWithExpiry is Generate with a lifetime other than the configured one
+	GenerateWithExpiry(merchantID uuid.UUID, accessKey string, ttl time.Duration) (string, time.Time, error)
 	Validate(tokenString string) (*TokenClaims, error)
+	// Refresh tokens only obtain new access tokens; Validate rejects them
+	GenerateRefresh(merchantID uuid.UUID, accessKey string) (string, time.Time, error)
+	ValidateRefresh(tokenString string) (*TokenClaims, error)
 }
 
 // TokenClaims holds the parsed JWT claims.
 type TokenClaims struct {
 	MerchantID uuid.UUID
 	AccessKey  string
+	TokenID    string    // "jti"; set on refresh tokens only
+	ExpiresAt  time.Time // "exp"
 }
 
 // IdempotencyCache is the Redis-layer idempotency check (fast path).
@@ -46,11 +63,34 @@ type IdempotencyCache interface {
 	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
 }
 
+// InFlightLock marks an idempotency key as being processed, so a duplicate
+// arriving before the first request commits can wait for it or be rejected
+// instead of racing it.
+type InFlightLock interface {
+	// Acquire claims key for ttl. It returns a token identifying the claim,
+	// or "" if another request holds the key.
+	Acquire(ctx context.Context, key string, ttl time.Duration) (string, error)
+	// Release frees key if the claim identified by token still holds it.
+	Release(ctx context.Context, key, token string) error
+}
+
 // NonceStore manages nonce uniqueness for replay attack prevention.
 type NonceStore interface {
 	// CheckAndSet atomically checks if nonce exists, sets it if not.
 	// Returns true if nonce is new (valid), false if already used.
 	CheckAndSet(ctx context.Context, merchantID string, nonce string, ttl time.Duration) (bool, error)
+	// Seen reports whether a nonce has been used and not yet expired,
+	// without recording it.
+	Seen(ctx context.Context, merchantID string, nonce string) (bool, error)
+}
+
+// LeaderLease elects one instance among replicas to hold a named lease.
+type LeaderLease interface {
+	// TryAcquire takes the lease if it is free, or renews it if this
+	// instance already holds it. Returns whether this instance holds it.
+	TryAcquire(ctx context.Context) (bool, error)
+	// Release gives the lease up if this instance holds it.
+	Release(ctx context.Context) error
 }
 
 // --- Service Ports (Business Logic) ---
@@ -60,6 +100,7 @@ type PaymentService interface {
 	ProcessPayment(ctx context.Context, req PaymentRequest) (*domain.Transaction, error)
 	ProcessRefund(ctx context.Context, req RefundRequest) (*domain.Transaction, error)
 	ProcessTopup(ctx context.Context, req TopupRequest) (*domain.Transaction, error)
+	ReverseTransaction(ctx context.Context, req ReversalRequest) (*domain.Transaction, error)
 }
 
 // PaymentRequest holds validated input for payment processing.
@@ -67,33 +108,69 @@ type PaymentRequest struct {
 	MerchantID  uuid.UUID
 	ReferenceID string
 	Amount      int64
-	Currency    string
-	Signature   string
-	ClientIP    string
-	ExtraData   *string
+	// AmountDecimal is the exact amount when it has a fractional part,
+	// which only DecimalBalance wallets accept; Amount is then its
+	// integer part (see domain.SplitAmount)
+	AmountDecimal *decimal.Decimal
+	Currency      string
+	Signature     string
+	ClientIP      string
+	ExtraData     *string
+	InitiatedBy   string // access key of the calling credential
+	// Client-supplied Idempotency-Key; "" = key derived from ReferenceID
+	IdempotencyKey string
 }
 
 // RefundRequest holds validated input for refund processing.
 type RefundRequest struct {
 	MerchantID          uuid.UUID
 	OriginalReferenceID string
-	Amount              *int64 // nil = full refund
+	ReferenceID         string           // the refund's own reference; "" = "REFUND-" + OriginalReferenceID
+	IdempotencyKey      string           // Client-supplied Idempotency-Key; "" = key derived from the references
+	Amount              *int64           // nil = full refund
+	AmountDecimal       *decimal.Decimal // As on PaymentRequest; Amount is set too
 	Reason              string
 	Signature           string
 	ClientIP            string
+	InitiatedBy         string // access key of the calling credential
+}
+
+// ReversalRequest holds validated input for an operator reversal.
+type ReversalRequest struct {
+	TransactionID uuid.UUID
+	Reason        string
+	ClientIP      string
+	InitiatedBy   string // the operator: "admin", or "admin:" + their X-Admin-Actor
 }
 
 // TopupRequest holds validated input for wallet topup.
 type TopupRequest struct {
-	MerchantID uuid.UUID
-	Amount     int64
-	Currency   string
+	MerchantID    uuid.UUID
+	Amount        int64
+	AmountDecimal *decimal.Decimal // As on PaymentRequest
+	Currency      string
+	ReferenceID   *string // nil = not idempotent, a reference is generated
+	InitiatedBy   string  // access key of the calling credential
 }
 
 // AuthService defines authentication business logic.
 type AuthService interface {
 	Register(ctx context.Context, req RegisterRequest) (*RegisterResponse, error)
 	Login(ctx context.Context, username, password string) (string, time.Time, error) // token, expiry, error
+	// LoginSession is Login that also issues a refresh token, for dashboard
+	// sessions that keep it in a cookie
+	LoginSession(ctx context.Context, username, password string) (*SessionTokens, error)
+	// Refresh exchanges a refresh token for a new access token and a rotated
+	// refresh token
+	Refresh(ctx context.Context, refreshToken string) (*SessionTokens, error)
+}
+
+// SessionTokens holds the tokens of a dashboard session.
+type SessionTokens struct {
+	AccessToken   string
+	AccessExpiry  time.Time
+	RefreshToken  string
+	RefreshExpiry time.Time
 }
 
 // RegisterRequest holds input for merchant registration.
@@ -102,6 +179,10 @@ type RegisterRequest struct {
 	Password     string
 	MerchantName string
 	WebhookURL   *string
+	Currency     string   // Primary currency and that of the first wallet; "" = domain.DefaultCurrency
+	Currencies   []string // Further currencies to open zero-balance wallets in
+	// IdempotencyKey makes retries return the original merchant and keys (nil = not idempotent)
+	IdempotencyKey *string
 }
 
 // RegisterResponse holds the registration result shown once.
@@ -115,22 +196,111 @@ type RegisterResponse struct {
 type ReportingService interface {
 	GetDashboardStats(ctx context.Context, merchantID uuid.UUID, period string) (*TransactionStats, error)
 	ListTransactions(ctx context.Context, params TransactionListParams) ([]domain.Transaction, int64, error)
-	GetWalletBalance(ctx context.Context, merchantID uuid.UUID) (int64, string, error) // balance, currency, error
+	// GetTransaction returns one of the merchant's transactions; another merchant's is not found
+	GetTransaction(ctx context.Context, merchantID, transactionID uuid.UUID) (*domain.Transaction, error)
+	ExportTransactions(ctx context.Context, params TransactionListParams) ([]domain.Transaction, error) // Page/PageSize ignored
+	// GetWalletBalance returns the balance and currency of the merchant's
+	// wallet in currency, or in its primary currency if currency is ""
+	GetWalletBalance(ctx context.Context, merchantID uuid.UUID, currency string) (decimal.Decimal, string, error)
+	// ListWalletBalances returns the balance of each of the merchant's wallets, ordered by currency
+	ListWalletBalances(ctx context.Context, merchantID uuid.UUID) ([]WalletBalance, error)
+	// PreviewBalance projects the balance through deltas without locking or writing
+	PreviewBalance(ctx context.Context, merchantID uuid.UUID, currency string, deltas []int64) (*BalancePreview, error)
+}
+
+// WalletBalance is the balance of one of a merchant's wallets.
+type WalletBalance struct {
+	Currency string
+	Balance  decimal.Decimal
+}
+
+// BalancePreview is a wallet balance projected through hypothetical deltas.
+type BalancePreview struct {
+	Currency  string
+	Balance   decimal.Decimal   // Current balance
+	Steps     []decimal.Decimal // Balance after each delta, in order
+	Projected decimal.Decimal   // Balance after the last delta
 }
 
 // WebhookService defines async webhook delivery.
 type WebhookService interface {
 	EnqueueWebhook(ctx context.Context, transaction *domain.Transaction) error
+	// DispatchWebhook honours the merchant's delivery mode; the result is nil unless synchronous.
+	DispatchWebhook(ctx context.Context, transaction *domain.Transaction) (*WebhookDispatchResult, error)
+	EventCatalog() *WebhookCatalog
+	GetLastDelivery(ctx context.Context, merchantID uuid.UUID) (*domain.WebhookDeliveryLog, error)    // nil if none recorded
+	GetDelivery(ctx context.Context, merchantID, logID uuid.UUID) (*domain.WebhookDeliveryLog, error) // nil if not found or not the merchant's
+	// TestFireWebhook sends one unpersisted sample event to the merchant's webhook URL.
+	TestFireWebhook(ctx context.Context, merchantID uuid.UUID) (*WebhookTestFireResult, error)
+	// Stop cancels background deliveries and retries and waits for them to return.
+	Stop()
+}
+
+// WebhookDispatchResult reports the outcome of a synchronous webhook attempt.
+type WebhookDispatchResult struct {
+	Synchronous bool
+	Delivered   bool
+	HTTPStatus  *int    // nil if no response was received
+	Error       *string // nil when delivered
+}
+
+// WebhookTestFireResult reports a test webhook. SigningInput is the exact
+// string the signature was computed over; live deliveries never expose it.
+type WebhookTestFireResult struct {
+	Delivered    bool
+	HTTPStatus   *int    // nil if no response was received
+	Error        *string // nil when delivered
+	Payload      []byte  // Body as sent
+	SigningInput string
+}
+
+// WebhookCatalog is the self-describing list of webhook events and payload schemas.
+type WebhookCatalog struct {
+	Events         []WebhookEventInfo
+	Envelope       []WebhookFieldInfo // Top-level payload fields, shared by all versions
+	Versions       []WebhookVersionInfo
+	DefaultVersion string
+	LatestVersion  string
+}
+
+// WebhookEventInfo describes one event type.
+type WebhookEventInfo struct {
+	Type            string
+	TransactionType string
+	Trigger         string
+}
+
+// WebhookVersionInfo describes the "data" object of one payload version.
+type WebhookVersionInfo struct {
+	Version       string
+	Fields        []WebhookFieldInfo
+	MinimalFields []WebhookFieldInfo // Sent to merchants in minimal payload mode
+}
+
+// WebhookFieldInfo describes a single JSON field.
+type WebhookFieldInfo struct {
+	Name     string
+	Type     string
+	Optional bool
 }
 
 // MerchantProfile is the read-only view of a merchant returned by GetProfile.
 type MerchantProfile struct {
-	ID           uuid.UUID
-	Username     string
-	MerchantName string
-	WebhookURL   *string
-	Status       domain.MerchantStatus
-	CreatedAt    string
+	ID                      uuid.UUID
+	Username                string
+	MerchantName            string
+	WebhookURL              *string
+	Status                  domain.MerchantStatus
+	SynchronousWebhook      bool
+	RequireIdempotencyKey   bool
+	WebhookPayloadMode      domain.WebhookPayloadMode
+	SessionExpirySeconds    *int // nil = jwt.expiry; longer values are capped at login
+	NotificationPreferences domain.NotificationPreferences
+	LastUsedAt              *string // RFC3339; nil if the API keys were never used
+	LastLoginAt             *string // RFC3339; nil if never logged in
+	SecretRotatedAt         *string // RFC3339; nil if the keys were never rotated
+	SecretExpiresAt         *string // RFC3339; nil if secrets do not expire
+	CreatedAt               string
 }
 
 // RotateKeysResponse holds the new keys after rotation.
@@ -143,10 +313,60 @@ type RotateKeysResponse struct {
 type MerchantManagementService interface {
 	GetProfile(ctx context.Context, merchantID uuid.UUID) (*MerchantProfile, error)
 	UpdateWebhookURL(ctx context.Context, merchantID uuid.UUID, webhookURL *string) error
-	RotateKeys(ctx context.Context, merchantID uuid.UUID) (*RotateKeysResponse, error)
+	SetSynchronousWebhook(ctx context.Context, merchantID uuid.UUID, enabled bool) error
+	SetRequireIdempotencyKey(ctx context.Context, merchantID uuid.UUID, required bool) error
+	SetWebhookPayloadMode(ctx context.Context, merchantID uuid.UUID, mode domain.WebhookPayloadMode) error
+	SetSessionExpiry(ctx context.Context, merchantID uuid.UUID, expiry time.Duration) error
+	SetNotificationPreferences(ctx context.Context, merchantID uuid.UUID, prefs domain.NotificationPreferences) error
+	// RotateKeys issues new API keys. A retry with the same idempotencyKey
+	// shortly after returns the same keys ("" = not idempotent).
+	RotateKeys(ctx context.Context, merchantID uuid.UUID, idempotencyKey string) (*RotateKeysResponse, error)
+}
+
+// Receipt is the canonical, signed view of a transaction.
+// Field order is part of the signed format: never reorder, only append.
+type Receipt struct {
+	TransactionID         string      `json:"transaction_id"`
+	ReferenceID           string      `json:"reference_id"`
+	MerchantID            string      `json:"merchant_id"`
+	MerchantName          string      `json:"merchant_name"`
+	TransactionType       string      `json:"transaction_type"`
+	Status                string      `json:"status"`
+	Amount                json.Number `json:"amount"` // Exact; a whole amount encodes as it did when this was int64
+	Currency              string      `json:"currency"`
+	OriginalTransactionID *string     `json:"original_transaction_id,omitempty"`
+	CreatedAt             string      `json:"created_at"`
+	ProcessedAt           *string     `json:"processed_at,omitempty"`
+	IssuedAt              string      `json:"issued_at"`
+}
+
+// SignedReceipt pairs a receipt with its signature over the compact JSON encoding of Receipt.
+type SignedReceipt struct {
+	Receipt   Receipt
+	Algorithm string
+	Signature string
+}
+
+// ReceiptService issues signed transaction receipts.
+type ReceiptService interface {
+	GetReceipt(ctx context.Context, merchantID, transactionID uuid.UUID) (*SignedReceipt, error)
+	PublicKey() (algorithm string, publicKey string)
 }
 
 // AuditService records audit trail entries asynchronously.
 type AuditService interface {
 	Log(ctx context.Context, log *domain.AuditLog)
 }
+
+// Notifier delivers a notification over one channel, e.g. an email or SMS
+// provider.
+type Notifier interface {
+	Send(ctx context.Context, n domain.Notification) error
+}
+
+// NotificationService notifies merchants of events on the channels their
+// preferences select, asynchronously (fire-and-forget). It is a secondary,
+// human-facing path; webhooks remain the primary channel.
+type NotificationService interface {
+	Notify(ctx context.Context, merchantID uuid.UUID, event domain.NotificationEvent, message string)
+}
@@ -21,12 +21,21 @@ return &auditService{repo: repo, log: log}
 }
 
 // Log records an audit entry asynchronously (fire-and-forget).
+// Within a request only the first entry is recorded, whichever path logs
+// it (see domain.ClaimAudit); it is tagged with the request ID.
 func (s *auditService) Log(ctx context.Context, entry *domain.AuditLog) {
+if !domain.ClaimAudit(ctx) {
+return
+}
+if entry.RequestID == "" {
+entry.RequestID = domain.RequestIDFromContext(ctx)
+}
 go func() {
 s.log.Info().
 Str("action", string(entry.Action)).
 Str("resource_type", entry.ResourceType).
 Str("resource_id", entry.ResourceID).
+Str("request_id", entry.RequestID).
 Str("ip", entry.IPAddress).
 Msg("audit")
 
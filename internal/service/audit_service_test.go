@@ -65,3 +65,37 @@ CreatedAt:    time.Now(),
 
 time.Sleep(50 * time.Millisecond) // let goroutine run
 }
+
+func TestAuditService_Log_OncePerRequest(t *testing.T) {
+ctrl := gomock.NewController(t)
+defer ctrl.Finish()
+
+mockRepo := mocks.NewMockAuditRepository(ctrl)
+svc := NewAuditService(mockRepo, newTestLogger())
+
+done := make(chan *domain.AuditLog, 2)
+mockRepo.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(
+func(ctx context.Context, log *domain.AuditLog) error {
+done <- log
+return nil
+},
+).Times(1)
+
+// Service-level and middleware entries for the same request
+ctx := domain.ContextWithRequestID(context.Background(), "req-123")
+svc.Log(ctx, &domain.AuditLog{ID: uuid.New(), Action: domain.AuditActionPayment, ResourceType: "transaction", ResourceID: "tx-1"})
+svc.Log(ctx, &domain.AuditLog{ID: uuid.New(), Action: domain.AuditActionPayment, ResourceType: "transaction"})
+
+select {
+case log := <-done:
+if log.ResourceID != "tx-1" {
+t.Errorf("expected the first entry to be kept, got resource %q", log.ResourceID)
+}
+if log.RequestID != "req-123" {
+t.Errorf("expected request ID req-123, got %q", log.RequestID)
+}
+case <-time.After(2 * time.Second):
+t.Fatal("audit log not persisted in time")
+}
+time.Sleep(50 * time.Millisecond) // a second write would fail the Times(1) expectation
+}
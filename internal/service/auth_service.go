@@ -4,7 +4,11 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/url"
+	"strings"
 	"time"
 
 	"secure-payment-gateway/internal/core/domain"
@@ -12,37 +16,148 @@ import (
 	"secure-payment-gateway/pkg/apperror"
 
 	"github.com/google/uuid"
+	"github.com/rs/zerolog"
 )
 
 // AuthServiceImpl implements ports.AuthService.
 type AuthServiceImpl struct {
 	merchantRepo ports.MerchantRepository
 	walletRepo   ports.WalletRepository
+	transactor   ports.DBTransactor
 	hashSvc      ports.HashService
 	encSvc       ports.EncryptionService
 	tokenSvc     ports.TokenService
+
+	registerCache ports.IdempotencyCache
+	registerLock  ports.InFlightLock // nil = concurrent registrations with one key race
+
+	requireWebhookURL bool
+	lookupHost        func(ctx context.Context, host string) ([]string, error) // resolves webhook hosts
+
+	maxSessionExpiry time.Duration // caps merchant session overrides; 0 = uncapped
+
+	redeemedRefresh ports.NonceStore // records spent refresh token IDs; nil = refresh tokens are reusable until they expire
+
+	log zerolog.Logger
+}
+
+// AuthOption configures optional AuthServiceImpl behaviour.
+type AuthOption func(*AuthServiceImpl)
+
+// WithRegisterIdempotency enables Idempotency-Key support on registration.
+// The issued keys are kept in the cache (secret encrypted) so a retried
+// registration returns the same credentials. lock claims the key while the
+// registration runs, so a concurrent duplicate fails with PAY_003 instead
+// of overwriting the cached credentials; nil leaves them to race.
+func WithRegisterIdempotency(cache ports.IdempotencyCache, lock ports.InFlightLock) AuthOption {
+	return func(s *AuthServiceImpl) {
+		s.registerCache = cache
+		s.registerLock = lock
+	}
+}
+
+// WithRequiredWebhookURL makes registration fail without an https
+// webhook_url whose host resolves. No request is sent to the URL: the
+// endpoint is unauthenticated, so probing it would let anyone make the
+// gateway call arbitrary hosts.
+func WithRequiredWebhookURL() AuthOption {
+	return func(s *AuthServiceImpl) {
+		s.requireWebhookURL = true
+	}
+}
+
+// WithMaxSessionExpiry caps per-merchant session expiry overrides: a
+// merchant whose override is longer gets tokens that expire after max.
+// Merchants without an override keep the token service's expiry.
+func WithMaxSessionExpiry(max time.Duration) AuthOption {
+	return func(s *AuthServiceImpl) {
+		s.maxSessionExpiry = max
+	}
+}
+
+// WithRefreshRotation makes each refresh token single-use: Refresh records
+// its ID in store, and a token whose ID is already recorded fails with
+// AUTH_003. A stolen token is then only good until the owner's next refresh.
+func WithRefreshRotation(store ports.NonceStore) AuthOption {
+	return func(s *AuthServiceImpl) {
+		s.redeemedRefresh = store
+	}
+}
+
+// WithAuthLogger sets the logger for best-effort writes that fail. Defaults
+// to a no-op logger.
+func WithAuthLogger(log zerolog.Logger) AuthOption {
+	return func(s *AuthServiceImpl) {
+		s.log = log
+	}
 }
 
 // NewAuthService creates a new AuthServiceImpl.
 func NewAuthService(
 	merchantRepo ports.MerchantRepository,
 	walletRepo ports.WalletRepository,
+	transactor ports.DBTransactor,
 	hashSvc ports.HashService,
 	encSvc ports.EncryptionService,
 	tokenSvc ports.TokenService,
+	opts ...AuthOption,
 ) *AuthServiceImpl {
-	return &AuthServiceImpl{
+	s := &AuthServiceImpl{
 		merchantRepo: merchantRepo,
 		walletRepo:   walletRepo,
+		transactor:   transactor,
 		hashSvc:      hashSvc,
 		encSvc:       encSvc,
 		tokenSvc:     tokenSvc,
+		lookupHost:   net.DefaultResolver.LookupHost,
+		log:          zerolog.Nop(),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
-// Register creates a new merchant account with a wallet.
-// Returns the access_key and secret_key (plaintext shown only once).
+// registrationRecord is the cached outcome of an idempotent registration.
+type registrationRecord struct {
+	MerchantID   uuid.UUID `json:"merchant_id"`
+	Username     string    `json:"username"`
+	AccessKey    string    `json:"access_key"`
+	SecretKeyEnc string    `json:"secret_key_enc"` // Never cached in plaintext
+}
+
+// Register creates a new merchant account and its wallets in one database
+// transaction. Returns the access_key and secret_key (plaintext shown only once).
 func (s *AuthServiceImpl) Register(ctx context.Context, req ports.RegisterRequest) (*ports.RegisterResponse, error) {
+	if s.requireWebhookURL {
+		if err := s.checkWebhookURL(ctx, req.WebhookURL); err != nil {
+			return nil, err
+		}
+	}
+
+	currencies, err := registrationCurrencies(req.Currency, req.Currencies)
+	if err != nil {
+		return nil, err
+	}
+
+	var idempKey string
+	if req.IdempotencyKey != nil && s.registerCache != nil {
+		idempKey = domain.BuildRegisterIdempotencyKey(*req.IdempotencyKey)
+		release, err := claimKey(ctx, s.registerLock, idempKey)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
+		replay, err := s.replayRegistration(ctx, idempKey, req.Username, req.Password, currencies)
+		if err != nil {
+			return nil, err
+		}
+		if replay != nil {
+			return replay, nil
+		}
+	}
+
 	// Check username uniqueness
 	existing, err := s.merchantRepo.GetByUsername(ctx, req.Username)
 	if err != nil {
@@ -76,82 +191,359 @@ func (s *AuthServiceImpl) Register(ctx context.Context, req ports.RegisterReques
 	}
 
 	now := time.Now().UTC()
+	latestVersion := LatestWebhookVersion // new integrations start on the latest webhook shape
 	merchant := &domain.Merchant{
-		ID:           uuid.New(),
-		Username:     req.Username,
-		PasswordHash: passwordHash,
-		MerchantName: req.MerchantName,
-		AccessKey:    accessKey,
-		SecretKeyEnc: secretKeyEnc,
-		WebhookURL:   req.WebhookURL,
-		Status:       domain.MerchantStatusActive,
-		CreatedAt:    now,
-		UpdatedAt:    now,
-	}
-
-	// Create merchant
-	if err := s.merchantRepo.Create(ctx, merchant); err != nil {
+		ID:             uuid.New(),
+		Username:       req.Username,
+		PasswordHash:   passwordHash,
+		MerchantName:   req.MerchantName,
+		AccessKey:      accessKey,
+		SecretKeyEnc:   secretKeyEnc,
+		WebhookURL:     req.WebhookURL,
+		Status:         domain.MerchantStatusActive,
+		WebhookVersion: &latestVersion,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+
+		WebhookPayloadMode: domain.WebhookPayloadFull,
+		PrimaryCurrency:    currencies[0],
+	}
+
+	// Record the credentials before anything is committed, so a retry after a
+	// committed-but-lost response still gets the same keys back.
+	if idempKey != "" {
+		record, err := json.Marshal(registrationRecord{
+			MerchantID:   merchant.ID,
+			Username:     merchant.Username,
+			AccessKey:    accessKey,
+			SecretKeyEnc: secretKeyEnc,
+		})
+		if err != nil {
+			return nil, apperror.InternalError(fmt.Errorf("marshal registration record: %w", err))
+		}
+		if err := s.registerCache.Set(ctx, idempKey, record, idempotencyTTL); err != nil {
+			return nil, apperror.InternalError(fmt.Errorf("cache registration record: %w", err))
+		}
+	}
+
+	dbTx, err := s.transactor.Begin(ctx)
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("begin tx: %w", err))
+	}
+	defer dbTx.Rollback(context.WithoutCancel(ctx)) //nolint:errcheck
+
+	if err := s.merchantRepo.Create(ctx, dbTx, merchant); err != nil {
 		return nil, apperror.InternalError(fmt.Errorf("create merchant: %w", err))
 	}
+	for _, currency := range currencies {
+		wallet, err := s.newWallet(merchant.ID, currency)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := s.walletRepo.GetOrCreateForUpdate(ctx, dbTx, wallet); err != nil {
+			return nil, apperror.InternalError(fmt.Errorf("create wallet: %w", err))
+		}
+	}
+	if err := commit(ctx, dbTx); err != nil {
+		return nil, err
+	}
+
+	return &ports.RegisterResponse{
+		MerchantID: merchant.ID,
+		AccessKey:  accessKey,
+		SecretKey:  secretKey,
+	}, nil
+}
+
+// registrationCurrencies returns the currencies to open wallets in at
+// registration: the primary one first, then the others upper-cased and
+// without duplicates. Every code is checked before anything is created.
+func registrationCurrencies(primary string, others []string) ([]string, error) {
+	if primary == "" {
+		primary = domain.DefaultCurrency
+	}
+	currencies := make([]string, 0, len(others)+1)
+	seen := make(map[string]bool, len(others)+1)
+	for _, c := range append([]string{primary}, others...) {
+		if !domain.IsCurrencyCode(c) {
+			return nil, apperror.Validation(fmt.Sprintf("currency %q is not an ISO 4217 currency code", c))
+		}
+		c = strings.ToUpper(c)
+		if !seen[c] {
+			seen[c] = true
+			currencies = append(currencies, c)
+		}
+	}
+	return currencies, nil
+}
+
+// checkWebhookURL requires an https webhook URL whose host resolves.
+func (s *AuthServiceImpl) checkWebhookURL(ctx context.Context, webhookURL *string) error {
+	if webhookURL == nil || *webhookURL == "" {
+		return apperror.Validation("webhook_url is required")
+	}
+	u, err := url.Parse(*webhookURL)
+	if err != nil || u.Hostname() == "" {
+		return apperror.Validation("webhook_url is not a valid URL")
+	}
+	if u.Scheme != "https" {
+		return apperror.Validation("webhook_url must use https")
+	}
+	if _, err := s.lookupHost(ctx, u.Hostname()); err != nil {
+		return apperror.Validation(fmt.Sprintf("webhook_url host %q does not resolve", u.Hostname()))
+	}
+	return nil
+}
+
+// replayRegistration returns the original credentials for a retried registration.
+// It returns nil, nil when the key is unused or the original attempt never
+// created the merchant, in which case registration proceeds normally. The
+// retry must carry the original password: the key and username alone are
+// not secret enough to hand out the merchant's secret key.
+func (s *AuthServiceImpl) replayRegistration(ctx context.Context, idempKey, username, password string, currencies []string) (*ports.RegisterResponse, error) {
+	cached, err := s.registerCache.Get(ctx, idempKey)
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("registration idempotency check: %w", err))
+	}
+	if cached == nil {
+		return nil, nil
+	}
+
+	var record registrationRecord
+	if err := json.Unmarshal(cached, &record); err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("unmarshal registration record: %w", err))
+	}
+	if record.Username != username {
+		return nil, apperror.Validation("idempotency key already used for a different registration")
+	}
+
+	merchant, err := s.merchantRepo.GetByID(ctx, record.MerchantID)
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("find merchant: %w", err))
+	}
+	if merchant == nil {
+		return nil, nil
+	}
+	// A wrong password is reported like a different username, so a replay
+	// never confirms which one matched
+	valid, err := s.hashSvc.Verify(password, merchant.PasswordHash)
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("verify password: %w", err))
+	}
+	if !valid {
+		return nil, apperror.Validation("idempotency key already used for a different registration")
+	}
+	if merchant.AccessKey != record.AccessKey {
+		return nil, apperror.Validation("credentials for this registration have since been rotated")
+	}
 
+	// Merchants registered before registration was transactional may lack wallets
+	currencies = append([]string{merchant.Currency()}, currencies[1:]...)
+	for _, currency := range currencies {
+		wallet, err := s.walletRepo.GetByMerchantID(ctx, merchant.ID, currency)
+		if err != nil {
+			return nil, apperror.InternalError(fmt.Errorf("find wallet: %w", err))
+		}
+		if wallet == nil {
+			if err := s.createWallet(ctx, merchant.ID, currency); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	secretKey, err := s.encSvc.Decrypt(record.SecretKeyEnc)
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("decrypt secret key: %w", err))
+	}
+
+	return &ports.RegisterResponse{
+		MerchantID: merchant.ID,
+		AccessKey:  record.AccessKey,
+		SecretKey:  secretKey,
+	}, nil
+}
+
+// newWallet builds a zero-balance wallet for the merchant in currency.
+func (s *AuthServiceImpl) newWallet(merchantID uuid.UUID, currency string) (*domain.Wallet, error) {
 	// Encrypt initial balance (0)
 	encryptedBalance, err := s.encSvc.Encrypt("0")
 	if err != nil {
 		return nil, apperror.InternalError(fmt.Errorf("encrypt initial balance: %w", err))
 	}
 
-	// Create default wallet
-	wallet := &domain.Wallet{
+	now := time.Now().UTC()
+	return &domain.Wallet{
 		ID:               uuid.New(),
-		MerchantID:       merchant.ID,
-		Currency:         "VND",
+		MerchantID:       merchantID,
+		Currency:         currency,
 		EncryptedBalance: encryptedBalance,
 		CreatedAt:        now,
 		UpdatedAt:        now,
-	}
+	}, nil
+}
 
+// createWallet creates a zero-balance wallet for the merchant in currency.
+func (s *AuthServiceImpl) createWallet(ctx context.Context, merchantID uuid.UUID, currency string) error {
+	wallet, err := s.newWallet(merchantID, currency)
+	if err != nil {
+		return err
+	}
 	if err := s.walletRepo.Create(ctx, wallet); err != nil {
-		return nil, apperror.InternalError(fmt.Errorf("create wallet: %w", err))
+		return apperror.InternalError(fmt.Errorf("create wallet: %w", err))
 	}
-
-	return &ports.RegisterResponse{
-		MerchantID: merchant.ID,
-		AccessKey:  accessKey,
-		SecretKey:  secretKey,
-	}, nil
+	return nil
 }
 
 // Login validates credentials and returns a JWT token.
 func (s *AuthServiceImpl) Login(ctx context.Context, username, password string) (string, time.Time, error) {
+	merchant, err := s.authenticate(ctx, username, password)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	// Generate JWT
+	token, expiry, err := s.generateAccessToken(merchant)
+	if err != nil {
+		return "", time.Time{}, apperror.InternalError(fmt.Errorf("generate token: %w", err))
+	}
+
+	s.recordLogin(ctx, merchant.ID)
+
+	return token, expiry, nil
+}
+
+// recordLogin stores the merchant's login time. It is best-effort: a failed
+// activity write must not block the login itself, so it is only logged.
+func (s *AuthServiceImpl) recordLogin(ctx context.Context, merchantID uuid.UUID) {
+	if err := s.merchantRepo.UpdateLastLoginAt(ctx, merchantID, time.Now().UTC()); err != nil {
+		s.log.Warn().Err(err).Str("merchant_id", merchantID.String()).Msg("failed to record last_login_at")
+	}
+}
+
+// LoginSession authenticates like Login and also issues a refresh token.
+func (s *AuthServiceImpl) LoginSession(ctx context.Context, username, password string) (*ports.SessionTokens, error) {
+	merchant, err := s.authenticate(ctx, username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.issueSession(merchant)
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordLogin(ctx, merchant.ID)
+
+	return tokens, nil
+}
+
+// Refresh exchanges a refresh token for a new session. The refresh token is
+// rejected once the merchant is suspended or has rotated its keys, so key
+// rotation also ends every dashboard session. With WithRefreshRotation it is
+// also rejected once redeemed.
+func (s *AuthServiceImpl) Refresh(ctx context.Context, refreshToken string) (*ports.SessionTokens, error) {
+	claims, err := s.tokenSvc.ValidateRefresh(refreshToken)
+	if err != nil {
+		return nil, apperror.ErrInvalidToken()
+	}
+
+	merchant, err := s.merchantRepo.GetByID(ctx, claims.MerchantID)
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("find merchant: %w", err))
+	}
+	if merchant == nil || merchant.AccessKey != claims.AccessKey {
+		return nil, apperror.ErrInvalidToken()
+	}
+	if !merchant.IsActive() {
+		return nil, apperror.ErrMerchantSuspended()
+	}
+	if err := s.redeemRefresh(ctx, claims); err != nil {
+		return nil, err
+	}
+
+	return s.issueSession(merchant)
+}
+
+// redeemRefresh marks the refresh token in claims as spent, failing if it
+// already was. Tokens without an ID predate rotation and are rejected.
+func (s *AuthServiceImpl) redeemRefresh(ctx context.Context, claims *ports.TokenClaims) error {
+	if s.redeemedRefresh == nil {
+		return nil
+	}
+	if claims.TokenID == "" {
+		return apperror.ErrInvalidToken()
+	}
+	// Remembered until the token would have expired anyway
+	ttl := time.Until(claims.ExpiresAt)
+	if ttl <= 0 {
+		return apperror.ErrInvalidToken()
+	}
+	fresh, err := s.redeemedRefresh.CheckAndSet(ctx, "refresh:"+claims.MerchantID.String(), claims.TokenID, ttl)
+	if err != nil {
+		return apperror.InternalError(fmt.Errorf("redeem refresh token: %w", err))
+	}
+	if !fresh {
+		return apperror.ErrInvalidToken()
+	}
+	return nil
+}
+
+// authenticate checks a merchant's username and password and that the
+// merchant may log in.
+func (s *AuthServiceImpl) authenticate(ctx context.Context, username, password string) (*domain.Merchant, error) {
 	merchant, err := s.merchantRepo.GetByUsername(ctx, username)
 	if err != nil {
-		return "", time.Time{}, apperror.InternalError(fmt.Errorf("find merchant: %w", err))
+		return nil, apperror.InternalError(fmt.Errorf("find merchant: %w", err))
 	}
 	if merchant == nil {
-		return "", time.Time{}, apperror.ErrInvalidCredentials()
+		return nil, apperror.ErrInvalidCredentials()
 	}
 
 	// Verify password
 	valid, err := s.hashSvc.Verify(password, merchant.PasswordHash)
 	if err != nil {
-		return "", time.Time{}, apperror.InternalError(fmt.Errorf("verify password: %w", err))
+		return nil, apperror.InternalError(fmt.Errorf("verify password: %w", err))
 	}
 	if !valid {
-		return "", time.Time{}, apperror.ErrInvalidCredentials()
+		return nil, apperror.ErrInvalidCredentials()
 	}
 
 	// Check merchant status
 	if !merchant.IsActive() {
-		return "", time.Time{}, apperror.ErrMerchantSuspended()
+		return nil, apperror.ErrMerchantSuspended()
 	}
+	return merchant, nil
+}
 
-	// Generate JWT
-	token, expiry, err := s.tokenSvc.Generate(merchant.ID, merchant.AccessKey)
+// issueSession generates an access token and a refresh token for merchant.
+func (s *AuthServiceImpl) issueSession(merchant *domain.Merchant) (*ports.SessionTokens, error) {
+	token, expiry, err := s.generateAccessToken(merchant)
 	if err != nil {
-		return "", time.Time{}, apperror.InternalError(fmt.Errorf("generate token: %w", err))
+		return nil, apperror.InternalError(fmt.Errorf("generate token: %w", err))
 	}
+	refresh, refreshExpiry, err := s.tokenSvc.GenerateRefresh(merchant.ID, merchant.AccessKey)
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("generate refresh token: %w", err))
+	}
+	return &ports.SessionTokens{
+		AccessToken:   token,
+		AccessExpiry:  expiry,
+		RefreshToken:  refresh,
+		RefreshExpiry: refreshExpiry,
+	}, nil
+}
 
-	return token, expiry, nil
+// generateAccessToken issues an access token with the merchant's session
+// expiry override, clamped to maxSessionExpiry, or the default expiry.
+func (s *AuthServiceImpl) generateAccessToken(merchant *domain.Merchant) (string, time.Time, error) {
+	ttl := merchant.SessionExpiry()
+	if ttl <= 0 {
+		return s.tokenSvc.Generate(merchant.ID, merchant.AccessKey)
+	}
+	if s.maxSessionExpiry > 0 && ttl > s.maxSessionExpiry {
+		ttl = s.maxSessionExpiry
+	}
+	return s.tokenSvc.GenerateWithExpiry(merchant.ID, merchant.AccessKey, ttl)
 }
 
 // generateRandomHex generates a random hex string of n bytes.
@@ -1,17 +1,21 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"testing"
 	"time"
 
+	"secure-payment-gateway/internal/adapter/storage/memory"
 	"secure-payment-gateway/internal/core/domain"
 	"secure-payment-gateway/internal/core/ports"
 	"secure-payment-gateway/internal/core/ports/mocks"
 	"secure-payment-gateway/pkg/apperror"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
@@ -33,10 +37,23 @@ func setupAuthService(t *testing.T) (
 	encSvc := mocks.NewMockEncryptionService(ctrl)
 	tokenSvc := mocks.NewMockTokenService(ctrl)
 
-	svc := NewAuthService(merchantRepo, walletRepo, hashSvc, encSvc, tokenSvc)
+	svc := NewAuthService(merchantRepo, walletRepo, newRegisterTransactor(ctrl), hashSvc, encSvc, tokenSvc)
 	return svc, merchantRepo, walletRepo, hashSvc, encSvc, tokenSvc, ctrl
 }
 
+// newRegisterTransactor returns a transactor whose transactions commit.
+func newRegisterTransactor(ctrl *gomock.Controller) *mocks.MockDBTransactor {
+	transactor := mocks.NewMockDBTransactor(ctrl)
+	transactor.EXPECT().Begin(gomock.Any()).Return(&mockTx{}, nil).AnyTimes()
+	return transactor
+}
+
+// createdWallet stands in for WalletRepository.GetOrCreateForUpdate
+// creating the wallet.
+func createdWallet(_ context.Context, _ pgx.Tx, w *domain.Wallet) (*domain.Wallet, error) {
+	return w, nil
+}
+
 func TestAuthService_Register_Success(t *testing.T) {
 	svc, merchantRepo, walletRepo, hashSvc, encSvc, _, ctrl := setupAuthService(t)
 	defer ctrl.Finish()
@@ -55,11 +72,11 @@ func TestAuthService_Register_Success(t *testing.T) {
 	// Expect: encrypt secret key
 	encSvc.EXPECT().Encrypt(gomock.Any()).Return("encrypted_secret", nil)
 	// Expect: create merchant
-	merchantRepo.EXPECT().Create(ctx, gomock.Any()).Return(nil)
+	merchantRepo.EXPECT().Create(ctx, gomock.Any(), gomock.Any()).Return(nil)
 	// Expect: encrypt initial balance
 	encSvc.EXPECT().Encrypt("0").Return("encrypted_zero", nil)
 	// Expect: create wallet
-	walletRepo.EXPECT().Create(ctx, gomock.Any()).Return(nil)
+	walletRepo.EXPECT().GetOrCreateForUpdate(ctx, gomock.Any(), gomock.Any()).DoAndReturn(createdWallet)
 
 	resp, err := svc.Register(ctx, req)
 	require.NoError(t, err)
@@ -71,6 +88,192 @@ func TestAuthService_Register_Success(t *testing.T) {
 	assert.NotEqual(t, uuid.Nil, resp.MerchantID)
 }
 
+func TestAuthService_Register_PrimaryCurrency(t *testing.T) {
+	svc, merchantRepo, walletRepo, hashSvc, encSvc, _, ctrl := setupAuthService(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	merchantRepo.EXPECT().GetByUsername(ctx, "usd_merchant").Return(nil, nil)
+	hashSvc.EXPECT().Hash(gomock.Any()).Return("$argon2id$hashed", nil)
+	encSvc.EXPECT().Encrypt(gomock.Any()).Return("encrypted", nil).Times(2)
+	merchantRepo.EXPECT().Create(ctx, gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, _ pgx.Tx, m *domain.Merchant) error {
+		assert.Equal(t, "USD", m.PrimaryCurrency)
+		return nil
+	})
+	walletRepo.EXPECT().GetOrCreateForUpdate(ctx, gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, _ pgx.Tx, w *domain.Wallet) (*domain.Wallet, error) {
+		assert.Equal(t, "USD", w.Currency, "the first wallet is in the primary currency")
+		return w, nil
+	})
+
+	_, err := svc.Register(ctx, ports.RegisterRequest{Username: "usd_merchant", Password: "StrongP@ss123", MerchantName: "US Shop", Currency: "usd"})
+	require.NoError(t, err)
+}
+
+func TestAuthService_Register_ExtraCurrencies(t *testing.T) {
+	svc, merchantRepo, walletRepo, hashSvc, encSvc, _, ctrl := setupAuthService(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	merchantRepo.EXPECT().GetByUsername(ctx, "multi_merchant").Return(nil, nil)
+	hashSvc.EXPECT().Hash(gomock.Any()).Return("$argon2id$hashed", nil)
+	encSvc.EXPECT().Encrypt(gomock.Any()).Return("encrypted", nil).Times(4)
+	merchantRepo.EXPECT().Create(ctx, gomock.Any(), gomock.Any()).Return(nil)
+	var created []string
+	walletRepo.EXPECT().GetOrCreateForUpdate(ctx, gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, _ pgx.Tx, w *domain.Wallet) (*domain.Wallet, error) {
+		assert.Equal(t, "encrypted", w.EncryptedBalance)
+		created = append(created, w.Currency)
+		return w, nil
+	}).Times(3)
+
+	_, err := svc.Register(ctx, ports.RegisterRequest{
+		Username: "multi_merchant", Password: "StrongP@ss123", MerchantName: "Multi Shop",
+		Currencies: []string{"usd", "VND", "sgd", "USD"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"VND", "USD", "SGD"}, created, "primary first, duplicates dropped")
+}
+
+func TestAuthService_Register_InvalidCurrency(t *testing.T) {
+	// Rejected before the username lookup, so nothing is created
+	svc, _, _, _, _, _, ctrl := setupAuthService(t)
+	defer ctrl.Finish()
+
+	_, err := svc.Register(context.Background(), ports.RegisterRequest{
+		Username: "multi_merchant", Password: "StrongP@ss123", MerchantName: "Multi Shop",
+		Currencies: []string{"USD", "US1"},
+	})
+	var appErr *apperror.AppError
+	require.ErrorAs(t, err, &appErr)
+	assert.Equal(t, "PAY_002", appErr.Code)
+}
+
+func TestAuthService_Register_RequiredWebhookURL_Rejects(t *testing.T) {
+	httpURL := "http://merchant.example.com/webhook"
+	unresolved := "https://unknown.invalid/webhook"
+	garbage := "https://"
+
+	tests := map[string]*string{
+		"missing":    nil,
+		"not https":  &httpURL,
+		"no host":    &garbage,
+		"unresolved": &unresolved,
+	}
+	for name, webhookURL := range tests {
+		t.Run(name, func(t *testing.T) {
+			// No repository calls: the request is rejected before any lookup
+			svc, _, _, _, _, _, ctrl := setupAuthService(t)
+			defer ctrl.Finish()
+			WithRequiredWebhookURL()(svc)
+			svc.lookupHost = func(_ context.Context, host string) ([]string, error) {
+				if host == "unknown.invalid" {
+					return nil, errors.New("no such host")
+				}
+				return []string{"203.0.113.10"}, nil
+			}
+
+			resp, err := svc.Register(context.Background(), ports.RegisterRequest{
+				Username:     "new_merchant",
+				Password:     "StrongP@ss123",
+				MerchantName: "Test Shop",
+				WebhookURL:   webhookURL,
+			})
+			assert.Nil(t, resp)
+			var appErr *apperror.AppError
+			require.True(t, errors.As(err, &appErr))
+			assert.Equal(t, "PAY_002", appErr.Code)
+			assert.Contains(t, appErr.Message, "webhook_url")
+		})
+	}
+}
+
+func TestAuthService_Register_RequiredWebhookURL_Accepts(t *testing.T) {
+	svc, merchantRepo, walletRepo, hashSvc, encSvc, _, ctrl := setupAuthService(t)
+	defer ctrl.Finish()
+	WithRequiredWebhookURL()(svc)
+
+	var resolved string
+	svc.lookupHost = func(_ context.Context, host string) ([]string, error) {
+		resolved = host
+		return []string{"203.0.113.10"}, nil
+	}
+
+	ctx := context.Background()
+	webhookURL := "https://merchant.example.com/webhook"
+	req := ports.RegisterRequest{
+		Username:     "new_merchant",
+		Password:     "StrongP@ss123",
+		MerchantName: "Test Shop",
+		WebhookURL:   &webhookURL,
+	}
+
+	merchantRepo.EXPECT().GetByUsername(ctx, req.Username).Return(nil, nil)
+	hashSvc.EXPECT().Hash(req.Password).Return("$argon2id$hashed", nil)
+	encSvc.EXPECT().Encrypt(gomock.Any()).Return("encrypted_secret", nil)
+	merchantRepo.EXPECT().Create(ctx, gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, _ pgx.Tx, m *domain.Merchant) error {
+		require.NotNil(t, m.WebhookURL)
+		assert.Equal(t, webhookURL, *m.WebhookURL)
+		return nil
+	})
+	encSvc.EXPECT().Encrypt("0").Return("encrypted_zero", nil)
+	walletRepo.EXPECT().GetOrCreateForUpdate(ctx, gomock.Any(), gomock.Any()).DoAndReturn(createdWallet)
+
+	resp, err := svc.Register(ctx, req)
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, "merchant.example.com", resolved)
+}
+
+func TestAuthService_Register_WalletFailureRollsBackMerchant(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	merchantRepo := mocks.NewMockMerchantRepository(ctrl)
+	walletRepo := mocks.NewMockWalletRepository(ctrl)
+	hashSvc := mocks.NewMockHashService(ctrl)
+	encSvc := mocks.NewMockEncryptionService(ctrl)
+	transactor := mocks.NewMockDBTransactor(ctrl)
+	svc := NewAuthService(merchantRepo, walletRepo, transactor, hashSvc, encSvc, mocks.NewMockTokenService(ctrl))
+
+	ctx := context.Background()
+	tx := &recordingTx{}
+	merchantRepo.EXPECT().GetByUsername(ctx, "new_merchant").Return(nil, nil)
+	hashSvc.EXPECT().Hash(gomock.Any()).Return("$argon2id$hashed", nil)
+	encSvc.EXPECT().Encrypt(gomock.Any()).Return("encrypted", nil).Times(2)
+	transactor.EXPECT().Begin(ctx).Return(tx, nil)
+	merchantRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+	walletRepo.EXPECT().GetOrCreateForUpdate(ctx, tx, gomock.Any()).Return(nil, errors.New("connection reset"))
+
+	resp, err := svc.Register(ctx, ports.RegisterRequest{Username: "new_merchant", Password: "StrongP@ss123", MerchantName: "Test Shop"})
+	assert.Nil(t, resp)
+	require.Error(t, err)
+	assert.False(t, tx.committed, "no merchant without its wallet")
+	assert.True(t, tx.rolledBack)
+}
+
+func TestAuthService_Register_ConcurrentDuplicateIsRejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lock := memory.NewInFlightLock()
+	// No repository expectations: the duplicate stops at the claim
+	svc := NewAuthService(mocks.NewMockMerchantRepository(ctrl), mocks.NewMockWalletRepository(ctrl), mocks.NewMockDBTransactor(ctrl),
+		mocks.NewMockHashService(ctrl), mocks.NewMockEncryptionService(ctrl), mocks.NewMockTokenService(ctrl),
+		WithRegisterIdempotency(mocks.NewMockIdempotencyCache(ctrl), lock))
+
+	ctx := context.Background()
+	key := "reg-5"
+	// The first registration with this key is still running
+	token, err := lock.Acquire(ctx, domain.BuildRegisterIdempotencyKey(key), time.Minute)
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+
+	resp, err := svc.Register(ctx, ports.RegisterRequest{Username: "new_merchant", Password: "StrongP@ss123", IdempotencyKey: &key})
+	assert.Nil(t, resp)
+	var appErr *apperror.AppError
+	require.True(t, errors.As(err, &appErr))
+	assert.Equal(t, "PAY_003", appErr.Code)
+}
+
 func TestAuthService_Register_DuplicateUsername(t *testing.T) {
 	svc, merchantRepo, _, _, _, _, ctrl := setupAuthService(t)
 	defer ctrl.Finish()
@@ -94,6 +297,143 @@ func TestAuthService_Register_DuplicateUsername(t *testing.T) {
 	assert.Equal(t, "PAY_002", appErr.Code) // Validation error
 }
 
+func TestAuthService_Register_IdempotentRetryReturnsSameKeys(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	merchantRepo := mocks.NewMockMerchantRepository(ctrl)
+	walletRepo := mocks.NewMockWalletRepository(ctrl)
+	hashSvc := mocks.NewMockHashService(ctrl)
+	encSvc := mocks.NewMockEncryptionService(ctrl)
+	cache := mocks.NewMockIdempotencyCache(ctrl)
+	svc := NewAuthService(merchantRepo, walletRepo, newRegisterTransactor(ctrl), hashSvc, encSvc, mocks.NewMockTokenService(ctrl),
+		WithRegisterIdempotency(cache, nil))
+
+	ctx := context.Background()
+	key := "reg-1"
+	req := ports.RegisterRequest{
+		Username:       "new_merchant",
+		Password:       "StrongP@ss123",
+		MerchantName:   "Test Shop",
+		IdempotencyKey: &key,
+	}
+	cacheKey := domain.BuildRegisterIdempotencyKey(key)
+
+	// First attempt: nothing cached, full registration
+	var stored []byte
+	var created *domain.Merchant
+	cache.EXPECT().Get(ctx, cacheKey).Return(nil, nil)
+	merchantRepo.EXPECT().GetByUsername(ctx, req.Username).Return(nil, nil)
+	hashSvc.EXPECT().Hash(req.Password).Return("$argon2id$hashed", nil)
+	encSvc.EXPECT().Encrypt("0").Return("encrypted_zero", nil)
+	encSvc.EXPECT().Encrypt(gomock.Any()).Return("encrypted_secret", nil)
+	cache.EXPECT().Set(ctx, cacheKey, gomock.Any(), idempotencyTTL).DoAndReturn(
+		func(_ context.Context, _ string, value []byte, _ time.Duration) error {
+			stored = value
+			return nil
+		})
+	merchantRepo.EXPECT().Create(ctx, gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, _ pgx.Tx, m *domain.Merchant) error {
+		created = m
+		return nil
+	})
+	walletRepo.EXPECT().GetOrCreateForUpdate(ctx, gomock.Any(), gomock.Any()).DoAndReturn(createdWallet)
+
+	first, err := svc.Register(ctx, req)
+	require.NoError(t, err)
+	assert.NotContains(t, string(stored), first.SecretKey, "secret must not be cached in plaintext")
+	assert.Contains(t, string(stored), "encrypted_secret")
+
+	// Retry: cached record replays the original credentials
+	cache.EXPECT().Get(ctx, cacheKey).Return(stored, nil)
+	merchantRepo.EXPECT().GetByID(ctx, created.ID).Return(created, nil)
+	hashSvc.EXPECT().Verify(req.Password, "$argon2id$hashed").Return(true, nil)
+	walletRepo.EXPECT().GetByMerchantID(ctx, created.ID, "VND").Return(&domain.Wallet{ID: uuid.New()}, nil)
+	encSvc.EXPECT().Decrypt(created.SecretKeyEnc).Return(first.SecretKey, nil)
+
+	second, err := svc.Register(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+}
+
+func TestAuthService_Register_IdempotentRetryRepairsMissingWallet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	merchantRepo := mocks.NewMockMerchantRepository(ctrl)
+	walletRepo := mocks.NewMockWalletRepository(ctrl)
+	hashSvc := mocks.NewMockHashService(ctrl)
+	encSvc := mocks.NewMockEncryptionService(ctrl)
+	cache := mocks.NewMockIdempotencyCache(ctrl)
+	svc := NewAuthService(merchantRepo, walletRepo, newRegisterTransactor(ctrl), hashSvc, encSvc, mocks.NewMockTokenService(ctrl),
+		WithRegisterIdempotency(cache, nil))
+
+	ctx := context.Background()
+	key := "reg-2"
+	merchant := &domain.Merchant{ID: uuid.New(), Username: "orphan", PasswordHash: "hash:p", AccessKey: "ak", SecretKeyEnc: "enc:sk"}
+	cache.EXPECT().Get(ctx, gomock.Any()).Return(
+		[]byte(`{"merchant_id":"`+merchant.ID.String()+`","username":"orphan","access_key":"ak","secret_key_enc":"enc:sk"}`), nil)
+	merchantRepo.EXPECT().GetByID(ctx, merchant.ID).Return(merchant, nil)
+	hashSvc.EXPECT().Verify("p", "hash:p").Return(true, nil)
+	walletRepo.EXPECT().GetByMerchantID(ctx, merchant.ID, "VND").Return(nil, nil)
+	encSvc.EXPECT().Encrypt("0").Return("encrypted_zero", nil)
+	walletRepo.EXPECT().Create(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, w *domain.Wallet) error {
+		assert.Equal(t, merchant.ID, w.MerchantID)
+		return nil
+	})
+	encSvc.EXPECT().Decrypt("enc:sk").Return("sk", nil)
+
+	resp, err := svc.Register(ctx, ports.RegisterRequest{Username: "orphan", Password: "p", IdempotencyKey: &key})
+	require.NoError(t, err)
+	assert.Equal(t, "ak", resp.AccessKey)
+	assert.Equal(t, "sk", resp.SecretKey)
+}
+
+func TestAuthService_Register_IdempotencyKeyReusedForOtherUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cache := mocks.NewMockIdempotencyCache(ctrl)
+	svc := NewAuthService(mocks.NewMockMerchantRepository(ctrl), mocks.NewMockWalletRepository(ctrl), mocks.NewMockDBTransactor(ctrl),
+		mocks.NewMockHashService(ctrl), mocks.NewMockEncryptionService(ctrl), mocks.NewMockTokenService(ctrl),
+		WithRegisterIdempotency(cache, nil))
+
+	key := "reg-3"
+	cache.EXPECT().Get(gomock.Any(), gomock.Any()).Return(
+		[]byte(`{"merchant_id":"`+uuid.New().String()+`","username":"someone_else"}`), nil)
+
+	resp, err := svc.Register(context.Background(), ports.RegisterRequest{Username: "me", IdempotencyKey: &key})
+	assert.Nil(t, resp)
+
+	var appErr *apperror.AppError
+	require.True(t, errors.As(err, &appErr))
+	assert.Equal(t, "PAY_002", appErr.Code)
+}
+
+func TestAuthService_Register_IdempotentRetryWithWrongPassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	merchantRepo := mocks.NewMockMerchantRepository(ctrl)
+	hashSvc := mocks.NewMockHashService(ctrl)
+	cache := mocks.NewMockIdempotencyCache(ctrl)
+	// No Decrypt expectation: the secret key is never read
+	svc := NewAuthService(merchantRepo, mocks.NewMockWalletRepository(ctrl), mocks.NewMockDBTransactor(ctrl), hashSvc,
+		mocks.NewMockEncryptionService(ctrl), mocks.NewMockTokenService(ctrl), WithRegisterIdempotency(cache, nil))
+
+	ctx := context.Background()
+	key := "reg-4"
+	merchant := &domain.Merchant{ID: uuid.New(), Username: "victim", PasswordHash: "hash:real", AccessKey: "ak", SecretKeyEnc: "enc:sk"}
+	cache.EXPECT().Get(ctx, gomock.Any()).Return(
+		[]byte(`{"merchant_id":"`+merchant.ID.String()+`","username":"victim","access_key":"ak","secret_key_enc":"enc:sk"}`), nil)
+	merchantRepo.EXPECT().GetByID(ctx, merchant.ID).Return(merchant, nil)
+	hashSvc.EXPECT().Verify("guess", "hash:real").Return(false, nil)
+
+	resp, err := svc.Register(ctx, ports.RegisterRequest{Username: "victim", Password: "guess", IdempotencyKey: &key})
+	assert.Nil(t, resp)
+	assertAppError(t, err, "PAY_002")
+	assert.Contains(t, err.Error(), "different registration", "reported like another username")
+}
+
 func TestAuthService_Login_Success(t *testing.T) {
 	svc, merchantRepo, _, hashSvc, _, tokenSvc, ctrl := setupAuthService(t)
 	defer ctrl.Finish()
@@ -113,12 +453,83 @@ func TestAuthService_Login_Success(t *testing.T) {
 	merchantRepo.EXPECT().GetByUsername(ctx, "test_user").Return(merchant, nil)
 	hashSvc.EXPECT().Verify("correct_password", "$argon2id$hashed").Return(true, nil)
 	tokenSvc.EXPECT().Generate(merchantID, accessKey).Return("jwt_token_here", time.Now().Add(24*time.Hour), nil)
+	merchantRepo.EXPECT().UpdateLastLoginAt(ctx, merchantID, gomock.Any()).Return(nil)
 
 	token, _, err := svc.Login(ctx, "test_user", "correct_password")
 	require.NoError(t, err)
 	assert.Equal(t, "jwt_token_here", token)
 }
 
+func TestAuthService_Login_LastLoginWriteFailureLogged(t *testing.T) {
+	svc, merchantRepo, _, hashSvc, _, tokenSvc, ctrl := setupAuthService(t)
+	defer ctrl.Finish()
+	var logs bytes.Buffer
+	WithAuthLogger(zerolog.New(&logs))(svc)
+
+	ctx := context.Background()
+	merchant := &domain.Merchant{
+		ID: uuid.New(), Username: "test_user", PasswordHash: "$argon2id$hashed", AccessKey: "ak_test123", Status: domain.MerchantStatusActive,
+	}
+	merchantRepo.EXPECT().GetByUsername(ctx, "test_user").Return(merchant, nil)
+	hashSvc.EXPECT().Verify("correct_password", "$argon2id$hashed").Return(true, nil)
+	tokenSvc.EXPECT().Generate(merchant.ID, "ak_test123").Return("jwt_token_here", time.Now().Add(24*time.Hour), nil)
+	merchantRepo.EXPECT().UpdateLastLoginAt(ctx, merchant.ID, gomock.Any()).Return(errors.New("db down"))
+
+	// The login still succeeds; the failed write is only logged
+	token, _, err := svc.Login(ctx, "test_user", "correct_password")
+	require.NoError(t, err)
+	assert.Equal(t, "jwt_token_here", token)
+	assert.Contains(t, logs.String(), "failed to record last_login_at")
+	assert.Contains(t, logs.String(), merchant.ID.String())
+}
+
+func TestAuthService_Login_SessionExpiryOverride(t *testing.T) {
+	intPtr := func(n int) *int { return &n }
+	tests := []struct {
+		name       string
+		override   *int // seconds
+		wantExpiry time.Duration
+	}{
+		{"no override uses global expiry", nil, 24 * time.Hour},
+		{"shorter override", intPtr(900), 15 * time.Minute},
+		{"override above max is clamped", intPtr(int((72 * time.Hour).Seconds())), 8 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			merchantRepo := mocks.NewMockMerchantRepository(ctrl)
+			hashSvc := mocks.NewMockHashService(ctrl)
+			tokenSvc := NewJWTTokenService(testJWTSecret, 24*time.Hour, "test-issuer")
+			svc := NewAuthService(merchantRepo, mocks.NewMockWalletRepository(ctrl), mocks.NewMockDBTransactor(ctrl), hashSvc,
+				mocks.NewMockEncryptionService(ctrl), tokenSvc, WithMaxSessionExpiry(8*time.Hour))
+
+			ctx := context.Background()
+			merchant := &domain.Merchant{
+				ID:                   uuid.New(),
+				Username:             "test_user",
+				PasswordHash:         "$argon2id$hashed",
+				AccessKey:            "ak_test123",
+				Status:               domain.MerchantStatusActive,
+				SessionExpirySeconds: tt.override,
+			}
+			merchantRepo.EXPECT().GetByUsername(ctx, "test_user").Return(merchant, nil)
+			hashSvc.EXPECT().Verify("correct_password", "$argon2id$hashed").Return(true, nil)
+			merchantRepo.EXPECT().UpdateLastLoginAt(ctx, merchant.ID, gomock.Any()).Return(nil)
+
+			before := time.Now()
+			token, expiry, err := svc.Login(ctx, "test_user", "correct_password")
+			require.NoError(t, err)
+
+			// The exp claim has second precision
+			want := before.Add(tt.wantExpiry)
+			assert.WithinDuration(t, want, expiry, 2*time.Second)
+			claims, err := tokenSvc.Validate(token)
+			require.NoError(t, err)
+			assert.Equal(t, merchant.ID, claims.MerchantID)
+		})
+	}
+}
+
 func TestAuthService_Login_UserNotFound(t *testing.T) {
 	svc, merchantRepo, _, _, _, _, ctrl := setupAuthService(t)
 	defer ctrl.Finish()
@@ -179,3 +590,127 @@ func TestAuthService_Login_MerchantSuspended(t *testing.T) {
 	require.True(t, errors.As(err, &appErr))
 	assert.Equal(t, "AUTH_004", appErr.Code)
 }
+
+func TestAuthService_LoginSession_IssuesRefreshToken(t *testing.T) {
+	svc, merchantRepo, _, hashSvc, _, tokenSvc, ctrl := setupAuthService(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	merchant := &domain.Merchant{
+		ID:           uuid.New(),
+		Username:     "test_user",
+		PasswordHash: "$argon2id$hashed",
+		AccessKey:    "ak_test123",
+		Status:       domain.MerchantStatusActive,
+	}
+
+	merchantRepo.EXPECT().GetByUsername(ctx, "test_user").Return(merchant, nil)
+	hashSvc.EXPECT().Verify("correct_password", "$argon2id$hashed").Return(true, nil)
+	tokenSvc.EXPECT().Generate(merchant.ID, "ak_test123").Return("jwt_token_here", time.Now().Add(time.Hour), nil)
+	tokenSvc.EXPECT().GenerateRefresh(merchant.ID, "ak_test123").Return("refresh_token_here", time.Now().Add(168*time.Hour), nil)
+	merchantRepo.EXPECT().UpdateLastLoginAt(ctx, merchant.ID, gomock.Any()).Return(nil)
+
+	session, err := svc.LoginSession(ctx, "test_user", "correct_password")
+	require.NoError(t, err)
+	assert.Equal(t, "jwt_token_here", session.AccessToken)
+	assert.Equal(t, "refresh_token_here", session.RefreshToken)
+}
+
+func TestAuthService_Refresh(t *testing.T) {
+	merchantID := uuid.New()
+	claims := &ports.TokenClaims{MerchantID: merchantID, AccessKey: "ak_test123"}
+
+	tests := map[string]struct {
+		merchant *domain.Merchant
+		wantCode string
+	}{
+		"active":        {merchant: &domain.Merchant{ID: merchantID, AccessKey: "ak_test123", Status: domain.MerchantStatusActive}},
+		"keys rotated":  {merchant: &domain.Merchant{ID: merchantID, AccessKey: "ak_rotated", Status: domain.MerchantStatusActive}, wantCode: "AUTH_003"},
+		"suspended":     {merchant: &domain.Merchant{ID: merchantID, AccessKey: "ak_test123", Status: domain.MerchantStatusSuspended}, wantCode: "AUTH_004"},
+		"merchant gone": {wantCode: "AUTH_003"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			svc, merchantRepo, _, _, _, tokenSvc, ctrl := setupAuthService(t)
+			defer ctrl.Finish()
+
+			ctx := context.Background()
+			tokenSvc.EXPECT().ValidateRefresh("refresh_token").Return(claims, nil)
+			merchantRepo.EXPECT().GetByID(ctx, merchantID).Return(tt.merchant, nil)
+			if tt.wantCode == "" {
+				tokenSvc.EXPECT().Generate(merchantID, "ak_test123").Return("new_jwt", time.Now().Add(time.Hour), nil)
+				tokenSvc.EXPECT().GenerateRefresh(merchantID, "ak_test123").Return("new_refresh", time.Now().Add(168*time.Hour), nil)
+			}
+
+			session, err := svc.Refresh(ctx, "refresh_token")
+			if tt.wantCode != "" {
+				var appErr *apperror.AppError
+				require.True(t, errors.As(err, &appErr))
+				assert.Equal(t, tt.wantCode, appErr.Code)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "new_jwt", session.AccessToken)
+			assert.Equal(t, "new_refresh", session.RefreshToken)
+		})
+	}
+}
+
+func TestAuthService_Refresh_RotationRejectsReuse(t *testing.T) {
+	svc, merchantRepo, _, _, _, tokenSvc, ctrl := setupAuthService(t)
+	defer ctrl.Finish()
+	nonces := mocks.NewMockNonceStore(ctrl)
+	WithRefreshRotation(nonces)(svc)
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	claims := &ports.TokenClaims{MerchantID: merchantID, AccessKey: "ak_test123", TokenID: "jti-1", ExpiresAt: time.Now().Add(time.Hour)}
+	merchant := &domain.Merchant{ID: merchantID, AccessKey: "ak_test123", Status: domain.MerchantStatusActive}
+
+	tokenSvc.EXPECT().ValidateRefresh("refresh_token").Return(claims, nil).Times(2)
+	merchantRepo.EXPECT().GetByID(ctx, merchantID).Return(merchant, nil).Times(2)
+	gomock.InOrder(
+		nonces.EXPECT().CheckAndSet(ctx, "refresh:"+merchantID.String(), "jti-1", gomock.Any()).Return(true, nil),
+		nonces.EXPECT().CheckAndSet(ctx, "refresh:"+merchantID.String(), "jti-1", gomock.Any()).Return(false, nil),
+	)
+	tokenSvc.EXPECT().Generate(merchantID, "ak_test123").Return("new_jwt", time.Now().Add(time.Hour), nil)
+	tokenSvc.EXPECT().GenerateRefresh(merchantID, "ak_test123").Return("new_refresh", time.Now().Add(168*time.Hour), nil)
+
+	_, err := svc.Refresh(ctx, "refresh_token")
+	require.NoError(t, err)
+
+	// The same token replayed, e.g. by whoever stole it, is refused
+	_, err = svc.Refresh(ctx, "refresh_token")
+	var appErr *apperror.AppError
+	require.True(t, errors.As(err, &appErr))
+	assert.Equal(t, "AUTH_003", appErr.Code)
+}
+
+func TestAuthService_Refresh_RotationRejectsTokenWithoutID(t *testing.T) {
+	svc, merchantRepo, _, _, _, tokenSvc, ctrl := setupAuthService(t)
+	defer ctrl.Finish()
+	// No CheckAndSet: a token issued before rotation has nothing to record
+	WithRefreshRotation(mocks.NewMockNonceStore(ctrl))(svc)
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	tokenSvc.EXPECT().ValidateRefresh("legacy_refresh").Return(&ports.TokenClaims{MerchantID: merchantID, AccessKey: "ak_test123", ExpiresAt: time.Now().Add(time.Hour)}, nil)
+	merchantRepo.EXPECT().GetByID(ctx, merchantID).Return(&domain.Merchant{ID: merchantID, AccessKey: "ak_test123", Status: domain.MerchantStatusActive}, nil)
+
+	_, err := svc.Refresh(ctx, "legacy_refresh")
+	var appErr *apperror.AppError
+	require.True(t, errors.As(err, &appErr))
+	assert.Equal(t, "AUTH_003", appErr.Code)
+}
+
+func TestAuthService_Refresh_InvalidToken(t *testing.T) {
+	svc, _, _, _, _, tokenSvc, ctrl := setupAuthService(t)
+	defer ctrl.Finish()
+
+	tokenSvc.EXPECT().ValidateRefresh("access_token").Return(nil, errors.New("unexpected token type"))
+
+	_, err := svc.Refresh(context.Background(), "access_token")
+	var appErr *apperror.AppError
+	require.True(t, errors.As(err, &appErr))
+	assert.Equal(t, "AUTH_003", appErr.Code)
+}
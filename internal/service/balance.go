@@ -0,0 +1,92 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"secure-payment-gateway/internal/core/domain"
+	"secure-payment-gateway/internal/core/ports"
+	"secure-payment-gateway/pkg/apperror"
+
+	"github.com/rs/zerolog"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	minInt64Balance = decimal.NewFromInt(math.MinInt64)
+	maxInt64Balance = decimal.NewFromInt(math.MaxInt64)
+)
+
+// decryptBalance decrypts and parses a wallet balance. By default the
+// plaintext is an int64 in minor units; wallets flagged DecimalBalance store
+// an arbitrary-precision decimal string instead. Either way the balance is
+// returned as a decimal so payment math is exact.
+//
+// A value that decrypts but does not parse means the ciphertext was tampered
+// with or was encrypted under a different key, so it is reported as an
+// integrity failure (SYS_004) and logged as an alert rather than as a
+// transient internal error.
+func decryptBalance(encSvc ports.EncryptionService, wallet *domain.Wallet, log zerolog.Logger) (decimal.Decimal, error) {
+	plain, err := encSvc.Decrypt(wallet.EncryptedBalance)
+	if err != nil {
+		return decimal.Zero, apperror.ErrEncryptionFailure(fmt.Errorf("decrypt balance: %w", err))
+	}
+
+	var balance decimal.Decimal
+	if wallet.DecimalBalance {
+		balance, err = decimal.NewFromString(plain)
+	} else {
+		var n int64
+		n, err = strconv.ParseInt(plain, 10, 64)
+		balance = decimal.NewFromInt(n)
+	}
+	if err != nil {
+		// Don't wrap err: it would carry the decrypted value into logs.
+		log.Error().
+			Bool("alert", true).
+			Str("wallet_id", wallet.ID.String()).
+			Bool("decimal_balance", wallet.DecimalBalance).
+			Msg("decrypted wallet balance is not a number: possible tampering or key mismatch")
+		return decimal.Zero, apperror.ErrDataIntegrity(fmt.Errorf("wallet %s: decrypted balance is not a number", wallet.ID))
+	}
+	return balance, nil
+}
+
+// encryptBalance formats balance in the wallet's representation and encrypts
+// it. An int64 wallet rejects a balance it cannot hold exactly.
+func encryptBalance(encSvc ports.EncryptionService, wallet *domain.Wallet, balance decimal.Decimal) (string, error) {
+	var plain string
+	if wallet.DecimalBalance {
+		plain = balance.String()
+	} else {
+		if !balance.IsInteger() || balance.LessThan(minInt64Balance) || balance.GreaterThan(maxInt64Balance) {
+			return "", apperror.ErrTransactionLimitExceeded()
+		}
+		plain = strconv.FormatInt(balance.IntPart(), 10)
+	}
+
+	enc, err := encSvc.Encrypt(plain)
+	if err != nil {
+		return "", apperror.ErrEncryptionFailure(fmt.Errorf("encrypt new balance: %w", err))
+	}
+	return enc, nil
+}
+
+// requestAmount joins a request's Amount and AmountDecimal back into the
+// exact amount.
+func requestAmount(amount int64, amountDecimal *decimal.Decimal) decimal.Decimal {
+	if amountDecimal != nil {
+		return *amountDecimal
+	}
+	return decimal.NewFromInt(amount)
+}
+
+// checkAmountPrecision rejects a fractional amount on a wallet that holds
+// int64 minor units. Only DecimalBalance wallets take fractions.
+func checkAmountPrecision(wallet *domain.Wallet, amount decimal.Decimal) error {
+	if !wallet.DecimalBalance && !amount.IsInteger() {
+		return apperror.Validation(fmt.Sprintf("amount must be a whole number of minor units for %s wallets", wallet.Currency))
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"secure-payment-gateway/internal/core/domain"
+	"secure-payment-gateway/internal/core/ports/mocks"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestDecryptBalance_Int64Wallet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	encSvc := mocks.NewMockEncryptionService(ctrl)
+	wallet := &domain.Wallet{ID: uuid.New(), EncryptedBalance: "enc"}
+
+	encSvc.EXPECT().Decrypt("enc").Return("9223372036854775807", nil)
+	balance, err := decryptBalance(encSvc, wallet, zerolog.Nop())
+	require.NoError(t, err)
+	assert.Equal(t, "9223372036854775807", balance.String())
+
+	// A fractional plaintext is not a valid int64 balance
+	encSvc.EXPECT().Decrypt("enc").Return("1.5", nil)
+	_, err = decryptBalance(encSvc, wallet, zerolog.Nop())
+	assertAppError(t, err, "SYS_004")
+}
+
+func TestDecryptBalance_DecimalWallet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	encSvc := mocks.NewMockEncryptionService(ctrl)
+	wallet := &domain.Wallet{ID: uuid.New(), EncryptedBalance: "enc", DecimalBalance: true}
+
+	encSvc.EXPECT().Decrypt("enc").Return("12345678901234567890.123456789", nil)
+	balance, err := decryptBalance(encSvc, wallet, zerolog.Nop())
+	require.NoError(t, err)
+	assert.Equal(t, "12345678901234567890.123456789", balance.String())
+}
+
+func TestDecryptBalance_IntegrityAndDecryptErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	encSvc := mocks.NewMockEncryptionService(ctrl)
+	var logs bytes.Buffer
+	log := zerolog.New(&logs)
+
+	for _, decimalBalance := range []bool{false, true} {
+		wallet := &domain.Wallet{ID: uuid.New(), EncryptedBalance: "enc", DecimalBalance: decimalBalance}
+		encSvc.EXPECT().Decrypt("enc").Return("not-a-number", nil)
+		_, err := decryptBalance(encSvc, wallet, log)
+		assertAppError(t, err, "SYS_004")
+		assert.NotContains(t, err.Error(), "not-a-number")
+		assert.Contains(t, logs.String(), wallet.ID.String())
+	}
+	assert.Contains(t, logs.String(), `"alert":true`)
+
+	encSvc.EXPECT().Decrypt("enc").Return("", errors.New("bad key"))
+	_, err := decryptBalance(encSvc, &domain.Wallet{EncryptedBalance: "enc"}, log)
+	assertAppError(t, err, "SYS_003")
+}
+
+func TestEncryptBalance(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	encSvc := mocks.NewMockEncryptionService(ctrl)
+
+	intWallet := &domain.Wallet{}
+	encSvc.EXPECT().Encrypt("50000").Return("enc_50000", nil)
+	enc, err := encryptBalance(encSvc, intWallet, decimal.NewFromInt(50000))
+	require.NoError(t, err)
+	assert.Equal(t, "enc_50000", enc)
+
+	// An int64 wallet cannot hold a fraction or overflow
+	_, err = encryptBalance(encSvc, intWallet, decimal.RequireFromString("0.5"))
+	assertAppError(t, err, "PAY_005")
+	_, err = encryptBalance(encSvc, intWallet, decimal.RequireFromString("9223372036854775808"))
+	assertAppError(t, err, "PAY_005")
+
+	decWallet := &domain.Wallet{DecimalBalance: true}
+	encSvc.EXPECT().Encrypt("9223372036854775808.25").Return("enc_big", nil)
+	enc, err = encryptBalance(encSvc, decWallet, decimal.RequireFromString("9223372036854775808.25"))
+	require.NoError(t, err)
+	assert.Equal(t, "enc_big", enc)
+}
+
+func TestDecimalBalanceArithmeticIsExact(t *testing.T) {
+	// 0.1 + 0.2 is 0.30000000000000004 in float64
+	sum := decimal.RequireFromString("0.1").Add(decimal.RequireFromString("0.2"))
+	assert.Equal(t, "0.3", sum.String())
+
+	balance := decimal.RequireFromString("1000000000000000000.000000001")
+	balance = balance.Sub(decimal.NewFromInt(1))
+	assert.Equal(t, "999999999999999999.000000001", balance.String())
+	balance = balance.Add(decimal.NewFromInt(1))
+	assert.Equal(t, "1000000000000000000.000000001", balance.String())
+
+	// Repeated small credits do not drift
+	total := decimal.Zero
+	for i := 0; i < 1000; i++ {
+		total = total.Add(decimal.RequireFromString("0.001"))
+	}
+	assert.True(t, total.Equal(decimal.NewFromInt(1)), total.String())
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"secure-payment-gateway/internal/core/ports"
+)
+
+// encryptionProbe is the known value round-tripped by EncryptionHealthCheck.
+const encryptionProbe = "spg-encryption-health-probe"
+
+// EncryptionHealthCheck implements ports.HealthChecker for the encryption
+// service by encrypting and decrypting a known value, so a misconfigured key
+// surfaces at startup and in /health instead of on the first payment.
+type EncryptionHealthCheck struct {
+	enc ports.EncryptionService
+}
+
+// NewEncryptionHealthCheck creates an encryption health checker.
+func NewEncryptionHealthCheck(enc ports.EncryptionService) *EncryptionHealthCheck {
+	return &EncryptionHealthCheck{enc: enc}
+}
+
+// Ping round-trips the probe value through the encryption service.
+func (h *EncryptionHealthCheck) Ping(_ context.Context) error {
+	ciphertext, err := h.enc.Encrypt(encryptionProbe)
+	if err != nil {
+		return fmt.Errorf("encrypting probe: %w", err)
+	}
+	plaintext, err := h.enc.Decrypt(ciphertext)
+	if err != nil {
+		return fmt.Errorf("decrypting probe: %w", err)
+	}
+	if plaintext != encryptionProbe {
+		return fmt.Errorf("encryption round-trip mismatch")
+	}
+	return nil
+}
+
+// Name returns the dependency name.
+func (h *EncryptionHealthCheck) Name() string {
+	return "encryption"
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptionHealthCheck_Healthy(t *testing.T) {
+	enc, err := NewAESEncryptionService(testAESKey)
+	require.NoError(t, err)
+
+	check := NewEncryptionHealthCheck(enc)
+	assert.Equal(t, "encryption", check.Name())
+	assert.NoError(t, check.Ping(context.Background()))
+}
+
+func TestEncryptionHealthCheck_BadKeyUnhealthy(t *testing.T) {
+	enc, err := NewAESEncryptionService(testAESKey)
+	require.NoError(t, err)
+	enc.key = []byte("not-a-valid-aes-key") // corrupted after construction
+
+	err = NewEncryptionHealthCheck(enc).Ping(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "encrypting probe")
+}
+
+// mismatchEncryption decrypts every ciphertext to a different value, as a
+// service with a silently wrong key or broken codec would.
+type mismatchEncryption struct{}
+
+func (mismatchEncryption) Encrypt(plaintext string) (string, error) { return plaintext, nil }
+func (mismatchEncryption) Decrypt(string) (string, error)           { return "something else", nil }
+
+func TestEncryptionHealthCheck_RoundTripMismatch(t *testing.T) {
+	err := NewEncryptionHealthCheck(mismatchEncryption{}).Ping(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "mismatch")
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"secure-payment-gateway/internal/core/ports"
+	"secure-payment-gateway/pkg/apperror"
+)
+
+// InFlightMode selects what happens to a request whose idempotency key is
+// already being processed by another request.
+type InFlightMode string
+
+const (
+	// InFlightBlock waits for the first request and replays its result, so
+	// a client retrying on a timeout still gets the outcome.
+	InFlightBlock InFlightMode = "block"
+	// InFlightConflict fails the duplicate at once with PAY_003, leaving
+	// the client to retry once the first request has finished.
+	InFlightConflict InFlightMode = "conflict"
+)
+
+const (
+	// inFlightLockTTL bounds how long a crashed request keeps its key claimed.
+	inFlightLockTTL = 30 * time.Second
+	// inFlightPollInterval is how often a blocked duplicate looks for the
+	// first request's result.
+	inFlightPollInterval = 25 * time.Millisecond
+)
+
+// inFlightGuard holds the WithInFlightLock settings.
+type inFlightGuard struct {
+	lock ports.InFlightLock
+	mode InFlightMode
+	wait time.Duration // InFlightBlock: longest wait before PAY_003
+}
+
+// WithInFlightLock claims each payment, refund and topup idempotency key
+// while the request runs. A concurrent duplicate then no longer races the
+// first request into the database. In InFlightBlock mode it waits up to
+// wait for the first result and replays it. In InFlightConflict mode it
+// fails immediately with PAY_003. If the lock is unavailable, requests
+// proceed unguarded, as without this option.
+func WithInFlightLock(lock ports.InFlightLock, mode InFlightMode, wait time.Duration) PaymentOption {
+	return func(s *PaymentServiceImpl) {
+		s.inFlight = nil
+		if lock != nil {
+			s.inFlight = &inFlightGuard{lock: lock, mode: mode, wait: wait}
+		}
+	}
+}
+
+// claimInFlight claims idempKey for this request and returns a func
+// releasing it, to be deferred. If the first request holding the key
+// finishes while this one waits, its stored result is returned instead.
+// The stores are checked again once the claim is held, since the first
+// request may have committed and released the key just before.
+func (s *PaymentServiceImpl) claimInFlight(ctx context.Context, idempKey string) (release func(), replay []byte, err error) {
+	noop := func() {}
+	if s.inFlight == nil {
+		return noop, nil, nil
+	}
+	deadline := time.Now().Add(s.inFlight.wait)
+
+	for {
+		token, err := s.inFlight.lock.Acquire(ctx, idempKey, inFlightLockTTL)
+		if err != nil {
+			s.log.Warn().Err(err).Str("key", idempKey).Msg("in-flight lock unavailable, proceeding without it")
+			return noop, nil, nil
+		}
+		if token != "" {
+			release = func() {
+				if err := s.inFlight.lock.Release(context.WithoutCancel(ctx), idempKey, token); err != nil {
+					s.log.Warn().Err(err).Str("key", idempKey).Msg("failed to release in-flight lock")
+				}
+			}
+			stored, err := s.storedResult(ctx, idempKey)
+			if err != nil || stored != nil {
+				release()
+				return nil, stored, err
+			}
+			return release, nil, nil
+		}
+
+		if s.inFlight.mode != InFlightBlock || !time.Now().Before(deadline) {
+			return nil, nil, apperror.ErrDuplicateTransaction()
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil, apperror.InternalError(fmt.Errorf("waiting for in-flight duplicate: %w", ctx.Err()))
+		case <-time.After(inFlightPollInterval):
+		}
+		// The first request may have failed, freeing the key without a result
+		if stored, err := s.storedResult(ctx, idempKey); err != nil || stored != nil {
+			return nil, stored, err
+		}
+	}
+}
+
+// storedResult returns the response stored under idempKey by a finished
+// request, from the cache or else the database, or nil if there is none.
+func (s *PaymentServiceImpl) storedResult(ctx context.Context, idempKey string) ([]byte, error) {
+	if cached, err := s.idempCache.Get(ctx, idempKey); err == nil && cached != nil {
+		return cached, nil
+	}
+	idempLog, err := s.idempRepo.Get(ctx, idempKey)
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("db idempotency check: %w", err))
+	}
+	if idempLog == nil {
+		return nil, nil
+	}
+	return idempLog.ResponseJSON, nil
+}
+
+// claimKey claims key on lock while one request runs and returns a func
+// releasing it, to be deferred. It fails with PAY_003 if another request
+// holds the key. With a nil or unavailable lock the request proceeds
+// unguarded. Unlike claimInFlight it never waits: callers replay whatever
+// the first request cached once they hold the key.
+func claimKey(ctx context.Context, lock ports.InFlightLock, key string) (func(), error) {
+	noop := func() {}
+	if lock == nil {
+		return noop, nil
+	}
+	token, err := lock.Acquire(ctx, key, inFlightLockTTL)
+	if err != nil {
+		return noop, nil
+	}
+	if token == "" {
+		return nil, apperror.ErrRequestInProgress()
+	}
+	return func() {
+		_ = lock.Release(context.WithoutCancel(ctx), key, token)
+	}, nil
+}
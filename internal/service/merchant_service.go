@@ -4,9 +4,13 @@ import (
 "context"
 "crypto/rand"
 "encoding/hex"
+"encoding/json"
 "fmt"
+"net/mail"
+"regexp"
 "time"
 
+"secure-payment-gateway/internal/core/domain"
 "secure-payment-gateway/internal/core/ports"
 "secure-payment-gateway/pkg/apperror"
 
@@ -16,17 +20,69 @@ import (
 type merchantService struct {
 merchantRepo ports.MerchantRepository
 encSvc       ports.EncryptionService
+secretMaxAge time.Duration // 0 = secrets never expire
+notifier     ports.NotificationService // nil = no notifications
+rotateCache  ports.IdempotencyCache    // nil = rotations are not idempotent
+rotateLock   ports.InFlightLock        // nil = concurrent rotations with one key both rotate
+}
+
+// rotateKeysIdempotencyTTL is how long a rotation can be retried with the
+// same Idempotency-Key and get the same keys back. It only needs to cover
+// double-clicks and client retries.
+const rotateKeysIdempotencyTTL = 10 * time.Minute
+
+// rotationRecord is the cached outcome of an idempotent key rotation.
+type rotationRecord struct {
+AccessKey    string `json:"access_key"`
+SecretKeyEnc string `json:"secret_key_enc"` // Never cached in plaintext
+}
+
+// MerchantOption configures optional merchantService behaviour.
+type MerchantOption func(*merchantService)
+
+// WithSecretMaxAge reports in profiles when each merchant's API secret
+// expires. It should match the age enforced by HMACAuth.
+func WithSecretMaxAge(maxAge time.Duration) MerchantOption {
+return func(s *merchantService) {
+s.secretMaxAge = maxAge
+}
+}
+
+// WithMerchantNotifications notifies merchants of key rotations, per their
+// notification preferences.
+func WithMerchantNotifications(notifier ports.NotificationService) MerchantOption {
+return func(s *merchantService) {
+s.notifier = notifier
+}
+}
+
+// WithRotateKeysIdempotency enables Idempotency-Key support on key
+// rotation. The new keys are kept in the cache (secret encrypted) for
+// rotateKeysIdempotencyTTL, so a retried rotation returns them instead of
+// replacing the keys the merchant just copied. lock claims the key while a
+// rotation runs, so of two concurrent requests (a double-click) one rotates
+// and the other fails with PAY_003; nil leaves them to race.
+func WithRotateKeysIdempotency(cache ports.IdempotencyCache, lock ports.InFlightLock) MerchantOption {
+return func(s *merchantService) {
+s.rotateCache = cache
+s.rotateLock = lock
+}
 }
 
 // NewMerchantService creates a new merchant management service.
 func NewMerchantService(
 merchantRepo ports.MerchantRepository,
 encSvc ports.EncryptionService,
+opts ...MerchantOption,
 ) ports.MerchantManagementService {
-return &merchantService{
+s := &merchantService{
 merchantRepo: merchantRepo,
 encSvc:       encSvc,
 }
+for _, opt := range opts {
+opt(s)
+}
+return s
 }
 
 func (s *merchantService) GetProfile(ctx context.Context, merchantID uuid.UUID) (*ports.MerchantProfile, error) {
@@ -38,14 +94,30 @@ if merchant == nil {
 return nil, apperror.ErrNotFound("merchant")
 }
 
-return &ports.MerchantProfile{
+profile := &ports.MerchantProfile{
 ID:           merchant.ID,
 Username:     merchant.Username,
 MerchantName: merchant.MerchantName,
 WebhookURL:   merchant.WebhookURL,
 Status:       merchant.Status,
+SynchronousWebhook: merchant.SynchronousWebhook,
+RequireIdempotencyKey: merchant.RequireIdempotencyKey,
+WebhookPayloadMode: domain.WebhookPayloadFull,
+SessionExpirySeconds: merchant.SessionExpirySeconds,
+NotificationPreferences: merchant.NotificationPreferences,
 CreatedAt:    merchant.CreatedAt.Format(time.RFC3339),
-}, nil
+}
+if merchant.WebhookPayloadMode != "" {
+profile.WebhookPayloadMode = merchant.WebhookPayloadMode
+}
+if profile.NotificationPreferences.Events == nil {
+profile.NotificationPreferences.Events = []domain.NotificationEvent{}
+}
+profile.LastUsedAt = formatOptionalTime(merchant.LastUsedAt)
+profile.LastLoginAt = formatOptionalTime(merchant.LastLoginAt)
+profile.SecretRotatedAt = formatOptionalTime(merchant.SecretRotatedAt)
+profile.SecretExpiresAt = formatOptionalTime(merchant.SecretExpiresAt(s.secretMaxAge))
+return profile, nil
 }
 
 func (s *merchantService) UpdateWebhookURL(ctx context.Context, merchantID uuid.UUID, webhookURL *string) error {
@@ -66,7 +138,142 @@ return apperror.InternalError(err)
 return nil
 }
 
-func (s *merchantService) RotateKeys(ctx context.Context, merchantID uuid.UUID) (*ports.RotateKeysResponse, error) {
+// SetSynchronousWebhook switches the merchant between async and synchronous webhook delivery.
+func (s *merchantService) SetSynchronousWebhook(ctx context.Context, merchantID uuid.UUID, enabled bool) error {
+merchant, err := s.merchantRepo.GetByID(ctx, merchantID)
+if err != nil {
+return apperror.InternalError(err)
+}
+if merchant == nil {
+return apperror.ErrNotFound("merchant")
+}
+
+merchant.SynchronousWebhook = enabled
+merchant.UpdatedAt = time.Now()
+
+if err := s.merchantRepo.Update(ctx, merchant); err != nil {
+return apperror.InternalError(err)
+}
+return nil
+}
+
+// SetRequireIdempotencyKey makes payments without an Idempotency-Key header fail with PAY_002.
+func (s *merchantService) SetRequireIdempotencyKey(ctx context.Context, merchantID uuid.UUID, required bool) error {
+merchant, err := s.merchantRepo.GetByID(ctx, merchantID)
+if err != nil {
+return apperror.InternalError(err)
+}
+if merchant == nil {
+return apperror.ErrNotFound("merchant")
+}
+
+merchant.RequireIdempotencyKey = required
+merchant.UpdatedAt = time.Now()
+
+if err := s.merchantRepo.Update(ctx, merchant); err != nil {
+return apperror.InternalError(err)
+}
+return nil
+}
+
+// SetWebhookPayloadMode chooses between full and minimal (IDs and status only) webhook payloads.
+func (s *merchantService) SetWebhookPayloadMode(ctx context.Context, merchantID uuid.UUID, mode domain.WebhookPayloadMode) error {
+if !mode.IsValid() {
+return apperror.Validation(fmt.Sprintf("webhook_payload_mode must be %q or %q", domain.WebhookPayloadFull, domain.WebhookPayloadMinimal))
+}
+merchant, err := s.merchantRepo.GetByID(ctx, merchantID)
+if err != nil {
+return apperror.InternalError(err)
+}
+if merchant == nil {
+return apperror.ErrNotFound("merchant")
+}
+
+merchant.WebhookPayloadMode = mode
+merchant.UpdatedAt = time.Now()
+
+if err := s.merchantRepo.Update(ctx, merchant); err != nil {
+return apperror.InternalError(err)
+}
+return nil
+}
+
+// SetSessionExpiry overrides the merchant's dashboard token lifetime.
+// Zero removes the override.
+func (s *merchantService) SetSessionExpiry(ctx context.Context, merchantID uuid.UUID, expiry time.Duration) error {
+if expiry < 0 || (expiry > 0 && expiry < domain.MinSessionExpiry) {
+return apperror.Validation(fmt.Sprintf("session_expiry_seconds must be 0 or at least %d", int(domain.MinSessionExpiry.Seconds())))
+}
+merchant, err := s.merchantRepo.GetByID(ctx, merchantID)
+if err != nil {
+return apperror.InternalError(err)
+}
+if merchant == nil {
+return apperror.ErrNotFound("merchant")
+}
+
+merchant.SessionExpirySeconds = nil
+if expiry > 0 {
+seconds := int(expiry / time.Second)
+merchant.SessionExpirySeconds = &seconds
+}
+merchant.UpdatedAt = time.Now()
+
+if err := s.merchantRepo.Update(ctx, merchant); err != nil {
+return apperror.InternalError(err)
+}
+return nil
+}
+
+// e164Phone matches a phone number in E.164 format.
+var e164Phone = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// SetNotificationPreferences replaces the merchant's notification preferences.
+func (s *merchantService) SetNotificationPreferences(ctx context.Context, merchantID uuid.UUID, prefs domain.NotificationPreferences) error {
+for _, event := range prefs.Events {
+if !event.IsValid() {
+return apperror.Validation(fmt.Sprintf("unknown notification event %q (want %s or %s)", event, domain.NotificationKeyRotation, domain.NotificationLargeRefund))
+}
+}
+if prefs.Email != "" {
+if addr, err := mail.ParseAddress(prefs.Email); err != nil || addr.Address != prefs.Email {
+return apperror.Validation("notification email is not a valid address")
+}
+}
+if prefs.Phone != "" && !e164Phone.MatchString(prefs.Phone) {
+return apperror.Validation("notification phone must be in E.164 format, e.g. +84901234567")
+}
+
+merchant, err := s.merchantRepo.GetByID(ctx, merchantID)
+if err != nil {
+return apperror.InternalError(err)
+}
+if merchant == nil {
+return apperror.ErrNotFound("merchant")
+}
+
+merchant.NotificationPreferences = prefs
+merchant.UpdatedAt = time.Now()
+
+if err := s.merchantRepo.Update(ctx, merchant); err != nil {
+return apperror.InternalError(err)
+}
+return nil
+}
+
+func (s *merchantService) RotateKeys(ctx context.Context, merchantID uuid.UUID, idempotencyKey string) (*ports.RotateKeysResponse, error) {
+var idempKey string
+if idempotencyKey != "" && s.rotateCache != nil {
+idempKey = domain.BuildRotateKeysIdempotencyKey(merchantID, idempotencyKey)
+// Claimed before the merchant is read, so a request that waited for
+// the claim sees the keys the first one stored
+release, err := claimKey(ctx, s.rotateLock, idempKey)
+if err != nil {
+return nil, err
+}
+defer release()
+}
+
 merchant, err := s.merchantRepo.GetByID(ctx, merchantID)
 if err != nil {
 return nil, apperror.InternalError(err)
@@ -75,6 +282,16 @@ if merchant == nil {
 return nil, apperror.ErrNotFound("merchant")
 }
 
+if idempKey != "" {
+replay, err := s.replayRotation(ctx, idempKey, merchant)
+if err != nil {
+return nil, err
+}
+if replay != nil {
+return replay, nil
+}
+}
+
 // Generate new access key and secret key
 newAccessKey, err := generateKey("ak_", 24)
 if err != nil {
@@ -91,20 +308,69 @@ if err != nil {
 return nil, apperror.InternalError(fmt.Errorf("encrypt secret key: %w", err))
 }
 
+now := time.Now()
 merchant.AccessKey = newAccessKey
 merchant.SecretKeyEnc = encSecretKey
-merchant.UpdatedAt = time.Now()
+merchant.SecretRotatedAt = &now
+merchant.UpdatedAt = now
 
 if err := s.merchantRepo.Update(ctx, merchant); err != nil {
 return nil, apperror.InternalError(err)
 }
 
+// Recorded only once the keys are in effect. The rotation has happened by
+// now, so a failure to record it must not hide the new keys.
+if idempKey != "" {
+if record, err := json.Marshal(rotationRecord{AccessKey: newAccessKey, SecretKeyEnc: encSecretKey}); err == nil {
+_ = s.rotateCache.Set(ctx, idempKey, record, rotateKeysIdempotencyTTL)
+}
+}
+
+if s.notifier != nil {
+s.notifier.Notify(ctx, merchantID, domain.NotificationKeyRotation,
+fmt.Sprintf("The API keys of %s were rotated at %s. The previous keys no longer work.", merchant.MerchantName, now.UTC().Format(time.RFC3339)))
+}
+
 return &ports.RotateKeysResponse{
 AccessKey: newAccessKey,
 SecretKey: newSecretKey,
 }, nil
 }
 
+// replayRotation returns the keys issued by an earlier rotation under
+// idempKey, or nil, nil if there was none.
+func (s *merchantService) replayRotation(ctx context.Context, idempKey string, merchant *domain.Merchant) (*ports.RotateKeysResponse, error) {
+cached, err := s.rotateCache.Get(ctx, idempKey)
+if err != nil {
+return nil, apperror.InternalError(fmt.Errorf("rotation idempotency check: %w", err))
+}
+if cached == nil {
+return nil, nil
+}
+
+var record rotationRecord
+if err := json.Unmarshal(cached, &record); err != nil {
+return nil, apperror.InternalError(fmt.Errorf("unmarshal rotation record: %w", err))
+}
+if merchant.AccessKey != record.AccessKey {
+return nil, apperror.Validation("keys from this rotation have since been rotated again")
+}
+secretKey, err := s.encSvc.Decrypt(record.SecretKeyEnc)
+if err != nil {
+return nil, apperror.InternalError(fmt.Errorf("decrypt secret key: %w", err))
+}
+return &ports.RotateKeysResponse{AccessKey: record.AccessKey, SecretKey: secretKey}, nil
+}
+
+// formatOptionalTime renders t as RFC3339, or nil if t is unset.
+func formatOptionalTime(t *time.Time) *string {
+if t == nil {
+return nil
+}
+s := t.Format(time.RFC3339)
+return &s
+}
+
 func generateKey(prefix string, length int) (string, error) {
 b := make([]byte, length)
 if _, err := rand.Read(b); err != nil {
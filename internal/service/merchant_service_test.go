@@ -3,10 +3,17 @@ package service
 import (
 "context"
 "errors"
+"strings"
+"sync"
+"sync/atomic"
 "testing"
+"time"
 
+"secure-payment-gateway/internal/adapter/storage/memory"
 "secure-payment-gateway/internal/core/domain"
+"secure-payment-gateway/internal/core/ports"
 "secure-payment-gateway/internal/core/ports/mocks"
+"secure-payment-gateway/pkg/apperror"
 
 "github.com/google/uuid"
 "github.com/stretchr/testify/assert"
@@ -40,6 +47,28 @@ assert.Equal(t, "Test Shop", profile.MerchantName)
 assert.Equal(t, &webhookURL, profile.WebhookURL)
 }
 
+func TestMerchantService_GetProfile_SecretExpiry(t *testing.T) {
+ctrl := gomock.NewController(t)
+defer ctrl.Finish()
+
+mockRepo := mocks.NewMockMerchantRepository(ctrl)
+mockEnc := mocks.NewMockEncryptionService(ctrl)
+svc := NewMerchantService(mockRepo, mockEnc, WithSecretMaxAge(90*24*time.Hour))
+
+merchantID := uuid.New()
+rotatedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+mockRepo.EXPECT().GetByID(gomock.Any(), merchantID).Return(&domain.Merchant{
+ID:              merchantID,
+Status:          domain.MerchantStatusActive,
+SecretRotatedAt: &rotatedAt,
+}, nil)
+
+profile, err := svc.GetProfile(context.Background(), merchantID)
+require.NoError(t, err)
+require.NotNil(t, profile.SecretExpiresAt)
+assert.Equal(t, "2026-04-01T00:00:00Z", *profile.SecretExpiresAt)
+}
+
 func TestMerchantService_GetProfile_NotFound(t *testing.T) {
 ctrl := gomock.NewController(t)
 defer ctrl.Finish()
@@ -73,6 +102,126 @@ err := svc.UpdateWebhookURL(context.Background(), merchantID, &newURL)
 assert.NoError(t, err)
 }
 
+func TestMerchantService_SetSynchronousWebhook(t *testing.T) {
+ctrl := gomock.NewController(t)
+defer ctrl.Finish()
+
+mockRepo := mocks.NewMockMerchantRepository(ctrl)
+svc := NewMerchantService(mockRepo, mocks.NewMockEncryptionService(ctrl))
+
+merchantID := uuid.New()
+mockRepo.EXPECT().GetByID(gomock.Any(), merchantID).Return(&domain.Merchant{ID: merchantID}, nil)
+mockRepo.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, m *domain.Merchant) error {
+assert.True(t, m.SynchronousWebhook)
+return nil
+})
+
+err := svc.SetSynchronousWebhook(context.Background(), merchantID, true)
+assert.NoError(t, err)
+}
+
+func TestMerchantService_SetRequireIdempotencyKey(t *testing.T) {
+ctrl := gomock.NewController(t)
+defer ctrl.Finish()
+
+mockRepo := mocks.NewMockMerchantRepository(ctrl)
+svc := NewMerchantService(mockRepo, mocks.NewMockEncryptionService(ctrl))
+
+merchantID := uuid.New()
+mockRepo.EXPECT().GetByID(gomock.Any(), merchantID).Return(&domain.Merchant{ID: merchantID}, nil)
+mockRepo.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, m *domain.Merchant) error {
+assert.True(t, m.RequireIdempotencyKey)
+return nil
+})
+
+err := svc.SetRequireIdempotencyKey(context.Background(), merchantID, true)
+assert.NoError(t, err)
+}
+
+func TestMerchantService_SetWebhookPayloadMode(t *testing.T) {
+ctrl := gomock.NewController(t)
+defer ctrl.Finish()
+
+mockRepo := mocks.NewMockMerchantRepository(ctrl)
+svc := NewMerchantService(mockRepo, mocks.NewMockEncryptionService(ctrl))
+
+merchantID := uuid.New()
+mockRepo.EXPECT().GetByID(gomock.Any(), merchantID).Return(&domain.Merchant{ID: merchantID}, nil)
+mockRepo.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, m *domain.Merchant) error {
+assert.Equal(t, domain.WebhookPayloadMinimal, m.WebhookPayloadMode)
+return nil
+})
+
+err := svc.SetWebhookPayloadMode(context.Background(), merchantID, domain.WebhookPayloadMinimal)
+assert.NoError(t, err)
+}
+
+func TestMerchantService_SetWebhookPayloadMode_Invalid(t *testing.T) {
+ctrl := gomock.NewController(t)
+defer ctrl.Finish()
+
+// No repository calls are expected for an invalid mode
+mockRepo := mocks.NewMockMerchantRepository(ctrl)
+svc := NewMerchantService(mockRepo, mocks.NewMockEncryptionService(ctrl))
+
+err := svc.SetWebhookPayloadMode(context.Background(), uuid.New(), domain.WebhookPayloadMode("verbose"))
+var appErr *apperror.AppError
+require.True(t, errors.As(err, &appErr))
+assert.Equal(t, "PAY_002", appErr.Code)
+}
+
+func TestMerchantService_SetSessionExpiry(t *testing.T) {
+ctrl := gomock.NewController(t)
+defer ctrl.Finish()
+
+mockRepo := mocks.NewMockMerchantRepository(ctrl)
+svc := NewMerchantService(mockRepo, mocks.NewMockEncryptionService(ctrl))
+
+merchantID := uuid.New()
+mockRepo.EXPECT().GetByID(gomock.Any(), merchantID).Return(&domain.Merchant{ID: merchantID}, nil)
+mockRepo.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, m *domain.Merchant) error {
+require.NotNil(t, m.SessionExpirySeconds)
+assert.Equal(t, 900, *m.SessionExpirySeconds)
+return nil
+})
+
+err := svc.SetSessionExpiry(context.Background(), merchantID, 15*time.Minute)
+assert.NoError(t, err)
+}
+
+func TestMerchantService_SetSessionExpiry_ZeroClearsOverride(t *testing.T) {
+ctrl := gomock.NewController(t)
+defer ctrl.Finish()
+
+mockRepo := mocks.NewMockMerchantRepository(ctrl)
+svc := NewMerchantService(mockRepo, mocks.NewMockEncryptionService(ctrl))
+
+merchantID := uuid.New()
+seconds := 900
+mockRepo.EXPECT().GetByID(gomock.Any(), merchantID).Return(&domain.Merchant{ID: merchantID, SessionExpirySeconds: &seconds}, nil)
+mockRepo.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, m *domain.Merchant) error {
+assert.Nil(t, m.SessionExpirySeconds)
+return nil
+})
+
+err := svc.SetSessionExpiry(context.Background(), merchantID, 0)
+assert.NoError(t, err)
+}
+
+func TestMerchantService_SetSessionExpiry_TooShort(t *testing.T) {
+ctrl := gomock.NewController(t)
+defer ctrl.Finish()
+
+// No repository calls are expected for an invalid expiry
+mockRepo := mocks.NewMockMerchantRepository(ctrl)
+svc := NewMerchantService(mockRepo, mocks.NewMockEncryptionService(ctrl))
+
+err := svc.SetSessionExpiry(context.Background(), uuid.New(), 30*time.Second)
+var appErr *apperror.AppError
+require.True(t, errors.As(err, &appErr))
+assert.Equal(t, "PAY_002", appErr.Code)
+}
+
 func TestMerchantService_RotateKeys_Success(t *testing.T) {
 ctrl := gomock.NewController(t)
 defer ctrl.Finish()
@@ -86,16 +235,195 @@ mockRepo.EXPECT().GetByID(gomock.Any(), merchantID).Return(&domain.Merchant{
 ID: merchantID,
 }, nil)
 mockEnc.EXPECT().Encrypt(gomock.Any()).Return("encrypted-new-secret", nil)
-mockRepo.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil)
+var updated *domain.Merchant
+mockRepo.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, m *domain.Merchant) error {
+updated = m
+return nil
+})
 
-result, err := svc.RotateKeys(context.Background(), merchantID)
+result, err := svc.RotateKeys(context.Background(), merchantID, "")
 require.NoError(t, err)
+require.NotNil(t, updated.SecretRotatedAt)
 assert.Contains(t, result.AccessKey, "ak_")
 assert.Contains(t, result.SecretKey, "sk_")
 assert.True(t, len(result.AccessKey) > 10)
 assert.True(t, len(result.SecretKey) > 10)
 }
 
+// newIdempotentRotation returns a merchant service rotating the keys of a
+// merchant held in memory, with Idempotency-Key support.
+func newIdempotentRotation(t *testing.T) (svc ports.MerchantManagementService, merchant *domain.Merchant) {
+ctrl := gomock.NewController(t)
+mockRepo := mocks.NewMockMerchantRepository(ctrl)
+mockEnc := mocks.NewMockEncryptionService(ctrl)
+svc = NewMerchantService(mockRepo, mockEnc, WithRotateKeysIdempotency(memory.NewIdempotencyCache(0), memory.NewInFlightLock()))
+
+merchant = &domain.Merchant{ID: uuid.New(), AccessKey: "ak_original"}
+mockRepo.EXPECT().GetByID(gomock.Any(), merchant.ID).DoAndReturn(func(context.Context, uuid.UUID) (*domain.Merchant, error) {
+copied := *merchant
+return &copied, nil
+}).AnyTimes()
+mockRepo.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, m *domain.Merchant) error {
+*merchant = *m
+return nil
+}).AnyTimes()
+mockEnc.EXPECT().Encrypt(gomock.Any()).DoAndReturn(func(s string) (string, error) { return "enc:" + s, nil }).AnyTimes()
+mockEnc.EXPECT().Decrypt(gomock.Any()).DoAndReturn(func(s string) (string, error) { return strings.TrimPrefix(s, "enc:"), nil }).AnyTimes()
+return svc, merchant
+}
+
+func TestMerchantService_RotateKeys_RetryReturnsSameKeys(t *testing.T) {
+svc, merchant := newIdempotentRotation(t)
+ctx := context.Background()
+
+first, err := svc.RotateKeys(ctx, merchant.ID, "rotate-1")
+require.NoError(t, err)
+retry, err := svc.RotateKeys(ctx, merchant.ID, "rotate-1")
+require.NoError(t, err)
+
+assert.Equal(t, first, retry)
+assert.Equal(t, first.AccessKey, merchant.AccessKey, "the retry did not rotate again")
+}
+
+func TestMerchantService_RotateKeys_ConcurrentDuplicatesRotateOnce(t *testing.T) {
+ctrl := gomock.NewController(t)
+mockRepo := mocks.NewMockMerchantRepository(ctrl)
+mockEnc := mocks.NewMockEncryptionService(ctrl)
+svc := NewMerchantService(mockRepo, mockEnc, WithRotateKeysIdempotency(memory.NewIdempotencyCache(0), memory.NewInFlightLock()))
+
+var mu sync.Mutex
+merchantID := uuid.New()
+merchant := domain.Merchant{ID: merchantID, AccessKey: "ak_original"}
+mockRepo.EXPECT().GetByID(gomock.Any(), merchantID).DoAndReturn(func(context.Context, uuid.UUID) (*domain.Merchant, error) {
+mu.Lock()
+defer mu.Unlock()
+copied := merchant
+return &copied, nil
+}).AnyTimes()
+var updates atomic.Int32
+mockRepo.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, m *domain.Merchant) error {
+updates.Add(1)
+time.Sleep(20 * time.Millisecond) // keep the first rotation in flight
+mu.Lock()
+defer mu.Unlock()
+merchant = *m
+return nil
+}).AnyTimes()
+mockEnc.EXPECT().Encrypt(gomock.Any()).DoAndReturn(func(s string) (string, error) { return "enc:" + s, nil }).AnyTimes()
+mockEnc.EXPECT().Decrypt(gomock.Any()).DoAndReturn(func(s string) (string, error) { return strings.TrimPrefix(s, "enc:"), nil }).AnyTimes()
+
+// A double-click: both requests carry the same Idempotency-Key
+const clicks = 5
+results := make([]*ports.RotateKeysResponse, clicks)
+errs := make([]error, clicks)
+var wg sync.WaitGroup
+for i := range clicks {
+wg.Add(1)
+go func() {
+defer wg.Done()
+results[i], errs[i] = svc.RotateKeys(context.Background(), merchantID, "rotate-1")
+}()
+}
+wg.Wait()
+
+assert.Equal(t, int32(1), updates.Load(), "the keys were rotated once")
+for i := range clicks {
+if errs[i] != nil {
+var appErr *apperror.AppError
+require.True(t, errors.As(errs[i], &appErr))
+assert.Equal(t, "PAY_003", appErr.Code)
+continue
+}
+// Every success hands out the keys now in effect
+assert.Equal(t, merchant.AccessKey, results[i].AccessKey)
+}
+}
+
+func TestMerchantService_RotateKeys_FreshRotationDiffers(t *testing.T) {
+svc, merchant := newIdempotentRotation(t)
+ctx := context.Background()
+
+first, err := svc.RotateKeys(ctx, merchant.ID, "rotate-1")
+require.NoError(t, err)
+second, err := svc.RotateKeys(ctx, merchant.ID, "rotate-2")
+require.NoError(t, err)
+unkeyed, err := svc.RotateKeys(ctx, merchant.ID, "")
+require.NoError(t, err)
+
+assert.NotEqual(t, first.AccessKey, second.AccessKey)
+assert.NotEqual(t, first.SecretKey, second.SecretKey)
+assert.NotEqual(t, second.AccessKey, unkeyed.AccessKey)
+assert.Equal(t, unkeyed.AccessKey, merchant.AccessKey)
+
+// The keys of the first rotation no longer work, so they are not replayed
+_, err = svc.RotateKeys(ctx, merchant.ID, "rotate-1")
+var appErr *apperror.AppError
+require.True(t, errors.As(err, &appErr))
+assert.Equal(t, "PAY_002", appErr.Code)
+}
+
+func TestMerchantService_RotateKeys_Notifies(t *testing.T) {
+ctrl := gomock.NewController(t)
+defer ctrl.Finish()
+
+mockRepo := mocks.NewMockMerchantRepository(ctrl)
+mockEnc := mocks.NewMockEncryptionService(ctrl)
+mockNotifier := mocks.NewMockNotificationService(ctrl)
+svc := NewMerchantService(mockRepo, mockEnc, WithMerchantNotifications(mockNotifier))
+
+merchantID := uuid.New()
+mockRepo.EXPECT().GetByID(gomock.Any(), merchantID).Return(&domain.Merchant{ID: merchantID, MerchantName: "Shop"}, nil)
+mockEnc.EXPECT().Encrypt(gomock.Any()).Return("encrypted-new-secret", nil)
+mockRepo.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil)
+mockNotifier.EXPECT().Notify(gomock.Any(), merchantID, domain.NotificationKeyRotation, gomock.Any()).
+Do(func(_ context.Context, _ uuid.UUID, _ domain.NotificationEvent, message string) {
+assert.Contains(t, message, "Shop")
+})
+
+_, err := svc.RotateKeys(context.Background(), merchantID, "")
+require.NoError(t, err)
+}
+
+func TestMerchantService_SetNotificationPreferences(t *testing.T) {
+ctrl := gomock.NewController(t)
+defer ctrl.Finish()
+
+mockRepo := mocks.NewMockMerchantRepository(ctrl)
+svc := NewMerchantService(mockRepo, mocks.NewMockEncryptionService(ctrl))
+
+merchantID := uuid.New()
+prefs := domain.NotificationPreferences{Events: []domain.NotificationEvent{domain.NotificationKeyRotation}, Email: "ops@shop.example", Phone: "+84901234567"}
+mockRepo.EXPECT().GetByID(gomock.Any(), merchantID).Return(&domain.Merchant{ID: merchantID}, nil)
+var updated *domain.Merchant
+mockRepo.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, m *domain.Merchant) error {
+updated = m
+return nil
+})
+
+require.NoError(t, svc.SetNotificationPreferences(context.Background(), merchantID, prefs))
+assert.Equal(t, prefs, updated.NotificationPreferences)
+}
+
+func TestMerchantService_SetNotificationPreferences_Invalid(t *testing.T) {
+ctrl := gomock.NewController(t)
+defer ctrl.Finish()
+
+svc := NewMerchantService(mocks.NewMockMerchantRepository(ctrl), mocks.NewMockEncryptionService(ctrl))
+
+for name, prefs := range map[string]domain.NotificationPreferences{
+"unknown event": {Events: []domain.NotificationEvent{"suspension"}},
+"bad email":     {Email: "Ops <ops@shop.example>"},
+"bad phone":     {Phone: "0901234567"},
+} {
+t.Run(name, func(t *testing.T) {
+err := svc.SetNotificationPreferences(context.Background(), uuid.New(), prefs)
+var appErr *apperror.AppError
+require.True(t, errors.As(err, &appErr))
+assert.Equal(t, "PAY_002", appErr.Code)
+})
+}
+}
+
 func TestMerchantService_RotateKeys_EncryptError(t *testing.T) {
 ctrl := gomock.NewController(t)
 defer ctrl.Finish()
@@ -110,6 +438,6 @@ ID: merchantID,
 }, nil)
 mockEnc.EXPECT().Encrypt(gomock.Any()).Return("", errors.New("encrypt failed"))
 
-_, err := svc.RotateKeys(context.Background(), merchantID)
+_, err := svc.RotateKeys(context.Background(), merchantID, "")
 assert.Error(t, err)
 }
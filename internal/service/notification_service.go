@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"secure-payment-gateway/internal/core/domain"
+	"secure-payment-gateway/internal/core/ports"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// NopNotifier discards notifications. It stands in for every channel no
+// provider is configured for.
+type NopNotifier struct{}
+
+// Send does nothing.
+func (NopNotifier) Send(context.Context, domain.Notification) error { return nil }
+
+// LogNotifier logs each notification without its recipient address. It
+// stands in for a provider while none is integrated.
+type LogNotifier struct {
+	log zerolog.Logger
+}
+
+// NewLogNotifier creates a LogNotifier writing to log.
+func NewLogNotifier(log zerolog.Logger) *LogNotifier {
+	return &LogNotifier{log: log}
+}
+
+// Send logs n.
+func (l *LogNotifier) Send(_ context.Context, n domain.Notification) error {
+	l.log.Info().
+		Str("merchant_id", n.MerchantID.String()).
+		Str("event", string(n.Event)).
+		Str("channel", string(n.Channel)).
+		Str("message", n.Message).
+		Msg("notification")
+	return nil
+}
+
+type notificationService struct {
+	merchantRepo ports.MerchantRepository
+	channels     map[domain.NotificationChannel]ports.Notifier
+	log          zerolog.Logger
+	now          func() time.Time
+}
+
+// NotificationOption configures optional notificationService behaviour.
+type NotificationOption func(*notificationService)
+
+// WithNotifier delivers notifications for channel through n.
+func WithNotifier(channel domain.NotificationChannel, n ports.Notifier) NotificationOption {
+	return func(s *notificationService) {
+		s.channels[channel] = n
+	}
+}
+
+// NewNotificationService creates a notification service. Channels without a
+// WithNotifier provider use NopNotifier, so preferences can be saved before
+// a provider is set up.
+func NewNotificationService(merchantRepo ports.MerchantRepository, log zerolog.Logger, opts ...NotificationOption) ports.NotificationService {
+	s := &notificationService{
+		merchantRepo: merchantRepo,
+		channels:     make(map[domain.NotificationChannel]ports.Notifier),
+		log:          log,
+		now:          time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Notify sends message to every channel the merchant set an address for, if
+// they asked to be notified of event. It returns at once; failures are only
+// logged, so a notification never fails the operation that raised it.
+func (s *notificationService) Notify(ctx context.Context, merchantID uuid.UUID, event domain.NotificationEvent, message string) {
+	occurredAt := s.now().UTC()
+	go func() {
+		ctx := context.WithoutCancel(ctx)
+		merchant, err := s.merchantRepo.GetByID(ctx, merchantID)
+		if err != nil || merchant == nil {
+			s.log.Warn().Err(err).Str("merchant_id", merchantID.String()).Str("event", string(event)).Msg("notification skipped: merchant not loaded")
+			return
+		}
+		prefs := merchant.NotificationPreferences
+		if !prefs.Wants(event) {
+			return
+		}
+		for channel, recipient := range prefs.Recipients() {
+			n := domain.Notification{
+				MerchantID: merchantID,
+				Event:      event,
+				Channel:    channel,
+				Recipient:  recipient,
+				Message:    message,
+				OccurredAt: occurredAt,
+			}
+			if err := s.notifier(channel).Send(ctx, n); err != nil {
+				s.log.Warn().Err(err).Str("merchant_id", merchantID.String()).Str("event", string(event)).Str("channel", string(channel)).Msg("failed to send notification")
+			}
+		}
+	}()
+}
+
+func (s *notificationService) notifier(channel domain.NotificationChannel) ports.Notifier {
+	if n, ok := s.channels[channel]; ok {
+		return n
+	}
+	return NopNotifier{}
+}
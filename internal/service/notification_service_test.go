@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"secure-payment-gateway/internal/core/domain"
+	"secure-payment-gateway/internal/core/ports/mocks"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+// recordingNotifier passes each notification sent to it on to a channel.
+type recordingNotifier struct {
+	sent chan domain.Notification
+	err  error
+}
+
+func (r *recordingNotifier) Send(_ context.Context, n domain.Notification) error {
+	r.sent <- n
+	return r.err
+}
+
+func TestNotificationService_SendsKeyRotationWhenEnabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepo := mocks.NewMockMerchantRepository(ctrl)
+	email := &recordingNotifier{sent: make(chan domain.Notification, 1)}
+	svc := NewNotificationService(mockRepo, zerolog.Nop(), WithNotifier(domain.NotificationChannelEmail, email))
+
+	merchantID := uuid.New()
+	mockRepo.EXPECT().GetByID(gomock.Any(), merchantID).Return(&domain.Merchant{
+		ID: merchantID,
+		NotificationPreferences: domain.NotificationPreferences{
+			Events: []domain.NotificationEvent{domain.NotificationKeyRotation},
+			Email:  "ops@shop.example",
+			Phone:  "+84901234567", // no SMS provider: the default no-op takes it
+		},
+	}, nil)
+
+	svc.Notify(context.Background(), merchantID, domain.NotificationKeyRotation, "keys rotated")
+
+	select {
+	case n := <-email.sent:
+		assert.Equal(t, merchantID, n.MerchantID)
+		assert.Equal(t, domain.NotificationKeyRotation, n.Event)
+		assert.Equal(t, domain.NotificationChannelEmail, n.Channel)
+		assert.Equal(t, "ops@shop.example", n.Recipient)
+		assert.Equal(t, "keys rotated", n.Message)
+	case <-time.After(time.Second):
+		t.Fatal("no notification sent")
+	}
+}
+
+func TestNotificationService_SkipsEventsNotOptedInto(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepo := mocks.NewMockMerchantRepository(ctrl)
+	email := &recordingNotifier{sent: make(chan domain.Notification, 1)}
+	svc := NewNotificationService(mockRepo, zerolog.Nop(), WithNotifier(domain.NotificationChannelEmail, email))
+
+	merchantID := uuid.New()
+	loaded := make(chan struct{})
+	mockRepo.EXPECT().GetByID(gomock.Any(), merchantID).DoAndReturn(func(context.Context, uuid.UUID) (*domain.Merchant, error) {
+		defer close(loaded)
+		return &domain.Merchant{
+			ID: merchantID,
+			NotificationPreferences: domain.NotificationPreferences{
+				Events: []domain.NotificationEvent{domain.NotificationLargeRefund},
+				Email:  "ops@shop.example",
+			},
+		}, nil
+	})
+
+	svc.Notify(context.Background(), merchantID, domain.NotificationKeyRotation, "keys rotated")
+	<-loaded
+	select {
+	case n := <-email.sent:
+		t.Fatalf("unexpected notification %+v", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestNotificationService_SendFailureIsNotFatal(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepo := mocks.NewMockMerchantRepository(ctrl)
+	sms := &recordingNotifier{sent: make(chan domain.Notification, 1), err: errors.New("provider down")}
+	svc := NewNotificationService(mockRepo, zerolog.Nop(), WithNotifier(domain.NotificationChannelSMS, sms))
+
+	merchantID := uuid.New()
+	mockRepo.EXPECT().GetByID(gomock.Any(), merchantID).Return(&domain.Merchant{
+		ID: merchantID,
+		NotificationPreferences: domain.NotificationPreferences{
+			Events: []domain.NotificationEvent{domain.NotificationLargeRefund},
+			Phone:  "+84901234567",
+		},
+	}, nil)
+
+	svc.Notify(context.Background(), merchantID, domain.NotificationLargeRefund, "large refund")
+	select {
+	case n := <-sms.sent:
+		require.Equal(t, "+84901234567", n.Recipient)
+	case <-time.After(time.Second):
+		t.Fatal("no notification sent")
+	}
+}
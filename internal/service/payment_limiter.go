@@ -0,0 +1,44 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// merchantLimiter caps the number of in-flight operations per merchant. It
+// is per process: with N instances a merchant may have up to N*limit
+// operations in flight.
+type merchantLimiter struct {
+	limit int
+
+	mu       sync.Mutex
+	inFlight map[uuid.UUID]int
+}
+
+func newMerchantLimiter(limit int) *merchantLimiter {
+	return &merchantLimiter{limit: limit, inFlight: make(map[uuid.UUID]int)}
+}
+
+// acquire takes a slot for the merchant. It reports false, without waiting,
+// when the merchant is already at the limit. Every successful acquire must be
+// paired with a release.
+func (l *merchantLimiter) acquire(merchantID uuid.UUID) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight[merchantID] >= l.limit {
+		return false
+	}
+	l.inFlight[merchantID]++
+	return true
+}
+
+func (l *merchantLimiter) release(merchantID uuid.UUID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight[merchantID] <= 1 {
+		delete(l.inFlight, merchantID)
+		return
+	}
+	l.inFlight[merchantID]--
+}
@@ -3,20 +3,32 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"secure-payment-gateway/internal/core/domain"
 	"secure-payment-gateway/internal/core/ports"
 	"secure-payment-gateway/pkg/apperror"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/rs/zerolog"
+	"github.com/shopspring/decimal"
 )
 
 const idempotencyTTL = 24 * time.Hour
 
+// topupReferencePrefix is prepended to a caller's topup reference_id in the
+// stored transaction, keeping topups apart from payments with the same one.
+const topupReferencePrefix = "TOPUP-"
+
+// maxTopupReferenceIDLength leaves room for topupReferencePrefix within
+// transactions.reference_id.
+const maxTopupReferenceIDLength = domain.MaxReferenceIDLength - len(topupReferencePrefix)
+
 // PaymentServiceImpl implements ports.PaymentService.
 type PaymentServiceImpl struct {
 	txRepo     ports.TransactionRepository
@@ -26,6 +38,184 @@ type PaymentServiceImpl struct {
 	encSvc     ports.EncryptionService
 	transactor ports.DBTransactor
 	log        zerolog.Logger
+
+	topupLimits TopupLimits
+
+	replayRefetch bool // re-read replayed transactions from the repository
+
+	autoCreateWallets bool // topups create a missing wallet instead of PAY_004
+
+	refundToCurrencyWallet bool // refunds of a missing wallet credit the merchant's wallet in the payment's currency instead of PAY_004
+
+	maxExtraDataBytes int // stored ExtraData cap; see domain.DefaultMaxExtraDataBytes
+
+	topupIncrements map[string]int64 // currency -> required multiple of minor units
+
+	paymentLimiter *merchantLimiter // nil = no per-merchant concurrency cap
+
+	dailyTransactionLimit *int64 // payments per merchant per UTC day; nil = unlimited
+
+	maxRefundsPerTx int // refunds against one transaction; 0 = unlimited
+
+	rejectReferenceCollisions bool // payments/topups may not reuse another type's reference
+
+	referenceDayLoc *time.Location   // non-nil = references are unique per day in this location
+	now             func() time.Time // clock for the day of daily-scoped references
+
+	inFlight *inFlightGuard // nil = concurrent duplicates race to the database
+
+	auditSvc ports.AuditService // nil = payments are audited by the HTTP middleware only
+
+	notifier             ports.NotificationService // nil = no refund notifications
+	largeRefundThreshold int64                     // refunds of at least this amount notify the merchant
+}
+
+// TopupLimits bounds wallet topups. A nil field means unlimited.
+type TopupLimits struct {
+	Min      *int64 // Smallest amount accepted per topup
+	Max      *int64 // Largest amount accepted per topup
+	DailyCap *int64 // Total topups per wallet per UTC day
+}
+
+// PaymentOption configures optional PaymentServiceImpl behaviour.
+type PaymentOption func(*PaymentServiceImpl)
+
+// WithTopupLimits enforces per-topup and daily topup limits.
+func WithTopupLimits(limits TopupLimits) PaymentOption {
+	return func(s *PaymentServiceImpl) {
+		s.topupLimits = limits
+	}
+}
+
+// WithReplayRefetch makes idempotent replays re-read the transaction by ID
+// instead of returning the cached response as stored, so a replay reflects
+// later changes such as a reversal. It costs one extra query per replay.
+func WithReplayRefetch(enabled bool) PaymentOption {
+	return func(s *PaymentServiceImpl) {
+		s.replayRefetch = enabled
+	}
+}
+
+// WithAutoCreateWallets sets whether a topup in a currency the merchant has
+// no wallet for creates that wallet, with a zero starting balance, in the
+// same database transaction. It is on by default, since a topup is how a
+// merchant funds a new currency; when off, such topups fail with PAY_004.
+func WithAutoCreateWallets(enabled bool) PaymentOption {
+	return func(s *PaymentServiceImpl) {
+		s.autoCreateWallets = enabled
+	}
+}
+
+// WithRefundToCurrencyWallet sets what a refund does when the payment's
+// wallet no longer exists. By default it fails with PAY_004 naming that
+// wallet. When enabled, it credits the merchant's wallet in the payment's
+// currency instead, creating it with a zero balance in the same database
+// transaction if needed, so the refund is never converted.
+func WithRefundToCurrencyWallet(enabled bool) PaymentOption {
+	return func(s *PaymentServiceImpl) {
+		s.refundToCurrencyWallet = enabled
+	}
+}
+
+// WithMaxExtraDataBytes caps the ExtraData stored per transaction (payment
+// metadata or refund reason), in bytes. n <= 0 keeps
+// domain.DefaultMaxExtraDataBytes.
+func WithMaxExtraDataBytes(n int) PaymentOption {
+	return func(s *PaymentServiceImpl) {
+		if n > 0 {
+			s.maxExtraDataBytes = n
+		}
+	}
+}
+
+// WithTopupIncrements requires topup amounts in a currency to be a multiple
+// of its increment, in minor units: e.g. {"VND": 1000} for the smallest note,
+// or {"CHF": 5} for 0.05 rounding. Currency codes are case-insensitive;
+// unlisted currencies, and increments below 2, accept any amount.
+func WithTopupIncrements(increments map[string]int64) PaymentOption {
+	return func(s *PaymentServiceImpl) {
+		s.topupIncrements = make(map[string]int64, len(increments))
+		for currency, inc := range increments {
+			if inc > 1 {
+				s.topupIncrements[strings.ToUpper(currency)] = inc
+			}
+		}
+	}
+}
+
+// WithMaxConcurrentPayments caps how many payments one merchant can have in
+// flight on this instance; payments beyond the cap fail fast with SYS_002
+// instead of queueing on the wallet lock. n <= 0 means unlimited.
+func WithMaxConcurrentPayments(n int) PaymentOption {
+	return func(s *PaymentServiceImpl) {
+		s.paymentLimiter = nil
+		if n > 0 {
+			s.paymentLimiter = newMerchantLimiter(n)
+		}
+	}
+}
+
+// WithDailyTransactionLimit caps how many payments a merchant can make per
+// UTC day; the payment that would exceed it fails with PAY_005. nil means
+// unlimited.
+func WithDailyTransactionLimit(limit *int64) PaymentOption {
+	return func(s *PaymentServiceImpl) {
+		s.dailyTransactionLimit = limit
+	}
+}
+
+// WithMaxRefundsPerTransaction caps how many refunds can be made against one
+// transaction, failed ones aside; the refund beyond it fails with PAY_006.
+// 0 means unlimited.
+func WithMaxRefundsPerTransaction(n int) PaymentOption {
+	return func(s *PaymentServiceImpl) {
+		s.maxRefundsPerTx = n
+	}
+}
+
+// WithRejectReferenceCollisions fails payments and topups with PAY_008 when
+// their reference_id is already used by a transaction of another type. Such
+// collisions are allowed by default, since idempotency is scoped per type,
+// but make later refunds by reference ambiguous. Costs a lookup per request.
+func WithRejectReferenceCollisions(enabled bool) PaymentOption {
+	return func(s *PaymentServiceImpl) {
+		s.rejectReferenceCollisions = enabled
+	}
+}
+
+// WithDailyReferences makes a reference_id unique per calendar day in loc
+// instead of for good (domain.ReferenceScopeDaily): payment and topup
+// idempotency keys include the day, so reusing a reference on a later day
+// creates a new transaction. Refunds and reversals are keyed by the day of
+// the payment they target, and a refund by reference targets the latest
+// payment with it; earlier payments with the reference cannot be refunded.
+// A nil loc keeps references globally unique.
+func WithDailyReferences(loc *time.Location) PaymentOption {
+	return func(s *PaymentServiceImpl) {
+		s.referenceDayLoc = loc
+	}
+}
+
+// WithPaymentAudit audits each committed payment from the service, with the
+// transaction ID as resource. Within an HTTP request this entry takes the
+// place of the AuditLog middleware's, since a request is audited once.
+func WithPaymentAudit(auditSvc ports.AuditService) PaymentOption {
+	return func(s *PaymentServiceImpl) {
+		s.auditSvc = auditSvc
+	}
+}
+
+// WithLargeRefundNotifications notifies the merchant of each refund of at
+// least threshold, in the refund currency's minor units, per their
+// notification preferences. A threshold <= 0 disables it.
+func WithLargeRefundNotifications(notifier ports.NotificationService, threshold int64) PaymentOption {
+	return func(s *PaymentServiceImpl) {
+		s.notifier = nil
+		if threshold > 0 {
+			s.notifier = notifier
+			s.largeRefundThreshold = threshold
+		}
+	}
 }
 
 // NewPaymentService creates a new PaymentServiceImpl.
@@ -37,8 +227,9 @@ func NewPaymentService(
 	encSvc ports.EncryptionService,
 	transactor ports.DBTransactor,
 	log zerolog.Logger,
+	opts ...PaymentOption,
 ) *PaymentServiceImpl {
-	return &PaymentServiceImpl{
+	s := &PaymentServiceImpl{
 		txRepo:     txRepo,
 		walletRepo: walletRepo,
 		idempRepo:  idempRepo,
@@ -46,16 +237,48 @@ func NewPaymentService(
 		encSvc:     encSvc,
 		transactor: transactor,
 		log:        log,
+		now:        time.Now,
+
+		maxExtraDataBytes: domain.DefaultMaxExtraDataBytes,
+		autoCreateWallets: true,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 // ProcessPayment implements the Payment algorithm with pessimistic locking.
 func (s *PaymentServiceImpl) ProcessPayment(ctx context.Context, req ports.PaymentRequest) (*domain.Transaction, error) {
-	if req.Amount <= 0 {
+	amount := requestAmount(req.Amount, req.AmountDecimal)
+	if amount.Sign() <= 0 {
 		return nil, apperror.ErrInvalidAmount()
 	}
+	if err := checkReferenceID("reference_id", req.ReferenceID); err != nil {
+		return nil, err
+	}
+	if req.ExtraData != nil {
+		if err := s.checkExtraDataSize("extra_data", *req.ExtraData); err != nil {
+			return nil, err
+		}
+	}
+	if s.paymentLimiter != nil {
+		if !s.paymentLimiter.acquire(req.MerchantID) {
+			return nil, apperror.ErrLockTimeout(fmt.Errorf("merchant %s is at its concurrent payment limit", req.MerchantID))
+		}
+		defer s.paymentLimiter.release(req.MerchantID)
+	}
 
-	idempKey := domain.BuildIdempotencyKey(req.MerchantID, req.ReferenceID)
+	// An explicit Idempotency-Key takes precedence over the reference, and
+	// a retry under it may carry a new reference
+	idempKey := domain.BuildIdempotencyKey(req.MerchantID, s.keyReference(req.ReferenceID, s.now()))
+	hashReference := req.ReferenceID
+	if req.IdempotencyKey != "" {
+		idempKey = domain.BuildPaymentIdempotencyKey(req.MerchantID, req.IdempotencyKey)
+		hashReference = ""
+	}
+	// A replay must come from the same payment, not one reusing its key
+	requestHash := domain.PaymentRequestHash(req.MerchantID, amount, req.Currency, hashReference)
 
 	// Layer 1: Redis idempotency check
 	cached, err := s.idempCache.Get(ctx, idempKey)
@@ -63,7 +286,10 @@ func (s *PaymentServiceImpl) ProcessPayment(ctx context.Context, req ports.Payme
 		s.log.Warn().Err(err).Str("key", idempKey).Msg("redis idempotency check failed, falling through to DB")
 	}
 	if cached != nil {
-		return s.unmarshalCachedTransaction(cached)
+		if err := s.checkPaymentReplay(ctx, idempKey, requestHash); err != nil {
+			return nil, err
+		}
+		return s.replayTransaction(ctx, cached)
 	}
 
 	// Layer 2: DB idempotency check
@@ -72,7 +298,26 @@ func (s *PaymentServiceImpl) ProcessPayment(ctx context.Context, req ports.Payme
 		return nil, apperror.InternalError(fmt.Errorf("db idempotency check: %w", err))
 	}
 	if idempLog != nil {
-		return s.unmarshalCachedTransaction(idempLog.ResponseJSON)
+		if err := matchRequestHash(idempLog.RequestHash, requestHash); err != nil {
+			return nil, err
+		}
+		return s.replayTransaction(ctx, idempLog.ResponseJSON)
+	}
+
+	release, replay, err := s.claimInFlight(ctx, idempKey)
+	if err != nil {
+		return nil, err
+	}
+	if replay != nil {
+		if err := s.checkPaymentReplay(ctx, idempKey, requestHash); err != nil {
+			return nil, err
+		}
+		return s.replayTransaction(ctx, replay)
+	}
+	defer release()
+
+	if err := s.checkReferenceCollision(ctx, req.MerchantID, req.ReferenceID, domain.TransactionTypePayment); err != nil {
+		return nil, err
 	}
 
 	// Begin database transaction
@@ -80,7 +325,19 @@ func (s *PaymentServiceImpl) ProcessPayment(ctx context.Context, req ports.Payme
 	if err != nil {
 		return nil, apperror.InternalError(fmt.Errorf("begin tx: %w", err))
 	}
-	defer dbTx.Rollback(ctx) //nolint:errcheck
+	defer dbTx.Rollback(context.WithoutCancel(ctx)) //nolint:errcheck
+
+	// Business rule: daily payment count. The count locks the merchant
+	// until commit, across currencies, and is taken before the wallet lock.
+	if limit := s.dailyTransactionLimit; limit != nil {
+		count, err := s.txRepo.CountTodayForUpdate(ctx, dbTx, req.MerchantID)
+		if err != nil {
+			return nil, apperror.InternalError(fmt.Errorf("count daily payments: %w", err))
+		}
+		if count >= *limit {
+			return nil, apperror.ErrTransactionLimitExceeded()
+		}
+	}
 
 	// Lock & get wallet
 	wallet, err := s.walletRepo.GetByMerchantIDForUpdate(ctx, dbTx, req.MerchantID, req.Currency)
@@ -90,50 +347,51 @@ func (s *PaymentServiceImpl) ProcessPayment(ctx context.Context, req ports.Payme
 	if wallet == nil {
 		return nil, apperror.ErrNotFound("wallet")
 	}
+	if err := checkAmountPrecision(wallet, amount); err != nil {
+		return nil, err
+	}
 
 	// Decrypt balance
-	balanceStr, err := s.encSvc.Decrypt(wallet.EncryptedBalance)
-	if err != nil {
-		return nil, apperror.ErrEncryptionFailure(fmt.Errorf("decrypt balance: %w", err))
-	}
-	currentBalance, err := strconv.ParseInt(balanceStr, 10, 64)
+	currentBalance, err := decryptBalance(s.encSvc, wallet, s.log)
 	if err != nil {
-		return nil, apperror.InternalError(fmt.Errorf("parse balance: %w", err))
+		return nil, err
 	}
 
 	// Business rule: sufficient funds
-	if currentBalance < req.Amount {
+	if currentBalance.LessThan(amount) {
 		return nil, apperror.ErrInsufficientFunds()
 	}
 
 	// Calculate new balance
-	newBalance := currentBalance - req.Amount
-	newBalanceEnc, err := s.encSvc.Encrypt(strconv.FormatInt(newBalance, 10))
+	newBalance := currentBalance.Sub(amount)
+	newBalanceEnc, err := encryptBalance(s.encSvc, wallet, newBalance)
 	if err != nil {
-		return nil, apperror.ErrEncryptionFailure(fmt.Errorf("encrypt new balance: %w", err))
+		return nil, err
 	}
 
 	// Encrypt amount for audit
-	amountEncrypted, err := s.encSvc.Encrypt(strconv.FormatInt(req.Amount, 10))
+	amountEncrypted, err := s.encSvc.Encrypt(amount.String())
 	if err != nil {
 		return nil, apperror.ErrEncryptionFailure(fmt.Errorf("encrypt amount: %w", err))
 	}
 
-	now := time.Now().UTC()
-	txn := &domain.Transaction{
-		ID:              uuid.New(),
+	wholeAmount, exactAmount := domain.SplitAmount(amount)
+	txn, err := domain.NewTransaction(domain.TransactionParams{
+		Type:            domain.TransactionTypePayment,
 		ReferenceID:     req.ReferenceID,
 		MerchantID:      req.MerchantID,
 		WalletID:        wallet.ID,
-		Amount:          req.Amount,
+		Amount:          wholeAmount,
+		AmountDecimal:   exactAmount,
 		AmountEncrypted: amountEncrypted,
-		TransactionType: domain.TransactionTypePayment,
-		Status:          domain.TransactionStatusSuccess,
+		Currency:        wallet.Currency,
 		Signature:       req.Signature,
 		ClientIP:        req.ClientIP,
 		ExtraData:       req.ExtraData,
-		CreatedAt:       now,
-		ProcessedAt:     &now,
+		InitiatedBy:     req.InitiatedBy,
+	})
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("build payment transaction: %w", err))
 	}
 
 	// Persist: update wallet balance
@@ -156,26 +414,43 @@ func (s *PaymentServiceImpl) ProcessPayment(ctx context.Context, req ports.Payme
 		Key:           idempKey,
 		TransactionID: txn.ID,
 		ResponseJSON:  respJSON,
-		CreatedAt:     now,
+		CreatedAt:     txn.CreatedAt,
+		RequestHash:   requestHash,
 	}
 	if err := s.idempRepo.Create(ctx, dbTx, idempLogEntry); err != nil {
 		return nil, apperror.InternalError(fmt.Errorf("save idempotency log: %w", err))
 	}
 
 	// Commit
-	if err := dbTx.Commit(ctx); err != nil {
-		return nil, apperror.InternalError(fmt.Errorf("commit tx: %w", err))
+	if err := commit(ctx, dbTx); err != nil {
+		return nil, err
 	}
 
-	// Post-process: cache in Redis (best-effort)
+	// Post-process: cache in Redis (best-effort). The hash goes first, so a
+	// replay finding the response usually finds the hash too.
+	if err := s.idempCache.Set(ctx, requestHashCacheKey(idempKey), []byte(requestHash), idempotencyTTL); err != nil {
+		s.log.Warn().Err(err).Str("key", idempKey).Msg("failed to cache request hash in redis")
+	}
 	if err := s.idempCache.Set(ctx, idempKey, respJSON, idempotencyTTL); err != nil {
 		s.log.Warn().Err(err).Str("key", idempKey).Msg("failed to cache idempotency in redis")
 	}
 
+	if s.auditSvc != nil {
+		s.auditSvc.Log(ctx, &domain.AuditLog{
+			ID:           uuid.New(),
+			MerchantID:   &txn.MerchantID,
+			Action:       domain.AuditActionPayment,
+			ResourceType: "transaction",
+			ResourceID:   txn.ID.String(),
+			IPAddress:    req.ClientIP,
+			CreatedAt:    txn.CreatedAt,
+		})
+	}
+
 	s.log.Info().
 		Str("tx_id", txn.ID.String()).
 		Str("merchant_id", req.MerchantID.String()).
-		Int64("amount", req.Amount).
+		Stringer("amount", amount).
 		Msg("payment processed successfully")
 
 	return txn, nil
@@ -183,7 +458,42 @@ func (s *PaymentServiceImpl) ProcessPayment(ctx context.Context, req ports.Payme
 
 // ProcessRefund implements the Refund algorithm.
 func (s *PaymentServiceImpl) ProcessRefund(ctx context.Context, req ports.RefundRequest) (*domain.Transaction, error) {
-	idempKey := domain.BuildRefundIdempotencyKey(req.MerchantID, req.OriginalReferenceID)
+	// The reason is stored as ExtraData; check it as stored (after sanitising)
+	if utf8.RuneCountInString(req.Reason) > domain.MaxRefundReasonLength {
+		return nil, apperror.Validation(fmt.Sprintf("reason must be at most %d characters", domain.MaxRefundReasonLength))
+	}
+	if err := s.checkExtraDataSize("reason", req.Reason); err != nil {
+		return nil, err
+	}
+	if err := checkReferenceID("original_reference_id", req.OriginalReferenceID); err != nil {
+		return nil, err
+	}
+	if req.ReferenceID != "" {
+		if err := checkReferenceID("reference_id", req.ReferenceID); err != nil {
+			return nil, err
+		}
+	}
+
+	// In daily scope the reference names one payment per day, so the key
+	// needs the day of the payment being refunded
+	var origTx *domain.Transaction
+	keyRef := req.OriginalReferenceID
+	if s.referenceDayLoc != nil {
+		var err error
+		if origTx, err = s.findRefundOriginal(ctx, req); err != nil {
+			return nil, err
+		}
+		keyRef = s.keyReference(req.OriginalReferenceID, origTx.CreatedAt)
+	}
+	// A refund naming itself is keyed apart from the payment's other
+	// refunds; one that does not is keyed by the payment alone
+	idempKey := domain.BuildRefundIdempotencyKey(req.MerchantID, keyRef)
+	switch {
+	case req.IdempotencyKey != "":
+		idempKey = domain.BuildPartialRefundIdempotencyKey(req.MerchantID, keyRef, "idempotency-key:"+req.IdempotencyKey)
+	case req.ReferenceID != "":
+		idempKey = domain.BuildPartialRefundIdempotencyKey(req.MerchantID, keyRef, req.ReferenceID)
+	}
 
 	// Layer 1: Redis idempotency check
 	cached, err := s.idempCache.Get(ctx, idempKey)
@@ -191,7 +501,7 @@ func (s *PaymentServiceImpl) ProcessRefund(ctx context.Context, req ports.Refund
 		s.log.Warn().Err(err).Str("key", idempKey).Msg("redis idempotency check failed, falling through to DB")
 	}
 	if cached != nil {
-		return s.unmarshalCachedTransaction(cached)
+		return s.replayTransaction(ctx, cached)
 	}
 
 	// Layer 2: DB idempotency check
@@ -200,97 +510,154 @@ func (s *PaymentServiceImpl) ProcessRefund(ctx context.Context, req ports.Refund
 		return nil, apperror.InternalError(fmt.Errorf("db idempotency check: %w", err))
 	}
 	if idempLog != nil {
-		return s.unmarshalCachedTransaction(idempLog.ResponseJSON)
+		return s.replayTransaction(ctx, idempLog.ResponseJSON)
 	}
 
-	// Find original transaction
-	origTx, err := s.txRepo.GetByReference(ctx, req.MerchantID, req.OriginalReferenceID)
+	release, replay, err := s.claimInFlight(ctx, idempKey)
 	if err != nil {
-		return nil, apperror.InternalError(fmt.Errorf("find original tx: %w", err))
+		return nil, err
+	}
+	if replay != nil {
+		return s.replayTransaction(ctx, replay)
 	}
+	defer release()
+
+	// Find original transaction
 	if origTx == nil {
-		return nil, apperror.ErrNotFound("original transaction")
+		if origTx, err = s.findRefundOriginal(ctx, req); err != nil {
+			return nil, err
+		}
 	}
 	if !origTx.IsRefundable() {
 		return nil, apperror.ErrInvalidRefund()
 	}
+	refundRef := domain.DerivedReference("REFUND-", req.OriginalReferenceID)
+	if req.ReferenceID != "" {
+		if err := s.checkReferenceCollision(ctx, req.MerchantID, req.ReferenceID, domain.TransactionTypeRefund); err != nil {
+			return nil, err
+		}
+		refundRef = req.ReferenceID
+	}
 
-	// Check no existing refund
-	refundExists, err := s.txRepo.CheckRefundExists(ctx, origTx.ID)
+	// Begin database transaction
+	dbTx, err := s.transactor.Begin(ctx)
 	if err != nil {
-		return nil, apperror.InternalError(fmt.Errorf("check refund exists: %w", err))
+		return nil, apperror.InternalError(fmt.Errorf("begin tx: %w", err))
 	}
-	if refundExists {
-		return nil, apperror.ErrDuplicateTransaction()
+	defer dbTx.Rollback(context.WithoutCancel(ctx)) //nolint:errcheck
+
+	// Lock the original, then re-read it and its refunds: concurrent
+	// refunds and reversals of the payment queue here, so none of them
+	// acts on what another has since refunded
+	if origTx, err = s.lockOriginal(ctx, dbTx, origTx.ID); err != nil {
+		return nil, err
+	}
+	if !origTx.IsRefundable() {
+		return nil, apperror.ErrInvalidRefund()
 	}
 
-	// Determine refund amount
-	refundAmount := origTx.Amount
-	if req.Amount != nil {
-		if *req.Amount <= 0 {
-			return nil, apperror.ErrInvalidAmount()
+	if s.maxRefundsPerTx > 0 {
+		count, err := s.txRepo.CountRefunds(ctx, origTx.ID)
+		if err != nil {
+			return nil, apperror.InternalError(fmt.Errorf("count refunds: %w", err))
 		}
-		if *req.Amount > origTx.Amount {
-			return nil, apperror.ErrRefundAmountExceedsOriginal()
+		if count >= int64(s.maxRefundsPerTx) {
+			return nil, apperror.ErrRefundLimitReached(s.maxRefundsPerTx)
 		}
-		refundAmount = *req.Amount
 	}
 
-	// Begin database transaction
-	dbTx, err := s.transactor.Begin(ctx)
+	// Refunds already made bound what is left to refund
+	refunded, err := s.txRepo.SumRefunds(ctx, origTx.ID)
 	if err != nil {
-		return nil, apperror.InternalError(fmt.Errorf("begin tx: %w", err))
+		return nil, apperror.InternalError(fmt.Errorf("sum refunds: %w", err))
+	}
+	remaining := origTx.ExactAmount().Sub(refunded)
+	if remaining.Sign() <= 0 {
+		return nil, apperror.ErrDuplicateTransaction()
+	}
+
+	// Determine refund amount: the rest of the payment unless given
+	refundAmount := remaining
+	if req.Amount != nil || req.AmountDecimal != nil {
+		var whole int64
+		if req.Amount != nil {
+			whole = *req.Amount
+		}
+		requested := requestAmount(whole, req.AmountDecimal)
+		if requested.Sign() <= 0 {
+			return nil, apperror.ErrInvalidAmount()
+		}
+		if requested.GreaterThan(remaining) {
+			return nil, apperror.ErrRefundAmountExceedsOriginal()
+		}
+		refundAmount = requested
 	}
-	defer dbTx.Rollback(ctx) //nolint:errcheck
 
 	// Lock & get wallet
-	wallet, err := s.walletRepo.GetByIDForUpdate(ctx, dbTx, origTx.WalletID)
+	locked, err := s.walletRepo.LockForUpdate(ctx, dbTx, origTx.WalletID)
 	if err != nil {
 		return nil, apperror.InternalError(fmt.Errorf("lock wallet: %w", err))
 	}
+	wallet := locked[origTx.WalletID]
 	if wallet == nil {
-		return nil, apperror.ErrNotFound("wallet")
+		if !s.refundToCurrencyWallet {
+			return nil, apperror.ErrNotFound(fmt.Sprintf("original wallet %s", origTx.WalletID))
+		}
+		// The refund goes back in the payment's own currency, so a wallet
+		// in that currency is created in its place. The unique (merchant,
+		// currency) constraint settles a race with another creator.
+		currency := origTx.Currency
+		if currency == "" {
+			currency = domain.DefaultCurrency
+		}
+		if wallet, err = s.getOrCreateWallet(ctx, dbTx, req.MerchantID, currency); err != nil {
+			return nil, err
+		}
+		s.log.Warn().
+			Str("original_wallet_id", origTx.WalletID.String()).
+			Str("wallet_id", wallet.ID.String()).
+			Msg("original wallet missing, crediting refund to a wallet in its currency")
+	}
+	if err := checkAmountPrecision(wallet, refundAmount); err != nil {
+		return nil, err
 	}
 
 	// Decrypt balance
-	balanceStr, err := s.encSvc.Decrypt(wallet.EncryptedBalance)
+	currentBalance, err := decryptBalance(s.encSvc, wallet, s.log)
 	if err != nil {
-		return nil, apperror.ErrEncryptionFailure(fmt.Errorf("decrypt balance: %w", err))
-	}
-	currentBalance, err := strconv.ParseInt(balanceStr, 10, 64)
-	if err != nil {
-		return nil, apperror.InternalError(fmt.Errorf("parse balance: %w", err))
+		return nil, err
 	}
 
 	// Calculate new balance (ADD back)
-	newBalance := currentBalance + refundAmount
-	newBalanceEnc, err := s.encSvc.Encrypt(strconv.FormatInt(newBalance, 10))
+	newBalance := currentBalance.Add(refundAmount)
+	newBalanceEnc, err := encryptBalance(s.encSvc, wallet, newBalance)
 	if err != nil {
-		return nil, apperror.ErrEncryptionFailure(fmt.Errorf("encrypt new balance: %w", err))
+		return nil, err
 	}
 
-	amountEncrypted, err := s.encSvc.Encrypt(strconv.FormatInt(refundAmount, 10))
+	amountEncrypted, err := s.encSvc.Encrypt(refundAmount.String())
 	if err != nil {
 		return nil, apperror.ErrEncryptionFailure(fmt.Errorf("encrypt amount: %w", err))
 	}
 
-	now := time.Now().UTC()
-	refundRefID := "REFUND-" + req.OriginalReferenceID
-	txn := &domain.Transaction{
-		ID:                    uuid.New(),
-		ReferenceID:           refundRefID,
+	wholeAmount, exactAmount := domain.SplitAmount(refundAmount)
+	txn, err := domain.NewTransaction(domain.TransactionParams{
+		Type:                  domain.TransactionTypeRefund,
+		ReferenceID:           refundRef,
 		MerchantID:            req.MerchantID,
 		WalletID:              wallet.ID,
-		Amount:                refundAmount,
+		Amount:                wholeAmount,
+		AmountDecimal:         exactAmount,
 		AmountEncrypted:       amountEncrypted,
-		TransactionType:       domain.TransactionTypeRefund,
-		Status:                domain.TransactionStatusSuccess,
+		Currency:              wallet.Currency,
 		Signature:             req.Signature,
 		ClientIP:              req.ClientIP,
 		ExtraData:             &req.Reason,
 		OriginalTransactionID: &origTx.ID,
-		CreatedAt:             now,
-		ProcessedAt:           &now,
+		InitiatedBy:           req.InitiatedBy,
+	})
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("build refund transaction: %w", err))
 	}
 
 	// Persist: update wallet balance
@@ -303,9 +670,12 @@ func (s *PaymentServiceImpl) ProcessRefund(ctx context.Context, req ports.Refund
 		return nil, apperror.InternalError(fmt.Errorf("create refund tx: %w", err))
 	}
 
-	// Persist: mark original transaction as REVERSED
-	if err := s.txRepo.UpdateStatus(ctx, dbTx, origTx.ID, domain.TransactionStatusReversed); err != nil {
-		return nil, apperror.InternalError(fmt.Errorf("reverse original tx: %w", err))
+	// Persist: mark original transaction as REVERSED once nothing is left
+	// to refund; until then it stays open to further partial refunds
+	if refunded.Add(refundAmount).Equal(origTx.ExactAmount()) {
+		if err := s.txRepo.UpdateStatus(ctx, dbTx, origTx.ID, domain.TransactionStatusReversed); err != nil {
+			return nil, apperror.InternalError(fmt.Errorf("reverse original tx: %w", err))
+		}
 	}
 
 	// Persist: idempotency log
@@ -318,15 +688,15 @@ func (s *PaymentServiceImpl) ProcessRefund(ctx context.Context, req ports.Refund
 		Key:           idempKey,
 		TransactionID: txn.ID,
 		ResponseJSON:  respJSON,
-		CreatedAt:     now,
+		CreatedAt:     txn.CreatedAt,
 	}
 	if err := s.idempRepo.Create(ctx, dbTx, idempLogEntry); err != nil {
 		return nil, apperror.InternalError(fmt.Errorf("save idempotency log: %w", err))
 	}
 
 	// Commit
-	if err := dbTx.Commit(ctx); err != nil {
-		return nil, apperror.InternalError(fmt.Errorf("commit tx: %w", err))
+	if err := commit(ctx, dbTx); err != nil {
+		return nil, err
 	}
 
 	// Post-process: cache in Redis (best-effort)
@@ -337,70 +707,310 @@ func (s *PaymentServiceImpl) ProcessRefund(ctx context.Context, req ports.Refund
 	s.log.Info().
 		Str("tx_id", txn.ID.String()).
 		Str("original_tx_id", origTx.ID.String()).
-		Int64("refund_amount", refundAmount).
+		Stringer("refund_amount", refundAmount).
 		Msg("refund processed successfully")
 
+	if s.notifier != nil && refundAmount.GreaterThanOrEqual(decimal.NewFromInt(s.largeRefundThreshold)) {
+		s.notifier.Notify(ctx, req.MerchantID, domain.NotificationLargeRefund,
+			fmt.Sprintf("A refund of %s %s was issued for payment %s.", refundAmount, txn.Currency, req.OriginalReferenceID))
+	}
+
+	return txn, nil
+}
+
+// ReverseTransaction credits a payment back to its wallet on an operator's
+// behalf (e.g. for fraud) and marks the original REVERSED. It records a
+// REVERSAL rather than a REFUND for what earlier partial refunds left of the
+// payment. Repeating a reversal replays the first one.
+func (s *PaymentServiceImpl) ReverseTransaction(ctx context.Context, req ports.ReversalRequest) (*domain.Transaction, error) {
+	if utf8.RuneCountInString(req.Reason) > domain.MaxRefundReasonLength {
+		return nil, apperror.Validation(fmt.Sprintf("reason must be at most %d characters", domain.MaxRefundReasonLength))
+	}
+	if err := s.checkExtraDataSize("reason", req.Reason); err != nil {
+		return nil, err
+	}
+
+	origTx, err := s.txRepo.GetByID(ctx, req.TransactionID)
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("find original tx: %w", err))
+	}
+	if origTx == nil {
+		return nil, apperror.ErrNotFound("transaction")
+	}
+
+	idempKey := domain.BuildReversalIdempotencyKey(origTx.MerchantID, s.keyReference(origTx.ReferenceID, origTx.CreatedAt))
+
+	// Replay before the eligibility check: a reversed original is no longer eligible
+	cached, err := s.idempCache.Get(ctx, idempKey)
+	if err != nil {
+		s.log.Warn().Err(err).Str("key", idempKey).Msg("redis idempotency check failed, falling through to DB")
+	}
+	if cached != nil {
+		return s.replayTransaction(ctx, cached)
+	}
+	idempLog, err := s.idempRepo.Get(ctx, idempKey)
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("db idempotency check: %w", err))
+	}
+	if idempLog != nil {
+		return s.replayTransaction(ctx, idempLog.ResponseJSON)
+	}
+
+	release, replay, err := s.claimInFlight(ctx, idempKey)
+	if err != nil {
+		return nil, err
+	}
+	if replay != nil {
+		return s.replayTransaction(ctx, replay)
+	}
+	defer release()
+
+	if !origTx.IsReversible() {
+		return nil, apperror.ErrInvalidReversal()
+	}
+
+	dbTx, err := s.transactor.Begin(ctx)
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("begin tx: %w", err))
+	}
+	defer dbTx.Rollback(context.WithoutCancel(ctx)) //nolint:errcheck
+
+	// Locked as for a refund, so a concurrent refund has either committed
+	// and is subtracted below, or waits and then finds the payment REVERSED
+	if origTx, err = s.lockOriginal(ctx, dbTx, origTx.ID); err != nil {
+		return nil, err
+	}
+	if !origTx.IsReversible() {
+		return nil, apperror.ErrInvalidReversal()
+	}
+	refunded, err := s.txRepo.SumRefunds(ctx, origTx.ID)
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("sum refunds: %w", err))
+	}
+	amount := origTx.ExactAmount().Sub(refunded)
+	if amount.Sign() <= 0 {
+		return nil, apperror.ErrInvalidReversal()
+	}
+
+	locked, err := s.walletRepo.LockForUpdate(ctx, dbTx, origTx.WalletID)
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("lock wallet: %w", err))
+	}
+	wallet := locked[origTx.WalletID]
+	if wallet == nil {
+		return nil, apperror.ErrNotFound(fmt.Sprintf("original wallet %s", origTx.WalletID))
+	}
+
+	currentBalance, err := decryptBalance(s.encSvc, wallet, s.log)
+	if err != nil {
+		return nil, err
+	}
+	newBalance := currentBalance.Add(amount)
+	newBalanceEnc, err := encryptBalance(s.encSvc, wallet, newBalance)
+	if err != nil {
+		return nil, err
+	}
+
+	amountEncrypted, err := s.encSvc.Encrypt(amount.String())
+	if err != nil {
+		return nil, apperror.ErrEncryptionFailure(fmt.Errorf("encrypt amount: %w", err))
+	}
+
+	wholeAmount, exactAmount := domain.SplitAmount(amount)
+	txn, err := domain.NewTransaction(domain.TransactionParams{
+		Type:                  domain.TransactionTypeReversal,
+		ReferenceID:           domain.DerivedReference("REVERSAL-", origTx.ReferenceID),
+		MerchantID:            origTx.MerchantID,
+		WalletID:              wallet.ID,
+		Amount:                wholeAmount,
+		AmountDecimal:         exactAmount,
+		AmountEncrypted:       amountEncrypted,
+		Currency:              wallet.Currency,
+		ClientIP:              req.ClientIP,
+		ExtraData:             &req.Reason,
+		OriginalTransactionID: &origTx.ID,
+		InitiatedBy:           req.InitiatedBy,
+	})
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("build reversal transaction: %w", err))
+	}
+
+	if err := s.walletRepo.UpdateBalance(ctx, dbTx, wallet.ID, newBalanceEnc); err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("update balance: %w", err))
+	}
+	if err := s.txRepo.Create(ctx, dbTx, txn); err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("create reversal tx: %w", err))
+	}
+	if err := s.txRepo.UpdateStatus(ctx, dbTx, origTx.ID, domain.TransactionStatusReversed); err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("reverse original tx: %w", err))
+	}
+
+	respJSON, err := json.Marshal(txn)
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("marshal response: %w", err))
+	}
+	if err := s.idempRepo.Create(ctx, dbTx, &domain.IdempotencyLog{
+		Key:           idempKey,
+		TransactionID: txn.ID,
+		ResponseJSON:  respJSON,
+		CreatedAt:     txn.CreatedAt,
+	}); err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("save idempotency log: %w", err))
+	}
+
+	if err := commit(ctx, dbTx); err != nil {
+		return nil, err
+	}
+
+	if err := s.idempCache.Set(ctx, idempKey, respJSON, idempotencyTTL); err != nil {
+		s.log.Warn().Err(err).Str("key", idempKey).Msg("failed to cache idempotency in redis")
+	}
+
+	s.log.Info().
+		Str("tx_id", txn.ID.String()).
+		Str("original_tx_id", origTx.ID.String()).
+		Stringer("amount", txn.ExactAmount()).
+		Msg("transaction reversed")
+
 	return txn, nil
 }
 
 // ProcessTopup implements the Topup algorithm.
 func (s *PaymentServiceImpl) ProcessTopup(ctx context.Context, req ports.TopupRequest) (*domain.Transaction, error) {
-	if req.Amount <= 0 {
+	amount := requestAmount(req.Amount, req.AmountDecimal)
+	if amount.Sign() <= 0 {
 		return nil, apperror.ErrInvalidAmount()
 	}
+	// Checked here too since a topup may create the wallet for this currency
+	if !domain.IsCurrencyCode(req.Currency) {
+		return nil, apperror.Validation("currency must be an ISO 4217 currency code")
+	}
+	if minAmount := s.topupLimits.Min; minAmount != nil && amount.LessThan(decimal.NewFromInt(*minAmount)) {
+		return nil, apperror.Validation(fmt.Sprintf("topup amount must be at least %d", *minAmount))
+	}
+	if maxAmount := s.topupLimits.Max; maxAmount != nil && amount.GreaterThan(decimal.NewFromInt(*maxAmount)) {
+		return nil, apperror.Validation(fmt.Sprintf("topup amount must not exceed %d", *maxAmount))
+	}
+	if inc := s.topupIncrements[strings.ToUpper(req.Currency)]; inc > 1 && !amount.Mod(decimal.NewFromInt(inc)).IsZero() {
+		return nil, apperror.Validation(fmt.Sprintf("topup amount must be a multiple of %d %s minor units", inc, strings.ToUpper(req.Currency)))
+	}
+
+	// Idempotency only applies when the caller supplies a reference
+	var idempKey string
+	if req.ReferenceID != nil {
+		if len(*req.ReferenceID) > maxTopupReferenceIDLength {
+			return nil, apperror.Validation(fmt.Sprintf("reference_id must be at most %d characters", maxTopupReferenceIDLength))
+		}
+		idempKey = domain.BuildTopupIdempotencyKey(req.MerchantID, s.keyReference(*req.ReferenceID, s.now()))
+
+		// Layer 1: Redis idempotency check
+		cached, err := s.idempCache.Get(ctx, idempKey)
+		if err != nil {
+			s.log.Warn().Err(err).Str("key", idempKey).Msg("redis idempotency check failed, falling through to DB")
+		}
+		if cached != nil {
+			return s.replayTransaction(ctx, cached)
+		}
+
+		// Layer 2: DB idempotency check
+		idempLog, err := s.idempRepo.Get(ctx, idempKey)
+		if err != nil {
+			return nil, apperror.InternalError(fmt.Errorf("db idempotency check: %w", err))
+		}
+		if idempLog != nil {
+			return s.replayTransaction(ctx, idempLog.ResponseJSON)
+		}
+
+		release, replay, err := s.claimInFlight(ctx, idempKey)
+		if err != nil {
+			return nil, err
+		}
+		if replay != nil {
+			return s.replayTransaction(ctx, replay)
+		}
+		defer release()
+
+		// Compared in its stored form, which is what a payment could collide with
+		if err := s.checkReferenceCollision(ctx, req.MerchantID, topupReferencePrefix+*req.ReferenceID, domain.TransactionTypeTopup); err != nil {
+			return nil, err
+		}
+	}
 
 	// Begin database transaction
 	dbTx, err := s.transactor.Begin(ctx)
 	if err != nil {
 		return nil, apperror.InternalError(fmt.Errorf("begin tx: %w", err))
 	}
-	defer dbTx.Rollback(ctx) //nolint:errcheck
+	defer dbTx.Rollback(context.WithoutCancel(ctx)) //nolint:errcheck
 
-	// Lock & get wallet
+	// Lock & get wallet, creating it on first topup when enabled
 	wallet, err := s.walletRepo.GetByMerchantIDForUpdate(ctx, dbTx, req.MerchantID, req.Currency)
 	if err != nil {
 		return nil, apperror.InternalError(fmt.Errorf("lock wallet: %w", err))
 	}
 	if wallet == nil {
-		return nil, apperror.ErrNotFound("wallet")
+		if !s.autoCreateWallets {
+			return nil, apperror.ErrNotFound("wallet")
+		}
+		if wallet, err = s.getOrCreateWallet(ctx, dbTx, req.MerchantID, req.Currency); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkAmountPrecision(wallet, amount); err != nil {
+		return nil, err
 	}
 
-	// Decrypt balance
-	balanceStr, err := s.encSvc.Decrypt(wallet.EncryptedBalance)
-	if err != nil {
-		return nil, apperror.ErrEncryptionFailure(fmt.Errorf("decrypt balance: %w", err))
+	// Business rule: daily topup cap (wallet lock serialises concurrent topups)
+	if limit := s.topupLimits.DailyCap; limit != nil {
+		now := time.Now().UTC()
+		dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		toppedUp, err := s.txRepo.SumTopupsSince(ctx, wallet.ID, dayStart)
+		if err != nil {
+			return nil, apperror.InternalError(fmt.Errorf("sum daily topups: %w", err))
+		}
+		if toppedUp.Add(amount).GreaterThan(decimal.NewFromInt(*limit)) {
+			return nil, apperror.ErrTransactionLimitExceeded()
+		}
 	}
-	currentBalance, err := strconv.ParseInt(balanceStr, 10, 64)
+
+	// Decrypt balance
+	currentBalance, err := decryptBalance(s.encSvc, wallet, s.log)
 	if err != nil {
-		return nil, apperror.InternalError(fmt.Errorf("parse balance: %w", err))
+		return nil, err
 	}
 
 	// Calculate new balance (ADD funds)
-	newBalance := currentBalance + req.Amount
-	newBalanceEnc, err := s.encSvc.Encrypt(strconv.FormatInt(newBalance, 10))
+	newBalance := currentBalance.Add(amount)
+	newBalanceEnc, err := encryptBalance(s.encSvc, wallet, newBalance)
 	if err != nil {
-		return nil, apperror.ErrEncryptionFailure(fmt.Errorf("encrypt new balance: %w", err))
+		return nil, err
 	}
 
-	amountEncrypted, err := s.encSvc.Encrypt(strconv.FormatInt(req.Amount, 10))
+	amountEncrypted, err := s.encSvc.Encrypt(amount.String())
 	if err != nil {
 		return nil, apperror.ErrEncryptionFailure(fmt.Errorf("encrypt amount: %w", err))
 	}
 
 	now := time.Now().UTC()
-	refID := fmt.Sprintf("TOPUP-%s-%d", req.MerchantID.String()[:8], now.UnixMilli())
-	txn := &domain.Transaction{
-		ID:              uuid.New(),
+	refID := fmt.Sprintf("%s%s-%d", topupReferencePrefix, req.MerchantID.String()[:8], now.UnixMilli())
+	if req.ReferenceID != nil {
+		refID = topupReferencePrefix + *req.ReferenceID
+	}
+	wholeAmount, exactAmount := domain.SplitAmount(amount)
+	txn, err := domain.NewTransaction(domain.TransactionParams{
+		Type:            domain.TransactionTypeTopup,
 		ReferenceID:     refID,
 		MerchantID:      req.MerchantID,
 		WalletID:        wallet.ID,
-		Amount:          req.Amount,
+		Amount:          wholeAmount,
+		AmountDecimal:   exactAmount,
 		AmountEncrypted: amountEncrypted,
-		TransactionType: domain.TransactionTypeTopup,
-		Status:          domain.TransactionStatusSuccess,
-		Signature:       "SYSTEM_TOPUP",
-		CreatedAt:       now,
-		ProcessedAt:     &now,
+		Currency:        wallet.Currency,
+		InitiatedBy:     req.InitiatedBy,
+		Now:             now,
+	})
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("build topup transaction: %w", err))
 	}
 
 	// Persist: update wallet balance
@@ -413,20 +1023,145 @@ func (s *PaymentServiceImpl) ProcessTopup(ctx context.Context, req ports.TopupRe
 		return nil, apperror.InternalError(fmt.Errorf("create transaction: %w", err))
 	}
 
+	// Persist: idempotency log (referenced topups only)
+	var respJSON []byte
+	if idempKey != "" {
+		respJSON, err = json.Marshal(txn)
+		if err != nil {
+			return nil, apperror.InternalError(fmt.Errorf("marshal response: %w", err))
+		}
+
+		idempLogEntry := &domain.IdempotencyLog{
+			Key:           idempKey,
+			TransactionID: txn.ID,
+			ResponseJSON:  respJSON,
+			CreatedAt:     now,
+		}
+		if err := s.idempRepo.Create(ctx, dbTx, idempLogEntry); err != nil {
+			return nil, apperror.InternalError(fmt.Errorf("save idempotency log: %w", err))
+		}
+	}
+
 	// Commit
-	if err := dbTx.Commit(ctx); err != nil {
-		return nil, apperror.InternalError(fmt.Errorf("commit tx: %w", err))
+	if err := commit(ctx, dbTx); err != nil {
+		return nil, err
+	}
+
+	// Post-process: cache in Redis (best-effort)
+	if idempKey != "" {
+		if err := s.idempCache.Set(ctx, idempKey, respJSON, idempotencyTTL); err != nil {
+			s.log.Warn().Err(err).Str("key", idempKey).Msg("failed to cache idempotency in redis")
+		}
 	}
 
 	s.log.Info().
 		Str("tx_id", txn.ID.String()).
 		Str("merchant_id", req.MerchantID.String()).
-		Int64("amount", req.Amount).
+		Stringer("amount", amount).
 		Msg("topup processed successfully")
 
 	return txn, nil
 }
 
+// checkReferenceID rejects a reference longer than transactions.reference_id
+// before it is used in an idempotency key or query. The HTTP layer enforces
+// the configured limit; this guards every other caller.
+func checkReferenceID(field, referenceID string) error {
+	if len(referenceID) > domain.MaxReferenceIDLength {
+		return apperror.Validation(fmt.Sprintf("%s must be at most %d characters", field, domain.MaxReferenceIDLength))
+	}
+	return nil
+}
+
+// checkExtraDataSize rejects a value bound for Transaction.ExtraData that
+// exceeds the stored size cap. field names it in the PAY_002 message.
+func (s *PaymentServiceImpl) checkExtraDataSize(field, value string) error {
+	if len(value) > s.maxExtraDataBytes {
+		return apperror.Validation(fmt.Sprintf("%s must be at most %d bytes", field, s.maxExtraDataBytes))
+	}
+	return nil
+}
+
+// getOrCreateWallet creates (or, if a concurrent creator won the race,
+// fetches) the merchant's zero-balance wallet in currency, locked within dbTx.
+func (s *PaymentServiceImpl) getOrCreateWallet(ctx context.Context, dbTx pgx.Tx, merchantID uuid.UUID, currency string) (*domain.Wallet, error) {
+	encryptedBalance, err := s.encSvc.Encrypt("0")
+	if err != nil {
+		return nil, apperror.ErrEncryptionFailure(fmt.Errorf("encrypt initial balance: %w", err))
+	}
+
+	now := time.Now().UTC()
+	wallet, err := s.walletRepo.GetOrCreateForUpdate(ctx, dbTx, &domain.Wallet{
+		ID:               uuid.New(),
+		MerchantID:       merchantID,
+		Currency:         strings.ToUpper(currency),
+		EncryptedBalance: encryptedBalance,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	})
+	if errors.Is(err, domain.ErrWalletExists) {
+		return nil, apperror.ErrWalletExists(strings.ToUpper(currency))
+	}
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("create wallet: %w", err))
+	}
+	return wallet, nil
+}
+
+// replayTransaction returns the transaction recorded for an idempotency hit.
+// With replay refetch enabled the canonical row is read back by ID; if that
+// read fails or finds nothing, the cached copy is returned as before.
+func (s *PaymentServiceImpl) replayTransaction(ctx context.Context, data []byte) (*domain.Transaction, error) {
+	cached, err := s.unmarshalCachedTransaction(data)
+	if err != nil || !s.replayRefetch {
+		return cached, err
+	}
+
+	current, err := s.txRepo.GetByID(ctx, cached.ID)
+	if err != nil {
+		s.log.Warn().Err(err).Str("tx_id", cached.ID.String()).Msg("replay refetch failed, returning cached transaction")
+		return cached, nil
+	}
+	if current == nil {
+		return cached, nil
+	}
+	return current, nil
+}
+
+// requestHashCacheKey returns the cache key holding the request hash of the
+// payment cached under idempKey. Idempotency keys start with a merchant ID
+// or "register:", so it never equals one.
+func requestHashCacheKey(idempKey string) string {
+	return "request-hash:" + idempKey
+}
+
+// checkPaymentReplay returns PAY_009 unless the payment stored under
+// idempKey was made by a request hashing to requestHash. The stored hash is
+// read from the cache, or from the idempotency log if the cache lacks it.
+func (s *PaymentServiceImpl) checkPaymentReplay(ctx context.Context, idempKey, requestHash string) error {
+	stored, err := s.idempCache.Get(ctx, requestHashCacheKey(idempKey))
+	if err == nil && stored != nil {
+		return matchRequestHash(string(stored), requestHash)
+	}
+	idempLog, err := s.idempRepo.Get(ctx, idempKey)
+	if err != nil {
+		return apperror.InternalError(fmt.Errorf("db idempotency check: %w", err))
+	}
+	if idempLog == nil {
+		return nil
+	}
+	return matchRequestHash(idempLog.RequestHash, requestHash)
+}
+
+// matchRequestHash returns PAY_009 if stored is a different request's hash.
+// Logs written before hashes were recorded have none and match any request.
+func matchRequestHash(stored, requestHash string) error {
+	if stored != "" && stored != requestHash {
+		return apperror.ErrIdempotencyMismatch()
+	}
+	return nil
+}
+
 // unmarshalCachedTransaction deserializes a cached transaction.
 func (s *PaymentServiceImpl) unmarshalCachedTransaction(data []byte) (*domain.Transaction, error) {
 	txn := &domain.Transaction{}
@@ -435,3 +1170,78 @@ func (s *PaymentServiceImpl) unmarshalCachedTransaction(data []byte) (*domain.Tr
 	}
 	return txn, nil
 }
+
+// lockOriginal re-reads the transaction a refund or reversal targets,
+// locking its row within dbTx.
+func (s *PaymentServiceImpl) lockOriginal(ctx context.Context, dbTx pgx.Tx, id uuid.UUID) (*domain.Transaction, error) {
+	origTx, err := s.txRepo.GetByIDForUpdate(ctx, dbTx, id)
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("lock original tx: %w", err))
+	}
+	if origTx == nil {
+		return nil, apperror.ErrNotFound("original transaction")
+	}
+	return origTx, nil
+}
+
+// findRefundOriginal returns the payment a refund request targets: the
+// payment with its original reference. With WithDailyReferences several
+// payments can share it and the latest is chosen, so earlier ones cannot be
+// refunded by reference.
+func (s *PaymentServiceImpl) findRefundOriginal(ctx context.Context, req ports.RefundRequest) (*domain.Transaction, error) {
+	origTx, err := s.txRepo.GetByReference(ctx, req.MerchantID, req.OriginalReferenceID, s.referenceDayLoc != nil)
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("find original tx: %w", err))
+	}
+	if origTx == nil {
+		return nil, apperror.ErrNotFound("original transaction")
+	}
+	// GetByReference prefers the payment, so anything else means the
+	// reference was only used by other operations (e.g. a topup)
+	if origTx.TransactionType != domain.TransactionTypePayment {
+		return nil, apperror.ErrReferenceCollision(req.OriginalReferenceID, string(origTx.TransactionType), string(domain.TransactionTypePayment))
+	}
+	return origTx, nil
+}
+
+// keyReference returns the reference part of an idempotency key for
+// referenceID used at t: the reference itself, or with WithDailyReferences
+// the reference prefixed with t's day.
+func (s *PaymentServiceImpl) keyReference(referenceID string, t time.Time) string {
+	if s.referenceDayLoc == nil {
+		return referenceID
+	}
+	return domain.DailyReference(t.In(s.referenceDayLoc), referenceID)
+}
+
+// checkReferenceCollision returns PAY_008 if WithRejectReferenceCollisions
+// is on and referenceID already belongs to a transaction of a type other
+// than txType.
+func (s *PaymentServiceImpl) checkReferenceCollision(ctx context.Context, merchantID uuid.UUID, referenceID string, txType domain.TransactionType) error {
+	if !s.rejectReferenceCollisions {
+		return nil
+	}
+	existing, err := s.txRepo.GetByReference(ctx, merchantID, referenceID, false)
+	if err != nil {
+		return apperror.InternalError(fmt.Errorf("check reference collision: %w", err))
+	}
+	if existing != nil && existing.TransactionType != txType {
+		return apperror.ErrReferenceCollision(referenceID, string(existing.TransactionType), string(txType))
+	}
+	return nil
+}
+
+// commit commits dbTx unless ctx is already done (e.g. the client
+// disconnected or its deadline passed), in which case nothing is committed
+// and the deferred rollback undoes the work. That rollback runs under
+// context.WithoutCancel, since pgx drops the connection instead of rolling
+// back cleanly when given a cancelled context.
+func commit(ctx context.Context, dbTx pgx.Tx) error {
+	if err := ctx.Err(); err != nil {
+		return apperror.InternalError(fmt.Errorf("request cancelled before commit: %w", err))
+	}
+	if err := dbTx.Commit(ctx); err != nil {
+		return apperror.InternalError(fmt.Errorf("commit tx: %w", err))
+	}
+	return nil
+}
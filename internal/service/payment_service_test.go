@@ -3,7 +3,12 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"secure-payment-gateway/internal/core/domain"
 	"secure-payment-gateway/internal/core/ports"
@@ -13,6 +18,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/rs/zerolog"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
@@ -71,6 +77,7 @@ func TestPaymentService_ProcessPayment_Success(t *testing.T) {
 		Currency:    "VND",
 		Signature:   "sig_valid",
 		ClientIP:    "1.2.3.4",
+		InitiatedBy: "ak_live_0001",
 	}
 
 	idempKey := domain.BuildIdempotencyKey(merchantID, "ORDER-001")
@@ -98,9 +105,14 @@ func TestPaymentService_ProcessPayment_Success(t *testing.T) {
 	d.walletRepo.EXPECT().UpdateBalance(ctx, tx, walletID, "enc_50000").Return(nil)
 	// Create transaction
 	d.txRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
-	// Save idempotency log
-	d.idempRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+	// Save idempotency log with the request hash
+	requestHash := domain.PaymentRequestHash(merchantID, decimal.NewFromInt(50000), "VND", "ORDER-001")
+	d.idempRepo.EXPECT().Create(ctx, tx, gomock.Any()).DoAndReturn(func(_ context.Context, _ pgx.Tx, log *domain.IdempotencyLog) error {
+		assert.Equal(t, requestHash, log.RequestHash)
+		return nil
+	})
 	// Cache in Redis
+	d.idempCache.EXPECT().Set(ctx, requestHashCacheKey(idempKey), []byte(requestHash), idempotencyTTL).Return(nil)
 	d.idempCache.EXPECT().Set(ctx, idempKey, gomock.Any(), idempotencyTTL).Return(nil)
 
 	result, err := d.svc.ProcessPayment(ctx, req)
@@ -110,6 +122,135 @@ func TestPaymentService_ProcessPayment_Success(t *testing.T) {
 	assert.Equal(t, domain.TransactionStatusSuccess, result.Status)
 	assert.Equal(t, int64(50000), result.Amount)
 	assert.Equal(t, merchantID, result.MerchantID)
+	assert.Equal(t, "ak_live_0001", result.InitiatedBy)
+}
+
+func TestPaymentService_ProcessPayment_DailyReferences(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+	hcm := time.FixedZone("ICT", 7*3600)
+	WithDailyReferences(hcm)(d.svc)
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	walletID := uuid.New()
+	tx := &mockTx{}
+	req := ports.PaymentRequest{MerchantID: merchantID, ReferenceID: "ORDER-001", Amount: 50000, Currency: "VND", Signature: "sig"}
+
+	// 16:59 UTC is still Oct 16 in ICT; 17:00 UTC is Oct 17
+	days := []struct {
+		now time.Time
+		key string
+	}{
+		{time.Date(2026, 10, 16, 16, 59, 0, 0, time.UTC), domain.BuildIdempotencyKey(merchantID, "20261016:ORDER-001")},
+		{time.Date(2026, 10, 16, 17, 0, 0, 0, time.UTC), domain.BuildIdempotencyKey(merchantID, "20261017:ORDER-001")},
+	}
+	txIDs := map[uuid.UUID]bool{}
+	for _, day := range days {
+		d.svc.now = func() time.Time { return day.now }
+		d.idempCache.EXPECT().Get(ctx, day.key).Return(nil, nil)
+		d.idempRepo.EXPECT().Get(ctx, day.key).Return(nil, nil)
+		d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+		d.walletRepo.EXPECT().GetByMerchantIDForUpdate(ctx, tx, merchantID, "VND").Return(&domain.Wallet{
+			ID: walletID, MerchantID: merchantID, Currency: "VND", EncryptedBalance: "enc_100000",
+		}, nil)
+		d.encSvc.EXPECT().Decrypt("enc_100000").Return("100000", nil)
+		d.encSvc.EXPECT().Encrypt("50000").Return("enc_50000", nil).Times(2)
+		d.walletRepo.EXPECT().UpdateBalance(ctx, tx, walletID, "enc_50000").Return(nil)
+		d.txRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+		d.idempRepo.EXPECT().Create(ctx, tx, gomock.Any()).DoAndReturn(func(_ context.Context, _ pgx.Tx, l *domain.IdempotencyLog) error {
+			assert.Equal(t, day.key, l.Key)
+			return nil
+		})
+		d.idempCache.EXPECT().Set(ctx, requestHashCacheKey(day.key), gomock.Any(), idempotencyTTL).Return(nil)
+		d.idempCache.EXPECT().Set(ctx, day.key, gomock.Any(), idempotencyTTL).Return(nil)
+
+		result, err := d.svc.ProcessPayment(ctx, req)
+		require.NoError(t, err)
+		assert.Equal(t, "ORDER-001", result.ReferenceID, "the stored reference is unchanged")
+		txIDs[result.ID] = true
+	}
+	assert.Len(t, txIDs, 2, "the same reference on the next day is a new transaction")
+}
+
+func TestPaymentService_ProcessRefund_DailyReferencesKeyedByPaymentDay(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+	WithDailyReferences(time.UTC)(d.svc)
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	// The latest payment with the reference was made on Oct 17; a refund on
+	// any later day is keyed by that day and so replays
+	idempKey := domain.BuildRefundIdempotencyKey(merchantID, "20261017:ORDER-001")
+	d.txRepo.EXPECT().GetByReference(ctx, merchantID, "ORDER-001", true).Return(&domain.Transaction{
+		ID: uuid.New(), MerchantID: merchantID, ReferenceID: "ORDER-001", TransactionType: domain.TransactionTypePayment,
+		Status: domain.TransactionStatusReversed, CreatedAt: time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC),
+	}, nil)
+	refund := domain.Transaction{ID: uuid.New(), TransactionType: domain.TransactionTypeRefund, Status: domain.TransactionStatusSuccess}
+	cached, err := json.Marshal(refund)
+	require.NoError(t, err)
+	d.idempCache.EXPECT().Get(ctx, idempKey).Return(cached, nil)
+
+	result, err := d.svc.ProcessRefund(ctx, ports.RefundRequest{MerchantID: merchantID, OriginalReferenceID: "ORDER-001", Reason: "r", Signature: "sig"})
+	require.NoError(t, err)
+	assert.Equal(t, refund.ID, result.ID)
+}
+
+// recordingTx records how a pgx.Tx was finished.
+type recordingTx struct {
+	pgx.Tx
+	committed, rolledBack bool
+	rollbackCtxErr        error
+}
+
+func (r *recordingTx) Commit(_ context.Context) error { r.committed = true; return nil }
+func (r *recordingTx) Rollback(ctx context.Context) error {
+	r.rolledBack = true
+	r.rollbackCtxErr = ctx.Err()
+	return nil
+}
+
+func TestPaymentService_ProcessPayment_CancelledRequestRollsBack(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	merchantID := uuid.New()
+	walletID := uuid.New()
+	tx := &recordingTx{}
+
+	d.idempCache.EXPECT().Get(ctx, gomock.Any()).Return(nil, nil)
+	d.idempRepo.EXPECT().Get(ctx, gomock.Any()).Return(nil, nil)
+	d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+	d.walletRepo.EXPECT().GetByMerchantIDForUpdate(ctx, tx, merchantID, "VND").Return(&domain.Wallet{
+		ID: walletID, MerchantID: merchantID, Currency: "VND", EncryptedBalance: "enc_100000",
+	}, nil)
+	d.encSvc.EXPECT().Decrypt("enc_100000").Return("100000", nil)
+	d.encSvc.EXPECT().Encrypt(gomock.Any()).Return("enc", nil).Times(2)
+	d.walletRepo.EXPECT().UpdateBalance(ctx, tx, walletID, "enc").Return(nil)
+	d.txRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+	// The client disconnects while the last write is in flight
+	d.idempRepo.EXPECT().Create(ctx, tx, gomock.Any()).DoAndReturn(
+		func(context.Context, pgx.Tx, *domain.IdempotencyLog) error {
+			cancel()
+			return nil
+		},
+	)
+	// No Redis write: nothing was committed
+
+	result, err := d.svc.ProcessPayment(ctx, ports.PaymentRequest{
+		MerchantID:  merchantID,
+		ReferenceID: "ORDER-CANCEL",
+		Amount:      50000,
+		Currency:    "VND",
+	})
+	assert.Nil(t, result)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.False(t, tx.committed)
+	assert.True(t, tx.rolledBack)
+	assert.NoError(t, tx.rollbackCtxErr, "rollback must not run on the cancelled context")
 }
 
 func TestPaymentService_ProcessPayment_InvalidAmount(t *testing.T) {
@@ -161,231 +302,294 @@ func TestPaymentService_ProcessPayment_InsufficientFunds(t *testing.T) {
 	assertAppError(t, err, "PAY_001")
 }
 
-func TestPaymentService_ProcessPayment_IdempotentRedisHit(t *testing.T) {
+func TestPaymentService_ProcessPayment_NonNumericBalance(t *testing.T) {
 	d := setupPaymentService(t)
 	defer d.ctrl.Finish()
 
 	ctx := context.Background()
 	merchantID := uuid.New()
-
-	cachedTx := &domain.Transaction{
-		ID:     uuid.New(),
-		Status: domain.TransactionStatusSuccess,
-		Amount: 50000,
-	}
-	cachedJSON, _ := json.Marshal(cachedTx)
-
-	idempKey := domain.BuildIdempotencyKey(merchantID, "ORDER-CACHED")
-	d.idempCache.EXPECT().Get(ctx, idempKey).Return(cachedJSON, nil)
+	tx := &mockTx{}
 
 	req := ports.PaymentRequest{
 		MerchantID:  merchantID,
-		ReferenceID: "ORDER-CACHED",
-		Amount:      50000,
+		ReferenceID: "ORDER-TAMPERED",
+		Amount:      1000,
 		Currency:    "VND",
+		Signature:   "sig",
 	}
 
+	idempKey := domain.BuildIdempotencyKey(merchantID, "ORDER-TAMPERED")
+
+	d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+	d.walletRepo.EXPECT().GetByMerchantIDForUpdate(ctx, tx, merchantID, "VND").Return(&domain.Wallet{
+		ID: uuid.New(), MerchantID: merchantID, EncryptedBalance: "enc_tampered",
+	}, nil)
+	// Decrypts "successfully" to garbage: wrong key or tampered ciphertext
+	d.encSvc.EXPECT().Decrypt("enc_tampered").Return("\x8f\x01garbage", nil)
+
 	result, err := d.svc.ProcessPayment(ctx, req)
-	require.NoError(t, err)
-	assert.Equal(t, cachedTx.ID, result.ID)
+	assert.Nil(t, result)
+	assertAppError(t, err, "SYS_004")
+	assert.NotContains(t, err.Error(), "garbage", "decrypted value must not leak into the error")
 }
 
-// ==================== ProcessRefund Tests ====================
-
-func TestPaymentService_ProcessRefund_FullRefund(t *testing.T) {
+func TestPaymentService_ProcessPayment_DecimalWallet(t *testing.T) {
 	d := setupPaymentService(t)
 	defer d.ctrl.Finish()
 
 	ctx := context.Background()
 	merchantID := uuid.New()
 	walletID := uuid.New()
-	origTxID := uuid.New()
 	tx := &mockTx{}
 
-	req := ports.RefundRequest{
-		MerchantID:          merchantID,
-		OriginalReferenceID: "ORDER-001",
-		Amount:              nil, // full refund
-		Reason:              "Customer request",
-		Signature:           "sig",
-		ClientIP:            "1.2.3.4",
+	req := ports.PaymentRequest{
+		MerchantID:  merchantID,
+		ReferenceID: "ORDER-DEC",
+		Amount:      50,
+		Currency:    "BTC",
+		Signature:   "sig",
 	}
 
-	idempKey := domain.BuildRefundIdempotencyKey(merchantID, "ORDER-001")
+	idempKey := domain.BuildIdempotencyKey(merchantID, "ORDER-DEC")
 
 	d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
 	d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
-	// Find original transaction
-	d.txRepo.EXPECT().GetByReference(ctx, merchantID, "ORDER-001").Return(&domain.Transaction{
-		ID:              origTxID,
-		MerchantID:      merchantID,
-		WalletID:        walletID,
-		Amount:          100000,
-		TransactionType: domain.TransactionTypePayment,
-		Status:          domain.TransactionStatusSuccess,
-	}, nil)
-	// Check no existing refund
-	d.txRepo.EXPECT().CheckRefundExists(ctx, origTxID).Return(false, nil)
-	// Begin tx
 	d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
-	// Lock wallet by ID
-	d.walletRepo.EXPECT().GetByIDForUpdate(ctx, tx, walletID).Return(&domain.Wallet{
-		ID: walletID, MerchantID: merchantID, EncryptedBalance: "enc_50000",
+	d.walletRepo.EXPECT().GetByMerchantIDForUpdate(ctx, tx, merchantID, "BTC").Return(&domain.Wallet{
+		ID: walletID, MerchantID: merchantID, Currency: "BTC",
+		EncryptedBalance: "enc_dec", DecimalBalance: true,
 	}, nil)
-	// Decrypt balance
-	d.encSvc.EXPECT().Decrypt("enc_50000").Return("50000", nil)
-	// Encrypt new balance (50000 + 100000 = 150000)
-	d.encSvc.EXPECT().Encrypt("150000").Return("enc_150000", nil)
-	// Encrypt refund amount
-	d.encSvc.EXPECT().Encrypt("100000").Return("enc_refund_100000", nil)
-	// Update wallet balance
-	d.walletRepo.EXPECT().UpdateBalance(ctx, tx, walletID, "enc_150000").Return(nil)
-	// Create refund transaction
+	d.encSvc.EXPECT().Decrypt("enc_dec").Return("100.000000017", nil)
+	// Exact decimal result, stored in the wallet's decimal representation
+	d.encSvc.EXPECT().Encrypt("50.000000017").Return("enc_new", nil)
+	d.encSvc.EXPECT().Encrypt("50").Return("enc_amount", nil)
+	d.walletRepo.EXPECT().UpdateBalance(ctx, tx, walletID, "enc_new").Return(nil)
 	d.txRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
-	// Mark original as REVERSED
-	d.txRepo.EXPECT().UpdateStatus(ctx, tx, origTxID, domain.TransactionStatusReversed).Return(nil)
-	// Save idempotency log
 	d.idempRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
-	// Cache in Redis
+	d.idempCache.EXPECT().Set(ctx, requestHashCacheKey(idempKey), gomock.Any(), idempotencyTTL).Return(nil)
 	d.idempCache.EXPECT().Set(ctx, idempKey, gomock.Any(), idempotencyTTL).Return(nil)
 
-	result, err := d.svc.ProcessRefund(ctx, req)
+	result, err := d.svc.ProcessPayment(ctx, req)
 	require.NoError(t, err)
-	require.NotNil(t, result)
-	assert.Equal(t, domain.TransactionTypeRefund, result.TransactionType)
-	assert.Equal(t, domain.TransactionStatusSuccess, result.Status)
-	assert.Equal(t, int64(100000), result.Amount) // full refund
-	assert.Equal(t, &origTxID, result.OriginalTransactionID)
+	assert.Equal(t, int64(50), result.Amount)
 }
 
-func TestPaymentService_ProcessRefund_PartialRefund(t *testing.T) {
+func TestPaymentService_ProcessPayment_FractionalAmount(t *testing.T) {
 	d := setupPaymentService(t)
 	defer d.ctrl.Finish()
 
 	ctx := context.Background()
 	merchantID := uuid.New()
 	walletID := uuid.New()
-	origTxID := uuid.New()
 	tx := &mockTx{}
-	refundAmount := int64(30000)
+	exact := decimal.RequireFromString("0.000000017")
 
-	req := ports.RefundRequest{
-		MerchantID:          merchantID,
-		OriginalReferenceID: "ORDER-002",
-		Amount:              &refundAmount,
-		Reason:              "Partial refund",
-		Signature:           "sig",
+	req := ports.PaymentRequest{
+		MerchantID:    merchantID,
+		ReferenceID:   "ORDER-FRAC",
+		AmountDecimal: &exact,
+		Currency:      "BTC",
+		Signature:     "sig",
 	}
 
-	idempKey := domain.BuildRefundIdempotencyKey(merchantID, "ORDER-002")
+	idempKey := domain.BuildIdempotencyKey(merchantID, "ORDER-FRAC")
 
 	d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
 	d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
-	d.txRepo.EXPECT().GetByReference(ctx, merchantID, "ORDER-002").Return(&domain.Transaction{
-		ID: origTxID, MerchantID: merchantID, WalletID: walletID,
-		Amount: 100000, TransactionType: domain.TransactionTypePayment, Status: domain.TransactionStatusSuccess,
-	}, nil)
-	d.txRepo.EXPECT().CheckRefundExists(ctx, origTxID).Return(false, nil)
 	d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
-	d.walletRepo.EXPECT().GetByIDForUpdate(ctx, tx, walletID).Return(&domain.Wallet{
-		ID: walletID, EncryptedBalance: "enc_0",
+	d.walletRepo.EXPECT().GetByMerchantIDForUpdate(ctx, tx, merchantID, "BTC").Return(&domain.Wallet{
+		ID: walletID, MerchantID: merchantID, Currency: "BTC",
+		EncryptedBalance: "enc_dec", DecimalBalance: true,
 	}, nil)
-	d.encSvc.EXPECT().Decrypt("enc_0").Return("0", nil)
-	d.encSvc.EXPECT().Encrypt("30000").Return("enc_30000", nil)
-	d.encSvc.EXPECT().Encrypt("30000").Return("enc_refund_30000", nil)
-	d.walletRepo.EXPECT().UpdateBalance(ctx, tx, walletID, "enc_30000").Return(nil)
-	d.txRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
-	d.txRepo.EXPECT().UpdateStatus(ctx, tx, origTxID, domain.TransactionStatusReversed).Return(nil)
-	d.idempRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+	d.encSvc.EXPECT().Decrypt("enc_dec").Return("100.000000017", nil)
+	d.encSvc.EXPECT().Encrypt("100").Return("enc_new", nil)
+	d.encSvc.EXPECT().Encrypt("0.000000017").Return("enc_amount", nil)
+	d.walletRepo.EXPECT().UpdateBalance(ctx, tx, walletID, "enc_new").Return(nil)
+	d.txRepo.EXPECT().Create(ctx, tx, gomock.Any()).DoAndReturn(func(_ context.Context, _ pgx.Tx, txn *domain.Transaction) error {
+		assert.Equal(t, int64(0), txn.Amount)
+		require.NotNil(t, txn.AmountDecimal)
+		assert.Equal(t, "0.000000017", txn.AmountDecimal.String())
+		return nil
+	})
+	d.idempRepo.EXPECT().Create(ctx, tx, gomock.Any()).DoAndReturn(func(_ context.Context, _ pgx.Tx, log *domain.IdempotencyLog) error {
+		assert.Equal(t, domain.PaymentRequestHash(merchantID, exact, "BTC", "ORDER-FRAC"), log.RequestHash)
+		return nil
+	})
+	d.idempCache.EXPECT().Set(ctx, requestHashCacheKey(idempKey), gomock.Any(), idempotencyTTL).Return(nil)
 	d.idempCache.EXPECT().Set(ctx, idempKey, gomock.Any(), idempotencyTTL).Return(nil)
 
-	result, err := d.svc.ProcessRefund(ctx, req)
+	result, err := d.svc.ProcessPayment(ctx, req)
 	require.NoError(t, err)
-	assert.Equal(t, int64(30000), result.Amount)
+	assert.Equal(t, "0.000000017", result.ExactAmount().String())
 }
 
-func TestPaymentService_ProcessRefund_OriginalNotFound(t *testing.T) {
+func TestPaymentService_FractionalAmountOnInt64Wallet(t *testing.T) {
+	half := decimal.RequireFromString("100.5")
+	wallet := func(merchantID uuid.UUID) *domain.Wallet {
+		return &domain.Wallet{ID: uuid.New(), MerchantID: merchantID, Currency: "VND", EncryptedBalance: "enc"}
+	}
+
+	t.Run("payment", func(t *testing.T) {
+		d := setupPaymentService(t)
+		ctx := context.Background()
+		merchantID := uuid.New()
+		tx := &mockTx{}
+		idempKey := domain.BuildIdempotencyKey(merchantID, "ORDER-HALF")
+
+		d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+		d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+		d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+		d.walletRepo.EXPECT().GetByMerchantIDForUpdate(ctx, tx, merchantID, "VND").Return(wallet(merchantID), nil)
+
+		// Rejected before the balance is read or written
+		result, err := d.svc.ProcessPayment(ctx, ports.PaymentRequest{
+			MerchantID: merchantID, ReferenceID: "ORDER-HALF", Amount: 100, AmountDecimal: &half, Currency: "VND",
+		})
+		assert.Nil(t, result)
+		assertAppError(t, err, "PAY_002")
+	})
+
+	t.Run("topup", func(t *testing.T) {
+		d := setupPaymentService(t)
+		ctx := context.Background()
+		merchantID := uuid.New()
+		tx := &mockTx{}
+
+		d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+		d.walletRepo.EXPECT().GetByMerchantIDForUpdate(ctx, tx, merchantID, "VND").Return(wallet(merchantID), nil)
+
+		result, err := d.svc.ProcessTopup(ctx, ports.TopupRequest{
+			MerchantID: merchantID, Amount: 100, AmountDecimal: &half, Currency: "VND",
+		})
+		assert.Nil(t, result)
+		assertAppError(t, err, "PAY_002")
+	})
+}
+
+func TestPaymentService_ProcessRefund_FractionalPayment(t *testing.T) {
 	d := setupPaymentService(t)
 	defer d.ctrl.Finish()
 
 	ctx := context.Background()
 	merchantID := uuid.New()
+	walletID := uuid.New()
+	origTxID := uuid.New()
+	tx := &mockTx{}
+	paid := decimal.RequireFromString("0.75")
+	idempKey := domain.BuildRefundIdempotencyKey(merchantID, "ORDER-FRAC")
 
-	req := ports.RefundRequest{
-		MerchantID:          merchantID,
-		OriginalReferenceID: "NONEXISTENT",
-		Signature:           "sig",
-	}
-
-	idempKey := domain.BuildRefundIdempotencyKey(merchantID, "NONEXISTENT")
 	d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
 	d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
-	d.txRepo.EXPECT().GetByReference(ctx, merchantID, "NONEXISTENT").Return(nil, nil)
+	orig := &domain.Transaction{
+		ID: origTxID, MerchantID: merchantID, WalletID: walletID, Amount: 0, AmountDecimal: &paid,
+		TransactionType: domain.TransactionTypePayment, Status: domain.TransactionStatusSuccess, Currency: "BTC",
+	}
+	d.txRepo.EXPECT().GetByReference(ctx, merchantID, "ORDER-FRAC", false).Return(orig, nil)
+	d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+	d.txRepo.EXPECT().GetByIDForUpdate(ctx, tx, origTxID).Return(orig, nil)
+	// A quarter was refunded already; the full refund returns the rest
+	d.txRepo.EXPECT().SumRefunds(ctx, origTxID).Return(decimal.RequireFromString("0.25"), nil)
+	d.walletRepo.EXPECT().LockForUpdate(ctx, tx, walletID).Return(map[uuid.UUID]*domain.Wallet{walletID: {
+		ID: walletID, MerchantID: merchantID, Currency: "BTC", EncryptedBalance: "enc_dec", DecimalBalance: true,
+	}}, nil)
+	d.encSvc.EXPECT().Decrypt("enc_dec").Return("1.5", nil)
+	d.encSvc.EXPECT().Encrypt("2").Return("enc_new", nil)
+	d.encSvc.EXPECT().Encrypt("0.5").Return("enc_amount", nil)
+	d.walletRepo.EXPECT().UpdateBalance(ctx, tx, walletID, "enc_new").Return(nil)
+	d.txRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+	d.txRepo.EXPECT().UpdateStatus(ctx, tx, origTxID, domain.TransactionStatusReversed).Return(nil)
+	d.idempRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+	d.idempCache.EXPECT().Set(ctx, idempKey, gomock.Any(), idempotencyTTL).Return(nil)
 
-	result, err := d.svc.ProcessRefund(ctx, req)
-	assert.Nil(t, result)
-	assertAppError(t, err, "PAY_004")
+	result, err := d.svc.ProcessRefund(ctx, ports.RefundRequest{
+		MerchantID: merchantID, OriginalReferenceID: "ORDER-FRAC", Reason: "r", Signature: "sig",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "0.5", result.ExactAmount().String())
 }
 
-func TestPaymentService_ProcessRefund_NotRefundable(t *testing.T) {
+func TestPaymentService_ProcessPayment_ExtraDataTooLarge(t *testing.T) {
 	d := setupPaymentService(t)
 	defer d.ctrl.Finish()
+	WithMaxExtraDataBytes(16)(d.svc)
 
-	ctx := context.Background()
-	merchantID := uuid.New()
+	ok := strings.Repeat("x", 16)
+	tooBig := strings.Repeat("é", 9) // 9 characters, 18 bytes
+	req := ports.PaymentRequest{MerchantID: uuid.New(), ReferenceID: "ORDER-X", Amount: 1, Currency: "VND"}
 
-	req := ports.RefundRequest{
-		MerchantID:          merchantID,
-		OriginalReferenceID: "ORDER-FAILED",
-		Signature:           "sig",
-	}
+	// Rejected before any idempotency or wallet access
+	req.ExtraData = &tooBig
+	result, err := d.svc.ProcessPayment(context.Background(), req)
+	assert.Nil(t, result)
+	assertAppError(t, err, "PAY_002")
+	assert.Contains(t, err.Error(), "extra_data must be at most 16 bytes")
 
-	idempKey := domain.BuildRefundIdempotencyKey(merchantID, "ORDER-FAILED")
-	d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
-	d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
-	d.txRepo.EXPECT().GetByReference(ctx, merchantID, "ORDER-FAILED").Return(&domain.Transaction{
-		ID:              uuid.New(),
-		TransactionType: domain.TransactionTypePayment,
-		Status:          domain.TransactionStatusFailed, // Not SUCCESS
-	}, nil)
+	assert.NoError(t, d.svc.checkExtraDataSize("extra_data", ok))
+}
 
-	result, err := d.svc.ProcessRefund(ctx, req)
+func TestPaymentService_ProcessPayment_ExtraDataDefaultLimit(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	extra := strings.Repeat("a", domain.DefaultMaxExtraDataBytes+1)
+	result, err := d.svc.ProcessPayment(context.Background(), ports.PaymentRequest{
+		MerchantID: uuid.New(), ReferenceID: "ORDER-X", Amount: 1, Currency: "VND", ExtraData: &extra,
+	})
 	assert.Nil(t, result)
-	assertAppError(t, err, "PAY_006")
+	assertAppError(t, err, "PAY_002")
 }
 
-func TestPaymentService_ProcessRefund_AmountExceeds(t *testing.T) {
+func TestPaymentService_ReferenceTooLong(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	// Rejected before any idempotency or wallet access
+	long := strings.Repeat("a", 10*1024)
+	ctx := context.Background()
+	_, err := d.svc.ProcessPayment(ctx, ports.PaymentRequest{MerchantID: uuid.New(), ReferenceID: long, Amount: 1, Currency: "VND"})
+	assertAppError(t, err, "PAY_002")
+	assert.Contains(t, err.Error(), "reference_id must be at most 100 characters")
+
+	_, err = d.svc.ProcessRefund(ctx, ports.RefundRequest{MerchantID: uuid.New(), OriginalReferenceID: long, Reason: "r"})
+	assertAppError(t, err, "PAY_002")
+
+	_, err = d.svc.ProcessTopup(ctx, ports.TopupRequest{MerchantID: uuid.New(), ReferenceID: &long, Amount: 1, Currency: "VND"})
+	assertAppError(t, err, "PAY_002")
+}
+
+func TestPaymentService_ProcessPayment_IdempotentRedisHit(t *testing.T) {
 	d := setupPaymentService(t)
 	defer d.ctrl.Finish()
 
 	ctx := context.Background()
 	merchantID := uuid.New()
-	origTxID := uuid.New()
-	over := int64(999999)
 
-	req := ports.RefundRequest{
-		MerchantID:          merchantID,
-		OriginalReferenceID: "ORDER-005",
-		Amount:              &over,
-		Signature:           "sig",
+	cachedTx := &domain.Transaction{
+		ID:     uuid.New(),
+		Status: domain.TransactionStatusSuccess,
+		Amount: 50000,
 	}
+	cachedJSON, _ := json.Marshal(cachedTx)
 
-	idempKey := domain.BuildRefundIdempotencyKey(merchantID, "ORDER-005")
-	d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
-	d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
-	d.txRepo.EXPECT().GetByReference(ctx, merchantID, "ORDER-005").Return(&domain.Transaction{
-		ID: origTxID, Amount: 50000, TransactionType: domain.TransactionTypePayment, Status: domain.TransactionStatusSuccess,
-	}, nil)
-	d.txRepo.EXPECT().CheckRefundExists(ctx, origTxID).Return(false, nil)
+	idempKey := domain.BuildIdempotencyKey(merchantID, "ORDER-CACHED")
+	d.idempCache.EXPECT().Get(ctx, idempKey).Return(cachedJSON, nil)
+	d.idempCache.EXPECT().Get(ctx, requestHashCacheKey(idempKey)).Return([]byte(domain.PaymentRequestHash(merchantID, decimal.NewFromInt(50000), "VND", "ORDER-CACHED")), nil)
 
-	result, err := d.svc.ProcessRefund(ctx, req)
-	assert.Nil(t, result)
-	assertAppError(t, err, "PAY_007")
-}
+	req := ports.PaymentRequest{
+		MerchantID:  merchantID,
+		ReferenceID: "ORDER-CACHED",
+		Amount:      50000,
+		Currency:    "VND",
+	}
 
-// ==================== ProcessTopup Tests ====================
+	result, err := d.svc.ProcessPayment(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, cachedTx.ID, result.ID)
+}
 
-func TestPaymentService_ProcessTopup_Success(t *testing.T) {
+func TestPaymentService_ProcessPayment_ExplicitKeyStored(t *testing.T) {
 	d := setupPaymentService(t)
 	defer d.ctrl.Finish()
 
@@ -393,19 +597,1093 @@ func TestPaymentService_ProcessTopup_Success(t *testing.T) {
 	merchantID := uuid.New()
 	walletID := uuid.New()
 	tx := &mockTx{}
+	idempKey := domain.BuildPaymentIdempotencyKey(merchantID, "client-key-1")
 
-	req := ports.TopupRequest{
-		MerchantID: merchantID,
-		Amount:     500000,
-		Currency:   "VND",
-	}
-
+	// The reference-derived key is never looked up
+	d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
 	d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
 	d.walletRepo.EXPECT().GetByMerchantIDForUpdate(ctx, tx, merchantID, "VND").Return(&domain.Wallet{
-		ID: walletID, MerchantID: merchantID, EncryptedBalance: "enc_100000",
+		ID:               walletID,
+		MerchantID:       merchantID,
+		Currency:         "VND",
+		EncryptedBalance: "enc_100000",
 	}, nil)
 	d.encSvc.EXPECT().Decrypt("enc_100000").Return("100000", nil)
-	d.encSvc.EXPECT().Encrypt("600000").Return("enc_600000", nil) // 100000 + 500000
+	d.encSvc.EXPECT().Encrypt("50000").Return("enc_50000", nil).Times(2)
+	d.walletRepo.EXPECT().UpdateBalance(ctx, tx, walletID, "enc_50000").Return(nil)
+	d.txRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+	d.idempRepo.EXPECT().Create(ctx, tx, gomock.Any()).DoAndReturn(func(_ context.Context, _ pgx.Tx, log *domain.IdempotencyLog) error {
+		assert.Equal(t, idempKey, log.Key)
+		// The reference is left out of the hash under an explicit key
+		assert.Equal(t, domain.PaymentRequestHash(merchantID, decimal.NewFromInt(50000), "VND", ""), log.RequestHash)
+		return nil
+	})
+	d.idempCache.EXPECT().Set(ctx, requestHashCacheKey(idempKey), gomock.Any(), idempotencyTTL).Return(nil)
+	d.idempCache.EXPECT().Set(ctx, idempKey, gomock.Any(), idempotencyTTL).Return(nil)
+
+	_, err := d.svc.ProcessPayment(ctx, ports.PaymentRequest{
+		MerchantID:     merchantID,
+		ReferenceID:    "ORDER-001",
+		Amount:         50000,
+		Currency:       "VND",
+		IdempotencyKey: "client-key-1",
+	})
+	require.NoError(t, err)
+}
+
+func TestPaymentService_ProcessPayment_ExplicitKeyReplaysAcrossReferences(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	cachedTx := &domain.Transaction{ID: uuid.New(), ReferenceID: "ORDER-001", Status: domain.TransactionStatusSuccess, Amount: 50000}
+	cachedJSON, _ := json.Marshal(cachedTx)
+	idempKey := domain.BuildPaymentIdempotencyKey(merchantID, "client-key-1")
+
+	// A retry under the same key but a fresh reference is not charged again
+	d.idempCache.EXPECT().Get(ctx, idempKey).Return(cachedJSON, nil)
+	d.idempCache.EXPECT().Get(ctx, requestHashCacheKey(idempKey)).Return([]byte(domain.PaymentRequestHash(merchantID, decimal.NewFromInt(50000), "VND", "")), nil)
+
+	result, err := d.svc.ProcessPayment(ctx, ports.PaymentRequest{
+		MerchantID:     merchantID,
+		ReferenceID:    "ORDER-001-RETRY",
+		Amount:         50000,
+		Currency:       "VND",
+		IdempotencyKey: "client-key-1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, cachedTx.ID, result.ID)
+}
+
+func TestPaymentService_ProcessPayment_ExplicitKeyReusedForOtherAmount(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	cachedTx := &domain.Transaction{ID: uuid.New(), ReferenceID: "ORDER-001", Status: domain.TransactionStatusSuccess, Amount: 50000}
+	cachedJSON, _ := json.Marshal(cachedTx)
+	idempKey := domain.BuildPaymentIdempotencyKey(merchantID, "client-key-1")
+
+	// The key already paid 50000; reusing it for another amount is not a retry
+	d.idempCache.EXPECT().Get(ctx, idempKey).Return(cachedJSON, nil)
+	d.idempCache.EXPECT().Get(ctx, requestHashCacheKey(idempKey)).Return([]byte(domain.PaymentRequestHash(merchantID, decimal.NewFromInt(50000), "VND", "")), nil)
+
+	result, err := d.svc.ProcessPayment(ctx, ports.PaymentRequest{
+		MerchantID:     merchantID,
+		ReferenceID:    "ORDER-001",
+		Amount:         70000,
+		Currency:       "VND",
+		IdempotencyKey: "client-key-1",
+	})
+	assert.Nil(t, result)
+	assertAppError(t, err, "PAY_009")
+}
+
+func TestPaymentService_ProcessPayment_ReplayWithDifferentAmount(t *testing.T) {
+	ctx := context.Background()
+	merchantID := uuid.New()
+	idempKey := domain.BuildIdempotencyKey(merchantID, "ORDER-001")
+	cachedJSON, _ := json.Marshal(&domain.Transaction{ID: uuid.New(), ReferenceID: "ORDER-001", Status: domain.TransactionStatusSuccess, Amount: 50000})
+	storedLog := &domain.IdempotencyLog{
+		Key:          idempKey,
+		ResponseJSON: cachedJSON,
+		RequestHash:  domain.PaymentRequestHash(merchantID, decimal.NewFromInt(50000), "VND", "ORDER-001"),
+	}
+
+	tests := []struct {
+		name   string
+		expect func(d *paymentTestDeps)
+	}{
+		{"redis hit", func(d *paymentTestDeps) {
+			d.idempCache.EXPECT().Get(ctx, idempKey).Return(cachedJSON, nil)
+			d.idempCache.EXPECT().Get(ctx, requestHashCacheKey(idempKey)).Return([]byte(storedLog.RequestHash), nil)
+		}},
+		{"redis hit without cached hash", func(d *paymentTestDeps) {
+			d.idempCache.EXPECT().Get(ctx, idempKey).Return(cachedJSON, nil)
+			d.idempCache.EXPECT().Get(ctx, requestHashCacheKey(idempKey)).Return(nil, nil)
+			d.idempRepo.EXPECT().Get(ctx, idempKey).Return(storedLog, nil)
+		}},
+		{"db hit", func(d *paymentTestDeps) {
+			d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+			d.idempRepo.EXPECT().Get(ctx, idempKey).Return(storedLog, nil)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := setupPaymentService(t)
+			defer d.ctrl.Finish()
+			tt.expect(d)
+
+			// No wallet expectations: the stale payment is neither replayed nor repeated
+			result, err := d.svc.ProcessPayment(ctx, ports.PaymentRequest{
+				MerchantID: merchantID, ReferenceID: "ORDER-001", Amount: 70000, Currency: "VND",
+			})
+			assert.Nil(t, result)
+			assertAppError(t, err, "PAY_009")
+		})
+	}
+}
+
+func TestPaymentService_ProcessPayment_ReplayRefetchReflectsReversal(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+	WithReplayRefetch(true)(d.svc)
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	walletID := uuid.New()
+
+	cachedTx := &domain.Transaction{
+		ID:       uuid.New(),
+		WalletID: walletID,
+		Status:   domain.TransactionStatusSuccess,
+		Amount:   50000,
+	}
+	cachedJSON, _ := json.Marshal(cachedTx)
+	reversed := *cachedTx
+	reversed.Status = domain.TransactionStatusReversed
+
+	idempKey := domain.BuildIdempotencyKey(merchantID, "ORDER-REVERSED")
+	d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	d.idempRepo.EXPECT().Get(ctx, idempKey).Return(&domain.IdempotencyLog{ResponseJSON: cachedJSON}, nil)
+	d.txRepo.EXPECT().GetByID(ctx, cachedTx.ID).Return(&reversed, nil)
+
+	result, err := d.svc.ProcessPayment(ctx, ports.PaymentRequest{
+		MerchantID: merchantID, ReferenceID: "ORDER-REVERSED", Amount: 50000, Currency: "VND",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, domain.TransactionStatusReversed, result.Status)
+	assert.Equal(t, walletID, result.WalletID)
+}
+
+func TestPaymentService_ProcessPayment_ReplayWithoutRefetchReturnsSnapshot(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	cachedTx := &domain.Transaction{ID: uuid.New(), Status: domain.TransactionStatusSuccess, Amount: 50000}
+	cachedJSON, _ := json.Marshal(cachedTx)
+
+	// No GetByID expectation: the repository must not be queried. The log
+	// predates request hashes, so any request matches it.
+	idempKey := domain.BuildIdempotencyKey(merchantID, "ORDER-SNAP")
+	d.idempCache.EXPECT().Get(ctx, idempKey).Return(cachedJSON, nil)
+	d.idempCache.EXPECT().Get(ctx, requestHashCacheKey(idempKey)).Return(nil, nil)
+	d.idempRepo.EXPECT().Get(ctx, idempKey).Return(&domain.IdempotencyLog{Key: idempKey, ResponseJSON: cachedJSON}, nil)
+
+	result, err := d.svc.ProcessPayment(ctx, ports.PaymentRequest{
+		MerchantID: merchantID, ReferenceID: "ORDER-SNAP", Amount: 50000, Currency: "VND",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, domain.TransactionStatusSuccess, result.Status)
+}
+
+func TestPaymentService_ProcessRefund_ReplayRefetchFallsBackToSnapshot(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+	WithReplayRefetch(true)(d.svc)
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	cachedTx := &domain.Transaction{ID: uuid.New(), Status: domain.TransactionStatusSuccess, Amount: 20000}
+	cachedJSON, _ := json.Marshal(cachedTx)
+
+	d.idempCache.EXPECT().Get(ctx, domain.BuildRefundIdempotencyKey(merchantID, "ORDER-R")).Return(cachedJSON, nil)
+	d.txRepo.EXPECT().GetByID(ctx, cachedTx.ID).Return(nil, errors.New("connection reset"))
+
+	result, err := d.svc.ProcessRefund(ctx, ports.RefundRequest{MerchantID: merchantID, OriginalReferenceID: "ORDER-R"})
+	require.NoError(t, err)
+	assert.Equal(t, cachedTx.ID, result.ID)
+	assert.Equal(t, domain.TransactionStatusSuccess, result.Status)
+}
+
+// ==================== ProcessRefund Tests ====================
+
+func TestPaymentService_ProcessRefund_FullRefund(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	walletID := uuid.New()
+	origTxID := uuid.New()
+	tx := &mockTx{}
+
+	req := ports.RefundRequest{
+		MerchantID:          merchantID,
+		OriginalReferenceID: "ORDER-001",
+		Amount:              nil, // full refund
+		Reason:              "Customer request",
+		Signature:           "sig",
+		ClientIP:            "1.2.3.4",
+	}
+
+	idempKey := domain.BuildRefundIdempotencyKey(merchantID, "ORDER-001")
+
+	d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	// Find original transaction
+	orig := &domain.Transaction{
+		ID:              origTxID,
+		MerchantID:      merchantID,
+		WalletID:        walletID,
+		Amount:          100000,
+		TransactionType: domain.TransactionTypePayment,
+		Status:          domain.TransactionStatusSuccess,
+	}
+	d.txRepo.EXPECT().GetByReference(ctx, merchantID, "ORDER-001", false).Return(orig, nil)
+	// Begin tx
+	d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+	// Lock and re-read the original
+	d.txRepo.EXPECT().GetByIDForUpdate(ctx, tx, origTxID).Return(orig, nil)
+	// Check no existing refund
+	d.txRepo.EXPECT().SumRefunds(ctx, origTxID).Return(decimal.NewFromInt(0), nil)
+	// Lock wallet by ID
+	d.walletRepo.EXPECT().LockForUpdate(ctx, tx, walletID).Return(map[uuid.UUID]*domain.Wallet{walletID: {
+		ID: walletID, MerchantID: merchantID, EncryptedBalance: "enc_50000",
+	}}, nil)
+	// Decrypt balance
+	d.encSvc.EXPECT().Decrypt("enc_50000").Return("50000", nil)
+	// Encrypt new balance (50000 + 100000 = 150000)
+	d.encSvc.EXPECT().Encrypt("150000").Return("enc_150000", nil)
+	// Encrypt refund amount
+	d.encSvc.EXPECT().Encrypt("100000").Return("enc_refund_100000", nil)
+	// Update wallet balance
+	d.walletRepo.EXPECT().UpdateBalance(ctx, tx, walletID, "enc_150000").Return(nil)
+	// Create refund transaction
+	d.txRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+	// Mark original as REVERSED
+	d.txRepo.EXPECT().UpdateStatus(ctx, tx, origTxID, domain.TransactionStatusReversed).Return(nil)
+	// Save idempotency log
+	d.idempRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+	// Cache in Redis
+	d.idempCache.EXPECT().Set(ctx, idempKey, gomock.Any(), idempotencyTTL).Return(nil)
+
+	result, err := d.svc.ProcessRefund(ctx, req)
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, domain.TransactionTypeRefund, result.TransactionType)
+	assert.Equal(t, domain.TransactionStatusSuccess, result.Status)
+	assert.Equal(t, int64(100000), result.Amount) // full refund
+	assert.Equal(t, &origTxID, result.OriginalTransactionID)
+}
+
+func TestPaymentService_ProcessRefund_PartialRefund(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	walletID := uuid.New()
+	origTxID := uuid.New()
+	tx := &mockTx{}
+	refundAmount := int64(30000)
+
+	req := ports.RefundRequest{
+		MerchantID:          merchantID,
+		OriginalReferenceID: "ORDER-002",
+		Amount:              &refundAmount,
+		Reason:              "Partial refund",
+		Signature:           "sig",
+	}
+
+	idempKey := domain.BuildRefundIdempotencyKey(merchantID, "ORDER-002")
+
+	d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	orig := &domain.Transaction{
+		ID: origTxID, MerchantID: merchantID, WalletID: walletID,
+		Amount: 100000, TransactionType: domain.TransactionTypePayment, Status: domain.TransactionStatusSuccess,
+	}
+	d.txRepo.EXPECT().GetByReference(ctx, merchantID, "ORDER-002", false).Return(orig, nil)
+	d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+	d.txRepo.EXPECT().GetByIDForUpdate(ctx, tx, origTxID).Return(orig, nil)
+	d.txRepo.EXPECT().SumRefunds(ctx, origTxID).Return(decimal.NewFromInt(0), nil)
+	d.walletRepo.EXPECT().LockForUpdate(ctx, tx, walletID).Return(map[uuid.UUID]*domain.Wallet{walletID: {
+		ID: walletID, EncryptedBalance: "enc_0",
+	}}, nil)
+	d.encSvc.EXPECT().Decrypt("enc_0").Return("0", nil)
+	d.encSvc.EXPECT().Encrypt("30000").Return("enc_30000", nil)
+	d.encSvc.EXPECT().Encrypt("30000").Return("enc_refund_30000", nil)
+	d.walletRepo.EXPECT().UpdateBalance(ctx, tx, walletID, "enc_30000").Return(nil)
+	d.txRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+	// Part of the payment is left, so the original is not marked REVERSED
+	d.txRepo.EXPECT().UpdateStatus(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	d.idempRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+	d.idempCache.EXPECT().Set(ctx, idempKey, gomock.Any(), idempotencyTTL).Return(nil)
+
+	result, err := d.svc.ProcessRefund(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, int64(30000), result.Amount)
+}
+
+func TestPaymentService_ProcessRefund_LastPartialRefundReverses(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		req     ports.RefundRequest
+		wantKey string
+		wantRef string
+	}{
+		{
+			name:    "own reference",
+			req:     ports.RefundRequest{ReferenceID: "RF-2"},
+			wantKey: "ORDER-003:RF-2",
+			wantRef: "RF-2",
+		},
+		{
+			name:    "idempotency key",
+			req:     ports.RefundRequest{IdempotencyKey: "key-2"},
+			wantKey: "ORDER-003:idempotency-key:key-2",
+			wantRef: "REFUND-ORDER-003",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d := setupPaymentService(t)
+			defer d.ctrl.Finish()
+
+			ctx := context.Background()
+			merchantID := uuid.New()
+			walletID := uuid.New()
+			origTxID := uuid.New()
+			tx := &mockTx{}
+			refundAmount := int64(70000)
+
+			req := tt.req
+			req.MerchantID = merchantID
+			req.OriginalReferenceID = "ORDER-003"
+			req.Amount = &refundAmount
+			req.Signature = "sig"
+
+			idempKey := merchantID.String() + ":refund:" + tt.wantKey
+			d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+			d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+			orig := &domain.Transaction{
+				ID: origTxID, MerchantID: merchantID, WalletID: walletID,
+				Amount: 100000, TransactionType: domain.TransactionTypePayment, Status: domain.TransactionStatusSuccess,
+			}
+			d.txRepo.EXPECT().GetByReference(ctx, merchantID, "ORDER-003", false).Return(orig, nil)
+			d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+			d.txRepo.EXPECT().GetByIDForUpdate(ctx, tx, origTxID).Return(orig, nil)
+			// An earlier refund took 30000, so this one takes the rest
+			d.txRepo.EXPECT().SumRefunds(ctx, origTxID).Return(decimal.NewFromInt(30000), nil)
+			d.walletRepo.EXPECT().LockForUpdate(ctx, tx, walletID).Return(map[uuid.UUID]*domain.Wallet{walletID: {
+				ID: walletID, EncryptedBalance: "enc_0",
+			}}, nil)
+			d.encSvc.EXPECT().Decrypt("enc_0").Return("0", nil)
+			d.encSvc.EXPECT().Encrypt("70000").Return("enc_70000", nil).Times(2)
+			d.walletRepo.EXPECT().UpdateBalance(ctx, tx, walletID, "enc_70000").Return(nil)
+			d.txRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+			d.txRepo.EXPECT().UpdateStatus(ctx, tx, origTxID, domain.TransactionStatusReversed).Return(nil)
+			d.idempRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+			d.idempCache.EXPECT().Set(ctx, idempKey, gomock.Any(), idempotencyTTL).Return(nil)
+
+			result, err := d.svc.ProcessRefund(ctx, req)
+			require.NoError(t, err)
+			assert.Equal(t, int64(70000), result.Amount)
+			assert.Equal(t, tt.wantRef, result.ReferenceID)
+		})
+	}
+}
+
+func TestPaymentService_ProcessRefund_LargeRefundNotifies(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		threshold int64
+		notified  bool
+	}{
+		{"at threshold", 30000, true},
+		{"below threshold", 30001, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d := setupPaymentService(t)
+			notifier := mocks.NewMockNotificationService(d.ctrl)
+			WithLargeRefundNotifications(notifier, tt.threshold)(d.svc)
+
+			ctx := context.Background()
+			merchantID := uuid.New()
+			walletID := uuid.New()
+			origTxID := uuid.New()
+			tx := &mockTx{}
+			refundAmount := int64(30000)
+			idempKey := domain.BuildRefundIdempotencyKey(merchantID, "ORDER-009")
+
+			d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+			d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+			orig := &domain.Transaction{
+				ID: origTxID, MerchantID: merchantID, WalletID: walletID, Currency: "VND",
+				Amount: 100000, TransactionType: domain.TransactionTypePayment, Status: domain.TransactionStatusSuccess,
+			}
+			d.txRepo.EXPECT().GetByReference(ctx, merchantID, "ORDER-009", false).Return(orig, nil)
+			d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+			d.txRepo.EXPECT().GetByIDForUpdate(ctx, tx, origTxID).Return(orig, nil)
+			d.txRepo.EXPECT().SumRefunds(ctx, origTxID).Return(decimal.NewFromInt(0), nil)
+			d.walletRepo.EXPECT().LockForUpdate(ctx, tx, walletID).Return(map[uuid.UUID]*domain.Wallet{walletID: {
+				ID: walletID, Currency: "VND", EncryptedBalance: "enc_0",
+			}}, nil)
+			d.encSvc.EXPECT().Decrypt("enc_0").Return("0", nil)
+			d.encSvc.EXPECT().Encrypt("30000").Return("enc_30000", nil).Times(2)
+			d.walletRepo.EXPECT().UpdateBalance(ctx, tx, walletID, "enc_30000").Return(nil)
+			d.txRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+			d.idempRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+			d.idempCache.EXPECT().Set(ctx, idempKey, gomock.Any(), idempotencyTTL).Return(nil)
+			if tt.notified {
+				notifier.EXPECT().Notify(ctx, merchantID, domain.NotificationLargeRefund, "A refund of 30000 VND was issued for payment ORDER-009.")
+			}
+
+			_, err := d.svc.ProcessRefund(ctx, ports.RefundRequest{
+				MerchantID: merchantID, OriginalReferenceID: "ORDER-009", Amount: &refundAmount, Reason: "r", Signature: "sig",
+			})
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestPaymentService_ProcessRefund_OriginalNotFound(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+
+	req := ports.RefundRequest{
+		MerchantID:          merchantID,
+		OriginalReferenceID: "NONEXISTENT",
+		Signature:           "sig",
+	}
+
+	idempKey := domain.BuildRefundIdempotencyKey(merchantID, "NONEXISTENT")
+	d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	d.txRepo.EXPECT().GetByReference(ctx, merchantID, "NONEXISTENT", false).Return(nil, nil)
+
+	result, err := d.svc.ProcessRefund(ctx, req)
+	assert.Nil(t, result)
+	assertAppError(t, err, "PAY_004")
+}
+
+func TestPaymentService_ProcessRefund_OriginalWalletMissing_NotFound(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	walletID := uuid.New()
+	origTxID := uuid.New()
+	tx := &mockTx{}
+
+	idempKey := domain.BuildRefundIdempotencyKey(merchantID, "ORDER-003")
+	d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	orig := &domain.Transaction{
+		ID: origTxID, MerchantID: merchantID, WalletID: walletID, Currency: "USD",
+		Amount: 100000, TransactionType: domain.TransactionTypePayment, Status: domain.TransactionStatusSuccess,
+	}
+	d.txRepo.EXPECT().GetByReference(ctx, merchantID, "ORDER-003", false).Return(orig, nil)
+	d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+	d.txRepo.EXPECT().GetByIDForUpdate(ctx, tx, origTxID).Return(orig, nil)
+	d.txRepo.EXPECT().SumRefunds(ctx, origTxID).Return(decimal.Zero, nil)
+	// No wallet is created or credited by default
+	d.walletRepo.EXPECT().LockForUpdate(ctx, tx, walletID).Return(map[uuid.UUID]*domain.Wallet{}, nil)
+
+	result, err := d.svc.ProcessRefund(ctx, ports.RefundRequest{MerchantID: merchantID, OriginalReferenceID: "ORDER-003", Signature: "sig"})
+	assert.Nil(t, result)
+	assertAppError(t, err, "PAY_004")
+	assert.Contains(t, err.Error(), walletID.String())
+}
+
+func TestPaymentService_ProcessRefund_OriginalWalletMissing(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		origCurrency string
+		wantCurrency string
+	}{
+		{"in the payment's currency", "USD", "USD"},
+		// Payments recorded before their currency was are in the default
+		{"without a recorded currency", "", domain.DefaultCurrency},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d := setupPaymentService(t)
+			defer d.ctrl.Finish()
+			WithRefundToCurrencyWallet(true)(d.svc)
+
+			ctx := context.Background()
+			merchantID := uuid.New()
+			walletID := uuid.New()
+			origTxID := uuid.New()
+			tx := &mockTx{}
+
+			req := ports.RefundRequest{MerchantID: merchantID, OriginalReferenceID: "ORDER-003", Signature: "sig"}
+			idempKey := domain.BuildRefundIdempotencyKey(merchantID, "ORDER-003")
+
+			d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+			d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+			orig := &domain.Transaction{
+				ID: origTxID, MerchantID: merchantID, WalletID: walletID, Currency: tt.origCurrency,
+				Amount: 100000, TransactionType: domain.TransactionTypePayment, Status: domain.TransactionStatusSuccess,
+			}
+			d.txRepo.EXPECT().GetByReference(ctx, merchantID, "ORDER-003", false).Return(orig, nil)
+			d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+			d.txRepo.EXPECT().GetByIDForUpdate(ctx, tx, origTxID).Return(orig, nil)
+			d.txRepo.EXPECT().SumRefunds(ctx, origTxID).Return(decimal.NewFromInt(0), nil)
+			d.walletRepo.EXPECT().LockForUpdate(ctx, tx, walletID).Return(map[uuid.UUID]*domain.Wallet{}, nil)
+
+			// A wallet in the payment's currency takes the missing one's place, in the same tx
+			var created *domain.Wallet
+			d.encSvc.EXPECT().Encrypt("0").Return("enc_0", nil)
+			d.walletRepo.EXPECT().GetOrCreateForUpdate(ctx, tx, gomock.Any()).
+				DoAndReturn(func(_ context.Context, _ pgx.Tx, w *domain.Wallet) (*domain.Wallet, error) {
+					created = w
+					return w, nil
+				})
+			d.encSvc.EXPECT().Decrypt("enc_0").Return("0", nil)
+			d.encSvc.EXPECT().Encrypt("100000").Return("enc_100000", nil).Times(2)
+			d.walletRepo.EXPECT().UpdateBalance(ctx, tx, gomock.Any(), "enc_100000").Return(nil)
+			d.txRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+			d.txRepo.EXPECT().UpdateStatus(ctx, tx, origTxID, domain.TransactionStatusReversed).Return(nil)
+			d.idempRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+			d.idempCache.EXPECT().Set(ctx, idempKey, gomock.Any(), idempotencyTTL).Return(nil)
+
+			result, err := d.svc.ProcessRefund(ctx, req)
+			require.NoError(t, err)
+			require.NotNil(t, created)
+			assert.Equal(t, merchantID, created.MerchantID)
+			assert.Equal(t, tt.wantCurrency, created.Currency)
+			assert.Equal(t, created.ID, result.WalletID)
+			assert.Equal(t, tt.wantCurrency, result.Currency)
+			assert.Equal(t, int64(100000), result.Amount)
+		})
+	}
+}
+
+func TestPaymentService_ProcessRefund_OriginalWalletMissing_CreateConflict(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+	WithRefundToCurrencyWallet(true)(d.svc)
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	walletID := uuid.New()
+	origTxID := uuid.New()
+	tx := &mockTx{}
+
+	idempKey := domain.BuildRefundIdempotencyKey(merchantID, "ORDER-004")
+	d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	orig := &domain.Transaction{
+		ID: origTxID, MerchantID: merchantID, WalletID: walletID, Currency: "VND",
+		Amount: 100000, TransactionType: domain.TransactionTypePayment, Status: domain.TransactionStatusSuccess,
+	}
+	d.txRepo.EXPECT().GetByReference(ctx, merchantID, "ORDER-004", false).Return(orig, nil)
+	d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+	d.txRepo.EXPECT().GetByIDForUpdate(ctx, tx, origTxID).Return(orig, nil)
+	d.txRepo.EXPECT().SumRefunds(ctx, origTxID).Return(decimal.NewFromInt(0), nil)
+	d.walletRepo.EXPECT().LockForUpdate(ctx, tx, walletID).Return(map[uuid.UUID]*domain.Wallet{}, nil)
+	d.encSvc.EXPECT().Encrypt("0").Return("enc_0", nil)
+	// Another request created the wallet first; the unique constraint rejects this one
+	d.walletRepo.EXPECT().GetOrCreateForUpdate(ctx, tx, gomock.Any()).
+		Return(nil, fmt.Errorf("%w: merchant %s, currency VND", domain.ErrWalletExists, merchantID))
+
+	result, err := d.svc.ProcessRefund(ctx, ports.RefundRequest{MerchantID: merchantID, OriginalReferenceID: "ORDER-004", Signature: "sig"})
+	assert.Nil(t, result)
+	assertAppError(t, err, "PAY_003")
+}
+
+func TestPaymentService_ProcessRefund_ReasonTooLong(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	// 100 "<" pass the 500-char binding limit but grow to 400 chars once escaped
+	reason := strings.Repeat("&lt;", 100) + strings.Repeat("a", 101)
+	result, err := d.svc.ProcessRefund(context.Background(), ports.RefundRequest{
+		MerchantID:          uuid.New(),
+		OriginalReferenceID: "ORDER-005",
+		Reason:              reason,
+	})
+	assert.Nil(t, result)
+	assertAppError(t, err, "PAY_002")
+}
+
+func TestPaymentService_ProcessRefund_ReasonExceedsExtraDataLimit(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+	WithMaxExtraDataBytes(64)(d.svc)
+
+	// Within the character limit, but too large to store
+	result, err := d.svc.ProcessRefund(context.Background(), ports.RefundRequest{
+		MerchantID:          uuid.New(),
+		OriginalReferenceID: "ORDER-005",
+		Reason:              strings.Repeat("&lt;", 20),
+	})
+	assert.Nil(t, result)
+	assertAppError(t, err, "PAY_002")
+	assert.Contains(t, err.Error(), "reason must be at most 64 bytes")
+}
+
+func TestPaymentService_ProcessRefund_NotRefundable(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+
+	req := ports.RefundRequest{
+		MerchantID:          merchantID,
+		OriginalReferenceID: "ORDER-FAILED",
+		Signature:           "sig",
+	}
+
+	idempKey := domain.BuildRefundIdempotencyKey(merchantID, "ORDER-FAILED")
+	d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	d.txRepo.EXPECT().GetByReference(ctx, merchantID, "ORDER-FAILED", false).Return(&domain.Transaction{
+		ID:              uuid.New(),
+		TransactionType: domain.TransactionTypePayment,
+		Status:          domain.TransactionStatusFailed, // Not SUCCESS
+	}, nil)
+
+	result, err := d.svc.ProcessRefund(ctx, req)
+	assert.Nil(t, result)
+	assertAppError(t, err, "PAY_006")
+}
+
+func TestPaymentService_ProcessRefund_ReversedWhileWaitingForLock(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	origTxID := uuid.New()
+	tx := &mockTx{}
+
+	idempKey := domain.BuildRefundIdempotencyKey(merchantID, "ORDER-RACE")
+	d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	d.txRepo.EXPECT().GetByReference(ctx, merchantID, "ORDER-RACE", false).Return(&domain.Transaction{
+		ID: origTxID, Amount: 50000, TransactionType: domain.TransactionTypePayment, Status: domain.TransactionStatusSuccess,
+	}, nil)
+	d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+	// A concurrent refund or reversal closed the payment before the lock was granted
+	d.txRepo.EXPECT().GetByIDForUpdate(ctx, tx, origTxID).Return(&domain.Transaction{
+		ID: origTxID, Amount: 50000, TransactionType: domain.TransactionTypePayment, Status: domain.TransactionStatusReversed,
+	}, nil)
+
+	result, err := d.svc.ProcessRefund(ctx, ports.RefundRequest{MerchantID: merchantID, OriginalReferenceID: "ORDER-RACE", Signature: "sig"})
+	assert.Nil(t, result)
+	assertAppError(t, err, "PAY_006")
+}
+
+func TestPaymentService_ProcessRefund_ReferenceOfTopupIsCollision(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+
+	idempKey := domain.BuildRefundIdempotencyKey(merchantID, "ORD-1")
+	d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	// No payment uses ORD-1, only a topup
+	d.txRepo.EXPECT().GetByReference(ctx, merchantID, "ORD-1", false).Return(&domain.Transaction{
+		ID:              uuid.New(),
+		ReferenceID:     "ORD-1",
+		TransactionType: domain.TransactionTypeTopup,
+		Status:          domain.TransactionStatusSuccess,
+	}, nil)
+
+	result, err := d.svc.ProcessRefund(ctx, ports.RefundRequest{MerchantID: merchantID, OriginalReferenceID: "ORD-1"})
+	assert.Nil(t, result)
+	assertAppError(t, err, "PAY_008")
+	assert.Contains(t, err.Error(), "used by a TOPUP transaction, not a PAYMENT")
+}
+
+func TestPaymentService_RejectReferenceCollisions(t *testing.T) {
+	t.Run("payment reusing a topup reference", func(t *testing.T) {
+		d := setupPaymentService(t)
+		WithRejectReferenceCollisions(true)(d.svc)
+		ctx := context.Background()
+		merchantID := uuid.New()
+
+		d.idempCache.EXPECT().Get(ctx, gomock.Any()).Return(nil, nil)
+		d.idempRepo.EXPECT().Get(ctx, gomock.Any()).Return(nil, nil)
+		d.txRepo.EXPECT().GetByReference(ctx, merchantID, "ORD-1", false).Return(&domain.Transaction{TransactionType: domain.TransactionTypeTopup}, nil)
+
+		result, err := d.svc.ProcessPayment(ctx, ports.PaymentRequest{MerchantID: merchantID, ReferenceID: "ORD-1", Amount: 50000, Currency: "VND"})
+		assert.Nil(t, result)
+		assertAppError(t, err, "PAY_008")
+	})
+
+	t.Run("topup reusing a payment reference", func(t *testing.T) {
+		d := setupPaymentService(t)
+		WithRejectReferenceCollisions(true)(d.svc)
+		ctx := context.Background()
+		merchantID := uuid.New()
+		ref := "ORD-1"
+
+		d.idempCache.EXPECT().Get(ctx, gomock.Any()).Return(nil, nil)
+		d.idempRepo.EXPECT().Get(ctx, gomock.Any()).Return(nil, nil)
+		// Topups are stored as TOPUP-{reference_id}, so that is what a payment collides with
+		d.txRepo.EXPECT().GetByReference(ctx, merchantID, "TOPUP-"+ref, false).Return(&domain.Transaction{TransactionType: domain.TransactionTypePayment}, nil)
+
+		result, err := d.svc.ProcessTopup(ctx, ports.TopupRequest{MerchantID: merchantID, ReferenceID: &ref, Amount: 50000, Currency: "VND"})
+		assert.Nil(t, result)
+		assertAppError(t, err, "PAY_008")
+	})
+
+	t.Run("off by default", func(t *testing.T) {
+		d := setupPaymentService(t)
+		ctx := context.Background()
+		merchantID := uuid.New()
+
+		// No GetByReference lookup; the payment goes on to the wallet
+		d.idempCache.EXPECT().Get(ctx, gomock.Any()).Return(nil, nil)
+		d.idempRepo.EXPECT().Get(ctx, gomock.Any()).Return(nil, nil)
+		d.transactor.EXPECT().Begin(ctx).Return(&mockTx{}, nil)
+		d.walletRepo.EXPECT().GetByMerchantIDForUpdate(ctx, gomock.Any(), merchantID, "VND").Return(nil, nil)
+
+		_, err := d.svc.ProcessPayment(ctx, ports.PaymentRequest{MerchantID: merchantID, ReferenceID: "ORD-1", Amount: 50000, Currency: "VND"})
+		assertAppError(t, err, "PAY_004")
+	})
+}
+
+func TestPaymentService_ProcessRefund_AmountExceeds(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	origTxID := uuid.New()
+	tx := &mockTx{}
+	over := int64(999999)
+
+	req := ports.RefundRequest{
+		MerchantID:          merchantID,
+		OriginalReferenceID: "ORDER-005",
+		Amount:              &over,
+		Signature:           "sig",
+	}
+
+	idempKey := domain.BuildRefundIdempotencyKey(merchantID, "ORDER-005")
+	d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	orig := &domain.Transaction{
+		ID: origTxID, Amount: 50000, TransactionType: domain.TransactionTypePayment, Status: domain.TransactionStatusSuccess,
+	}
+	d.txRepo.EXPECT().GetByReference(ctx, merchantID, "ORDER-005", false).Return(orig, nil)
+	d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+	d.txRepo.EXPECT().GetByIDForUpdate(ctx, tx, origTxID).Return(orig, nil)
+	d.txRepo.EXPECT().SumRefunds(ctx, origTxID).Return(decimal.NewFromInt(0), nil)
+
+	result, err := d.svc.ProcessRefund(ctx, req)
+	assert.Nil(t, result)
+	assertAppError(t, err, "PAY_007")
+}
+
+func TestPaymentService_ProcessRefund_BoundedByEarlierRefunds(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		refunded int64
+		amount   int64
+		wantCode string
+	}{
+		{"exceeds remaining", 40000, 20000, "PAY_007"},
+		{"fully refunded", 50000, 1, "PAY_003"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d := setupPaymentService(t)
+			defer d.ctrl.Finish()
+
+			ctx := context.Background()
+			merchantID := uuid.New()
+			origTxID := uuid.New()
+			tx := &mockTx{}
+
+			idempKey := domain.BuildRefundIdempotencyKey(merchantID, "ORDER-006")
+			d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+			d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+			orig := &domain.Transaction{
+				ID: origTxID, Amount: 50000, TransactionType: domain.TransactionTypePayment, Status: domain.TransactionStatusSuccess,
+			}
+			d.txRepo.EXPECT().GetByReference(ctx, merchantID, "ORDER-006", false).Return(orig, nil)
+			d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+			d.txRepo.EXPECT().GetByIDForUpdate(ctx, tx, origTxID).Return(orig, nil)
+			d.txRepo.EXPECT().SumRefunds(ctx, origTxID).Return(decimal.NewFromInt(tt.refunded), nil)
+
+			// The amount is within the payment but not what is left of it
+			result, err := d.svc.ProcessRefund(ctx, ports.RefundRequest{
+				MerchantID: merchantID, OriginalReferenceID: "ORDER-006", Amount: &tt.amount, Signature: "sig",
+			})
+			assert.Nil(t, result)
+			assertAppError(t, err, tt.wantCode)
+		})
+	}
+}
+
+func TestPaymentService_ProcessRefund_MaxRefundsPerTransaction(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		count    int64
+		wantCode string
+	}{
+		{"at cap", 3, "PAY_006"},
+		// Below the cap the refund goes on to the amount checks
+		{"below cap", 2, "PAY_007"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d := setupPaymentService(t)
+			defer d.ctrl.Finish()
+			WithMaxRefundsPerTransaction(3)(d.svc)
+
+			ctx := context.Background()
+			merchantID := uuid.New()
+			origTxID := uuid.New()
+			tx := &mockTx{}
+			amount := int64(999999)
+
+			idempKey := domain.BuildRefundIdempotencyKey(merchantID, "ORDER-007")
+			d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+			d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+			orig := &domain.Transaction{
+				ID: origTxID, Amount: 50000, TransactionType: domain.TransactionTypePayment, Status: domain.TransactionStatusSuccess,
+			}
+			d.txRepo.EXPECT().GetByReference(ctx, merchantID, "ORDER-007", false).Return(orig, nil)
+			d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+			d.txRepo.EXPECT().GetByIDForUpdate(ctx, tx, origTxID).Return(orig, nil)
+			d.txRepo.EXPECT().CountRefunds(ctx, origTxID).Return(tt.count, nil)
+			if tt.count < 3 {
+				d.txRepo.EXPECT().SumRefunds(ctx, origTxID).Return(decimal.NewFromInt(0), nil)
+			}
+
+			result, err := d.svc.ProcessRefund(ctx, ports.RefundRequest{
+				MerchantID: merchantID, OriginalReferenceID: "ORDER-007", Amount: &amount, Signature: "sig",
+			})
+			assert.Nil(t, result)
+			assertAppError(t, err, tt.wantCode)
+		})
+	}
+}
+
+// ==================== ReverseTransaction Tests ====================
+
+func TestPaymentService_ReverseTransaction_Success(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	walletID := uuid.New()
+	origTxID := uuid.New()
+	tx := &mockTx{}
+
+	idempKey := domain.BuildReversalIdempotencyKey(merchantID, "ORDER-FRAUD")
+
+	orig := &domain.Transaction{
+		ID: origTxID, ReferenceID: "ORDER-FRAUD", MerchantID: merchantID, WalletID: walletID,
+		Amount: 100000, TransactionType: domain.TransactionTypePayment, Status: domain.TransactionStatusSuccess,
+	}
+	d.txRepo.EXPECT().GetByID(ctx, origTxID).Return(orig, nil)
+	d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+	d.txRepo.EXPECT().GetByIDForUpdate(ctx, tx, origTxID).Return(orig, nil)
+	d.txRepo.EXPECT().SumRefunds(ctx, origTxID).Return(decimal.Zero, nil)
+	d.walletRepo.EXPECT().LockForUpdate(ctx, tx, walletID).Return(map[uuid.UUID]*domain.Wallet{walletID: {
+		ID: walletID, MerchantID: merchantID, EncryptedBalance: "enc_50000", Currency: "VND",
+	}}, nil)
+	d.encSvc.EXPECT().Decrypt("enc_50000").Return("50000", nil)
+	d.encSvc.EXPECT().Encrypt("150000").Return("enc_150000", nil)
+	d.encSvc.EXPECT().Encrypt("100000").Return("enc_reversal_100000", nil)
+	d.walletRepo.EXPECT().UpdateBalance(ctx, tx, walletID, "enc_150000").Return(nil)
+	var created *domain.Transaction
+	d.txRepo.EXPECT().Create(ctx, tx, gomock.Any()).DoAndReturn(func(_ context.Context, _ pgx.Tx, txn *domain.Transaction) error {
+		created = txn
+		return nil
+	})
+	d.txRepo.EXPECT().UpdateStatus(ctx, tx, origTxID, domain.TransactionStatusReversed).Return(nil)
+	d.idempRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+	d.idempCache.EXPECT().Set(ctx, idempKey, gomock.Any(), idempotencyTTL).Return(nil)
+
+	result, err := d.svc.ReverseTransaction(ctx, ports.ReversalRequest{
+		TransactionID: origTxID,
+		Reason:        "Confirmed fraud",
+		ClientIP:      "10.0.0.1",
+		InitiatedBy:   "admin:alice",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, domain.TransactionTypeReversal, result.TransactionType)
+	assert.NotEqual(t, domain.TransactionTypeRefund, result.TransactionType)
+	assert.Equal(t, domain.TransactionStatusSuccess, result.Status)
+	assert.Equal(t, int64(100000), result.Amount)
+	assert.Equal(t, "REVERSAL-ORDER-FRAUD", result.ReferenceID)
+	assert.Equal(t, merchantID, result.MerchantID)
+	assert.Equal(t, &origTxID, result.OriginalTransactionID)
+	assert.Equal(t, "Confirmed fraud", *result.ExtraData)
+	assert.Equal(t, "admin:alice", result.InitiatedBy)
+	assert.Same(t, created, result)
+}
+
+func TestPaymentService_ReverseTransaction_CreditsWhatRefundsLeft(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	walletID := uuid.New()
+	origTxID := uuid.New()
+	tx := &mockTx{}
+	// Too long to prefix within the reference_id column
+	ref := strings.Repeat("R", domain.MaxReferenceIDLength)
+	idempKey := domain.BuildReversalIdempotencyKey(merchantID, ref)
+
+	orig := &domain.Transaction{
+		ID: origTxID, ReferenceID: ref, MerchantID: merchantID, WalletID: walletID,
+		Amount: 100000, TransactionType: domain.TransactionTypePayment, Status: domain.TransactionStatusSuccess,
+	}
+	d.txRepo.EXPECT().GetByID(ctx, origTxID).Return(orig, nil)
+	d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+	d.txRepo.EXPECT().GetByIDForUpdate(ctx, tx, origTxID).Return(orig, nil)
+	// A partial refund already returned 30000 and left the payment SUCCESS
+	d.txRepo.EXPECT().SumRefunds(ctx, origTxID).Return(decimal.NewFromInt(30000), nil)
+	d.walletRepo.EXPECT().LockForUpdate(ctx, tx, walletID).Return(map[uuid.UUID]*domain.Wallet{walletID: {
+		ID: walletID, MerchantID: merchantID, EncryptedBalance: "enc_0", Currency: "VND",
+	}}, nil)
+	d.encSvc.EXPECT().Decrypt("enc_0").Return("0", nil)
+	d.encSvc.EXPECT().Encrypt("70000").Return("enc_70000", nil).Times(2)
+	d.walletRepo.EXPECT().UpdateBalance(ctx, tx, walletID, "enc_70000").Return(nil)
+	d.txRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+	d.txRepo.EXPECT().UpdateStatus(ctx, tx, origTxID, domain.TransactionStatusReversed).Return(nil)
+	d.idempRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+	d.idempCache.EXPECT().Set(ctx, idempKey, gomock.Any(), idempotencyTTL).Return(nil)
+
+	result, err := d.svc.ReverseTransaction(ctx, ports.ReversalRequest{TransactionID: origTxID, Reason: "fraud"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(70000), result.Amount)
+	assert.Equal(t, domain.DerivedReference("REVERSAL-", ref), result.ReferenceID)
+	assert.LessOrEqual(t, len(result.ReferenceID), domain.MaxReferenceIDLength)
+}
+
+func TestPaymentService_ReverseTransaction_RefundedWhileWaitingForLock(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	origTxID := uuid.New()
+	tx := &mockTx{}
+	idempKey := domain.BuildReversalIdempotencyKey(merchantID, "ORDER-RACE")
+
+	d.txRepo.EXPECT().GetByID(ctx, origTxID).Return(&domain.Transaction{
+		ID: origTxID, ReferenceID: "ORDER-RACE", MerchantID: merchantID,
+		Amount: 100000, TransactionType: domain.TransactionTypePayment, Status: domain.TransactionStatusSuccess,
+	}, nil)
+	d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+	// A full refund committed while this reversal waited for the lock
+	d.txRepo.EXPECT().GetByIDForUpdate(ctx, tx, origTxID).Return(&domain.Transaction{
+		ID: origTxID, ReferenceID: "ORDER-RACE", MerchantID: merchantID,
+		Amount: 100000, TransactionType: domain.TransactionTypePayment, Status: domain.TransactionStatusReversed,
+	}, nil)
+
+	result, err := d.svc.ReverseTransaction(ctx, ports.ReversalRequest{TransactionID: origTxID, Reason: "fraud"})
+	assert.Nil(t, result)
+	assertAppError(t, err, "PAY_006")
+}
+
+func TestPaymentService_ReverseTransaction_NotFound(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	ctx := context.Background()
+	id := uuid.New()
+	d.txRepo.EXPECT().GetByID(ctx, id).Return(nil, nil)
+
+	result, err := d.svc.ReverseTransaction(ctx, ports.ReversalRequest{TransactionID: id, Reason: "fraud"})
+	assert.Nil(t, result)
+	assertAppError(t, err, "PAY_004")
+}
+
+func TestPaymentService_ReverseTransaction_NotReversible(t *testing.T) {
+	for _, orig := range []domain.Transaction{
+		{TransactionType: domain.TransactionTypePayment, Status: domain.TransactionStatusReversed},
+		{TransactionType: domain.TransactionTypePayment, Status: domain.TransactionStatusFailed},
+		{TransactionType: domain.TransactionTypeTopup, Status: domain.TransactionStatusSuccess},
+	} {
+		t.Run(string(orig.TransactionType)+"_"+string(orig.Status), func(t *testing.T) {
+			d := setupPaymentService(t)
+			defer d.ctrl.Finish()
+
+			ctx := context.Background()
+			orig.ID = uuid.New()
+			orig.MerchantID = uuid.New()
+			orig.ReferenceID = "ORDER-X"
+			idempKey := domain.BuildReversalIdempotencyKey(orig.MerchantID, "ORDER-X")
+
+			d.txRepo.EXPECT().GetByID(ctx, orig.ID).Return(&orig, nil)
+			d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+			d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+
+			result, err := d.svc.ReverseTransaction(ctx, ports.ReversalRequest{TransactionID: orig.ID, Reason: "fraud"})
+			assert.Nil(t, result)
+			assertAppError(t, err, "PAY_006")
+		})
+	}
+}
+
+func TestPaymentService_ReverseTransaction_ReplaysPreviousReversal(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	origTxID := uuid.New()
+	idempKey := domain.BuildReversalIdempotencyKey(merchantID, "ORDER-FRAUD")
+
+	prev := domain.Transaction{ID: uuid.New(), TransactionType: domain.TransactionTypeReversal, Status: domain.TransactionStatusSuccess}
+	cached, err := json.Marshal(prev)
+	require.NoError(t, err)
+
+	// The original is already REVERSED; the replay must win over the eligibility check
+	d.txRepo.EXPECT().GetByID(ctx, origTxID).Return(&domain.Transaction{
+		ID: origTxID, ReferenceID: "ORDER-FRAUD", MerchantID: merchantID,
+		TransactionType: domain.TransactionTypePayment, Status: domain.TransactionStatusReversed,
+	}, nil)
+	d.idempCache.EXPECT().Get(ctx, idempKey).Return(cached, nil)
+
+	result, err := d.svc.ReverseTransaction(ctx, ports.ReversalRequest{TransactionID: origTxID, Reason: "fraud"})
+	require.NoError(t, err)
+	assert.Equal(t, prev.ID, result.ID)
+	assert.Equal(t, domain.TransactionTypeReversal, result.TransactionType)
+}
+
+// ==================== ProcessTopup Tests ====================
+
+func TestPaymentService_ProcessTopup_Success(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	walletID := uuid.New()
+	tx := &mockTx{}
+
+	req := ports.TopupRequest{
+		MerchantID: merchantID,
+		Amount:     500000,
+		Currency:   "VND",
+	}
+
+	d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+	d.walletRepo.EXPECT().GetByMerchantIDForUpdate(ctx, tx, merchantID, "VND").Return(&domain.Wallet{
+		ID: walletID, MerchantID: merchantID, EncryptedBalance: "enc_100000",
+	}, nil)
+	d.encSvc.EXPECT().Decrypt("enc_100000").Return("100000", nil)
+	d.encSvc.EXPECT().Encrypt("600000").Return("enc_600000", nil) // 100000 + 500000
 	d.encSvc.EXPECT().Encrypt("500000").Return("enc_amount_500000", nil)
 	d.walletRepo.EXPECT().UpdateBalance(ctx, tx, walletID, "enc_600000").Return(nil)
 	d.txRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
@@ -433,9 +1711,46 @@ func TestPaymentService_ProcessTopup_InvalidAmount(t *testing.T) {
 	assertAppError(t, err, "PAY_002")
 }
 
+func TestPaymentService_ProcessTopup_InvalidCurrency(t *testing.T) {
+	// No transaction is begun, so no wallet can be auto-created
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	// "ABC" has the shape of a code but is no ISO 4217 currency
+	for _, currency := range []string{"U$D", "ABC"} {
+		req := ports.TopupRequest{
+			MerchantID: uuid.New(),
+			Amount:     100,
+			Currency:   currency,
+		}
+
+		result, err := d.svc.ProcessTopup(context.Background(), req)
+		assert.Nil(t, result, currency)
+		assertAppError(t, err, "PAY_002")
+	}
+}
+
+func TestPaymentService_ProcessTopup_ReferenceTooLongForPrefix(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	// Fits the column on its own, but not once stored as TOPUP-{reference_id}
+	ref := strings.Repeat("r", domain.MaxReferenceIDLength-len("TOPUP-")+1)
+
+	result, err := d.svc.ProcessTopup(context.Background(), ports.TopupRequest{
+		MerchantID:  uuid.New(),
+		Amount:      100000,
+		Currency:    "VND",
+		ReferenceID: &ref,
+	})
+	assert.Nil(t, result)
+	assertAppError(t, err, "PAY_002")
+}
+
 func TestPaymentService_ProcessTopup_WalletNotFound(t *testing.T) {
 	d := setupPaymentService(t)
 	defer d.ctrl.Finish()
+	WithAutoCreateWallets(false)(d.svc)
 
 	ctx := context.Background()
 	merchantID := uuid.New()
@@ -447,6 +1762,7 @@ func TestPaymentService_ProcessTopup_WalletNotFound(t *testing.T) {
 		Currency:   "USD",
 	}
 
+	// With auto-creation off there is no GetOrCreateForUpdate call
 	d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
 	d.walletRepo.EXPECT().GetByMerchantIDForUpdate(ctx, tx, merchantID, "USD").Return(nil, nil)
 
@@ -455,6 +1771,422 @@ func TestPaymentService_ProcessTopup_WalletNotFound(t *testing.T) {
 	assertAppError(t, err, "PAY_004")
 }
 
+func TestPaymentService_ProcessTopup_AutoCreatesWallet(t *testing.T) {
+	// Auto-creation is on by default
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	tx := &mockTx{}
+
+	var created *domain.Wallet
+	d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+	d.walletRepo.EXPECT().GetByMerchantIDForUpdate(ctx, tx, merchantID, "usd").Return(nil, nil)
+	d.encSvc.EXPECT().Encrypt("0").Return("enc_0", nil)
+	d.walletRepo.EXPECT().GetOrCreateForUpdate(ctx, tx, gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ pgx.Tx, w *domain.Wallet) (*domain.Wallet, error) {
+			created = w
+			return w, nil
+		})
+	d.encSvc.EXPECT().Decrypt("enc_0").Return("0", nil)
+	d.encSvc.EXPECT().Encrypt("100000").Return("enc_100000", nil).Times(2) // new balance and amount
+	d.walletRepo.EXPECT().UpdateBalance(ctx, tx, gomock.Any(), "enc_100000").Return(nil)
+	d.txRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+
+	result, err := d.svc.ProcessTopup(ctx, ports.TopupRequest{MerchantID: merchantID, Amount: 100000, Currency: "usd"})
+	require.NoError(t, err)
+	require.NotNil(t, created)
+	assert.Equal(t, merchantID, created.MerchantID)
+	assert.Equal(t, "USD", created.Currency)
+	assert.Equal(t, "enc_0", created.EncryptedBalance)
+	assert.Equal(t, created.ID, result.WalletID)
+	assert.Equal(t, "USD", result.Currency)
+}
+
+func TestPaymentService_ProcessTopup_AutoCreateConflictIsPAY003(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	tx := &mockTx{}
+
+	d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+	d.walletRepo.EXPECT().GetByMerchantIDForUpdate(ctx, tx, merchantID, "usd").Return(nil, nil)
+	d.encSvc.EXPECT().Encrypt("0").Return("enc_0", nil)
+	d.walletRepo.EXPECT().GetOrCreateForUpdate(ctx, tx, gomock.Any()).
+		Return(nil, fmt.Errorf("%w: merchant %s, currency USD", domain.ErrWalletExists, merchantID))
+
+	_, err := d.svc.ProcessTopup(ctx, ports.TopupRequest{MerchantID: merchantID, Amount: 100000, Currency: "usd"})
+	assertAppError(t, err, "PAY_003")
+}
+
+func TestPaymentService_ProcessTopup_WithReference(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	walletID := uuid.New()
+	tx := &mockTx{}
+	ref := "BANK-TRF-001"
+	idempKey := domain.BuildTopupIdempotencyKey(merchantID, ref)
+
+	d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+	d.walletRepo.EXPECT().GetByMerchantIDForUpdate(ctx, tx, merchantID, "VND").Return(&domain.Wallet{
+		ID: walletID, MerchantID: merchantID, EncryptedBalance: "enc_0",
+	}, nil)
+	d.encSvc.EXPECT().Decrypt("enc_0").Return("0", nil)
+	d.encSvc.EXPECT().Encrypt("100000").Return("enc_100000", nil).Times(2) // balance + amount
+	d.walletRepo.EXPECT().UpdateBalance(ctx, tx, walletID, "enc_100000").Return(nil)
+	d.txRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+	d.idempRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+	d.idempCache.EXPECT().Set(ctx, idempKey, gomock.Any(), idempotencyTTL).Return(nil)
+
+	result, err := d.svc.ProcessTopup(ctx, ports.TopupRequest{
+		MerchantID:  merchantID,
+		Amount:      100000,
+		Currency:    "VND",
+		ReferenceID: &ref,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "TOPUP-"+ref, result.ReferenceID)
+}
+
+func TestPaymentService_ProcessTopup_WithReference_Deduped(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	ref := "BANK-TRF-001"
+	idempKey := domain.BuildTopupIdempotencyKey(merchantID, ref)
+
+	original := &domain.Transaction{
+		ID:              uuid.New(),
+		ReferenceID:     "TOPUP-" + ref,
+		MerchantID:      merchantID,
+		Amount:          100000,
+		TransactionType: domain.TransactionTypeTopup,
+		Status:          domain.TransactionStatusSuccess,
+	}
+	cachedJSON, _ := json.Marshal(original)
+
+	// Retry hits the cache: no DB transaction, no second credit
+	d.idempCache.EXPECT().Get(ctx, idempKey).Return(cachedJSON, nil)
+
+	result, err := d.svc.ProcessTopup(ctx, ports.TopupRequest{
+		MerchantID:  merchantID,
+		Amount:      100000,
+		Currency:    "VND",
+		ReferenceID: &ref,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, original.ID, result.ID)
+}
+
+func TestPaymentService_ProcessTopup_BelowMin(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	minAmount := int64(10000)
+	WithTopupLimits(TopupLimits{Min: &minAmount})(d.svc)
+
+	result, err := d.svc.ProcessTopup(context.Background(), ports.TopupRequest{
+		MerchantID: uuid.New(),
+		Amount:     9999,
+		Currency:   "VND",
+	})
+	assert.Nil(t, result)
+	assertAppError(t, err, "PAY_002")
+}
+
+func TestPaymentService_ProcessTopup_NotMultipleOfIncrement(t *testing.T) {
+	increments := map[string]int64{"vnd": 1000, "CHF": 5, "USD": 1}
+
+	for _, tc := range []struct {
+		currency string
+		amount   int64
+	}{
+		{"VND", 1500},
+		{"VND", 999},
+		{"CHF", 1003},
+		{"chf", 7},
+	} {
+		t.Run(fmt.Sprintf("%s_%d", tc.currency, tc.amount), func(t *testing.T) {
+			d := setupPaymentService(t)
+			defer d.ctrl.Finish()
+			WithTopupIncrements(increments)(d.svc)
+
+			result, err := d.svc.ProcessTopup(context.Background(), ports.TopupRequest{
+				MerchantID: uuid.New(),
+				Amount:     tc.amount,
+				Currency:   tc.currency,
+			})
+			assert.Nil(t, result)
+			assertAppError(t, err, "PAY_002")
+			assert.Contains(t, err.Error(), "multiple of")
+		})
+	}
+}
+
+func TestPaymentService_ProcessTopup_MultipleOfIncrement(t *testing.T) {
+	increments := map[string]int64{"VND": 1000, "CHF": 5, "USD": 1}
+
+	for _, tc := range []struct {
+		currency string
+		amount   int64
+	}{
+		{"VND", 2000},
+		{"CHF", 1005},
+		{"USD", 150}, // increment 1: any amount
+		{"EUR", 333}, // unlisted: any amount
+	} {
+		t.Run(fmt.Sprintf("%s_%d", tc.currency, tc.amount), func(t *testing.T) {
+			d := setupPaymentService(t)
+			defer d.ctrl.Finish()
+			WithTopupIncrements(increments)(d.svc)
+
+			ctx := context.Background()
+			merchantID := uuid.New()
+			walletID := uuid.New()
+			tx := &mockTx{}
+			amount := strconv.FormatInt(tc.amount, 10)
+
+			d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+			d.walletRepo.EXPECT().GetByMerchantIDForUpdate(ctx, tx, merchantID, tc.currency).Return(&domain.Wallet{
+				ID: walletID, MerchantID: merchantID, EncryptedBalance: "enc_0", Currency: tc.currency,
+			}, nil)
+			d.encSvc.EXPECT().Decrypt("enc_0").Return("0", nil)
+			d.encSvc.EXPECT().Encrypt(amount).Return("enc_balance", nil)
+			d.encSvc.EXPECT().Encrypt(amount).Return("enc_amount", nil)
+			d.walletRepo.EXPECT().UpdateBalance(ctx, tx, walletID, "enc_balance").Return(nil)
+			d.txRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+
+			result, err := d.svc.ProcessTopup(ctx, ports.TopupRequest{
+				MerchantID: merchantID,
+				Amount:     tc.amount,
+				Currency:   tc.currency,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tc.amount, result.Amount)
+		})
+	}
+}
+
+func TestPaymentService_ProcessTopup_AboveMax(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	maxAmount := int64(1000000)
+	WithTopupLimits(TopupLimits{Max: &maxAmount})(d.svc)
+
+	result, err := d.svc.ProcessTopup(context.Background(), ports.TopupRequest{
+		MerchantID: uuid.New(),
+		Amount:     1000001,
+		Currency:   "VND",
+	})
+	assert.Nil(t, result)
+	assertAppError(t, err, "PAY_002")
+}
+
+func TestPaymentService_ProcessTopup_DailyCapExceeded(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	dailyCap := int64(1000000)
+	WithTopupLimits(TopupLimits{DailyCap: &dailyCap})(d.svc)
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	walletID := uuid.New()
+	tx := &mockTx{}
+
+	d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+	d.walletRepo.EXPECT().GetByMerchantIDForUpdate(ctx, tx, merchantID, "VND").Return(&domain.Wallet{
+		ID: walletID, MerchantID: merchantID, EncryptedBalance: "enc_100000",
+	}, nil)
+	d.txRepo.EXPECT().SumTopupsSince(ctx, walletID, gomock.Any()).Return(decimal.NewFromInt(800000), nil)
+
+	result, err := d.svc.ProcessTopup(ctx, ports.TopupRequest{
+		MerchantID: merchantID,
+		Amount:     300000, // 800000 + 300000 > 1000000
+		Currency:   "VND",
+	})
+	assert.Nil(t, result)
+	assertAppError(t, err, "PAY_005")
+}
+
+func TestPaymentService_ProcessTopup_WithinDailyCap(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	dailyCap := int64(1000000)
+	WithTopupLimits(TopupLimits{DailyCap: &dailyCap})(d.svc)
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	walletID := uuid.New()
+	tx := &mockTx{}
+
+	d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+	d.walletRepo.EXPECT().GetByMerchantIDForUpdate(ctx, tx, merchantID, "VND").Return(&domain.Wallet{
+		ID: walletID, MerchantID: merchantID, EncryptedBalance: "enc_100000",
+	}, nil)
+	d.txRepo.EXPECT().SumTopupsSince(ctx, walletID, gomock.Any()).Return(decimal.NewFromInt(800000), nil)
+	d.encSvc.EXPECT().Decrypt("enc_100000").Return("100000", nil)
+	d.encSvc.EXPECT().Encrypt("300000").Return("enc_300000", nil)
+	d.encSvc.EXPECT().Encrypt("200000").Return("enc_amount_200000", nil)
+	d.walletRepo.EXPECT().UpdateBalance(ctx, tx, walletID, "enc_300000").Return(nil)
+	d.txRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+
+	result, err := d.svc.ProcessTopup(ctx, ports.TopupRequest{
+		MerchantID: merchantID,
+		Amount:     200000, // exactly reaches the cap
+		Currency:   "VND",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(200000), result.Amount)
+}
+
+func TestPaymentService_ProcessPayment_DailyTransactionLimitReached(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	limit := int64(100)
+	WithDailyTransactionLimit(&limit)(d.svc)
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	tx := &mockTx{}
+	idempKey := domain.BuildIdempotencyKey(merchantID, "ORDER-101")
+
+	d.idempCache.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	d.idempRepo.EXPECT().Get(ctx, idempKey).Return(nil, nil)
+	d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+	d.txRepo.EXPECT().CountTodayForUpdate(ctx, tx, merchantID).Return(int64(100), nil) // already at the limit
+
+	result, err := d.svc.ProcessPayment(ctx, ports.PaymentRequest{
+		MerchantID:  merchantID,
+		ReferenceID: "ORDER-101",
+		Amount:      50000,
+		Currency:    "VND",
+	})
+	assert.Nil(t, result)
+	assertAppError(t, err, "PAY_005")
+}
+
+func TestPaymentService_ProcessPayment_DailyTransactionLimitOverCount(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	// e.g. the limit was lowered mid-day
+	limit := int64(100)
+	WithDailyTransactionLimit(&limit)(d.svc)
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	tx := &mockTx{}
+
+	d.idempCache.EXPECT().Get(ctx, gomock.Any()).Return(nil, nil)
+	d.idempRepo.EXPECT().Get(ctx, gomock.Any()).Return(nil, nil)
+	d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+	d.txRepo.EXPECT().CountTodayForUpdate(ctx, tx, merchantID).Return(int64(150), nil)
+
+	result, err := d.svc.ProcessPayment(ctx, ports.PaymentRequest{
+		MerchantID:  merchantID,
+		ReferenceID: "ORDER-151",
+		Amount:      50000,
+		Currency:    "VND",
+	})
+	assert.Nil(t, result)
+	assertAppError(t, err, "PAY_005")
+}
+
+func TestPaymentService_ProcessPayment_WithinDailyTransactionLimit(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+
+	limit := int64(100)
+	WithDailyTransactionLimit(&limit)(d.svc)
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	walletID := uuid.New()
+	tx := &mockTx{}
+
+	d.idempCache.EXPECT().Get(ctx, gomock.Any()).Return(nil, nil)
+	d.idempRepo.EXPECT().Get(ctx, gomock.Any()).Return(nil, nil)
+	d.transactor.EXPECT().Begin(ctx).Return(tx, nil)
+	d.txRepo.EXPECT().CountTodayForUpdate(ctx, tx, merchantID).Return(int64(99), nil) // this payment is the 100th
+	d.walletRepo.EXPECT().GetByMerchantIDForUpdate(ctx, tx, merchantID, "VND").Return(&domain.Wallet{
+		ID: walletID, MerchantID: merchantID, Currency: "VND", EncryptedBalance: "enc_100000",
+	}, nil)
+	d.encSvc.EXPECT().Decrypt("enc_100000").Return("100000", nil)
+	d.encSvc.EXPECT().Encrypt("50000").Return("enc_50000", nil).Times(2)
+	d.walletRepo.EXPECT().UpdateBalance(ctx, tx, walletID, "enc_50000").Return(nil)
+	d.txRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+	d.idempRepo.EXPECT().Create(ctx, tx, gomock.Any()).Return(nil)
+	d.idempCache.EXPECT().Set(ctx, gomock.Any(), gomock.Any(), idempotencyTTL).Return(nil).Times(2)
+
+	result, err := d.svc.ProcessPayment(ctx, ports.PaymentRequest{
+		MerchantID:  merchantID,
+		ReferenceID: "ORDER-100",
+		Amount:      50000,
+		Currency:    "VND",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(50000), result.Amount)
+}
+
+func TestPaymentService_ProcessPayment_ConcurrencyLimitIsPerMerchant(t *testing.T) {
+	d := setupPaymentService(t)
+	defer d.ctrl.Finish()
+	WithMaxConcurrentPayments(1)(d.svc)
+
+	ctx := context.Background()
+	busy, other := uuid.New(), uuid.New()
+	entered, unblock := make(chan struct{}), make(chan struct{})
+
+	// The first payment holds busy's only slot until unblocked
+	d.idempCache.EXPECT().Get(gomock.Any(), domain.BuildIdempotencyKey(busy, "ORDER-1")).DoAndReturn(
+		func(context.Context, string) ([]byte, error) {
+			close(entered)
+			<-unblock
+			return nil, nil
+		})
+	d.idempRepo.EXPECT().Get(gomock.Any(), domain.BuildIdempotencyKey(busy, "ORDER-1")).Return(nil, errors.New("db down"))
+
+	done := make(chan error)
+	go func() {
+		_, err := d.svc.ProcessPayment(ctx, ports.PaymentRequest{MerchantID: busy, ReferenceID: "ORDER-1", Amount: 1000, Currency: "VND"})
+		done <- err
+	}()
+	<-entered
+
+	// A second payment from the same merchant is rejected without touching storage
+	_, err := d.svc.ProcessPayment(ctx, ports.PaymentRequest{MerchantID: busy, ReferenceID: "ORDER-2", Amount: 1000, Currency: "VND"})
+	assertAppError(t, err, "SYS_002")
+
+	// Other merchants are unaffected (the payment gets past the limiter to storage)
+	d.idempCache.EXPECT().Get(gomock.Any(), domain.BuildIdempotencyKey(other, "ORDER-1")).Return(nil, nil)
+	d.idempRepo.EXPECT().Get(gomock.Any(), domain.BuildIdempotencyKey(other, "ORDER-1")).Return(nil, errors.New("db down"))
+	_, err = d.svc.ProcessPayment(ctx, ports.PaymentRequest{MerchantID: other, ReferenceID: "ORDER-1", Amount: 1000, Currency: "VND"})
+	assertAppError(t, err, "SYS_001")
+
+	close(unblock)
+	assertAppError(t, <-done, "SYS_001")
+
+	// The slot is released once the first payment returns
+	d.idempCache.EXPECT().Get(gomock.Any(), domain.BuildIdempotencyKey(busy, "ORDER-3")).Return(nil, nil)
+	d.idempRepo.EXPECT().Get(gomock.Any(), domain.BuildIdempotencyKey(busy, "ORDER-3")).Return(nil, errors.New("db down"))
+	_, err = d.svc.ProcessPayment(ctx, ports.PaymentRequest{MerchantID: busy, ReferenceID: "ORDER-3", Amount: 1000, Currency: "VND"})
+	assertAppError(t, err, "SYS_001")
+}
+
 // ==================== Helper ====================
 
 func assertAppError(t *testing.T, err error, expectedCode string) {
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"secure-payment-gateway/internal/core/ports"
+	"secure-payment-gateway/pkg/apperror"
+
+	"github.com/google/uuid"
+)
+
+// receiptService implements ports.ReceiptService.
+type receiptService struct {
+	txRepo       ports.TransactionRepository
+	walletRepo   ports.WalletRepository
+	merchantRepo ports.MerchantRepository
+	signer       ports.ReceiptSigner
+}
+
+// NewReceiptService creates a new receipt service.
+func NewReceiptService(
+	txRepo ports.TransactionRepository,
+	walletRepo ports.WalletRepository,
+	merchantRepo ports.MerchantRepository,
+	signer ports.ReceiptSigner,
+) ports.ReceiptService {
+	return &receiptService{
+		txRepo:       txRepo,
+		walletRepo:   walletRepo,
+		merchantRepo: merchantRepo,
+		signer:       signer,
+	}
+}
+
+// GetReceipt builds and signs the receipt for a transaction owned by merchantID.
+// Transactions of other merchants are reported as not found.
+func (s *receiptService) GetReceipt(ctx context.Context, merchantID, transactionID uuid.UUID) (*ports.SignedReceipt, error) {
+	txn, err := s.txRepo.GetByID(ctx, transactionID)
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("get transaction: %w", err))
+	}
+	if txn == nil || txn.MerchantID != merchantID {
+		return nil, apperror.ErrNotFound("transaction")
+	}
+
+	merchant, err := s.merchantRepo.GetByID(ctx, merchantID)
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("get merchant: %w", err))
+	}
+	if merchant == nil {
+		return nil, apperror.ErrNotFound("merchant")
+	}
+
+	wallet, err := s.walletRepo.GetByID(ctx, txn.WalletID)
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("get wallet: %w", err))
+	}
+	if wallet == nil {
+		return nil, apperror.ErrNotFound("wallet")
+	}
+
+	receipt := ports.Receipt{
+		TransactionID:   txn.ID.String(),
+		ReferenceID:     txn.ReferenceID,
+		MerchantID:      merchant.ID.String(),
+		MerchantName:    merchant.MerchantName,
+		TransactionType: string(txn.TransactionType),
+		Status:          string(txn.Status),
+		Amount:          json.Number(txn.ExactAmount().String()),
+		Currency:        wallet.Currency,
+		CreatedAt:       txn.CreatedAt.UTC().Format(time.RFC3339),
+		IssuedAt:        time.Now().UTC().Format(time.RFC3339),
+	}
+	if txn.OriginalTransactionID != nil {
+		orig := txn.OriginalTransactionID.String()
+		receipt.OriginalTransactionID = &orig
+	}
+	if txn.HasProcessedAt() {
+		processed := txn.ProcessedAt.UTC().Format(time.RFC3339)
+		receipt.ProcessedAt = &processed
+	}
+
+	canonical, err := json.Marshal(receipt)
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("marshal receipt: %w", err))
+	}
+
+	return &ports.SignedReceipt{
+		Receipt:   receipt,
+		Algorithm: s.signer.Algorithm(),
+		Signature: s.signer.Sign(canonical),
+	}, nil
+}
+
+// PublicKey returns the algorithm and public key receipts can be verified with.
+func (s *receiptService) PublicKey() (string, string) {
+	return s.signer.Algorithm(), s.signer.PublicKey()
+}
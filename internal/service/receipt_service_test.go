@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"secure-payment-gateway/internal/core/domain"
+	"secure-payment-gateway/internal/core/ports"
+	"secure-payment-gateway/internal/core/ports/mocks"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+const testReceiptSeed = "9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60"
+
+// verifyReceipt checks a receipt the way an external verifier would: using only
+// the published public key and the compact JSON encoding of the receipt.
+func verifyReceipt(t *testing.T, publicKeyB64 string, receipt ports.Receipt, signatureB64 string) bool {
+	t.Helper()
+	pub, err := base64.StdEncoding.DecodeString(publicKeyB64)
+	require.NoError(t, err)
+	sig, err := base64.StdEncoding.DecodeString(signatureB64)
+	require.NoError(t, err)
+	msg, err := json.Marshal(receipt)
+	require.NoError(t, err)
+	return ed25519.Verify(ed25519.PublicKey(pub), msg, sig)
+}
+
+func setupReceiptService(t *testing.T) (ports.ReceiptService, *mocks.MockTransactionRepository, *mocks.MockWalletRepository, *mocks.MockMerchantRepository) {
+	t.Helper()
+	ctrl := gomock.NewController(t)
+	signer, err := NewEd25519ReceiptSigner(testReceiptSeed)
+	require.NoError(t, err)
+
+	txRepo := mocks.NewMockTransactionRepository(ctrl)
+	walletRepo := mocks.NewMockWalletRepository(ctrl)
+	merchantRepo := mocks.NewMockMerchantRepository(ctrl)
+	return NewReceiptService(txRepo, walletRepo, merchantRepo, signer), txRepo, walletRepo, merchantRepo
+}
+
+func TestReceiptService_GetReceipt_VerifiesAndDetectsTampering(t *testing.T) {
+	svc, txRepo, walletRepo, merchantRepo := setupReceiptService(t)
+
+	merchantID := uuid.New()
+	walletID := uuid.New()
+	now := time.Now()
+	txn := &domain.Transaction{
+		ID:              uuid.New(),
+		ReferenceID:     "ORDER-001",
+		MerchantID:      merchantID,
+		WalletID:        walletID,
+		Amount:          50000,
+		TransactionType: domain.TransactionTypePayment,
+		Status:          domain.TransactionStatusSuccess,
+		CreatedAt:       now,
+		ProcessedAt:     &now,
+	}
+
+	txRepo.EXPECT().GetByID(gomock.Any(), txn.ID).Return(txn, nil)
+	merchantRepo.EXPECT().GetByID(gomock.Any(), merchantID).Return(&domain.Merchant{ID: merchantID, MerchantName: "Test Shop"}, nil)
+	walletRepo.EXPECT().GetByID(gomock.Any(), walletID).Return(&domain.Wallet{ID: walletID, Currency: "VND"}, nil)
+
+	signed, err := svc.GetReceipt(context.Background(), merchantID, txn.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Ed25519", signed.Algorithm)
+	assert.Equal(t, txn.ID.String(), signed.Receipt.TransactionID)
+	assert.Equal(t, json.Number("50000"), signed.Receipt.Amount)
+	assert.Equal(t, "VND", signed.Receipt.Currency)
+	assert.Equal(t, "Test Shop", signed.Receipt.MerchantName)
+
+	_, publicKey := svc.PublicKey()
+	assert.True(t, verifyReceipt(t, publicKey, signed.Receipt, signed.Signature))
+
+	tampered := signed.Receipt
+	tampered.Amount = "5000000"
+	assert.False(t, verifyReceipt(t, publicKey, tampered, signed.Signature))
+}
+
+func TestReceiptService_GetReceipt_OtherMerchant(t *testing.T) {
+	svc, txRepo, _, _ := setupReceiptService(t)
+
+	txn := &domain.Transaction{ID: uuid.New(), MerchantID: uuid.New()}
+	txRepo.EXPECT().GetByID(gomock.Any(), txn.ID).Return(txn, nil)
+
+	result, err := svc.GetReceipt(context.Background(), uuid.New(), txn.ID)
+	assert.Nil(t, result)
+	assertAppError(t, err, "PAY_004")
+}
+
+func TestReceiptService_GetReceipt_NotFound(t *testing.T) {
+	svc, txRepo, _, _ := setupReceiptService(t)
+
+	txRepo.EXPECT().GetByID(gomock.Any(), gomock.Any()).Return(nil, nil)
+
+	result, err := svc.GetReceipt(context.Background(), uuid.New(), uuid.New())
+	assert.Nil(t, result)
+	assertAppError(t, err, "PAY_004")
+}
+
+func TestEd25519ReceiptSigner_InvalidKey(t *testing.T) {
+	_, err := NewEd25519ReceiptSigner("not-hex")
+	assert.Error(t, err)
+
+	_, err = NewEd25519ReceiptSigner(strings.Repeat("ab", 16)) // 16 bytes, too short
+	assert.Error(t, err)
+}
+
+func TestEd25519ReceiptSigner_SignAndVerify(t *testing.T) {
+	signer, err := NewEd25519ReceiptSigner(testReceiptSeed)
+	require.NoError(t, err)
+
+	sig := signer.Sign([]byte("receipt"))
+	assert.True(t, signer.Verify([]byte("receipt"), sig))
+	assert.False(t, signer.Verify([]byte("receipt!"), sig))
+	assert.False(t, signer.Verify([]byte("receipt"), "%%%not-base64"))
+}
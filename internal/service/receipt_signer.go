@@ -0,0 +1,57 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// Ed25519ReceiptSigner implements ports.ReceiptSigner with an Ed25519 key pair.
+// Unlike HMAC, anyone holding the public key can verify a receipt.
+type Ed25519ReceiptSigner struct {
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+}
+
+// NewEd25519ReceiptSigner creates a signer from a 32-byte hex-encoded seed.
+func NewEd25519ReceiptSigner(seedHex string) (*Ed25519ReceiptSigner, error) {
+	seed, err := hex.DecodeString(seedHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex signing key: %w", err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("signing key must be %d bytes (%d hex chars), got %d bytes",
+			ed25519.SeedSize, ed25519.SeedSize*2, len(seed))
+	}
+
+	privateKey := ed25519.NewKeyFromSeed(seed)
+	return &Ed25519ReceiptSigner{
+		privateKey: privateKey,
+		publicKey:  privateKey.Public().(ed25519.PublicKey),
+	}, nil
+}
+
+// Algorithm returns the signature algorithm name.
+func (s *Ed25519ReceiptSigner) Algorithm() string {
+	return "Ed25519"
+}
+
+// Sign returns the base64 (std) signature of message.
+func (s *Ed25519ReceiptSigner) Sign(message []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(s.privateKey, message))
+}
+
+// Verify checks a base64 signature produced by Sign.
+func (s *Ed25519ReceiptSigner) Verify(message []byte, signature string) bool {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(s.publicKey, message, sig)
+}
+
+// PublicKey returns the base64 (std) encoded public key.
+func (s *Ed25519ReceiptSigner) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(s.publicKey)
+}
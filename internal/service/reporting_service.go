@@ -3,6 +3,7 @@ package service
 import (
 "context"
 "fmt"
+"strings"
 "time"
 
 "secure-payment-gateway/internal/core/domain"
@@ -10,13 +11,53 @@ import (
 "secure-payment-gateway/pkg/apperror"
 
 "github.com/google/uuid"
+"github.com/rs/zerolog"
+"github.com/shopspring/decimal"
 )
 
+// ExportLimits bounds transaction exports.
+type ExportLimits struct {
+MaxRows          int // Hard cap on rows in a single export
+UnboundedMaxRows int // Largest export allowed without both from and to
+}
+
+// DefaultExportLimits is used unless overridden with WithExportLimits.
+var DefaultExportLimits = ExportLimits{MaxRows: 10000, UnboundedMaxRows: 1000}
+
+// ReportingOption configures optional reportingService behaviour.
+type ReportingOption func(*reportingService)
+
+// WithExportLimits overrides DefaultExportLimits.
+func WithExportLimits(limits ExportLimits) ReportingOption {
+return func(s *reportingService) {
+s.exportLimits = limits
+}
+}
+
+// WithReportingLogger sets the logger used for integrity alerts. Defaults to a no-op logger.
+func WithReportingLogger(log zerolog.Logger) ReportingOption {
+return func(s *reportingService) {
+s.log = log
+}
+}
+
+// WithPrimaryCurrencies makes balance queries without a currency use each
+// merchant's primary currency, read from merchantRepo. Without it they use
+// domain.DefaultCurrency.
+func WithPrimaryCurrencies(merchantRepo ports.MerchantRepository) ReportingOption {
+return func(s *reportingService) {
+s.merchantRepo = merchantRepo
+}
+}
+
 // reportingService implements ports.ReportingService.
 type reportingService struct {
-txRepo     ports.TransactionRepository
-walletRepo ports.WalletRepository
-encSvc     ports.EncryptionService
+txRepo       ports.TransactionRepository
+walletRepo   ports.WalletRepository
+encSvc       ports.EncryptionService
+merchantRepo ports.MerchantRepository // nil = every primary currency is domain.DefaultCurrency
+exportLimits ExportLimits
+log          zerolog.Logger
 }
 
 // NewReportingService creates a new reporting service.
@@ -24,12 +65,19 @@ func NewReportingService(
 txRepo ports.TransactionRepository,
 walletRepo ports.WalletRepository,
 encSvc ports.EncryptionService,
+opts ...ReportingOption,
 ) ports.ReportingService {
-return &reportingService{
-txRepo:     txRepo,
-walletRepo: walletRepo,
-encSvc:     encSvc,
+s := &reportingService{
+txRepo:       txRepo,
+walletRepo:   walletRepo,
+encSvc:       encSvc,
+exportLimits: DefaultExportLimits,
+log:          zerolog.Nop(),
 }
+for _, opt := range opts {
+opt(s)
+}
+return s
 }
 
 // GetDashboardStats returns aggregated transaction stats for the merchant.
@@ -37,6 +85,10 @@ func (s *reportingService) GetDashboardStats(ctx context.Context, merchantID uui
 var periodStart *int64
 
 switch period {
+case "today":
+now := time.Now().UTC()
+t := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).Unix()
+periodStart = &t
 case "day":
 t := time.Now().AddDate(0, 0, -1).Unix()
 periodStart = &t
@@ -49,7 +101,7 @@ periodStart = &t
 case "all", "":
 // No time filter
 default:
-return nil, apperror.Validation("invalid period: must be day, week, month, or all")
+return nil, apperror.Validation("invalid period: must be today, day, week, month, or all")
 }
 
 stats, err := s.txRepo.GetStats(ctx, merchantID, periodStart)
@@ -69,26 +121,151 @@ return nil, 0, apperror.InternalError(err)
 return txns, total, nil
 }
 
-// GetWalletBalance decrypts and returns the current balance for the merchant VND wallet.
-func (s *reportingService) GetWalletBalance(ctx context.Context, merchantID uuid.UUID) (int64, string, error) {
-wallet, err := s.walletRepo.GetByMerchantID(ctx, merchantID, "VND")
+// GetTransaction returns a single transaction owned by merchantID.
+func (s *reportingService) GetTransaction(ctx context.Context, merchantID, transactionID uuid.UUID) (*domain.Transaction, error) {
+txn, err := s.txRepo.GetByID(ctx, transactionID)
 if err != nil {
-return 0, "", apperror.InternalError(err)
+return nil, apperror.InternalError(err)
 }
-if wallet == nil {
-return 0, "", apperror.ErrNotFound("wallet")
+if txn == nil || txn.MerchantID != merchantID {
+return nil, apperror.ErrNotFound("transaction")
+}
+return txn, nil
 }
 
-balanceStr, err := s.encSvc.Decrypt(wallet.EncryptedBalance)
+// ExportTransactions returns every transaction matching params, within the export limits.
+// Large exports must be bounded by both From and To so they can't dump the whole history.
+func (s *reportingService) ExportTransactions(ctx context.Context, params ports.TransactionListParams) ([]domain.Transaction, error) {
+// Count first so oversized exports are rejected before any rows are loaded
+params.Page, params.PageSize = 1, 1
+_, total, err := s.txRepo.List(ctx, params)
 if err != nil {
-return 0, "", apperror.InternalError(err)
+return nil, apperror.InternalError(err)
 }
 
-var balance int64
-_, err = fmt.Sscanf(balanceStr, "%d", &balance)
+bounded := params.From != nil && params.To != nil
+if !bounded && total > int64(s.exportLimits.UnboundedMaxRows) {
+return nil, apperror.Validation(fmt.Sprintf(
+"export matches %d transactions: both from and to are required above %d rows",
+total, s.exportLimits.UnboundedMaxRows))
+}
+if total > int64(s.exportLimits.MaxRows) {
+return nil, apperror.Validation(fmt.Sprintf(
+"export matches %d transactions, exceeding the maximum of %d: narrow the date range",
+total, s.exportLimits.MaxRows))
+}
+if total == 0 {
+return []domain.Transaction{}, nil
+}
+
+params.PageSize = int(total)
+txns, _, err := s.txRepo.List(ctx, params)
 if err != nil {
-return 0, "", apperror.InternalError(err)
+return nil, apperror.InternalError(err)
+}
+return txns, nil
+}
+
+// GetWalletBalance decrypts and returns the current balance of the merchant's
+// wallet in currency, or in its primary currency if currency is "". Naming a
+// currency the merchant holds no wallet in is a validation error; a missing
+// primary wallet is PAY_004.
+func (s *reportingService) GetWalletBalance(ctx context.Context, merchantID uuid.UUID, currency string) (decimal.Decimal, string, error) {
+requested := currency != ""
+if requested {
+currency = strings.ToUpper(currency)
+} else {
+primary, err := s.primaryCurrency(ctx, merchantID)
+if err != nil {
+return decimal.Zero, "", err
+}
+currency = primary
+}
+
+wallet, err := s.walletRepo.GetByMerchantID(ctx, merchantID, currency)
+if err != nil {
+return decimal.Zero, "", apperror.InternalError(err)
+}
+if wallet == nil {
+if requested {
+return decimal.Zero, "", apperror.Validation(fmt.Sprintf("no %s wallet", currency))
+}
+return decimal.Zero, "", apperror.ErrNotFound("wallet")
+}
+
+balance, err := decryptBalance(s.encSvc, wallet, s.log)
+if err != nil {
+return decimal.Zero, "", err
 }
 
 return balance, wallet.Currency, nil
 }
+
+// ListWalletBalances returns the balance of each of the merchant's wallets,
+// ordered by currency. A merchant without wallets gets an empty list.
+func (s *reportingService) ListWalletBalances(ctx context.Context, merchantID uuid.UUID) ([]ports.WalletBalance, error) {
+wallets, err := s.walletRepo.ListByMerchantID(ctx, merchantID)
+if err != nil {
+return nil, apperror.InternalError(err)
+}
+
+balances := make([]ports.WalletBalance, 0, len(wallets))
+for i := range wallets {
+balance, err := decryptBalance(s.encSvc, &wallets[i], s.log)
+if err != nil {
+return nil, err
+}
+balances = append(balances, ports.WalletBalance{Currency: wallets[i].Currency, Balance: balance})
+}
+return balances, nil
+}
+
+// primaryCurrency returns the merchant's primary currency.
+func (s *reportingService) primaryCurrency(ctx context.Context, merchantID uuid.UUID) (string, error) {
+if s.merchantRepo == nil {
+return domain.DefaultCurrency, nil
+}
+merchant, err := s.merchantRepo.GetByID(ctx, merchantID)
+if err != nil {
+return "", apperror.InternalError(err)
+}
+if merchant == nil {
+return "", apperror.ErrNotFound("merchant")
+}
+return merchant.Currency(), nil
+}
+
+// PreviewBalance projects the merchant's balance in currency through deltas
+// (minor units, negative = debit), applied in order. The wallet is read
+// without a lock and nothing is written. A delta that would take the
+// balance below zero fails with PAY_001, as the real debit would.
+func (s *reportingService) PreviewBalance(ctx context.Context, merchantID uuid.UUID, currency string, deltas []int64) (*ports.BalancePreview, error) {
+wallet, err := s.walletRepo.GetByMerchantID(ctx, merchantID, strings.ToUpper(currency))
+if err != nil {
+return nil, apperror.InternalError(err)
+}
+if wallet == nil {
+return nil, apperror.ErrNotFound("wallet")
+}
+
+balance, err := decryptBalance(s.encSvc, wallet, s.log)
+if err != nil {
+return nil, err
+}
+
+preview := &ports.BalancePreview{
+Currency: wallet.Currency,
+Balance:  balance,
+Steps:    make([]decimal.Decimal, 0, len(deltas)),
+}
+projected := balance
+for _, delta := range deltas {
+projected = projected.Add(decimal.NewFromInt(delta))
+if projected.IsNegative() {
+return nil, apperror.ErrInsufficientFunds()
+}
+preview.Steps = append(preview.Steps, projected)
+}
+preview.Projected = projected
+return preview, nil
+}
@@ -1,9 +1,11 @@
 package service
 
 import (
+"bytes"
 "context"
 "errors"
 "testing"
+"time"
 
 "secure-payment-gateway/internal/core/domain"
 "secure-payment-gateway/internal/core/ports"
@@ -11,6 +13,8 @@ import (
 "secure-payment-gateway/pkg/apperror"
 
 "github.com/google/uuid"
+"github.com/rs/zerolog"
+"github.com/shopspring/decimal"
 "github.com/stretchr/testify/assert"
 "github.com/stretchr/testify/require"
 "go.uber.org/mock/gomock"
@@ -32,9 +36,9 @@ TotalTransactions: 100,
 Successful:        80,
 Failed:            15,
 Reversed:          5,
-TotalRevenue:      5000000,
-TotalRefunded:     200000,
-TotalTopup:        1000000,
+TotalRevenue:      decimal.NewFromInt(5000000),
+TotalRefunded:     decimal.NewFromInt(200000),
+TotalTopup:        decimal.NewFromInt(1000000),
 }
 
 mockTxRepo.EXPECT().GetStats(gomock.Any(), merchantID, (*int64)(nil)).Return(expected, nil)
@@ -65,6 +69,32 @@ require.NoError(t, err)
 assert.Equal(t, int64(10), result.TotalTransactions)
 }
 
+func TestReportingService_GetDashboardStats_Today(t *testing.T) {
+ctrl := gomock.NewController(t)
+defer ctrl.Finish()
+
+mockTxRepo := mocks.NewMockTransactionRepository(ctrl)
+mockWalletRepo := mocks.NewMockWalletRepository(ctrl)
+mockEncSvc := mocks.NewMockEncryptionService(ctrl)
+
+svc := NewReportingService(mockTxRepo, mockWalletRepo, mockEncSvc)
+
+merchantID := uuid.New()
+now := time.Now().UTC()
+midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).Unix()
+
+mockTxRepo.EXPECT().GetStats(gomock.Any(), merchantID, gomock.Any()).
+DoAndReturn(func(_ context.Context, _ uuid.UUID, periodStart *int64) (*ports.TransactionStats, error) {
+require.NotNil(t, periodStart)
+assert.Equal(t, midnight, *periodStart)
+return &ports.TransactionStats{TotalTransactions: 3}, nil
+})
+
+result, err := svc.GetDashboardStats(context.Background(), merchantID, "today")
+require.NoError(t, err)
+assert.Equal(t, int64(3), result.TotalTransactions)
+}
+
 func TestReportingService_GetDashboardStats_InvalidPeriod(t *testing.T) {
 ctrl := gomock.NewController(t)
 defer ctrl.Finish()
@@ -129,6 +159,28 @@ _, _, err := svc.ListTransactions(context.Background(), params)
 require.Error(t, err)
 }
 
+func TestReportingService_GetTransaction_ScopedToMerchant(t *testing.T) {
+ctrl := gomock.NewController(t)
+defer ctrl.Finish()
+
+mockTxRepo := mocks.NewMockTransactionRepository(ctrl)
+svc := NewReportingService(mockTxRepo, mocks.NewMockWalletRepository(ctrl), mocks.NewMockEncryptionService(ctrl))
+
+merchantID := uuid.New()
+txn := &domain.Transaction{ID: uuid.New(), MerchantID: merchantID}
+mockTxRepo.EXPECT().GetByID(gomock.Any(), txn.ID).Return(txn, nil).Times(2)
+
+got, err := svc.GetTransaction(context.Background(), merchantID, txn.ID)
+require.NoError(t, err)
+assert.Equal(t, txn, got)
+
+// Another merchant's transaction is indistinguishable from a missing one
+_, err = svc.GetTransaction(context.Background(), uuid.New(), txn.ID)
+var appErr *apperror.AppError
+require.True(t, errors.As(err, &appErr))
+assert.Equal(t, 404, appErr.HTTPStatus)
+}
+
 func TestReportingService_GetWalletBalance_Success(t *testing.T) {
 ctrl := gomock.NewController(t)
 defer ctrl.Finish()
@@ -148,12 +200,38 @@ EncryptedBalance: "encrypted-100000",
 }, nil)
 mockEncSvc.EXPECT().Decrypt("encrypted-100000").Return("100000", nil)
 
-balance, currency, err := svc.GetWalletBalance(context.Background(), merchantID)
+balance, currency, err := svc.GetWalletBalance(context.Background(), merchantID, "")
 require.NoError(t, err)
-assert.Equal(t, int64(100000), balance)
+assert.Equal(t, "100000", balance.String())
 assert.Equal(t, "VND", currency)
 }
 
+func TestReportingService_ListWalletBalances(t *testing.T) {
+ctrl := gomock.NewController(t)
+defer ctrl.Finish()
+
+mockWalletRepo := mocks.NewMockWalletRepository(ctrl)
+mockEncSvc := mocks.NewMockEncryptionService(ctrl)
+
+svc := NewReportingService(nil, mockWalletRepo, mockEncSvc)
+
+merchantID := uuid.New()
+mockWalletRepo.EXPECT().ListByMerchantID(gomock.Any(), merchantID).Return([]domain.Wallet{
+{ID: uuid.New(), MerchantID: merchantID, Currency: "USD", EncryptedBalance: "encrypted-25"},
+{ID: uuid.New(), MerchantID: merchantID, Currency: "VND", EncryptedBalance: "encrypted-100000"},
+}, nil)
+mockEncSvc.EXPECT().Decrypt("encrypted-25").Return("25", nil)
+mockEncSvc.EXPECT().Decrypt("encrypted-100000").Return("100000", nil)
+
+balances, err := svc.ListWalletBalances(context.Background(), merchantID)
+require.NoError(t, err)
+require.Len(t, balances, 2)
+assert.Equal(t, "USD", balances[0].Currency)
+assert.Equal(t, "25", balances[0].Balance.String())
+assert.Equal(t, "VND", balances[1].Currency)
+assert.Equal(t, "100000", balances[1].Balance.String())
+}
+
 func TestReportingService_GetWalletBalance_WalletNotFound(t *testing.T) {
 ctrl := gomock.NewController(t)
 defer ctrl.Finish()
@@ -167,7 +245,7 @@ svc := NewReportingService(mockTxRepo, mockWalletRepo, mockEncSvc)
 merchantID := uuid.New()
 mockWalletRepo.EXPECT().GetByMerchantID(gomock.Any(), merchantID, "VND").Return(nil, nil)
 
-_, _, err := svc.GetWalletBalance(context.Background(), merchantID)
+_, _, err := svc.GetWalletBalance(context.Background(), merchantID, "")
 require.Error(t, err)
 
 var appErr *apperror.AppError
@@ -175,6 +253,51 @@ assert.ErrorAs(t, err, &appErr)
 assert.Equal(t, "PAY_004", appErr.Code)
 }
 
+func TestReportingService_GetWalletBalance_PrimaryCurrency(t *testing.T) {
+ctrl := gomock.NewController(t)
+defer ctrl.Finish()
+
+mockMerchantRepo := mocks.NewMockMerchantRepository(ctrl)
+mockWalletRepo := mocks.NewMockWalletRepository(ctrl)
+mockEncSvc := mocks.NewMockEncryptionService(ctrl)
+
+svc := NewReportingService(mocks.NewMockTransactionRepository(ctrl), mockWalletRepo, mockEncSvc, WithPrimaryCurrencies(mockMerchantRepo))
+
+// A merchant holding only a USD wallet
+merchantID := uuid.New()
+mockMerchantRepo.EXPECT().GetByID(gomock.Any(), merchantID).Return(&domain.Merchant{ID: merchantID, PrimaryCurrency: "USD"}, nil)
+mockWalletRepo.EXPECT().GetByMerchantID(gomock.Any(), merchantID, "USD").Return(&domain.Wallet{
+ID:               uuid.New(),
+MerchantID:       merchantID,
+Currency:         "USD",
+EncryptedBalance: "encrypted-2500",
+}, nil)
+mockEncSvc.EXPECT().Decrypt("encrypted-2500").Return("2500", nil)
+
+balance, currency, err := svc.GetWalletBalance(context.Background(), merchantID, "")
+require.NoError(t, err)
+assert.Equal(t, "2500", balance.String())
+assert.Equal(t, "USD", currency)
+}
+
+func TestReportingService_GetWalletBalance_RequestedCurrencyMissing(t *testing.T) {
+ctrl := gomock.NewController(t)
+defer ctrl.Finish()
+
+mockWalletRepo := mocks.NewMockWalletRepository(ctrl)
+svc := NewReportingService(mocks.NewMockTransactionRepository(ctrl), mockWalletRepo, mocks.NewMockEncryptionService(ctrl),
+WithPrimaryCurrencies(mocks.NewMockMerchantRepository(ctrl)))
+
+merchantID := uuid.New()
+mockWalletRepo.EXPECT().GetByMerchantID(gomock.Any(), merchantID, "EUR").Return(nil, nil)
+
+_, _, err := svc.GetWalletBalance(context.Background(), merchantID, "eur")
+var appErr *apperror.AppError
+require.ErrorAs(t, err, &appErr)
+assert.Equal(t, "PAY_002", appErr.Code)
+assert.Equal(t, 400, appErr.HTTPStatus)
+}
+
 func TestReportingService_GetWalletBalance_DecryptError(t *testing.T) {
 ctrl := gomock.NewController(t)
 defer ctrl.Finish()
@@ -191,6 +314,181 @@ EncryptedBalance: "bad",
 }, nil)
 mockEncSvc.EXPECT().Decrypt("bad").Return("", errors.New("decrypt fail"))
 
-_, _, err := svc.GetWalletBalance(context.Background(), merchantID)
+_, _, err := svc.GetWalletBalance(context.Background(), merchantID, "")
+require.Error(t, err)
+}
+
+func TestReportingService_GetWalletBalance_NonNumericBalance(t *testing.T) {
+ctrl := gomock.NewController(t)
+defer ctrl.Finish()
+
+mockWalletRepo := mocks.NewMockWalletRepository(ctrl)
+mockEncSvc := mocks.NewMockEncryptionService(ctrl)
+var logs bytes.Buffer
+svc := NewReportingService(nil, mockWalletRepo, mockEncSvc, WithReportingLogger(zerolog.New(&logs)))
+
+merchantID := uuid.New()
+walletID := uuid.New()
+mockWalletRepo.EXPECT().GetByMerchantID(gomock.Any(), merchantID, "VND").Return(&domain.Wallet{
+ID: walletID, EncryptedBalance: "enc", Currency: "VND",
+}, nil)
+// Sscanf used to accept a numeric prefix like this one
+mockEncSvc.EXPECT().Decrypt("enc").Return("100000abc", nil)
+
+_, _, err := svc.GetWalletBalance(context.Background(), merchantID, "")
+
+var appErr *apperror.AppError
+require.ErrorAs(t, err, &appErr)
+assert.Equal(t, "SYS_004", appErr.Code)
+assert.Contains(t, logs.String(), `"level":"error"`)
+assert.Contains(t, logs.String(), `"alert":true`)
+assert.Contains(t, logs.String(), walletID.String())
+}
+
+func TestReportingService_PreviewBalance_ProjectsDeltasInOrder(t *testing.T) {
+ctrl := gomock.NewController(t)
+defer ctrl.Finish()
+
+mockWalletRepo := mocks.NewMockWalletRepository(ctrl)
+mockEncSvc := mocks.NewMockEncryptionService(ctrl)
+svc := NewReportingService(mocks.NewMockTransactionRepository(ctrl), mockWalletRepo, mockEncSvc)
+
+merchantID := uuid.New()
+// Read without a lock: GetByMerchantIDForUpdate must not be called
+mockWalletRepo.EXPECT().GetByMerchantID(gomock.Any(), merchantID, "VND").Return(&domain.Wallet{
+ID:               uuid.New(),
+MerchantID:       merchantID,
+Currency:         "VND",
+EncryptedBalance: "encrypted-100000",
+}, nil)
+mockEncSvc.EXPECT().Decrypt("encrypted-100000").Return("100000", nil)
+
+preview, err := svc.PreviewBalance(context.Background(), merchantID, "vnd", []int64{-30000, 50000, -120000})
+require.NoError(t, err)
+assert.Equal(t, "VND", preview.Currency)
+assert.Equal(t, "100000", preview.Balance.String())
+require.Len(t, preview.Steps, 3)
+assert.Equal(t, "70000", preview.Steps[0].String())
+assert.Equal(t, "120000", preview.Steps[1].String())
+assert.Equal(t, "0", preview.Steps[2].String())
+assert.Equal(t, "0", preview.Projected.String())
+}
+
+func TestReportingService_PreviewBalance_RejectsNegativeProjection(t *testing.T) {
+ctrl := gomock.NewController(t)
+defer ctrl.Finish()
+
+mockWalletRepo := mocks.NewMockWalletRepository(ctrl)
+mockEncSvc := mocks.NewMockEncryptionService(ctrl)
+svc := NewReportingService(mocks.NewMockTransactionRepository(ctrl), mockWalletRepo, mockEncSvc)
+
+merchantID := uuid.New()
+mockWalletRepo.EXPECT().GetByMerchantID(gomock.Any(), merchantID, "VND").Return(&domain.Wallet{
+ID:               uuid.New(),
+MerchantID:       merchantID,
+Currency:         "VND",
+EncryptedBalance: "encrypted-100000",
+}, nil)
+mockEncSvc.EXPECT().Decrypt("encrypted-100000").Return("100000", nil)
+
+// The running balance dips below zero at the second delta even though
+// the final total would be positive
+_, err := svc.PreviewBalance(context.Background(), merchantID, "VND", []int64{-60000, -60000, 500000})
+var appErr *apperror.AppError
+require.ErrorAs(t, err, &appErr)
+assert.Equal(t, "PAY_001", appErr.Code)
+}
+
+func TestReportingService_PreviewBalance_UnknownCurrency(t *testing.T) {
+ctrl := gomock.NewController(t)
+defer ctrl.Finish()
+
+mockWalletRepo := mocks.NewMockWalletRepository(ctrl)
+svc := NewReportingService(mocks.NewMockTransactionRepository(ctrl), mockWalletRepo, mocks.NewMockEncryptionService(ctrl))
+
+merchantID := uuid.New()
+mockWalletRepo.EXPECT().GetByMerchantID(gomock.Any(), merchantID, "EUR").Return(nil, nil)
+
+_, err := svc.PreviewBalance(context.Background(), merchantID, "EUR", []int64{1000})
+var appErr *apperror.AppError
+require.ErrorAs(t, err, &appErr)
+assert.Equal(t, "PAY_004", appErr.Code)
+}
+
+func TestReportingService_ExportTransactions_UnboundedLargeRejected(t *testing.T) {
+ctrl := gomock.NewController(t)
+defer ctrl.Finish()
+
+mockTxRepo := mocks.NewMockTransactionRepository(ctrl)
+svc := NewReportingService(mockTxRepo, nil, nil, WithExportLimits(ExportLimits{MaxRows: 500, UnboundedMaxRows: 100}))
+
+merchantID := uuid.New()
+// Only the count query runs; no rows are loaded
+mockTxRepo.EXPECT().List(gomock.Any(), gomock.Any()).Return(nil, int64(250), nil)
+
+from := time.Now().Add(-time.Hour).Unix()
+txns, err := svc.ExportTransactions(context.Background(), ports.TransactionListParams{
+MerchantID: merchantID,
+From:       &from, // "to" missing: still unbounded
+})
+assert.Nil(t, txns)
 require.Error(t, err)
+
+var appErr *apperror.AppError
+require.ErrorAs(t, err, &appErr)
+assert.Equal(t, "PAY_002", appErr.Code)
+assert.Contains(t, appErr.Message, "from and to are required")
+}
+
+func TestReportingService_ExportTransactions_BoundedSucceeds(t *testing.T) {
+ctrl := gomock.NewController(t)
+defer ctrl.Finish()
+
+mockTxRepo := mocks.NewMockTransactionRepository(ctrl)
+svc := NewReportingService(mockTxRepo, nil, nil, WithExportLimits(ExportLimits{MaxRows: 500, UnboundedMaxRows: 100}))
+
+merchantID := uuid.New()
+from := time.Now().Add(-24 * time.Hour).Unix()
+to := time.Now().Unix()
+rows := make([]domain.Transaction, 250)
+
+gomock.InOrder(
+mockTxRepo.EXPECT().List(gomock.Any(), gomock.Any()).Return(rows[:1], int64(250), nil),
+mockTxRepo.EXPECT().List(gomock.Any(), gomock.Any()).DoAndReturn(
+func(_ context.Context, p ports.TransactionListParams) ([]domain.Transaction, int64, error) {
+assert.Equal(t, 1, p.Page)
+assert.Equal(t, 250, p.PageSize)
+return rows, int64(250), nil
+}),
+)
+
+txns, err := svc.ExportTransactions(context.Background(), ports.TransactionListParams{
+MerchantID: merchantID,
+From:       &from,
+To:         &to,
+})
+require.NoError(t, err)
+assert.Len(t, txns, 250)
+}
+
+func TestReportingService_ExportTransactions_OverMaxRowsRejected(t *testing.T) {
+ctrl := gomock.NewController(t)
+defer ctrl.Finish()
+
+mockTxRepo := mocks.NewMockTransactionRepository(ctrl)
+svc := NewReportingService(mockTxRepo, nil, nil, WithExportLimits(ExportLimits{MaxRows: 500, UnboundedMaxRows: 100}))
+
+from := time.Now().Add(-24 * time.Hour).Unix()
+to := time.Now().Unix()
+mockTxRepo.EXPECT().List(gomock.Any(), gomock.Any()).Return(nil, int64(501), nil)
+
+_, err := svc.ExportTransactions(context.Background(), ports.TransactionListParams{
+MerchantID: uuid.New(),
+From:       &from,
+To:         &to,
+})
+var appErr *apperror.AppError
+require.ErrorAs(t, err, &appErr)
+assert.Equal(t, "PAY_002", appErr.Code)
+assert.Contains(t, appErr.Message, "exceeding the maximum of 500")
 }
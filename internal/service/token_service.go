@@ -10,26 +10,66 @@ import (
 	"github.com/google/uuid"
 )
 
+// defaultRefreshExpiry is the refresh token lifetime unless WithRefreshExpiry is given.
+const defaultRefreshExpiry = 7 * 24 * time.Hour
+
+// tokenTypeRefresh marks refresh tokens in the "typ" claim. Access tokens
+// carry no "typ", so tokens issued before refresh tokens existed stay valid.
+const tokenTypeRefresh = "refresh"
+
 // JWTTokenService implements ports.TokenService using HS256 JWT.
 type JWTTokenService struct {
-	secret []byte
-	expiry time.Duration
-	issuer string
+	secret        []byte
+	expiry        time.Duration
+	refreshExpiry time.Duration
+	issuer        string
+}
+
+// TokenOption configures optional JWTTokenService behaviour.
+type TokenOption func(*JWTTokenService)
+
+// WithRefreshExpiry sets the refresh token lifetime. Zero keeps the default.
+func WithRefreshExpiry(d time.Duration) TokenOption {
+	return func(s *JWTTokenService) {
+		if d > 0 {
+			s.refreshExpiry = d
+		}
+	}
 }
 
 // NewJWTTokenService creates a new JWT token service.
-func NewJWTTokenService(secret string, expiry time.Duration, issuer string) *JWTTokenService {
-	return &JWTTokenService{
-		secret: []byte(secret),
-		expiry: expiry,
-		issuer: issuer,
+func NewJWTTokenService(secret string, expiry time.Duration, issuer string, opts ...TokenOption) *JWTTokenService {
+	s := &JWTTokenService{
+		secret:        []byte(secret),
+		expiry:        expiry,
+		refreshExpiry: defaultRefreshExpiry,
+		issuer:        issuer,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 // Generate creates a signed JWT for the given merchant.
 func (s *JWTTokenService) Generate(merchantID uuid.UUID, accessKey string) (string, time.Time, error) {
+	return s.sign(merchantID, accessKey, s.expiry, "")
+}
+
+// GenerateWithExpiry creates a signed JWT that expires after ttl instead of
+// the configured expiry.
+func (s *JWTTokenService) GenerateWithExpiry(merchantID uuid.UUID, accessKey string, ttl time.Duration) (string, time.Time, error) {
+	return s.sign(merchantID, accessKey, ttl, "")
+}
+
+// GenerateRefresh creates a signed refresh token for the given merchant.
+func (s *JWTTokenService) GenerateRefresh(merchantID uuid.UUID, accessKey string) (string, time.Time, error) {
+	return s.sign(merchantID, accessKey, s.refreshExpiry, tokenTypeRefresh)
+}
+
+func (s *JWTTokenService) sign(merchantID uuid.UUID, accessKey string, ttl time.Duration, typ string) (string, time.Time, error) {
 	now := time.Now()
-	expiresAt := now.Add(s.expiry)
+	expiresAt := now.Add(ttl)
 
 	claims := jwt.MapClaims{
 		"sub":        merchantID.String(),
@@ -38,6 +78,13 @@ func (s *JWTTokenService) Generate(merchantID uuid.UUID, accessKey string) (stri
 		"exp":        expiresAt.Unix(),
 		"iss":        s.issuer,
 	}
+	if typ != "" {
+		claims["typ"] = typ
+	}
+	if typ == tokenTypeRefresh {
+		// Lets a refresh token be redeemed only once
+		claims["jti"] = uuid.NewString()
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString(s.secret)
@@ -49,7 +96,18 @@ func (s *JWTTokenService) Generate(merchantID uuid.UUID, accessKey string) (stri
 }
 
 // Validate parses and validates a JWT token, returning the claims.
+// Refresh tokens are rejected.
 func (s *JWTTokenService) Validate(tokenString string) (*ports.TokenClaims, error) {
+	return s.parse(tokenString, "")
+}
+
+// ValidateRefresh parses and validates a refresh token, returning the claims.
+// Access tokens are rejected.
+func (s *JWTTokenService) ValidateRefresh(tokenString string) (*ports.TokenClaims, error) {
+	return s.parse(tokenString, tokenTypeRefresh)
+}
+
+func (s *JWTTokenService) parse(tokenString, wantType string) (*ports.TokenClaims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
@@ -65,6 +123,10 @@ func (s *JWTTokenService) Validate(tokenString string) (*ports.TokenClaims, erro
 		return nil, fmt.Errorf("invalid token claims")
 	}
 
+	if typ, _ := claims["typ"].(string); typ != wantType {
+		return nil, fmt.Errorf("unexpected token type %q", typ)
+	}
+
 	sub, ok := claims["sub"].(string)
 	if !ok {
 		return nil, fmt.Errorf("missing subject claim")
@@ -76,9 +138,16 @@ func (s *JWTTokenService) Validate(tokenString string) (*ports.TokenClaims, erro
 	}
 
 	accessKey, _ := claims["access_key"].(string)
+	tokenID, _ := claims["jti"].(string)
+	var expiresAt time.Time
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		expiresAt = exp.Time
+	}
 
 	return &ports.TokenClaims{
 		MerchantID: merchantID,
 		AccessKey:  accessKey,
+		TokenID:    tokenID,
+		ExpiresAt:  expiresAt,
 	}, nil
 }
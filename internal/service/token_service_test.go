@@ -27,6 +27,20 @@ func TestJWTTokenService_GenerateAndValidate(t *testing.T) {
 	assert.Equal(t, accessKey, claims.AccessKey)
 }
 
+func TestJWTTokenService_GenerateWithExpiry(t *testing.T) {
+	svc := NewJWTTokenService(testJWTSecret, 24*time.Hour, "test-issuer")
+	merchantID := uuid.New()
+
+	before := time.Now()
+	tokenStr, expiresAt, err := svc.GenerateWithExpiry(merchantID, "key", 30*time.Minute)
+	require.NoError(t, err)
+	assert.WithinDuration(t, before.Add(30*time.Minute), expiresAt, time.Second)
+
+	claims, err := svc.Validate(tokenStr)
+	require.NoError(t, err)
+	assert.Equal(t, merchantID, claims.MerchantID)
+}
+
 func TestJWTTokenService_ExpiredToken(t *testing.T) {
 	// Token with -1 hour expiry = already expired
 	svc := NewJWTTokenService(testJWTSecret, -1*time.Hour, "test-issuer")
@@ -63,3 +77,43 @@ func TestJWTTokenService_EmptyToken(t *testing.T) {
 	_, err := svc.Validate("")
 	assert.Error(t, err)
 }
+
+func TestJWTTokenService_RefreshTokens(t *testing.T) {
+	svc := NewJWTTokenService(testJWTSecret, time.Hour, "test-issuer", WithRefreshExpiry(48*time.Hour))
+	merchantID := uuid.New()
+
+	refresh, expiresAt, err := svc.GenerateRefresh(merchantID, "test-access-key")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(48*time.Hour), expiresAt, time.Minute)
+
+	claims, err := svc.ValidateRefresh(refresh)
+	require.NoError(t, err)
+	assert.Equal(t, merchantID, claims.MerchantID)
+	assert.Equal(t, "test-access-key", claims.AccessKey)
+	assert.NotEmpty(t, claims.TokenID)
+	assert.WithinDuration(t, expiresAt, claims.ExpiresAt, time.Second)
+
+	// Each refresh token has its own ID, so it can be redeemed once
+	other, _, err := svc.GenerateRefresh(merchantID, "test-access-key")
+	require.NoError(t, err)
+	otherClaims, err := svc.ValidateRefresh(other)
+	require.NoError(t, err)
+	assert.NotEqual(t, claims.TokenID, otherClaims.TokenID)
+
+	// Each token type only validates as itself
+	_, err = svc.Validate(refresh)
+	assert.Error(t, err)
+
+	access, _, err := svc.Generate(merchantID, "test-access-key")
+	require.NoError(t, err)
+	_, err = svc.ValidateRefresh(access)
+	assert.Error(t, err)
+}
+
+func TestJWTTokenService_DefaultRefreshExpiry(t *testing.T) {
+	svc := NewJWTTokenService(testJWTSecret, time.Hour, "test-issuer")
+
+	_, expiresAt, err := svc.GenerateRefresh(uuid.New(), "test-access-key")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(defaultRefreshExpiry), expiresAt, time.Minute)
+}
@@ -4,19 +4,26 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"secure-payment-gateway/internal/core/domain"
 	"secure-payment-gateway/internal/core/ports"
+	"secure-payment-gateway/pkg/apperror"
 
 	"github.com/google/uuid"
 	"github.com/rs/zerolog"
 )
 
-// webhookRetryIntervals defines the retry intervals per WEBHOOK_SPEC.md.
-var webhookRetryIntervals = []time.Duration{
+// defaultWebhookRetryIntervals defines the retry intervals per WEBHOOK_SPEC.md.
+var defaultWebhookRetryIntervals = []time.Duration{
 	15 * time.Second,
 	60 * time.Second,
 	2 * time.Minute,
@@ -24,6 +31,9 @@ var webhookRetryIntervals = []time.Duration{
 	10 * time.Minute,
 }
 
+// defaultSyncWebhookTimeout bounds the single attempt made for synchronous-mode merchants.
+const defaultSyncWebhookTimeout = 3 * time.Second
+
 // WebhookEvent types
 const (
 	EventPaymentUpdate = "PAYMENT_UPDATE"
@@ -31,24 +41,273 @@ const (
 	EventTopupUpdate   = "TOPUP_UPDATE"
 )
 
+// webhookEventSpec describes when an event type is sent.
+type webhookEventSpec struct {
+	Type            string
+	TransactionType domain.TransactionType
+	Trigger         string
+}
+
+// webhookEvents is the source of truth for event selection and the public catalog.
+var webhookEvents = []webhookEventSpec{
+	{EventPaymentUpdate, domain.TransactionTypePayment, "A payment reaches a final state (SUCCESS or FAILED)"},
+	{EventRefundUpdate, domain.TransactionTypeRefund, "A refund is processed against an earlier payment"},
+	{EventTopupUpdate, domain.TransactionTypeTopup, "A wallet topup completes"},
+}
+
+// eventTypeFor returns the event sent for a transaction of the given type.
+func eventTypeFor(txType domain.TransactionType) string {
+	for _, ev := range webhookEvents {
+		if ev.TransactionType == txType {
+			return ev.Type
+		}
+	}
+	return EventPaymentUpdate
+}
+
+// Webhook payload schema versions. Merchants are pinned to one; nil pins to DefaultWebhookVersion.
+const (
+	WebhookVersion202401 = "2024-01" // Original flat shape (WebhookPayloadData)
+	WebhookVersion202501 = "2025-01" // Typed shape with transaction metadata (WebhookPayloadDataV2)
+
+	DefaultWebhookVersion = WebhookVersion202401
+	LatestWebhookVersion  = WebhookVersion202501
+)
+
+// webhookEvent is the version-independent input to payload serializers.
+type webhookEvent struct {
+	Transaction *domain.Transaction
+	Currency    string
+	Timestamp   int64
+}
+
+// webhookSerializer builds the version-specific "data" object of a payload.
+type webhookSerializer func(ev webhookEvent) any
+
+// webhookSerializers maps each supported version to its serializer.
+// Never change an existing entry; add a new version instead.
+var webhookSerializers = map[string]webhookSerializer{
+	WebhookVersion202401: serializeWebhookV202401,
+	WebhookVersion202501: serializeWebhookV202501,
+}
+
+// webhookMinimalSerializers build the "data" object for merchants in minimal
+// payload mode: IDs and status only. Every version needs an entry.
+var webhookMinimalSerializers = map[string]webhookSerializer{
+	WebhookVersion202401: serializeWebhookV202401Minimal,
+	WebhookVersion202501: serializeWebhookV202501Minimal,
+}
+
 // WebhookPayload is the JSON structure sent to merchant webhook_url.
 type WebhookPayload struct {
-	EventType string             `json:"event_type"`
-	Data      WebhookPayloadData `json:"data"`
-	Signature string             `json:"signature"`
+	Version   string `json:"version"`
+	EventType string `json:"event_type"`
+	Data      any    `json:"data"` // WebhookPayloadData or WebhookPayloadDataV2, per Version
+	Signature string `json:"signature"`
 }
 
-// WebhookPayloadData holds the transaction details in the webhook.
+// WebhookPayloadData holds the transaction details in a 2024-01 webhook.
 type WebhookPayloadData struct {
+	MerchantOrderID      string      `json:"merchant_order_id"`
+	GatewayTransactionID string      `json:"gateway_transaction_id"`
+	Status               string      `json:"status"`
+	Amount               json.Number `json:"amount"` // Exact; fractional only on decimal-balance wallets
+	Currency             string      `json:"currency"`
+	Reason               string      `json:"reason"`
+	Timestamp            int64       `json:"timestamp"`
+}
+
+// WebhookPayloadDataV2 holds the transaction details in a 2025-01 webhook.
+type WebhookPayloadDataV2 struct {
+	TransactionID         string      `json:"transaction_id"`
+	ReferenceID           string      `json:"reference_id"`
+	TransactionType       string      `json:"transaction_type"`
+	Status                string      `json:"status"`
+	Amount                json.Number `json:"amount"` // As in WebhookPayloadData
+	Currency              string      `json:"currency"`
+	OriginalTransactionID *string     `json:"original_transaction_id,omitempty"`
+	CreatedAt             string      `json:"created_at"`
+	ProcessedAt           *string     `json:"processed_at,omitempty"`
+	Timestamp             int64       `json:"timestamp"`
+}
+
+// WebhookPayloadDataMinimal is WebhookPayloadData without amount, currency
+// and reason, sent to merchants in minimal payload mode.
+type WebhookPayloadDataMinimal struct {
 	MerchantOrderID      string `json:"merchant_order_id"`
 	GatewayTransactionID string `json:"gateway_transaction_id"`
 	Status               string `json:"status"`
-	Amount               int64  `json:"amount"`
-	Currency             string `json:"currency"`
-	Reason               string `json:"reason"`
 	Timestamp            int64  `json:"timestamp"`
 }
 
+// WebhookPayloadDataV2Minimal is WebhookPayloadDataV2 without amount,
+// currency and timestamps of the transaction, sent in minimal payload mode.
+type WebhookPayloadDataV2Minimal struct {
+	TransactionID         string  `json:"transaction_id"`
+	ReferenceID           string  `json:"reference_id"`
+	TransactionType       string  `json:"transaction_type"`
+	Status                string  `json:"status"`
+	OriginalTransactionID *string `json:"original_transaction_id,omitempty"`
+	Timestamp             int64   `json:"timestamp"`
+}
+
+// webhookPayloadDataTypes maps each version to the Go type its serializer emits.
+var webhookPayloadDataTypes = map[string]reflect.Type{
+	WebhookVersion202401: reflect.TypeOf(WebhookPayloadData{}),
+	WebhookVersion202501: reflect.TypeOf(WebhookPayloadDataV2{}),
+}
+
+// webhookMinimalDataTypes maps each version to the Go type its minimal serializer emits.
+var webhookMinimalDataTypes = map[string]reflect.Type{
+	WebhookVersion202401: reflect.TypeOf(WebhookPayloadDataMinimal{}),
+	WebhookVersion202501: reflect.TypeOf(WebhookPayloadDataV2Minimal{}),
+}
+
+// EventCatalog describes the supported events and payload schemas.
+// It is derived from the event table and payload structs so it cannot drift.
+func (s *webhookService) EventCatalog() *ports.WebhookCatalog {
+	catalog := &ports.WebhookCatalog{
+		Envelope:       describeFields(reflect.TypeOf(WebhookPayload{})),
+		DefaultVersion: DefaultWebhookVersion,
+		LatestVersion:  LatestWebhookVersion,
+	}
+	for _, ev := range webhookEvents {
+		catalog.Events = append(catalog.Events, ports.WebhookEventInfo{
+			Type:            ev.Type,
+			TransactionType: string(ev.TransactionType),
+			Trigger:         ev.Trigger,
+		})
+	}
+	versions := make([]string, 0, len(webhookPayloadDataTypes))
+	for version := range webhookPayloadDataTypes {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions) // Versions are dates, so this is chronological
+	for _, version := range versions {
+		catalog.Versions = append(catalog.Versions, ports.WebhookVersionInfo{
+			Version:       version,
+			Fields:        describeFields(webhookPayloadDataTypes[version]),
+			MinimalFields: describeFields(webhookMinimalDataTypes[version]),
+		})
+	}
+	return catalog
+}
+
+// describeFields lists the JSON fields of a struct type.
+func describeFields(t reflect.Type) []ports.WebhookFieldInfo {
+	fields := make([]ports.WebhookFieldInfo, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		ft := f.Type
+		optional := strings.Contains(opts, "omitempty")
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+			optional = true
+		}
+		fields = append(fields, ports.WebhookFieldInfo{
+			Name:     name,
+			Type:     jsonTypeName(ft),
+			Optional: optional,
+		})
+	}
+	return fields
+}
+
+// jsonTypeName maps a Go type to its JSON schema type name.
+func jsonTypeName(t reflect.Type) string {
+	if t == reflect.TypeOf(json.Number("")) {
+		return "number"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func serializeWebhookV202401(ev webhookEvent) any {
+	txn := ev.Transaction
+	return WebhookPayloadData{
+		MerchantOrderID:      txn.ReferenceID,
+		GatewayTransactionID: txn.ID.String(),
+		Status:               string(txn.Status),
+		Amount:               json.Number(txn.ExactAmount().String()),
+		Currency:             ev.Currency,
+		Reason:               fmt.Sprintf("Transaction %s", txn.Status),
+		Timestamp:            ev.Timestamp,
+	}
+}
+
+func serializeWebhookV202501(ev webhookEvent) any {
+	txn := ev.Transaction
+	data := WebhookPayloadDataV2{
+		TransactionID:   txn.ID.String(),
+		ReferenceID:     txn.ReferenceID,
+		TransactionType: string(txn.TransactionType),
+		Status:          string(txn.Status),
+		Amount:          json.Number(txn.ExactAmount().String()),
+		Currency:        ev.Currency,
+		CreatedAt:       txn.CreatedAt.UTC().Format(time.RFC3339),
+		Timestamp:       ev.Timestamp,
+	}
+	if txn.OriginalTransactionID != nil {
+		orig := txn.OriginalTransactionID.String()
+		data.OriginalTransactionID = &orig
+	}
+	if txn.HasProcessedAt() {
+		processed := txn.ProcessedAt.UTC().Format(time.RFC3339)
+		data.ProcessedAt = &processed
+	}
+	return data
+}
+
+func serializeWebhookV202401Minimal(ev webhookEvent) any {
+	full := serializeWebhookV202401(ev).(WebhookPayloadData)
+	return WebhookPayloadDataMinimal{
+		MerchantOrderID:      full.MerchantOrderID,
+		GatewayTransactionID: full.GatewayTransactionID,
+		Status:               full.Status,
+		Timestamp:            full.Timestamp,
+	}
+}
+
+func serializeWebhookV202501Minimal(ev webhookEvent) any {
+	full := serializeWebhookV202501(ev).(WebhookPayloadDataV2)
+	return WebhookPayloadDataV2Minimal{
+		TransactionID:         full.TransactionID,
+		ReferenceID:           full.ReferenceID,
+		TransactionType:       full.TransactionType,
+		Status:                full.Status,
+		OriginalTransactionID: full.OriginalTransactionID,
+		Timestamp:             full.Timestamp,
+	}
+}
+
+// resolveWebhookVersion returns the merchant's pinned version, falling back to
+// the default for unpinned merchants or versions this build doesn't know.
+func resolveWebhookVersion(pinned *string) string {
+	if pinned != nil {
+		if _, ok := webhookSerializers[*pinned]; ok {
+			return *pinned
+		}
+	}
+	return DefaultWebhookVersion
+}
+
 // webhookService implements ports.WebhookService.
 type webhookService struct {
 	merchantRepo ports.MerchantRepository
@@ -58,6 +317,37 @@ type webhookService struct {
 	sigSvc       ports.SignatureService
 	httpClient   HTTPClient
 	log          zerolog.Logger
+	syncTimeout  time.Duration
+
+	retryIntervals  []time.Duration // wait before each retry; len = number of retries
+	encryptPayloads bool            // store delivery log payloads encrypted
+
+	// Background deliveries run under bgCtx, cancelled by Stop, and are
+	// counted in deliveries so Stop can wait for them.
+	bgCtx      context.Context
+	stopBg     context.CancelFunc
+	deliveries sync.WaitGroup
+}
+
+// WebhookOption configures optional webhookService behaviour.
+type WebhookOption func(*webhookService)
+
+// WithPayloadEncryption stores delivery log payloads, which carry amounts
+// and references, encrypted with the EncryptionService. Payloads are
+// decrypted only for the owning merchant's delivery detail. Logs stored
+// in plaintext remain readable either way.
+func WithPayloadEncryption(enabled bool) WebhookOption {
+	return func(s *webhookService) {
+		s.encryptPayloads = enabled
+	}
+}
+
+// WithWebhookRetryIntervals replaces the retry schedule: one retry per
+// interval, each sent that long after the previous attempt failed.
+func WithWebhookRetryIntervals(intervals []time.Duration) WebhookOption {
+	return func(s *webhookService) {
+		s.retryIntervals = append([]time.Duration(nil), intervals...)
+	}
 }
 
 // HTTPClient interface for testability.
@@ -65,7 +355,8 @@ type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
-// NewWebhookService creates a new webhook service.
+// NewWebhookService creates a new webhook service. A nil webhookRepo
+// disables delivery log persistence.
 func NewWebhookService(
 	merchantRepo ports.MerchantRepository,
 	walletRepo ports.WalletRepository,
@@ -73,43 +364,117 @@ func NewWebhookService(
 	sigSvc ports.SignatureService,
 	httpClient HTTPClient,
 	log zerolog.Logger,
-	webhookRepo ...ports.WebhookRepository,
+	webhookRepo ports.WebhookRepository,
+	opts ...WebhookOption,
 ) ports.WebhookService {
-	var repo ports.WebhookRepository
-	if len(webhookRepo) > 0 {
-		repo = webhookRepo[0]
-	}
-	return &webhookService{
+	s := &webhookService{
 		merchantRepo: merchantRepo,
 		walletRepo:   walletRepo,
-		webhookRepo:  repo,
+		webhookRepo:  webhookRepo,
 		encSvc:       encSvc,
 		sigSvc:       sigSvc,
 		httpClient:   httpClient,
 		log:          log,
+		syncTimeout:  defaultSyncWebhookTimeout,
+
+		retryIntervals: defaultWebhookRetryIntervals,
+	}
+	s.bgCtx, s.stopBg = context.WithCancel(context.Background())
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
+}
+
+// Stop cancels background deliveries and waits for them to return. A
+// delivery waiting for its next retry stops at once and its log stays
+// PENDING; one in flight is aborted.
+func (s *webhookService) Stop() {
+	s.stopBg()
+	s.deliveries.Wait()
+}
+
+// inBackground runs deliver under the background context, tracked for Stop.
+func (s *webhookService) inBackground(deliver func(ctx context.Context)) {
+	s.deliveries.Add(1)
+	go func() {
+		defer s.deliveries.Done()
+		deliver(s.bgCtx)
+	}()
 }
 
 // EnqueueWebhook sends a webhook to the merchant asynchronously with retries.
 func (s *webhookService) EnqueueWebhook(ctx context.Context, transaction *domain.Transaction) error {
+	// The transaction is committed: notify the merchant even if the client has gone
+	ctx = context.WithoutCancel(ctx)
+	merchant, payload, err := s.buildWebhook(ctx, transaction)
+	if err != nil || merchant == nil {
+		return err
+	}
+
+	// Fire async with retries
+	s.inBackground(func(ctx context.Context) {
+		s.deliverWithRetries(ctx, *merchant.WebhookURL, payload, transaction.ID, transaction.MerchantID)
+	})
+
+	return nil
+}
+
+// DispatchWebhook delivers the webhook in the merchant's configured mode.
+// Synchronous-mode merchants get one bounded attempt before this returns;
+// remaining retries continue in the background. Async merchants are enqueued
+// as usual and nil is returned.
+func (s *webhookService) DispatchWebhook(ctx context.Context, transaction *domain.Transaction) (*ports.WebhookDispatchResult, error) {
+	// The transaction is committed: notify the merchant even if the client
+	// has gone. A synchronous attempt is still bounded by syncTimeout.
+	ctx = context.WithoutCancel(ctx)
+	merchant, payload, err := s.buildWebhook(ctx, transaction)
+	if err != nil || merchant == nil {
+		return nil, err
+	}
+	if !merchant.SynchronousWebhook {
+		s.inBackground(func(ctx context.Context) {
+			s.deliverWithRetries(ctx, *merchant.WebhookURL, payload, transaction.ID, transaction.MerchantID)
+		})
+		return nil, nil
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("marshal webhook payload: %w", err)
+	}
+	deliveryLog := s.newDeliveryLog(*merchant.WebhookURL, payloadBytes, transaction.ID, transaction.MerchantID)
+
+	attemptCtx, cancel := context.WithTimeout(ctx, s.syncTimeout)
+	delivered := s.attemptDelivery(attemptCtx, payloadBytes, deliveryLog, 0)
+	cancel()
+
+	result := &ports.WebhookDispatchResult{
+		Synchronous: true,
+		Delivered:   delivered,
+		HTTPStatus:  deliveryLog.HTTPStatus,
+		Error:       deliveryLog.LastError,
+	}
+	if !delivered {
+		s.inBackground(func(ctx context.Context) {
+			s.retryFrom(ctx, payloadBytes, deliveryLog, 1)
+		})
+	}
+	return result, nil
+}
+
+// buildWebhook resolves the merchant and signs the payload for a transaction.
+// It returns a nil merchant when the merchant has no webhook URL configured.
+func (s *webhookService) buildWebhook(ctx context.Context, transaction *domain.Transaction) (*domain.Merchant, WebhookPayload, error) {
 	// Lookup merchant to get webhook_url and secret_key
 	merchant, err := s.merchantRepo.GetByID(ctx, transaction.MerchantID)
 	if err != nil {
 		s.log.Error().Err(err).Str("merchant_id", transaction.MerchantID.String()).Msg("webhook: failed to fetch merchant")
-		return err
+		return nil, WebhookPayload{}, err
 	}
 	if merchant == nil || merchant.WebhookURL == nil || *merchant.WebhookURL == "" {
 		s.log.Debug().Str("merchant_id", transaction.MerchantID.String()).Msg("webhook: no webhook URL configured, skipping")
-		return nil
-	}
-
-	// Determine event type
-	eventType := EventPaymentUpdate
-	switch transaction.TransactionType {
-	case domain.TransactionTypeRefund:
-		eventType = EventRefundUpdate
-	case domain.TransactionTypeTopup:
-		eventType = EventTopupUpdate
+		return nil, WebhookPayload{}, nil
 	}
 
 	// Determine currency from wallet
@@ -119,59 +484,148 @@ func (s *webhookService) EnqueueWebhook(ctx context.Context, transaction *domain
 		currency = wallet.Currency
 	}
 
-	// Build reason
-	reason := fmt.Sprintf("Transaction %s", transaction.Status)
+	payload, _, err := s.signWebhook(merchant, transaction, currency)
+	if err != nil {
+		return nil, WebhookPayload{}, err
+	}
+	return merchant, payload, nil
+}
+
+// signWebhook builds the payload for a transaction in the merchant's pinned
+// version and payload mode, and signs it with the merchant's secret. It also
+// returns the signing input: the exact string the signature is computed over.
+func (s *webhookService) signWebhook(merchant *domain.Merchant, transaction *domain.Transaction, currency string) (WebhookPayload, string, error) {
+	eventType := eventTypeFor(transaction.TransactionType)
 
-	// Build payload data
-	data := WebhookPayloadData{
-		MerchantOrderID:      transaction.ReferenceID,
-		GatewayTransactionID: transaction.ID.String(),
-		Status:               string(transaction.Status),
-		Amount:               transaction.Amount,
-		Currency:             currency,
-		Reason:               reason,
-		Timestamp:            time.Now().Unix(),
+	// Build payload data in the merchant's pinned schema version
+	version := resolveWebhookVersion(merchant.WebhookVersion)
+	if merchant.WebhookVersion != nil && *merchant.WebhookVersion != version {
+		s.log.Warn().Str("merchant_id", merchant.ID.String()).Str("pinned", *merchant.WebhookVersion).Msg("webhook: unknown pinned version, using default")
+	}
+	serializers := webhookSerializers
+	if merchant.WebhookPayloadMode == domain.WebhookPayloadMinimal {
+		serializers = webhookMinimalSerializers
 	}
+	data := serializers[version](webhookEvent{
+		Transaction: transaction,
+		Currency:    currency,
+		Timestamp:   time.Now().Unix(),
+	})
 
 	// Sign the payload data with merchant secret
 	secretKey, err := s.encSvc.Decrypt(merchant.SecretKeyEnc)
 	if err != nil {
 		s.log.Error().Err(err).Msg("webhook: failed to decrypt merchant secret key")
-		return err
+		return WebhookPayload{}, "", err
 	}
 
 	dataBytes, _ := json.Marshal(data)
-	signature := s.sigSvc.Sign(secretKey, string(dataBytes))
+	signingInput := string(dataBytes)
+	signature := s.sigSvc.Sign(secretKey, signingInput)
 
 	payload := WebhookPayload{
+		Version:   version,
 		EventType: eventType,
 		Data:      data,
 		Signature: signature,
 	}
 
-	// Fire async with retries
-	go s.deliverWithRetries(*merchant.WebhookURL, payload, transaction.ID, transaction.MerchantID)
+	return payload, signingInput, nil
+}
 
-	return nil
+// TestFireWebhook sends a sample PAYMENT_UPDATE for a made-up transaction to
+// the merchant's webhook URL, in one attempt bounded like synchronous
+// delivery. Nothing is persisted and nothing is retried. Unlike live
+// deliveries, the result exposes the signing input so merchants can debug
+// signature mismatches against their own computation.
+func (s *webhookService) TestFireWebhook(ctx context.Context, merchantID uuid.UUID) (*ports.WebhookTestFireResult, error) {
+	merchant, err := s.merchantRepo.GetByID(ctx, merchantID)
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("get merchant: %w", err))
+	}
+	if merchant == nil {
+		return nil, apperror.ErrNotFound("merchant")
+	}
+	if merchant.WebhookURL == nil || *merchant.WebhookURL == "" {
+		return nil, apperror.Validation("no webhook_url configured")
+	}
+
+	now := time.Now().UTC()
+	sample := &domain.Transaction{
+		ID:              uuid.New(),
+		ReferenceID:     "TEST-" + now.Format("20060102150405"),
+		MerchantID:      merchant.ID,
+		Amount:          100000,
+		TransactionType: domain.TransactionTypePayment,
+		Status:          domain.TransactionStatusSuccess,
+		CreatedAt:       now,
+		ProcessedAt:     &now,
+	}
+	payload, signingInput, err := s.signWebhook(merchant, sample, "VND")
+	if err != nil {
+		return nil, apperror.ErrEncryptionFailure(fmt.Errorf("sign test webhook: %w", err))
+	}
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("marshal webhook payload: %w", err))
+	}
+
+	result := &ports.WebhookTestFireResult{
+		Payload:      payloadBytes,
+		SigningInput: signingInput,
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, s.syncTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(attemptCtx, http.MethodPost, *merchant.WebhookURL, bytes.NewReader(payloadBytes))
+	if err != nil {
+		errMsg := err.Error()
+		result.Error = &errMsg
+		return result, nil
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		errMsg := err.Error()
+		result.Error = &errMsg
+		return result, nil
+	}
+	resp.Body.Close()
+
+	httpStatus := resp.StatusCode
+	result.HTTPStatus = &httpStatus
+	result.Delivered = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !result.Delivered {
+		errMsg := fmt.Sprintf("HTTP %d", resp.StatusCode)
+		result.Error = &errMsg
+	}
+	s.log.Info().Str("merchant_id", merchant.ID.String()).Str("url_host", webhookHost(*merchant.WebhookURL)).
+		Int("http_status", httpStatus).Msg("webhook: test fired")
+	return result, nil
 }
 
 // deliverWithRetries attempts to deliver the webhook with exponential backoff.
-func (s *webhookService) deliverWithRetries(url string, payload WebhookPayload, txID uuid.UUID, merchantID uuid.UUID) {
+func (s *webhookService) deliverWithRetries(ctx context.Context, url string, payload WebhookPayload, txID uuid.UUID, merchantID uuid.UUID) {
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
 		s.log.Error().Err(err).Str("tx_id", txID.String()).Msg("webhook: failed to marshal payload")
 		return
 	}
 
-	// Create initial log entry
-	logID := uuid.New()
+	deliveryLog := s.newDeliveryLog(url, payloadBytes, txID, merchantID)
+	s.retryFrom(ctx, payloadBytes, deliveryLog, 0)
+}
+
+// newDeliveryLog creates and persists the initial PENDING log entry.
+func (s *webhookService) newDeliveryLog(url string, payloadBytes []byte, txID uuid.UUID, merchantID uuid.UUID) *domain.WebhookDeliveryLog {
 	now := time.Now()
 	deliveryLog := &domain.WebhookDeliveryLog{
-		ID:            logID,
+		ID:            uuid.New(),
 		TransactionID: txID,
 		MerchantID:    merchantID,
 		WebhookURL:    url,
-		Payload:       string(payloadBytes),
+		Payload:       s.sealPayload(payloadBytes, txID),
 		Attempt:       0,
 		Status:        domain.WebhookStatusPending,
 		CreatedAt:     now,
@@ -183,72 +637,204 @@ func (s *webhookService) deliverWithRetries(url string, payload WebhookPayload,
 			s.log.Warn().Err(err).Str("tx_id", txID.String()).Msg("webhook: failed to persist initial log")
 		}
 	}
+	return deliveryLog
+}
 
-	for attempt := 0; attempt <= len(webhookRetryIntervals); attempt++ {
+// retryFrom runs delivery attempts starting at the given attempt index,
+// waiting the spec interval before each retry, and marks the log FAILED
+// once every attempt is exhausted. If ctx is cancelled it returns early,
+// leaving the log as it is.
+func (s *webhookService) retryFrom(ctx context.Context, payloadBytes []byte, deliveryLog *domain.WebhookDeliveryLog, start int) {
+	for attempt := start; attempt <= len(s.retryIntervals); attempt++ {
 		if attempt > 0 {
-			time.Sleep(webhookRetryIntervals[attempt-1])
+			timer := time.NewTimer(s.retryIntervals[attempt-1])
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				s.log.Info().Func(deliveryFields(deliveryLog)).Msg("webhook: retries stopped")
+				return
+			case <-timer.C:
+			}
 		}
-
-		deliveryLog.Attempt = attempt + 1
-		deliveryLog.UpdatedAt = time.Now()
-
-		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payloadBytes))
-		if err != nil {
-			errMsg := err.Error()
-			deliveryLog.LastError = &errMsg
-			s.persistLog(deliveryLog)
-			s.log.Error().Err(err).Str("tx_id", txID.String()).Int("attempt", attempt+1).Msg("webhook: failed to create request")
-			continue
+		if s.attemptDelivery(ctx, payloadBytes, deliveryLog, attempt) {
+			return
 		}
-		req.Header.Set("Content-Type", "application/json")
-
-		resp, err := s.httpClient.Do(req)
-		if err != nil {
-			errMsg := err.Error()
-			deliveryLog.LastError = &errMsg
-			if attempt < len(webhookRetryIntervals) {
-				nextRetry := time.Now().Add(webhookRetryIntervals[attempt])
-				deliveryLog.NextRetryAt = &nextRetry
-			}
-			s.persistLog(deliveryLog)
-			s.log.Warn().Err(err).Str("tx_id", txID.String()).Int("attempt", attempt+1).Msg("webhook: delivery failed")
-			continue
+		if ctx.Err() != nil {
+			s.log.Info().Func(deliveryFields(deliveryLog)).Msg("webhook: retries stopped")
+			return
 		}
-		resp.Body.Close()
+	}
+
+	if err := deliveryLog.TransitionTo(domain.WebhookStatusFailed); err != nil {
+		s.log.Warn().Err(err).Str("tx_id", deliveryLog.TransactionID.String()).Msg("webhook: not marking FAILED")
+		return
+	}
+	deliveryLog.NextRetryAt = nil
+	s.persistLog(deliveryLog)
+	s.log.Error().Str("tx_id", deliveryLog.TransactionID.String()).Msg("webhook: all retry attempts exhausted")
+}
 
-		httpStatus := resp.StatusCode
-		deliveryLog.HTTPStatus = &httpStatus
+// attemptDelivery makes a single delivery attempt and records its outcome on
+// the log. It reports whether the merchant acknowledged with a 2xx. A log
+// that already reached a terminal status is left untouched.
+func (s *webhookService) attemptDelivery(ctx context.Context, payloadBytes []byte, deliveryLog *domain.WebhookDeliveryLog, attempt int) bool {
+	if deliveryLog.Status.IsTerminal() {
+		return deliveryLog.Status == domain.WebhookStatusDelivered
+	}
+	deliveryLog.Attempt = attempt + 1
+	deliveryLog.UpdatedAt = time.Now()
 
-		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-			deliveryLog.Status = domain.WebhookStatusDelivered
-			deliveryLog.LastError = nil
-			deliveryLog.NextRetryAt = nil
-			s.persistLog(deliveryLog)
-			s.log.Info().Str("tx_id", txID.String()).Int("attempt", attempt+1).Int("status", resp.StatusCode).Msg("webhook: delivered successfully")
-			return
-		}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, deliveryLog.WebhookURL, bytes.NewReader(payloadBytes))
+	if err != nil {
+		errMsg := err.Error()
+		deliveryLog.LastError = &errMsg
+		s.persistLog(deliveryLog)
+		s.log.Error().Err(err).Func(deliveryFields(deliveryLog)).Msg("webhook: failed to create request")
+		return false
+	}
+	req.Header.Set("Content-Type", "application/json")
 
-		errMsg := fmt.Sprintf("HTTP %d", resp.StatusCode)
+	start := time.Now()
+	resp, err := s.httpClient.Do(req)
+	latency := time.Since(start)
+	if err != nil {
+		errMsg := err.Error()
 		deliveryLog.LastError = &errMsg
-		if attempt < len(webhookRetryIntervals) {
-			nextRetry := time.Now().Add(webhookRetryIntervals[attempt])
+		if attempt < len(s.retryIntervals) {
+			nextRetry := time.Now().Add(s.retryIntervals[attempt])
 			deliveryLog.NextRetryAt = &nextRetry
 		}
 		s.persistLog(deliveryLog)
-		s.log.Warn().Str("tx_id", txID.String()).Int("attempt", attempt+1).Int("status", resp.StatusCode).Msg("webhook: non-2xx response, retrying")
+		s.log.Warn().Err(err).Func(deliveryFields(deliveryLog)).Dur("latency_ms", latency).Msg("webhook: delivery failed")
+		return false
 	}
+	resp.Body.Close()
 
-	deliveryLog.Status = domain.WebhookStatusFailed
-	deliveryLog.NextRetryAt = nil
+	httpStatus := resp.StatusCode
+	deliveryLog.HTTPStatus = &httpStatus
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if err := deliveryLog.TransitionTo(domain.WebhookStatusDelivered); err != nil {
+			s.log.Warn().Err(err).Func(deliveryFields(deliveryLog)).Int("http_status", resp.StatusCode).Dur("latency_ms", latency).Msg("webhook: late 2xx ignored")
+			return false
+		}
+		deliveryLog.LastError = nil
+		deliveryLog.NextRetryAt = nil
+		s.persistLog(deliveryLog)
+		s.log.Info().Func(deliveryFields(deliveryLog)).Int("http_status", resp.StatusCode).Dur("latency_ms", latency).Msg("webhook: delivered successfully")
+		return true
+	}
+
+	errMsg := fmt.Sprintf("HTTP %d", resp.StatusCode)
+	deliveryLog.LastError = &errMsg
+	if attempt < len(s.retryIntervals) {
+		nextRetry := time.Now().Add(s.retryIntervals[attempt])
+		deliveryLog.NextRetryAt = &nextRetry
+	}
 	s.persistLog(deliveryLog)
-	s.log.Error().Str("tx_id", txID.String()).Msg("webhook: all retry attempts exhausted")
+	s.log.Warn().Func(deliveryFields(deliveryLog)).Int("http_status", resp.StatusCode).Dur("latency_ms", latency).Msg("webhook: non-2xx response, retrying")
+	return false
+}
+
+// deliveryFields adds the fields that correlate a delivery attempt log line
+// with its transaction and endpoint. Only the URL host is logged: paths and
+// query strings may carry merchant tokens, and the payload signature is never
+// logged.
+func deliveryFields(deliveryLog *domain.WebhookDeliveryLog) func(e *zerolog.Event) {
+	return func(e *zerolog.Event) {
+		e.Str("tx_id", deliveryLog.TransactionID.String()).
+			Str("merchant_id", deliveryLog.MerchantID.String()).
+			Str("url_host", webhookHost(deliveryLog.WebhookURL)).
+			Int("attempt", deliveryLog.Attempt)
+	}
+}
+
+// webhookHost returns the host of a webhook URL, or "" if it does not parse.
+func webhookHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// GetLastDelivery returns the most recently updated delivery log for the merchant.
+func (s *webhookService) GetLastDelivery(ctx context.Context, merchantID uuid.UUID) (*domain.WebhookDeliveryLog, error) {
+	if s.webhookRepo == nil {
+		return nil, nil
+	}
+	log, err := s.webhookRepo.GetLatestByMerchant(ctx, merchantID)
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("get last webhook delivery: %w", err))
+	}
+	return log, nil
+}
+
+// GetDelivery returns one delivery log, or nil if it does not exist or
+// belongs to another merchant, so callers cannot tell the two apart.
+func (s *webhookService) GetDelivery(ctx context.Context, merchantID, logID uuid.UUID) (*domain.WebhookDeliveryLog, error) {
+	if s.webhookRepo == nil {
+		return nil, nil
+	}
+	log, err := s.webhookRepo.GetByID(ctx, logID)
+	if err != nil {
+		return nil, apperror.InternalError(fmt.Errorf("get webhook delivery: %w", err))
+	}
+	if log == nil || log.MerchantID != merchantID {
+		return nil, nil
+	}
+	payload, err := s.openPayload(log.Payload)
+	if err != nil {
+		// The rest of the record is still useful; the payload is left out
+		s.log.Warn().Err(err).Str("log_id", log.ID.String()).Msg("webhook: failed to decrypt stored payload")
+	}
+	log.Payload = payload
+	return log, nil
+}
+
+// sealPayload returns a delivery log payload as stored. With payload
+// encryption it is the ciphertext as a JSON string, since the column is
+// JSONB; if encryption fails, "{}" is stored rather than plaintext.
+func (s *webhookService) sealPayload(payloadBytes []byte, txID uuid.UUID) string {
+	if !s.encryptPayloads {
+		return string(payloadBytes)
+	}
+	ciphertext, err := s.encSvc.Encrypt(string(payloadBytes))
+	if err != nil {
+		s.log.Error().Err(err).Str("tx_id", txID.String()).Msg("webhook: failed to encrypt payload, not storing it")
+		return "{}"
+	}
+	sealed, _ := json.Marshal(ciphertext)
+	return string(sealed)
+}
+
+// openPayload reverses sealPayload. A payload that is not a JSON string was
+// stored in plaintext and is returned as is. On error it returns "".
+func (s *webhookService) openPayload(stored string) (string, error) {
+	if !strings.HasPrefix(stored, `"`) {
+		return stored, nil
+	}
+	var ciphertext string
+	if err := json.Unmarshal([]byte(stored), &ciphertext); err != nil {
+		return "", fmt.Errorf("unwrap payload: %w", err)
+	}
+	plaintext, err := s.encSvc.Decrypt(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("decrypt payload: %w", err)
+	}
+	return plaintext, nil
 }
 
 func (s *webhookService) persistLog(log *domain.WebhookDeliveryLog) {
 	if s.webhookRepo == nil {
 		return
 	}
-	if err := s.webhookRepo.Update(context.Background(), log); err != nil {
+	err := s.webhookRepo.Update(context.Background(), log)
+	switch {
+	case errors.Is(err, domain.ErrInvalidWebhookTransition):
+		// Another writer already recorded a terminal status; it stands
+		s.log.Warn().Err(err).Str("log_id", log.ID.String()).Msg("webhook: delivery log already terminal, update dropped")
+	case err != nil:
 		s.log.Warn().Err(err).Str("log_id", log.ID.String()).Msg("webhook: failed to persist delivery log")
 	}
 }
@@ -1,10 +1,18 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -14,6 +22,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 )
 
@@ -50,7 +59,7 @@ func TestWebhookService_EnqueueWebhook_Success(t *testing.T) {
 		},
 	}
 
-	svc := NewWebhookService(mockMerchantRepo, mockWalletRepo, mockEncSvc, mockSigSvc, httpClient, newTestLogger())
+	svc := NewWebhookService(mockMerchantRepo, mockWalletRepo, mockEncSvc, mockSigSvc, httpClient, newTestLogger(), nil)
 
 	merchantID := uuid.New()
 	walletID := uuid.New()
@@ -91,6 +100,61 @@ func TestWebhookService_EnqueueWebhook_Success(t *testing.T) {
 	}
 }
 
+func TestWebhookService_DispatchWebhook_OutlivesCancelledRequest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMerchantRepo := mocks.NewMockMerchantRepository(ctrl)
+	mockWalletRepo := mocks.NewMockWalletRepository(ctrl)
+	mockEncSvc := mocks.NewMockEncryptionService(ctrl)
+	mockSigSvc := mocks.NewMockSignatureService(ctrl)
+
+	delivered := make(chan struct{}, 1)
+	httpClient := &mockHTTPClient{
+		doFunc: func(req *http.Request) (*http.Response, error) {
+			delivered <- struct{}{}
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(nil)}, nil
+		},
+	}
+	svc := NewWebhookService(mockMerchantRepo, mockWalletRepo, mockEncSvc, mockSigSvc, httpClient, newTestLogger(), nil)
+
+	merchantID := uuid.New()
+	walletID := uuid.New()
+	webhookURL := "https://merchant.example.com/webhook"
+	notCancelled := func(ctx context.Context) {
+		assert.NoError(t, ctx.Err(), "lookups must not use the request's cancellation")
+	}
+	mockMerchantRepo.EXPECT().GetByID(gomock.Any(), merchantID).DoAndReturn(
+		func(ctx context.Context, _ uuid.UUID) (*domain.Merchant, error) {
+			notCancelled(ctx)
+			return &domain.Merchant{ID: merchantID, SecretKeyEnc: "enc", WebhookURL: &webhookURL}, nil
+		},
+	)
+	mockWalletRepo.EXPECT().GetByID(gomock.Any(), walletID).DoAndReturn(
+		func(ctx context.Context, _ uuid.UUID) (*domain.Wallet, error) {
+			notCancelled(ctx)
+			return &domain.Wallet{ID: walletID, Currency: "VND"}, nil
+		},
+	)
+	mockEncSvc.EXPECT().Decrypt("enc").Return("key", nil)
+	mockSigSvc.EXPECT().Sign("key", gomock.Any()).Return("sig")
+
+	// The payment committed, then the client disconnected
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := svc.DispatchWebhook(ctx, &domain.Transaction{
+		ID: uuid.New(), MerchantID: merchantID, WalletID: walletID, Amount: 50000,
+		TransactionType: domain.TransactionTypePayment, Status: domain.TransactionStatusSuccess,
+	})
+	require.NoError(t, err)
+
+	select {
+	case <-delivered:
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook delivery timed out")
+	}
+}
+
 func TestWebhookService_EnqueueWebhook_NoWebhookURL(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -107,7 +171,7 @@ func TestWebhookService_EnqueueWebhook_NoWebhookURL(t *testing.T) {
 		},
 	}
 
-	svc := NewWebhookService(mockMerchantRepo, mockWalletRepo, mockEncSvc, mockSigSvc, httpClient, newTestLogger())
+	svc := NewWebhookService(mockMerchantRepo, mockWalletRepo, mockEncSvc, mockSigSvc, httpClient, newTestLogger(), nil)
 
 	merchantID := uuid.New()
 	mockMerchantRepo.EXPECT().GetByID(gomock.Any(), merchantID).Return(&domain.Merchant{
@@ -141,7 +205,7 @@ func TestWebhookService_EnqueueWebhook_MerchantNotFound(t *testing.T) {
 		},
 	}
 
-	svc := NewWebhookService(mockMerchantRepo, mockWalletRepo, mockEncSvc, mockSigSvc, httpClient, newTestLogger())
+	svc := NewWebhookService(mockMerchantRepo, mockWalletRepo, mockEncSvc, mockSigSvc, httpClient, newTestLogger(), nil)
 
 	merchantID := uuid.New()
 	mockMerchantRepo.EXPECT().GetByID(gomock.Any(), merchantID).Return(nil, errors.New("db error"))
@@ -171,7 +235,7 @@ func TestWebhookService_EnqueueWebhook_DecryptError(t *testing.T) {
 		},
 	}
 
-	svc := NewWebhookService(mockMerchantRepo, mockWalletRepo, mockEncSvc, mockSigSvc, httpClient, newTestLogger())
+	svc := NewWebhookService(mockMerchantRepo, mockWalletRepo, mockEncSvc, mockSigSvc, httpClient, newTestLogger(), nil)
 
 	merchantID := uuid.New()
 	walletID := uuid.New()
@@ -222,7 +286,7 @@ func TestWebhookService_EventType_Refund(t *testing.T) {
 		},
 	}
 
-	svc := NewWebhookService(mockMerchantRepo, mockWalletRepo, mockEncSvc, mockSigSvc, httpClient, newTestLogger())
+	svc := NewWebhookService(mockMerchantRepo, mockWalletRepo, mockEncSvc, mockSigSvc, httpClient, newTestLogger(), nil)
 
 	merchantID := uuid.New()
 	walletID := uuid.New()
@@ -355,12 +419,9 @@ func TestWebhookService_PersistsFailedDelivery(t *testing.T) {
 		},
 	}
 
-	// Override retry intervals to make test fast
-	orig := webhookRetryIntervals
-	webhookRetryIntervals = []time.Duration{1 * time.Millisecond}
-	defer func() { webhookRetryIntervals = orig }()
-
-	svc := NewWebhookService(mockMerchantRepo, mockWalletRepo, mockEncSvc, mockSigSvc, httpClient, newTestLogger(), mockWebhookRepo)
+	// Shorten the retry schedule to make test fast
+	svc := NewWebhookService(mockMerchantRepo, mockWalletRepo, mockEncSvc, mockSigSvc, httpClient, newTestLogger(), mockWebhookRepo,
+		WithWebhookRetryIntervals([]time.Duration{time.Millisecond}))
 
 	merchantID := uuid.New()
 	walletID := uuid.New()
@@ -409,3 +470,652 @@ func TestWebhookService_PersistsFailedDelivery(t *testing.T) {
 		t.Fatal("webhook retry timed out")
 	}
 }
+
+// deliverWithPinnedVersion enqueues a webhook for a merchant pinned to version
+// and returns the decoded JSON body that was POSTed.
+func deliverWithPinnedVersion(t *testing.T, version *string, tx *domain.Transaction) map[string]interface{} {
+	t.Helper()
+	return deliverWithPayloadMode(t, version, "", tx)
+}
+
+// deliverWithPayloadMode is deliverWithPinnedVersion for a merchant with the
+// given webhook payload mode.
+func deliverWithPayloadMode(t *testing.T, version *string, mode domain.WebhookPayloadMode, tx *domain.Transaction) map[string]interface{} {
+	t.Helper()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMerchantRepo := mocks.NewMockMerchantRepository(ctrl)
+	mockWalletRepo := mocks.NewMockWalletRepository(ctrl)
+	mockEncSvc := mocks.NewMockEncryptionService(ctrl)
+	mockSigSvc := mocks.NewMockSignatureService(ctrl)
+
+	bodies := make(chan []byte, 1)
+	httpClient := &mockHTTPClient{
+		doFunc: func(req *http.Request) (*http.Response, error) {
+			b, _ := io.ReadAll(req.Body)
+			bodies <- b
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(nil)}, nil
+		},
+	}
+
+	svc := NewWebhookService(mockMerchantRepo, mockWalletRepo, mockEncSvc, mockSigSvc, httpClient, newTestLogger(), nil)
+
+	webhookURL := "https://merchant.example.com/webhook"
+	mockMerchantRepo.EXPECT().GetByID(gomock.Any(), tx.MerchantID).Return(&domain.Merchant{
+		ID:                 tx.MerchantID,
+		SecretKeyEnc:       "enc",
+		WebhookURL:         &webhookURL,
+		WebhookVersion:     version,
+		WebhookPayloadMode: mode,
+	}, nil)
+	mockWalletRepo.EXPECT().GetByID(gomock.Any(), tx.WalletID).Return(&domain.Wallet{ID: tx.WalletID, Currency: "VND"}, nil)
+	mockEncSvc.EXPECT().Decrypt("enc").Return("key", nil)
+	mockSigSvc.EXPECT().Sign("key", gomock.Any()).Return("sig")
+
+	require.NoError(t, svc.EnqueueWebhook(context.Background(), tx))
+
+	select {
+	case b := <-bodies:
+		var payload map[string]interface{}
+		require.NoError(t, json.Unmarshal(b, &payload))
+		return payload
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook delivery timed out")
+		return nil
+	}
+}
+
+func TestWebhookService_PinnedVersionsProduceTheirShapes(t *testing.T) {
+	now := time.Now()
+	tx := &domain.Transaction{
+		ID:              uuid.New(),
+		ReferenceID:     "ORDER-42",
+		MerchantID:      uuid.New(),
+		WalletID:        uuid.New(),
+		Amount:          75000,
+		TransactionType: domain.TransactionTypePayment,
+		Status:          domain.TransactionStatusSuccess,
+		CreatedAt:       now,
+		ProcessedAt:     &now,
+	}
+
+	v1 := WebhookVersion202401
+	payload := deliverWithPinnedVersion(t, &v1, tx)
+	assert.Equal(t, "2024-01", payload["version"])
+	data := payload["data"].(map[string]interface{})
+	assert.Equal(t, "ORDER-42", data["merchant_order_id"])
+	assert.Equal(t, tx.ID.String(), data["gateway_transaction_id"])
+	assert.Contains(t, data, "reason")
+	assert.NotContains(t, data, "transaction_type")
+
+	v2 := WebhookVersion202501
+	payload = deliverWithPinnedVersion(t, &v2, tx)
+	assert.Equal(t, "2025-01", payload["version"])
+	data = payload["data"].(map[string]interface{})
+	assert.Equal(t, "ORDER-42", data["reference_id"])
+	assert.Equal(t, tx.ID.String(), data["transaction_id"])
+	assert.Equal(t, "PAYMENT", data["transaction_type"])
+	assert.Contains(t, data, "processed_at")
+	assert.NotContains(t, data, "merchant_order_id")
+}
+
+func TestWebhookService_MinimalPayloadModeOmitsAmounts(t *testing.T) {
+	now := time.Now()
+	tx := &domain.Transaction{
+		ID:              uuid.New(),
+		ReferenceID:     "ORDER-42",
+		MerchantID:      uuid.New(),
+		WalletID:        uuid.New(),
+		Amount:          75000,
+		TransactionType: domain.TransactionTypePayment,
+		Status:          domain.TransactionStatusSuccess,
+		CreatedAt:       now,
+		ProcessedAt:     &now,
+	}
+
+	v1 := WebhookVersion202401
+	payload := deliverWithPayloadMode(t, &v1, domain.WebhookPayloadMinimal, tx)
+	assert.Equal(t, "2024-01", payload["version"])
+	data := payload["data"].(map[string]interface{})
+	assert.Equal(t, "ORDER-42", data["merchant_order_id"])
+	assert.Equal(t, tx.ID.String(), data["gateway_transaction_id"])
+	assert.Equal(t, "SUCCESS", data["status"])
+	assert.Contains(t, data, "timestamp")
+	assert.NotContains(t, data, "amount")
+	assert.NotContains(t, data, "currency")
+	assert.NotContains(t, data, "reason")
+
+	v2 := WebhookVersion202501
+	payload = deliverWithPayloadMode(t, &v2, domain.WebhookPayloadMinimal, tx)
+	assert.Equal(t, "2025-01", payload["version"])
+	data = payload["data"].(map[string]interface{})
+	assert.Equal(t, "ORDER-42", data["reference_id"])
+	assert.Equal(t, tx.ID.String(), data["transaction_id"])
+	assert.Equal(t, "PAYMENT", data["transaction_type"])
+	assert.Equal(t, "SUCCESS", data["status"])
+	assert.NotContains(t, data, "amount")
+	assert.NotContains(t, data, "currency")
+	assert.NotContains(t, data, "created_at")
+	assert.NotContains(t, data, "processed_at")
+}
+
+func TestWebhookService_FullPayloadModeKeepsAmounts(t *testing.T) {
+	tx := &domain.Transaction{
+		ID:              uuid.New(),
+		ReferenceID:     "ORDER-43",
+		MerchantID:      uuid.New(),
+		WalletID:        uuid.New(),
+		Amount:          75000,
+		TransactionType: domain.TransactionTypePayment,
+		Status:          domain.TransactionStatusSuccess,
+		CreatedAt:       time.Now(),
+	}
+
+	for _, version := range []string{WebhookVersion202401, WebhookVersion202501} {
+		v := version
+		data := deliverWithPayloadMode(t, &v, domain.WebhookPayloadFull, tx)["data"].(map[string]interface{})
+		assert.Equal(t, float64(75000), data["amount"], version)
+		assert.Equal(t, "VND", data["currency"], version)
+	}
+}
+
+func TestWebhookService_ZeroProcessedAtIsOmitted(t *testing.T) {
+	var zero time.Time
+	tx := &domain.Transaction{
+		ID:              uuid.New(),
+		MerchantID:      uuid.New(),
+		WalletID:        uuid.New(),
+		Amount:          1000,
+		TransactionType: domain.TransactionTypePayment,
+		Status:          domain.TransactionStatusSuccess,
+		CreatedAt:       time.Now(),
+		ProcessedAt:     &zero,
+	}
+
+	v2 := WebhookVersion202501
+	data := deliverWithPinnedVersion(t, &v2, tx)["data"].(map[string]interface{})
+	assert.NotContains(t, data, "processed_at")
+}
+
+func TestWebhookService_UnpinnedOrUnknownVersionUsesDefault(t *testing.T) {
+	tx := &domain.Transaction{
+		ID:              uuid.New(),
+		MerchantID:      uuid.New(),
+		WalletID:        uuid.New(),
+		Amount:          1000,
+		TransactionType: domain.TransactionTypeTopup,
+		Status:          domain.TransactionStatusSuccess,
+	}
+
+	payload := deliverWithPinnedVersion(t, nil, tx)
+	assert.Equal(t, DefaultWebhookVersion, payload["version"])
+
+	unknown := "1999-01"
+	payload = deliverWithPinnedVersion(t, &unknown, tx)
+	assert.Equal(t, DefaultWebhookVersion, payload["version"])
+}
+
+func setupSyncWebhook(t *testing.T, httpClient HTTPClient) (*webhookService, *domain.Transaction) {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	mockMerchantRepo := mocks.NewMockMerchantRepository(ctrl)
+	mockWalletRepo := mocks.NewMockWalletRepository(ctrl)
+	mockEncSvc := mocks.NewMockEncryptionService(ctrl)
+	mockSigSvc := mocks.NewMockSignatureService(ctrl)
+
+	svc := NewWebhookService(mockMerchantRepo, mockWalletRepo, mockEncSvc, mockSigSvc, httpClient, newTestLogger(), nil).(*webhookService)
+	svc.syncTimeout = 50 * time.Millisecond
+	t.Cleanup(svc.Stop)
+
+	merchantID := uuid.New()
+	walletID := uuid.New()
+	webhookURL := "https://merchant.example.com/webhook"
+
+	mockMerchantRepo.EXPECT().GetByID(gomock.Any(), merchantID).Return(&domain.Merchant{
+		ID:                 merchantID,
+		SecretKeyEnc:       "encrypted-secret",
+		WebhookURL:         &webhookURL,
+		SynchronousWebhook: true,
+	}, nil)
+	mockWalletRepo.EXPECT().GetByID(gomock.Any(), walletID).Return(&domain.Wallet{ID: walletID, Currency: "VND"}, nil)
+	mockEncSvc.EXPECT().Decrypt("encrypted-secret").Return("secret-key", nil)
+	mockSigSvc.EXPECT().Sign("secret-key", gomock.Any()).Return("signature-hash")
+
+	return svc, &domain.Transaction{
+		ID:              uuid.New(),
+		ReferenceID:     "ref-sync",
+		MerchantID:      merchantID,
+		WalletID:        walletID,
+		Amount:          50000,
+		TransactionType: domain.TransactionTypePayment,
+		Status:          domain.TransactionStatusSuccess,
+		CreatedAt:       time.Now(),
+	}
+}
+
+func TestWebhookService_DispatchWebhook_SyncDelivered(t *testing.T) {
+	calls := 0
+	svc, tx := setupSyncWebhook(t, &mockHTTPClient{
+		doFunc: func(req *http.Request) (*http.Response, error) {
+			calls++
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(nil)}, nil
+		},
+	})
+
+	result, err := svc.DispatchWebhook(context.Background(), tx)
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.True(t, result.Synchronous)
+	assert.True(t, result.Delivered)
+	require.NotNil(t, result.HTTPStatus)
+	assert.Equal(t, 200, *result.HTTPStatus)
+	assert.Nil(t, result.Error)
+	assert.Equal(t, 1, calls, "delivery happens before DispatchWebhook returns")
+}
+
+func TestWebhookService_DispatchWebhook_SyncTimeout(t *testing.T) {
+	var calls atomic.Int32
+	svc, tx := setupSyncWebhook(t, &mockHTTPClient{
+		doFunc: func(req *http.Request) (*http.Response, error) {
+			calls.Add(1)
+			// Merchant endpoint hangs past the sync timeout
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		},
+	})
+
+	start := time.Now()
+	result, err := svc.DispatchWebhook(context.Background(), tx)
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), time.Second, "sync attempt must be bounded")
+
+	require.NotNil(t, result)
+	assert.True(t, result.Synchronous)
+	assert.False(t, result.Delivered)
+	assert.Nil(t, result.HTTPStatus)
+	require.NotNil(t, result.Error)
+	assert.Contains(t, *result.Error, "deadline exceeded")
+
+	// The background retry is waiting 15s for its next attempt; Stop ends it
+	start = time.Now()
+	svc.Stop()
+	assert.Less(t, time.Since(start), time.Second, "a waiting retry stops at once")
+	assert.Equal(t, int32(1), calls.Load(), "no retry is sent after Stop")
+}
+
+func TestWebhookService_TestFireWebhook_IncludesSigningInput(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMerchantRepo := mocks.NewMockMerchantRepository(ctrl)
+	mockEncSvc := mocks.NewMockEncryptionService(ctrl)
+	sigSvc := NewHMACSignatureService()
+
+	var sent []byte
+	svc := NewWebhookService(mockMerchantRepo, mocks.NewMockWalletRepository(ctrl), mockEncSvc, sigSvc, &mockHTTPClient{
+		doFunc: func(req *http.Request) (*http.Response, error) {
+			sent, _ = io.ReadAll(req.Body)
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(nil)}, nil
+		},
+	}, newTestLogger(), nil)
+
+	merchantID := uuid.New()
+	webhookURL := "https://merchant.example.com/webhook"
+	mockMerchantRepo.EXPECT().GetByID(gomock.Any(), merchantID).Return(&domain.Merchant{
+		ID: merchantID, SecretKeyEnc: "encrypted-secret", WebhookURL: &webhookURL,
+	}, nil)
+	mockEncSvc.EXPECT().Decrypt("encrypted-secret").Return("secret-key", nil)
+
+	result, err := svc.TestFireWebhook(context.Background(), merchantID)
+	require.NoError(t, err)
+	assert.True(t, result.Delivered)
+	assert.Equal(t, sent, result.Payload, "the reported payload is the body sent")
+
+	var payload struct {
+		Data      json.RawMessage `json:"data"`
+		Signature string          `json:"signature"`
+	}
+	require.NoError(t, json.Unmarshal(sent, &payload))
+	assert.JSONEq(t, string(payload.Data), result.SigningInput)
+	assert.True(t, sigSvc.Verify("secret-key", result.SigningInput, payload.Signature),
+		"the signature is computed over exactly the signing input")
+	assert.NotContains(t, string(sent), "signing_input", "the merchant endpoint gets a normal payload")
+}
+
+func TestWebhookService_TestFireWebhook_NoWebhookURL(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMerchantRepo := mocks.NewMockMerchantRepository(ctrl)
+	svc := NewWebhookService(mockMerchantRepo, nil, nil, nil, &mockHTTPClient{}, newTestLogger(), nil)
+
+	merchantID := uuid.New()
+	mockMerchantRepo.EXPECT().GetByID(gomock.Any(), merchantID).Return(&domain.Merchant{ID: merchantID}, nil)
+
+	result, err := svc.TestFireWebhook(context.Background(), merchantID)
+	assert.Nil(t, result)
+	assertAppError(t, err, "PAY_002")
+}
+
+func TestWebhookService_LiveDeliveryOmitsSigningInput(t *testing.T) {
+	var sent []byte
+	svc, tx := setupSyncWebhook(t, &mockHTTPClient{
+		doFunc: func(req *http.Request) (*http.Response, error) {
+			sent, _ = io.ReadAll(req.Body)
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(nil)}, nil
+		},
+	})
+
+	result, err := svc.DispatchWebhook(context.Background(), tx)
+	require.NoError(t, err)
+	require.True(t, result.Delivered)
+
+	var envelope map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(sent, &envelope))
+	assert.ElementsMatch(t, []string{"version", "event_type", "data", "signature"}, mapKeys(envelope))
+	assert.NotContains(t, string(sent), "signing_input")
+}
+
+func mapKeys(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func TestWebhookService_DispatchWebhook_AsyncByDefault(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMerchantRepo := mocks.NewMockMerchantRepository(ctrl)
+	mockWalletRepo := mocks.NewMockWalletRepository(ctrl)
+	mockEncSvc := mocks.NewMockEncryptionService(ctrl)
+	mockSigSvc := mocks.NewMockSignatureService(ctrl)
+
+	delivered := make(chan struct{}, 1)
+	httpClient := &mockHTTPClient{
+		doFunc: func(req *http.Request) (*http.Response, error) {
+			delivered <- struct{}{}
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(nil)}, nil
+		},
+	}
+	svc := NewWebhookService(mockMerchantRepo, mockWalletRepo, mockEncSvc, mockSigSvc, httpClient, newTestLogger(), nil)
+
+	merchantID := uuid.New()
+	webhookURL := "https://merchant.example.com/webhook"
+	mockMerchantRepo.EXPECT().GetByID(gomock.Any(), merchantID).Return(&domain.Merchant{
+		ID: merchantID, SecretKeyEnc: "encrypted-secret", WebhookURL: &webhookURL,
+	}, nil)
+	mockWalletRepo.EXPECT().GetByID(gomock.Any(), gomock.Any()).Return(nil, nil)
+	mockEncSvc.EXPECT().Decrypt("encrypted-secret").Return("secret-key", nil)
+	mockSigSvc.EXPECT().Sign("secret-key", gomock.Any()).Return("signature-hash")
+
+	result, err := svc.DispatchWebhook(context.Background(), &domain.Transaction{
+		ID: uuid.New(), MerchantID: merchantID, TransactionType: domain.TransactionTypePayment, Status: domain.TransactionStatusSuccess,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, result)
+
+	select {
+	case <-delivered:
+	case <-time.After(2 * time.Second):
+		t.Fatal("async webhook was not delivered")
+	}
+}
+
+func TestWebhookService_EventCatalog_CoversAllEventConstants(t *testing.T) {
+	// Collect every Event* constant declared in webhook_service.go
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "webhook_service.go", nil, 0)
+	require.NoError(t, err)
+
+	var declared []string
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			for i, name := range spec.(*ast.ValueSpec).Names {
+				if !strings.HasPrefix(name.Name, "Event") {
+					continue
+				}
+				lit := spec.(*ast.ValueSpec).Values[i].(*ast.BasicLit)
+				value, err := strconv.Unquote(lit.Value)
+				require.NoError(t, err)
+				declared = append(declared, value)
+			}
+		}
+	}
+	require.NotEmpty(t, declared)
+
+	svc := NewWebhookService(nil, nil, nil, nil, nil, newTestLogger(), nil)
+	catalog := svc.EventCatalog()
+
+	listed := make([]string, 0, len(catalog.Events))
+	for _, ev := range catalog.Events {
+		listed = append(listed, ev.Type)
+		assert.NotEmpty(t, ev.Trigger, ev.Type)
+	}
+	assert.ElementsMatch(t, declared, listed)
+}
+
+func TestWebhookService_EventCatalog_DescribesEveryVersion(t *testing.T) {
+	svc := NewWebhookService(nil, nil, nil, nil, nil, newTestLogger(), nil)
+	catalog := svc.EventCatalog()
+
+	assert.Equal(t, DefaultWebhookVersion, catalog.DefaultVersion)
+	assert.Equal(t, LatestWebhookVersion, catalog.LatestVersion)
+	require.Len(t, catalog.Versions, len(webhookSerializers))
+
+	for _, v := range catalog.Versions {
+		_, ok := webhookSerializers[v.Version]
+		assert.True(t, ok, v.Version)
+		assert.NotEmpty(t, v.Fields, v.Version)
+		for _, f := range v.Fields {
+			if f.Name == "amount" {
+				assert.Equal(t, "number", f.Type, v.Version) // fractional on decimal-balance wallets
+			}
+		}
+	}
+
+	// Catalog fields match what the serializer actually emits
+	tx := &domain.Transaction{ID: uuid.New(), CreatedAt: time.Now()}
+	for _, v := range catalog.Versions {
+		raw, err := json.Marshal(webhookSerializers[v.Version](webhookEvent{Transaction: tx}))
+		require.NoError(t, err)
+		var emitted map[string]any
+		require.NoError(t, json.Unmarshal(raw, &emitted))
+		for _, f := range v.Fields {
+			if !f.Optional {
+				assert.Contains(t, emitted, f.Name, "%s.%s", v.Version, f.Name)
+			}
+		}
+	}
+
+	// Minimal fields likewise match the minimal serializer
+	require.Len(t, webhookMinimalSerializers, len(webhookSerializers))
+	for _, v := range catalog.Versions {
+		assert.NotEmpty(t, v.MinimalFields, v.Version)
+		raw, err := json.Marshal(webhookMinimalSerializers[v.Version](webhookEvent{Transaction: tx}))
+		require.NoError(t, err)
+		var emitted map[string]any
+		require.NoError(t, json.Unmarshal(raw, &emitted))
+		for _, f := range v.MinimalFields {
+			if !f.Optional {
+				assert.Contains(t, emitted, f.Name, "%s.%s (minimal)", v.Version, f.Name)
+			}
+		}
+		assert.NotContains(t, emitted, "amount", v.Version)
+	}
+
+	envelope := make([]string, 0, len(catalog.Envelope))
+	for _, f := range catalog.Envelope {
+		envelope = append(envelope, f.Name)
+	}
+	assert.Equal(t, []string{"version", "event_type", "data", "signature"}, envelope)
+}
+
+func TestWebhookService_TerminalLogIsNotReattemptedOrFlipped(t *testing.T) {
+	calls := 0
+	svc := &webhookService{
+		httpClient: &mockHTTPClient{doFunc: func(req *http.Request) (*http.Response, error) {
+			calls++
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(nil)}, nil
+		}},
+		log:            newTestLogger(),
+		retryIntervals: []time.Duration{time.Millisecond},
+	}
+
+	// A late 2xx can't flip FAILED to DELIVERED
+	failed := &domain.WebhookDeliveryLog{ID: uuid.New(), WebhookURL: "https://merchant.example.com/webhook", Status: domain.WebhookStatusFailed, Attempt: 2}
+	assert.False(t, svc.attemptDelivery(context.Background(), []byte(`{}`), failed, 2))
+	assert.Equal(t, domain.WebhookStatusFailed, failed.Status)
+	assert.Equal(t, 2, failed.Attempt)
+
+	// Exhausting retries can't flip DELIVERED to FAILED
+	delivered := &domain.WebhookDeliveryLog{ID: uuid.New(), WebhookURL: "https://merchant.example.com/webhook", Status: domain.WebhookStatusDelivered}
+	svc.retryFrom(context.Background(), []byte(`{}`), delivered, 1)
+	assert.Equal(t, domain.WebhookStatusDelivered, delivered.Status)
+
+	assert.Zero(t, calls, "terminal logs are never re-sent")
+}
+
+func TestWebhookService_RepoRejectedTransitionIsDropped(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockWebhookRepo := mocks.NewMockWebhookRepository(ctrl)
+	svc := &webhookService{
+		httpClient: &mockHTTPClient{doFunc: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(nil)}, nil
+		}},
+		log:         newTestLogger(),
+		webhookRepo: mockWebhookRepo,
+	}
+
+	// Another writer already stored FAILED; our late DELIVERED is refused
+	mockWebhookRepo.EXPECT().Update(gomock.Any(), gomock.Any()).Return(domain.ErrInvalidWebhookTransition)
+
+	pending := &domain.WebhookDeliveryLog{ID: uuid.New(), WebhookURL: "https://merchant.example.com/webhook", Status: domain.WebhookStatusPending}
+	assert.True(t, svc.attemptDelivery(context.Background(), []byte(`{}`), pending, 0))
+}
+
+func TestWebhookService_GetDelivery_ScopedToMerchant(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockWebhookRepo := mocks.NewMockWebhookRepository(ctrl)
+	svc := &webhookService{log: newTestLogger(), webhookRepo: mockWebhookRepo}
+
+	owner := uuid.New()
+	log := &domain.WebhookDeliveryLog{ID: uuid.New(), MerchantID: owner, Status: domain.WebhookStatusDelivered}
+	mockWebhookRepo.EXPECT().GetByID(gomock.Any(), log.ID).Return(log, nil).Times(2)
+	missing := uuid.New()
+	mockWebhookRepo.EXPECT().GetByID(gomock.Any(), missing).Return(nil, nil)
+
+	got, err := svc.GetDelivery(context.Background(), owner, log.ID)
+	require.NoError(t, err)
+	assert.Same(t, log, got)
+
+	// Another merchant's log looks the same as a missing one
+	got, err = svc.GetDelivery(context.Background(), uuid.New(), log.ID)
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	got, err = svc.GetDelivery(context.Background(), owner, missing)
+	require.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestWebhookService_EncryptedPayloadDecryptedForOwnerOnly(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	encSvc, err := NewAESEncryptionService(testAESKey)
+	require.NoError(t, err)
+	mockWebhookRepo := mocks.NewMockWebhookRepository(ctrl)
+	svc := NewWebhookService(nil, nil, encSvc, nil, nil, newTestLogger(), mockWebhookRepo,
+		WithPayloadEncryption(true),
+	).(*webhookService)
+
+	plaintext := `{"event_type":"PAYMENT_UPDATE","data":{"amount":500000}}`
+	var stored *domain.WebhookDeliveryLog
+	mockWebhookRepo.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, log *domain.WebhookDeliveryLog) error {
+			copied := *log
+			stored = &copied
+			return nil
+		},
+	)
+	owner := uuid.New()
+	deliveryLog := svc.newDeliveryLog("https://merchant.example.com/webhook", []byte(plaintext), uuid.New(), owner)
+	require.NotNil(t, stored)
+
+	// At rest: a JSON string (the column is JSONB) holding ciphertext
+	assert.NotContains(t, stored.Payload, "500000")
+	var ciphertext string
+	require.NoError(t, json.Unmarshal([]byte(stored.Payload), &ciphertext))
+	decrypted, err := encSvc.Decrypt(ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, decrypted)
+
+	mockWebhookRepo.EXPECT().GetByID(gomock.Any(), deliveryLog.ID).Return(stored, nil)
+	got, err := svc.GetDelivery(context.Background(), owner, deliveryLog.ID)
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, plaintext, got.Payload)
+}
+
+func TestWebhookService_PlaintextPayloadReadWithEncryptionOn(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockWebhookRepo := mocks.NewMockWebhookRepository(ctrl)
+	svc := &webhookService{log: newTestLogger(), webhookRepo: mockWebhookRepo, encryptPayloads: true}
+
+	// Logged before encryption was turned on
+	owner := uuid.New()
+	log := &domain.WebhookDeliveryLog{ID: uuid.New(), MerchantID: owner, Payload: `{"data":{}}`}
+	mockWebhookRepo.EXPECT().GetByID(gomock.Any(), log.ID).Return(log, nil)
+
+	got, err := svc.GetDelivery(context.Background(), owner, log.ID)
+	require.NoError(t, err)
+	assert.Equal(t, `{"data":{}}`, got.Payload)
+}
+
+func TestWebhookService_DeliveryLogLineIsStructured(t *testing.T) {
+	var buf bytes.Buffer
+	svc := &webhookService{
+		httpClient: &mockHTTPClient{doFunc: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(nil)}, nil
+		}},
+		log: zerolog.New(&buf),
+	}
+
+	deliveryLog := &domain.WebhookDeliveryLog{
+		ID:            uuid.New(),
+		TransactionID: uuid.New(),
+		MerchantID:    uuid.New(),
+		WebhookURL:    "https://merchant.example.com/hooks/payments?token=s3cret",
+		Status:        domain.WebhookStatusPending,
+	}
+	payload := []byte(`{"data":{},"signature":"deadbeefsignature"}`)
+	require.True(t, svc.attemptDelivery(context.Background(), payload, deliveryLog, 1))
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "info", entry["level"])
+	assert.Equal(t, deliveryLog.TransactionID.String(), entry["tx_id"])
+	assert.Equal(t, deliveryLog.MerchantID.String(), entry["merchant_id"])
+	assert.Equal(t, "merchant.example.com", entry["url_host"])
+	assert.EqualValues(t, 2, entry["attempt"])
+	assert.EqualValues(t, 200, entry["http_status"])
+	assert.Contains(t, entry, "latency_ms")
+
+	assert.NotContains(t, buf.String(), "deadbeefsignature")
+	assert.NotContains(t, buf.String(), "s3cret")
+}
@@ -0,0 +1,65 @@
+package apperror
+
+import "sort"
+
+// CatalogEntry describes one error code returned by the API.
+type CatalogEntry struct {
+	Code       string
+	Message    string // {placeholders} mark the parts filled in per error
+	HTTPStatus int
+}
+
+// Catalog lists every error code, one entry per code, sorted by code.
+// Entries are built by calling the constructors themselves so the catalog
+// cannot drift from what handlers actually return. Where several
+// constructors share a code, the first listed (the most general) wins.
+func Catalog() []CatalogEntry {
+	errs := []*AppError{
+		ErrInvalidAccessKey(),
+		ErrInvalidSignature(),
+		ErrTimestampExpired(),
+		ErrNonceUsed(),
+		ErrSecretKeyExpired(),
+		ErrTLSRequired(),
+		ErrInsufficientFunds(),
+		Validation("{detail}"),
+		ErrInvalidAmount(),
+		ErrDuplicateTransaction(),
+		ErrWalletExists("{currency}"),
+		ErrRequestInProgress(),
+		ErrNotFound("{entity}"),
+		ErrTransactionLimitExceeded(),
+		ErrInvalidRefund(),
+		ErrInvalidReversal(),
+		ErrRefundLimitReached(0),
+		ErrRefundAmountExceedsOriginal(),
+		ErrReferenceCollision("{reference_id}", "{type}", "{wanted_type}"),
+		ErrIdempotencyMismatch(),
+		ErrInvalidCredentials(),
+		ErrUsernameExists(),
+		ErrInvalidToken(),
+		ErrMerchantSuspended(),
+		ErrInvalidAdminKey(),
+		ErrRateLimitExceeded(),
+		ErrRouteNotFound(),
+		ErrMethodNotAllowed(),
+		InternalError(nil),
+		ErrDatabaseError(nil),
+		ErrLockTimeout(nil),
+		ErrEncryptionFailure(nil),
+		ErrDataIntegrity(nil),
+		ErrServerOverloaded(),
+	}
+
+	seen := make(map[string]bool, len(errs))
+	entries := make([]CatalogEntry, 0, len(errs))
+	for _, e := range errs {
+		if seen[e.Code] {
+			continue
+		}
+		seen[e.Code] = true
+		entries = append(entries, CatalogEntry{Code: e.Code, Message: e.Message, HTTPStatus: e.HTTPStatus})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Code < entries[j].Code })
+	return entries
+}
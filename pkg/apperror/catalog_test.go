@@ -0,0 +1,59 @@
+package apperror
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCatalog_CoversEveryDeclaredCode(t *testing.T) {
+	// Collect the code literal passed to every New/Wrap call in errors.go
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "errors.go", nil, 0)
+	require.NoError(t, err)
+
+	declared := map[string]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		fn, ok := call.Fun.(*ast.Ident)
+		if !ok || (fn.Name != "New" && fn.Name != "Wrap") {
+			return true
+		}
+		if lit, ok := call.Args[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			code, err := strconv.Unquote(lit.Value)
+			require.NoError(t, err)
+			declared[code] = true
+		}
+		return true
+	})
+	require.NotEmpty(t, declared)
+
+	listed := map[string]bool{}
+	for _, e := range Catalog() {
+		assert.False(t, listed[e.Code], "duplicate %s", e.Code)
+		listed[e.Code] = true
+		assert.NotEmpty(t, e.Message, e.Code)
+		assert.NotZero(t, e.HTTPStatus, e.Code)
+	}
+	assert.Equal(t, declared, listed)
+}
+
+func TestCatalog_KnownEntries(t *testing.T) {
+	byCode := map[string]CatalogEntry{}
+	for _, e := range Catalog() {
+		byCode[e.Code] = e
+	}
+
+	assert.Equal(t, CatalogEntry{Code: "PAY_001", Message: "Insufficient balance in wallet", HTTPStatus: 402}, byCode["PAY_001"])
+	assert.Equal(t, "{detail}", byCode["PAY_002"].Message, "the generic validation template wins")
+	assert.Equal(t, "{entity} not found", byCode["PAY_004"].Message)
+	assert.Equal(t, 503, byCode["SYS_006"].HTTPStatus)
+}
@@ -61,6 +61,14 @@ func ErrNonceUsed() *AppError {
 	return New("SEC_004", "Nonce has already been used", http.StatusForbidden)
 }
 
+func ErrSecretKeyExpired() *AppError {
+	return New("SEC_005", "Secret key has expired; rotate keys", http.StatusForbidden)
+}
+
+func ErrTLSRequired() *AppError {
+	return New("SEC_006", "HTTPS is required", http.StatusForbidden)
+}
+
 // ---- Payment Business Logic (PAY) ----
 
 func ErrInsufficientFunds() *AppError {
@@ -83,14 +91,48 @@ func ErrTransactionLimitExceeded() *AppError {
 	return New("PAY_005", "Transaction limit exceeded", http.StatusUnprocessableEntity)
 }
 
+// ErrRequestInProgress reports a request whose Idempotency-Key another
+// request is still processing. Retrying once it finishes replays its result.
+func ErrRequestInProgress() *AppError {
+	return New("PAY_003", "A request with this Idempotency-Key is still in progress", http.StatusConflict)
+}
+
+// ErrWalletExists reports a wallet creation for a currency the merchant
+// already holds a wallet in.
+func ErrWalletExists(currency string) *AppError {
+	return New("PAY_003", fmt.Sprintf("Wallet already exists for %s", currency), http.StatusConflict)
+}
+
 func ErrInvalidRefund() *AppError {
 	return New("PAY_006", "Original transaction not eligible for refund", http.StatusBadRequest)
 }
 
+func ErrInvalidReversal() *AppError {
+	return New("PAY_006", "Transaction not eligible for reversal", http.StatusBadRequest)
+}
+
+// ErrRefundLimitReached reports a refund beyond the allowed number of
+// refunds against one transaction.
+func ErrRefundLimitReached(max int) *AppError {
+	return New("PAY_006", fmt.Sprintf("Original transaction already has the maximum of %d refunds", max), http.StatusBadRequest)
+}
+
 func ErrRefundAmountExceedsOriginal() *AppError {
 	return New("PAY_007", "Refund amount exceeds original transaction amount", http.StatusBadRequest)
 }
 
+// ErrReferenceCollision reports a reference_id that belongs to a transaction
+// of another operation type than the request needs.
+func ErrReferenceCollision(referenceID, usedBy, wanted string) *AppError {
+	return New("PAY_008", fmt.Sprintf("reference_id %s is used by a %s transaction, not a %s; use a distinct reference_id per operation type", referenceID, usedBy, wanted), http.StatusConflict)
+}
+
+// ErrIdempotencyMismatch reports a request whose idempotency key was already
+// used by a request with a different body.
+func ErrIdempotencyMismatch() *AppError {
+	return New("PAY_009", "Idempotency key already used for a different request", http.StatusConflict)
+}
+
 // ---- Authentication (AUTH) ----
 
 func ErrInvalidCredentials() *AppError {
@@ -109,12 +151,29 @@ func ErrMerchantSuspended() *AppError {
 	return New("AUTH_004", "Merchant account is suspended", http.StatusForbidden)
 }
 
+func ErrInvalidAdminKey() *AppError {
+	return New("AUTH_005", "Invalid or missing admin key", http.StatusUnauthorized)
+}
+
 // ---- Rate Limiting (RATE) ----
 
 func ErrRateLimitExceeded() *AppError {
 	return New("RATE_001", "Rate limit exceeded", http.StatusTooManyRequests)
 }
 
+// ---- Request Routing (REQ) ----
+
+// ErrRouteNotFound reports a request to a path with no registered route.
+func ErrRouteNotFound() *AppError {
+	return New("REQ_001", "Route not found", http.StatusNotFound)
+}
+
+// ErrMethodNotAllowed reports a request whose path exists but not for the
+// HTTP method used.
+func ErrMethodNotAllowed() *AppError {
+	return New("REQ_002", "Method not allowed", http.StatusMethodNotAllowed)
+}
+
 // ---- System & Infrastructure (SYS) ----
 
 func ErrDatabaseError(err error) *AppError {
@@ -129,6 +188,18 @@ func ErrEncryptionFailure(err error) *AppError {
 	return Wrap("SYS_003", "Encryption service failure", http.StatusInternalServerError, err)
 }
 
+// ErrDataIntegrity reports stored data that decrypted but is not valid,
+// e.g. tampered ciphertext or a key mismatch. Not retryable.
+func ErrDataIntegrity(err error) *AppError {
+	return Wrap("SYS_004", "Stored data failed integrity check", http.StatusInternalServerError, err)
+}
+
+// ErrServerOverloaded reports a request shed because the server is at its
+// in-flight request cap.
+func ErrServerOverloaded() *AppError {
+	return New("SYS_006", "Server is at capacity, retry later", http.StatusServiceUnavailable)
+}
+
 // InternalError wraps an internal error as a SYS_001 error.
 func InternalError(err error) *AppError {
 	return Wrap("SYS_001", "Internal server error", http.StatusInternalServerError, err)
@@ -57,6 +57,8 @@ func TestSecurityErrors(t *testing.T) {
 		{"InvalidSignature", ErrInvalidSignature(), "SEC_002", 401},
 		{"TimestampExpired", ErrTimestampExpired(), "SEC_003", 403},
 		{"NonceUsed", ErrNonceUsed(), "SEC_004", 403},
+		{"SecretKeyExpired", ErrSecretKeyExpired(), "SEC_005", 403},
+		{"TLSRequired", ErrTLSRequired(), "SEC_006", 403},
 	}
 
 	for _, tt := range tests {
@@ -77,9 +79,12 @@ func TestPaymentErrors(t *testing.T) {
 		{"InsufficientFunds", ErrInsufficientFunds(), "PAY_001", 402},
 		{"InvalidAmount", ErrInvalidAmount(), "PAY_002", 400},
 		{"DuplicateTransaction", ErrDuplicateTransaction(), "PAY_003", 409},
+		{"WalletExists", ErrWalletExists("USD"), "PAY_003", 409},
+		{"RequestInProgress", ErrRequestInProgress(), "PAY_003", 409},
 		{"NotFound", ErrNotFound("Wallet"), "PAY_004", 404},
 		{"TransactionLimitExceeded", ErrTransactionLimitExceeded(), "PAY_005", 422},
 		{"InvalidRefund", ErrInvalidRefund(), "PAY_006", 400},
+		{"InvalidReversal", ErrInvalidReversal(), "PAY_006", 400},
 		{"RefundAmountExceeds", ErrRefundAmountExceedsOriginal(), "PAY_007", 400},
 	}
 
@@ -102,6 +107,7 @@ func TestAuthErrors(t *testing.T) {
 		{"UsernameExists", ErrUsernameExists(), "AUTH_002", 409},
 		{"InvalidToken", ErrInvalidToken(), "AUTH_003", 401},
 		{"MerchantSuspended", ErrMerchantSuspended(), "AUTH_004", 403},
+		{"InvalidAdminKey", ErrInvalidAdminKey(), "AUTH_005", 401},
 	}
 
 	for _, tt := range tests {
@@ -112,6 +118,16 @@ func TestAuthErrors(t *testing.T) {
 	}
 }
 
+func TestRoutingErrors(t *testing.T) {
+	notFound := ErrRouteNotFound()
+	assert.Equal(t, "REQ_001", notFound.Code)
+	assert.Equal(t, 404, notFound.HTTPStatus)
+
+	noMethod := ErrMethodNotAllowed()
+	assert.Equal(t, "REQ_002", noMethod.Code)
+	assert.Equal(t, 405, noMethod.HTTPStatus)
+}
+
 func TestSystemErrors(t *testing.T) {
 	inner := fmt.Errorf("pg: connection closed")
 	dbErr := ErrDatabaseError(inner)
@@ -126,6 +142,15 @@ func TestSystemErrors(t *testing.T) {
 	encErr := ErrEncryptionFailure(inner)
 	assert.Equal(t, "SYS_003", encErr.Code)
 	assert.Equal(t, 500, encErr.HTTPStatus)
+
+	integrityErr := ErrDataIntegrity(inner)
+	assert.Equal(t, "SYS_004", integrityErr.Code)
+	assert.Equal(t, 500, integrityErr.HTTPStatus)
+	assert.True(t, errors.Is(integrityErr, inner))
+
+	overloadErr := ErrServerOverloaded()
+	assert.Equal(t, "SYS_006", overloadErr.Code)
+	assert.Equal(t, 503, overloadErr.HTTPStatus)
 }
 
 func TestRateLimitError(t *testing.T) {
@@ -0,0 +1,27 @@
+// Package buildinfo holds build metadata injected at link time, e.g.
+//
+//	go build -ldflags "-X secure-payment-gateway/pkg/buildinfo.Version=v1.2.3 \
+//	  -X secure-payment-gateway/pkg/buildinfo.Commit=$(git rev-parse HEAD) \
+//	  -X secure-payment-gateway/pkg/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Binaries built without these flags report the defaults below.
+package buildinfo
+
+// Set via -ldflags -X; must stay plain string variables.
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
+// Info is the build metadata of the running binary.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+}
+
+// Get returns the build metadata of the running binary.
+func Get() Info {
+	return Info{Version: Version, Commit: Commit, BuildTime: BuildTime}
+}
@@ -0,0 +1,129 @@
+package clientauth
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"secure-payment-gateway/internal/core/domain"
+	"secure-payment-gateway/internal/core/ports/mocks"
+	"secure-payment-gateway/internal/service"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+const testSecret = "merchant-secret-key"
+
+func TestSignRequest_VerifiesWithServer(t *testing.T) {
+	sigSvc := service.NewHMACSignatureService()
+	body := []byte(`{"reference_id":"order-1","amount":50000,"currency":"VND"}`)
+	ts := time.Now().Unix()
+
+	signature := SignRequest(testSecret, http.MethodPost, "/api/v1/payments", body, ts, "nonce-1")
+
+	canonical := sigSvc.BuildCanonicalString(http.MethodPost, "/api/v1/payments", ts, "nonce-1", string(body))
+	assert.True(t, sigSvc.Verify(testSecret, canonical, signature))
+	assert.False(t, sigSvc.Verify("other-secret", canonical, signature))
+}
+
+func TestSignRequest_NormalizesPathLikeServer(t *testing.T) {
+	// The server signs URL.Path: no query string, escapes decoded
+	ts := int64(1700000000)
+	want := SignRequest(testSecret, http.MethodGet, "/api/v1/transactions/ref 1", nil, ts, "n")
+
+	assert.Equal(t, want, SignRequest(testSecret, http.MethodGet, "/api/v1/transactions/ref%201?page=2#top", nil, ts, "n"))
+	assert.Equal(t, "GET|/api/v1/transactions|1700000000|n|", CanonicalString(http.MethodGet, "/api/v1/transactions?status=SUCCESS", ts, "n", nil))
+}
+
+func TestSetHeaders(t *testing.T) {
+	body := []byte(`{"amount":1}`)
+	req, err := http.NewRequest(http.MethodPost, "https://gateway.example.com/api/v1/payments?x=1", nil)
+	require.NoError(t, err)
+
+	SetHeaders(req, "ak_123", testSecret, body, 1700000000, "nonce-2")
+
+	assert.Equal(t, "ak_123", req.Header.Get(HeaderAccessKey))
+	assert.Equal(t, "1700000000", req.Header.Get(HeaderTimestamp))
+	assert.Equal(t, "nonce-2", req.Header.Get(HeaderNonce))
+	assert.Equal(t, SignRequest(testSecret, http.MethodPost, "/api/v1/payments", body, 1700000000, "nonce-2"), req.Header.Get(HeaderSignature))
+}
+
+type captureClient struct {
+	bodies chan []byte
+}
+
+func (c *captureClient) Do(req *http.Request) (*http.Response, error) {
+	b, _ := io.ReadAll(req.Body)
+	c.bodies <- b
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(nil)}, nil
+}
+
+// deliverWebhook runs a real webhook delivery and returns the raw body the
+// merchant endpoint received.
+func deliverWebhook(t *testing.T) []byte {
+	ctrl := gomock.NewController(t)
+	merchantRepo := mocks.NewMockMerchantRepository(ctrl)
+	walletRepo := mocks.NewMockWalletRepository(ctrl)
+	encSvc := mocks.NewMockEncryptionService(ctrl)
+	client := &captureClient{bodies: make(chan []byte, 1)}
+
+	merchantID, walletID := uuid.New(), uuid.New()
+	webhookURL := "https://merchant.example.com/webhook"
+	merchantRepo.EXPECT().GetByID(gomock.Any(), merchantID).Return(&domain.Merchant{
+		ID:           merchantID,
+		SecretKeyEnc: "encrypted-secret",
+		WebhookURL:   &webhookURL,
+	}, nil)
+	walletRepo.EXPECT().GetByID(gomock.Any(), walletID).Return(&domain.Wallet{ID: walletID, Currency: "VND"}, nil)
+	encSvc.EXPECT().Decrypt("encrypted-secret").Return(testSecret, nil)
+
+	svc := service.NewWebhookService(merchantRepo, walletRepo, encSvc, service.NewHMACSignatureService(), client, zerolog.New(io.Discard), nil)
+	err := svc.EnqueueWebhook(context.Background(), &domain.Transaction{
+		ID:              uuid.New(),
+		ReferenceID:     "order-<&>",
+		MerchantID:      merchantID,
+		WalletID:        walletID,
+		Amount:          50000,
+		TransactionType: domain.TransactionTypePayment,
+		Status:          domain.TransactionStatusSuccess,
+		CreatedAt:       time.Now(),
+	})
+	require.NoError(t, err)
+
+	select {
+	case body := <-client.bodies:
+		return body
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook delivery timed out")
+		return nil
+	}
+}
+
+func TestVerifyWebhook_AcceptsServerDelivery(t *testing.T) {
+	body := deliverWebhook(t)
+
+	assert.NoError(t, VerifyWebhook(testSecret, http.Header{}, body))
+	assert.ErrorIs(t, VerifyWebhook("wrong-secret", http.Header{}, body), ErrInvalidSignature)
+}
+
+func TestVerifyWebhook_RejectsTamperedOrMalformed(t *testing.T) {
+	data := `{"status":"SUCCESS","amount":50000}`
+	signed := `{"data":` + data + `,"signature":"` + sign(testSecret, data) + `"}`
+	require.NoError(t, VerifyWebhook(testSecret, nil, []byte(signed)))
+
+	tampered := `{"data":{"status":"SUCCESS","amount":99999},"signature":"` + sign(testSecret, data) + `"}`
+	assert.ErrorIs(t, VerifyWebhook(testSecret, nil, []byte(tampered)), ErrInvalidSignature)
+
+	header := http.Header{}
+	header.Set(HeaderSignature, "deadbeef")
+	assert.ErrorIs(t, VerifyWebhook(testSecret, header, []byte(signed)), ErrInvalidSignature, "header signature takes precedence")
+
+	assert.Error(t, VerifyWebhook(testSecret, nil, []byte(`not json`)))
+	assert.Error(t, VerifyWebhook(testSecret, nil, []byte(`{"signature":"x"}`)))
+}
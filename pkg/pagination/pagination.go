@@ -0,0 +1,131 @@
+// Package pagination parses page/page_size query parameters and builds the
+// pagination metadata shared by list endpoints.
+package pagination
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// DefaultPageSize is used when page_size is missing, invalid or below 1.
+	DefaultPageSize = 20
+	// MaxPageSize caps page_size; larger values are clamped to it.
+	MaxPageSize = 100
+)
+
+// Page is a requested page of a list, numbered from 1.
+type Page struct {
+	Number int
+	Size   int
+}
+
+// Parse reads a page from raw page and page_size values. A missing, invalid
+// or non-positive page is 1; page_size falls back to DefaultPageSize and is
+// clamped to MaxPageSize.
+func Parse(page, pageSize string) Page {
+	p := Page{Number: 1, Size: DefaultPageSize}
+	if n, err := strconv.Atoi(page); err == nil && n > 1 {
+		p.Number = n
+	}
+	if n, err := strconv.Atoi(pageSize); err == nil && n >= 1 {
+		p.Size = min(n, MaxPageSize)
+	}
+	return p
+}
+
+// FromQuery reads the page from the request's page and page_size query
+// parameters.
+func FromQuery(c *gin.Context) Page {
+	return Parse(c.Query("page"), c.Query("page_size"))
+}
+
+// Offset is the number of items before the page.
+func (p Page) Offset() int {
+	return (p.Number - 1) * p.Size
+}
+
+// Meta is the pagination metadata of a list response.
+type Meta struct {
+	Total      *int64  `json:"total"` // null when the list was not counted
+	Page       int     `json:"page"`
+	PageSize   int     `json:"page_size"`
+	TotalPages *int    `json:"total_pages"` // null when the list was not counted
+	HasNext    bool    `json:"has_next"`
+	Next       *string `json:"next"` // Relative URL of the next page, null on the last page
+	Prev       *string `json:"prev"` // Relative URL of the previous page, null on the first page
+}
+
+// NewMeta builds the metadata for page p of total items. Links keep the
+// request's other query parameters. Past the last page, prev points to the
+// last page so clients can recover.
+func NewMeta(c *gin.Context, p Page, total int64) Meta {
+	totalPages := int((total + int64(p.Size) - 1) / int64(p.Size))
+	m := Meta{
+		Total:      &total,
+		Page:       p.Number,
+		PageSize:   p.Size,
+		TotalPages: &totalPages,
+		HasNext:    p.Number < totalPages,
+	}
+	if m.HasNext {
+		m.Next = link(c, p.Number+1, p.Size)
+	}
+	if p.Number > 1 {
+		m.Prev = link(c, min(p.Number-1, max(totalPages, 1)), p.Size)
+	}
+	return m
+}
+
+// NewUncountedMeta builds the metadata for page p of a list whose size is
+// unknown: total and total_pages are null, and hasNext says whether a next
+// page exists.
+func NewUncountedMeta(c *gin.Context, p Page, hasNext bool) Meta {
+	m := Meta{Page: p.Number, PageSize: p.Size, HasNext: hasNext}
+	if hasNext {
+		m.Next = link(c, p.Number+1, p.Size)
+	}
+	if p.Number > 1 {
+		m.Prev = link(c, p.Number-1, p.Size)
+	}
+	return m
+}
+
+// List is one page of items with its metadata.
+type List[T any] struct {
+	Items []T `json:"items"`
+	Meta
+}
+
+// NewList builds a List, never with null items.
+func NewList[T any](c *gin.Context, p Page, items []T, total int64) List[T] {
+	if items == nil {
+		items = []T{}
+	}
+	return List[T]{Items: items, Meta: NewMeta(c, p, total)}
+}
+
+// NewUncountedList builds a List without a total from items fetched with
+// one extra item of lookahead: up to p.Size+1 items, the extra one showing
+// that a next page exists. It is dropped from the page.
+func NewUncountedList[T any](c *gin.Context, p Page, items []T) List[T] {
+	hasNext := len(items) > p.Size
+	if hasNext {
+		items = items[:p.Size]
+	}
+	if items == nil {
+		items = []T{}
+	}
+	return List[T]{Items: items, Meta: NewUncountedMeta(c, p, hasNext)}
+}
+
+// link builds a relative URL to another page of the current request,
+// preserving its filters.
+func link(c *gin.Context, page, pageSize int) *string {
+	q := c.Request.URL.Query()
+	q.Set("page", strconv.Itoa(page))
+	q.Set("page_size", strconv.Itoa(pageSize))
+	l := c.Request.URL.Path + "?" + q.Encode()
+	return &l
+}
@@ -0,0 +1,110 @@
+package pagination
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name           string
+		page, pageSize string
+		want           Page
+	}{
+		{"defaults", "", "", Page{Number: 1, Size: DefaultPageSize}},
+		{"explicit", "3", "50", Page{Number: 3, Size: 50}},
+		{"size clamped to max", "1", "1000", Page{Number: 1, Size: MaxPageSize}},
+		{"size at max", "1", "100", Page{Number: 1, Size: 100}},
+		{"zero size", "1", "0", Page{Number: 1, Size: DefaultPageSize}},
+		{"negative size", "1", "-5", Page{Number: 1, Size: DefaultPageSize}},
+		{"zero page", "0", "10", Page{Number: 1, Size: 10}},
+		{"negative page", "-2", "10", Page{Number: 1, Size: 10}},
+		{"not numbers", "two", "ten", Page{Number: 1, Size: DefaultPageSize}},
+		{"overflowing page", "99999999999999999999", "10", Page{Number: 1, Size: 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Parse(tt.page, tt.pageSize))
+		})
+	}
+}
+
+func TestPage_Offset(t *testing.T) {
+	assert.Equal(t, 0, Page{Number: 1, Size: 20}.Offset())
+	assert.Equal(t, 40, Page{Number: 3, Size: 20}.Offset())
+}
+
+func newContext(target string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", target, nil)
+	return c
+}
+
+func pageOf(t *testing.T, link *string) string {
+	require.NotNil(t, link)
+	u, err := url.Parse(*link)
+	require.NoError(t, err)
+	return u.Query().Get("page")
+}
+
+func TestNewMeta(t *testing.T) {
+	c := newContext("/items?status=SUCCESS&page=2&page_size=20")
+	m := NewMeta(c, FromQuery(c), 45)
+
+	assert.Equal(t, 3, *m.TotalPages)
+	assert.True(t, m.HasNext)
+	assert.Equal(t, "3", pageOf(t, m.Next))
+	assert.Equal(t, "1", pageOf(t, m.Prev))
+	assert.Contains(t, *m.Next, "status=SUCCESS", "filters are kept")
+
+	first := NewMeta(c, Page{Number: 1, Size: 20}, 45)
+	assert.Nil(t, first.Prev)
+	last := NewMeta(c, Page{Number: 3, Size: 20}, 45)
+	assert.Nil(t, last.Next)
+
+	empty := NewMeta(c, Page{Number: 1, Size: 20}, 0)
+	assert.Equal(t, 0, *empty.TotalPages)
+	assert.False(t, empty.HasNext)
+	assert.Nil(t, empty.Next)
+	assert.Nil(t, empty.Prev)
+}
+
+func TestNewMeta_PageOutOfRange(t *testing.T) {
+	c := newContext("/items?page=9")
+	m := NewMeta(c, FromQuery(c), 45)
+
+	assert.Equal(t, 9, m.Page)
+	assert.Nil(t, m.Next)
+	assert.Equal(t, "3", pageOf(t, m.Prev), "prev leads back to the last page")
+}
+
+func TestNewList_NeverNullItems(t *testing.T) {
+	list := NewList[string](newContext("/items"), Page{Number: 1, Size: 20}, nil, 0)
+	assert.NotNil(t, list.Items)
+}
+
+func TestNewUncountedList(t *testing.T) {
+	c := newContext("/items?status=SUCCESS&page=2&page_size=2")
+	list := NewUncountedList(c, FromQuery(c), []string{"a", "b", "c"})
+
+	assert.Equal(t, []string{"a", "b"}, list.Items, "the lookahead item is dropped")
+	assert.Nil(t, list.Total)
+	assert.Nil(t, list.TotalPages)
+	assert.True(t, list.HasNext)
+	assert.Equal(t, "3", pageOf(t, list.Next))
+	assert.Equal(t, "1", pageOf(t, list.Prev))
+
+	last := NewUncountedList(c, Page{Number: 1, Size: 2}, []string{"a", "b"})
+	assert.False(t, last.HasNext)
+	assert.Nil(t, last.Next)
+	assert.Nil(t, last.Prev)
+}
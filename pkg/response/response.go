@@ -3,6 +3,8 @@ package response
 import (
 	"errors"
 	"net/http"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"secure-payment-gateway/pkg/apperror"
@@ -26,9 +28,32 @@ type ErrorResponse struct {
 	Timestamp string `json:"timestamp"`
 }
 
+// prettyQueryEnabled gates the ?pretty=true debugging aid; off by default so
+// production responses stay compact.
+var prettyQueryEnabled atomic.Bool
+
+// SetPrettyQueryEnabled controls whether a truthy ?pretty query parameter
+// makes responses indented JSON. Intended for non-release modes only.
+func SetPrettyQueryEnabled(enabled bool) {
+	prettyQueryEnabled.Store(enabled)
+}
+
+// writeJSON renders body compact, or indented when pretty output was
+// requested and is enabled. Both renderers write the whole body in one go,
+// so Content-Length is set by net/http as usual.
+func writeJSON(c *gin.Context, status int, body interface{}) {
+	if prettyQueryEnabled.Load() {
+		if pretty, err := strconv.ParseBool(c.Query("pretty")); err == nil && pretty {
+			c.IndentedJSON(status, body)
+			return
+		}
+	}
+	c.JSON(status, body)
+}
+
 // OK sends a 200 response with data.
 func OK(c *gin.Context, data interface{}) {
-	c.JSON(http.StatusOK, SuccessResponse{
+	writeJSON(c, http.StatusOK, SuccessResponse{
 		Data:      data,
 		RequestID: getRequestID(c),
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
@@ -37,7 +62,7 @@ func OK(c *gin.Context, data interface{}) {
 
 // Created sends a 201 response with data.
 func Created(c *gin.Context, data interface{}) {
-	c.JSON(http.StatusCreated, SuccessResponse{
+	writeJSON(c, http.StatusCreated, SuccessResponse{
 		Data:      data,
 		RequestID: getRequestID(c),
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
@@ -49,7 +74,7 @@ func Created(c *gin.Context, data interface{}) {
 func Error(c *gin.Context, err error) {
 	var appErr *apperror.AppError
 	if errors.As(err, &appErr) {
-		c.JSON(appErr.HTTPStatus, ErrorResponse{
+		writeJSON(c, appErr.HTTPStatus, ErrorResponse{
 			ErrorCode: appErr.Code,
 			Message:   appErr.Message,
 			RequestID: getRequestID(c),
@@ -58,10 +83,11 @@ func Error(c *gin.Context, err error) {
 		return
 	}
 
-	// Unknown error -> 500
-	c.JSON(http.StatusInternalServerError, ErrorResponse{
-		ErrorCode: "SYS_000",
-		Message:   "Internal server error",
+	// Unknown error -> 500, coded the same as apperror.InternalError
+	internal := apperror.InternalError(err)
+	writeJSON(c, internal.HTTPStatus, ErrorResponse{
+		ErrorCode: internal.Code,
+		Message:   internal.Message,
 		RequestID: getRequestID(c),
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
 	})
@@ -3,6 +3,7 @@ package response
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -92,8 +93,26 @@ func TestError_UnknownError(t *testing.T) {
 
 	var resp ErrorResponse
 	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
-	assert.Equal(t, "SYS_000", resp.ErrorCode)
+	assert.Equal(t, "SYS_001", resp.ErrorCode)
 	assert.Equal(t, "Internal server error", resp.Message)
+	assert.NotContains(t, w.Body.String(), "something unexpected")
+}
+
+func TestError_UnknownErrorMatchesInternalError(t *testing.T) {
+	bare := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(bare)
+	Error(c, fmt.Errorf("boom"))
+
+	wrapped := httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(wrapped)
+	Error(c, apperror.InternalError(fmt.Errorf("boom")))
+
+	var bareResp, wrappedResp ErrorResponse
+	require.NoError(t, json.Unmarshal(bare.Body.Bytes(), &bareResp))
+	require.NoError(t, json.Unmarshal(wrapped.Body.Bytes(), &wrappedResp))
+	assert.Equal(t, wrapped.Code, bare.Code)
+	assert.Equal(t, wrappedResp.ErrorCode, bareResp.ErrorCode)
+	assert.Equal(t, wrappedResp.Message, bareResp.Message)
 }
 
 func TestOK_GeneratesRequestID_WhenMissing(t *testing.T) {
@@ -107,3 +126,46 @@ func TestOK_GeneratesRequestID_WhenMissing(t *testing.T) {
 	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
 	assert.NotEmpty(t, resp.RequestID, "should generate a UUID when request_id is missing")
 }
+
+func TestPrettyQuery(t *testing.T) {
+	SetPrettyQueryEnabled(true)
+	defer SetPrettyQueryEnabled(false)
+
+	r := gin.New()
+	r.GET("/ok", func(c *gin.Context) { OK(c, map[string]string{"status": "healthy"}) })
+	r.GET("/err", func(c *gin.Context) { Error(c, apperror.ErrInvalidSignature()) })
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	get := func(path string) (*http.Response, string) {
+		resp, err := http.Get(srv.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(body)), resp.ContentLength, path)
+		return resp, string(body)
+	}
+
+	_, body := get("/ok?pretty=true")
+	assert.Contains(t, body, "\n        \"status\": \"healthy\"")
+
+	resp, body := get("/err?pretty=1")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Contains(t, body, "\n    \"error_code\": \"SEC_002\"")
+
+	for _, path := range []string{"/ok", "/ok?pretty=false", "/ok?pretty=yes"} {
+		_, body = get(path)
+		assert.NotContains(t, body, "\n", path)
+	}
+}
+
+func TestPrettyQuery_DisabledStaysCompact(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/?pretty=true", nil)
+
+	OK(c, map[string]string{"status": "healthy"})
+
+	assert.NotContains(t, w.Body.String(), "\n")
+}
@@ -2,11 +2,7 @@ package integration
 
 import (
 	"bytes"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
-	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -14,8 +10,11 @@ import (
 	"time"
 
 	httpHandler "secure-payment-gateway/internal/adapter/http/handler"
+	"secure-payment-gateway/internal/adapter/http/middleware"
 	redisStorage "secure-payment-gateway/internal/adapter/storage/redis"
+	"secure-payment-gateway/internal/core/domain"
 	"secure-payment-gateway/internal/service"
+	"secure-payment-gateway/pkg/clientauth"
 	"secure-payment-gateway/pkg/logger"
 
 	"github.com/alicebob/miniredis/v2"
@@ -31,9 +30,48 @@ import (
 type testApp struct {
 	server *httptest.Server
 	redis  *miniredis.Miniredis
+	audit  *inMemoryAuditRepo
 }
 
-func newTestApp(t *testing.T) *testApp {
+// testAppConfig collects what testAppOptions change from the default stack.
+type testAppConfig struct {
+	paymentOpts      []service.PaymentOption
+	signatureHeaders middleware.SignatureHeaders
+	sumRefundsDelay  time.Duration
+}
+
+// testAppOption customises the app; rdb is the app's Redis.
+type testAppOption func(cfg *testAppConfig, rdb *goredis.Client)
+
+// withInFlightLock guards payments with the Redis in-flight lock in mode.
+func withInFlightLock(mode service.InFlightMode) testAppOption {
+	return func(cfg *testAppConfig, rdb *goredis.Client) {
+		cfg.paymentOpts = append(cfg.paymentOpts, service.WithInFlightLock(redisStorage.NewInFlightLock(rdb), mode, 5*time.Second))
+	}
+}
+
+// withSignatureHeaders reads HMAC credentials from the given header names.
+func withSignatureHeaders(headers middleware.SignatureHeaders) testAppOption {
+	return func(cfg *testAppConfig, _ *goredis.Client) {
+		cfg.signatureHeaders = headers
+	}
+}
+
+// withSumRefundsDelay stalls each read of a payment's refunded total by d.
+func withSumRefundsDelay(d time.Duration) testAppOption {
+	return func(cfg *testAppConfig, _ *goredis.Client) {
+		cfg.sumRefundsDelay = d
+	}
+}
+
+// withPaymentOptions adds options to the payment service.
+func withPaymentOptions(opts ...service.PaymentOption) testAppOption {
+	return func(cfg *testAppConfig, _ *goredis.Client) {
+		cfg.paymentOpts = append(cfg.paymentOpts, opts...)
+	}
+}
+
+func newTestApp(t *testing.T, opts ...testAppOption) *testApp {
 	t.Helper()
 
 	// Start miniredis
@@ -59,12 +97,22 @@ func newTestApp(t *testing.T) *testApp {
 	txRepo := newInMemoryTransactionRepo()
 	idempotencyRepo := newInMemoryIdempotencyRepo()
 	transactor := newInMemoryTransactor()
+	auditRepo := newInMemoryAuditRepo()
 
 	// Business services
-	authSvc := service.NewAuthService(merchantRepo, walletRepo, hashSvc, encSvc, tokenSvc)
+	authSvc := service.NewAuthService(merchantRepo, walletRepo, transactor, hashSvc, encSvc, tokenSvc,
+		service.WithRegisterIdempotency(idempotencyCache, redisStorage.NewInFlightLock(rdb)),
+	)
 	log := logger.New("debug", false)
-	paymentSvc := service.NewPaymentService(txRepo, walletRepo, idempotencyRepo, idempotencyCache, encSvc, transactor, log)
-	reportingSvc := service.NewReportingService(txRepo, walletRepo, encSvc)
+	auditSvc := service.NewAuditService(auditRepo, log)
+	// Payments are audited by both the service and the HTTP middleware
+	cfg := testAppConfig{paymentOpts: []service.PaymentOption{service.WithPaymentAudit(auditSvc)}}
+	for _, opt := range opts {
+		opt(&cfg, rdb)
+	}
+	txRepo.sumRefundsDelay = cfg.sumRefundsDelay
+	paymentSvc := service.NewPaymentService(txRepo, walletRepo, idempotencyRepo, idempotencyCache, encSvc, transactor, log, cfg.paymentOpts...)
+	reportingSvc := service.NewReportingService(txRepo, walletRepo, encSvc, service.WithPrimaryCurrencies(merchantRepo))
 
 	router := httpHandler.SetupRouter(httpHandler.RouterDeps{
 		AuthSvc:      authSvc,
@@ -75,7 +123,10 @@ func newTestApp(t *testing.T) *testApp {
 		SigSvc:       sigSvc,
 		NonceStore:   nonceStore,
 		TokenSvc:     tokenSvc,
+		AuditSvc:     auditSvc,
 		Logger:       log,
+
+		SignatureHeaders: cfg.signatureHeaders,
 	})
 
 	server := httptest.NewServer(router)
@@ -83,6 +134,7 @@ func newTestApp(t *testing.T) *testApp {
 	return &testApp{
 		server: server,
 		redis:  mr,
+		audit:  auditRepo,
 	}
 }
 
@@ -184,6 +236,39 @@ func TestIntegration_DuplicateUsername(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, resp2.StatusCode)
 }
 
+func TestIntegration_RegisterIdempotentRetry(t *testing.T) {
+	app := newTestApp(t)
+	defer app.close()
+
+	regBody, _ := json.Marshal(map[string]string{
+		"username":      "retry_merchant",
+		"password":      "StrongPass123!",
+		"merchant_name": "Retry Shop",
+	})
+
+	register := func() map[string]interface{} {
+		req, _ := http.NewRequest(http.MethodPost, app.server.URL+"/api/v1/auth/register", bytes.NewReader(regBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", "reg-retry-1")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return body["data"].(map[string]interface{})
+	}
+
+	first := register()
+	// Client lost the first response and retries with the same key
+	second := register()
+
+	assert.Equal(t, first["merchant_id"], second["merchant_id"])
+	assert.Equal(t, first["access_key"], second["access_key"])
+	assert.Equal(t, first["secret_key"], second["secret_key"])
+}
+
 func TestIntegration_JWT_Dashboard(t *testing.T) {
 	app := newTestApp(t)
 	defer app.close()
@@ -207,6 +292,43 @@ func TestIntegration_JWT_Dashboard(t *testing.T) {
 	assert.Equal(t, "VND", data["currency"])
 }
 
+func TestIntegration_JWT_BalanceInPrimaryCurrency(t *testing.T) {
+	app := newTestApp(t)
+	defer app.close()
+
+	regBody, _ := json.Marshal(map[string]string{
+		"username":      "usdmerchant",
+		"password":      "StrongPass123!",
+		"merchant_name": "US Shop",
+		"currency":      "USD",
+	})
+	resp, err := http.Post(app.server.URL+"/api/v1/auth/register", "application/json", bytes.NewReader(regBody))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	token := loginAndGetToken(t, app, "usdmerchant", "StrongPass123!")
+
+	balance := func(query string) (int, map[string]interface{}) {
+		req, _ := http.NewRequest(http.MethodGet, app.server.URL+"/api/v1/wallets/balance"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return resp.StatusCode, body
+	}
+
+	status, body := balance("")
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "USD", body["data"].(map[string]interface{})["currency"])
+
+	// A currency the merchant holds no wallet in is a client error, not PAY_004
+	status, body = balance("?currency=VND")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "PAY_002", body["error_code"])
+}
+
 func TestIntegration_JWT_DashboardStats(t *testing.T) {
 	app := newTestApp(t)
 	defer app.close()
@@ -268,21 +390,9 @@ func TestIntegration_HMAC_PaymentEndToEnd(t *testing.T) {
 		"amount":       int64(50000),
 		"currency":     "VND",
 	})
-	timestamp := fmt.Sprintf("%d", time.Now().Unix())
-	nonce := "unique-nonce-001"
-
-	// Build canonical string
-	canonical := fmt.Sprintf("POST|/api/v1/payments|%s|%s|%s", timestamp, nonce, string(payBody))
-	mac := hmac.New(sha256.New, []byte(secretKey))
-	mac.Write([]byte(canonical))
-	signature := hex.EncodeToString(mac.Sum(nil))
-
 	reqPay, _ := http.NewRequest(http.MethodPost, app.server.URL+"/api/v1/payments", bytes.NewReader(payBody))
 	reqPay.Header.Set("Content-Type", "application/json")
-	reqPay.Header.Set("X-Merchant-Access-Key", accessKey)
-	reqPay.Header.Set("X-Signature", signature)
-	reqPay.Header.Set("X-Timestamp", timestamp)
-	reqPay.Header.Set("X-Nonce", nonce)
+	clientauth.SetHeaders(reqPay, accessKey, secretKey, payBody, time.Now().Unix(), "unique-nonce-001")
 
 	respPay, err := http.DefaultClient.Do(reqPay)
 	require.NoError(t, err)
@@ -311,6 +421,86 @@ func TestIntegration_HMAC_PaymentEndToEnd(t *testing.T) {
 	assert.Equal(t, float64(950000), balData["balance"])
 }
 
+func TestIntegration_PaymentAuditedOnce(t *testing.T) {
+	app := newTestApp(t)
+	defer app.close()
+
+	accessKey, secretKey := registerAndGetKeys(t, app)
+	token := loginAndGetToken(t, app, "hmac_merchant", "StrongPass123!")
+
+	topupBody, _ := json.Marshal(map[string]interface{}{
+		"amount":   int64(1000000),
+		"currency": "VND",
+	})
+	reqTopup, _ := http.NewRequest(http.MethodPost, app.server.URL+"/api/v1/wallets/topup", bytes.NewReader(topupBody))
+	reqTopup.Header.Set("Content-Type", "application/json")
+	reqTopup.Header.Set("Authorization", "Bearer "+token)
+	respTopup, err := http.DefaultClient.Do(reqTopup)
+	require.NoError(t, err)
+	respTopup.Body.Close()
+	require.Equal(t, http.StatusCreated, respTopup.StatusCode)
+
+	payBody, _ := json.Marshal(map[string]interface{}{
+		"reference_id": "order-audit-001",
+		"amount":       int64(50000),
+		"currency":     "VND",
+	})
+	reqPay, _ := http.NewRequest(http.MethodPost, app.server.URL+"/api/v1/payments", bytes.NewReader(payBody))
+	reqPay.Header.Set("Content-Type", "application/json")
+	clientauth.SetHeaders(reqPay, accessKey, secretKey, payBody, time.Now().Unix(), "audit-nonce-001")
+	respPay, err := http.DefaultClient.Do(reqPay)
+	require.NoError(t, err)
+	defer respPay.Body.Close()
+	require.Equal(t, http.StatusCreated, respPay.StatusCode)
+
+	var payResp map[string]interface{}
+	require.NoError(t, json.NewDecoder(respPay.Body).Decode(&payResp))
+	txID := payResp["data"].(map[string]interface{})["id"].(string)
+
+	// Audit writes are asynchronous, and the middleware's runs after the
+	// response is sent: wait for the first, then make sure no second appears
+	require.Eventually(t, func() bool {
+		return len(app.audit.byAction(domain.AuditActionPayment)) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Never(t, func() bool {
+		return len(app.audit.byAction(domain.AuditActionPayment)) > 1
+	}, 200*time.Millisecond, 10*time.Millisecond)
+
+	// The service claimed the request first, so its entry (with the
+	// transaction ID) is the one kept
+	entry := app.audit.byAction(domain.AuditActionPayment)[0]
+	assert.Equal(t, txID, entry.ResourceID)
+	assert.Equal(t, payResp["request_id"], entry.RequestID, "entry carries the request ID the response reports")
+}
+
+func TestIntegration_HMAC_CustomHeaderNames(t *testing.T) {
+	headers := middleware.SignatureHeaders{AccessKey: "X-Api-Key", Signature: "X-Api-Signature", Timestamp: "X-Api-Timestamp", Nonce: "X-Api-Nonce"}
+	app := newTestApp(t, withSignatureHeaders(headers))
+	defer app.close()
+
+	accessKey, secretKey := registerAndGetKeys(t, app)
+	signed := clientauth.Headers{AccessKey: headers.AccessKey, Signature: headers.Signature, Timestamp: headers.Timestamp, Nonce: headers.Nonce}
+
+	topup := func(sign func(req *http.Request, body []byte)) int {
+		t.Helper()
+		body, _ := json.Marshal(map[string]interface{}{"amount": int64(100000), "currency": "VND"})
+		req, _ := http.NewRequest(http.MethodPost, app.server.URL+"/api/v1/wallets/topup", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		sign(req, body)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusCreated, topup(func(req *http.Request, body []byte) {
+		signed.SetHeaders(req, accessKey, secretKey, body, time.Now().Unix(), "custom-nonce-001")
+	}))
+	assert.Equal(t, http.StatusUnauthorized, topup(func(req *http.Request, body []byte) {
+		clientauth.SetHeaders(req, accessKey, secretKey, body, time.Now().Unix(), "custom-nonce-002")
+	}), "the default names are not read; without a JWT the request is refused")
+}
+
 func TestIntegration_HMAC_MissingHeaders(t *testing.T) {
 	app := newTestApp(t)
 	defer app.close()
@@ -322,6 +512,199 @@ func TestIntegration_HMAC_MissingHeaders(t *testing.T) {
 	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
 }
 
+func TestIntegration_HMAC_Topup(t *testing.T) {
+	app := newTestApp(t)
+	defer app.close()
+
+	accessKey, secretKey := registerAndGetKeys(t, app)
+	token := loginAndGetToken(t, app, "hmac_merchant", "StrongPass123!")
+
+	topup := func(secret, nonce string) int {
+		t.Helper()
+		body, _ := json.Marshal(map[string]interface{}{
+			"amount":   int64(200000),
+			"currency": "VND",
+		})
+		req, _ := http.NewRequest(http.MethodPost, app.server.URL+"/api/v1/wallets/topup", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		clientauth.SetHeaders(req, accessKey, secret, body, time.Now().Unix(), nonce)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusCreated, topup(secretKey, "topup-nonce-001"))
+	assert.Equal(t, http.StatusUnauthorized, topup("wrong-secret", "topup-nonce-002"), "a signed topup is never let through on a bad signature")
+
+	// The signed topup credited the same wallet the dashboard sees
+	req, _ := http.NewRequest(http.MethodGet, app.server.URL+"/api/v1/wallets/balance", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var body map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	data := body["data"].(map[string]interface{})
+	assert.Equal(t, float64(200000), data["balance"])
+}
+
+// signedResult is the part of a signed call's response the tests check.
+type signedResult struct {
+	status int
+	id     string
+	code   string
+}
+
+// signedPost sends body to path signed with the merchant's keys; headers
+// are extra name/value pairs.
+func signedPost(t *testing.T, app *testApp, accessKey, secretKey, path, body, nonce string, headers ...string) signedResult {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, app.server.URL+path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	clientauth.SetHeaders(req, accessKey, secretKey, []byte(body), time.Now().Unix(), nonce)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var result struct {
+		ErrorCode string `json:"error_code"`
+		Data      struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&result)
+	return signedResult{status: resp.StatusCode, id: result.Data.ID, code: result.ErrorCode}
+}
+
+// payForRefunds registers a merchant, tops it up with 1,000,000 VND and
+// pays 100,000 of it as order-001, returning the merchant's credentials.
+func payForRefunds(t *testing.T, app *testApp) (accessKey, secretKey, token string) {
+	t.Helper()
+	accessKey, secretKey = registerAndGetKeys(t, app)
+	token = loginAndGetToken(t, app, "hmac_merchant", "StrongPass123!")
+
+	topupReq, _ := http.NewRequest(http.MethodPost, app.server.URL+"/api/v1/wallets/topup", bytes.NewBufferString(`{"amount":1000000,"currency":"VND"}`))
+	topupReq.Header.Set("Content-Type", "application/json")
+	topupReq.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(topupReq)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
+
+	pay := signedPost(t, app, accessKey, secretKey, "/api/v1/payments", `{"reference_id":"order-001","amount":100000,"currency":"VND"}`, "pay-nonce-001")
+	require.Equal(t, http.StatusCreated, pay.status)
+	return accessKey, secretKey, token
+}
+
+// walletBalance returns the merchant's primary wallet balance.
+func walletBalance(t *testing.T, app *testApp, token string) int64 {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, app.server.URL+"/api/v1/wallets/balance", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var result struct {
+		Data struct {
+			Balance int64 `json:"balance"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	return result.Data.Balance
+}
+
+func TestIntegration_PartialRefunds(t *testing.T) {
+	app := newTestApp(t)
+	defer app.close()
+
+	accessKey, secretKey, token := payForRefunds(t, app)
+	refund := func(body, nonce string, headers ...string) signedResult {
+		t.Helper()
+		return signedPost(t, app, accessKey, secretKey, "/api/v1/payments/refund", body, nonce, headers...)
+	}
+
+	// Two partial refunds, each named by its own reference or key
+	first := refund(`{"original_reference_id":"order-001","reference_id":"refund-001","amount":30000,"reason":"damaged"}`, "refund-nonce-001")
+	require.Equal(t, http.StatusCreated, first.status, first.code)
+	second := refund(`{"original_reference_id":"order-001","amount":30000,"reason":"damaged"}`, "refund-nonce-002", "Idempotency-Key", "refund-key-002")
+	require.Equal(t, http.StatusCreated, second.status, second.code)
+	assert.NotEqual(t, first.id, second.id, "the second partial refund is a refund of its own, not a replay")
+
+	// Retrying either replays it
+	assert.Equal(t, first.id, refund(`{"original_reference_id":"order-001","reference_id":"refund-001","amount":30000,"reason":"damaged"}`, "refund-nonce-003").id)
+	assert.Equal(t, second.id, refund(`{"original_reference_id":"order-001","amount":30000,"reason":"damaged"}`, "refund-nonce-004", "Idempotency-Key", "refund-key-002").id)
+	assert.Equal(t, int64(960000), walletBalance(t, app, token))
+
+	// More than is left is refused; the rest closes the payment
+	over := refund(`{"original_reference_id":"order-001","reference_id":"refund-003","amount":40001,"reason":"damaged"}`, "refund-nonce-005")
+	assert.Equal(t, "PAY_007", over.code)
+	last := refund(`{"original_reference_id":"order-001","reference_id":"refund-003","reason":"damaged"}`, "refund-nonce-006")
+	require.Equal(t, http.StatusCreated, last.status, last.code)
+	assert.Equal(t, int64(1000000), walletBalance(t, app, token))
+
+	after := refund(`{"original_reference_id":"order-001","reference_id":"refund-004","amount":1,"reason":"damaged"}`, "refund-nonce-007")
+	assert.Equal(t, "PAY_006", after.code, "a fully refunded payment is REVERSED")
+}
+
+func TestIntegration_RefundLimit(t *testing.T) {
+	app := newTestApp(t, withPaymentOptions(service.WithMaxRefundsPerTransaction(2)))
+	defer app.close()
+
+	accessKey, secretKey, token := payForRefunds(t, app)
+	refund := func(ref, nonce string) signedResult {
+		t.Helper()
+		body := `{"original_reference_id":"order-001","reference_id":"` + ref + `","amount":10000,"reason":"damaged"}`
+		return signedPost(t, app, accessKey, secretKey, "/api/v1/payments/refund", body, nonce)
+	}
+
+	first := refund("refund-001", "refund-nonce-001")
+	require.Equal(t, http.StatusCreated, first.status, first.code)
+	second := refund("refund-002", "refund-nonce-002")
+	require.Equal(t, http.StatusCreated, second.status, second.code)
+
+	// Part of the payment is left, but it has had its two refunds
+	third := refund("refund-003", "refund-nonce-003")
+	assert.Equal(t, http.StatusBadRequest, third.status)
+	assert.Equal(t, "PAY_006", third.code)
+	assert.Equal(t, int64(920000), walletBalance(t, app, token))
+
+	// A retry of a refund already made still replays it
+	assert.Equal(t, first.id, refund("refund-001", "refund-nonce-004").id)
+}
+
+func TestIntegration_TopupCreatesWallet(t *testing.T) {
+	app := newTestApp(t)
+	defer app.close()
+
+	token := registerAndLogin(t, app)
+
+	// The merchant registered with a VND wallet only; a USD topup adds one
+	req, _ := http.NewRequest(http.MethodPost, app.server.URL+"/api/v1/wallets/topup", bytes.NewBufferString(`{"amount":5000,"currency":"USD"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	req, _ = http.NewRequest(http.MethodGet, app.server.URL+"/api/v1/wallets/balance?currency=USD", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var body struct {
+		Data struct {
+			Balance  int64  `json:"balance"`
+			Currency string `json:"currency"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, int64(5000), body.Data.Balance)
+	assert.Equal(t, "USD", body.Data.Currency)
+}
+
 func TestIntegration_JWT_Unauthorized(t *testing.T) {
 	app := newTestApp(t)
 	defer app.close()
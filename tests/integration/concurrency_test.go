@@ -2,19 +2,18 @@ package integration
 
 import (
 	"bytes"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"strconv"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"secure-payment-gateway/internal/service"
+	"secure-payment-gateway/pkg/clientauth"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -90,22 +89,12 @@ func TestConcurrentPayments(t *testing.T) {
 
 			refID := fmt.Sprintf("CONCURRENT-PAY-%d", idx)
 			body := fmt.Sprintf(`{"reference_id":"%s","amount":%d,"currency":"VND"}`, refID, paymentAmount)
-			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
 			nonce := fmt.Sprintf("nonce-concurrent-%d-%d", idx, time.Now().UnixNano())
 
-			// Build HMAC signature
-			canonical := fmt.Sprintf("POST|/api/v1/payments|%s|%s|%s", timestamp, nonce, body)
-			mac := hmac.New(sha256.New, []byte(secretKey))
-			mac.Write([]byte(canonical))
-			signature := hex.EncodeToString(mac.Sum(nil))
-
 			req, _ := http.NewRequest("POST", app.server.URL+"/api/v1/payments",
 				bytes.NewBufferString(body))
 			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("X-Merchant-Access-Key", accessKey)
-			req.Header.Set("X-Signature", signature)
-			req.Header.Set("X-Timestamp", timestamp)
-			req.Header.Set("X-Nonce", nonce)
+			clientauth.SetHeaders(req, accessKey, secretKey, []byte(body), time.Now().Unix(), nonce)
 
 			r, err := http.DefaultClient.Do(req)
 			if err != nil {
@@ -127,17 +116,10 @@ func TestConcurrentPayments(t *testing.T) {
 
 	t.Logf("Concurrent payments: %d succeeded, %d failed (out of %d)", successCount.Load(), failCount.Load(), concurrency)
 
-	// Verify all requests completed
-	totalProcessed := successCount.Load() + failCount.Load()
-	assert.Equal(t, int64(concurrency), totalProcessed, "all requests should complete")
-
-	t.Logf("Concurrent payments: %d succeeded, %d failed (out of %d)", successCount.Load(), failCount.Load(), concurrency)
+	// The wallet row lock serialises the payments: every one fits the balance
+	assert.Equal(t, int64(concurrency), successCount.Load(), "all payments should succeed")
+	assert.Zero(t, failCount.Load())
 
-	// Verify final balance is non-negative
-	// NOTE: With real PostgreSQL + SELECT FOR UPDATE, all 100 would succeed sequentially
-	// and balance would be exactly 0. With in-memory repos (no row-level locks),
-	// concurrent reads cause "lost updates" — this is expected and demonstrates why
-	// pessimistic locking is critical in production.
 	balanceReq, _ := http.NewRequest("GET", app.server.URL+"/api/v1/wallets/balance", nil)
 	balanceReq.Header.Set("Authorization", "Bearer "+token)
 	resp, err = http.DefaultClient.Do(balanceReq)
@@ -155,7 +137,7 @@ func TestConcurrentPayments(t *testing.T) {
 	require.NoError(t, err)
 
 	t.Logf("Final balance: %d VND", balanceResult.Data.Balance)
-	assert.GreaterOrEqual(t, balanceResult.Data.Balance, int64(0), "balance must never go negative")
+	assert.Equal(t, int64(0), balanceResult.Data.Balance, "no update may be lost")
 }
 
 // TestConcurrentPayments_InsufficientFunds verifies pessimistic locking
@@ -217,6 +199,7 @@ func TestConcurrentPayments_InsufficientFunds(t *testing.T) {
 	var wg sync.WaitGroup
 	var successCount atomic.Int64
 	var failCount atomic.Int64
+	var insufficientCount atomic.Int64
 
 	for i := 0; i < concurrency; i++ {
 		wg.Add(1)
@@ -225,21 +208,12 @@ func TestConcurrentPayments_InsufficientFunds(t *testing.T) {
 
 			refID := fmt.Sprintf("OVERSPEND-PAY-%d", idx)
 			body := fmt.Sprintf(`{"reference_id":"%s","amount":%d,"currency":"VND"}`, refID, paymentAmount)
-			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
 			nonce := fmt.Sprintf("nonce-overspend-%d-%d", idx, time.Now().UnixNano())
 
-			canonical := fmt.Sprintf("POST|/api/v1/payments|%s|%s|%s", timestamp, nonce, body)
-			mac := hmac.New(sha256.New, []byte(secretKey))
-			mac.Write([]byte(canonical))
-			signature := hex.EncodeToString(mac.Sum(nil))
-
 			req, _ := http.NewRequest("POST", app.server.URL+"/api/v1/payments",
 				bytes.NewBufferString(body))
 			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("X-Merchant-Access-Key", accessKey)
-			req.Header.Set("X-Signature", signature)
-			req.Header.Set("X-Timestamp", timestamp)
-			req.Header.Set("X-Nonce", nonce)
+			clientauth.SetHeaders(req, accessKey, secretKey, []byte(body), time.Now().Unix(), nonce)
 
 			r, err := http.DefaultClient.Do(req)
 			if err != nil {
@@ -249,9 +223,13 @@ func TestConcurrentPayments_InsufficientFunds(t *testing.T) {
 			defer r.Body.Close()
 			_, _ = io.ReadAll(r.Body)
 
-			if r.StatusCode == 201 {
+			switch r.StatusCode {
+			case http.StatusCreated:
 				successCount.Add(1)
-			} else {
+			case http.StatusPaymentRequired:
+				insufficientCount.Add(1)
+				failCount.Add(1)
+			default:
 				failCount.Add(1)
 			}
 		}(i)
@@ -261,13 +239,12 @@ func TestConcurrentPayments_InsufficientFunds(t *testing.T) {
 
 	t.Logf("Overspend test: %d succeeded, %d failed (out of %d)", successCount.Load(), failCount.Load(), concurrency)
 
-	// With real PostgreSQL + pessimistic locking (SELECT FOR UPDATE), exactly 5 would succeed.
-	// With in-memory repos (no row-level locking), all may succeed due to race conditions.
-	// The CRITICAL safety property is that balance must never go negative.
-	totalProcessed := successCount.Load() + failCount.Load()
-	assert.Equal(t, int64(concurrency), totalProcessed, "all requests should complete")
+	// The wallet row lock serialises the payments: exactly the 5 that fit succeed
+	// and the rest fail with insufficient funds (PAY_001)
+	assert.Equal(t, int64(5), successCount.Load())
+	assert.Equal(t, int64(5), insufficientCount.Load())
+	assert.Equal(t, int64(5), failCount.Load())
 
-	// Verify final balance is >= 0 (the most important safety invariant)
 	balanceReq, _ := http.NewRequest("GET", app.server.URL+"/api/v1/wallets/balance", nil)
 	balanceReq.Header.Set("Authorization", "Bearer "+token)
 	resp, err = http.DefaultClient.Do(balanceReq)
@@ -284,12 +261,8 @@ func TestConcurrentPayments_InsufficientFunds(t *testing.T) {
 	resp.Body.Close()
 	require.NoError(t, err)
 
-	t.Logf("Final balance: %d VND (should be >= 0)", balanceResult.Data.Balance)
-	assert.GreaterOrEqual(t, balanceResult.Data.Balance, int64(0), "balance must never go negative")
-
-	// With pessimistic locking, expected final balance = 0 (exactly 5 succeed)
-	// With in-memory repos, balance may be negative due to race conditions in the test infra
-	// This test validates the business logic layer; PostgreSQL locking is tested separately
+	t.Logf("Final balance: %d VND", balanceResult.Data.Balance)
+	assert.Equal(t, int64(0), balanceResult.Data.Balance)
 }
 
 // TestConcurrentIdempotency verifies that duplicate concurrent requests
@@ -351,21 +324,12 @@ func TestConcurrentIdempotency(t *testing.T) {
 		go func(idx int) {
 			defer wg.Done()
 
-			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
 			nonce := fmt.Sprintf("nonce-idemp-%d-%d", idx, time.Now().UnixNano())
 
-			canonical := fmt.Sprintf("POST|/api/v1/payments|%s|%s|%s", timestamp, nonce, body)
-			mac := hmac.New(sha256.New, []byte(secretKey))
-			mac.Write([]byte(canonical))
-			signature := hex.EncodeToString(mac.Sum(nil))
-
 			req, _ := http.NewRequest("POST", app.server.URL+"/api/v1/payments",
 				bytes.NewBufferString(body))
 			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("X-Merchant-Access-Key", accessKey)
-			req.Header.Set("X-Signature", signature)
-			req.Header.Set("X-Timestamp", timestamp)
-			req.Header.Set("X-Nonce", nonce)
+			clientauth.SetHeaders(req, accessKey, secretKey, []byte(body), time.Now().Unix(), nonce)
 
 			r, err := http.DefaultClient.Do(req)
 			if err != nil {
@@ -429,3 +393,164 @@ func TestConcurrentIdempotency(t *testing.T) {
 	assert.LessOrEqual(t, balanceResult.Data.Balance, int64(1000000), "balance should not exceed initial topup")
 	_ = expectedMinBalance
 }
+
+// duplicateResult is one response to a concurrent duplicate payment.
+type duplicateResult struct {
+	status int
+	txID   string
+	code   string
+}
+
+// fireDuplicatePayments funds a merchant with 1,000,000 VND, sends n
+// identical payments of 50,000 at once and returns the responses with the
+// final balance.
+func fireDuplicatePayments(t *testing.T, app *testApp, n int) ([]duplicateResult, int64) {
+	t.Helper()
+	accessKey, secretKey := registerAndGetKeys(t, app)
+	token := loginAndGetToken(t, app, "hmac_merchant", "StrongPass123!")
+
+	topupReq, _ := http.NewRequest("POST", app.server.URL+"/api/v1/wallets/topup", bytes.NewBufferString(`{"amount":1000000,"currency":"VND"}`))
+	topupReq.Header.Set("Content-Type", "application/json")
+	topupReq.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(topupReq)
+	require.NoError(t, err)
+	require.Equal(t, 201, resp.StatusCode)
+	resp.Body.Close()
+
+	body := `{"reference_id":"IN-FLIGHT-ORDER-001","amount":50000,"currency":"VND"}`
+	results := make([]duplicateResult, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			req, _ := http.NewRequest("POST", app.server.URL+"/api/v1/payments", bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/json")
+			clientauth.SetHeaders(req, accessKey, secretKey, []byte(body), time.Now().Unix(), fmt.Sprintf("nonce-in-flight-%d", idx))
+
+			r, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return
+			}
+			defer r.Body.Close()
+			var result struct {
+				ErrorCode string `json:"error_code"`
+				Data      struct {
+					ID string `json:"id"`
+				} `json:"data"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&result)
+			results[idx] = duplicateResult{status: r.StatusCode, txID: result.Data.ID, code: result.ErrorCode}
+		}(i)
+	}
+	wg.Wait()
+
+	balanceReq, _ := http.NewRequest("GET", app.server.URL+"/api/v1/wallets/balance", nil)
+	balanceReq.Header.Set("Authorization", "Bearer "+token)
+	resp, err = http.DefaultClient.Do(balanceReq)
+	require.NoError(t, err)
+	var balanceResult struct {
+		Data struct {
+			Balance int64 `json:"balance"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&balanceResult))
+	resp.Body.Close()
+	return results, balanceResult.Data.Balance
+}
+
+// TestConcurrentIdempotency_InFlightBlock verifies that in block mode every
+// duplicate waits for the first request and receives its transaction.
+func TestConcurrentIdempotency_InFlightBlock(t *testing.T) {
+	app := newTestApp(t, withInFlightLock(service.InFlightBlock))
+	defer app.close()
+
+	results, balance := fireDuplicatePayments(t, app, 20)
+
+	txIDs := make(map[string]struct{})
+	for _, r := range results {
+		assert.Contains(t, []int{200, 201}, r.status)
+		txIDs[r.txID] = struct{}{}
+	}
+	assert.Len(t, txIDs, 1, "every duplicate replays the same transaction")
+	assert.Equal(t, int64(950000), balance, "the wallet is charged once")
+}
+
+// TestConcurrentIdempotency_InFlightConflict verifies that in conflict mode
+// duplicates arriving while the first request runs fail with PAY_003.
+func TestConcurrentIdempotency_InFlightConflict(t *testing.T) {
+	app := newTestApp(t, withInFlightLock(service.InFlightConflict))
+	defer app.close()
+
+	results, balance := fireDuplicatePayments(t, app, 20)
+
+	created := 0
+	txIDs := make(map[string]struct{})
+	for _, r := range results {
+		switch r.status {
+		case 201:
+			created++
+			txIDs[r.txID] = struct{}{}
+		case 200:
+			// Arrived after the first finished: an ordinary replay
+			txIDs[r.txID] = struct{}{}
+		case 409:
+			assert.Equal(t, "PAY_003", r.code)
+		default:
+			t.Errorf("unexpected status %d", r.status)
+		}
+	}
+	assert.Equal(t, 1, created)
+	assert.Len(t, txIDs, 1)
+	assert.Equal(t, int64(950000), balance, "the wallet is charged once")
+}
+
+// TestConcurrentPartialRefunds sends partial refunds of one payment that
+// together exceed it, each under its own reference. The payment's row lock
+// serialises them, so only those that fit what is left are made; the read
+// delay makes any refund checked outside the lock act on a stale total.
+func TestConcurrentPartialRefunds(t *testing.T) {
+	app := newTestApp(t, withSumRefundsDelay(20*time.Millisecond))
+	defer app.close()
+
+	// order-001 paid 100,000 of the 1,000,000 topped up
+	accessKey, secretKey, token := payForRefunds(t, app)
+
+	concurrency := 10
+	statuses := make([]int, concurrency)
+	codes := make([]string, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"original_reference_id":"order-001","reference_id":"refund-%03d","amount":30000,"reason":"damaged"}`, idx)
+			req, _ := http.NewRequest("POST", app.server.URL+"/api/v1/payments/refund", bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/json")
+			clientauth.SetHeaders(req, accessKey, secretKey, []byte(body), time.Now().Unix(), fmt.Sprintf("nonce-refund-%d", idx))
+
+			r, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return
+			}
+			defer r.Body.Close()
+			var result struct {
+				ErrorCode string `json:"error_code"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&result)
+			statuses[idx], codes[idx] = r.StatusCode, result.ErrorCode
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for i, status := range statuses {
+		if status == 201 {
+			created++
+			continue
+		}
+		assert.Equal(t, "PAY_007", codes[i], "a refund beyond what is left is refused")
+	}
+	assert.Equal(t, 3, created, "three refunds of 30,000 fit a payment of 100,000")
+	assert.Equal(t, int64(990000), walletBalance(t, app, token), "the payment is never over-refunded")
+}
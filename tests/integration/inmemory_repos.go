@@ -3,7 +3,9 @@ package integration
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"secure-payment-gateway/internal/core/domain"
 	"secure-payment-gateway/internal/core/ports"
@@ -11,6 +13,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/shopspring/decimal"
 )
 
 // --- In-Memory Merchant Repo ---
@@ -24,7 +27,7 @@ func newInMemoryMerchantRepo() *inMemoryMerchantRepo {
 	return &inMemoryMerchantRepo{merchants: make(map[uuid.UUID]*domain.Merchant)}
 }
 
-func (r *inMemoryMerchantRepo) Create(ctx context.Context, m *domain.Merchant) error {
+func (r *inMemoryMerchantRepo) Create(ctx context.Context, tx pgx.Tx, m *domain.Merchant) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	for _, existing := range r.merchants {
@@ -81,20 +84,73 @@ func (r *inMemoryMerchantRepo) Update(ctx context.Context, m *domain.Merchant) e
 	return nil
 }
 
+func (r *inMemoryMerchantRepo) UpdateLastUsedAt(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m, ok := r.merchants[id]
+	if !ok {
+		return fmt.Errorf("merchant not found")
+	}
+	if m.LastUsedAt == nil || m.LastUsedAt.Before(usedAt) {
+		m.LastUsedAt = &usedAt
+	}
+	return nil
+}
+
+func (r *inMemoryMerchantRepo) UpdateLastLoginAt(ctx context.Context, id uuid.UUID, loginAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m, ok := r.merchants[id]
+	if !ok {
+		return fmt.Errorf("merchant not found")
+	}
+	m.LastLoginAt = &loginAt
+	return nil
+}
+
 // --- In-Memory Wallet Repo ---
 
+// inMemoryWalletRepo emulates SELECT ... FOR UPDATE: the ...ForUpdate methods
+// take a per-wallet row lock that is held by the transaction until it
+// commits or rolls back, so concurrent payments serialise as with PostgreSQL.
 type inMemoryWalletRepo struct {
-	mu      sync.RWMutex
-	wallets map[uuid.UUID]*domain.Wallet
+	mu       sync.RWMutex
+	wallets  map[uuid.UUID]*domain.Wallet
+	rowLocks map[uuid.UUID]*sync.Mutex
 }
 
 func newInMemoryWalletRepo() *inMemoryWalletRepo {
-	return &inMemoryWalletRepo{wallets: make(map[uuid.UUID]*domain.Wallet)}
+	return &inMemoryWalletRepo{
+		wallets:  make(map[uuid.UUID]*domain.Wallet),
+		rowLocks: make(map[uuid.UUID]*sync.Mutex),
+	}
+}
+
+// lockRow blocks until tx holds the row lock for walletID.
+func (r *inMemoryWalletRepo) lockRow(tx pgx.Tx, walletID uuid.UUID) error {
+	memTx, ok := tx.(*inMemoryTx)
+	if !ok {
+		return fmt.Errorf("in-memory wallet repo: row locks need an in-memory transaction, got %T", tx)
+	}
+	r.mu.Lock()
+	lock, ok := r.rowLocks[walletID]
+	if !ok {
+		lock = &sync.Mutex{}
+		r.rowLocks[walletID] = lock
+	}
+	r.mu.Unlock()
+	memTx.acquire(lock)
+	return nil
 }
 
 func (r *inMemoryWalletRepo) Create(ctx context.Context, w *domain.Wallet) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	for _, existing := range r.wallets {
+		if existing.MerchantID == w.MerchantID && existing.Currency == w.Currency {
+			return fmt.Errorf("%w: merchant %s, currency %s", domain.ErrWalletExists, w.MerchantID, w.Currency)
+		}
+	}
 	r.wallets[w.ID] = w
 	return nil
 }
@@ -123,13 +179,66 @@ func (r *inMemoryWalletRepo) GetByMerchantID(ctx context.Context, merchantID uui
 }
 
 func (r *inMemoryWalletRepo) GetByMerchantIDForUpdate(ctx context.Context, tx pgx.Tx, merchantID uuid.UUID, currency string) (*domain.Wallet, error) {
-	return r.GetByMerchantID(ctx, merchantID, currency)
+	w, err := r.GetByMerchantID(ctx, merchantID, currency)
+	if err != nil || w == nil {
+		return w, err
+	}
+	return r.GetByIDForUpdate(ctx, tx, w.ID)
 }
 
+// GetByIDForUpdate locks the row, then reads it, so the caller sees every
+// update committed by the previous lock holder.
 func (r *inMemoryWalletRepo) GetByIDForUpdate(ctx context.Context, tx pgx.Tx, id uuid.UUID) (*domain.Wallet, error) {
+	if err := r.lockRow(tx, id); err != nil {
+		return nil, err
+	}
 	return r.GetByID(ctx, id)
 }
 
+func (r *inMemoryWalletRepo) ListByMerchantID(ctx context.Context, merchantID uuid.UUID) ([]domain.Wallet, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var wallets []domain.Wallet
+	for _, w := range r.wallets {
+		if w.MerchantID == merchantID {
+			wallets = append(wallets, *w)
+		}
+	}
+	sort.Slice(wallets, func(i, j int) bool { return wallets[i].Currency < wallets[j].Currency })
+	return wallets, nil
+}
+
+func (r *inMemoryWalletRepo) LockForUpdate(ctx context.Context, tx pgx.Tx, ids ...uuid.UUID) (map[uuid.UUID]*domain.Wallet, error) {
+	wallets := make(map[uuid.UUID]*domain.Wallet, len(ids))
+	for _, id := range domain.WalletLockOrder(ids...) {
+		w, err := r.GetByIDForUpdate(ctx, tx, id)
+		if err != nil {
+			return nil, err
+		}
+		if w != nil {
+			wallets[id] = w
+		}
+	}
+	return wallets, nil
+}
+
+func (r *inMemoryWalletRepo) GetOrCreateForUpdate(ctx context.Context, tx pgx.Tx, w *domain.Wallet) (*domain.Wallet, error) {
+	r.mu.Lock()
+	id := w.ID
+	found := false
+	for _, existing := range r.wallets {
+		if existing.MerchantID == w.MerchantID && existing.Currency == w.Currency {
+			id, found = existing.ID, true
+			break
+		}
+	}
+	if !found {
+		r.wallets[w.ID] = w
+	}
+	r.mu.Unlock()
+	return r.GetByIDForUpdate(ctx, tx, id)
+}
+
 func (r *inMemoryWalletRepo) UpdateBalance(ctx context.Context, tx pgx.Tx, walletID uuid.UUID, encryptedBalance string) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -143,13 +252,23 @@ func (r *inMemoryWalletRepo) UpdateBalance(ctx context.Context, tx pgx.Tx, walle
 
 // --- In-Memory Transaction Repo ---
 
+// inMemoryTransactionRepo takes row locks in GetByIDForUpdate the way
+// inMemoryWalletRepo does, so concurrent refunds of a payment serialise.
 type inMemoryTransactionRepo struct {
 	mu           sync.RWMutex
 	transactions map[uuid.UUID]*domain.Transaction
+	rowLocks     map[uuid.UUID]*sync.Mutex
+
+	// sumRefundsDelay stalls SumRefunds after it reads the total, widening
+	// the window in which concurrent refunds could act on the same total
+	sumRefundsDelay time.Duration
 }
 
 func newInMemoryTransactionRepo() *inMemoryTransactionRepo {
-	return &inMemoryTransactionRepo{transactions: make(map[uuid.UUID]*domain.Transaction)}
+	return &inMemoryTransactionRepo{
+		transactions: make(map[uuid.UUID]*domain.Transaction),
+		rowLocks:     make(map[uuid.UUID]*sync.Mutex),
+	}
 }
 
 func (r *inMemoryTransactionRepo) Create(ctx context.Context, tx pgx.Tx, t *domain.Transaction) error {
@@ -170,16 +289,53 @@ func (r *inMemoryTransactionRepo) GetByID(ctx context.Context, id uuid.UUID) (*d
 	return &copy, nil
 }
 
-func (r *inMemoryTransactionRepo) GetByReference(ctx context.Context, merchantID uuid.UUID, referenceID string) (*domain.Transaction, error) {
+// GetByIDForUpdate locks the row, then reads it, so the caller sees every
+// update committed by the previous lock holder.
+func (r *inMemoryTransactionRepo) GetByIDForUpdate(ctx context.Context, tx pgx.Tx, id uuid.UUID) (*domain.Transaction, error) {
+	memTx, ok := tx.(*inMemoryTx)
+	if !ok {
+		return nil, fmt.Errorf("in-memory transaction repo: row locks need an in-memory transaction, got %T", tx)
+	}
+	r.mu.Lock()
+	lock, ok := r.rowLocks[id]
+	if !ok {
+		lock = &sync.Mutex{}
+		r.rowLocks[id] = lock
+	}
+	r.mu.Unlock()
+	memTx.acquire(lock)
+	return r.GetByID(ctx, id)
+}
+
+func (r *inMemoryTransactionRepo) GetByReference(ctx context.Context, merchantID uuid.UUID, referenceID string, newestFirst bool) (*domain.Transaction, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
+	var found *domain.Transaction
 	for _, t := range r.transactions {
-		if t.MerchantID == merchantID && t.ReferenceID == referenceID {
-			copy := *t
-			return &copy, nil
+		if t.MerchantID != merchantID || t.ReferenceID != referenceID {
+			continue
+		}
+		// Same preference as the postgres repo: the payment, then the oldest
+		// (or newest)
+		if found == nil {
+			found = t
+			continue
+		}
+		isPayment := t.TransactionType == domain.TransactionTypePayment
+		foundPayment := found.TransactionType == domain.TransactionTypePayment
+		preferred := t.CreatedAt.Before(found.CreatedAt)
+		if newestFirst {
+			preferred = t.CreatedAt.After(found.CreatedAt)
+		}
+		if (isPayment && !foundPayment) || (isPayment == foundPayment && preferred) {
+			found = t
 		}
 	}
-	return nil, nil
+	if found == nil {
+		return nil, nil
+	}
+	copy := *found
+	return &copy, nil
 }
 
 func (r *inMemoryTransactionRepo) UpdateStatus(ctx context.Context, tx pgx.Tx, id uuid.UUID, status domain.TransactionStatus) error {
@@ -204,6 +360,60 @@ func (r *inMemoryTransactionRepo) CheckRefundExists(ctx context.Context, origina
 	return false, nil
 }
 
+func (r *inMemoryTransactionRepo) CountRefunds(ctx context.Context, originalTxID uuid.UUID) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var count int64
+	for _, t := range r.transactions {
+		if t.OriginalTransactionID != nil && *t.OriginalTransactionID == originalTxID &&
+			t.TransactionType == domain.TransactionTypeRefund && t.Status != domain.TransactionStatusFailed {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *inMemoryTransactionRepo) SumRefunds(ctx context.Context, originalTxID uuid.UUID) (decimal.Decimal, error) {
+	r.mu.RLock()
+	total := decimal.Zero
+	for _, t := range r.transactions {
+		if t.OriginalTransactionID != nil && *t.OriginalTransactionID == originalTxID &&
+			t.TransactionType == domain.TransactionTypeRefund && t.Status != domain.TransactionStatusFailed {
+			total = total.Add(t.ExactAmount())
+		}
+	}
+	r.mu.RUnlock()
+	time.Sleep(r.sumRefundsDelay)
+	return total, nil
+}
+
+func (r *inMemoryTransactionRepo) SumTopupsSince(ctx context.Context, walletID uuid.UUID, since time.Time) (decimal.Decimal, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	total := decimal.Zero
+	for _, t := range r.transactions {
+		if t.WalletID == walletID && t.TransactionType == domain.TransactionTypeTopup &&
+			t.Status == domain.TransactionStatusSuccess && !t.CreatedAt.Before(since) {
+			total = total.Add(t.ExactAmount())
+		}
+	}
+	return total, nil
+}
+
+func (r *inMemoryTransactionRepo) CountTodayForUpdate(ctx context.Context, tx pgx.Tx, merchantID uuid.UUID) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	y, m, d := time.Now().UTC().Date()
+	dayStart := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	var count int64
+	for _, t := range r.transactions {
+		if t.MerchantID == merchantID && t.TransactionType == domain.TransactionTypePayment && !t.CreatedAt.Before(dayStart) {
+			count++
+		}
+	}
+	return count, nil
+}
+
 func (r *inMemoryTransactionRepo) List(ctx context.Context, params ports.TransactionListParams) ([]domain.Transaction, int64, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -222,12 +432,27 @@ func (r *inMemoryTransactionRepo) List(ctx context.Context, params ports.Transac
 	}
 	total := int64(len(result))
 
-	// Simple pagination
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if params.SortDir == ports.SortAsc {
+			a, b = b, a
+		}
+		if params.SortBy == "amount" && a.Amount != b.Amount {
+			return a.Amount > b.Amount
+		}
+		return a.CreatedAt.After(b.CreatedAt)
+	})
+
+	// Simple pagination; without a total, one extra row shows a next page
+	limit := params.PageSize
+	if params.SkipTotal {
+		total, limit = 0, limit+1
+	}
 	start := (params.Page - 1) * params.PageSize
 	if start >= len(result) {
 		return []domain.Transaction{}, total, nil
 	}
-	end := start + params.PageSize
+	end := start + limit
 	if end > len(result) {
 		end = len(result)
 	}
@@ -257,11 +482,11 @@ func (r *inMemoryTransactionRepo) GetStats(ctx context.Context, merchantID uuid.
 		if t.Status == domain.TransactionStatusSuccess {
 			switch t.TransactionType {
 			case domain.TransactionTypePayment:
-				stats.TotalRevenue += t.Amount
+				stats.TotalRevenue = stats.TotalRevenue.Add(t.ExactAmount())
 			case domain.TransactionTypeRefund:
-				stats.TotalRefunded += t.Amount
+				stats.TotalRefunded = stats.TotalRefunded.Add(t.ExactAmount())
 			case domain.TransactionTypeTopup:
-				stats.TotalTopup += t.Amount
+				stats.TotalTopup = stats.TotalTopup.Add(t.ExactAmount())
 			}
 		}
 	}
@@ -297,7 +522,53 @@ func (r *inMemoryIdempotencyRepo) Get(ctx context.Context, key string) (*domain.
 	return &copy, nil
 }
 
-// --- In-Memory Transactor (no-op tx) ---
+func (r *inMemoryIdempotencyRepo) DeleteOlderThan(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deleted int64
+	for key, l := range r.logs {
+		if l.CreatedAt.Before(before) {
+			delete(r.logs, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// --- In-Memory Audit Repo ---
+
+// inMemoryAuditRepo keeps every entry it is given; unlike the audit_logs
+// table it does not drop duplicate request IDs, so tests see every write.
+type inMemoryAuditRepo struct {
+	mu      sync.Mutex
+	entries []domain.AuditLog
+}
+
+func newInMemoryAuditRepo() *inMemoryAuditRepo {
+	return &inMemoryAuditRepo{}
+}
+
+func (r *inMemoryAuditRepo) Create(ctx context.Context, log *domain.AuditLog) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, *log)
+	return nil
+}
+
+// byAction returns the stored entries with the given action.
+func (r *inMemoryAuditRepo) byAction(action domain.AuditAction) []domain.AuditLog {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []domain.AuditLog
+	for _, e := range r.entries {
+		if e.Action == action {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// --- In-Memory Transactor ---
 
 type inMemoryTransactor struct{}
 
@@ -306,7 +577,56 @@ func newInMemoryTransactor() *inMemoryTransactor {
 }
 
 func (t *inMemoryTransactor) Begin(ctx context.Context) (pgx.Tx, error) {
-	return &noopTx{}, nil
+	return &inMemoryTx{}, nil
+}
+
+// inMemoryTx holds the row locks taken by in-memory repos and releases them
+// on Commit or Rollback. Writes are applied immediately and are not undone
+// on rollback.
+type inMemoryTx struct {
+	noopTx
+
+	mu   sync.Mutex
+	held []*sync.Mutex
+}
+
+// acquire takes lock for the rest of the transaction. Re-locking a row the
+// transaction already holds is a no-op, as in PostgreSQL.
+func (t *inMemoryTx) acquire(lock *sync.Mutex) {
+	t.mu.Lock()
+	for _, h := range t.held {
+		if h == lock {
+			t.mu.Unlock()
+			return
+		}
+	}
+	t.mu.Unlock()
+
+	lock.Lock()
+	t.mu.Lock()
+	t.held = append(t.held, lock)
+	t.mu.Unlock()
+}
+
+// release unlocks every held row; later calls are no-ops, so the usual
+// Commit followed by a deferred Rollback is safe.
+func (t *inMemoryTx) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, lock := range t.held {
+		lock.Unlock()
+	}
+	t.held = nil
+}
+
+func (t *inMemoryTx) Commit(ctx context.Context) error {
+	t.release()
+	return nil
+}
+
+func (t *inMemoryTx) Rollback(ctx context.Context) error {
+	t.release()
+	return nil
 }
 
 // noopTx is a no-op pgx.Tx implementation for in-memory testing.
@@ -0,0 +1,54 @@
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"secure-payment-gateway/internal/core/domain"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemoryWalletRepo_ForUpdateBlocksUntilCommit(t *testing.T) {
+	ctx := context.Background()
+	repo := newInMemoryWalletRepo()
+	transactor := newInMemoryTransactor()
+	w := &domain.Wallet{ID: uuid.New(), MerchantID: uuid.New(), Currency: "VND", EncryptedBalance: "v1"}
+	require.NoError(t, repo.Create(ctx, w))
+
+	first, err := transactor.Begin(ctx)
+	require.NoError(t, err)
+	_, err = repo.GetByMerchantIDForUpdate(ctx, first, w.MerchantID, "VND")
+	require.NoError(t, err)
+	// Re-locking within the same transaction must not deadlock
+	_, err = repo.GetByIDForUpdate(ctx, first, w.ID)
+	require.NoError(t, err)
+
+	seen := make(chan string, 1)
+	go func() {
+		second, _ := transactor.Begin(ctx)
+		defer second.Rollback(ctx) //nolint:errcheck
+		locked, _ := repo.GetByIDForUpdate(ctx, second, w.ID)
+		seen <- locked.EncryptedBalance
+	}()
+
+	select {
+	case <-seen:
+		t.Fatal("second transaction acquired the row lock while the first held it")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	require.NoError(t, repo.UpdateBalance(ctx, first, w.ID, "v2"))
+	require.NoError(t, first.Commit(ctx))
+	require.NoError(t, first.Rollback(ctx)) // deferred Rollback after Commit is a no-op
+
+	select {
+	case balance := <-seen:
+		assert.Equal(t, "v2", balance, "the waiter reads the committed update")
+	case <-time.After(time.Second):
+		t.Fatal("row lock was not released on commit")
+	}
+}
@@ -0,0 +1,423 @@
+//go:build integration
+
+// Postgres-backed integration tests. They start PostgreSQL in a container via
+// testcontainers (Docker required), apply db/migrations, and run the full
+// stack against the real repositories so SELECT ... FOR UPDATE and the
+// idempotency log constraints are exercised for real.
+//
+//	make test-integration
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	httpHandler "secure-payment-gateway/internal/adapter/http/handler"
+	pgStorage "secure-payment-gateway/internal/adapter/storage/postgres"
+	redisStorage "secure-payment-gateway/internal/adapter/storage/redis"
+	"secure-payment-gateway/internal/core/domain"
+	"secure-payment-gateway/internal/service"
+	"secure-payment-gateway/pkg/clientauth"
+	"secure-payment-gateway/pkg/logger"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	tcpostgres "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// pgTestApp is newTestApp with PostgreSQL repositories instead of in-memory ones.
+type pgTestApp struct {
+	server *httptest.Server
+	pool   *pgxpool.Pool
+}
+
+func newPGTestApp(t *testing.T) *pgTestApp {
+	t.Helper()
+	ctx := context.Background()
+
+	ctr, err := tcpostgres.Run(ctx, "postgres:16-alpine",
+		tcpostgres.WithDatabase("payment_gateway"),
+		tcpostgres.WithUsername("postgres"),
+		tcpostgres.WithPassword("postgres"),
+		testcontainers.WithWaitStrategy(
+			wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).
+				WithStartupTimeout(60*time.Second),
+		),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = testcontainers.TerminateContainer(ctr) })
+
+	dsn, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+	pool, err := pgxpool.New(ctx, dsn)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+	applyMigrations(t, pool)
+
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	t.Cleanup(mr.Close)
+	rdb := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	idempotencyCache := redisStorage.NewIdempotencyCache(rdb)
+	nonceStore := redisStorage.NewNonceStore(rdb)
+
+	encSvc, err := service.NewAESEncryptionService("0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+	require.NoError(t, err)
+	sigSvc := service.NewHMACSignatureService()
+	hashSvc := service.NewArgon2HashService()
+	tokenSvc := service.NewJWTTokenService("test-jwt-secret-key-32bytes!!", 24*time.Hour, "test-issuer")
+
+	merchantRepo := pgStorage.NewMerchantRepo(pool)
+	walletRepo := pgStorage.NewWalletRepo(pool)
+	txRepo := pgStorage.NewTransactionRepo(pool)
+	idempotencyRepo := pgStorage.NewIdempotencyRepo(pool)
+	transactor := pgStorage.NewTransactor(pool)
+
+	log := logger.New("warn", false)
+	authSvc := service.NewAuthService(merchantRepo, walletRepo, transactor, hashSvc, encSvc, tokenSvc)
+	paymentSvc := service.NewPaymentService(txRepo, walletRepo, idempotencyRepo, idempotencyCache, encSvc, transactor, log)
+	reportingSvc := service.NewReportingService(txRepo, walletRepo, encSvc, service.WithPrimaryCurrencies(merchantRepo))
+
+	router := httpHandler.SetupRouter(httpHandler.RouterDeps{
+		AuthSvc:      authSvc,
+		PaymentSvc:   paymentSvc,
+		ReportingSvc: reportingSvc,
+		MerchantRepo: merchantRepo,
+		EncSvc:       encSvc,
+		SigSvc:       sigSvc,
+		NonceStore:   nonceStore,
+		TokenSvc:     tokenSvc,
+		Logger:       log,
+	})
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	return &pgTestApp{server: server, pool: pool}
+}
+
+// applyMigrations runs every db/migrations/*.up.sql file in order.
+func applyMigrations(t *testing.T, pool *pgxpool.Pool) {
+	t.Helper()
+	files, err := filepath.Glob("../../db/migrations/*.up.sql")
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+	sort.Strings(files)
+
+	for _, f := range files {
+		sql, err := os.ReadFile(f)
+		require.NoError(t, err)
+		// No arguments: pgx uses the simple protocol, which allows multiple statements
+		_, err = pool.Exec(context.Background(), string(sql))
+		require.NoError(t, err, filepath.Base(f))
+	}
+}
+
+// pgMerchant is a registered, logged-in merchant with a topped-up wallet.
+type pgMerchant struct {
+	accessKey, secretKey, token string
+}
+
+func (a *pgTestApp) setupMerchant(t *testing.T, username string, topup int64) pgMerchant {
+	t.Helper()
+	var m pgMerchant
+
+	regBody := fmt.Sprintf(`{"username":%q,"password":"StrongPass123!","merchant_name":"PG Test"}`, username)
+	resp, err := http.Post(a.server.URL+"/api/v1/auth/register", "application/json", bytes.NewBufferString(regBody))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var reg struct {
+		Data struct {
+			AccessKey string `json:"access_key"`
+			SecretKey string `json:"secret_key"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&reg))
+	resp.Body.Close()
+	m.accessKey, m.secretKey = reg.Data.AccessKey, reg.Data.SecretKey
+
+	loginBody := fmt.Sprintf(`{"username":%q,"password":"StrongPass123!"}`, username)
+	resp, err = http.Post(a.server.URL+"/api/v1/auth/login", "application/json", bytes.NewBufferString(loginBody))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var login struct {
+		Data struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&login))
+	resp.Body.Close()
+	m.token = login.Data.Token
+
+	topupBody := fmt.Sprintf(`{"amount":%d,"currency":"VND"}`, topup)
+	req, _ := http.NewRequest(http.MethodPost, a.server.URL+"/api/v1/wallets/topup", bytes.NewBufferString(topupBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+m.token)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
+
+	return m
+}
+
+// pay sends a signed payment and returns the HTTP status.
+func (a *pgTestApp) pay(m pgMerchant, refID string, amount int64, nonce string) (int, error) {
+	body := fmt.Sprintf(`{"reference_id":%q,"amount":%d,"currency":"VND"}`, refID, amount)
+	req, _ := http.NewRequest(http.MethodPost, a.server.URL+"/api/v1/payments", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	clientauth.SetHeaders(req, m.accessKey, m.secretKey, []byte(body), time.Now().Unix(), nonce)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.ReadAll(resp.Body)
+	return resp.StatusCode, nil
+}
+
+func (a *pgTestApp) balance(t *testing.T, m pgMerchant) int64 {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, a.server.URL+"/api/v1/wallets/balance", nil)
+	req.Header.Set("Authorization", "Bearer "+m.token)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var result struct {
+		Data struct {
+			Balance int64 `json:"balance"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	return result.Data.Balance
+}
+
+func (a *pgTestApp) countPayments(t *testing.T, refPrefix string) int {
+	t.Helper()
+	var n int
+	err := a.pool.QueryRow(context.Background(),
+		`SELECT COUNT(*) FROM transactions WHERE transaction_type = 'PAYMENT' AND status = 'SUCCESS' AND reference_id LIKE $1`,
+		refPrefix+"%").Scan(&n)
+	require.NoError(t, err)
+	return n
+}
+
+// walletID returns the ID of m's VND wallet.
+func (a *pgTestApp) walletID(t *testing.T, m pgMerchant) uuid.UUID {
+	t.Helper()
+	var id uuid.UUID
+	err := a.pool.QueryRow(context.Background(),
+		`SELECT w.id FROM wallets w JOIN merchants m ON m.id = w.merchant_id WHERE m.access_key = $1 AND w.currency = 'VND'`,
+		m.accessKey).Scan(&id)
+	require.NoError(t, err)
+	return id
+}
+
+// TestPostgres_ConcurrentOverspend fires more payments than the balance
+// covers; SELECT ... FOR UPDATE must let exactly the affordable ones through.
+func TestPostgres_ConcurrentOverspend(t *testing.T) {
+	app := newPGTestApp(t)
+	m := app.setupMerchant(t, "pg_overspend", 500000)
+
+	const concurrency = 20
+	var wg sync.WaitGroup
+	var succeeded, insufficient, other atomic.Int64
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			status, err := app.pay(m, fmt.Sprintf("PG-OVERSPEND-%d", idx), 100000, fmt.Sprintf("pg-overspend-%d-%d", idx, time.Now().UnixNano()))
+			switch {
+			case err != nil:
+				other.Add(1)
+			case status == http.StatusCreated:
+				succeeded.Add(1)
+			case status == http.StatusPaymentRequired:
+				insufficient.Add(1)
+			default:
+				other.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(5), succeeded.Load())
+	assert.Equal(t, int64(concurrency-5), insufficient.Load())
+	assert.Zero(t, other.Load())
+	assert.Equal(t, int64(0), app.balance(t, m))
+	assert.Equal(t, 5, app.countPayments(t, "PG-OVERSPEND-"))
+}
+
+// TestPostgres_ConcurrentIdempotency sends the same reference concurrently;
+// the idempotency log's primary key must leave exactly one committed payment
+// and one deduction, whatever status the racing duplicates get.
+func TestPostgres_ConcurrentIdempotency(t *testing.T) {
+	app := newPGTestApp(t)
+	m := app.setupMerchant(t, "pg_idempotency", 1000000)
+
+	const concurrency = 20
+	var wg sync.WaitGroup
+	var succeeded atomic.Int64
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			status, err := app.pay(m, "PG-IDEMPOTENT-001", 50000, fmt.Sprintf("pg-idemp-%d-%d", idx, time.Now().UnixNano()))
+			if err == nil && status == http.StatusCreated {
+				succeeded.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.GreaterOrEqual(t, succeeded.Load(), int64(1))
+	assert.Equal(t, 1, app.countPayments(t, "PG-IDEMPOTENT-001"))
+	assert.Equal(t, int64(950000), app.balance(t, m))
+}
+
+// TestPostgres_OppositeLockOrderDoesNotDeadlock locks the same two wallets
+// from two transactions at once, passing them in opposite orders. With
+// LockForUpdate's canonical order one simply waits for the other; in caller
+// order Postgres would abort one of them with a deadlock error (40P01).
+func TestPostgres_OppositeLockOrderDoesNotDeadlock(t *testing.T) {
+	app := newPGTestApp(t)
+	a := app.walletID(t, app.setupMerchant(t, "pg_lock_a", 1000))
+	b := app.walletID(t, app.setupMerchant(t, "pg_lock_b", 1000))
+	repo := pgStorage.NewWalletRepo(app.pool)
+	ctx := context.Background()
+
+	for round := 0; round < 10; round++ {
+		start := make(chan struct{})
+		errs := make(chan error, 2)
+		var wg sync.WaitGroup
+		for _, ids := range [][]uuid.UUID{{a, b}, {b, a}} {
+			wg.Add(1)
+			go func(ids []uuid.UUID) {
+				defer wg.Done()
+				tx, err := app.pool.Begin(ctx)
+				if err != nil {
+					errs <- err
+					return
+				}
+				defer tx.Rollback(ctx) //nolint:errcheck
+
+				<-start
+				wallets, err := repo.LockForUpdate(ctx, tx, ids...)
+				if err == nil && len(wallets) != 2 {
+					err = fmt.Errorf("locked %d of 2 wallets", len(wallets))
+				}
+				if err == nil {
+					time.Sleep(20 * time.Millisecond) // hold both locks while the other waits
+					err = tx.Commit(ctx)
+				}
+				errs <- err
+			}(ids)
+		}
+		close(start)
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			require.NoError(t, err, "round %d", round)
+		}
+	}
+}
+
+// TestPostgres_SumRefunds sums every partial refund of a payment, converting
+// a cross-currency one back at its rate, and leaves out failed ones.
+func TestPostgres_SumRefunds(t *testing.T) {
+	app := newPGTestApp(t)
+	m := app.setupMerchant(t, "pg_sum_refunds", 100000)
+	status, err := app.pay(m, "PG-SUM-REFUNDS", 60000, fmt.Sprintf("pg-sum-refunds-%d", time.Now().UnixNano()))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, status)
+
+	ctx := context.Background()
+	var paymentID, merchantID, walletID uuid.UUID
+	require.NoError(t, app.pool.QueryRow(ctx,
+		`SELECT id, merchant_id, wallet_id FROM transactions WHERE reference_id = 'PG-SUM-REFUNDS' AND transaction_type = 'PAYMENT'`,
+	).Scan(&paymentID, &merchantID, &walletID))
+
+	refund := func(amount int64, status string) {
+		t.Helper()
+		_, err := app.pool.Exec(ctx,
+			`INSERT INTO transactions (reference_id, merchant_id, wallet_id, amount, amount_encrypted, transaction_type, status, signature, original_transaction_id)
+			VALUES ('REFUND-PG-SUM-REFUNDS', $1, $2, $3, 'enc', 'REFUND', $4, 'sig', $5)`,
+			merchantID, walletID, amount, status, paymentID)
+		require.NoError(t, err)
+	}
+	refund(10000, "SUCCESS")
+	refund(15000, "SUCCESS")
+	refund(5000, "SUCCESS")
+	refund(20000, "FAILED")
+
+	total, err := pgStorage.NewTransactionRepo(app.pool).SumRefunds(ctx, paymentID)
+	require.NoError(t, err)
+	assert.True(t, decimal.NewFromInt(30000).Equal(total), "total = %s", total)
+}
+
+func TestPostgres_DeleteOldWebhookLogs(t *testing.T) {
+	app := newPGTestApp(t)
+	m := app.setupMerchant(t, "pg_webhook_cleanup", 100000)
+	status, err := app.pay(m, "PG-WEBHOOK-CLEANUP", 1000, fmt.Sprintf("pg-webhook-cleanup-%d", time.Now().UnixNano()))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, status)
+
+	ctx := context.Background()
+	var txID, merchantID uuid.UUID
+	require.NoError(t, app.pool.QueryRow(ctx,
+		`SELECT id, merchant_id FROM transactions WHERE reference_id = 'PG-WEBHOOK-CLEANUP'`,
+	).Scan(&txID, &merchantID))
+	_, err = app.pool.Exec(ctx, `DELETE FROM webhook_delivery_logs WHERE transaction_id = $1`, txID)
+	require.NoError(t, err)
+
+	logAt := func(status domain.WebhookStatus, age time.Duration) {
+		t.Helper()
+		_, err := app.pool.Exec(ctx,
+			`INSERT INTO webhook_delivery_logs (transaction_id, merchant_id, webhook_url, payload, status, updated_at)
+			VALUES ($1, $2, 'https://example.com/webhook', '{}', $3, $4)`,
+			txID, merchantID, string(status), time.Now().Add(-age))
+		require.NoError(t, err)
+	}
+	logAt(domain.WebhookStatusDelivered, 48*time.Hour)
+	logAt(domain.WebhookStatusDelivered, time.Hour)
+	logAt(domain.WebhookStatusFailed, 48*time.Hour)
+	logAt(domain.WebhookStatusPending, 48*time.Hour)
+
+	repo := pgStorage.NewWebhookRepository(app.pool)
+	deleted, err := repo.DeleteOlderThan(ctx, domain.WebhookStatusDelivered, time.Now().Add(-24*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted, "only the old delivered log")
+
+	logs, err := repo.GetByTransactionID(ctx, txID)
+	require.NoError(t, err)
+	remaining := map[domain.WebhookStatus]int{}
+	for _, l := range logs {
+		remaining[l.Status]++
+	}
+	assert.Equal(t, map[domain.WebhookStatus]int{
+		domain.WebhookStatusDelivered: 1,
+		domain.WebhookStatusFailed:    1,
+		domain.WebhookStatusPending:   1,
+	}, remaining)
+}